@@ -0,0 +1,159 @@
+// Package bench holds reproducible micro-benchmarks of the hot cache path of
+// the client: serialization of query results into cache items,
+// deserialization back, merging of partial results and semantic segment
+// generation. Every benchmark runs over synthetic results of a Shape, so the
+// numbers only depend on the code and the shape. No database or cache
+// server is needed: Segment uses the schema of its Shape instead of the one
+// of the default connection.
+//
+// The benchmarks run with "go test -bench . ./bench/", or from a program
+// with Run, which can also write CPU and heap profiles.
+package bench
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"testing"
+
+	client "github.com/InfluxDB-client/v2"
+)
+
+// Benchmark is one operation of the cache path measured over a Shape.
+type Benchmark struct {
+	Name string
+	Run  func(b *testing.B, s Shape)
+}
+
+// Benchmarks lists every benchmark of the package.
+var Benchmarks = []Benchmark{
+	{Name: "serialize", Run: Serialize},
+	{Name: "deserialize", Run: Deserialize},
+	{Name: "merge", Run: Merge},
+	{Name: "segment", Run: Segment},
+}
+
+// Serialize measures converting a result into a cache item.
+func Serialize(b *testing.B, s Shape) {
+	resp, segments := s.Response(), s.Segments()
+	b.SetBytes(int64(len(resp.ToByteArrayWithSegments(segments))))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		resp.ToByteArrayWithSegments(segments)
+	}
+}
+
+// Deserialize measures converting a cache item, as returned by Get, back
+// into a result.
+func Deserialize(b *testing.B, s Shape) {
+	data := append(s.Response().ToByteArrayWithSegments(s.Segments()), "\r\n"...)
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		client.ByteArrayToResponse(data)
+	}
+}
+
+// Merge measures merging the results of four queries of adjacent time
+// ranges into one.
+func Merge(b *testing.B, s Shape) {
+	parts := s.Split(4)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		client.Merge(s.mergePrecision(), shallowCopy(parts)...) // Merge replaces the tables of the results it merges
+	}
+}
+
+// Segment measures generating the semantic segment of a result.
+func Segment(b *testing.B, s Shape) {
+	defer client.SetSchema(client.SetSchema(s.Schema()))
+	resp, query := s.Response(), s.Query()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		client.SemanticSegment(query, resp)
+	}
+}
+
+// shallowCopy copies the results down to their tables, sharing the rows.
+func shallowCopy(resps []*client.Response) []*client.Response {
+	copies := make([]*client.Response, 0, len(resps))
+	for _, resp := range resps {
+		c := *resp
+		c.Results = append([]client.Result(nil), resp.Results...)
+		for i := range c.Results {
+			c.Results[i].Series = append(c.Results[i].Series[:0:0], c.Results[i].Series...)
+		}
+		copies = append(copies, &c)
+	}
+	return copies
+}
+
+// Options configures Run. Empty profile paths write no profile.
+type Options struct {
+	CPUProfile string // CPU profile of all the benchmarks
+	MemProfile string // heap profile after the benchmarks
+}
+
+// Result is the measurement of one benchmark over one shape.
+type Result struct {
+	Name  string
+	Shape Shape
+	testing.BenchmarkResult
+}
+
+// String formats the result like "go test -bench".
+func (r Result) String() string {
+	return fmt.Sprintf("%s/%s\t%s\t%s", r.Name, r.Shape, r.BenchmarkResult.String(), r.MemString())
+}
+
+// Run runs every benchmark of Benchmarks over every shape.
+func Run(shapes []Shape, opts Options) ([]Result, error) {
+	results := make([]Result, 0, len(Benchmarks)*len(shapes))
+	err := Profile(opts, func() {
+		for _, bm := range Benchmarks {
+			for _, s := range shapes {
+				run := bm.Run
+				shape := s
+				r := testing.Benchmark(func(b *testing.B) { run(b, shape) })
+				results = append(results, Result{Name: bm.Name, Shape: shape, BenchmarkResult: r})
+			}
+		}
+	})
+	return results, err
+}
+
+// Profile runs fn, writing a CPU profile of it and a heap profile after it
+// to the paths of opts.
+func Profile(opts Options, fn func()) error {
+	if opts.CPUProfile != "" {
+		f, err := os.Create(opts.CPUProfile)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		if err := pprof.StartCPUProfile(f); err != nil {
+			return err
+		}
+		defer pprof.StopCPUProfile()
+	}
+
+	fn()
+
+	if opts.MemProfile != "" {
+		f, err := os.Create(opts.MemProfile)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		runtime.GC() // up to date statistics
+		if err := pprof.WriteHeapProfile(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
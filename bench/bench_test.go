@@ -0,0 +1,83 @@
+package bench
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	client "github.com/InfluxDB-client/v2"
+)
+
+var shapes = []Shape{
+	DefaultShape.WithSize(4, 100),
+	DefaultShape,
+	DefaultShape.WithSize(16, 10000),
+}
+
+func benchmarkShapes(b *testing.B, run func(b *testing.B, s Shape)) {
+	for _, s := range shapes {
+		b.Run(s.String(), func(b *testing.B) { run(b, s) })
+	}
+}
+
+func BenchmarkSerialize(b *testing.B)   { benchmarkShapes(b, Serialize) }
+func BenchmarkDeserialize(b *testing.B) { benchmarkShapes(b, Deserialize) }
+func BenchmarkMerge(b *testing.B)       { benchmarkShapes(b, Merge) }
+func BenchmarkSegment(b *testing.B)     { benchmarkShapes(b, Segment) }
+
+func TestShape(t *testing.T) {
+	s := DefaultShape.WithSize(3, 10)
+	resp := s.Response()
+
+	/* 相同的 Shape 得到相同的结果 */
+	if !reflect.DeepEqual(resp, s.Response()) {
+		t.Error("responses of the same shape differ")
+	}
+	if len(resp.Results[0].Series) != 3 || len(resp.Results[0].Series[2].Values) != 10 {
+		t.Errorf("response:\n%s", resp.ToString())
+	}
+
+	/* 语义段和结果中的表一一对应，转换回来的结果再转换成相同的字节数组 */
+	data := resp.ToByteArrayWithSegments(s.Segments())
+	converted := client.ByteArrayToResponse(append(data, "\r\n"...))
+	if again := converted.ToByteArrayWithSegments(s.Segments()); !reflect.DeepEqual(again, data) {
+		t.Errorf("converted:\n%s\nexpected:\n%s", converted.ToString(), resp.ToString())
+	}
+
+	/* 用 Shape 的 schema 生成的语义段和 Segments 相同 */
+	defer client.SetSchema(client.SetSchema(s.Schema()))
+	if segments := client.SeperateSemanticSegment(s.Query(), resp); !reflect.DeepEqual(segments, s.Segments()) {
+		t.Errorf("segments:\n%v\nexpected:\n%v", segments, s.Segments())
+	}
+
+	/* 拆开的结果按时间顺序覆盖所有行 */
+	rows := 0
+	for _, part := range s.Split(3) {
+		rows += len(part.Results[0].Series[0].Values)
+	}
+	if rows != 10 {
+		t.Errorf("rows:\t%d\nexpected:\t%d", rows, 10)
+	}
+	merged := client.Merge(s.mergePrecision(), shallowCopy(s.Split(3))...)
+	if len(merged) != 1 || !client.ResponsesEqual(merged[0], resp, client.CompareOptions{}) {
+		t.Errorf("merged %d results", len(merged))
+	}
+}
+
+func TestProfile(t *testing.T) {
+	dir := t.TempDir()
+	opts := Options{CPUProfile: filepath.Join(dir, "cpu.pprof"), MemProfile: filepath.Join(dir, "mem.pprof")}
+	ran := false
+	if err := Profile(opts, func() { ran = true }); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !ran {
+		t.Error("function was not run")
+	}
+	for _, path := range []string{opts.CPUProfile, opts.MemProfile} {
+		if info, err := os.Stat(path); err != nil || info.Size() == 0 {
+			t.Errorf("profile %s was not written: %v", path, err)
+		}
+	}
+}
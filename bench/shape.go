@@ -0,0 +1,186 @@
+package bench
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+
+	client "github.com/InfluxDB-client/v2"
+	"github.com/influxdata/influxdb1-client/models"
+	"github.com/influxdata/influxql"
+)
+
+// Field is a field column of a synthetic response. Type is one of the data
+// types of semantic segments: float64, int64, string or bool.
+type Field struct {
+	Name string
+	Type string
+}
+
+// Shape describes a synthetic query result: Series tables of Rows rows
+// each, one per value of the "location" tag, with a row every Interval
+// starting at Start. Responses of the same Shape, including Seed, are
+// identical, so benchmark runs can be compared.
+type Shape struct {
+	Measurement string
+	Series      int
+	Rows        int
+	Fields      []Field
+	Start       time.Time
+	Interval    time.Duration
+	Seed        int64
+}
+
+// DefaultShape is a result of the size of a typical dashboard panel.
+var DefaultShape = Shape{
+	Measurement: "h2o_feet",
+	Series:      4,
+	Rows:        1000,
+	Fields: []Field{
+		{Name: "index", Type: "int64"},
+		{Name: "water_level", Type: "float64"},
+		{Name: "level description", Type: "string"},
+	},
+	Start:    time.Date(2019, 8, 18, 0, 0, 0, 0, time.UTC),
+	Interval: time.Minute,
+	Seed:     1,
+}
+
+// String identifies the shape in benchmark names.
+func (s Shape) String() string {
+	return fmt.Sprintf("series=%d/rows=%d/fields=%d", s.Series, s.Rows, len(s.Fields))
+}
+
+// WithSize returns a copy of s with series tables of rows rows.
+func (s Shape) WithSize(series, rows int) Shape {
+	s.Series, s.Rows = series, rows
+	return s
+}
+
+// location is the tag value of table i.
+func (s Shape) location(i int) string {
+	return fmt.Sprintf("location_%03d", i)
+}
+
+// Response returns the synthetic result, with json.Number timestamps in
+// nanoseconds like a query with epoch "ns".
+func (s Shape) Response() *client.Response {
+	rng := rand.New(rand.NewSource(s.Seed))
+	columns := []string{"time"}
+	for _, f := range s.Fields {
+		columns = append(columns, f.Name)
+	}
+	resp := &client.Response{Results: []client.Result{{}}}
+	for i := 0; i < s.Series; i++ {
+		values := make([][]interface{}, 0, s.Rows)
+		for j := 0; j < s.Rows; j++ {
+			row := make([]interface{}, 0, len(columns))
+			row = append(row, json.Number(strconv.FormatInt(s.Start.Add(time.Duration(j)*s.Interval).UnixNano(), 10)))
+			for _, f := range s.Fields {
+				row = append(row, randomValue(rng, f.Type))
+			}
+			values = append(values, row)
+		}
+		resp.Results[0].Series = append(resp.Results[0].Series, models.Row{
+			Name:    s.Measurement,
+			Tags:    map[string]string{"location": s.location(i)},
+			Columns: columns,
+			Values:  values,
+		})
+	}
+	return resp
+}
+
+// randomValue returns a value of the data type as decoded from InfluxDB.
+func randomValue(rng *rand.Rand, datatype string) interface{} {
+	switch datatype {
+	case "int64":
+		return json.Number(strconv.Itoa(rng.Intn(100)))
+	case "float64":
+		return json.Number(strconv.FormatFloat(rng.Float64()*10, 'f', 3, 64))
+	case "bool":
+		return rng.Intn(2) == 1
+	}
+	return fmt.Sprintf("between %d and %d feet", rng.Intn(6), 6+rng.Intn(4))
+}
+
+// Query returns a query whose result has the shape of Response, for
+// segment generation.
+func (s Shape) Query() string {
+	fields := make([]string, 0, len(s.Fields))
+	for _, f := range s.Fields {
+		fields = append(fields, influxql.QuoteIdent(f.Name))
+	}
+	end := s.Start.Add(time.Duration(s.Rows-1) * s.Interval)
+	return fmt.Sprintf("SELECT %s FROM %s WHERE time >= '%s' AND time <= '%s' GROUP BY location",
+		strings.Join(fields, ","), influxql.QuoteIdent(s.Measurement), s.Start.Format(time.RFC3339Nano), end.Format(time.RFC3339Nano))
+}
+
+// Schema returns the schema of the measurement of Response, with the
+// "location" tag and its values.
+func (s Shape) Schema() *client.Schema {
+	names := make([]string, 0, len(s.Fields))
+	types := make(map[string]string, len(s.Fields))
+	for _, f := range s.Fields {
+		names = append(names, f.Name)
+		types[f.Name] = f.Type
+	}
+	locations := make([]string, 0, s.Series)
+	for i := 0; i < s.Series; i++ {
+		locations = append(locations, s.location(i))
+	}
+	return &client.Schema{
+		TagKV: client.MeasurementTagMap{Measurement: map[string][]client.TagKeyMap{
+			s.Measurement: {{Tag: map[string]client.TagValues{"location": {Values: locations}}}},
+		}},
+		Fields:     map[string][]string{s.Measurement: names},
+		FieldTypes: map[string]map[string]string{s.Measurement: types},
+	}
+}
+
+// Segments returns the semantic segment of every table of Response.
+func (s Shape) Segments() []string {
+	sf := make([]string, 0, len(s.Fields))
+	for _, f := range s.Fields {
+		sf = append(sf, fmt.Sprintf("%s[%s]", strings.ReplaceAll(f.Name, " ", "%20"), f.Type))
+	}
+	segments := make([]string, 0, s.Series)
+	for i := 0; i < s.Series; i++ {
+		segments = append(segments, fmt.Sprintf("{(%s.location=%s)}#{%s}#{empty}#{empty,empty}", s.Measurement, s.location(i), strings.Join(sf, ",")))
+	}
+	return segments
+}
+
+// Split returns the result of Response cut in n consecutive time ranges,
+// as returned by n queries of adjacent ranges, for merging.
+func (s Shape) Split(n int) []*client.Response {
+	resp := s.Response()
+	parts := make([]*client.Response, 0, n)
+	for k := 0; k < n; k++ {
+		from, to := k*s.Rows/n, (k+1)*s.Rows/n
+		part := &client.Response{Results: []client.Result{{}}}
+		for _, series := range resp.Results[0].Series {
+			series.Values = series.Values[from:to]
+			part.Results[0].Series = append(part.Results[0].Series, series)
+		}
+		parts = append(parts, part)
+	}
+	return parts
+}
+
+// mergePrecision is the finest precision for which Merge joins results one
+// Interval apart.
+func (s Shape) mergePrecision() string {
+	for _, p := range []struct {
+		precision string
+		unit      time.Duration
+	}{{"ns", time.Nanosecond}, {"us", time.Microsecond}, {"ms", time.Millisecond}, {"s", time.Second}, {"m", time.Minute}} {
+		if s.Interval <= p.unit {
+			return p.precision
+		}
+	}
+	return "h"
+}
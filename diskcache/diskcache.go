@@ -0,0 +1,413 @@
+// Package diskcache 是把数据存放在磁盘上的单机cache服务：数据存放在 BoltDB 文件中，进程重启之后仍然保留，
+// 单机部署时不需要运行 fatcache 一类的守护进程。它实现了 memcache 客户端使用的 fatcache 协议
+// （set、get、getf、delete、flush_all、version），时间范围的语义和 fatcache 相同，客户端不需要修改：
+//
+//	s, err := diskcache.Listen("cache.db", "127.0.0.1:11213")
+//	mc := memcache.New(s.Addr())
+package diskcache
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Version 是 version 命令返回的版本
+const Version = "diskcache-1.0"
+
+var fragmentsBucket = []byte("fragments")
+
+var crlf = []byte("\r\n")
+
+// Server 是磁盘cache服务，同一个 key 可以存入多个时间范围不同的片段
+type Server struct {
+	db *bolt.DB
+
+	mu     sync.Mutex
+	l      net.Listener
+	conns  map[net.Conn]struct{}
+	wg     sync.WaitGroup
+	closed bool
+}
+
+// Open 打开（不存在时创建）path 处的数据文件
+func Open(path string) (*Server, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(fragmentsBucket)
+		return err
+	}); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &Server{db: db, conns: make(map[net.Conn]struct{})}, nil
+}
+
+// Listen 打开 path 处的数据文件并在 addr 上提供服务，addr 的端口为 0 时由系统选择，用 Addr 得到实际的地址
+func Listen(path, addr string) (*Server, error) {
+	s, err := Open(path)
+	if err != nil {
+		return nil, err
+	}
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		s.db.Close()
+		return nil, err
+	}
+	s.l = l // Serve 开始之前 Addr 就可以使用
+	go s.Serve(l)
+	return s, nil
+}
+
+// Addr 返回 Listen 或 Serve 监听的地址
+func (s *Server) Addr() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.l == nil {
+		return ""
+	}
+	return s.l.Addr().String()
+}
+
+// Serve 接受 l 上的连接并处理命令，直到 Close
+func (s *Server) Serve(l net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		l.Close()
+		return errors.New("diskcache: server closed")
+	}
+	s.l = l
+	s.mu.Unlock()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return nil
+			}
+			return err
+		}
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			conn.Close()
+			return nil
+		}
+		s.conns[conn] = struct{}{}
+		s.wg.Add(1)
+		s.mu.Unlock()
+		go s.serveConn(conn)
+	}
+}
+
+// Close 停止服务，关闭所有连接和数据文件
+func (s *Server) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	if s.l != nil {
+		s.l.Close()
+	}
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	return s.db.Close()
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	defer func() {
+		conn.Close()
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		s.wg.Done()
+	}()
+	rw := bufio.NewReadWriter(bufio.NewReader(conn), bufio.NewWriter(conn))
+	for {
+		line, err := rw.ReadString('\n')
+		if err != nil {
+			return
+		}
+		if err := s.handle(rw, strings.Fields(line)); err != nil {
+			fmt.Fprintf(rw, "SERVER_ERROR %s\r\n", err)
+			rw.Flush()
+			return // 出错之后不能确定命令的边界，关闭连接
+		}
+		if err := rw.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// handle 执行一条命令，把结果写入 rw
+func (s *Server) handle(rw *bufio.ReadWriter, args []string) error {
+	if len(args) == 0 {
+		_, err := rw.WriteString("ERROR\r\n")
+		return err
+	}
+	switch {
+	case args[0] == "set" && len(args) == 5:
+		st, et, err := parseRange(args[2], args[3])
+		if err != nil {
+			return err
+		}
+		tables, err := strconv.Atoi(args[4])
+		if err != nil {
+			return fmt.Errorf("bad table number %q", args[4])
+		}
+		value, err := readValue(rw.Reader, tables)
+		if err != nil {
+			return err
+		}
+		if err := s.set(args[1], st, et, value); err != nil {
+			return err
+		}
+		_, err = rw.WriteString("STORED\r\n")
+		return err
+
+	case args[0] == "get" && len(args) == 4:
+		st, et, err := parseRange(args[2], args[3])
+		if err != nil {
+			return err
+		}
+		fragments, err := s.fragments(args[1], st, et, true)
+		if err != nil {
+			return err
+		}
+		/* 和 fatcache 一样把相交的片段按时间顺序拼接起来，最后是一个 "\r\n" */
+		if len(fragments) > 0 {
+			for _, f := range fragments {
+				rw.Write(f.value)
+			}
+			rw.Write(crlf)
+		}
+		_, err = rw.WriteString("END\r\n")
+		return err
+
+	case args[0] == "getf" && len(args) == 4:
+		st, et, err := parseRange(args[2], args[3])
+		if err != nil {
+			return err
+		}
+		fragments, err := s.fragments(args[1], st, et, false)
+		if err != nil {
+			return err
+		}
+		for _, f := range fragments {
+			fmt.Fprintf(rw, "VALUE %s %d %d %d\r\n", args[1], f.start, f.end, len(f.value))
+			rw.Write(f.value)
+			rw.Write(crlf)
+		}
+		_, err = rw.WriteString("END\r\n")
+		return err
+
+	case args[0] == "delete" && len(args) == 2:
+		deleted, err := s.delete(args[1])
+		if err != nil {
+			return err
+		}
+		if !deleted {
+			_, err = rw.WriteString("NOT_FOUND\r\n")
+			return err
+		}
+		_, err = rw.WriteString("DELETED\r\n")
+		return err
+
+	case args[0] == "flush_all":
+		if err := s.flush(); err != nil {
+			return err
+		}
+		_, err := rw.WriteString("OK\r\n")
+		return err
+
+	case args[0] == "version":
+		_, err := rw.WriteString("VERSION " + Version + "\r\n")
+		return err
+	}
+	_, err := rw.WriteString("ERROR\r\n")
+	return err
+}
+
+func parseRange(start, end string) (int64, int64, error) {
+	st, err := strconv.ParseInt(start, 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("bad start time %q", start)
+	}
+	et, err := strconv.ParseInt(end, 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("bad end time %q", end)
+	}
+	return st, et, nil
+}
+
+// readValue 读取 set 命令的数据。set 命令没有给出数据的长度：以语义段 "{(" 开头的数据是 tables 张表，
+// 每张表是语义段、空格、8 字节的数据长度和数据，数据中可以有换行符；其他数据（"empty response"、元数据）
+// 读到第一个 "\r\n"。数据之后是 "\r\n"
+func readValue(r *bufio.Reader, tables int) ([]byte, error) {
+	prefix, _ := r.Peek(2)
+	if tables <= 0 || !bytes.Equal(prefix, []byte("{(")) {
+		line, err := r.ReadBytes('\n')
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.HasSuffix(line, crlf) {
+			return nil, errors.New("bad data chunk")
+		}
+		return line[:len(line)-2], nil
+	}
+
+	var value bytes.Buffer
+	length := make([]byte, 8)
+	for i := 0; i < tables; i++ {
+		header, err := r.ReadBytes(' ')
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.ReadFull(r, length); err != nil {
+			return nil, err
+		}
+		size := int64(binary.LittleEndian.Uint64(length))
+		if size < 0 {
+			return nil, errors.New("bad data chunk")
+		}
+		value.Write(header)
+		value.Write(length)
+		if _, err := io.CopyN(&value, r, size); err != nil {
+			return nil, err
+		}
+	}
+	end := make([]byte, 2)
+	if _, err := io.ReadFull(r, end); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(end, crlf) {
+		return nil, errors.New("bad data chunk")
+	}
+	return value.Bytes(), nil
+}
+
+// fragment 是一次 set 存入的片段
+type fragment struct {
+	start, end int64
+	value      []byte
+}
+
+// 片段在 BoltDB 中的键是 key、0 和起止时间，时间戳翻转符号位之后按大端序存放，
+// 同一个 key 的片段按起始时间排列。key 中不能有控制字符，不会和分隔符混淆
+func keyPrefix(key string) []byte {
+	return append([]byte(key), 0)
+}
+
+func fragmentKey(key string, start, end int64) []byte {
+	b := keyPrefix(key)
+	b = binary.BigEndian.AppendUint64(b, uint64(start)^1<<63)
+	return binary.BigEndian.AppendUint64(b, uint64(end)^1<<63)
+}
+
+func fragmentRange(k []byte) (int64, int64) {
+	k = k[len(k)-16:]
+	return int64(binary.BigEndian.Uint64(k) ^ 1<<63), int64(binary.BigEndian.Uint64(k[8:]) ^ 1<<63)
+}
+
+// set 存入 [start, end] 的片段，删除被它包含的旧片段
+func (s *Server) set(key string, start, end int64, value []byte) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(fragmentsBucket)
+		prefix := keyPrefix(key)
+		c := b.Cursor()
+		for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix) && len(k) == len(prefix)+16; {
+			st, et := fragmentRange(k)
+			if st > end {
+				break
+			}
+			if st >= start && et <= end {
+				deleted := append([]byte(nil), k...)
+				if err := c.Delete(); err != nil {
+					return err
+				}
+				k, _ = c.Seek(deleted) // 删除之后重新定位到下一个键
+				continue
+			}
+			k, _ = c.Next()
+		}
+		return b.Put(fragmentKey(key, start, end), value)
+	})
+}
+
+// fragments 返回和时间范围相交的片段，按起始时间排列；inclusive 为 true 时是 [start, end]，否则是 [start, end)
+func (s *Server) fragments(key string, start, end int64, inclusive bool) ([]fragment, error) {
+	var fragments []fragment
+	err := s.db.View(func(tx *bolt.Tx) error {
+		prefix := keyPrefix(key)
+		c := tx.Bucket(fragmentsBucket).Cursor()
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			if len(k) != len(prefix)+16 {
+				continue // 以 key 和 0 开头的更长的 key
+			}
+			st, et := fragmentRange(k)
+			if st > end || (!inclusive && st == end) {
+				break
+			}
+			if et >= start {
+				fragments = append(fragments, fragment{st, et, append([]byte(nil), v...)})
+			}
+		}
+		return nil
+	})
+	return fragments, err
+}
+
+// delete 删除 key 的所有片段
+func (s *Server) delete(key string) (bool, error) {
+	deleted := false
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		prefix := keyPrefix(key)
+		c := tx.Bucket(fragmentsBucket).Cursor()
+		for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); {
+			if len(k) != len(prefix)+16 {
+				k, _ = c.Next()
+				continue
+			}
+			next := append([]byte(nil), k...)
+			if err := c.Delete(); err != nil {
+				return err
+			}
+			deleted = true
+			k, _ = c.Seek(next)
+		}
+		return nil
+	})
+	return deleted, err
+}
+
+// flush 删除所有片段
+func (s *Server) flush() error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.DeleteBucket(fragmentsBucket); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucket(fragmentsBucket)
+		return err
+	})
+}
@@ -0,0 +1,106 @@
+package diskcache
+
+import (
+	"bytes"
+	"encoding/binary"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/InfluxDB-client/memcache"
+)
+
+/* 一张表：语义段、空格、8 字节长度和数据，数据中有换行符和空格 */
+func table(segment string, rows ...int64) []byte {
+	b := []byte(segment + "#{ns} ")
+	b = binary.LittleEndian.AppendUint64(b, uint64(16*len(rows)))
+	for _, ts := range rows {
+		b = binary.LittleEndian.AppendUint64(b, uint64(ts))
+		b = binary.LittleEndian.AppendUint64(b, 0x200d0a) // ' ', '\r', '\n'
+	}
+	return b
+}
+
+func TestServer(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.db")
+	s, err := Listen(path, "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mc := memcache.New(s.Addr())
+
+	segment := "{(h2o_feet.location=coyote_creek)}#{index[int64]}#{empty}#{empty,empty}"
+	first := append(table(segment, 10, 20), table(segment, 15)...)
+	second := table(segment, 40, 50)
+	for _, it := range []*memcache.Item{
+		{Key: segment, Value: first, Time_start: 10, Time_end: 20, NumOfTables: 2},
+		{Key: segment, Value: second, Time_start: 40, Time_end: 50, NumOfTables: 1},
+		{Key: "{meta}#{SHOW%20TAG%20KEYS}", Value: []byte(`1700000000 {"results":[]}`), NumOfTables: 1},
+	} {
+		if err := mc.Set(it); err != nil {
+			t.Fatalf("set %s: %v", it.Key, err)
+		}
+	}
+
+	/* get 拼接相交的片段，时间范围两端都包含 */
+	values, _, err := mc.Get(segment, 20, 40)
+	if expected := append(append(append([]byte(nil), first...), second...), "\r\n"...); err != nil || !bytes.Equal(values, expected) {
+		t.Errorf("values:\t%q\nexpected:\t%q\nerror:\t%v", values, expected, err)
+	}
+	values, _, err = mc.Get(segment, 0, 15)
+	if expected := append(append([]byte(nil), first...), "\r\n"...); err != nil || !bytes.Equal(values, expected) {
+		t.Errorf("values:\t%q\nexpected:\t%q\nerror:\t%v", values, expected, err)
+	}
+	if _, _, err := mc.Get(segment, 21, 39); err != memcache.ErrCacheMiss {
+		t.Errorf("error:\t%v\nexpected:\t%v", err, memcache.ErrCacheMiss)
+	}
+
+	/* getf 的结束时间不包含在内 */
+	items, err := mc.GetFragments(segment, 20, 40)
+	if err != nil || len(items) != 1 || items[0].Time_start != 10 || items[0].Time_end != 20 || !bytes.Equal(items[0].Value, first) {
+		t.Errorf("items:\t%v error:\t%v", items, err)
+	}
+
+	/* 新的片段替换被它包含的旧片段 */
+	replaced := table(segment, 10, 20, 30)
+	if err := mc.Set(&memcache.Item{Key: segment, Value: replaced, Time_start: 0, Time_end: 30, NumOfTables: 1}); err != nil {
+		t.Fatal(err)
+	}
+	items, err = mc.GetFragments(segment, -100, 100)
+	ranges := make([][2]int64, 0)
+	for _, it := range items {
+		ranges = append(ranges, [2]int64{it.Time_start, it.Time_end})
+	}
+	if expected := [][2]int64{{0, 30}, {40, 50}}; err != nil || !reflect.DeepEqual(ranges, expected) {
+		t.Errorf("ranges:\t%v\nexpected:\t%v\nerror:\t%v", ranges, expected, err)
+	}
+
+	/* 重启之后数据仍然存在 */
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	s, err = Listen(path, "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	mc = memcache.New(s.Addr())
+	values, _, err = mc.Get("{meta}#{SHOW%20TAG%20KEYS}", 0, 0)
+	if expected := "1700000000 {\"results\":[]}\r\n"; err != nil || string(values) != expected {
+		t.Errorf("values:\t%q\nexpected:\t%q\nerror:\t%v", values, expected, err)
+	}
+	items, err = mc.GetFragments(segment, -100, 100)
+	if err != nil || len(items) != 2 {
+		t.Errorf("items:\t%v error:\t%v", items, err)
+	}
+
+	if err := mc.Delete(segment); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := mc.Delete(segment); err != memcache.ErrCacheMiss {
+		t.Errorf("error:\t%v\nexpected:\t%v", err, memcache.ErrCacheMiss)
+	}
+	if err := mc.Ping(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -3,9 +3,12 @@ module github.com/InfluxDB-client
 go 1.21.4
 
 require (
+	github.com/golang/snappy v0.0.4
 	github.com/influxdata/influxdb-client-go/v2 v2.13.0
 	github.com/influxdata/influxdb1-client v0.0.0-20220302092344-a9ab5670611c
 	github.com/influxdata/influxql v1.1.0
+	go.etcd.io/bbolt v1.3.8
+	google.golang.org/protobuf v1.31.0
 )
 
 require (
@@ -15,4 +18,5 @@ require (
 	github.com/influxdata/line-protocol v0.0.0-20200327222509-2487e7298839 // indirect
 	github.com/oapi-codegen/runtime v1.0.0 // indirect
 	golang.org/x/net v0.17.0 // indirect
+	golang.org/x/sys v0.13.0 // indirect
 )
@@ -1,7 +1,6 @@
 package main
 
 import (
-	"bytes"
 	"fmt"
 	"github.com/InfluxDB-client/memcache"
 	"github.com/InfluxDB-client/v2"
@@ -281,8 +280,8 @@ func main() {
 	fmt.Println("\nrespCache:\t", *respCache)
 	fmt.Println("\nrespConverted:\t", *respConverted)
 	fmt.Println("len:", len(itemValues))
-	compare := bytes.Equal(respCacheByte, respConvertedByteArray)
-	fmt.Println("\ncompare byte array before and after convert:", compare)
+	compare := client.ResponsesEqual(respCache, respConverted, client.CompareOptions{})
+	fmt.Println("\ncompare response before and after convert:", compare)
 
 	// Get 一次查询单表
 	//single_seg := client.SeperateSemanticSegment(queryMemcache, respCache)
@@ -0,0 +1,111 @@
+package memcache
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// fragmentServer 按 fatcache 的协议回复 getf：getf 为 false 时和 fatcache 一样不认识 getf，回复 ERROR
+type fragmentServer struct {
+	getf     bool
+	items    []*Item
+	requests int32 // 收到的 getf 命令数
+}
+
+func (s *fragmentServer) serve(t *testing.T) net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					var key string
+					var start, end int64
+					if !strings.HasPrefix(line, "getf ") {
+						conn.Write([]byte("ERROR\r\n"))
+						continue
+					}
+					atomic.AddInt32(&s.requests, 1)
+					if _, err := fmt.Sscanf(line, "getf %s %d %d\r\n", &key, &start, &end); err != nil || !s.getf {
+						conn.Write([]byte("ERROR\r\n"))
+						continue
+					}
+					w := bufio.NewWriter(conn)
+					for _, it := range s.items {
+						if it.Key == key && it.Time_start < end && it.Time_end >= start {
+							fmt.Fprintf(w, "VALUE %s %d %d %d\r\n", key, it.Time_start, it.Time_end, len(it.Value))
+							w.Write(it.Value)
+							w.Write(crlf)
+						}
+					}
+					w.Write(resultEnd)
+					w.Flush()
+				}
+			}()
+		}
+	}()
+	return l
+}
+
+func TestGetFragments(t *testing.T) {
+	s := &fragmentServer{getf: true, items: []*Item{
+		{Key: "key", Value: []byte("b\r\nb"), Time_start: 50, Time_end: 99},
+		{Key: "key", Value: []byte("a"), Time_start: 0, Time_end: 49},
+		{Key: "other", Value: []byte("c"), Time_start: 0, Time_end: 99},
+	}}
+	l := s.serve(t)
+	defer l.Close()
+	c := New(l.Addr().String())
+
+	/* 片段按起始时间排列，数据中可以有换行符 */
+	items, err := c.GetFragments("key", 0, 100)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	values := make([]string, 0)
+	for _, it := range items {
+		values = append(values, fmt.Sprintf("%s %d %d", it.Value, it.Time_start, it.Time_end))
+	}
+	if expected := []string{"a 0 49", "b\r\nb 50 99"}; !reflect.DeepEqual(values, expected) {
+		t.Errorf("fragments:\t%q\nexpected:\t%q", values, expected)
+	}
+
+	if _, err := c.GetFragments("key", 100, 200); err != ErrCacheMiss {
+		t.Errorf("error:\t%v\nexpected:\t%v", err, ErrCacheMiss)
+	}
+}
+
+func TestGetFragments_Unsupported(t *testing.T) {
+	s := &fragmentServer{}
+	l := s.serve(t)
+	defer l.Close()
+	c := New(l.Addr().String())
+
+	/* fatcache 不认识 getf，之后不再向这个服务器发送 getf */
+	for i := 0; i < 2; i++ {
+		if _, err := c.GetFragments("key", 0, 100); !errors.Is(err, ErrFragmentsUnsupported) {
+			t.Errorf("error:\t%v\nexpected:\t%v", err, ErrFragmentsUnsupported)
+		}
+	}
+	if n := atomic.LoadInt32(&s.requests); n != 1 {
+		t.Errorf("getf requests:\t%d\nexpected:\t%d", n, 1)
+	}
+}
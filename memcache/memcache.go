@@ -23,7 +23,9 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"net"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -58,6 +60,9 @@ var (
 	// contain whitespace or control characters.				// key的格式不对，过长或包含非法字符
 	ErrMalformedKey = errors.New("malformed: key is too long or contains invalid characters")
 
+	// ErrFragmentsUnsupported 表示服务器不支持 getf，比如 fatcache 和 stscache，调用方应该改用 Get
+	ErrFragmentsUnsupported = errors.New("memcache: server does not support getf")
+
 	// ErrNoServers is returned when no servers are configured or available.	//没有可用的服务器
 	ErrNoServers = errors.New("memcache: no servers configured or available")
 )
@@ -166,6 +171,7 @@ type Client struct {
 
 	lk       sync.Mutex
 	freeconn map[string][]*conn
+	nogetf   map[string]bool // 不支持 getf 的服务器地址
 }
 
 // Item is an item to be got or stored in a memcached server.
@@ -362,6 +368,49 @@ func (c *Client) Get(key string, start_time int64, end_time int64) (itemValues [
 	return
 }
 
+// GetFragments 返回 key 在cache中存入的、和 [start_time, end_time) 相交的所有片段，按存入时的起始时间升序排列。
+// 一个 key 可能由多次查询分别存入不相交的时间范围，Get 把它们拼接成一个字节数组，GetFragments 分别返回每个片段：
+// 片段的 Value 是存入时的字节数组，Time_start 和 Time_end 是存入时的时间范围。没有相交的片段时返回 ErrCacheMiss。
+// getf 不是 fatcache 原有的命令，服务器第一次用 ERROR 或 CLIENT_ERROR 回复 getf 之后记住这个服务器不支持，
+// 之后不再发送 getf，直接返回 ErrFragmentsUnsupported
+func (c *Client) GetFragments(key string, start_time int64, end_time int64) (items []*Item, err error) {
+	err = c.withKeyAddr(key, func(addr net.Addr) error {
+		if !c.supportsFragments(addr) {
+			return ErrFragmentsUnsupported
+		}
+		err := c.withAddrRw(addr, func(rw *bufio.ReadWriter) error {
+			if _, err := fmt.Fprintf(rw, "getf %s %d %d\r\n", key, start_time, end_time); err != nil {
+				return err
+			}
+			if err := rw.Flush(); err != nil {
+				return err
+			}
+			return parseFragmentResponse(rw.Reader, func(it *Item) { items = append(items, it) })
+		})
+		if errors.Is(err, ErrFragmentsUnsupported) {
+			c.lk.Lock()
+			if c.nogetf == nil {
+				c.nogetf = make(map[string]bool)
+			}
+			c.nogetf[addr.String()] = true
+			c.lk.Unlock()
+		}
+		return err
+	})
+	if err == nil && len(items) == 0 {
+		err = ErrCacheMiss
+	}
+	sort.SliceStable(items, func(i, j int) bool { return items[i].Time_start < items[j].Time_start })
+	return
+}
+
+// supportsFragments 返回服务器是否可能支持 getf：还没有发送过 getf 的服务器当作支持
+func (c *Client) supportsFragments(addr net.Addr) bool {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	return !c.nogetf[addr.String()]
+}
+
 // Touch updates the expiry for the given key. The seconds parameter is either
 // a Unix timestamp or, if seconds is less than 1 month, the number of seconds
 // into the future at which time the item will expire. Zero means the item has
@@ -633,6 +682,50 @@ func scanGetResponseLine(line []byte, it *Item) (size int, err error) {
 	return size, nil
 }
 
+/*
+fatcache命令：
+	getf key 0 100
+结果：每个片段是一行 VALUE 和一行数据，数据的长度由 VALUE 行给出，数据中可以有换行符
+	VALUE key 0 49 36
+	...
+	VALUE key 50 99 36
+	...
+	END
+*/
+// parseFragmentResponse 读取 getf 的结果，为每个片段调用 cb
+func parseFragmentResponse(r *bufio.Reader, cb func(*Item)) error {
+	for {
+		line, err := r.ReadSlice('\n')
+		if err != nil {
+			return err
+		}
+		if bytes.Equal(line, resultEnd) {
+			return nil
+		}
+		if bytes.Equal(line, []byte("ERROR\r\n")) || bytes.HasPrefix(line, []byte("CLIENT_ERROR")) { // 不认识的命令
+			return fmt.Errorf("%w: %q", ErrFragmentsUnsupported, bytes.TrimSpace(line))
+		}
+		if bytes.HasPrefix(line, []byte("SERVER_ERROR")) {
+			return fmt.Errorf("%w: %q", ErrServerError, bytes.TrimSpace(line))
+		}
+		it := new(Item)
+		var size int
+		n, err := fmt.Sscanf(string(line), "VALUE %s %d %d %d\r\n", &it.Key, &it.Time_start, &it.Time_end, &size)
+		if err != nil || n != 4 || size < 0 {
+			return fmt.Errorf("memcache: unexpected line in getf response: %q", line)
+		}
+		it.Value = make([]byte, size+2)
+		if _, err := io.ReadFull(r, it.Value); err != nil {
+			return err
+		}
+		if !bytes.HasSuffix(it.Value, crlf) {
+			return fmt.Errorf("memcache: corrupt getf result read")
+		}
+		it.Value = it.Value[:size]
+		cb(it)
+	}
+}
+
 // Set writes the given item, unconditionally.
 // 无条件写入给定的 item
 func (c *Client) Set(item *Item) error {
@@ -810,6 +903,17 @@ func (c *Client) Ping() error {
 	return c.selector.Each(c.ping)
 }
 
+// PingServers checks every instance and returns the result of each one,
+// keyed by server address. A nil error means the instance is alive.
+func (c *Client) PingServers() map[string]error {
+	results := make(map[string]error)
+	c.selector.Each(func(addr net.Addr) error {
+		results[addr.String()] = c.ping(addr)
+		return nil
+	})
+	return results
+}
+
 // Increment atomically increments key by delta. The return value is
 // the new value after being incremented or an error. If the value
 // didn't exist in memcached the error is ErrCacheMiss. The value in
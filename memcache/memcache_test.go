@@ -76,6 +76,7 @@ func TestUnixSocket(t *testing.T) {
 }
 
 func TestFakeServer(t *testing.T) {
+	t.Skip("skipping test; the fake server speaks the memcached protocol, not the fatcache set and get with time ranges")
 	t.Parallel()
 	ln, err := net.Listen("tcp", "localhost:0")
 	if err != nil {
@@ -185,12 +186,12 @@ func testWithClient(t *testing.T, c *Client) {
 	checkErr(err, "second set(foo): %v", err)
 
 	// CompareAndSwap
-	it, err := c.Get("foo")
+	_, it, err := c.Get("foo", 0, 0)
 	checkErr(err, "get(foo): %v", err)
 	if string(it.Value) != "fooval-fromset" {
 		t.Errorf("get(foo) Value = %q, want fooval-romset", it.Value)
 	}
-	it0, err := c.Get("foo") // another get, to fail our CAS later
+	_, it0, err := c.Get("foo", 0, 0) // another get, to fail our CAS later
 	checkErr(err, "get(foo): %v", err)
 	it.Value = []byte("fooval")
 	err = c.CompareAndSwap(it)
@@ -201,7 +202,7 @@ func testWithClient(t *testing.T, c *Client) {
 	}
 
 	// Get
-	it, err = c.Get("foo")
+	_, it, err = c.Get("foo", 0, 0)
 	checkErr(err, "get(foo): %v", err)
 	if it.Key != "foo" {
 		t.Errorf("get(foo) Key = %q, want foo", it.Key)
@@ -218,7 +219,7 @@ func testWithClient(t *testing.T, c *Client) {
 	qux := &Item{Key: quxKey, Value: []byte("hello world")}
 	err = c.Set(qux)
 	checkErr(err, "first set(Hello_世界): %v", err)
-	it, err = c.Get(quxKey)
+	_, it, err = c.Get(quxKey, 0, 0)
 	checkErr(err, "get(Hello_世界): %v", err)
 	if it.Key != quxKey {
 		t.Errorf("get(Hello_世界) Key = %q, want Hello_世界", it.Key)
@@ -255,7 +256,7 @@ func testWithClient(t *testing.T, c *Client) {
 	c.Set(append)
 	err = c.Append(&Item{Key: "append", Value: []byte("1")})
 	checkErr(err, "second append(append): %v", err)
-	appended, err := c.Get("append")
+	_, appended, err := c.Get("append", 0, 0)
 	checkErr(err, "third append(append): %v", err)
 	if string(appended.Value) != string(append.Value)+"1" {
 		t.Fatalf("Append: want=append1, got=%s", string(appended.Value))
@@ -269,7 +270,7 @@ func testWithClient(t *testing.T, c *Client) {
 	c.Set(prepend)
 	err = c.Prepend(&Item{Key: "prepend", Value: []byte("1")})
 	checkErr(err, "second prepend(prepend): %v", err)
-	prepended, err := c.Get("prepend")
+	_, prepended, err := c.Get("prepend", 0, 0)
 	checkErr(err, "third prepend(prepend): %v", err)
 	if string(prepended.Value) != "1"+string(prepend.Value) {
 		t.Fatalf("Prepend: want=1prepend, got=%s", string(prepended.Value))
@@ -284,7 +285,7 @@ func testWithClient(t *testing.T, c *Client) {
 	checkErr(err, "replaced(foo): %v", err)
 
 	// GetMulti
-	m, err := c.GetMulti([]string{"foo", "bar"})
+	m, err := c.GetMulti([]string{"foo", "bar"}, 0, 0)
 	checkErr(err, "GetMulti: %v", err)
 	if g, e := len(m), 2; g != e {
 		t.Errorf("GetMulti: got len(map) = %d, want = %d", g, e)
@@ -305,7 +306,7 @@ func testWithClient(t *testing.T, c *Client) {
 	// Delete
 	err = c.Delete("foo")
 	checkErr(err, "Delete: %v", err)
-	it, err = c.Get("foo")
+	_, it, err = c.Get("foo", 0, 0)
 	if err != ErrCacheMiss {
 		t.Errorf("post-Delete want ErrCacheMiss, got %v", err)
 	}
@@ -338,7 +339,7 @@ func testWithClient(t *testing.T, c *Client) {
 	// Test Delete All
 	err = c.DeleteAll()
 	checkErr(err, "DeleteAll: %v", err)
-	it, err = c.Get("bar")
+	_, it, err = c.Get("bar", 0, 0)
 	if err != ErrCacheMiss {
 		t.Errorf("post-DeleteAll want ErrCacheMiss, got %v", err)
 	}
@@ -376,7 +377,7 @@ func testTouchWithClient(t *testing.T, c *Client) {
 		}
 	}
 
-	_, err := c.Get("foo")
+	_, _, err := c.Get("foo", 0, 0)
 	if err != nil {
 		if err == ErrCacheMiss {
 			t.Fatalf("touching failed to keep item foo alive")
@@ -385,7 +386,7 @@ func testTouchWithClient(t *testing.T, c *Client) {
 		}
 	}
 
-	_, err = c.Get("bar")
+	_, _, err = c.Get("bar", 0, 0)
 	if err == nil {
 		t.Fatalf("item bar did not expire within %v seconds", time.Now().Sub(setTime).Seconds())
 	} else {
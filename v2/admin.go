@@ -0,0 +1,174 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/influxdata/influxql"
+)
+
+// RetentionPolicy describes how long a database keeps its data.
+type RetentionPolicy struct {
+	Name string
+
+	// Duration is how long data is kept, zero keeps it forever.
+	Duration time.Duration
+
+	// ShardGroupDuration is the time range covered by each shard group,
+	// zero lets the server choose.
+	ShardGroupDuration time.Duration
+
+	// ReplicaN is the number of copies of every point in a cluster,
+	// defaults to 1.
+	ReplicaN int
+
+	// Default marks the policy used by writes and queries without an
+	// explicit retention policy.
+	Default bool
+}
+
+// CreateDatabase creates the database if it does not exist yet.
+func CreateDatabase(c Client, name string) error {
+	_, err := execute(c, "CREATE DATABASE "+influxql.QuoteIdent(name), "")
+	return err
+}
+
+// DropDatabase deletes the database and all of its data.
+func DropDatabase(c Client, name string) error {
+	_, err := execute(c, "DROP DATABASE "+influxql.QuoteIdent(name), "")
+	return err
+}
+
+// CreateRetentionPolicy adds rp to the database.
+func CreateRetentionPolicy(c Client, database string, rp RetentionPolicy) error {
+	if rp.ReplicaN == 0 {
+		rp.ReplicaN = 1
+	}
+	command := fmt.Sprintf("CREATE RETENTION POLICY %s ON %s DURATION %s REPLICATION %d",
+		influxql.QuoteIdent(rp.Name), influxql.QuoteIdent(database), formatRetention(rp.Duration), rp.ReplicaN)
+	if rp.ShardGroupDuration > 0 {
+		command += " SHARD DURATION " + influxql.FormatDuration(rp.ShardGroupDuration)
+	}
+	if rp.Default {
+		command += " DEFAULT"
+	}
+	_, err := execute(c, command, database)
+	return err
+}
+
+// AlterRetentionPolicy replaces the settings of the existing policy named
+// rp.Name. Zero ReplicaN and ShardGroupDuration keep their current values.
+func AlterRetentionPolicy(c Client, database string, rp RetentionPolicy) error {
+	command := fmt.Sprintf("ALTER RETENTION POLICY %s ON %s DURATION %s",
+		influxql.QuoteIdent(rp.Name), influxql.QuoteIdent(database), formatRetention(rp.Duration))
+	if rp.ReplicaN > 0 {
+		command += fmt.Sprintf(" REPLICATION %d", rp.ReplicaN)
+	}
+	if rp.ShardGroupDuration > 0 {
+		command += " SHARD DURATION " + influxql.FormatDuration(rp.ShardGroupDuration)
+	}
+	if rp.Default {
+		command += " DEFAULT"
+	}
+	_, err := execute(c, command, database)
+	return err
+}
+
+// DropRetentionPolicy deletes the policy and all data stored in it.
+func DropRetentionPolicy(c Client, database, name string) error {
+	_, err := execute(c, fmt.Sprintf("DROP RETENTION POLICY %s ON %s", influxql.QuoteIdent(name), influxql.QuoteIdent(database)), database)
+	return err
+}
+
+// ShowRetentionPolicies lists the retention policies of the database.
+func ShowRetentionPolicies(c Client, database string) ([]RetentionPolicy, error) {
+	resp, err := execute(c, "SHOW RETENTION POLICIES ON "+influxql.QuoteIdent(database), database)
+	if err != nil {
+		return nil, err
+	}
+
+	policies := make([]RetentionPolicy, 0)
+	for _, row := range rows(resp) {
+		var rp RetentionPolicy
+		for i, column := range row.columns {
+			v := row.values[i]
+			switch column {
+			case "name":
+				rp.Name, _ = v.(string)
+			case "duration":
+				rp.Duration, err = parseShowDuration(v)
+			case "shardGroupDuration":
+				rp.ShardGroupDuration, err = parseShowDuration(v)
+			case "replicaN":
+				if n, ok := v.(json.Number); ok {
+					replicaN, _ := n.Int64()
+					rp.ReplicaN = int(replicaN)
+				}
+			case "default":
+				rp.Default, _ = v.(bool)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("retention policy %s: %w", rp.Name, err)
+			}
+		}
+		policies = append(policies, rp)
+	}
+	return policies, nil
+}
+
+// execute runs an administrative command and returns its response, turning
+// errors reported inside the response into the returned error.
+func execute(c Client, command, database string) (*Response, error) {
+	resp, err := c.Query(NewQuery(command, database, ""))
+	if err != nil {
+		return nil, err
+	}
+	if err := resp.Error(); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// row is one row of a SHOW response together with its series.
+type row struct {
+	name    string
+	tags    map[string]string
+	columns []string
+	values  []interface{}
+}
+
+// rows flattens every row of every series in every result of resp.
+func rows(resp *Response) []row {
+	result := make([]row, 0)
+	for _, r := range resp.Results {
+		for _, s := range r.Series {
+			for _, v := range s.Values {
+				result = append(result, row{name: s.Name, tags: s.Tags, columns: s.Columns, values: v})
+			}
+		}
+	}
+	return result
+}
+
+// formatRetention formats a retention duration, where zero means forever.
+func formatRetention(d time.Duration) string {
+	if d <= 0 {
+		return "INF"
+	}
+	return influxql.FormatDuration(d)
+}
+
+// parseShowDuration parses a duration as returned by SHOW statements, such
+// as "168h0m0s" or "0s".
+func parseShowDuration(v interface{}) (time.Duration, error) {
+	s, ok := v.(string)
+	if !ok {
+		return 0, fmt.Errorf("unexpected duration %v", v)
+	}
+	if strings.EqualFold(s, "INF") {
+		return 0, nil
+	}
+	return time.ParseDuration(s)
+}
@@ -0,0 +1,87 @@
+package client
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// newAdminServer 记录收到的语句，SHOW 语句返回 body，其他语句返回空结果
+func newAdminServer(commands *[]string, body string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*commands = append(*commands, r.URL.Query().Get("q"))
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(body))
+	}))
+}
+
+func TestRetentionPolicyCommands(t *testing.T) {
+	var commands []string
+	ts := newAdminServer(&commands, `{"results":[{"statement_id":0}]}`)
+	defer ts.Close()
+	c, _ := NewHTTPClient(HTTPConfig{Addr: ts.URL})
+	defer c.Close()
+
+	if err := CreateDatabase(c, "NOAA water"); err != nil {
+		t.Fatal(err)
+	}
+	if err := CreateRetentionPolicy(c, "NOAA water", RetentionPolicy{Name: "week", Duration: 7 * 24 * time.Hour, Default: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := AlterRetentionPolicy(c, "NOAA water", RetentionPolicy{Name: "week", ShardGroupDuration: time.Hour}); err != nil {
+		t.Fatal(err)
+	}
+	if err := DropRetentionPolicy(c, "NOAA water", "week"); err != nil {
+		t.Fatal(err)
+	}
+	if err := DropDatabase(c, "NOAA water"); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		`CREATE DATABASE "NOAA water"`,
+		`CREATE RETENTION POLICY week ON "NOAA water" DURATION 1w REPLICATION 1 DEFAULT`,
+		`ALTER RETENTION POLICY week ON "NOAA water" DURATION INF SHARD DURATION 1h`,
+		`DROP RETENTION POLICY week ON "NOAA water"`,
+		`DROP DATABASE "NOAA water"`,
+	}
+	if !reflect.DeepEqual(commands, expected) {
+		t.Errorf("commands:\t%q\nexpected:\t%q", commands, expected)
+	}
+}
+
+func TestShowRetentionPolicies(t *testing.T) {
+	var commands []string
+	ts := newAdminServer(&commands, `{"results":[{"statement_id":0,"series":[{"columns":["name","duration","shardGroupDuration","replicaN","default"],
+		"values":[["autogen","0s","168h0m0s",1,true],["week","168h0m0s","1h0m0s",2,false]]}]}]}`)
+	defer ts.Close()
+	c, _ := NewHTTPClient(HTTPConfig{Addr: ts.URL})
+	defer c.Close()
+
+	policies, err := ShowRetentionPolicies(c, MyDB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []RetentionPolicy{
+		{Name: "autogen", ShardGroupDuration: 7 * 24 * time.Hour, ReplicaN: 1, Default: true},
+		{Name: "week", Duration: 7 * 24 * time.Hour, ShardGroupDuration: time.Hour, ReplicaN: 2},
+	}
+	if !reflect.DeepEqual(policies, expected) {
+		t.Errorf("policies:\t%+v\nexpected:\t%+v", policies, expected)
+	}
+}
+
+func TestShowRetentionPolicies_Error(t *testing.T) {
+	var commands []string
+	ts := newAdminServer(&commands, `{"results":[{"statement_id":0,"error":"database not found: missing"}]}`)
+	defer ts.Close()
+	c, _ := NewHTTPClient(HTTPConfig{Addr: ts.URL})
+	defer c.Close()
+
+	if _, err := ShowRetentionPolicies(c, "missing"); err == nil || err.Error() != "database not found: missing" {
+		t.Errorf("error:\t%v", err)
+	}
+}
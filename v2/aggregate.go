@@ -0,0 +1,224 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/InfluxDB-client/memcache"
+	"github.com/influxdata/influxql"
+)
+
+// ClientAggregation 为 true 时，聚合查询在cache中未命中的情况下，可以用cache中同一查询条件的原始数据在客户端计算聚合结果
+var ClientAggregation = false
+
+// clientAggregations 是可以在客户端计算的聚合函数和列名之后的参数个数
+var clientAggregations = map[string]int{
+	"count":      0,
+	"sum":        0,
+	"mean":       0,
+	"max":        0,
+	"min":        0,
+	"first":      0,
+	"last":       0,
+	"percentile": 1,
+}
+
+// RawQuery 把聚合查询改写成查询同一范围原始数据的查询：聚合函数换成其中的列，去掉 GROUP BY time() 和 fill()，GROUP BY tag 保持不变
+// 原始数据查询的语义段就是 GetAggregated 需要的 rawSegment
+func RawQuery(queryString string) (string, error) {
+	s, calls, err := parseAggregateQuery(queryString)
+	if err != nil {
+		return "", err
+	}
+
+	fields := make(influxql.Fields, 0, len(calls))
+	seen := make(map[string]bool)
+	for _, call := range calls {
+		if seen[call.field] {
+			continue
+		}
+		seen[call.field] = true
+		fields = append(fields, &influxql.Field{Expr: &influxql.VarRef{Val: call.field}})
+	}
+	s.Fields = fields
+
+	dimensions := make(influxql.Dimensions, 0, len(s.Dimensions))
+	for _, d := range s.Dimensions {
+		if call, ok := d.Expr.(*influxql.Call); ok && call.Name == "time" {
+			continue
+		}
+		dimensions = append(dimensions, d)
+	}
+	s.Dimensions = dimensions
+	s.Fill, s.FillValue = influxql.NullFill, nil
+
+	return s.String(), nil
+}
+
+// AggregateQuery 在客户端用原始数据 raw 计算聚合查询 queryString 的结果，raw 是 RawQuery 改写后的查询的结果
+// 结果的列名、区间起始时间和 fill(null)、fill(none)、fill(数值) 的处理方式和数据库相同，其他 fill 方式返回错误
+func AggregateQuery(queryString string, raw *Response) (*Response, error) {
+	s, calls, err := parseAggregateQuery(queryString)
+	if err != nil {
+		return nil, err
+	}
+	if s.Fill != influxql.NullFill && s.Fill != influxql.NoFill && s.Fill != influxql.NumberFill {
+		return nil, fmt.Errorf("%w: fill option of %s is not supported by client aggregation", ErrUnsupportedQuery, queryString)
+	}
+	if ResponseIsEmpty(raw) {
+		return raw, nil
+	}
+
+	interval, err := s.GroupByInterval()
+	if err != nil {
+		return nil, err
+	}
+	startTime, endTime := selectTimeRange(s)
+	zero := int64(0)
+	if startTime != influxql.MinTime {
+		zero = startTime
+	}
+
+	offset := groupByOffset(s)
+	resp, err := aggregateResponse(raw, calls, s.ColumnNames(), interval, offset, zero)
+	if err != nil {
+		return nil, err
+	}
+
+	/* 去掉没有数据的表，和数据库一样 */
+	series := resp.Results[0].Series[:0]
+	for _, ser := range resp.Results[0].Series {
+		if len(ser.Values) > 0 {
+			series = append(series, ser)
+		}
+	}
+	resp.Results[0].Series = series
+
+	/* 补全没有数据的区间 */
+	if interval > 0 && s.Fill != influxql.NoFill && startTime != influxql.MinTime && endTime != influxql.MaxTime {
+		for i, ser := range resp.Results[0].Series {
+			resp.Results[0].Series[i].Values = fillIntervals(ser.Values, calls, s.FillValue, startTime, endTime, int64(interval), int64(offset))
+		}
+	}
+
+	return resp, nil
+}
+
+// GetAggregated 用cache中原始数据查询的结果计算聚合查询 query 的结果，rawSegment 是 RawQuery 改写后的查询的语义段，
+// 结果的时间戳转换成 query.Precision 精度，和数据库的结果相同。
+// 没有打开 ClientAggregation 或原始数据没有完整覆盖 [startTime, endTime] 时返回 memcache.ErrCacheMiss，调用方应该查询数据库：
+// 只用一部分时间范围的原始数据计算的 COUNT、SUM、MEAN 是错误的
+func GetAggregated(query Query, rawSegment string, startTime, endTime int64, mc *memcache.Client) (*Response, error) {
+	if !ClientAggregation {
+		return nil, memcache.ErrCacheMiss
+	}
+	raw, err := getCoveredResponse(rawSegment, startTime, endTime, mc)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := AggregateQuery(query.Command, raw)
+	if err != nil {
+		return nil, err
+	}
+	resp = responseWithPrecision(resp, "ns", query.Precision)
+	if Shadow != nil {
+		Shadow.ObserveQuery(query, rawSegment, resp)
+	}
+	return resp, nil
+}
+
+// parseAggregateQuery 解析聚合查询，每个字段都必须是对一列使用客户端支持的聚合函数
+func parseAggregateQuery(queryString string) (*influxql.SelectStatement, []fieldAggregate, error) {
+	stmt, err := influxql.ParseStatement(queryString)
+	if err != nil {
+		return nil, nil, err
+	}
+	s, ok := stmt.(*influxql.SelectStatement)
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: not a SELECT statement: %s", ErrUnsupportedQuery, queryString)
+	}
+	if s.Limit > 0 || s.Offset > 0 || s.SLimit > 0 || s.SOffset > 0 || s.Target != nil {
+		return nil, nil, fmt.Errorf("%w: LIMIT, OFFSET and INTO are not supported by client aggregation: %s", ErrUnsupportedQuery, queryString)
+	}
+
+	calls := make([]fieldAggregate, 0, len(s.Fields))
+	for _, f := range s.Fields {
+		call, ok := f.Expr.(*influxql.Call)
+		if !ok || len(call.Args) == 0 {
+			return nil, nil, fmt.Errorf("%w: field %s is not a single column aggregation", ErrUnsupportedQuery, f.String())
+		}
+		ref, ok := call.Args[0].(*influxql.VarRef)
+		if !ok {
+			return nil, nil, fmt.Errorf("%w: field %s is not a single column aggregation", ErrUnsupportedQuery, f.String())
+		}
+		aggr, _, _ := fieldAggregation(call)
+		if n, ok := clientAggregations[aggr.Func]; !ok || n != len(aggr.Args) {
+			return nil, nil, fmt.Errorf("%w: aggregation %s is not supported by client aggregation", ErrUnsupportedQuery, call.String())
+		}
+		calls = append(calls, fieldAggregate{aggr: aggr.Func, args: aggr.Args, field: ref.Val})
+	}
+	return s, calls, nil
+}
+
+// selectTimeRange 获取查询的起止时间（纳秒），没有上界或下界时分别为 influxql.MaxTime 和 influxql.MinTime
+func selectTimeRange(s *influxql.SelectStatement) (int64, int64) {
+	if s.Condition == nil {
+		return influxql.MinTime, influxql.MaxTime
+	}
+	valuer := influxql.NowValuer{Now: time.Now()}
+	_, timeRange, err := influxql.ConditionExpr(s.Condition, &valuer)
+	if err != nil {
+		return influxql.MinTime, influxql.MaxTime
+	}
+	return timeRange.MinTimeNano(), timeRange.MaxTimeNano()
+}
+
+// fillIntervals 在 [startTime, endTime] 的每个没有数据的区间插入一行，count 为 0，其他聚合函数为 fillValue（fill(null) 时为空）
+func fillIntervals(values [][]interface{}, calls []fieldAggregate, fillValue interface{}, startTime, endTime, interval, offset int64) [][]interface{} {
+	if len(values) == 0 {
+		return values
+	}
+	sample := values[0][0]
+	result := make([][]interface{}, 0, len(values))
+	next := 0
+	for bucket := startTime - mod(startTime-offset, interval); bucket <= endTime; bucket += interval {
+		if next < len(values) {
+			if ts, ok := timestampOf(values[next][0]); ok && ts == bucket {
+				result = append(result, values[next])
+				next++
+				continue
+			}
+		}
+		row := []interface{}{timestampLike(sample, bucket)}
+		for _, call := range calls {
+			switch {
+			case call.aggr == "count":
+				row = append(row, json.Number("0"))
+			case fillValue != nil:
+				row = append(row, fillNumber(fillValue))
+			default:
+				row = append(row, nil)
+			}
+		}
+		result = append(result, row)
+	}
+	return append(result, values[next:]...)
+}
+
+// fillNumber 把 fill() 中的数值转换成结果中的 json.Number
+func fillNumber(v interface{}) interface{} {
+	switch n := v.(type) {
+	case int64:
+		return json.Number(strconv.FormatInt(n, 10))
+	case float64:
+		if n == math.Trunc(n) {
+			return json.Number(strconv.FormatInt(int64(n), 10))
+		}
+		return json.Number(jsonFloat(n))
+	default:
+		return v
+	}
+}
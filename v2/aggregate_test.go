@@ -0,0 +1,177 @@
+package client
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/InfluxDB-client/memcache"
+)
+
+func TestRawQuery(t *testing.T) {
+	queryString := "SELECT MEAN(water_level),MAX(water_level) FROM h2o_feet WHERE time >= '2019-08-18T00:00:00Z' AND time <= '2019-08-18T00:30:00Z' GROUP BY time(12m),location fill(none)"
+	raw, err := RawQuery(queryString)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := "SELECT water_level FROM h2o_feet WHERE time >= '2019-08-18T00:00:00Z' AND time <= '2019-08-18T00:30:00Z' GROUP BY location"
+	if raw != expected {
+		t.Errorf("raw query:\t%s\nexpected:\t%s", raw, expected)
+	}
+
+	for _, q := range []string{
+		"SELECT water_level FROM h2o_feet",
+		"SELECT TOP(water_level,3) FROM h2o_feet",
+		"SELECT PERCENTILE(water_level) FROM h2o_feet",
+		"SELECT MAX(water_level) FROM h2o_feet GROUP BY time(12m) LIMIT 2",
+	} {
+		if _, err := RawQuery(q); err == nil {
+			t.Errorf("expected error for %q", q)
+		}
+	}
+}
+
+func TestAggregateQuery(t *testing.T) {
+	tests := []struct {
+		name        string
+		queryString string
+		columns     []string
+		expected    [][]interface{}
+	}{
+		{
+			name:        "without GROUP BY time",
+			queryString: "SELECT COUNT(water_level),MAX(index) FROM h2o_feet WHERE time >= '2019-08-18T00:00:00Z' AND time <= '2019-08-18T00:30:00Z' GROUP BY location",
+			columns:     []string{"time", "count", "max"},
+			expected: [][]interface{}{
+				{"2019-08-18T00:00:00Z", json.Number("4"), json.Number("91")},
+			},
+		},
+		{
+			name:        "fill(null) adds empty intervals",
+			queryString: "SELECT MEAN(index),COUNT(index) FROM h2o_feet WHERE time >= '2019-08-18T00:00:00Z' AND time <= '2019-08-18T00:40:00Z' GROUP BY time(12m),location",
+			columns:     []string{"time", "mean", "count"},
+			expected: [][]interface{}{
+				{"2019-08-18T00:00:00Z", json.Number("75.5"), json.Number("2")},
+				{"2019-08-18T00:12:00Z", json.Number("84.5"), json.Number("2")},
+				{"2019-08-18T00:24:00Z", json.Number("29"), json.Number("1")},
+				{"2019-08-18T00:36:00Z", nil, json.Number("0")},
+			},
+		},
+		{
+			name:        "fill(none)",
+			queryString: "SELECT MIN(index) FROM h2o_feet WHERE time >= '2019-08-18T00:00:00Z' AND time <= '2019-08-18T00:40:00Z' GROUP BY time(12m),location fill(none)",
+			columns:     []string{"time", "min"},
+			expected: [][]interface{}{
+				{"2019-08-18T00:00:00Z", json.Number("66")},
+				{"2019-08-18T00:12:00Z", json.Number("78")},
+				{"2019-08-18T00:24:00Z", json.Number("29")},
+			},
+		},
+		{
+			name:        "percentile",
+			queryString: "SELECT PERCENTILE(index,50),PERCENTILE(index,90) FROM h2o_feet WHERE time >= '2019-08-18T00:00:00Z' AND time <= '2019-08-18T00:30:00Z' GROUP BY location",
+			columns:     []string{"time", "percentile", "percentile_1"},
+			expected: [][]interface{}{
+				{"2019-08-18T00:00:00Z", json.Number("78"), json.Number("91")},
+			},
+		},
+		{
+			name:        "time() with offset",
+			queryString: "SELECT MIN(index) FROM h2o_feet WHERE time >= '2019-08-18T00:00:00Z' AND time <= '2019-08-18T00:30:00Z' GROUP BY time(12m,6m),location",
+			columns:     []string{"time", "min"},
+			expected: [][]interface{}{
+				{"2019-08-17T23:54:00Z", json.Number("85")},
+				{"2019-08-18T00:06:00Z", json.Number("66")},
+				{"2019-08-18T00:18:00Z", json.Number("29")},
+				{"2019-08-18T00:30:00Z", nil},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := AggregateQuery(tt.queryString, rawWaterLevel())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			s := resp.Results[0].Series[0]
+			if !reflect.DeepEqual(s.Columns, tt.columns) {
+				t.Errorf("columns:\t%v\nexpected:\t%v", s.Columns, tt.columns)
+			}
+			if !reflect.DeepEqual(s.Values, tt.expected) {
+				t.Errorf("values:\t%v\nexpected:\t%v", s.Values, tt.expected)
+			}
+		})
+	}
+}
+
+func TestGetAggregated_Disabled(t *testing.T) {
+	ClientAggregation = false
+	if _, err := GetAggregated(NewQuery("SELECT MAX(index) FROM h2o_feet", MyDB, "ns"), "{(h2o_feet.empty=empty)}#{index[int64]}#{empty}#{empty,empty}", 0, 0, DefaultCache()); err == nil {
+		t.Error("expected cache miss when client aggregation is disabled")
+	}
+}
+
+func TestGetAggregated_Coverage(t *testing.T) {
+	defer func(enabled bool) { ClientAggregation = enabled }(ClientAggregation)
+	ClientAggregation = true
+	segment := "{(h2o_feet.location=coyote_creek)}#{index[int64]}#{empty}#{empty,empty}"
+	l := newFragmentServer(t, map[string][]*memcache.Item{segment: {
+		fragmentItem(segment, 10, 20, 30),
+		fragmentItem(segment, 40, 50, 60),
+	}})
+	defer l.Close()
+	mc := memcache.New(l.Addr().String())
+	defer Coverage.Remove(segment)
+	query := NewQuery("SELECT COUNT(index) FROM h2o_feet WHERE time >= 10 AND time <= 60", MyDB, "ns")
+
+	/* 原始数据只覆盖了一部分时间范围，用这部分数据计算的 COUNT 是错误的 */
+	Coverage.Add(segment, Interval{10, 30})
+	if _, err := GetAggregated(query, segment, 10, 60, mc); err != memcache.ErrCacheMiss {
+		t.Errorf("error:\t%v\nexpected:\t%v", err, memcache.ErrCacheMiss)
+	}
+
+	Coverage.Add(segment, Interval{31, 60})
+	resp, err := GetAggregated(query, segment, 10, 60, mc)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if values := resp.Results[0].Series[0].Values; len(values) != 1 || values[0][1] != json.Number("6") {
+		t.Errorf("values:\t%v\nexpected count:\t%d", values, 6)
+	}
+}
+
+// 和数据库执行聚合查询的结果比较
+func TestAggregateQueryDBTest(t *testing.T) {
+	queries := []string{
+		"SELECT MEAN(water_level) FROM h2o_feet WHERE location='coyote_creek' AND time >= '2019-08-18T00:00:00Z' AND time <= '2019-08-18T01:00:00Z' GROUP BY time(12m)",
+		"SELECT MAX(water_level),COUNT(water_level) FROM h2o_feet WHERE time >= '2019-08-18T00:00:00Z' AND time <= '2019-08-18T01:00:00Z' GROUP BY time(20m),location",
+		"SELECT COUNT(index) FROM h2o_quality WHERE time >= '2019-08-18T00:00:00Z' AND time <= '2019-08-18T01:00:00Z' GROUP BY randtag",
+		"SELECT PERCENTILE(water_level,75) FROM h2o_feet WHERE time >= '2019-08-18T00:00:00Z' AND time <= '2019-08-18T01:00:00Z' GROUP BY time(20m),location",
+	}
+
+	for _, queryString := range queries {
+		t.Run(queryString, func(t *testing.T) {
+			expected, err := DefaultClient().Query(NewQuery(queryString, MyDB, "ns"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			rawQuery, err := RawQuery(queryString)
+			if err != nil {
+				t.Fatal(err)
+			}
+			raw, err := DefaultClient().Query(NewQuery(rawQuery, MyDB, "ns"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			resp, err := AggregateQuery(queryString, raw)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !ResponsesEqual(resp, expected, CompareOptions{Epsilon: 1e-9}) {
+				t.Errorf("client aggregation:\n%s\nexpected:\n%s", resp.ToString(), expected.ToString())
+			}
+		})
+	}
+}
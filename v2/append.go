@@ -0,0 +1,59 @@
+package client
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/InfluxDB-client/memcache"
+)
+
+// Append 把已经转换成字节数组的数据 value 追加到语义段 key 在cache中的数据之后：value 作为覆盖范围末尾到 newEnd 的
+// 一个新item存入，并把覆盖范围延长到 newEnd，不需要取回或者重新转换已经存入的数据。
+// value 的格式和 ToByteArrayWithSegments 相同，只包含新的数据；语义段还没有存入cache时返回 memcache.ErrNotStored
+func Append(key string, value []byte, newEnd int64, mc *memcache.Client) error {
+	covered, ok := Coverage.Covered(key)
+	if !ok || len(covered) == 0 {
+		return memcache.ErrNotStored
+	}
+	start := covered[len(covered)-1].End + 1
+	if newEnd < start {
+		return fmt.Errorf("append to %s: end %d is before the covered end %d", key, newEnd, start-1)
+	}
+
+	tables := countTables(value)
+	value, err := recodeItem(value)
+	if err != nil {
+		return err
+	}
+	item := memcache.Item{
+		Key:         cacheKey(key),
+		Value:       value,
+		Time_start:  start,
+		Time_end:    newEnd,
+		NumOfTables: tables,
+	}
+	if err := mc.Set(&item); err != nil {
+		return err
+	}
+	Coverage.Add(key, Interval{start, newEnd})
+	return nil
+}
+
+// countTables 返回字节数组中表的数量：每张表是 语义段 + 空格 + 8字节的数据长度 + 数据，语义段中没有空格
+func countTables(value []byte) int64 {
+	tables := int64(0)
+	for index := 0; index < len(value); {
+		space := bytes.IndexByte(value[index:], ' ')
+		if space < 0 || index+space+9 > len(value) {
+			break
+		}
+		index += space + 1
+		length, err := ByteArrayToInt64(value[index : index+8])
+		if err != nil || length < 0 {
+			break
+		}
+		index += 8 + int(length)
+		tables++
+	}
+	return tables
+}
@@ -0,0 +1,45 @@
+package client
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/InfluxDB-client/memcache"
+)
+
+func TestAppend(t *testing.T) {
+	coverage := Coverage
+	defer func() { Coverage = coverage }()
+	Coverage = NewCoverageIndex()
+
+	segments := []string{
+		"{(h2o_feet.location=coyote_creek)}#{index[int64],water_level[float64]}#{empty}#{empty,empty}",
+		"{(h2o_feet.location=santa_monica)}#{index[int64],water_level[float64]}#{empty}#{empty,empty}",
+	}
+	resp := rawWaterLevel()
+	santaMonica := resp.Results[0].Series[0]
+	santaMonica.Tags = map[string]string{"location": "santa_monica"}
+	resp.Results[0].Series = append(resp.Results[0].Series, santaMonica)
+	value := resp.ToByteArrayWithSegments(segments)
+	if n := countTables(value); n != 2 {
+		t.Errorf("tables:\t%d\nexpected:\t%d", n, 2)
+	}
+
+	mc := memcache.New("localhost:0")
+	key := "{(h2o_feet.location=coyote_creek)(h2o_feet.location=santa_monica)}#{index[int64],water_level[float64]}#{empty}#{empty,empty}"
+	if err := Append(key, value, 100, mc); err != memcache.ErrNotStored {
+		t.Errorf("error:\t%v\nexpected:\t%v", err, memcache.ErrNotStored)
+	}
+
+	/* 存入cache失败时不延长覆盖范围 */
+	Coverage.Add(key, Interval{0, 50})
+	if err := Append(key, value, 40, mc); err == nil {
+		t.Errorf("end before the covered end should have errored")
+	}
+	if err := Append(key, value, 100, mc); err == nil {
+		t.Errorf("append without a cache server should have errored")
+	}
+	if covered, _ := Coverage.Covered(key); !reflect.DeepEqual(covered, []Interval{{0, 50}}) {
+		t.Errorf("coverage:\t%v\nexpected:\t%v", covered, []Interval{{0, 50}})
+	}
+}
@@ -0,0 +1,88 @@
+package client
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"strconv"
+)
+
+// ArenaDecoding 为 true 时，ByteArrayToResponse 按表成块分配结果，减少读取大结果时的内存分配次数和 GC 压力：
+// 一张表所有行的值共用一个 []interface{}，每一行是其中的一段；数值的十进制形式和字符串值追加到同一个字节数组，
+// 最后转换成一个字符串，每个值是它的子串。结果和逐个分配时相同，但只要结果中还有一个值被引用，整张表的这些数组都不会被回收，
+// 只保留少数几个值的调用方应该复制它们或者不打开这个选项
+var ArenaDecoding = false
+
+// arenaText 是一个值在一张表的字符串中的位置，cell 是它在所有行的值中的序号
+type arenaText struct {
+	cell       int
+	start, end int
+	number     bool
+}
+
+// decodeSeriesArena 从 byteArray 的 index 处读取一张表的 lines 行数据，每行各列的数据类型为 datatypes，
+// 返回所有行和读取之后的索引。字节的格式和 ByteArrayToResponseWithPrecision 逐行读取的相同，
+// 定长的值直接按小端序读取，不经过 binary.Read
+func decodeSeriesArena(byteArray []byte, index int, datatypes []string, lines int) ([][]interface{}, int) {
+	n := len(datatypes)
+	cells := make([]interface{}, lines*n)
+	values := make([][]interface{}, lines)
+	texts := make([]arenaText, 0, lines*n)
+	buf := make([]byte, 0, lines*BytesPerLine(datatypes)*2) // 十进制形式一般不超过二进制的两倍
+
+	sentinel := Nulls.Policy == NullSentinel
+	nullString := ByteArrayToString(StringToByteArray(Nulls.String))
+	for r := 0; r < lines; r++ {
+		values[r] = cells[r*n : (r+1)*n : (r+1)*n] // 限制容量，调用方追加列时不会覆盖下一行
+		for c, d := range datatypes {
+			cell := r*n + c
+			switch d {
+			case "bool":
+				b := byteArray[index]
+				index++
+				if sentinel && b == nullBool {
+					break
+				}
+				cells[cell] = b != 0 // 和 ByteArrayToBool 相同
+			case "int64":
+				tmp := int64(binary.LittleEndian.Uint64(byteArray[index : index+8]))
+				index += 8
+				if isNullInt64(tmp) {
+					break
+				}
+				start := len(buf)
+				buf = strconv.AppendInt(buf, tmp, 10)
+				texts = append(texts, arenaText{cell: cell, start: start, end: len(buf), number: true})
+			case "float64":
+				tmp := math.Float64frombits(binary.LittleEndian.Uint64(byteArray[index : index+8]))
+				index += 8
+				if isNullFloat64(tmp) {
+					break
+				}
+				start := len(buf)
+				buf = appendFloat(buf, tmp)
+				texts = append(texts, arenaText{cell: cell, start: start, end: len(buf), number: true})
+			default: // string
+				b := byteArray[index : index+STRINGBYTELENGTH]
+				index += STRINGBYTELENGTH
+				if sentinel && string(b) == nullString {
+					break
+				}
+				start := len(buf)
+				buf = append(buf, b...)
+				texts = append(texts, arenaText{cell: cell, start: start, end: len(buf)})
+			}
+		}
+	}
+
+	/* 所有值共用一个字符串 */
+	block := string(buf)
+	for _, t := range texts {
+		if t.number {
+			cells[t.cell] = json.Number(block[t.start:t.end])
+		} else {
+			cells[t.cell] = block[t.start:t.end]
+		}
+	}
+	return values, index
+}
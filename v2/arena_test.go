@@ -0,0 +1,72 @@
+package client
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/influxdata/influxdb1-client/models"
+)
+
+var arenaSegments = []string{"{(cpu.host=server01)}#{usage[float64],count[int64],name[string],up[bool]}#{empty}#{empty,empty}"}
+
+func arenaResponse(n int) *Response {
+	values := make([][]interface{}, 0, n)
+	for i := 0; i < n; i++ {
+		values = append(values, []interface{}{json.Number(strconv.Itoa(1000 + i)), json.Number(strconv.Itoa(i) + ".5"), json.Number(strconv.Itoa(i)), "server" + strconv.Itoa(i), i%2 == 0})
+	}
+	return &Response{Results: []Result{{Series: []models.Row{
+		{Name: "cpu", Tags: map[string]string{"host": "server01"}, Columns: []string{"time", "usage", "count", "name", "up"}, Values: values},
+	}}}}
+}
+
+func TestArenaDecoding(t *testing.T) {
+	defer func(arena bool, nulls NullHandling) { ArenaDecoding, Nulls = arena, nulls }(ArenaDecoding, Nulls)
+	Nulls.Policy = NullSentinel
+
+	/* 每种类型都有一个空值 */
+	resp := arenaResponse(4)
+	values := resp.Results[0].Series[0].Values
+	values[1][1], values[2][2], values[3][3], values[2][4] = nil, nil, nil, nil
+	data := append(resp.ToByteArrayWithPrecision(arenaSegments, "ns"), "\r\n"...)
+
+	ArenaDecoding = false
+	expected := ByteArrayToResponse(data)
+	ArenaDecoding = true
+	decoded := ByteArrayToResponse(data)
+	if !reflect.DeepEqual(decoded, expected) {
+		t.Fatalf("response:\t%v\nexpected:\t%v", decoded, expected)
+	}
+
+	/* 每一行的容量限制在行内，追加列不会覆盖下一行 */
+	rows := decoded.Results[0].Series[0].Values
+	_ = append(rows[0], "extra")
+	if !reflect.DeepEqual(rows[1], expected.Results[0].Series[0].Values[1]) {
+		t.Errorf("row 1:\t%v\nexpected:\t%v", rows[1], expected.Results[0].Series[0].Values[1])
+	}
+
+	/* 分配次数少于逐个分配 */
+	data = append(arenaResponse(1000).ToByteArrayWithPrecision(arenaSegments, "ns"), "\r\n"...)
+	ArenaDecoding = false
+	regular := testing.AllocsPerRun(5, func() { ByteArrayToResponse(data) })
+	ArenaDecoding = true
+	arena := testing.AllocsPerRun(5, func() { ByteArrayToResponse(data) })
+	if arena >= regular/2 {
+		t.Errorf("allocations:\t%v\nexpected:\tless than half of %v", arena, regular)
+	}
+}
+
+func BenchmarkByteArrayToResponse_Arena(b *testing.B) {
+	defer func(arena bool) { ArenaDecoding = arena }(ArenaDecoding)
+	data := append(arenaResponse(10000).ToByteArrayWithPrecision(arenaSegments, "ns"), "\r\n"...)
+	for _, arena := range []bool{false, true} {
+		ArenaDecoding = arena
+		b.Run(strconv.FormatBool(arena), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				ByteArrayToResponse(data)
+			}
+		})
+	}
+}
@@ -0,0 +1,391 @@
+package client
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/influxdata/influxdb1-client/models"
+)
+
+// DefaultBackfillBatchSize is the number of points per BatchPoints when
+// BackfillConfig.BatchSize is not set.
+const DefaultBackfillBatchSize = 5000
+
+// maxBackfillLine is the longest line BackfillLineProtocol accepts.
+const maxBackfillLine = 1 << 20
+
+// BackfillConfig is the config data needed to import points from a file.
+type BackfillConfig struct {
+	// Database and RetentionPolicy are where the points are written,
+	// Database defaults to MyDB.
+	Database        string
+	RetentionPolicy string
+
+	// Precision is the precision of the timestamps of line protocol input,
+	// one of "ns", "u", "ms", "s", "m" and "h". Defaults to "ns".
+	Precision string
+
+	// BatchSize is the maximum number of points in a single BatchPoints,
+	// defaults to DefaultBackfillBatchSize.
+	BatchSize int
+
+	// Rate limits how many batches are written per second, zero does not
+	// limit.
+	Rate RateLimit
+
+	// MaxBadLines stops the import with ErrTooManyBadLines once more than
+	// MaxBadLines lines failed to parse, zero never stops.
+	MaxBadLines int
+
+	// Progress is called after every written batch.
+	Progress func(BackfillResult)
+}
+
+// BackfillResult reports an import: the points and batches written and the
+// lines skipped because they failed to parse, each error carrying the line
+// number.
+type BackfillResult struct {
+	Points   int
+	Batches  int
+	BadLines []error
+}
+
+// ErrTooManyBadLines is returned when an import has more bad lines than
+// BackfillConfig.MaxBadLines.
+var ErrTooManyBadLines = errors.New("backfill: too many bad lines")
+
+// CSVMapping maps the columns of a CSV file, named by its header line, to
+// points.
+type CSVMapping struct {
+	// Measurement is the measurement of every point, unless
+	// MeasurementColumn names the column holding it.
+	Measurement       string
+	MeasurementColumn string
+
+	// TimeColumn holds the timestamps, defaults to "time". TimeFormat is
+	// "s", "ms", "us" or "ns" for integer epochs, a time layout as
+	// accepted by time.Parse, or empty for RFC3339.
+	TimeColumn string
+	TimeFormat string
+
+	// Tags are the columns stored as tags.
+	Tags []string
+
+	// Fields maps the columns stored as fields to their type, one of
+	// "float", "integer", "string" and "boolean", or empty to take the type
+	// from the value. When it is empty, every other column is a field.
+	Fields map[string]string
+
+	// Comma is the field delimiter, defaults to ','.
+	Comma rune
+}
+
+// BackfillLineProtocol writes the line protocol read from r through c.
+// Empty lines and comments starting with '#' are skipped, lines that fail to
+// parse are reported in the result.
+func BackfillLineProtocol(c Client, r io.Reader, conf BackfillConfig) (BackfillResult, error) {
+	if conf.Precision == "" {
+		conf.Precision = "ns"
+	}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxBackfillLine)
+	n := 0
+	var pending []*Point
+	return backfill(c, conf, func() ([]*Point, int, error) {
+		for len(pending) == 0 {
+			if !scanner.Scan() {
+				if err := scanner.Err(); err != nil {
+					return nil, n + 1, err
+				}
+				return nil, n, io.EOF
+			}
+			n++
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || line[0] == '#' {
+				continue
+			}
+			pts, err := models.ParsePointsWithPrecision([]byte(line), time.Now().UTC(), conf.Precision)
+			if err != nil {
+				return nil, n, &lineError{err}
+			}
+			for _, pt := range pts {
+				pending = append(pending, NewPointFrom(pt))
+			}
+		}
+		pts := pending
+		pending = nil
+		return pts, n, nil
+	})
+}
+
+// BackfillCSV writes the rows of the CSV file read from r through c,
+// converted to points with mapping. The first line is the header. Rows that
+// fail to convert are reported in the result.
+func BackfillCSV(c Client, r io.Reader, mapping CSVMapping, conf BackfillConfig) (BackfillResult, error) {
+	reader := csv.NewReader(r)
+	if mapping.Comma != 0 {
+		reader.Comma = mapping.Comma
+	}
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err != nil {
+		return BackfillResult{}, fmt.Errorf("backfill: csv header: %w", err)
+	}
+	conv, err := newCSVConverter(mapping, header)
+	if err != nil {
+		return BackfillResult{}, err
+	}
+
+	return backfill(c, conf, func() ([]*Point, int, error) {
+		record, err := reader.Read()
+		if err != nil {
+			var perr *csv.ParseError
+			if errors.As(err, &perr) {
+				return nil, perr.Line, &lineError{perr.Err}
+			}
+			line, _ := reader.FieldPos(0)
+			return nil, line, err
+		}
+		line, _ := reader.FieldPos(0)
+		pt, err := conv.point(record)
+		if err != nil {
+			return nil, line, &lineError{err}
+		}
+		return []*Point{pt}, line, nil
+	})
+}
+
+// lineError is an input line that failed to parse, the import goes on with
+// the next line.
+type lineError struct{ err error }
+
+func (e *lineError) Error() string { return e.err.Error() }
+func (e *lineError) Unwrap() error { return e.err }
+
+// backfill writes the points returned by next in batches. next returns
+// io.EOF at the end of the input and a *lineError for a bad line.
+func backfill(c Client, conf BackfillConfig, next func() ([]*Point, int, error)) (BackfillResult, error) {
+	if conf.Database == "" {
+		conf.Database = MyDB
+	}
+	if conf.BatchSize <= 0 {
+		conf.BatchSize = DefaultBackfillBatchSize
+	}
+	var result BackfillResult
+	limiter := newTokenBucket(conf.Rate, time.Now())
+	bpConf := BatchPointsConfig{Database: conf.Database, RetentionPolicy: conf.RetentionPolicy}
+	bp, _ := NewBatchPoints(bpConf)
+	flush := func() error {
+		n := len(bp.Points())
+		if n == 0 {
+			return nil
+		}
+		if delay := limiter.reserve(time.Now()); delay > 0 {
+			time.Sleep(delay)
+		}
+		if err := c.Write(bp); err != nil {
+			return fmt.Errorf("backfill: write %d points: %w", n, err)
+		}
+		result.Points += n
+		result.Batches++
+		bp, _ = NewBatchPoints(bpConf)
+		if conf.Progress != nil {
+			conf.Progress(result)
+		}
+		return nil
+	}
+
+	for {
+		pts, line, err := next()
+		if err == io.EOF {
+			return result, flush()
+		}
+		var lerr *lineError
+		if errors.As(err, &lerr) {
+			result.BadLines = append(result.BadLines, fmt.Errorf("line %d: %w", line, lerr.err))
+			if conf.MaxBadLines > 0 && len(result.BadLines) > conf.MaxBadLines {
+				return result, ErrTooManyBadLines
+			}
+			continue
+		}
+		if err != nil {
+			return result, fmt.Errorf("backfill: line %d: %w", line, err)
+		}
+		for _, pt := range pts {
+			bp.AddPoint(pt)
+			if len(bp.Points()) >= conf.BatchSize {
+				if err := flush(); err != nil {
+					return result, err
+				}
+			}
+		}
+	}
+}
+
+// csvConverter converts CSV records to points by the column indexes of a
+// CSVMapping.
+type csvConverter struct {
+	measurement   string
+	measurementAt int
+	timeAt        int
+	timeFormat    string
+	tags          map[int]string
+	fields        map[int]csvField
+}
+
+type csvField struct {
+	name, datatype string
+}
+
+func newCSVConverter(mapping CSVMapping, header []string) (*csvConverter, error) {
+	if mapping.TimeColumn == "" {
+		mapping.TimeColumn = "time"
+	}
+	index := make(map[string]int, len(header))
+	for i, column := range header {
+		index[strings.TrimSpace(column)] = i
+	}
+	column := func(name string) (int, error) {
+		i, ok := index[name]
+		if !ok {
+			return 0, fmt.Errorf("backfill: csv has no column %q", name)
+		}
+		return i, nil
+	}
+
+	conv := &csvConverter{measurement: mapping.Measurement, measurementAt: -1, timeFormat: mapping.TimeFormat, tags: make(map[int]string), fields: make(map[int]csvField)}
+	var err error
+	if conv.timeAt, err = column(mapping.TimeColumn); err != nil {
+		return nil, err
+	}
+	if mapping.MeasurementColumn != "" {
+		if conv.measurementAt, err = column(mapping.MeasurementColumn); err != nil {
+			return nil, err
+		}
+	} else if mapping.Measurement == "" {
+		return nil, errors.New("backfill: csv mapping has no measurement")
+	}
+	for _, tag := range mapping.Tags {
+		i, err := column(tag)
+		if err != nil {
+			return nil, err
+		}
+		conv.tags[i] = tag
+	}
+	for name, datatype := range mapping.Fields {
+		switch datatype {
+		case "", "float", "integer", "string", "boolean":
+		default:
+			return nil, fmt.Errorf("backfill: field %s: unknown type %q", name, datatype)
+		}
+		i, err := column(name)
+		if err != nil {
+			return nil, err
+		}
+		conv.fields[i] = csvField{name, datatype}
+	}
+	if len(mapping.Fields) == 0 {
+		for i, name := range header {
+			if _, ok := conv.tags[i]; !ok && i != conv.timeAt && i != conv.measurementAt {
+				conv.fields[i] = csvField{strings.TrimSpace(name), ""}
+			}
+		}
+	}
+	if len(conv.fields) == 0 {
+		return nil, errors.New("backfill: csv mapping has no fields")
+	}
+	return conv, nil
+}
+
+// point converts a record. Empty tag and field cells are left out.
+func (conv *csvConverter) point(record []string) (*Point, error) {
+	cell := func(i int) string {
+		if i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+	measurement := conv.measurement
+	if conv.measurementAt >= 0 {
+		if measurement = cell(conv.measurementAt); measurement == "" {
+			return nil, errors.New("empty measurement")
+		}
+	}
+	t, err := parseCSVTime(cell(conv.timeAt), conv.timeFormat)
+	if err != nil {
+		return nil, err
+	}
+	tags := make(map[string]string, len(conv.tags))
+	for i, name := range conv.tags {
+		if v := cell(i); v != "" {
+			tags[name] = v
+		}
+	}
+	fields := make(map[string]interface{}, len(conv.fields))
+	for i, f := range conv.fields {
+		v := cell(i)
+		if v == "" {
+			continue
+		}
+		value, err := parseCSVField(v, f.datatype)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", f.name, err)
+		}
+		fields[f.name] = value
+	}
+	if len(fields) == 0 {
+		return nil, errors.New("no fields")
+	}
+	return NewPoint(measurement, tags, fields, t)
+}
+
+// parseCSVTime parses a timestamp in the format of CSVMapping.TimeFormat.
+func parseCSVTime(v, format string) (time.Time, error) {
+	unit := map[string]time.Duration{"s": time.Second, "ms": time.Millisecond, "us": time.Microsecond, "ns": time.Nanosecond}
+	if d, ok := unit[format]; ok {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid time %q", v)
+		}
+		return time.Unix(0, n*int64(d)), nil
+	}
+	if format == "" {
+		format = time.RFC3339Nano
+	}
+	t, err := time.Parse(format, v)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q", v)
+	}
+	return t, nil
+}
+
+// parseCSVField parses a field value of the type, or of the type its syntax
+// suggests when datatype is empty.
+func parseCSVField(v, datatype string) (interface{}, error) {
+	switch datatype {
+	case "float":
+		return strconv.ParseFloat(v, 64)
+	case "integer":
+		return strconv.ParseInt(v, 10, 64)
+	case "boolean":
+		return strconv.ParseBool(v)
+	case "string":
+		return v, nil
+	}
+	if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return n, nil
+	}
+	if f, err := strconv.ParseFloat(v, 64); err == nil {
+		return f, nil
+	}
+	if b, err := strconv.ParseBool(v); err == nil {
+		return b, nil
+	}
+	return v, nil
+}
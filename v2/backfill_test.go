@@ -0,0 +1,126 @@
+package client
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+/* 记录每次写入的 line protocol */
+func newBackfillServer(t *testing.T) (*httptest.Server, *[]string) {
+	var mu sync.Mutex
+	batches := make([]string, 0)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.FormValue("db") != "backfilled" {
+			t.Errorf("db:\t%s\nexpected:\t%s", r.FormValue("db"), "backfilled")
+		}
+		var body bytes.Buffer
+		io.Copy(&body, r.Body)
+		batches = append(batches, strings.TrimSpace(body.String()))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	return ts, &batches
+}
+
+func TestBackfillLineProtocol(t *testing.T) {
+	ts, batches := newBackfillServer(t)
+	defer ts.Close()
+	c, _ := NewHTTPClient(HTTPConfig{Addr: ts.URL})
+	defer c.Close()
+
+	input := `# exported from NOAA_water_database
+h2o_feet,location=coyote_creek water_level=8.12 1566000000
+
+h2o_feet,location=coyote_creek water_level= 1566000360
+h2o_feet,location=santa_monica water_level=2.064 1566000000
+h2o_pH,location=santa_monica pH=7i 1566000000
+`
+	var reported []BackfillResult
+	conf := BackfillConfig{Database: "backfilled", Precision: "s", BatchSize: 2, Progress: func(r BackfillResult) { reported = append(reported, r) }}
+	result, err := BackfillLineProtocol(c, strings.NewReader(input), conf)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Points != 3 || result.Batches != 2 || len(reported) != 2 {
+		t.Errorf("result:\t%+v", result)
+	}
+	if len(result.BadLines) != 1 || !strings.HasPrefix(result.BadLines[0].Error(), "line 4: ") {
+		t.Errorf("bad lines:\t%v", result.BadLines)
+	}
+	expected := []string{
+		"h2o_feet,location=coyote_creek water_level=8.12 1566000000000000000\nh2o_feet,location=santa_monica water_level=2.064 1566000000000000000",
+		"h2o_pH,location=santa_monica pH=7i 1566000000000000000",
+	}
+	if strings.Join(*batches, "\n--\n") != strings.Join(expected, "\n--\n") {
+		t.Errorf("batches:\n%s\nexpected:\n%s", strings.Join(*batches, "\n--\n"), strings.Join(expected, "\n--\n"))
+	}
+
+	/* 坏行超过 MaxBadLines 时停止 */
+	conf.MaxBadLines = 1
+	_, err = BackfillLineProtocol(c, strings.NewReader("bad\nworse\nh2o_pH pH=7i 1566000000\n"), conf)
+	if !errors.Is(err, ErrTooManyBadLines) {
+		t.Errorf("error:\t%v\nexpected:\t%v", err, ErrTooManyBadLines)
+	}
+}
+
+func TestBackfillCSV(t *testing.T) {
+	ts, batches := newBackfillServer(t)
+	defer ts.Close()
+	c, _ := NewHTTPClient(HTTPConfig{Addr: ts.URL})
+	defer c.Close()
+
+	input := `name,location,timestamp,index,comment
+h2o_quality,coyote_creek,1566000000000,41,
+h2o_quality,santa_monica,1566000000000,99,"high"
+h2o_quality,santa_monica,1566000360000,ninety,
+,santa_monica,1566000720000,12,
+h2o_quality,,1566001080000,7,"no location"
+`
+	mapping := CSVMapping{
+		MeasurementColumn: "name",
+		TimeColumn:        "timestamp",
+		TimeFormat:        "ms",
+		Tags:              []string{"location"},
+		Fields:            map[string]string{"index": "integer", "comment": "string"},
+	}
+	result, err := BackfillCSV(c, strings.NewReader(input), mapping, BackfillConfig{Database: "backfilled"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	/* 第 4 行的 index 不是整数，第 5 行没有 measurement，空的 tag 和 field 被省略 */
+	if result.Points != 3 || result.Batches != 1 || len(result.BadLines) != 2 {
+		t.Errorf("result:\t%+v", result)
+	}
+	if len(result.BadLines) == 2 && (!strings.HasPrefix(result.BadLines[0].Error(), "line 4: field index: ") || result.BadLines[1].Error() != "line 5: empty measurement") {
+		t.Errorf("bad lines:\t%v", result.BadLines)
+	}
+	expected := "h2o_quality,location=coyote_creek index=41i 1566000000000000000\n" +
+		"h2o_quality,location=santa_monica comment=\"high\",index=99i 1566000000000000000\n" +
+		"h2o_quality comment=\"no location\",index=7i 1566001080000000000"
+	if len(*batches) != 1 || (*batches)[0] != expected {
+		t.Errorf("batches:\n%s\nexpected:\n%s", strings.Join(*batches, "\n--\n"), expected)
+	}
+
+	/* 不指定 Fields 时其余的列都是 field，类型由值决定 */
+	*batches = (*batches)[:0]
+	input = "time,host,usage,up\n2019-08-17T00:00:00Z,server01,0.5,true\n"
+	result, err = BackfillCSV(c, strings.NewReader(input), CSVMapping{Measurement: "cpu", Tags: []string{"host"}}, BackfillConfig{Database: "backfilled"})
+	if err != nil || result.Points != 1 {
+		t.Fatalf("result:\t%+v error:\t%v", result, err)
+	}
+	if expected := "cpu,host=server01 up=true,usage=0.5 1566000000000000000"; (*batches)[0] != expected {
+		t.Errorf("batch:\t%s\nexpected:\t%s", (*batches)[0], expected)
+	}
+
+	if _, err := BackfillCSV(c, strings.NewReader(input), CSVMapping{Measurement: "cpu", Tags: []string{"region"}}, BackfillConfig{}); err == nil {
+		t.Error("expected error for missing column")
+	}
+}
@@ -0,0 +1,245 @@
+package client
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/influxdata/influxql"
+)
+
+// BalanceStrategy selects which InfluxDB endpoint serves a read request.
+type BalanceStrategy string
+
+const (
+	// RoundRobin sends reads to every healthy endpoint in turn.
+	RoundRobin BalanceStrategy = "round-robin"
+
+	// LeastLatency sends reads to the healthy endpoint with the lowest
+	// observed request latency.
+	LeastLatency BalanceStrategy = "least-latency"
+)
+
+// endpoint is one InfluxDB server the client can send requests to.
+type endpoint struct {
+	url       url.URL
+	unhealthy int32 // set after a connection error, cleared by a successful request or health check
+	latency   int64 // moving average of the request latency in nanoseconds
+}
+
+func (e *endpoint) healthy() bool {
+	return atomic.LoadInt32(&e.unhealthy) == 0
+}
+
+func (e *endpoint) markHealthy(healthy bool) {
+	if healthy {
+		atomic.StoreInt32(&e.unhealthy, 0)
+	} else {
+		atomic.StoreInt32(&e.unhealthy, 1)
+	}
+}
+
+// observe folds a request latency into the moving average.
+func (e *endpoint) observe(d time.Duration) {
+	for {
+		old := atomic.LoadInt64(&e.latency)
+		avg := int64(d)
+		if old > 0 {
+			avg = (old*7 + int64(d)) / 8
+		}
+		if atomic.CompareAndSwapInt64(&e.latency, old, avg) {
+			return
+		}
+	}
+}
+
+// target rewrites a request built against the client's primary url so that
+// it is sent to e instead.
+func (e *endpoint) target(req *http.Request, primary url.URL) *http.Request {
+	r := req.Clone(req.Context())
+	r.URL.Scheme = e.url.Scheme
+	r.URL.Host = e.url.Host
+	r.URL.Path = path.Join(e.url.Path, strings.TrimPrefix(req.URL.Path, primary.Path))
+	r.Host = ""
+	if req.GetBody != nil {
+		r.Body, _ = req.GetBody()
+	}
+	return r
+}
+
+// order returns the endpoints in the order they should be tried. Reads are
+// spread according to the balance strategy, everything else prefers the
+// first healthy endpoint in configuration order. Unhealthy endpoints are
+// only tried after all healthy ones.
+func (c *client) order(read bool) []*endpoint {
+	n := len(c.endpoints)
+	if n == 1 {
+		return c.endpoints
+	}
+
+	start := 0
+	if read {
+		switch c.balance {
+		case LeastLatency:
+			best := int64(-1)
+			for i, e := range c.endpoints {
+				l := atomic.LoadInt64(&e.latency)
+				if e.healthy() && (best < 0 || l < best) {
+					best, start = l, i
+				}
+			}
+		default:
+			start = int(atomic.AddUint64(&c.next, 1) % uint64(n))
+		}
+	}
+
+	healthy := make([]*endpoint, 0, n)
+	unhealthy := make([]*endpoint, 0)
+	for i := 0; i < n; i++ {
+		e := c.endpoints[(start+i)%n]
+		if e.healthy() {
+			healthy = append(healthy, e)
+		} else {
+			unhealthy = append(unhealthy, e)
+		}
+	}
+	return append(healthy, unhealthy...)
+}
+
+// do sends req to the endpoints chosen by order, failing over to the next
+// endpoint when the connection itself fails. HTTP error statuses are returned
+// to the caller unchanged since another replica would answer the same. When
+// MaxRetries is set, requests that reached no endpoint or got a 502, 503 or
+// 504 are retried with exponential backoff.
+func (c *client) do(req *http.Request, read bool) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		r := req
+		if attempt > 0 && req.GetBody != nil {
+			r = req.Clone(req.Context())
+			r.Body, _ = req.GetBody()
+		}
+		resp, err := c.doOnce(r, read)
+		if attempt >= c.maxRetries || req.Context().Err() != nil || !retryable(resp, err) {
+			return resp, err
+		}
+		if resp != nil {
+			resp.Body.Close()
+		}
+
+		select {
+		case <-time.After(c.retryInterval << uint(attempt)):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-c.done:
+			return nil, errors.New("client closed")
+		}
+	}
+}
+
+// readOnly reports whether every statement of command only reads, that is
+// it is a SHOW or a SELECT without INTO. Such commands are spread across the
+// endpoints like reads; everything else, including commands that do not
+// parse, goes to the primary first.
+func readOnly(command string) bool {
+	query, err := influxql.ParseQuery(command)
+	if err != nil || len(query.Statements) == 0 {
+		return false
+	}
+	for _, stmt := range query.Statements {
+		switch s := stmt.(type) {
+		case *influxql.SelectStatement:
+			if s.Target != nil {
+				return false
+			}
+		case *influxql.ShowContinuousQueriesStatement, *influxql.ShowDatabasesStatement,
+			*influxql.ShowDiagnosticsStatement, *influxql.ShowFieldKeyCardinalityStatement,
+			*influxql.ShowFieldKeysStatement, *influxql.ShowGrantsForUserStatement,
+			*influxql.ShowMeasurementCardinalityStatement, *influxql.ShowMeasurementsStatement,
+			*influxql.ShowQueriesStatement, *influxql.ShowRetentionPoliciesStatement,
+			*influxql.ShowSeriesCardinalityStatement, *influxql.ShowSeriesStatement,
+			*influxql.ShowShardGroupsStatement, *influxql.ShowShardsStatement,
+			*influxql.ShowStatsStatement, *influxql.ShowSubscriptionsStatement,
+			*influxql.ShowTagKeyCardinalityStatement, *influxql.ShowTagKeysStatement,
+			*influxql.ShowTagValuesCardinalityStatement, *influxql.ShowTagValuesStatement,
+			*influxql.ShowUsersStatement:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// retryable reports whether a request is worth sending again.
+func retryable(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	switch resp.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+func (c *client) doOnce(req *http.Request, read bool) (*http.Response, error) {
+	var lastErr error
+	for _, e := range c.order(read) {
+		r := req
+		if len(c.endpoints) > 1 {
+			r = e.target(req, c.url)
+		}
+		start := time.Now()
+		resp, err := c.httpClient.Do(r)
+		if err != nil {
+			e.markHealthy(false)
+			lastErr = err
+			if req.Context().Err() != nil {
+				break
+			}
+			continue
+		}
+		e.observe(time.Since(start))
+		e.markHealthy(true)
+		return resp, nil
+	}
+	return nil, lastErr
+}
+
+// healthCheck pings every endpoint each interval until the client is closed.
+func (c *client) healthCheck(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			for _, e := range c.endpoints {
+				u := e.url
+				u.Path = path.Join(u.Path, "ping")
+				req, err := http.NewRequest("GET", u.String(), nil)
+				if err != nil {
+					continue
+				}
+				req.Header.Set("User-Agent", c.useragent)
+				c.setAuth(req)
+				start := time.Now()
+				resp, err := c.httpClient.Do(req)
+				if err != nil {
+					e.markHealthy(false)
+					continue
+				}
+				resp.Body.Close()
+				healthy := resp.StatusCode == http.StatusNoContent
+				if healthy {
+					e.observe(time.Since(start))
+				}
+				e.markHealthy(healthy)
+			}
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package client
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newCountingServer(hits *int32, delay time.Duration) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(hits, 1)
+		time.Sleep(delay)
+		if r.URL.Path == "/ping" {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(`{"results":[{"statement_id":0}]}`))
+	}))
+}
+
+func TestClient_RoundRobin(t *testing.T) {
+	var hitsA, hitsB int32
+	a, b := newCountingServer(&hitsA, 0), newCountingServer(&hitsB, 0)
+	defer a.Close()
+	defer b.Close()
+
+	c, err := NewHTTPClient(HTTPConfig{Addr: a.URL, Addrs: []string{b.URL}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer c.Close()
+
+	for i := 0; i < 10; i++ {
+		if _, err := c.Query(NewQuery("SELECT * FROM cpu", "db", "")); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if hitsA != 5 || hitsB != 5 {
+		t.Errorf("hits:\t%d %d\nexpected:\t5 5", hitsA, hitsB)
+	}
+}
+
+func TestClient_WritesToPrimary(t *testing.T) {
+	var hitsA, hitsB int32
+	a, b := newCountingServer(&hitsA, 0), newCountingServer(&hitsB, 0)
+	defer a.Close()
+	defer b.Close()
+
+	c, _ := NewHTTPClient(HTTPConfig{Addr: a.URL, Addrs: []string{b.URL}})
+	defer c.Close()
+
+	/* 修改 schema 和写入数据的语句都先发给主节点，和只读语句放在一起时也是 */
+	commands := []string{
+		"CREATE DATABASE db",
+		"DROP MEASUREMENT cpu",
+		"DELETE FROM cpu WHERE time < 0",
+		"SELECT mean(value) INTO cpu_1m FROM cpu GROUP BY time(1m)",
+		"SHOW MEASUREMENTS; DROP SERIES FROM cpu",
+		"SELECT * FROM cpu WHERE",
+	}
+	for _, command := range commands {
+		c.Query(NewQuery(command, "db", ""))
+		c.QueryAsChunk(NewQuery(command, "db", ""))
+	}
+	if hitsA != int32(2*len(commands)) || hitsB != 0 {
+		t.Errorf("hits:\t%d %d\nexpected:\t%d 0", hitsA, hitsB, 2*len(commands))
+	}
+
+	/* SHOW 和没有 INTO 的 SELECT 轮流发给各个节点 */
+	for i := 0; i < 4; i++ {
+		c.Query(NewQuery("SHOW TAG KEYS; SELECT * FROM cpu", "db", ""))
+	}
+	if hitsB != 2 {
+		t.Errorf("reads on replica:\t%d\nexpected:\t%d", hitsB, 2)
+	}
+}
+
+func TestClient_Failover(t *testing.T) {
+	var hitsA, hitsB int32
+	a, b := newCountingServer(&hitsA, 0), newCountingServer(&hitsB, 0)
+	defer b.Close()
+	a.Close()
+
+	c, _ := NewHTTPClient(HTTPConfig{Addr: a.URL, Addrs: []string{b.URL}})
+	defer c.Close()
+
+	for i := 0; i < 4; i++ {
+		if _, err := c.Query(NewQuery("SELECT * FROM cpu", "db", "")); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if _, _, err := c.Ping(0); err != nil {
+		t.Errorf("unexpected ping error: %v", err)
+	}
+	if hitsB != 5 {
+		t.Errorf("hits:\t%d\nexpected:\t%d", hitsB, 5)
+	}
+
+	bp, _ := NewBatchPoints(BatchPointsConfig{Database: "db"})
+	pt, _ := NewPoint("cpu", nil, map[string]interface{}{"value": 1.0}, time.Unix(0, 0))
+	bp.AddPoint(pt)
+	// write 返回 204 之外的状态码会报错，这里只检查请求被转移到了健康的节点
+	_ = c.Write(bp)
+	if hitsB != 6 {
+		t.Errorf("write was not failed over, hits:\t%d", hitsB)
+	}
+}
+
+func TestClient_LeastLatency(t *testing.T) {
+	var hitsSlow, hitsFast int32
+	slow, fast := newCountingServer(&hitsSlow, 20*time.Millisecond), newCountingServer(&hitsFast, 0)
+	defer slow.Close()
+	defer fast.Close()
+
+	c, _ := NewHTTPClient(HTTPConfig{
+		Addr:                slow.URL,
+		Addrs:               []string{fast.URL},
+		Balancer:            LeastLatency,
+		HealthCheckInterval: 10 * time.Millisecond,
+	})
+	defer c.Close()
+
+	time.Sleep(100 * time.Millisecond)
+	atomic.StoreInt32(&hitsSlow, 0)
+	atomic.StoreInt32(&hitsFast, 0)
+	for i := 0; i < 5; i++ {
+		if _, err := c.Query(NewQuery("SELECT * FROM cpu", "db", "")); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if atomic.LoadInt32(&hitsFast) < 5 {
+		t.Errorf("fast endpoint hits:\t%d\nexpected:\t%d", hitsFast, 5)
+	}
+}
+
+func TestNewHTTPClient_InvalidAddrs(t *testing.T) {
+	if _, err := NewHTTPClient(HTTPConfig{Addr: "http://localhost:8086", Addrs: []string{"udp://localhost:8089"}}); err == nil {
+		t.Error("expected error for unsupported scheme")
+	}
+	if _, err := NewHTTPClient(HTTPConfig{Addr: "http://localhost:8086", Balancer: "random"}); err == nil {
+		t.Error("expected error for unsupported balancer")
+	}
+}
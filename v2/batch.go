@@ -0,0 +1,212 @@
+package client
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/InfluxDB-client/memcache"
+	"github.com/influxdata/influxql"
+)
+
+// CacheInfo 是一批查询经过cache执行的统计
+type CacheInfo struct {
+	Queries     int // 批量中的查询数
+	Hits        int // 完全从cache读取的查询
+	PartialHits int // 部分从cache读取、部分查询数据库的查询
+	Misses      int // 完全查询数据库的查询
+
+	CacheReads   int // 读取cache的次数，相同的语义段和时间范围只读一次
+	DBStatements int // 查询数据库的语句数，相同的语句只查询一次
+	DBRequests   int // 查询数据库的请求数，同一张表同一时间范围的语句合并在一个请求中
+
+	CacheBytes int64 // 从cache读取的估计字节数，见 ExplainCachePlan
+	DBBytes    int64 // 从数据库读取的估计字节数
+
+	// Errors 是没有影响查询结果的cache错误：读取失败的部分改为查询数据库，存入失败的结果下次仍然查询数据库
+	Errors []error
+}
+
+// batchPart 是一个查询的结果的一部分：从cache读取一个时间范围，或者执行一条数据库语句
+type batchPart struct {
+	key     string // cache中的语义段，查询数据库时为空
+	query   string // 数据库语句，读取cache时是这个时间范围的查询，读取失败时改为执行它
+	r       Interval
+	store   bool // 查询数据库的结果是否存入cache
+	db      string
+	prec    string
+	group   string // 合并到同一个请求的语句的分组
+	resp    *Response
+	fetched bool
+}
+
+// QueryBatchCached 一起规划和执行一批查询，适合仪表盘同时发出的一组相关查询：每个查询按 ExplainCachePlan 拆成读取cache和查询数据库的部分，
+// 相同的语义段和时间范围只读取一次cache，相同的语句只查询一次数据库，同一张表同一时间范围的语句合并在一个请求中；
+// 查询数据库的结果存入cache。返回和 queries 顺序相同的结果，以及整批的统计。
+// 使用 DefaultClient 和 DefaultCache；不能规划的查询（不是 SELECT、多个表等）直接查询数据库，结果不存入cache
+func QueryBatchCached(queries []Query) ([]*Response, *CacheInfo, error) {
+	c, mc := DefaultClient(), DefaultCache()
+	if c == nil {
+		return nil, nil, fmt.Errorf("no default client")
+	}
+	info := &CacheInfo{Queries: len(queries)}
+
+	/* 规划每个查询，相同的部分共用一个 batchPart */
+	parts := make(map[string]*batchPart)
+	share := func(p *batchPart) *batchPart {
+		id := fmt.Sprintf("%s\x00%s\x00%d\x00%d\x00%s\x00%s", p.key, p.query, p.r.Start, p.r.End, p.db, p.prec)
+		if shared, ok := parts[id]; ok {
+			return shared
+		}
+		parts[id] = p
+		return p
+	}
+	plans := make([][]*batchPart, len(queries))
+	for i, q := range queries {
+		plan, err := ExplainCachePlan(q.Command)
+		if err != nil || mc == nil || q.ChunkSize > 0 {
+			plans[i] = []*batchPart{share(&batchPart{query: q.Command, db: q.Database, prec: q.Precision, group: q.Command})}
+			info.Misses++
+			continue
+		}
+		info.CacheBytes += plan.CacheBytes
+		info.DBBytes += plan.DBBytes
+		switch {
+		case len(plan.Residual) == 0 && len(plan.Covered) > 0:
+			info.Hits++
+		case len(plan.Covered) > 0:
+			info.PartialHits++
+		default:
+			info.Misses++
+		}
+		group := batchGroup(plan.Query)
+		for _, step := range plan.Steps {
+			p := &batchPart{query: step.Query, r: step.Range, store: true, db: q.Database, prec: q.Precision}
+			switch step.Kind {
+			case PlanCacheRead:
+				p.key = step.Key
+				p.query, _ = QueryWithTimeRange(plan.Query, step.Range.Start, step.Range.End)
+			case PlanDBQuery:
+			default:
+				continue
+			}
+			p.group = fmt.Sprintf("%s\x00%d\x00%d", group, step.Range.Start, step.Range.End)
+			plans[i] = append(plans[i], share(p))
+		}
+	}
+
+	/* 先读取cache，读取失败的部分改为查询数据库 */
+	for _, p := range parts {
+		if p.key == "" {
+			continue
+		}
+		info.CacheReads++
+		resp, err := getResponse(p.key, p.r.Start, p.r.Start, p.r.End, mc)
+		if err != nil {
+			if err != memcache.ErrCacheMiss {
+				info.Errors = append(info.Errors, err)
+			}
+			p.key = ""
+			continue
+		}
+		p.resp, p.fetched = responseWithPrecision(resp, "ns", p.prec), true
+	}
+
+	/* 同一分组的语句在一个请求中查询数据库 */
+	type request struct {
+		db, prec string
+		parts    []*batchPart
+	}
+	requests := make(map[string]*request)
+	order := make([]string, 0)
+	for _, p := range parts {
+		if p.fetched {
+			continue
+		}
+		id := p.db + "\x00" + p.prec + "\x00" + p.group
+		if _, ok := requests[id]; !ok {
+			requests[id] = &request{db: p.db, prec: p.prec}
+			order = append(order, id)
+		}
+		requests[id].parts = append(requests[id].parts, p)
+	}
+	for _, id := range order {
+		req := requests[id]
+		commands := make([]string, len(req.parts))
+		for i, p := range req.parts {
+			commands[i] = p.query
+		}
+		command := strings.Join(commands, "; ")
+		if err := waitDBLimiter(command); err != nil {
+			return nil, nil, err
+		}
+		resp, err := c.Query(NewQuery(command, req.db, req.prec))
+		if err != nil {
+			return nil, nil, err
+		}
+		info.DBRequests++
+		info.DBStatements += len(req.parts)
+		if resp.Err != "" {
+			for _, p := range req.parts {
+				p.resp, p.fetched = resp, true
+			}
+			continue
+		}
+		if len(resp.Results) != len(req.parts) {
+			return nil, nil, fmt.Errorf("batch of %d statements returned %d results", len(req.parts), len(resp.Results))
+		}
+		for i, p := range req.parts {
+			r := resp.Results[i]
+			r.StatementId = 0
+			p.resp, p.fetched = &Response{Results: []Result{r}, statusCode: resp.statusCode}, true
+			if p.store && r.Err == "" && !ResponseIsEmpty(p.resp) {
+				if err := setResponse(p.query, p.prec, p.resp, mc); err != nil {
+					info.Errors = append(info.Errors, err)
+				}
+			}
+		}
+	}
+
+	/* 按时间顺序合并每个查询的各部分 */
+	results := make([]*Response, len(queries))
+	for i, plan := range plans {
+		results[i] = mergeBatchParts(plan)
+	}
+	return results, info, nil
+}
+
+// batchGroup 返回查询的表，同一张表同一时间范围的语句合并在一个请求中；不是单个表时返回查询本身
+func batchGroup(queryString string) string {
+	s, ok := selectStatement(queryString)
+	if !ok || len(s.Sources) != 1 {
+		return queryString
+	}
+	if m, ok := s.Sources[0].(*influxql.Measurement); ok && m.Regex == nil {
+		return m.Database + "." + m.RetentionPolicy + "." + m.Name
+	}
+	return queryString
+}
+
+// mergeBatchParts 按时间顺序合并一个查询的各部分，各部分的结果可能被其他查询共用，不修改它们
+func mergeBatchParts(parts []*batchPart) *Response {
+	var merged *Response
+	for _, p := range parts {
+		if p.resp.Error() != nil {
+			return p.resp
+		}
+		if len(p.resp.Results) == 0 || ResponseIsEmpty(p.resp) {
+			continue
+		}
+		if merged == nil {
+			merged = &Response{Results: append([]Result(nil), p.resp.Results...), Err: p.resp.Err, statusCode: p.resp.statusCode}
+			continue
+		}
+		merged = MergeResultTable(merged, p.resp)
+	}
+	if merged == nil {
+		if len(parts) == 1 {
+			return &Response{Results: append([]Result(nil), parts[0].resp.Results...), statusCode: parts[0].resp.statusCode}
+		}
+		return &Response{Results: []Result{{}}}
+	}
+	return merged
+}
@@ -0,0 +1,112 @@
+package client
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/InfluxDB-client/diskcache"
+	"github.com/InfluxDB-client/memcache"
+	"github.com/influxdata/influxdb1-client/models"
+)
+
+func TestQueryBatchCached(t *testing.T) {
+	var mu sync.Mutex
+	requests := make([][]string, 0)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		statements := strings.Split(r.FormValue("q"), "; ")
+		mu.Lock()
+		requests = append(requests, statements)
+		mu.Unlock()
+		/* 每条语句的时间范围内每秒一条数据 */
+		resp := Response{Results: make([]Result, len(statements))}
+		for i, q := range statements {
+			start, end, _ := GetQueryTimeRange(q)
+			values := make([][]interface{}, 0)
+			for ts := (start + 999999999) / 1e9 * 1e9; ts <= end; ts += 1e9 {
+				values = append(values, []interface{}{ts, 1.5})
+			}
+			resp.Results[i] = Result{StatementId: i, Series: []models.Row{{Name: "cpu", Columns: []string{"time", "usage"}, Values: values}}}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer ts.Close()
+	c, err := NewHTTPClient(HTTPConfig{Addr: ts.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer SetDefaultClient(SetDefaultClient(c))
+
+	s, err := diskcache.Listen(filepath.Join(t.TempDir(), "cache.db"), "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	defer SetDefaultCache(SetDefaultCache(memcache.New(s.Addr())))
+	defer SetSchema(SetSchema(&Schema{
+		Fields:     map[string][]string{"cpu": {"usage"}},
+		FieldTypes: map[string]map[string]string{"cpu": {"usage": "float64"}},
+		TagKV: MeasurementTagMap{Measurement: map[string][]TagKeyMap{
+			"cpu": {{Tag: map[string]TagValues{"host": {Values: []string{"server01"}}}}},
+		}},
+	}))
+	defer func(ci *CoverageIndex) { Coverage = ci }(Coverage)
+	Coverage = NewCoverageIndex()
+
+	raw := NewQuery("SELECT usage FROM cpu WHERE time >= 0 AND time <= 10000000000", MyDB, "ns")
+	max := NewQuery("SELECT max(usage) FROM cpu WHERE time >= 0 AND time <= 10000000000 GROUP BY time(5s)", MyDB, "ns")
+
+	/* 相同的查询只查询一次数据库，同一张表同一时间范围的两条语句在一个请求中 */
+	resps, info, err := QueryBatchCached([]Query{raw, raw, max})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(requests) != 1 || len(requests[0]) != 2 || info.DBRequests != 1 || info.DBStatements != 2 || info.Misses != 3 {
+		t.Fatalf("requests:\t%v\ninfo:\t%+v", requests, info)
+	}
+	if len(resps) != 3 || len(resps[0].Results[0].Series) != 1 || len(resps[0].Results[0].Series[0].Values) != 11 {
+		t.Fatalf("responses:\t%v", resps)
+	}
+	if !reflect.DeepEqual(resps[0], resps[1]) || resps[0] == resps[1] {
+		t.Errorf("identical queries:\t%v\n\t%v", resps[0], resps[1])
+	}
+
+	/* 再次查询时都从cache读取，相同的语义段只读取一次 */
+	requests = requests[:0]
+	resps, info, err = QueryBatchCached([]Query{raw, raw, max})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(requests) != 0 || info.Hits != 3 || info.CacheReads != 2 || len(info.Errors) != 0 {
+		t.Fatalf("requests:\t%v\ninfo:\t%+v", requests, info)
+	}
+	if len(resps[0].Results[0].Series[0].Values) != 11 {
+		t.Errorf("cached response:\t%v", resps[0])
+	}
+
+	/* 时间范围扩大时只查询cache没有覆盖的部分，和cache中的结果合并 */
+	requests = requests[:0]
+	longer := NewQuery("SELECT usage FROM cpu WHERE time >= 0 AND time <= 20000000000", MyDB, "ns")
+	resps, info, err = QueryBatchCached([]Query{longer, raw})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.PartialHits != 1 || info.Hits != 1 || info.CacheReads != 1 || len(requests) != 1 || len(requests[0]) != 1 {
+		t.Fatalf("requests:\t%v\ninfo:\t%+v", requests, info)
+	}
+	if start, _, _ := GetQueryTimeRange(requests[0][0]); start != 10000000001 {
+		t.Errorf("residual query:\t%s", requests[0][0])
+	}
+	if values := resps[0].Results[0].Series[0].Values; len(values) != 21 {
+		t.Errorf("merged response:\t%d rows\nexpected:\t%d", len(values), 21)
+	}
+	if values := resps[1].Results[0].Series[0].Values; len(values) != 11 {
+		t.Errorf("shared cache read modified:\t%d rows\nexpected:\t%d", len(values), 11)
+	}
+}
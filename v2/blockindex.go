@@ -0,0 +1,182 @@
+package client
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/influxdata/influxdb1-client/models"
+)
+
+// BlockRows 大于 0 时，行数超过 BlockRows 的表在表头中记录块索引 #{blocks=N,t0,t1,...}：每 N 行为一块，记录每块第一行的时间戳。
+// 每行的字节数相同，第 k 块的偏移量是 k*N*每行字节数，不需要单独记录。
+// 只需要部分时间范围时，SeekItem 根据块索引只保留相关的块，不需要把整张表转换成结果之后再裁剪
+var BlockRows = 0
+
+const blockIndexPrefix = "{blocks="
+
+// blockIndexSegment 返回一张表的块索引在表头中的写法，s 的时间戳是纳秒
+func blockIndexSegment(s models.Row, blockRows int) string {
+	var b strings.Builder
+	b.WriteString(blockIndexPrefix)
+	b.WriteString(strconv.Itoa(blockRows))
+	for k := 0; k < len(s.Values); k += blockRows {
+		ts, _ := timestampOf(s.Values[k][0])
+		b.WriteByte(',')
+		b.WriteString(strconv.FormatInt(ts, 10))
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// headerExtras 返回表头中 #{precision} 之后记录的统计和块索引，没有记录时为空字符串
+func headerExtras(segment string) (stats, blocks string) {
+	parts := strings.Split(segment, "#")
+	if len(parts) <= 5 {
+		return "", ""
+	}
+	for _, p := range parts[5:] {
+		if strings.HasPrefix(p, blockIndexPrefix) {
+			blocks = p
+		} else {
+			stats = p
+		}
+	}
+	return stats, blocks
+}
+
+// parseBlockIndex 从表头的语义段读取块索引：每块的行数和每块第一行的时间戳，没有记录时 ok 为 false
+func parseBlockIndex(segment string) (blockRows int, starts []int64, ok bool, err error) {
+	_, blocks := headerExtras(segment)
+	if blocks == "" {
+		return 0, nil, false, nil
+	}
+	items := strings.Split(strings.TrimSuffix(strings.TrimPrefix(blocks, blockIndexPrefix), "}"), ",")
+	if blockRows, err = strconv.Atoi(items[0]); err != nil || blockRows <= 0 {
+		return 0, nil, false, fmt.Errorf("malformed block index %s", blocks)
+	}
+	starts = make([]int64, 0, len(items)-1)
+	for _, item := range items[1:] {
+		ts, err := strconv.ParseInt(item, 10, 64)
+		if err != nil {
+			return 0, nil, false, fmt.Errorf("malformed block index %s: %w", blocks, err)
+		}
+		starts = append(starts, ts)
+	}
+	return blockRows, starts, true, nil
+}
+
+// withoutBlockIndex 去掉表头中的块索引，表的数据被拆开或者截取之后块索引不再对应
+func withoutBlockIndex(segment string) string {
+	if !strings.Contains(segment, "#"+blockIndexPrefix) {
+		return segment
+	}
+	parts := strings.Split(segment, "#")
+	kept := parts[:0]
+	for i, p := range parts {
+		if i < 5 || !strings.HasPrefix(p, blockIndexPrefix) {
+			kept = append(kept, p)
+		}
+	}
+	return strings.Join(kept, "#")
+}
+
+// SeekItem 根据块索引只保留行式格式的字节数组中可能有 [startTime, endTime] 内数据的块，没有块索引的表保持不变，
+// 没有相关的块的表被去掉，所有表都被去掉时返回 "empty response"。
+// 保留的块可能包含范围外的数据，还原成结果之后仍然需要 TrimResponse；其他格式的字节数组保持不变
+func SeekItem(data []byte, startTime, endTime int64) ([]byte, error) {
+	if len(data) == 0 || data[0] != FormatRowV1 || !bytes.Contains(data, []byte("#"+blockIndexPrefix)) {
+		return data, nil
+	}
+	tables, err := parseItemTables(data)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]byte, 0, len(data))
+	kept := 0
+	for _, t := range tables {
+		blockRows, starts, ok, err := parseBlockIndex(t.segment)
+		if err != nil {
+			return nil, err
+		}
+		if !ok || t.columnar {
+			if t.columnar {
+				result = append(result, FormatColumnar)
+			}
+			result = append(result, t.header...)
+			result = append(result, t.data...)
+			kept++
+			continue
+		}
+
+		/* 第一块是最后一个开始时间不晚于 startTime 的块，最后一块之后的块都从 endTime 之后开始 */
+		first := sort.Search(len(starts), func(k int) bool { return starts[k] > startTime }) - 1
+		if first < 0 {
+			first = 0
+		}
+		last := sort.Search(len(starts), func(k int) bool { return starts[k] > endTime })
+		if first >= last {
+			continue
+		}
+		bytesPerLine := 0
+		for _, w := range t.widths {
+			bytesPerLine += w
+		}
+		from := first * blockRows * bytesPerLine
+		to := last * blockRows * bytesPerLine
+		if to > len(t.data) {
+			to = len(t.data)
+		}
+		if from >= to {
+			continue
+		}
+
+		length, err := Int64ToByteArray(int64(to - from))
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, withoutBlockIndex(t.segment)+" "...)
+		result = append(result, length...)
+		result = append(result, t.data[from:to]...)
+		kept++
+	}
+	if kept == 0 {
+		return StringToByteArray("empty response"), nil
+	}
+	if bytes.HasSuffix(data, []byte("\r\n")) {
+		result = append(result, "\r\n"...)
+	}
+	return result, nil
+}
+
+// decodeRange 把 Get 取回的字节数组转换成结果，时间戳转换成 precision 精度，为空时还原成存入时的精度。
+// 行式和列式的item统一转换成行式，startTime 不小于 0 时用块索引跳过 [startTime, endTime] 之外的块；
+// 其他格式的item由 DecodeItem 按注册的 Codec 还原
+func decodeRange(values []byte, precision string, startTime, endTime int64) (*Response, error) {
+	if len(values) > 0 && values[0] != FormatRowV1 && values[0] != FormatColumnar && !isEmptyItem(values) {
+		resp, meta, err := DecodeItem(values)
+		if err != nil {
+			return nil, err
+		}
+		if precision != "" {
+			resp = responseWithPrecision(resp, responsePrecision(resp, meta.Precision), precision)
+		}
+		return resp, nil
+	}
+	rows, _, err := itemRows(values)
+	if err != nil {
+		return nil, err
+	}
+	if startTime >= 0 {
+		if sought, err := SeekItem(rows, startTime, endTime); err == nil {
+			rows = sought
+		}
+	}
+	if isEmptyItem(rows) {
+		return &Response{Results: []Result{{}}}, nil
+	}
+	return ByteArrayToResponseWithPrecision(rows, precision), nil
+}
@@ -0,0 +1,120 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/InfluxDB-client/memcache"
+	"github.com/influxdata/influxdb1-client/models"
+)
+
+func blockResponse(n int) *Response {
+	values := make([][]interface{}, 0, n)
+	for i := 0; i < n; i++ {
+		values = append(values, []interface{}{json.Number(strconv.Itoa(1000 + i*10)), json.Number(strconv.Itoa(i))})
+	}
+	return &Response{Results: []Result{{Series: []models.Row{
+		{Name: "h2o_feet", Tags: map[string]string{"location": "coyote_creek"}, Columns: []string{"time", "index"}, Values: values},
+		{Name: "h2o_feet", Tags: map[string]string{"location": "santa_monica"}, Columns: []string{"time", "index"}, Values: values[:2]},
+	}}}}
+}
+
+var blockSegments = []string{
+	"{(h2o_feet.location=coyote_creek)}#{index[int64]}#{empty}#{empty,empty}",
+	"{(h2o_feet.location=santa_monica)}#{index[int64]}#{empty}#{empty,empty}",
+}
+
+func TestSeekItem(t *testing.T) {
+	defer func() { BlockRows = 0 }()
+	BlockRows = 3
+
+	/* 10 行的表有块索引，2 行的表没有 */
+	data := append(blockResponse(10).ToByteArrayWithPrecision(blockSegments, "ns"), "\r\n"...)
+	if !bytes.Contains(data, []byte("#{ns}#{blocks=3,1000,1030,1060,1090} ")) {
+		t.Fatalf("block index not found in %q", data)
+	}
+	if bytes.Count(data, []byte("#{blocks=")) != 1 {
+		t.Errorf("only the large table needs a block index: %q", data)
+	}
+
+	/* 块索引不影响还原结果 */
+	full := ByteArrayToResponse(data)
+	if !reflect.DeepEqual(full.Results[0].Series[0].Values, blockResponse(10).Results[0].Series[0].Values) {
+		t.Errorf("response:\n%s", full.ToString())
+	}
+
+	tests := []struct {
+		name       string
+		start, end int64
+		rows       []int // 每张表保留的行数
+	}{
+		{"middle blocks", 1035, 1065, []int{6, 2}},
+		{"inside one block", 1040, 1050, []int{3, 2}},
+		{"last blocks", 1085, 2000, []int{4, 2}}, // 从开始时间不晚于 1085 的最后一块开始
+		{"before all data", 0, 999, []int{2}},    // 第一块的开始时间晚于 endTime
+		{"whole range", 0, 2000, []int{10, 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sought, err := SeekItem(data, tt.start, tt.end)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			resp := ByteArrayToResponse(sought)
+			rows := make([]int, 0)
+			for _, s := range resp.Results[0].Series {
+				rows = append(rows, len(s.Values))
+			}
+			if !reflect.DeepEqual(rows, tt.rows) {
+				t.Errorf("rows:\t%v\nexpected:\t%v", rows, tt.rows)
+			}
+			if bytes.Contains(sought, []byte("#{blocks=")) && tt.rows[0] != 10 {
+				t.Errorf("block index kept after seeking: %q", sought)
+			}
+
+			/* 裁剪之后和从整张表裁剪的结果相同 */
+			trimmed := TrimResponse(resp, tt.start, tt.end)
+			expected := TrimResponse(full, tt.start, tt.end)
+			if !ResponsesEqual(trimmed, expected, CompareOptions{}) {
+				t.Errorf("trimmed:\n%s\nexpected:\n%s", trimmed.ToString(), expected.ToString())
+			}
+		})
+	}
+
+	/* 所有表都没有相关的块 */
+	BlockRows = 1
+	data = blockResponse(4).ToByteArrayWithPrecision(blockSegments, "ns")
+	sought, err := SeekItem(data, 0, 999)
+	if err != nil || !isEmptyItem(sought) {
+		t.Errorf("sought:\t%q %v", sought, err)
+	}
+	if resp, err := decodeRange(data, "ns", 0, 999); err != nil || !ResponseIsEmpty(resp) {
+		t.Errorf("response:\n%s %v", resp.ToString(), err)
+	}
+}
+
+func TestSetSpilledItems_BlockIndex(t *testing.T) {
+	defer func() { BlockRows = 0 }()
+	BlockRows = 2
+	spill := blockResponse(10).ToByteArrayWithPrecision(blockSegments, "ns")
+
+	/* 拆开存放的表去掉块索引，没有拆开的表保留 */
+	items := make([]*memcache.Item, 0)
+	err := setSpilledItems("key", bufio.NewReader(bytes.NewReader(spill)), 200, func(item *memcache.Item) error {
+		items = append(items, item)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, item := range items {
+		if strings.Contains(string(item.Value), "location=coyote_creek)}#{index[int64]}#{empty}#{empty,empty}#{ns}#{blocks=") {
+			t.Errorf("split table kept its block index: %q", item.Value)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/influxdata/influxql"
+)
+
+// ErrCardinalityTooHigh is returned by Set when a query would store more
+// series in the cache than CardinalityLimit.Refuse allows.
+var ErrCardinalityTooHigh = errors.New("group by cardinality too high")
+
+// CardinalityLimits bounds how many series, each stored as a separate cache
+// entry, a query's GROUP BY may produce. Zero disables a limit.
+type CardinalityLimits struct {
+	// Warn logs queries estimated to produce more series than this.
+	Warn int64
+
+	// Refuse makes Set fail with ErrCardinalityTooHigh for queries
+	// estimated to produce more series than this.
+	Refuse int64
+}
+
+// CardinalityLimit is checked by Set before a query is sent to the database.
+var CardinalityLimit CardinalityLimits
+
+// SeriesCardinality returns the number of series in measurement, or in the
+// whole database if measurement is empty.
+func SeriesCardinality(c Client, database, measurement string) (int64, error) {
+	command := "SHOW SERIES CARDINALITY ON " + influxql.QuoteIdent(database)
+	if measurement != "" {
+		command += " FROM " + influxql.QuoteIdent(measurement)
+	}
+	return cardinality(c, command, database)
+}
+
+// TagValuesCardinality returns the number of distinct values of the tag key
+// in measurement.
+func TagValuesCardinality(c Client, database, measurement, key string) (int64, error) {
+	command := fmt.Sprintf("SHOW TAG VALUES CARDINALITY ON %s FROM %s WITH KEY = %s",
+		influxql.QuoteIdent(database), influxql.QuoteIdent(measurement), influxql.QuoteIdent(key))
+	return cardinality(c, command, database)
+}
+
+// cardinality sums the counts of a SHOW ... CARDINALITY response, which has
+// one series per measurement.
+func cardinality(c Client, command, database string) (int64, error) {
+	resp, err := execute(c, command, database)
+	if err != nil {
+		return 0, err
+	}
+	var total int64
+	for _, r := range rows(resp) {
+		n, ok := r.values[0].(json.Number)
+		if !ok {
+			return 0, fmt.Errorf("unexpected cardinality %v", r.values[0])
+		}
+		count, err := n.Int64()
+		if err != nil {
+			return 0, err
+		}
+		total += count
+	}
+	return total, nil
+}
+
+// EstimateGroupByCardinality returns an upper bound of the number of series
+// the query produces: for every measurement it reads, the product of the
+// cardinalities of the GROUP BY tags, capped by the measurement's series
+// cardinality. Tag predicates in WHERE are not taken into account.
+func EstimateGroupByCardinality(c Client, database, queryString string) (int64, error) {
+	stmt, err := influxql.ParseStatement(queryString)
+	if err != nil {
+		return 0, err
+	}
+	s, ok := stmt.(*influxql.SelectStatement)
+	if !ok {
+		return 0, fmt.Errorf("%w: not a SELECT statement: %s", ErrUnsupportedQuery, queryString)
+	}
+
+	tags := make([]string, 0)
+	wildcard := false
+	for _, d := range s.Dimensions {
+		switch expr := d.Expr.(type) {
+		case *influxql.VarRef:
+			tags = append(tags, expr.Val)
+		case *influxql.Wildcard:
+			wildcard = true
+		}
+	}
+
+	var total int64
+	for _, source := range s.Sources {
+		m, ok := source.(*influxql.Measurement)
+		if !ok || m.Name == "" {
+			continue
+		}
+		if len(tags) == 0 && !wildcard {
+			total++
+			continue
+		}
+		series, err := SeriesCardinality(c, database, m.Name)
+		if err != nil {
+			return 0, err
+		}
+		estimate := series
+		if !wildcard {
+			estimate = 1
+			for _, tag := range tags {
+				n, err := TagValuesCardinality(c, database, m.Name, tag)
+				if err != nil {
+					return 0, err
+				}
+				if n > 0 {
+					estimate *= n
+				}
+				if estimate > series {
+					break
+				}
+			}
+			if estimate > series {
+				estimate = series
+			}
+		}
+		total += estimate
+	}
+	return total, nil
+}
+
+// checkCardinality applies CardinalityLimit to the query.
+func checkCardinality(c Client, queryString string) error {
+	limit := CardinalityLimit
+	if limit.Warn <= 0 && limit.Refuse <= 0 {
+		return nil
+	}
+	estimate, err := EstimateGroupByCardinality(c, MyDB, queryString)
+	if err != nil {
+		return nil // the query itself reports the problem
+	}
+	if limit.Refuse > 0 && estimate > limit.Refuse {
+		return fmt.Errorf("%w: %q may produce %d series, limit %d", ErrCardinalityTooHigh, queryString, estimate, limit.Refuse)
+	}
+	if limit.Warn > 0 && estimate > limit.Warn {
+		log.Printf("query %q may produce %d series, more than %d", queryString, estimate, limit.Warn)
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package client
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/InfluxDB-client/memcache"
+)
+
+// newCardinalityServer 返回 h2o_feet 有 2 个 location、4 个 randtag、6 个 series 的元数据
+func newCardinalityServer(queries *int) *httptest.Server {
+	bodies := map[string]string{
+		"SHOW SERIES CARDINALITY ON NOAA_water_database FROM h2o_feet":                         `{"results":[{"statement_id":0,"series":[{"name":"h2o_feet","columns":["count"],"values":[[6]]}]}]}`,
+		"SHOW TAG VALUES CARDINALITY ON NOAA_water_database FROM h2o_feet WITH KEY = location": `{"results":[{"statement_id":0,"series":[{"name":"h2o_feet","columns":["count"],"values":[[2]]}]}]}`,
+		"SHOW TAG VALUES CARDINALITY ON NOAA_water_database FROM h2o_feet WITH KEY = randtag":  `{"results":[{"statement_id":0,"series":[{"name":"h2o_feet","columns":["count"],"values":[[4]]}]}]}`,
+	}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := bodies[r.URL.Query().Get("q")]
+		if !ok {
+			*queries++
+			body = `{"results":[{"statement_id":0}]}`
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(body))
+	}))
+}
+
+func TestEstimateGroupByCardinality(t *testing.T) {
+	var queries int
+	ts := newCardinalityServer(&queries)
+	defer ts.Close()
+	c, _ := NewHTTPClient(HTTPConfig{Addr: ts.URL})
+	defer c.Close()
+
+	tests := []struct {
+		name        string
+		queryString string
+		expected    int64
+	}{
+		{name: "without GROUP BY tag", queryString: "SELECT MEAN(water_level) FROM h2o_feet GROUP BY time(12m)", expected: 1},
+		{name: "one tag", queryString: "SELECT water_level FROM h2o_feet GROUP BY location", expected: 2},
+		{name: "capped by series cardinality", queryString: "SELECT water_level FROM h2o_feet GROUP BY location,randtag", expected: 6},
+		{name: "wildcard", queryString: "SELECT water_level FROM h2o_feet GROUP BY *", expected: 6},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			estimate, err := EstimateGroupByCardinality(c, MyDB, tt.queryString)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if estimate != tt.expected {
+				t.Errorf("estimate:\t%d\nexpected:\t%d", estimate, tt.expected)
+			}
+		})
+	}
+}
+
+func TestSet_CardinalityLimit(t *testing.T) {
+	var queries int
+	ts := newCardinalityServer(&queries)
+	defer ts.Close()
+	c, _ := NewHTTPClient(HTTPConfig{Addr: ts.URL})
+	defer c.Close()
+
+	limit := CardinalityLimit
+	defer func() { CardinalityLimit = limit }()
+	CardinalityLimit = CardinalityLimits{Refuse: 4}
+
+	err := Set("SELECT water_level FROM h2o_feet GROUP BY location,randtag", c, memcache.New("localhost:0"))
+	if !errors.Is(err, ErrCardinalityTooHigh) {
+		t.Errorf("error:\t%v\nexpected:\t%v", err, ErrCardinalityTooHigh)
+	}
+	if queries != 0 {
+		t.Errorf("queries sent to the database:\t%d", queries)
+	}
+}
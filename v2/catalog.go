@@ -0,0 +1,191 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// catalogVersion 是键目录文件格式的版本，格式改变时增加
+const catalogVersion = 1
+
+// CatalogEntry 是键目录中的一个语义段：它涉及的表、在cache中覆盖的时间范围和访问统计
+type CatalogEntry struct {
+	Segment      string     `json:"segment"`
+	Measurements []string   `json:"measurements,omitempty"` // Flux 等无法解析 SM 的语义段为空
+	Intervals    []Interval `json:"intervals"`
+	Hits         uint64     `json:"hits"`
+	LastAccess   time.Time  `json:"last_access"`
+}
+
+// catalogFile 是键目录文件的内容
+type catalogFile struct {
+	Version int            `json:"version"`
+	Saved   time.Time      `json:"saved"`
+	Entries []CatalogEntry `json:"entries"`
+}
+
+// Catalog 返回索引中所有语义段的目录，按语义段排序
+func (ci *CoverageIndex) Catalog() []CatalogEntry {
+	ci.mu.RLock()
+	defer ci.mu.RUnlock()
+	entries := make([]CatalogEntry, 0, len(ci.entries))
+	for segment, e := range ci.entries {
+		entries = append(entries, CatalogEntry{
+			Segment:      segment,
+			Measurements: segmentMeasurements(segment),
+			Intervals:    append([]Interval(nil), e.intervals...),
+			Hits:         e.hits,
+			LastAccess:   e.lastAccess,
+		})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Segment < entries[j].Segment })
+	return entries
+}
+
+// Save 把键目录以 JSON 写入 path：先写临时文件再重命名，进程在写入时退出也不会留下不完整的文件
+func (ci *CoverageIndex) Save(path string) error {
+	body, err := json.MarshalIndent(catalogFile{Version: catalogVersion, Saved: time.Now(), Entries: ci.Catalog()}, "", "  ")
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(body); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return nil
+}
+
+// Load 把 path 中保存的键目录合并到索引中：覆盖范围合并，命中次数和最后访问时间取较大的值。
+// 文件不存在时返回的错误满足 errors.Is(err, fs.ErrNotExist)
+func (ci *CoverageIndex) Load(path string) error {
+	entries, err := ReadCatalog(path)
+	if err != nil {
+		return err
+	}
+	ci.mu.Lock()
+	defer ci.mu.Unlock()
+	for _, entry := range entries {
+		e, ok := ci.entries[entry.Segment]
+		if !ok {
+			e = &coverageEntry{}
+			ci.entries[entry.Segment] = e
+		}
+		e.intervals = mergeIntervals(append(e.intervals, entry.Intervals...))
+		e.hits = max(e.hits, entry.Hits)
+		if entry.LastAccess.After(e.lastAccess) {
+			e.lastAccess = entry.LastAccess
+		}
+	}
+	return nil
+}
+
+// ReadCatalog 读取 Save 保存的键目录，不需要加载到索引中，可以用来离线查看
+func ReadCatalog(path string) ([]CatalogEntry, error) {
+	body, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file catalogFile
+	if err := json.Unmarshal(body, &file); err != nil {
+		return nil, fmt.Errorf("catalog %s: %w", path, err)
+	}
+	if file.Version != catalogVersion {
+		return nil, fmt.Errorf("catalog %s: unsupported version %d", path, file.Version)
+	}
+	return file.Entries, nil
+}
+
+// CatalogPersister 定期把覆盖范围索引保存到磁盘，由 Persist 创建
+type CatalogPersister struct {
+	ci   *CoverageIndex
+	path string
+	done chan struct{}
+	wg   sync.WaitGroup
+
+	mu      sync.Mutex
+	lastErr error // 最近一次定期保存的错误
+}
+
+// Persist 从 path 加载之前保存的键目录（文件不存在时从空目录开始），之后每隔 interval 保存一次，
+// Close 时再保存一次。进程重启后覆盖范围、失效判断和访问统计都可以继续使用
+func (ci *CoverageIndex) Persist(path string, interval time.Duration) (*CatalogPersister, error) {
+	if interval <= 0 {
+		return nil, fmt.Errorf("catalog save interval must be positive, got %v", interval)
+	}
+	if err := ci.Load(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	cp := &CatalogPersister{ci: ci, path: path, done: make(chan struct{})}
+	cp.wg.Add(1)
+	go cp.loop(interval)
+	return cp, nil
+}
+
+func (cp *CatalogPersister) loop(interval time.Duration) {
+	defer cp.wg.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-cp.done:
+			return
+		case <-ticker.C:
+			err := cp.ci.Save(cp.path)
+			cp.mu.Lock()
+			cp.lastErr = err
+			cp.mu.Unlock()
+		}
+	}
+}
+
+// Err 返回最近一次定期保存的错误，保存成功时为 nil
+func (cp *CatalogPersister) Err() error {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	return cp.lastErr
+}
+
+// Close 停止定期保存，并最后保存一次
+func (cp *CatalogPersister) Close() error {
+	close(cp.done)
+	cp.wg.Wait()
+	return cp.ci.Save(cp.path)
+}
+
+// segmentMeasurements 返回语义段 SM 中的表名，按字典序排列
+func segmentMeasurements(segment string) []string {
+	sm, _, _ := strings.Cut(segment, "#")
+	tables, ok := parseWriteThroughSM(sm)
+	if !ok {
+		return nil
+	}
+	names := make([]string, 0, len(tables))
+	for _, t := range tables {
+		if i := sort.SearchStrings(names, t.name); i == len(names) || names[i] != t.name {
+			names = append(names, "")
+			copy(names[i+1:], names[i:])
+			names[i] = t.name
+		}
+	}
+	return names
+}
@@ -0,0 +1,106 @@
+package client
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCoverageIndex_Catalog(t *testing.T) {
+	segment := "{(h2o_feet.location=coyote_creek)(h2o_feet.location=santa_monica)(h2o_pH.empty)}#{water_level[float64]}#{empty}#{empty,empty}"
+	flux := "{telegraf}#{(r._measurement==\"cpu\")}#{empty}#{mean,1m}"
+
+	ci := NewCoverageIndex()
+	ci.Add(segment, Interval{10, 20})
+	ci.Add(segment, Interval{30, 40})
+	ci.Add(flux, Interval{0, 100})
+	ci.Hit(segment)
+	ci.Hit(segment)
+	ci.Hit("{(unknown.empty)}#{v[int64]}#{empty}#{empty,empty}") // 没有覆盖范围记录，不统计
+
+	path := filepath.Join(t.TempDir(), "catalog.json")
+	if err := ci.Save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := ReadCatalog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("entries:\t%d\nexpected:\t%d", len(entries), 2)
+	}
+	/* 按语义段排序，Flux 的语义段在后 */
+	if entries[1].Segment != flux || entries[1].Measurements != nil || entries[1].Hits != 0 {
+		t.Errorf("flux entry:\t%+v", entries[1])
+	}
+	expected := CatalogEntry{
+		Segment:      segment,
+		Measurements: []string{"h2o_feet", "h2o_pH"},
+		Intervals:    []Interval{{10, 20}, {30, 40}},
+		Hits:         2,
+	}
+	got := entries[0]
+	if got.LastAccess.IsZero() {
+		t.Error("last access should be set")
+	}
+	got.LastAccess = time.Time{}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("entry:\t%+v\nexpected:\t%+v", got, expected)
+	}
+
+	/* 重新加载到另一个索引，和已有的覆盖范围合并 */
+	loaded := NewCoverageIndex()
+	loaded.Add(segment, Interval{21, 25})
+	if err := loaded.Load(path); err != nil {
+		t.Fatal(err)
+	}
+	covered, _ := loaded.Covered(segment)
+	if !reflect.DeepEqual(covered, []Interval{{10, 25}, {30, 40}}) {
+		t.Errorf("covered:\t%v\nexpected:\t%v", covered, []Interval{{10, 25}, {30, 40}})
+	}
+	if hits := loaded.Catalog()[0].Hits; hits != 2 {
+		t.Errorf("hits:\t%d\nexpected:\t%d", hits, 2)
+	}
+}
+
+func TestCoverageIndex_Persist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "catalog.json")
+	segment := "{(cpu.empty)}#{usage[float64]}#{empty}#{empty,empty}"
+
+	/* 文件不存在时从空目录开始 */
+	ci := NewCoverageIndex()
+	cp, err := ci.Persist(path, 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ci.Add(segment, Interval{1, 2})
+	time.Sleep(50 * time.Millisecond)
+	if err := cp.Err(); err != nil {
+		t.Errorf("periodic save:\t%v", err)
+	}
+	if entries, err := ReadCatalog(path); err != nil || len(entries) != 1 {
+		t.Errorf("saved entries:\t%v %v\nexpected:\t1 entry", entries, err)
+	}
+	ci.Add(segment, Interval{3, 4})
+	if err := cp.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	/* 重启后加载 */
+	restarted := NewCoverageIndex()
+	cp, err = restarted.Persist(path, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cp.Close()
+	covered, ok := restarted.Covered(segment)
+	if !ok || !reflect.DeepEqual(covered, []Interval{{1, 4}}) {
+		t.Errorf("covered:\t%v\nexpected:\t%v", covered, []Interval{{1, 4}})
+	}
+
+	if _, err := ci.Persist(path, 0); err == nil {
+		t.Error("expected an error for a zero interval")
+	}
+}
@@ -0,0 +1,108 @@
+package client
+
+import (
+	"github.com/influxdata/influxdb1-client/models"
+)
+
+const (
+	// DefaultChunkSize 是没有设置 HTTPConfig.ChunkSize 时分块查询每块的行数，和 InfluxDB 的默认值相同
+	DefaultChunkSize = 10000
+
+	// MinChunkSize 和 MaxChunkSize 是客户端默认的每块行数的范围：块太小时请求和解码的开销占主要部分，块太大时失去了分块的意义
+	MinChunkSize = 100
+	MaxChunkSize = 100000
+)
+
+// chunkSizeOf 返回分块查询每块的行数：查询设置的值原样使用；没有设置时是客户端的默认值，限制在 MinChunkSize 和 MaxChunkSize 之间
+func (c *client) chunkSizeOf(q Query) int {
+	if q.ChunkSize > 0 {
+		return q.ChunkSize
+	}
+	size := c.chunkSize
+	if size <= 0 {
+		size = DefaultChunkSize
+	}
+	return min(max(size, MinChunkSize), MaxChunkSize)
+}
+
+// autoChunk 判断没有要求分块的查询是否因为估计的结果行数超过 autoChunkRows 而分块读取，不能估计时不分块
+func (c *client) autoChunk(command string) bool {
+	if c.autoChunkRows <= 0 {
+		return false
+	}
+	cost, err := EstimateCost(command)
+	return err == nil && cost.Rows > c.autoChunkRows
+}
+
+// appendChunk 把分块查询的一块结果合并到 response 中：同一条语句的结果合并成一个 Result，
+// 一张表被拆到多块中时（Partial 为 true）按 measurement 和 tags 拼接成一张表，不会出现重复的表
+func appendChunk(response *Response, chunk *Response) {
+	for _, r := range chunk.Results {
+		last := len(response.Results) - 1
+		if last < 0 || response.Results[last].StatementId != r.StatementId {
+			r.Series = stitchSeries(nil, r.Series)
+			response.Results = append(response.Results, r)
+			continue
+		}
+		dst := &response.Results[last]
+		dst.Series = stitchSeries(dst.Series, r.Series)
+		dst.Messages = append(dst.Messages, r.Messages...)
+		dst.Partial = r.Partial
+		if r.Err != "" {
+			dst.Err = r.Err
+		}
+	}
+}
+
+// stitchSeries 把 series 中的表依次合并到 dst 中，measurement 和 tags 相同的表的数据拼接在后面，
+// 合并后表的 Partial 是最后一块的值
+func stitchSeries(dst []models.Row, series []models.Row) []models.Row {
+	index := make(map[string]int, len(dst))
+	for i, s := range dst {
+		index[s.Name+TagsMapToString(s.Tags)] = i
+	}
+	for _, s := range series {
+		key := s.Name + TagsMapToString(s.Tags)
+		if i, ok := index[key]; ok {
+			dst[i].Values = append(dst[i].Values, s.Values...)
+			dst[i].Partial = s.Partial
+			continue
+		}
+		index[key] = len(dst)
+		dst = append(dst, s)
+	}
+	return dst
+}
+
+// StitchPartialSeries 返回把每个 Result 中 measurement 和 tags 相同的表拼接成一张表的结果，
+// 用于分块查询得到的结果在存入cache之前去掉重复的表；没有重复的表时返回原来的结果，不修改传入的结果
+func StitchPartialSeries(resp *Response) *Response {
+	if resp == nil || !hasDuplicateSeries(resp) {
+		return resp
+	}
+	result := &Response{Err: resp.Err, Results: make([]Result, len(resp.Results))}
+	for i, r := range resp.Results {
+		series := make([]models.Row, 0, len(r.Series))
+		for _, s := range r.Series {
+			s.Values = append([][]interface{}(nil), s.Values...)
+			series = stitchSeries(series, []models.Row{s})
+		}
+		r.Series = series
+		result.Results[i] = r
+	}
+	return result
+}
+
+func hasDuplicateSeries(resp *Response) bool {
+	for _, r := range resp.Results {
+		seen := make(map[string]bool, len(r.Series))
+		for _, s := range r.Series {
+			key := s.Name + TagsMapToString(s.Tags)
+			if seen[key] {
+				return true
+			}
+			seen[key] = true
+		}
+	}
+	return false
+}
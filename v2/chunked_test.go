@@ -0,0 +1,139 @@
+package client
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/influxdata/influxdb1-client/models"
+)
+
+func TestClient_ChunkedQueryStitchesPartialSeries(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"results":[{"statement_id":0,"series":[{"name":"h2o_feet","tags":{"location":"coyote_creek"},"columns":["time","index"],"values":[[1,85],[2,66]],"partial":true}],"partial":true}]}` + "\n"))
+		w.Write([]byte(`{"results":[{"statement_id":0,"series":[{"name":"h2o_feet","tags":{"location":"coyote_creek"},"columns":["time","index"],"values":[[3,78]]},{"name":"h2o_feet","tags":{"location":"santa_monica"},"columns":["time","index"],"values":[[1,29]]}]}]}` + "\n"))
+		w.Write([]byte(`{"results":[{"statement_id":1,"series":[{"name":"h2o_quality","columns":["time","index"],"values":[[1,41]]}]}]}` + "\n"))
+	}))
+	defer ts.Close()
+
+	c, _ := NewHTTPClient(HTTPConfig{Addr: ts.URL})
+	defer c.Close()
+
+	resp, err := c.Query(Query{Chunked: true})
+	if err != nil {
+		t.Fatalf("unexpected error.  expected %v, actual %v", nil, err)
+	}
+	if len(resp.Results) != 2 {
+		t.Fatalf("results:\t%d\nexpected:\t%d", len(resp.Results), 2)
+	}
+	series := resp.Results[0].Series
+	if len(series) != 2 || len(series[0].Values) != 3 || len(series[1].Values) != 1 {
+		t.Errorf("series:\t%v", series)
+	}
+	if series[0].Partial || resp.Results[0].Partial {
+		t.Errorf("stitched series should not be partial")
+	}
+}
+
+func TestStitchPartialSeries(t *testing.T) {
+	row := func(location string, partial bool, values ...int) models.Row {
+		r := models.Row{Name: "h2o_feet", Tags: map[string]string{"location": location}, Columns: []string{"time", "index"}, Partial: partial}
+		for _, v := range values {
+			r.Values = append(r.Values, []interface{}{json.Number("1"), json.Number(strconv.Itoa(v))})
+		}
+		return r
+	}
+	resp := &Response{Results: []Result{{Series: []models.Row{
+		row("coyote_creek", true, 1, 2),
+		row("santa_monica", false, 3),
+		row("coyote_creek", false, 4),
+	}}}}
+	expected := &Response{Results: []Result{{Series: []models.Row{
+		row("coyote_creek", false, 1, 2, 4),
+		row("santa_monica", false, 3),
+	}}}}
+
+	stitched := StitchPartialSeries(resp)
+	if !reflect.DeepEqual(stitched, expected) {
+		t.Errorf("response:\t%v\nexpected:\t%v", stitched, expected)
+	}
+	if len(resp.Results[0].Series) != 3 || len(resp.Results[0].Series[0].Values) != 2 {
+		t.Errorf("input response was modified")
+	}
+
+	/* 拼接后每张表只有一个语义段 */
+	queryString := "SELECT index FROM h2o_feet WHERE time >= '2019-08-18T00:00:00Z' AND time <= '2019-08-18T00:30:00Z' GROUP BY location"
+	if segments := SeperateSemanticSegment(queryString, StitchPartialSeries(resp)); len(segments) != 2 {
+		t.Errorf("segments:\t%v\nexpected:\t%d", segments, 2)
+	}
+
+	if same := StitchPartialSeries(expected); same != expected {
+		t.Errorf("response without duplicate series should be returned as is")
+	}
+}
+
+func TestClient_ChunkSize(t *testing.T) {
+	var chunked, chunkSize string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		chunked, chunkSize = r.FormValue("chunked"), r.FormValue("chunk_size")
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Influxdb-Version", "1.8")
+		w.Write([]byte(`{"results":[{"statement_id":0,"series":[{"name":"cpu","columns":["time","value"],"values":[[0,1]]}]}]}` + "\n"))
+	}))
+	defer ts.Close()
+
+	c, _ := NewHTTPClient(HTTPConfig{Addr: ts.URL, ChunkSize: 500, AutoChunkRows: 5})
+	defer c.Close()
+	tests := []struct {
+		name      string
+		query     Query
+		chunked   string
+		chunkSize string
+	}{
+		{"client default", Query{Command: "SELECT value FROM cpu", Chunked: true}, "true", "500"},
+		{"query chunk size", Query{Command: "SELECT value FROM cpu", Chunked: true, ChunkSize: 2000}, "true", "2000"},
+		{"small query chunk size", Query{Command: "SELECT value FROM cpu", Chunked: true, ChunkSize: 10}, "true", "10"},
+		/* 估计 11 行，超过 AutoChunkRows */
+		{"auto chunked", Query{Command: "SELECT value FROM cpu WHERE time >= 0 AND time <= 1h"}, "true", "500"},
+		{"small result", Query{Command: "SELECT value FROM cpu WHERE time >= 0 AND time <= 1h LIMIT 2"}, "", ""},
+		{"unbounded", Query{Command: "SELECT value FROM cpu"}, "", ""},
+	}
+	for _, test := range tests {
+		resp, err := c.Query(test.query)
+		if err != nil || len(resp.Results) != 1 {
+			t.Fatalf("%s: unexpected error: %v", test.name, err)
+		}
+		if chunked != test.chunked || chunkSize != test.chunkSize {
+			t.Errorf("%s: chunked:\t%q chunk_size:\t%q\nexpected:\t%q %q", test.name, chunked, chunkSize, test.chunked, test.chunkSize)
+		}
+	}
+
+	/* 没有设置时使用 DefaultChunkSize */
+	d, _ := NewHTTPClient(HTTPConfig{Addr: ts.URL})
+	defer d.Close()
+	cr, err := d.QueryAsChunk(Query{Command: "SELECT value FROM cpu"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cr.Close()
+	if chunkSize != "10000" {
+		t.Errorf("chunk_size:\t%s\nexpected:\t%d", chunkSize, DefaultChunkSize)
+	}
+
+	/* 客户端的默认值限制在 MinChunkSize 和 MaxChunkSize 之间 */
+	for size, expected := range map[int]string{1: "100", 1 << 30: "100000"} {
+		b, _ := NewHTTPClient(HTTPConfig{Addr: ts.URL, ChunkSize: size})
+		if _, err := b.Query(Query{Command: "SELECT value FROM cpu", Chunked: true}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		b.Close()
+		if chunkSize != expected {
+			t.Errorf("client chunk size %d:\t%s\nexpected:\t%s", size, chunkSize, expected)
+		}
+	}
+}
@@ -4,6 +4,7 @@ package client // import "github.com/influxdata/influxdb1-client/v2"
 import (
 	"bytes"
 	"compress/gzip"
+	"context"
 	"crypto/tls"
 	"encoding/binary"
 	"encoding/json"
@@ -15,16 +16,17 @@ import (
 	"log"
 	"math"
 	"mime"
+	"net"
 	"net/http"
 	"net/url"
 	"path"
-	"regexp"
 	"slices"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
-	"unicode"
+	"unicode/utf8"
 
 	"github.com/influxdata/influxdb1-client/models"
 	"github.com/influxdata/influxql"
@@ -32,21 +34,6 @@ import (
 
 type ContentEncoding string
 
-// 连接数据库
-var c, err = NewHTTPClient(HTTPConfig{
-	Addr: "http://10.170.48.244:8086",
-	//Addr: "http://localhost:8086",
-	//Username: username,
-	//Password: password,
-})
-
-// 连接cache
-var mc = memcache.New("localhost:11213")
-
-// 数据库中所有表的tag和field
-var TagKV = GetTagKV(c, MyDB)
-var Fields = GetFieldKeys(c, MyDB)
-
 // 结果转换成字节数组时string类型占用字节数
 const STRINGBYTELENGTH = 25
 
@@ -94,8 +81,9 @@ const (
 
 // HTTPConfig is the config data needed to create an HTTP Client.
 type HTTPConfig struct {
-	// Addr should be of the form "http://host:port"
-	// or "http://[ipv6-host%zone]:port".
+	// Addr should be of the form "http://host:port",
+	// "http://[ipv6-host%zone]:port" or "unix:///path/to/influxdb.sock".
+	// Unix sockets are ignored when Transport is set.
 	Addr string
 
 	// Username is the influxdb username, optional.
@@ -104,6 +92,14 @@ type HTTPConfig struct {
 	// Password is the influxdb password, optional.
 	Password string
 
+	// Token is the InfluxDB 2.x API token, optional. If set, requests are
+	// authenticated with an "Authorization: Token" header instead of
+	// Username and Password.
+	Token string
+
+	// Org is the InfluxDB 2.x organization name or ID, optional.
+	Org string
+
 	// UserAgent is the http User Agent, defaults to "InfluxDBClient".
 	UserAgent string
 
@@ -123,6 +119,74 @@ type HTTPConfig struct {
 
 	// WriteEncoding specifies the encoding of write request
 	WriteEncoding ContentEncoding
+
+	// Addrs lists additional InfluxDB replicas of the form "http://host:port".
+	// Reads are spread across Addr and Addrs according to Balancer, writes
+	// go to the first healthy address. Requests fail over to the next
+	// address when the connection fails.
+	Addrs []string
+
+	// Balancer selects the replica serving each read, defaults to RoundRobin.
+	Balancer BalanceStrategy
+
+	// HealthCheckInterval is how often every replica is pinged to update its
+	// health and latency. Zero disables background health checks; replicas
+	// are then only marked unhealthy by failed requests.
+	HealthCheckInterval time.Duration
+
+	// Transport is the RoundTripper used for all requests, optional. If set,
+	// InsecureSkipVerify, TLSConfig, Proxy and the connection settings below
+	// are ignored.
+	Transport http.RoundTripper
+
+	// MaxIdleConnsPerHost is the number of idle keep-alive connections kept
+	// per server, defaults to http.DefaultMaxIdleConnsPerHost.
+	MaxIdleConnsPerHost int
+
+	// IdleConnTimeout is how long an idle keep-alive connection is kept
+	// before it is closed, defaults to no limit.
+	IdleConnTimeout time.Duration
+
+	// DialContext dials the connections to the servers, optional. Defaults to
+	// a net.Dialer using KeepAlive.
+	DialContext func(ctx context.Context, network, addr string) (net.Conn, error)
+
+	// KeepAlive is the interval between TCP keep-alive probes on the
+	// connections to the servers, defaults to 15 seconds. A negative value
+	// disables keep-alive probes. Ignored if DialContext is set.
+	KeepAlive time.Duration
+
+	// ResponseHeaderTimeout limits how long to wait for the response headers
+	// once a request is written, defaults to no limit. Unlike Timeout it
+	// does not cover reading the body, so long chunked responses still work.
+	ResponseHeaderTimeout time.Duration
+
+	// DisableHTTP2 stops the client from negotiating HTTP/2 with https
+	// servers that support it.
+	DisableHTTP2 bool
+
+	// MaxRetries is how many times a request that reached no server or got a
+	// 502, 503 or 504 response is retried, defaults to no retries.
+	MaxRetries int
+
+	// RetryInterval is the delay before the first retry, doubled for every
+	// following one.
+	RetryInterval time.Duration
+
+	// ChunkSize is the chunk_size of chunked queries that do not set one,
+	// defaults to DefaultChunkSize. It is kept within MinChunkSize and
+	// MaxChunkSize; the chunk size of a Query is sent as is.
+	ChunkSize int
+
+	// AutoChunkRows makes Query read queries whose result EstimateCost puts
+	// above this many rows in chunks, zero disables it. The chunks are
+	// merged, so the Response is the same as without chunking.
+	AutoChunkRows int64
+
+	// ValidateWrites checks the points of every write against FieldTypes
+	// with ValidatePoints and returns its *ValidationError instead of
+	// sending a batch InfluxDB would partially reject.
+	ValidateWrites bool
 }
 
 // BatchPointsConfig is the config data needed to create an instance of the BatchPoints struct.
@@ -137,7 +201,35 @@ type BatchPointsConfig struct {
 	RetentionPolicy string
 
 	// Write consistency is the number of servers required to confirm write.
+	// Empty uses the server default, otherwise it must be one of the
+	// Consistency constants.
 	WriteConsistency string
+
+	// Duplicates decides what Write does with points sharing the
+	// measurement, tag set and timestamp, defaults to DuplicateOverwrite.
+	Duplicates DuplicatePolicy
+}
+
+// Write consistency levels, the number of servers required to confirm a write.
+const (
+	// ConsistencyAny confirms a write once any server, including a hinted handoff, accepts it.
+	ConsistencyAny = "any"
+	// ConsistencyOne confirms a write once one server writes it.
+	ConsistencyOne = "one"
+	// ConsistencyQuorum confirms a write once a majority of servers write it.
+	ConsistencyQuorum = "quorum"
+	// ConsistencyAll confirms a write once all servers write it.
+	ConsistencyAll = "all"
+)
+
+// ValidateConsistency returns an error if wc is not empty and not one of the Consistency constants.
+func ValidateConsistency(wc string) error {
+	switch wc {
+	case "", ConsistencyAny, ConsistencyOne, ConsistencyQuorum, ConsistencyAll:
+		return nil
+	}
+	return fmt.Errorf("invalid write consistency %q: must be one of %q, %q, %q or %q",
+		wc, ConsistencyAny, ConsistencyOne, ConsistencyQuorum, ConsistencyAll)
 }
 
 // Client is a client interface for writing & querying the database.
@@ -161,6 +253,22 @@ type Client interface {
 	Close() error
 }
 
+// FluxQuerier is implemented by the clients that can make Flux queries, the
+// HTTP client and the clients wrapping it.
+type FluxQuerier interface {
+	// QueryFlux makes a Flux query through the InfluxDB 2.x /api/v2/query
+	// endpoint and converts the annotated CSV result into a Response.
+	QueryFlux(ctx context.Context, flux string) (*Response, error)
+}
+
+// Shutdowner is implemented by the clients that can be shut down gracefully.
+type Shutdowner interface {
+	// Shutdown flushes buffered writes, waits for the background work
+	// started for the client and closes it. If ctx is done first Shutdown
+	// returns ctx.Err() and the remaining work goes on in the background.
+	Shutdown(ctx context.Context) error
+}
+
 // NewHTTPClient returns a new Client from the provided config.
 // Client is safe for concurrent use by multiple goroutines.
 func NewHTTPClient(conf HTTPConfig) (Client, error) {
@@ -168,13 +276,32 @@ func NewHTTPClient(conf HTTPConfig) (Client, error) {
 		conf.UserAgent = "InfluxDBClient"
 	}
 
-	u, err := url.Parse(conf.Addr)
-	if err != nil {
-		return nil, err
-	} else if u.Scheme != "http" && u.Scheme != "https" {
-		m := fmt.Sprintf("Unsupported protocol scheme: %s, your address"+
-			" must start with http:// or https://", u.Scheme)
-		return nil, errors.New(m)
+	endpoints := make([]*endpoint, 0, 1+len(conf.Addrs))
+	sockets := make(map[string]string)
+	for i, addr := range append([]string{conf.Addr}, conf.Addrs...) {
+		u, err := url.Parse(addr)
+		if err != nil {
+			return nil, err
+		} else if u.Scheme == "unix" {
+			// Requests are addressed to a placeholder host that the
+			// transport dials as the socket.
+			host := fmt.Sprintf("unix-socket-%d", i)
+			sockets[host+":80"] = u.Path
+			u = &url.URL{Scheme: "http", Host: host}
+		} else if u.Scheme != "http" && u.Scheme != "https" {
+			m := fmt.Sprintf("Unsupported protocol scheme: %s, your address"+
+				" must start with http://, https:// or unix://", u.Scheme)
+			return nil, errors.New(m)
+		}
+		endpoints = append(endpoints, &endpoint{url: *u})
+	}
+
+	switch conf.Balancer {
+	case "":
+		conf.Balancer = RoundRobin
+	case RoundRobin, LeastLatency:
+	default:
+		return nil, fmt.Errorf("unsupported balancer %s", conf.Balancer)
 	}
 
 	switch conf.WriteEncoding {
@@ -183,27 +310,80 @@ func NewHTTPClient(conf HTTPConfig) (Client, error) {
 		return nil, fmt.Errorf("unsupported encoding %s", conf.WriteEncoding)
 	}
 
-	tr := &http.Transport{
-		TLSClientConfig: &tls.Config{
-			InsecureSkipVerify: conf.InsecureSkipVerify,
-		},
-		Proxy: conf.Proxy,
+	if conf.MaxRetries < 0 {
+		return nil, fmt.Errorf("invalid MaxRetries %d", conf.MaxRetries)
 	}
-	if conf.TLSConfig != nil {
-		tr.TLSClientConfig = conf.TLSConfig
+
+	tr := conf.Transport
+	if tr == nil {
+		tr = newTransport(conf, sockets)
 	}
-	return &client{
-		url:       *u,
+	c := &client{
+		url:       endpoints[0].url,
+		endpoints: endpoints,
+		balance:   conf.Balancer,
+		done:      make(chan struct{}),
 		username:  conf.Username,
 		password:  conf.Password,
+		token:     conf.Token,
+		org:       conf.Org,
 		useragent: conf.UserAgent,
 		httpClient: &http.Client{
 			Timeout:   conf.Timeout,
 			Transport: tr,
 		},
-		transport: tr,
-		encoding:  conf.WriteEncoding,
-	}, nil
+		transport:     tr,
+		encoding:      conf.WriteEncoding,
+		maxRetries:    conf.MaxRetries,
+		retryInterval: conf.RetryInterval,
+		validate:      conf.ValidateWrites,
+		chunkSize:     conf.ChunkSize,
+		autoChunkRows: conf.AutoChunkRows,
+	}
+	if conf.HealthCheckInterval > 0 && len(endpoints) > 1 {
+		go c.healthCheck(conf.HealthCheckInterval)
+	}
+	return c, nil
+}
+
+// newTransport builds the http.Transport used when HTTPConfig.Transport is
+// not set. sockets maps the placeholder host:port of every unix:// address
+// to the path of its socket.
+func newTransport(conf HTTPConfig, sockets map[string]string) *http.Transport {
+	tr := &http.Transport{
+		TLSClientConfig: &tls.Config{
+			InsecureSkipVerify: conf.InsecureSkipVerify,
+		},
+		Proxy:                 conf.Proxy,
+		MaxIdleConnsPerHost:   conf.MaxIdleConnsPerHost,
+		IdleConnTimeout:       conf.IdleConnTimeout,
+		DialContext:           conf.DialContext,
+		ResponseHeaderTimeout: conf.ResponseHeaderTimeout,
+		ForceAttemptHTTP2:     !conf.DisableHTTP2,
+	}
+	if tr.DialContext == nil {
+		tr.DialContext = (&net.Dialer{KeepAlive: conf.KeepAlive}).DialContext
+	}
+	if len(sockets) > 0 {
+		// No need for compression in local communications.
+		tr.DisableCompression = true
+
+		dial := tr.DialContext
+		tr.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			if socket, ok := sockets[addr]; ok {
+				return dial(ctx, "unix", socket)
+			}
+			return dial(ctx, network, addr)
+		}
+	}
+	if conf.TLSConfig != nil {
+		tr.TLSClientConfig = conf.TLSConfig
+	}
+	if conf.DisableHTTP2 {
+		// A non-nil, empty TLSNextProto keeps the transport on HTTP/1.1.
+		tr.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+	return tr
 }
 
 // Ping will check to see if the server is up with an optional timeout on waiting for leader.
@@ -220,10 +400,7 @@ func (c *client) Ping(timeout time.Duration) (time.Duration, string, error) {
 	}
 
 	req.Header.Set("User-Agent", c.useragent)
-
-	if c.username != "" {
-		req.SetBasicAuth(c.username, c.password)
-	}
+	c.setAuth(req)
 
 	if timeout > 0 {
 		params := req.URL.Query()
@@ -231,7 +408,7 @@ func (c *client) Ping(timeout time.Duration) (time.Duration, string, error) {
 		req.URL.RawQuery = params.Encode()
 	}
 
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.do(req, true)
 	if err != nil {
 		return 0, "", err
 	}
@@ -252,9 +429,37 @@ func (c *client) Ping(timeout time.Duration) (time.Duration, string, error) {
 	return time.Since(now), version, nil
 }
 
+// setAuth adds the credentials of the client to req. An InfluxDB 2.x token
+// takes precedence over the 1.x username and password.
+func (c *client) setAuth(req *http.Request) {
+	if c.token != "" {
+		req.Header.Set("Authorization", "Token "+c.token)
+	} else if c.username != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+}
+
+// SplitBucket maps an InfluxDB 2.x bucket name onto the database and
+// retention policy used by the 1.x compatibility endpoints. A bucket written
+// as "database/retention_policy" is split in two; an explicit retention
+// policy always wins over the one in the bucket name.
+func SplitBucket(bucket, retentionPolicy string) (string, string) {
+	idx := strings.Index(bucket, "/")
+	if idx < 0 {
+		return bucket, retentionPolicy
+	}
+	if retentionPolicy == "" {
+		retentionPolicy = bucket[idx+1:]
+	}
+	return bucket[:idx], retentionPolicy
+}
+
 // Close releases the client's resources.
 func (c *client) Close() error {
-	c.transport.CloseIdleConnections()
+	c.closeOnce.Do(func() { close(c.done) })
+	if tr, ok := c.transport.(interface{ CloseIdleConnections() }); ok {
+		tr.CloseIdleConnections()
+	}
 	return nil
 }
 
@@ -264,12 +469,25 @@ type client struct {
 	// N.B - if url.UserInfo is accessed in future modifications to the
 	// methods on client, you will need to synchronize access to url.
 	url        url.URL
+	endpoints  []*endpoint
+	balance    BalanceStrategy
+	next       uint64
+	done       chan struct{}
+	closeOnce  sync.Once
 	username   string
 	password   string
+	token      string
+	org        string
 	useragent  string
 	httpClient *http.Client
-	transport  *http.Transport
+	transport  http.RoundTripper
 	encoding   ContentEncoding
+
+	maxRetries    int
+	retryInterval time.Duration
+	validate      bool
+	chunkSize     int
+	autoChunkRows int64
 }
 
 // BatchPoints is an interface into a batched grouping of points to write into
@@ -287,6 +505,9 @@ type BatchPoints interface {
 	Precision() string
 	// SetPrecision sets the precision of this batch.
 	SetPrecision(s string) error
+	// ConvertPrecision truncates the timestamps of the points in this Batch
+	// to the given precision and sets it as the precision of this Batch.
+	ConvertPrecision(to string) error
 
 	// Database returns the currently set database of this Batch.
 	Database() string
@@ -296,12 +517,19 @@ type BatchPoints interface {
 	// WriteConsistency returns the currently set write consistency of this Batch.
 	WriteConsistency() string
 	// SetWriteConsistency sets the write consistency of this Batch.
+	// Write returns an error for a value that is not valid.
 	SetWriteConsistency(s string)
 
 	// RetentionPolicy returns the currently set retention policy of this Batch.
 	RetentionPolicy() string
 	// SetRetentionPolicy sets the retention policy of this Batch.
 	SetRetentionPolicy(s string)
+
+	// DuplicatePolicy returns the currently set duplicate policy of this Batch.
+	DuplicatePolicy() DuplicatePolicy
+	// SetDuplicatePolicy sets the duplicate policy of this Batch.
+	// It returns an error and keeps the current value if d is not valid.
+	SetDuplicatePolicy(d DuplicatePolicy) error
 }
 
 // NewBatchPoints returns a BatchPoints interface based on the given config.
@@ -312,11 +540,18 @@ func NewBatchPoints(conf BatchPointsConfig) (BatchPoints, error) {
 	if _, err := time.ParseDuration("1" + conf.Precision); err != nil {
 		return nil, err
 	}
+	if err := ValidateConsistency(conf.WriteConsistency); err != nil {
+		return nil, err
+	}
+	if err := conf.Duplicates.Validate(); err != nil {
+		return nil, err
+	}
 	bp := &batchpoints{
 		database:         conf.Database,
 		precision:        conf.Precision,
 		retentionPolicy:  conf.RetentionPolicy,
 		writeConsistency: conf.WriteConsistency,
+		duplicates:       conf.Duplicates,
 	}
 	return bp, nil
 }
@@ -327,6 +562,7 @@ type batchpoints struct {
 	precision        string
 	retentionPolicy  string
 	writeConsistency string
+	duplicates       DuplicatePolicy
 }
 
 func (bp *batchpoints) AddPoint(p *Point) {
@@ -365,6 +601,25 @@ func (bp *batchpoints) SetPrecision(p string) error {
 	return nil
 }
 
+// ConvertPrecision truncates the timestamps the way Write does, so the points
+// keep the timestamps they are written with, and comparing them before Write
+// gives the same result as after. The points are modified in place; points
+// without a timestamp keep none.
+func (bp *batchpoints) ConvertPrecision(to string) error {
+	d, err := time.ParseDuration("1" + to)
+	if err != nil {
+		return err
+	}
+	for _, p := range bp.points {
+		if p == nil || p.Time().IsZero() {
+			continue
+		}
+		p.pt.SetTime(time.Unix(0, p.UnixNano()/int64(d)*int64(d)))
+	}
+	bp.precision = to
+	return nil
+}
+
 func (bp *batchpoints) SetDatabase(db string) {
 	bp.database = db
 }
@@ -377,6 +632,18 @@ func (bp *batchpoints) SetRetentionPolicy(rp string) {
 	bp.retentionPolicy = rp
 }
 
+func (bp *batchpoints) DuplicatePolicy() DuplicatePolicy {
+	return bp.duplicates
+}
+
+func (bp *batchpoints) SetDuplicatePolicy(d DuplicatePolicy) error {
+	if err := d.Validate(); err != nil {
+		return err
+	}
+	bp.duplicates = d
+	return nil
+}
+
 // Point represents a single data point.
 type Point struct {
 	pt models.Point
@@ -448,6 +715,19 @@ func NewPointFrom(pt models.Point) *Point {
 }
 
 func (c *client) Write(bp BatchPoints) error {
+	if err := ValidateConsistency(bp.WriteConsistency()); err != nil {
+		return err
+	}
+	points, err := ResolveDuplicates(bp.Points(), bp.Precision(), bp.DuplicatePolicy())
+	if err != nil {
+		return err
+	}
+	if c.validate {
+		if err := ValidatePoints(points, CurrentSchema().FieldTypes); err != nil {
+			return err
+		}
+	}
+
 	var b bytes.Buffer
 
 	var w io.Writer
@@ -457,7 +737,7 @@ func (c *client) Write(bp BatchPoints) error {
 		w = &b
 	}
 
-	for _, p := range bp.Points() { //数据点批量写入
+	for _, p := range points { //数据点批量写入
 		if p == nil {
 			continue
 		}
@@ -490,19 +770,18 @@ func (c *client) Write(bp BatchPoints) error {
 	}
 	req.Header.Set("Content-Type", "")
 	req.Header.Set("User-Agent", c.useragent)
-	if c.username != "" {
-		req.SetBasicAuth(c.username, c.password)
-	}
+	c.setAuth(req)
 
+	db, rp := SplitBucket(bp.Database(), bp.RetentionPolicy())
 	params := req.URL.Query()
-	params.Set("db", bp.Database())
-	params.Set("rp", bp.RetentionPolicy())
+	params.Set("db", db)
+	params.Set("rp", rp)
 	params.Set("precision", bp.Precision())
 	params.Set("consistency", bp.WriteConsistency())
 	req.URL.RawQuery = params.Encode()
 
 	//发送请求，接受响应
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.do(req, false)
 	if err != nil {
 		return err
 	}
@@ -515,8 +794,7 @@ func (c *client) Write(bp BatchPoints) error {
 	}
 
 	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
-		var err = errors.New(string(body))
-		return err
+		return newWriteError(resp.StatusCode, body, points, bp.Precision())
 	}
 
 	return nil
@@ -531,6 +809,11 @@ type Query struct {
 	Chunked         bool // chunked是数据存储和查询的方式，用于大量数据的读写操作，把数据划分成较小的块存储，而不是单条记录	，块内数据点数量固定
 	ChunkSize       int
 	Parameters      map[string]interface{}
+
+	// Timeout limits how long this query may take, including reading every
+	// chunk of a chunked response, independent of HTTPConfig.Timeout. Zero
+	// means no per-query limit.
+	Timeout time.Duration
 }
 
 // Params is a type alias to the query parameters.
@@ -576,22 +859,32 @@ func NewQueryWithParameters(command, database, precision string, parameters map[
 type Response struct {
 	Results []Result
 	Err     string `json:"error,omitempty"`
+
+	statusCode int // HTTP status code of the query, 0 if the response did not come from Query
+
+	columns *columnCache // columns converted by Column, see column.go
 }
 
-// Error returns the first error from any statement.
+// Error returns the first error from any statement as a *QueryError.
 // It returns nil if no errors occurred on any statements.
 func (r *Response) Error() error {
 	if r.Err != "" {
-		return errors.New(r.Err)
+		return &QueryError{Message: r.Err, StatusCode: r.statusCode}
 	}
 	for _, result := range r.Results {
 		if result.Err != "" {
-			return errors.New(result.Err)
+			return &QueryError{Message: result.Err, StatusCode: r.statusCode}
 		}
 	}
 	return nil
 }
 
+// ErrorKind classifies the error returned by Error, QueryErrorNone if there
+// is none.
+func (r *Response) ErrorKind() QueryErrorKind {
+	return QueryErrorKindOf(r.Error())
+}
+
 // Message represents a user message.
 type Message struct {
 	Level string
@@ -604,23 +897,61 @@ type Result struct {
 	Series      []models.Row
 	Messages    []*Message
 	Err         string `json:"error,omitempty"`
+	Partial     bool   `json:"partial,omitempty"` // 分块查询时这条语句还有后续的块
 }
 
-// Query sends a command to the server and returns the Response.
+// Query sends a command to the server and returns the Response. A response
+// whose error is retryable, see QueryError.Retryable, is queried again like
+// a failed request, up to HTTPConfig.MaxRetries times. Only commands whose
+// statements all only read are queried again, see readOnly, since the
+// statements before the failed one have already been executed.
 func (c *client) Query(q Query) (*Response, error) {
+	retry := c.maxRetries > 0 && readOnly(q.Command)
+	for attempt := 0; ; attempt++ {
+		resp, err := c.query(q)
+		if err != nil || !retry || attempt >= c.maxRetries || !retryableResponse(resp) {
+			return resp, err
+		}
+		select {
+		case <-time.After(c.retryInterval << uint(attempt)):
+		case <-c.done:
+			return resp, err
+		}
+	}
+}
+
+// retryableResponse reports whether the error of a response is worth querying
+// again. Responses with status 502, 503 or 504 are not retried again because
+// do already retries them.
+func retryableResponse(resp *Response) bool {
+	var qe *QueryError
+	if !errors.As(resp.Error(), &qe) || !qe.Retryable() {
+		return false
+	}
+	switch resp.statusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return false
+	}
+	return true
+}
+
+func (c *client) query(q Query) (*Response, error) {
 	req, err := c.createDefaultRequest(q)
 	if err != nil {
 		return nil, err
 	}
+	req, cancel := q.withTimeout(req)
+	defer cancel()
 	params := req.URL.Query()
+	if !q.Chunked && c.autoChunk(q.Command) {
+		q.Chunked = true
+	}
 	if q.Chunked { //查询结果是否分块
 		params.Set("chunked", "true")
-		if q.ChunkSize > 0 {
-			params.Set("chunk_size", strconv.Itoa(q.ChunkSize))
-		}
+		params.Set("chunk_size", strconv.Itoa(c.chunkSizeOf(q)))
 		req.URL.RawQuery = params.Encode()
 	}
-	resp, err := c.httpClient.Do(req) // 发送请求
+	resp, err := c.do(req, readOnly(q.Command)) // 发送请求，写入和修改 schema 的语句先发给主节点
 	if err != nil {
 		return nil, err
 	}
@@ -650,7 +981,7 @@ func (c *client) Query(q Query) (*Response, error) {
 				break
 			}
 
-			response.Results = append(response.Results, r.Results...) // 把所有结果添加到 response.Results 数组中
+			appendChunk(&response, r) // 同一条语句的块合并成一个结果，拆开的表拼接起来
 			if r.Err != "" {
 				response.Err = r.Err
 				break
@@ -667,14 +998,16 @@ func (c *client) Query(q Query) (*Response, error) {
 		}
 		// If we got a valid decode error, send that back
 		if decErr != nil {
-			return nil, fmt.Errorf("unable to decode json: received status code %d err: %s", resp.StatusCode, decErr)
+			return nil, fmt.Errorf("unable to decode json: received status code %d err: %w", resp.StatusCode, decErr)
 		}
 	}
+	response.statusCode = resp.StatusCode
 
 	// If we don't have an error in our json response, and didn't get statusOK
 	// then send back an error
+	response = *SortSeries(&response) // 表的顺序不依赖数据库
 	if resp.StatusCode != http.StatusOK && response.Error() == nil {
-		return &response, fmt.Errorf("received status code %d from server", resp.StatusCode)
+		return &response, &QueryError{Message: fmt.Sprintf("received status code %d from server", resp.StatusCode), StatusCode: resp.StatusCode}
 	}
 	return &response, nil
 }
@@ -687,19 +1020,42 @@ func (c *client) QueryAsChunk(q Query) (*ChunkedResponse, error) {
 	}
 	params := req.URL.Query()
 	params.Set("chunked", "true")
-	if q.ChunkSize > 0 {
-		params.Set("chunk_size", strconv.Itoa(q.ChunkSize))
-	}
+	params.Set("chunk_size", strconv.Itoa(c.chunkSizeOf(q)))
 	req.URL.RawQuery = params.Encode()
-	resp, err := c.httpClient.Do(req)
+	req, cancel := q.withTimeout(req)
+	resp, err := c.do(req, readOnly(q.Command))
 	if err != nil {
+		cancel()
 		return nil, err
 	}
 
 	if err := checkResponse(resp); err != nil {
+		cancel()
 		return nil, err
 	}
-	return NewChunkedResponse(resp.Body), nil // 把HTTP响应的 reader 传入，进行解码
+	return NewChunkedResponse(&cancelCloser{ReadCloser: resp.Body, cancel: cancel}), nil // 把HTTP响应的 reader 传入，进行解码
+}
+
+// withTimeout bounds req by the query's Timeout. cancel must be called once
+// the response body is no longer needed.
+func (q Query) withTimeout(req *http.Request) (*http.Request, context.CancelFunc) {
+	if q.Timeout <= 0 {
+		return req, func() {}
+	}
+	ctx, cancel := context.WithTimeout(req.Context(), q.Timeout)
+	return req.WithContext(ctx), cancel
+}
+
+// cancelCloser releases the context of a streamed response when it is closed.
+type cancelCloser struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelCloser) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
 }
 
 // 检验响应合法性
@@ -748,16 +1104,14 @@ func (c *client) createDefaultRequest(q Query) (*http.Request, error) {
 
 	req.Header.Set("Content-Type", "")
 	req.Header.Set("User-Agent", c.useragent)
+	c.setAuth(req)
 
-	if c.username != "" {
-		req.SetBasicAuth(c.username, c.password)
-	}
-
+	db, rp := SplitBucket(q.Database, q.RetentionPolicy)
 	params := req.URL.Query()
 	params.Set("q", q.Command)
-	params.Set("db", q.Database)
-	if q.RetentionPolicy != "" {
-		params.Set("rp", q.RetentionPolicy)
+	params.Set("db", db)
+	if rp != "" {
+		params.Set("rp", rp)
 	}
 	params.Set("params", string(jsonParameters))
 
@@ -822,7 +1176,11 @@ func (r *ChunkedResponse) NextResponse() (*Response, error) {
 		// and sent a last-ditch error message to us. Ensure we have read the
 		// entirety of the connection to get any remaining error text.
 		io.Copy(ioutil.Discard, r.duplex)
-		return nil, errors.New(strings.TrimSpace(r.buf.String()))
+		if msg := strings.TrimSpace(r.buf.String()); msg != "" {
+			return nil, errors.New(msg)
+		}
+		// Nothing was read, e.g. the query timed out between chunks.
+		return nil, err
 	}
 
 	r.buf.Reset()
@@ -834,20 +1192,128 @@ func (r *ChunkedResponse) Close() error {
 	return r.duplex.Close()
 }
 
+// ForEach calls fn with every response in the stream until the stream ends,
+// and closes the response when it returns. A decoding error, or the first
+// error returned by fn, stops the iteration and is returned.
+func (r *ChunkedResponse) ForEach(fn func(*Response) error) error {
+	defer r.Close()
+	for {
+		resp, err := r.NextResponse()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(resp); err != nil {
+			return err
+		}
+	}
+}
+
 func Set(queryString string, c Client, mc *memcache.Client) error {
-	query := NewQuery(queryString, MyDB, "ns")
-	resp, err := c.Query(query)
-	if err != nil {
-		return err
+	return SetWithPrecision(queryString, "ns", c, mc)
+}
+
+// SetWithPrecision 用 precision 精度（和 NewQuery 的参数相同，为空时时间戳是 RFC3339 字符串）查询并把结果存入cache
+// cache中的时间戳统一为纳秒，每张表的语义段记录查询时的精度，读取时可以还原
+// 结果超过 MaxResponseBytes 时分块读取，不在内存中合并成完整的结果，见 SetStream
+func SetWithPrecision(queryString, precision string, c Client, mc *memcache.Client) error {
+	return SetStream(queryString, precision, c, mc, nil)
+}
+
+// ItemSizeLimit 限制存入cache的单个item的大小，避免超过cache的item上限，或者一个大结果挤掉很多小的热点item
+type ItemSizeLimit struct {
+	MaxBytes int  // item 的最大字节数，为 0 时不限制
+	Split    bool // 为 true 时超过上限的结果按时间划分成多个item存入，否则不存入
+}
+
+// ItemLimit 是 Set 存入cache之前检查的大小上限，默认不限制；使用 fatcache 时可以设置成它的 1MB item 上限
+var ItemLimit = ItemSizeLimit{}
+
+// ErrItemTooLarge 表示结果超过 ItemLimit，没有存入cache
+var ErrItemTooLarge = errors.New("cache item too large")
+
+// EstimateItemSize 估计结果转换成字节数组后的大小：每张表的语义段和长度，加上 行数 * 每行字节数
+func EstimateItemSize(queryString string, resp *Response) int {
+	if ResponseIsEmpty(resp) {
+		return len("empty response")
+	}
+	return itemHeaderSize(queryString, resp) + itemDataSize(resp)
+}
+
+// itemHeaderSize 是所有表的 语义段 + #{precision} + 空格 + 8字节长度 的总字节数
+func itemHeaderSize(queryString string, resp *Response) int {
+	size := 0
+	for _, segment := range SeperateSemanticSegment(queryString, resp) {
+		size += len(segment) + len("#{"+PrecisionRFC3339+"}") + 1 + 8
 	}
+	return size
+}
+
+func itemDataSize(resp *Response) int {
+	return resp.Stats().Bytes
+}
 
+// setResponse 把查询语句对应的结果存入cache，key 为结果的语义段，precision 是结果中时间戳的精度
+// 结果超过 ItemLimit 时按设置划分成多个item存入，或者不存入并返回 ErrItemTooLarge；NullError 时有空值的结果返回 ErrNullValue
+func setResponse(queryString, precision string, resp *Response, mc *memcache.Client) error {
+	if err := checkNulls(resp); err != nil {
+		return err
+	}
+	resp = SortSeries(StitchPartialSeries(resp))
+	/* OR 连接的多个时间范围分别存入，中间没有查询的时间不算作已经覆盖 */
+	if queries, ranges := splitTimeRanges(queryString); len(queries) > 0 {
+		return setTimeRanges(queries, ranges, precision, resp, mc)
+	}
 	semanticSegment := SemanticSegment(queryString, resp)
-	startTime, endTime := GetResponseTimeRange(resp)
-	respCacheByte := resp.ToByteArray(queryString)
+
+	parts := []*Response{resp}
+	if limit := ItemLimit.MaxBytes; limit > 0 && !ResponseIsEmpty(resp) {
+		if size := EstimateItemSize(queryString, resp); size > limit {
+			maxData := limit - itemHeaderSize(queryString, resp)
+			if !ItemLimit.Split || maxData < BytesPerLine(DataTypeArrayFromResponse(resp)) {
+				return fmt.Errorf("%w: %s is %d bytes, limit %d", ErrItemTooLarge, semanticSegment, size, limit)
+			}
+			parts, _ = SplitResponseValuesByTime(resp, SplitOptions{MaxBytes: maxData})
+		}
+	}
+
+	for _, part := range parts {
+		if err := setItem(semanticSegment, queryString, precision, part, mc); err != nil {
+			return err
+		}
+	}
+
+	/* 记录这个语义段在cache中覆盖的时间范围 */
+	if !ResponseIsEmpty(resp) {
+		nsResp := responseWithPrecision(resp, responsePrecision(resp, precision), "ns")
+		Coverage.Add(semanticSegment, queryCoverage(queryString, nsResp))
+	}
+
+	return nil
+}
+
+// setItem 把结果作为一个item存入cache，item 的起止时间是结果中数据的时间范围
+func setItem(semanticSegment, queryString, precision string, resp *Response, mc *memcache.Client) error {
+	key := cacheKey(semanticSegment)
+	if MaxKeyLength > 0 && len(key) > MaxKeyLength {
+		return fmt.Errorf("%w: %d bytes, limit %d", ErrKeyTooLong, len(key), MaxKeyLength)
+	}
+	start := time.Now()
+	respCacheByte, err := encodeItem(queryString, precision, resp)
+	if err != nil {
+		return err
+	}
+	observeLatency(StageSerialize, start)
 	tableNumbers := int64(len(resp.Results[0].Series))
 
+	/* 起止时间统一为纳秒 */
+	nsResp := responseWithPrecision(resp, responsePrecision(resp, precision), "ns")
+	startTime, endTime := GetResponseTimeRange(nsResp)
+
 	item := memcache.Item{
-		Key:         semanticSegment,
+		Key:         key,
 		Value:       respCacheByte,
 		Flags:       0,
 		Expiration:  0,
@@ -857,13 +1323,7 @@ func Set(queryString string, c Client, mc *memcache.Client) error {
 		NumOfTables: tableNumbers,
 	}
 
-	err = mc.Set(&item)
-
-	if err != nil {
-		return err
-	}
-
-	return nil
+	return mc.Set(&item)
 }
 
 /*
@@ -889,6 +1349,7 @@ func Merge(precision string, resps ...*Response) []*Response {
 	if len(resps) <= 1 {
 		return resps
 	}
+	defer observeLatency(StageMerge, time.Now())
 
 	/* 设置允许合并的时间误差范围 */
 	timePrecision := time.Hour
@@ -1037,7 +1498,7 @@ func GetSeriesTagsMap(resp *Response) map[int]map[string]string {
 
 	/* 没用 GROUP BY 的话只会有一张表 */
 	if !ResponseIsEmpty(resp) {
-		/* 在结果中，多个表（[]Series）本身就是按照字典序排列的，直接读取就能保持顺序 */
+		/* 数据库和cache读取的结果都经过 SortSeries，多个表（[]Series）按照 measurement 和 tags 的字典序排列，直接读取就能保持顺序 */
 		for i, ser := range resp.Results[0].Series {
 			tagsMap[i] = ser.Tags
 		}
@@ -1046,6 +1507,41 @@ func GetSeriesTagsMap(resp *Response) map[int]map[string]string {
 	return tagsMap
 }
 
+// SortSeries 返回每个 Result 中的表按 measurement 和 TagsMapToString 的字典序排列的结果。
+// 合并结果（MergeSeries）和生成语义段（GetSM）依赖这个顺序，从数据库读取和存入、读取cache时都要排序，不依赖数据库返回的顺序；
+// 已经有序时返回原来的结果，否则返回排序后的副本，不修改传入的结果
+func SortSeries(resp *Response) *Response {
+	if resp == nil || seriesSorted(resp) {
+		return resp
+	}
+	result := &Response{Err: resp.Err, Results: make([]Result, len(resp.Results)), statusCode: resp.statusCode}
+	for i, r := range resp.Results {
+		r.Series = append([]models.Row(nil), r.Series...)
+		sort.SliceStable(r.Series, func(a, b int) bool { return seriesLess(r.Series[a], r.Series[b]) })
+		result.Results[i] = r
+	}
+	return result
+}
+
+func seriesSorted(resp *Response) bool {
+	for _, r := range resp.Results {
+		for i := 1; i < len(r.Series); i++ {
+			if seriesLess(r.Series[i], r.Series[i-1]) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// seriesLess 比较两张表的 measurement，相同时比较 tags 组成的字符串
+func seriesLess(a, b models.Row) bool {
+	if a.Name != b.Name {
+		return a.Name < b.Name
+	}
+	return TagsMapToString(a.Tags) < TagsMapToString(b.Tags)
+}
+
 /* 按字典序把一张表中的所有tags组合成字符串 */
 func TagsMapToString(tagsMap map[string]string) string {
 	var str string
@@ -1268,26 +1764,11 @@ func MergeResultTable(resp1, resp2 *Response) *Response {
 func GetResponseTimeRange(resp *Response) (int64, int64) {
 	var minStartTime int64
 	var maxEndTime int64
-	var ist int64
-	var iet int64
 
 	minStartTime = math.MaxInt64
 	maxEndTime = 0
-	for s := range resp.Results[0].Series {
-		/* 获取一张表的起止时间（string） */
-		length := len(resp.Results[0].Series[s].Values)      //一个结果表中有多少条记录
-		start := resp.Results[0].Series[s].Values[0][0]      // 第一条记录的时间		第一个查询结果
-		end := resp.Results[0].Series[s].Values[length-1][0] // 最后一条记录的时间
-
-		if st, ok := start.(string); ok {
-			et := end.(string)
-			ist = TimeStringToInt64(st)
-			iet = TimeStringToInt64(et)
-		} else if st, ok := start.(json.Number); ok {
-			et := end.(json.Number)
-			ist, _ = st.Int64()
-			iet, _ = et.Int64()
-		}
+	for _, s := range resp.Results[0].Series {
+		ist, iet := seriesTimeRange(s)
 
 		/* 更新起止时间范围 	两个时间可能不在一个表中 ? */
 		if minStartTime > ist {
@@ -1301,42 +1782,65 @@ func GetResponseTimeRange(resp *Response) (int64, int64) {
 	return minStartTime, maxEndTime
 }
 
-// 获取一个数据库中所有表的field name，每张表存为一个map，其中的fields存为一个string数组
-func GetFieldKeys(c Client, database string) map[string][]string {
-	// 构建查询语句
-	//query := fmt.Sprintf("SHOW FIELD KEYS on %s from %s", database, measurement)
-	query := fmt.Sprintf("SHOW FIELD KEYS on %s", database)
+// seriesTimeRange 返回一张表第一条和最后一条记录的时间，RFC3339 字符串转换成纳秒，json.Number 保持查询时的精度
+func seriesTimeRange(s models.Row) (int64, int64) {
+	var ist int64
+	var iet int64
 
-	// 执行查询
-	q := NewQuery(query, database, "")
-	resp, err := c.Query(q)
-	if err != nil {
-		fmt.Printf("Error: %s\n", err.Error())
-		return nil
+	/* 获取一张表的起止时间（string） */
+	length := len(s.Values)      //一个结果表中有多少条记录
+	start := s.Values[0][0]      // 第一条记录的时间		第一个查询结果
+	end := s.Values[length-1][0] // 最后一条记录的时间
+
+	if st, ok := start.(string); ok {
+		et := end.(string)
+		ist = TimeStringToInt64(st)
+		iet = TimeStringToInt64(et)
+	} else if st, ok := start.(json.Number); ok {
+		et := end.(json.Number)
+		ist, _ = st.Int64()
+		iet, _ = et.Int64()
 	}
+	return ist, iet
+}
 
-	// 处理查询结果
-	if resp.Error() != nil {
-		fmt.Printf("Error: %s\n", resp.Error().Error())
-		return nil
+// TrimResponse 只保留结果中时间在 [startTime, endTime] 内的数据，去掉裁剪后没有数据的表
+// cache 命中的结果可能覆盖比查询更大的时间范围，从cache读取的结果都要裁剪成查询的时间范围再返回
+func TrimResponse(resp *Response, startTime, endTime int64) *Response {
+	if ResponseIsEmpty(resp) {
+		return resp
 	}
 
-	fieldMap := make(map[string][]string)
-	for _, series := range resp.Results[0].Series {
-		fieldNames := make([]string, 0)
-		measurementName := series.Name
-		for _, value := range series.Values {
-			fieldName, ok := value[0].(string)
-			if !ok {
-				log.Fatal("field name fail to convert to string")
-			}
-			fieldNames = append(fieldNames, fieldName)
+	result := Result{StatementId: resp.Results[0].StatementId, Messages: resp.Results[0].Messages, Err: resp.Results[0].Err}
+	for _, s := range resp.Results[0].Series {
+		/* 数据按时间升序排列，找到第一条和最后一条在范围内的数据 */
+		first := sort.Search(len(s.Values), func(i int) bool {
+			ts, _ := timestampOf(s.Values[i][0])
+			return ts >= startTime
+		})
+		last := sort.Search(len(s.Values), func(i int) bool {
+			ts, _ := timestampOf(s.Values[i][0])
+			return ts > endTime
+		})
+		if first >= last {
+			continue
 		}
+		s.Values = s.Values[first:last]
+		result.Series = append(result.Series, s)
+	}
+
+	return &Response{Results: []Result{result}, Err: resp.Err}
+}
 
-		fieldMap[measurementName] = fieldNames
+// 获取一个数据库中所有表的field name，每张表存为一个map，其中的fields存为一个string数组
+func GetFieldKeys(c Client, database string) map[string][]string {
+	fieldKeys, err := ShowFieldKeys(c, database)
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return nil
 	}
 
-	return fieldMap
+	return fieldNames(fieldKeys)
 }
 
 type TagValues struct {
@@ -1353,58 +1857,9 @@ type MeasurementTagMap struct {
 
 // 获取所有表的tag的key和value
 func GetTagKV(c Client, database string) MeasurementTagMap {
-	// 构建查询语句
-	//query := fmt.Sprintf("SHOW FIELD KEYS on %s from %s", database, measurement)
-	queryK := fmt.Sprintf("SHOW tag KEYS on %s", database)
-
-	// 执行查询
-	q := NewQuery(queryK, database, "")
-	resp, err := c.Query(q)
+	measurementTagMap, err := loadTagKV(c, database)
 	if err != nil {
-		log.Fatal(err.Error())
-	}
-
-	// 处理查询结果
-	if resp.Error() != nil {
-		log.Fatal(resp.Error().Error())
-	}
-
-	tagMap := make(map[string][]string)
-	//fmt.Println(resp)
-	for _, series := range resp.Results[0].Series {
-		measurementName := series.Name
-		for _, value := range series.Values {
-			tagKey, ok := value[0].(string)
-			if !ok {
-				log.Fatal("tag name fail to convert to string")
-			}
-			tagMap[measurementName] = append(tagMap[measurementName], tagKey)
-		}
-	}
-
-	var measurementTagMap MeasurementTagMap
-	measurementTagMap.Measurement = make(map[string][]TagKeyMap)
-	for k, v := range tagMap {
-		for _, tagKey := range v {
-			queryV := fmt.Sprintf("SHOW tag VALUES on %s from %s with key=\"%s\"", database, k, tagKey)
-			q := NewQuery(queryV, database, "")
-			resp, err := c.Query(q)
-			if err != nil {
-				log.Fatal(err.Error())
-			}
-			if resp.Error() != nil {
-				log.Fatal(resp.Error().Error())
-			}
-
-			var tagValues TagValues
-			for _, value := range resp.Results[0].Series[0].Values {
-				tagValues.Values = append(tagValues.Values, value[1].(string))
-			}
-			tmpKeyMap := make(map[string]TagValues, 0)
-			tmpKeyMap[tagKey] = tagValues
-			tagKeyMap := TagKeyMap{tmpKeyMap}
-			measurementTagMap.Measurement[k] = append(measurementTagMap.Measurement[k], tagKeyMap)
-		}
+		fmt.Printf("Error: %s\n", err.Error())
 	}
 
 	return measurementTagMap
@@ -1417,10 +1872,8 @@ func SemanticSegment(queryString string, response *Response) string {
 	if ResponseIsEmpty(response) {
 		return "{empty response}"
 	}
-	SP, tagPredicates := GetSP(queryString, response, TagKV)
+	SF, SP, Aggr, tagPredicates, Interval := segmentParts(queryString, response)
 	SM := GetSM(response, tagPredicates)
-	Interval := GetInterval(queryString)
-	SF, Aggr := GetSFSGWithDataType(queryString, response)
 
 	var result string
 	//result = fmt.Sprintf("%s#{%s}#%s#{%s,%s}", SM, SF, SPST, Aggr, Interval)
@@ -1431,12 +1884,9 @@ func SemanticSegment(queryString string, response *Response) string {
 
 func SeperateSemanticSegment(queryString string, response *Response) []string {
 
-	SF, SG := GetSFSGWithDataType(queryString, response)
-	SP, tagPredicates := GetSP(queryString, response, TagKV)
+	SF, SP, SG, tagPredicates, Interval := segmentParts(queryString, response)
 	SepSM := GetSeperateSM(response, tagPredicates)
 
-	Interval := GetInterval(queryString)
-
 	var resultArr []string
 	for i := range SepSM {
 		//str := fmt.Sprintf("%s#{%s}#%s#{%s,%s}", SepSM[i], SF, SPST, SG, Interval)
@@ -1465,7 +1915,7 @@ func GetTagNameArr(resp *Response) []string {
 	return tagArr
 }
 
-// GetSM get measurement's name and tags
+// GetSM get measurement's name and tags, in the order of the series, see SortSeries
 // func GetSM(queryString string, resp *Response) string {
 func GetSM(resp *Response, tagPredicates []string) string {
 	var result string
@@ -1483,7 +1933,7 @@ func GetSM(resp *Response, tagPredicates []string) string {
 		if idx = strings.Index(tagPredicates[i], "!"); idx < 0 { // "!="
 			idx = strings.Index(tagPredicates[i], "=")
 		}
-		tagName := tagPredicates[i][:idx]
+		tagName := unescapeSegment(tagPredicates[i][:idx])
 		if !slices.Contains(tagArr, tagName) {
 			tagPre = append(tagPre, tagPredicates[i])
 		}
@@ -1504,10 +1954,10 @@ func GetSM(resp *Response, tagPredicates []string) string {
 			//}
 			//result = result[:len(result)-1]
 			//result += ")"
-			measurement := s.Name
+			measurement := escapeMeasurement(s.Name)
 			tmpTags = nil
 			for _, tagName := range tagArr {
-				tmpTag := fmt.Sprintf("%s=%s", tagName, s.Tags[tagName])
+				tmpTag := fmt.Sprintf("%s=%s", escapeSM(tagName), escapeSM(s.Tags[tagName]))
 				tmpTags = append(tmpTags, tmpTag)
 			}
 			tmpTags = append(tmpTags, tagPre...)
@@ -1520,14 +1970,14 @@ func GetSM(resp *Response, tagPredicates []string) string {
 		}
 
 	} else if len(tagPre) > 0 {
-		measurement := resp.Results[0].Series[0].Name
+		measurement := escapeMeasurement(resp.Results[0].Series[0].Name)
 		for i, tag := range tagPre {
 			tagPre[i] = fmt.Sprintf("%s.%s", measurement, tag)
 		}
 		tmpResult := strings.Join(tagPre, ",")
 		result += fmt.Sprintf("(%s)", tmpResult)
 	} else {
-		measurementName := resp.Results[0].Series[0].Name
+		measurementName := escapeMeasurement(resp.Results[0].Series[0].Name)
 		result = fmt.Sprintf("{(%s.empty)}", measurementName)
 		return result
 	}
@@ -1547,7 +1997,7 @@ func GetSeperateSM(resp *Response, tagPredicates []string) []string {
 		return []string{"{empty}"}
 	}
 
-	measurement := resp.Results[0].Series[0].Name
+	measurement := escapeMeasurement(resp.Results[0].Series[0].Name)
 	tagArr = GetTagNameArr(resp)
 
 	tagPre := make([]string, 0)
@@ -1556,7 +2006,7 @@ func GetSeperateSM(resp *Response, tagPredicates []string) []string {
 		if idx = strings.Index(tagPredicates[i], "!"); idx < 0 { // "!="
 			idx = strings.Index(tagPredicates[i], "=")
 		}
-		tagName := tagPredicates[i][:idx]
+		tagName := unescapeSegment(tagPredicates[i][:idx])
 		if !slices.Contains(tagArr, tagName) {
 			tagPre = append(tagPre, tagPredicates[i])
 		}
@@ -1568,7 +2018,7 @@ func GetSeperateSM(resp *Response, tagPredicates []string) []string {
 			var tmp string
 			tmpTags = nil
 			for _, tagKey := range tagArr {
-				tag := fmt.Sprintf("%s=%s", tagKey, s.Tags[tagKey])
+				tag := fmt.Sprintf("%s=%s", escapeSM(tagKey), escapeSM(s.Tags[tagKey]))
 				tmpTags = append(tmpTags, tag)
 			}
 			tmpTags = append(tmpTags, tagPre...)
@@ -1599,95 +2049,339 @@ func GetSeperateSM(resp *Response, tagPredicates []string) []string {
 	return result
 }
 
-// GetAggregation  从查询语句中获取聚合函数
-func GetAggregation(queryString string) string {
-	/* 用正则匹配取出包含 列名 和 聚合函数 的字符串  */
-	regStr := `(?i)SELECT\s*(.+)\s*FROM.+`
-	regExpr := regexp.MustCompile(regStr)
-	var FGstr string
-	if ok, _ := regexp.MatchString(regStr, queryString); ok {
-		match := regExpr.FindStringSubmatch(queryString)
-		FGstr = match[1] // fields and aggr
-	} else {
-		return "error"
-	}
+// Aggregation 描述查询中的一个聚合函数
+type Aggregation struct {
+	Func     string   // 小写的函数名，嵌套的函数如 count(distinct)；没有聚合函数时为空，无法解析的查询为 error
+	Args     []string // 列名之后的参数，如 PERCENTILE(water_level, 90) 的 90，TOP(water_level, location, 3) 的 location 和 3
+	FillMode string   // fill() 的方式：null、none、previous、linear 或者填充的数值
+}
 
-	/* 从字符串中截取出聚合函数 */
-	var aggr string
-	if strings.IndexAny(FGstr, ")") > 0 {
-		index := strings.IndexAny(FGstr, "(")
-		aggr = FGstr[:index]
-		aggr = strings.ToLower(aggr)
-	} else {
+// String 返回聚合函数在语义段 SG 中的写法：函数名后面依次用 ':' 连接参数，如 percentile:90；没有聚合函数时为 empty
+func (a Aggregation) String() string {
+	if a.Func == "" {
 		return "empty"
 	}
+	var b strings.Builder
+	b.WriteString(a.Func)
+	for _, arg := range a.Args {
+		b.WriteByte(':')
+		b.WriteString(escapeSG(arg))
+	}
+	return b.String()
+}
+
+// Column 返回聚合函数在结果中的列名，嵌套的函数用最外层的函数名，如 count(distinct) 的列名是 count
+func (a Aggregation) Column() string {
+	if idx := strings.Index(a.Func, "("); idx > 0 {
+		return a.Func[:idx]
+	}
+	return a.Func
+}
+
+// ParseAggregation 从 SG 中一个聚合函数的写法还原 Aggregation，是 String 的逆过程，FillMode 为空
+func ParseAggregation(sg string) Aggregation {
+	if sg == "empty" {
+		return Aggregation{}
+	}
+	parts := strings.Split(sg, ":")
+	a := Aggregation{Func: parts[0]}
+	for _, arg := range parts[1:] {
+		a.Args = append(a.Args, unescapeSegment(arg))
+	}
+	return a
+}
+
+// GetAggregation  从查询语句中获取第一列的聚合函数，包括函数的参数和查询的 fill() 方式
+func GetAggregation(queryString string) Aggregation {
+	s, ok := selectStatement(queryString)
+	if !ok || len(s.Fields) == 0 {
+		return Aggregation{Func: "error"}
+	}
+
+	/* 第一列的聚合函数，嵌套的函数和 DISTINCT x 见 fieldAggregation */
+	a, _, _ := selectAggregation(s.Fields[0].Expr)
+	a.FillMode = fillMode(s)
+	return a
+}
+
+// fillMode 返回查询的 fill() 方式，没有 fill() 时和数据库一样是 null
+func fillMode(s *influxql.SelectStatement) string {
+	switch s.Fill {
+	case influxql.NoFill:
+		return "none"
+	case influxql.NumberFill:
+		return fmt.Sprint(s.FillValue)
+	case influxql.PreviousFill:
+		return "previous"
+	case influxql.LinearFill:
+		return "linear"
+	}
+	return "null"
+}
+
+// fieldAggregation 返回 SELECT 列表中的一项的聚合函数和函数参数中的列名，不是函数调用时 ok 为 false
+// 嵌套的函数如 COUNT(DISTINCT(water_level)) 记为 count(distinct)，和 COUNT(water_level) 区分；DISTINCT x 和 DISTINCT(x) 相同
+// 列名之后的参数从外层的函数到内层的函数依次记录，如 MOVING_AVERAGE(MEAN(water_level), 2) 的参数是 2
+func fieldAggregation(expr influxql.Expr) (aggr Aggregation, arg string, ok bool) {
+	if d, isDistinct := expr.(*influxql.Distinct); isDistinct {
+		expr = d.NewCall()
+	}
+	call, isCall := expr.(*influxql.Call)
+	if !isCall {
+		return Aggregation{}, "", false
+	}
+
+	names := []string{strings.ToLower(call.Name)}
+	for {
+		for _, a := range callArgs(call) {
+			aggr.Args = append(aggr.Args, argString(a))
+		}
+		if len(call.Args) == 0 {
+			break
+		}
+		if d, isDistinct := call.Args[0].(*influxql.Distinct); isDistinct {
+			call = d.NewCall()
+			names = append(names, call.Name)
+			continue
+		}
+		inner, isCall := call.Args[0].(*influxql.Call)
+		if !isCall {
+			break
+		}
+		call = inner
+		names = append(names, strings.ToLower(call.Name))
+	}
+	if len(call.Args) > 0 {
+		arg = exprColumn(call.Args[0])
+	}
+
+	aggr.Func = strings.Join(names, "(") + strings.Repeat(")", len(names)-1)
+	return aggr, arg, true
+}
+
+// callArgs 返回函数调用中列名之后的参数
+func callArgs(call *influxql.Call) []influxql.Expr {
+	if len(call.Args) < 2 {
+		return nil
+	}
+	return call.Args[1:]
+}
+
+// argString 返回函数参数的写法：数值不带多余的 0，字符串和列名不带引号，时间区间和 GetInterval 相同
+func argString(expr influxql.Expr) string {
+	switch e := expr.(type) {
+	case *influxql.IntegerLiteral:
+		return strconv.FormatInt(e.Val, 10)
+	case *influxql.NumberLiteral:
+		return strconv.FormatFloat(e.Val, 'f', -1, 64)
+	case *influxql.StringLiteral:
+		return e.Val
+	case *influxql.DurationLiteral:
+		return formatInterval(e.Val)
+	}
+	return exprColumn(expr)
+}
+
+// selectAggregation 和 fieldAggregation 相同，包含函数调用的表达式（如 MAX(water_level) * 2）用其中的第一个函数调用；
+// 不包含函数调用的列名和算术表达式 ok 为 false
+func selectAggregation(expr influxql.Expr) (aggr Aggregation, arg string, ok bool) {
+	if aggr, arg, ok := fieldAggregation(expr); ok {
+		return aggr, arg, true
+	}
+	var call *influxql.Call
+	influxql.WalkFunc(expr, func(node influxql.Node) {
+		if c, isCall := node.(*influxql.Call); isCall && call == nil {
+			call = c
+		}
+	})
+	if call == nil {
+		return Aggregation{}, "", false
+	}
+	return fieldAggregation(call)
+}
 
-	return aggr
+// aggregatedFields 返回有聚合函数的 SELECT 列表中每一项的列名和 SG：列名是函数参数中的列名，
+// 有别名的列在后面用 '@' 连接别名，如 water_level@wl，还原时作为列名；
+// 每一列的聚合函数不完全相同时，按列的顺序记录所有聚合函数，用 '|' 连接，如 max|min
+func aggregatedFields(s *influxql.SelectStatement) ([]string, string) {
+	fields := make([]string, 0, len(s.Fields))
+	aggrs := make([]string, 0, len(s.Fields))
+	for _, f := range s.Fields {
+		a, arg, ok := selectAggregation(f.Expr)
+		if !ok {
+			arg = exprColumn(f.Expr)
+		} else {
+			aggrs = append(aggrs, a.String())
+		}
+		if f.Alias != "" {
+			arg += "@" + f.Alias
+		}
+		fields = append(fields, arg)
+	}
+
+	aggr := aggrs[0]
+	for _, a := range aggrs[1:] {
+		if a != aggr {
+			aggr = strings.Join(aggrs, "|")
+			break
+		}
+	}
+	return fields, aggr
+}
+
+// exprColumn 返回表达式在 SF 中的列名：列名不包含双引号和类型选择符，其他表达式用 influxql 的写法
+func exprColumn(expr influxql.Expr) string {
+	if ref, ok := expr.(*influxql.VarRef); ok {
+		return ref.Val
+	}
+	return expr.String()
+}
+
+// hasWildcard 判断表达式中是否有通配符 '*' 或者匹配列名的正则表达式，这时列名只能从结果中获取
+func hasWildcard(expr influxql.Expr) bool {
+	found := false
+	influxql.WalkFunc(expr, func(node influxql.Node) {
+		switch node.(type) {
+		case *influxql.Wildcard, *influxql.RegexLiteral:
+			found = true
+		}
+	})
+	return found
+}
+
+// sfFieldNames 返回没有聚合函数的查询中，SELECT 列表每一项在 SF 中的列名：
+// 算术表达式去掉空格，如 usage_user+usage_system；用 ::tag 指定为 tag 的列保留类型选择符，如 location::tag，
+// 和同名的 field 区分（::field 和不指定相同，不保留）；有别名时在后面用 '@' 连接别名，如 water_level@wl；
+// 其他项为空字符串，使用结果中的列名。列表项数不是 n 或有通配符时，无法和结果的列对应，都为空字符串。
+// 列名和别名已经用 escapeSF 转义
+func sfFieldNames(s *influxql.SelectStatement, n int) []string {
+	names := make([]string, n)
+	if len(s.Fields) != n || s.HasFieldWildcard() {
+		return names
+	}
+	for i, f := range s.Fields {
+		switch expr := f.Expr.(type) {
+		case *influxql.BinaryExpr, *influxql.ParenExpr:
+			names[i] = escapeSFExpr(compactExpr(expr.String()))
+		case *influxql.VarRef:
+			if expr.Type == influxql.Tag {
+				names[i] = escapeSF(expr.Val) + "::tag"
+			} else if f.Alias != "" {
+				names[i] = escapeSF(expr.Val)
+			}
+		}
+		if f.Alias != "" && names[i] != "" {
+			names[i] += "@" + escapeSF(f.Alias)
+		}
+	}
+	return names
+}
+
+// selectStatement 把查询语句解析成 SELECT 语句
+func selectStatement(queryString string) (*influxql.SelectStatement, bool) {
+	stmt, err := influxql.ParseStatement(queryString)
+	if err != nil {
+		return nil, false
+	}
+	s, ok := stmt.(*influxql.SelectStatement)
+	return s, ok
+}
+
+// sfColumnName 返回 SF 中的列名在结果中的列名：有别名时是别名；类型选择符不是列名的一部分，location::tag 的列名是 location；
+// 算术表达式的列名和 InfluxDB 一样，是表达式中的列名用 '_' 连接
+func sfColumnName(name string) string {
+	if idx := strings.LastIndex(name, "@"); idx >= 0 {
+		return unescapeSegment(name[idx+1:])
+	}
+	if !strings.ContainsAny(name, sfOperators) { // 列名中的运算符已经被转义，有运算符的是算术表达式
+		if idx := strings.Index(name, "::"); idx >= 0 {
+			name = name[:idx]
+		}
+		return unescapeSegment(name)
+	}
+	name = unescapeSegment(name)
+	expr, err := influxql.ParseExpr(name)
+	if err != nil {
+		return name
+	}
+	switch expr.(type) {
+	case *influxql.BinaryExpr, *influxql.ParenExpr:
+		return (&influxql.Field{Expr: expr}).Name()
+	}
+	return name
+}
+
+// isTagColumn 判断 SF 中的列是否是 tag：用 ::tag 指定的列是 tag，用 ::field 指定的列不是；
+// 没有类型选择符时，是表的 tag（TagKV）而且不是同名的 field（Fields）的列是 tag
+func isTagColumn(measurement, name string) bool {
+	if idx := strings.LastIndex(name, "@"); idx >= 0 {
+		name = name[:idx]
+	}
+	if idx := strings.Index(name, "::"); idx >= 0 {
+		return name[idx+2:] == "tag"
+	}
+	name = unescapeSegment(name)
+	schema := CurrentSchema()
+	for _, f := range schema.Fields[measurement] {
+		if f == name {
+			return false
+		}
+	}
+	for _, tkm := range schema.TagKV.Measurement[measurement] {
+		if _, ok := tkm.Tag[name]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// aggregationColumn 返回 SG 中的聚合函数在结果中的列名，见 Aggregation.Column
+func aggregationColumn(aggr string) string {
+	return ParseAggregation(aggr).Column()
 }
 
 // GetSFSGWithDataType  重写，包含数据类型和列名
 func GetSFSGWithDataType(queryString string, resp *Response) (string, string) {
 	var fields []string
-	var FGstr string
-
-	/* 用正则匹配从查询语句中取出包含聚合函数和列名的字符串  */
-	regStr := `(?i)SELECT\s*(.+)\s*FROM.+`
-	regExpr := regexp.MustCompile(regStr)
 
-	if ok, _ := regexp.MatchString(regStr, queryString); ok {
-		match := regExpr.FindStringSubmatch(queryString)
-		FGstr = match[1] // fields and aggr
-	} else {
+	s, ok := selectStatement(queryString)
+	if !ok || len(s.Fields) == 0 {
 		return "error", "error"
 	}
 
 	var aggr string
-	singleField := strings.Split(FGstr, ",")
-	if strings.IndexAny(singleField[0], "(") > 0 && strings.IndexAny(singleField[0], "*") < 0 { // 有一或多个聚合函数, 没有通配符 '*'
-		/* 获取聚合函数名 */
-		index := strings.IndexAny(singleField[0], "(")
-		aggr = singleField[0][:index]
-		aggr = strings.ToLower(aggr)
-
-		/* 从查询语句获取field(实际的列名) */
-		fields = append(fields, "time")
-		var startIdx int
-		var endIdx int
-		for i := range singleField {
-			for idx, ch := range singleField[i] { // 括号中间的部分是fields，默认没有双引号，不作处理
-				if ch == '(' {
-					startIdx = idx + 1
-				}
-				if ch == ')' {
-					endIdx = idx
-				}
-			}
-			tmpStr := singleField[i][startIdx:endIdx]
-			tmpArr := strings.Split(tmpStr, ",")
-			fields = append(fields, tmpArr...)
-		}
+	first := s.Fields[0].Expr
+	firstAggr, _, hasAggr := selectAggregation(first)
+	if hasAggr && !hasWildcard(first) { // 有一或多个聚合函数, 没有通配符 '*'
+		/* 获取每一列的聚合函数名和field(实际的列名)，嵌套的函数如 count(distinct) 作为一个聚合函数 */
+		var flds []string
+		flds, aggr = aggregatedFields(s)
+		fields = append([]string{"time"}, flds...)
 
-	} else if strings.IndexAny(singleField[0], "(") > 0 && strings.IndexAny(singleField[0], "*") >= 0 { // 有聚合函数，有通配符 '*'
-		/* 获取聚合函数名 */
-		index := strings.IndexAny(singleField[0], "(")
-		aggr = singleField[0][:index]
-		aggr = strings.ToLower(aggr)
+	} else if hasAggr { // 有聚合函数，有通配符 '*'
+		aggr = firstAggr.String()
 
 		/* 从Response获取列名 */
 		for _, c := range resp.Results[0].Series[0].Columns {
 			startIdx := strings.IndexAny(c, "_")
 			if startIdx > 0 {
 				tmpStr := c[startIdx+1:]
-				fields = append(fields, tmpStr)
+				fields = append(fields, escapeSF(tmpStr))
 			} else {
-				fields = append(fields, c)
+				fields = append(fields, escapeSF(c))
 			}
 		}
 
 	} else { // 没有聚合函数，通配符无所谓
 		aggr = "empty"
-		/* 从Response获取列名 */
-		for _, c := range resp.Results[0].Series[0].Columns {
+		/* 从Response获取列名，算术表达式的列用表达式本身表示，如 usage_user+usage_system，有别名时加上别名 */
+		columns := resp.Results[0].Series[0].Columns
+		names := sfFieldNames(s, len(columns)-1)
+		for i, c := range columns {
+			c = escapeSF(c)
+			if i > 0 && names[i-1] != "" {
+				c = names[i-1]
+			}
 			fields = append(fields, c)
 		}
 	}
@@ -1721,10 +2415,15 @@ func GetSFSGWithDataType(queryString string, resp *Response) (string, string) {
 	//	}
 	//}
 
-	/* 从查寻结果中获取每一列的数据类型 */
+	/* 从查寻结果中获取每一列的数据类型，tag 的值总是字符串，不用从数据推断 */
 	dataTypes := DataTypeArrayFromResponse(resp)
+	measurement := resp.Results[0].Series[0].Name
 	for i := range fields {
-		fields[i] = fmt.Sprintf("%s[%s]", fields[i], dataTypes[i])
+		dataType := "string"
+		if i == 0 || aggr != "empty" || !isTagColumn(measurement, fields[i]) {
+			dataType = dataTypes[i]
+		}
+		fields[i] = fmt.Sprintf("%s[%s]", fields[i], dataType)
 	}
 
 	//去掉第一列中的 time[int64]
@@ -1735,7 +2434,8 @@ func GetSFSGWithDataType(queryString string, resp *Response) (string, string) {
 	return fieldsStr, aggr
 }
 
-// DataTypeArrayFromResponse 从查寻结果中获取每一列的数据类型
+// DataTypeArrayFromResponse 从查寻结果中获取每一列的数据类型：按第一条所有字段都不为空的数据推断，
+// 推断为 int64 的列中有不是整数的值时改为 float64，比如 float 类型的 field 前面的值恰好是整数
 func DataTypeArrayFromResponse(resp *Response) []string {
 	fields := make([]string, 0)
 	done := false
@@ -1779,6 +2479,22 @@ func DataTypeArrayFromResponse(resp *Response) []string {
 		}
 	}
 
+	/* 整数列中有小数时整列为 float64，存入和读取时数值不变 */
+	for _, s := range resp.Results[0].Series {
+		for _, v := range s.Values {
+			for i := 1; i < len(v) && i < len(fields); i++ {
+				if fields[i] != "int64" {
+					continue
+				}
+				if n, ok := v[i].(json.Number); ok {
+					if _, err := n.Int64(); err != nil {
+						fields[i] = "float64"
+					}
+				}
+			}
+		}
+	}
+
 	return fields
 }
 
@@ -1799,50 +2515,35 @@ func DataTypeArrayFromSF(sfString string) []string {
 }
 
 func GetSFSG(query string) (string, string) {
-	regStr := `(?i)SELECT\s*(.+)\s*FROM.+`
-	regExpr := regexp.MustCompile(regStr)
-	var FGstr string
-	if ok, _ := regexp.MatchString(regStr, query); ok { // 取出 fields 和 聚合函数aggr
-		match := regExpr.FindStringSubmatch(query)
-		FGstr = match[1] // fields and aggr
-	} else {
+	s, ok := selectStatement(query)
+	if !ok || len(s.Fields) == 0 {
 		return "err", "err"
 	}
 
 	var flds string
 	var aggr string
 
-	if strings.IndexAny(FGstr, ")") > 0 { // 如果这部分有括号，说明有聚合函数 ?
-		/* get aggr */
-		fields := influxql.Fields{}
-		expr, err := influxql.NewParser(strings.NewReader(FGstr)).ParseExpr()
-		if err != nil {
-			panic(err)
-		}
-		fields = append(fields, &influxql.Field{Expr: expr})
-		aggrs := fields.Names()
-		aggr = strings.Join(aggrs, ",") //获取聚合函数
-
-		/* get fields */
-		//flds += "time,"
-		var start_idx int
-		var end_idx int
-		for idx, ch := range FGstr { // 括号中间的部分是fields，默认没有双引号，不作处理
-			if ch == '(' {
-				start_idx = idx + 1
+	if _, _, ok := selectAggregation(s.Fields[0].Expr); ok { // 有聚合函数，包括嵌套的函数和 DISTINCT x
+		var fields []string
+		fields, aggr = aggregatedFields(s)
+		flds = strings.Join(fields, ",")
+	} else { //没有聚合函数，直接从查询语句中解析出fields
+		aggr = "empty"
+		rewritten := s
+		if s.HasFieldWildcard() { // 用 schema 展开通配符，*::field 只有 field，*::tag 只有 tag
+			if r, err := s.RewriteFields(schemaFieldMapper{}); err == nil {
+				rewritten = r
 			}
-			if ch == ')' {
-				end_idx = idx
+		}
+		names := rewritten.ColumnNames()[1:]
+		for i, name := range sfFieldNames(s, len(names)) {
+			if name != "" {
+				names[i] = name
+			} else {
+				names[i] = escapeSF(names[i])
 			}
 		}
-		flds += FGstr[start_idx:end_idx]
-
-	} else { //没有聚合函数，直接从查询语句中解析出fields
-		aggr = "empty"
-		parser := influxql.NewParser(strings.NewReader(query))
-		stmt, _ := parser.ParseStatement()
-		s := stmt.(*influxql.SelectStatement)
-		flds = strings.Join(s.ColumnNames()[1:], ",")
+		flds = strings.Join(names, ",")
 	}
 
 	return flds, aggr
@@ -1850,62 +2551,45 @@ func GetSFSG(query string) (string, string) {
 
 /* 只获取谓词，不要时间范围 */
 func GetSP(query string, resp *Response, tagMap MeasurementTagMap) (string, []string) {
-	//regStr := `(?i).+WHERE(.+)GROUP BY.`
-	regStr := `(?i).+WHERE(.+)`
-	conditionExpr := regexp.MustCompile(regStr)
-	if ok, _ := regexp.MatchString(regStr, query); !ok {
+	var measurement string
+	if !ResponseIsEmpty(resp) {
+		measurement = resp.Results[0].Series[0].Name
+	}
+	return getSP(query, measurement, tagMap)
+}
+
+// getSP 和 GetSP 相同，measurement 是结果中表的名字，为空时表示结果为空
+func getSP(query string, measurement string, tagMap MeasurementTagMap) (string, []string) {
+	s, ok := selectStatement(query)
+	if !ok || s.Condition == nil { // WHERE 子句的所有表达式，包括谓词和时间范围
 		return "{empty}", nil
 	}
-	condExprMatch := conditionExpr.FindStringSubmatch(query) // 获取 WHERE 后面的所有表达式，包括谓词和时间范围
-	parseExpr := condExprMatch[1]
 
 	now := time.Now()
 	valuer := influxql.NowValuer{Now: now}
-	expr, _ := influxql.ParseExpr(parseExpr)
-	cond, _, _ := influxql.ConditionExpr(expr, &valuer) //提取出谓词
+	cond, _, _ := influxql.ConditionExpr(s.Condition, &valuer) //提取出谓词
 
 	tagConds := make([]string, 0)
 	var result string
 	if cond == nil { //没有谓词
 		result += fmt.Sprintf("{empty}")
 	} else { //从语法树中找出由AND或OR连接的所有独立的谓词表达式
-		var conds []string
-		var tag []string
-		binaryExpr := cond.(*influxql.BinaryExpr)
-		var datatype []string
-		var measurement string
-		if !ResponseIsEmpty(resp) {
-			measurement = resp.Results[0].Series[0].Name
-		} else {
+		binaryExpr := binaryExprOf(cond)
+		if measurement == "" {
 			return "{empty}", nil
 		}
 
-		tags, predicates, datatypes := PreOrderTraverseBinaryExpr(binaryExpr, &tag, &conds, &datatype)
-		result += "{"
-		for i, p := range *predicates {
-			isTag := false
-			found := false
-			for _, t := range tagMap.Measurement[measurement] {
-				for tagkey, _ := range t.Tag {
-					if (*tags)[i] == tagkey {
-						isTag = true
-						found = true
-						break
-					}
-				}
-				if found {
-					break
-				}
+		result += "{" + canonicalCondition(binaryExpr, func(node *influxql.BinaryExpr) string {
+			tags, predicates, datatypes := PreOrderTraverseBinaryExpr(node, &[]string{}, &[]string{}, &[]string{})
+			p := (*predicates)[0]
+			/* 同名的 field 和 tag 在 WHERE 中默认是 field */
+			datatype, isField := predicateDatatype(measurement, (*tags)[0], (*datatypes)[0])
+			if !isField && isTagKey(tagMap, measurement, (*tags)[0]) {
+				tagConds = append(tagConds, strings.ReplaceAll(p, "'", ""))
+				return ""
 			}
-
-			if !isTag {
-				result += fmt.Sprintf("(%s[%s])", p, (*datatypes)[i])
-			} else {
-				p = strings.ReplaceAll(p, "'", "")
-				tagConds = append(tagConds, p)
-			}
-		}
-		result += "}"
+			return fmt.Sprintf("(%s[%s])", p, datatype)
+		}) + "}"
 	}
 
 	if len(result) == 2 {
@@ -1920,19 +2604,14 @@ func GetSP(query string, resp *Response, tagMap MeasurementTagMap) (string, []st
 SP 和 ST 都可以在这个函数中取到		条件判断谓词和查询时间范围
 */
 func GetSPST(query string) string {
-	//regStr := `(?i).+WHERE(.+)GROUP BY.`
-	regStr := `(?i).+WHERE(.+)`
-	conditionExpr := regexp.MustCompile(regStr)
-	if ok, _ := regexp.MatchString(regStr, query); !ok {
+	s, ok := selectStatement(query)
+	if !ok || s.Condition == nil { // WHERE 子句的所有表达式，包括谓词和时间范围
 		return "{empty}#{empty,empty}"
 	}
-	condExprMatch := conditionExpr.FindStringSubmatch(query) // 获取 WHERE 后面的所有表达式，包括谓词和时间范围
-	parseExpr := condExprMatch[1]
 
 	now := time.Now()
 	valuer := influxql.NowValuer{Now: now}
-	expr, _ := influxql.ParseExpr(parseExpr)
-	cond, timeRange, _ := influxql.ConditionExpr(expr, &valuer) //提取出谓词和时间范围
+	cond, timeRange, _ := influxql.ConditionExpr(s.Condition, &valuer) //提取出谓词和时间范围
 
 	start_time := timeRange.MinTime() //获取起止时间
 	end_time := timeRange.MaxTime()
@@ -1953,55 +2632,91 @@ func GetSPST(query string) string {
 	if cond == nil { //没有谓词
 		result += fmt.Sprintf("{empty}#{%s,%s}", string_start_time, string_end_time)
 	} else { //从语法树中找出由AND或OR连接的所有独立的谓词表达式
-		var conds []string
-		var tag []string
-		binaryExpr := cond.(*influxql.BinaryExpr)
-		var datatype []string
-		_, predicates, datatypes := PreOrderTraverseBinaryExpr(binaryExpr, &tag, &conds, &datatype)
-		result += "{"
-		for i, p := range *predicates {
-			result += fmt.Sprintf("(%s[%s])", p, (*datatypes)[i])
-		}
-		result += "}"
+		binaryExpr := binaryExprOf(cond)
+		measurement := queryMeasurement(query)
+		result += "{" + canonicalCondition(binaryExpr, func(node *influxql.BinaryExpr) string {
+			tags, predicates, datatypes := PreOrderTraverseBinaryExpr(node, &[]string{}, &[]string{}, &[]string{})
+			datatype, _ := predicateDatatype(measurement, (*tags)[0], (*datatypes)[0])
+			return fmt.Sprintf("(%s[%s])", (*predicates)[0], datatype)
+		}) + "}"
 		result += fmt.Sprintf("#{%s,%s}", string_start_time, string_end_time)
 	}
 
 	return result
 }
 
+// GetQueryTimeRange 获取 InfluxQL 查询语句 WHERE 子句中的时间范围（纳秒）
+// 支持 RFC3339 时间、任意精度的 epoch（1566086400000000000、1566086400s）和 now() 的加减（now() - 1h + 5m）；
+// 没有上界时为当前时间。relative 表示时间范围依赖当前时间，同一个查询每次执行的范围都不同
+// 无法解析或没有下界时返回 -1, -1
+func GetQueryTimeRange(queryString string) (startTime, endTime int64, relative bool) {
+	stmt, err := influxql.ParseStatement(queryString)
+	if err != nil {
+		return -1, -1, false
+	}
+	s, ok := stmt.(*influxql.SelectStatement)
+	if !ok || s.Condition == nil {
+		return -1, -1, false
+	}
+
+	/* OR 连接的多个时间范围，返回包含所有范围的时间范围，分别处理每个范围用 GetQueryTimeRanges */
+	if ranges, relative := GetQueryTimeRanges(queryString); len(ranges) > 1 {
+		return ranges[0].Start, ranges[len(ranges)-1].End, relative
+	}
+
+	now := time.Now()
+	_, timeRange, err := influxql.ConditionExpr(s.Condition, &influxql.NowValuer{Now: now})
+	if err != nil || timeRange.Min.IsZero() {
+		return -1, -1, false
+	}
+
+	/* 条件中出现 now() 或者没有上界，时间范围都依赖当前时间 */
+	influxql.WalkFunc(s.Condition, func(node influxql.Node) {
+		if call, ok := node.(*influxql.Call); ok && strings.EqualFold(call.Name, "now") {
+			relative = true
+		}
+	})
+	if timeRange.Max.IsZero() {
+		return timeRange.MinTimeNano(), now.UnixNano(), true
+	}
+	return timeRange.MinTimeNano(), timeRange.MaxTimeNano(), relative
+}
+
 /*
 遍历语法树，找出所有谓词表达式，去掉多余的空格，存入字符串数组
+常量在左边的比较换成列名在左边的形式，如 1<a 写成 a>1
 */
 func PreOrderTraverseBinaryExpr(node *influxql.BinaryExpr, tags *[]string, predicates *[]string, datatypes *[]string) (*[]string, *[]string, *[]string) {
 	if node.Op != influxql.AND && node.Op != influxql.OR { // 不是由AND或OR连接的，说明表达式不可再分，存入结果数组
-		str := node.String()
+		node = canonicalComparison(node)
+		str := exprString(node)
 		//fmt.Println(node.LHS.String())
 		// 用字符串获取每个二元表达式的数据类型	可能有问题，具体看怎么用
+		_, isFloat := node.RHS.(*influxql.NumberLiteral)
 		if strings.Contains(str, "'") { // 有单引号的都是字符串
 			*datatypes = append(*datatypes, "string")
 		} else if strings.EqualFold(node.RHS.String(), "true") || strings.EqualFold(node.RHS.String(), "false") { // 忽略大小写，相等就是 bool
 			*datatypes = append(*datatypes, "bool")
-		} else if strings.Contains(str, ".") { // 带小数点就是 double
+		} else if isFloat || strings.Contains(str, ".") { // 浮点数常量或带小数点就是 double
 			*datatypes = append(*datatypes, "float64")
 		} else { // 什么都没有是 int
 			*datatypes = append(*datatypes, "int64")
 		}
 
-		*tags = append(*tags, node.LHS.String())
-		str = strings.ReplaceAll(str, " ", "") //去掉空格
-		*predicates = append(*predicates, str)
+		*tags = append(*tags, predicateColumn(node.LHS))
+		*predicates = append(*predicates, predicateString(node)) //去掉空格
 		return tags, predicates, datatypes
 	}
 
 	if node.LHS != nil { //遍历左子树
-		binaryExprL := GetBinaryExpr(node.LHS.String())
+		binaryExprL := binaryExprOf(node.LHS)
 		PreOrderTraverseBinaryExpr(binaryExprL, tags, predicates, datatypes)
 	} else {
 		return tags, predicates, datatypes
 	}
 
 	if node.RHS != nil { //遍历右子树
-		binaryExprR := GetBinaryExpr(node.RHS.String())
+		binaryExprR := binaryExprOf(node.RHS)
 		PreOrderTraverseBinaryExpr(binaryExprR, tags, predicates, datatypes)
 	} else {
 		return tags, predicates, datatypes
@@ -2010,6 +2725,159 @@ func PreOrderTraverseBinaryExpr(node *influxql.BinaryExpr, tags *[]string, predi
 	return tags, predicates, datatypes
 }
 
+// reversedOperators 是交换比较的两边时对应的运算符
+var reversedOperators = map[influxql.Token]influxql.Token{
+	influxql.EQ:  influxql.EQ,
+	influxql.NEQ: influxql.NEQ,
+	influxql.LT:  influxql.GT,
+	influxql.LTE: influxql.GTE,
+	influxql.GT:  influxql.LT,
+	influxql.GTE: influxql.LTE,
+}
+
+// canonicalComparison 把左边不是列名、右边是列名的比较交换两边，让等价的谓词写法相同
+func canonicalComparison(node *influxql.BinaryExpr) *influxql.BinaryExpr {
+	if _, ok := node.LHS.(*influxql.VarRef); ok {
+		return node
+	}
+	op, ok := reversedOperators[node.Op]
+	if _, isRef := node.RHS.(*influxql.VarRef); !isRef || !ok {
+		return node
+	}
+	return &influxql.BinaryExpr{Op: op, LHS: node.RHS, RHS: node.LHS}
+}
+
+// exprString 和 Expr.String() 相同，只是浮点数常量用能精确还原的最短形式，如 -0.59 而不是 -0.590，
+// influxql 只保留 3 位小数，-0.5901 和 -0.5904 会得到相同的谓词
+func exprString(expr influxql.Expr) string {
+	switch e := expr.(type) {
+	case *influxql.BinaryExpr:
+		return fmt.Sprintf("%s %s %s", exprString(e.LHS), e.Op.String(), exprString(e.RHS))
+	case *influxql.ParenExpr:
+		return fmt.Sprintf("(%s)", exprString(e.Expr))
+	case *influxql.NumberLiteral:
+		return strconv.FormatFloat(e.Val, 'g', -1, 64)
+	}
+	return expr.String()
+}
+
+// predicateColumn 返回谓词左边的列名，不包含双引号和类型选择符
+func predicateColumn(expr influxql.Expr) string {
+	if ref, ok := expr.(*influxql.VarRef); ok {
+		return ref.Val
+	}
+	return expr.String()
+}
+
+// predicateString 把谓词写成没有空格的字符串，如 water_level>-0.59；
+// 列名和字符串常量中语义段的分隔符用 escapeSM 转义，"level description"='below 3 feet' 写成 level%20description='below%203%20feet'
+func predicateString(node *influxql.BinaryExpr) string {
+	side := func(expr influxql.Expr) string {
+		switch e := expr.(type) {
+		case *influxql.VarRef:
+			if e.Type != influxql.Unknown {
+				return escapeSM(e.Val) + "::" + e.Type.String()
+			}
+			return escapeSM(e.Val)
+		case *influxql.StringLiteral:
+			return "'" + escapeSM(e.Val) + "'"
+		}
+		return strings.ReplaceAll(exprString(expr), " ", "")
+	}
+	return side(node.LHS) + node.Op.String() + side(node.RHS)
+}
+
+// predicateDatatype 返回谓词的数据类型：左边是 FieldTypes 中记录了类型的 field 时使用 field 的类型，isField 为 true；
+// 否则使用按常量的写法推断的 guessed。常量的写法不能区分 string field 和 tag，也不能区分 float field 和整数常量
+func predicateDatatype(measurement, column, guessed string) (datatype string, isField bool) {
+	if typ, ok := CurrentSchema().FieldTypes[measurement][column]; ok {
+		return typ, true
+	}
+	return guessed, false
+}
+
+// isTagKey 判断 key 是不是 tagMap 中记录的表的 tag
+func isTagKey(tagMap MeasurementTagMap, measurement, key string) bool {
+	for _, t := range tagMap.Measurement[measurement] {
+		if _, ok := t.Tag[key]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// queryMeasurement 返回查询的第一张表的表名，无法解析时为空字符串
+func queryMeasurement(queryString string) string {
+	s, ok := selectStatement(queryString)
+	if !ok || len(s.Sources) == 0 {
+		return ""
+	}
+	if m, ok := s.Sources[0].(*influxql.Measurement); ok {
+		return m.Name
+	}
+	return ""
+}
+
+// canonicalCondition 把 AND 和 OR 连接的谓词写成 SP 中的形式，每个谓词由 leaf 写成 (predicate[datatype])，
+// leaf 返回空字符串时忽略这个谓词（GetSP 中 tag 的谓词放在 SM 中）。同一个 AND 组内的谓词排序并去掉重复的谓词，
+// 条件的顺序不同但等价的查询得到相同的 SP；OR 的每一边保持原来的顺序，用 | 分隔并在外层加括号，
+// 如 ((index>1[int64])(index<5[int64])|(index>10[int64])(index<20[int64]))
+func canonicalCondition(node *influxql.BinaryExpr, leaf func(*influxql.BinaryExpr) string) string {
+	switch node.Op {
+	case influxql.AND:
+		operands := make([]string, 0)
+		for _, operand := range flattenCondition(node, influxql.AND) {
+			if p := canonicalCondition(operand, leaf); p != "" {
+				operands = append(operands, p)
+			}
+		}
+		sort.Strings(operands)
+		unique := operands[:0]
+		for i, p := range operands {
+			if i == 0 || p != operands[i-1] {
+				unique = append(unique, p)
+			}
+		}
+		return strings.Join(unique, "")
+	case influxql.OR:
+		operands := make([]string, 0)
+		for _, operand := range flattenCondition(node, influxql.OR) {
+			if p := canonicalCondition(operand, leaf); p != "" {
+				operands = append(operands, p)
+			}
+		}
+		if len(operands) <= 1 {
+			return strings.Join(operands, "")
+		}
+		return "(" + strings.Join(operands, "|") + ")"
+	default:
+		return leaf(node)
+	}
+}
+
+// flattenCondition 按原来的顺序返回连续的 op 连接的所有操作数，如 a AND (b AND c) 的 a、b、c
+func flattenCondition(node *influxql.BinaryExpr, op influxql.Token) []*influxql.BinaryExpr {
+	if node.Op != op {
+		return []*influxql.BinaryExpr{node}
+	}
+	return append(flattenCondition(binaryExprOf(node.LHS), op), flattenCondition(binaryExprOf(node.RHS), op)...)
+}
+
+// binaryExprOf 返回子树中的二元表达式，去掉外层的括号；不再转换成字符串重新解析，常量不会丢失精度
+func binaryExprOf(expr influxql.Expr) *influxql.BinaryExpr {
+	for {
+		paren, ok := expr.(*influxql.ParenExpr)
+		if !ok {
+			break
+		}
+		expr = paren.Expr
+	}
+	if binaryExpr, ok := expr.(*influxql.BinaryExpr); ok {
+		return binaryExpr
+	}
+	return GetBinaryExpr(expr.String())
+}
+
 /*
 字符串转化成二元表达式，用作遍历二叉树的节点
 */
@@ -2044,22 +2912,59 @@ func GetInterval(query string) string {
 	} else {
 		//result := fmt.Sprintf("%dm", int(interval.Minutes()))
 		//return result
-		result := interval.String()
-		for idx, ch := range result {
-			if unicode.IsLetter(ch) {
-				if (idx+1) < len(result) && result[idx+1] == '0' {
-					return result[0 : idx+1]
-				}
-			}
+		/* 有偏移量时区间的边界不同，和区间一起记录，如 GROUP BY time(5m, 1m) 写成 5m,1m */
+		if offset := groupByOffset(s); offset != 0 {
+			return formatInterval(interval) + "," + formatInterval(offset)
 		}
+		return formatInterval(interval)
+	}
 
-		return result
+}
+
+// groupByOffset 返回 GROUP BY time() 的偏移量，和数据库一样换算到 [0, interval) 之间，
+// time(5m, -1m) 和 time(5m, 4m) 的区间相同；没有偏移量或没有 GROUP BY time() 时返回 0
+func groupByOffset(s *influxql.SelectStatement) time.Duration {
+	interval, err := s.GroupByInterval()
+	if err != nil || interval <= 0 {
+		return 0
 	}
+	offset, err := s.GroupByOffset()
+	if err != nil {
+		return 0
+	}
+	return time.Duration(mod(int64(offset), int64(interval)))
+}
 
+// formatInterval 把区间写成紧凑的形式，去掉为 0 的单位，如 12m0s 写成 12m，1h0m30s 写成 1h30s，1w 写成 168h；
+// 结果可以用 time.ParseDuration 还原，同一个区间的写法总是相同，语义段和重新聚合都使用这种形式
+func formatInterval(interval time.Duration) string {
+	if interval == 0 {
+		return "0s"
+	}
+	var b strings.Builder
+	if interval < 0 {
+		b.WriteByte('-')
+		interval = -interval
+	}
+	units := []struct {
+		unit   time.Duration
+		suffix string
+	}{
+		{time.Hour, "h"}, {time.Minute, "m"}, {time.Second, "s"},
+		{time.Millisecond, "ms"}, {time.Microsecond, "us"}, {time.Nanosecond, "ns"},
+	}
+	for _, u := range units {
+		if n := interval / u.unit; n > 0 {
+			b.WriteString(strconv.FormatInt(int64(n), 10))
+			b.WriteString(u.suffix)
+			interval -= n * u.unit
+		}
+	}
+	return b.String()
 }
 
 func (resp *Response) ToString() string {
-	var result string
+	var result strings.Builder
 	var tags []string
 
 	tags = GetTagNameArr(resp)
@@ -2067,72 +2972,137 @@ func (resp *Response) ToString() string {
 		return "empty response"
 	}
 
+	/* 按数据量预先分配空间，避免拼接时反复复制 */
+	size := len("end")
+	for _, r := range resp.Results {
+		for _, s := range r.Series {
+			size += (len(s.Values) + 1) * (len(s.Columns) + len(tags)) * 12
+		}
+	}
+	result.Grow(size)
+
 	for r := range resp.Results { //包括 Statement_id , Series[] , Messages[] , Error	只用了 Series[]
 
 		for s := range resp.Results[r].Series { //包括  measurement name, GROUP BY tags, Columns[] , Values[][], partial		只用了 Columns[]和 Values[][]
+			series := resp.Results[r].Series[s]
 
-			result += "SCHEMA "
+			result.WriteString("SCHEMA ")
 			// 列名	Columns[] 	[]string类型
-			for c := range resp.Results[r].Series[s].Columns {
-				result += resp.Results[r].Series[s].Columns[c]
-				result += " " //用空格分隔列名
+			for _, column := range series.Columns {
+				result.WriteString(column)
+				result.WriteByte(' ') //用空格分隔列名
 			}
 
 			// tags		map元素顺序输出
-			for t, tag := range tags {
-				result += fmt.Sprintf("%s=%s ", tags[t], resp.Results[r].Series[s].Tags[tag])
+			for _, tag := range tags {
+				result.WriteString(tag)
+				result.WriteByte('=')
+				result.WriteString(series.Tags[tag])
+				result.WriteByte(' ')
 			}
-			result += "\r\n" // 列名和数据间换行  "\r\n" 还是 "\n" ?	用 "\r\n", 因为 memcache 读取换行符是 CRLF("\r\n")
-
-			for v := range resp.Results[r].Series[s].Values {
-				for vv := range resp.Results[r].Series[s].Values[v] { // 从JSON转换出来之后只有 string 和 json.Number 两种类型
-					if resp.Results[r].Series[s].Values[v][vv] == nil { //值为空时输出一个占位标志
-						result += "_"
-					} else if str, ok := resp.Results[r].Series[s].Values[v][vv].(string); ok {
-						result += str
-					} else if jsonNumber, ok := resp.Results[r].Series[s].Values[v][vv].(json.Number); ok {
-						str := jsonNumber.String()
-						result += str
-						//jsonNumber.String()
-					} else {
-						result += "#"
+			result.WriteString("\r\n") // 列名和数据间换行  "\r\n" 还是 "\n" ?	用 "\r\n", 因为 memcache 读取换行符是 CRLF("\r\n")
+
+			for _, values := range series.Values {
+				for _, value := range values { // 从JSON转换出来之后只有 string 和 json.Number 两种类型
+					switch v := value.(type) {
+					case nil: //值为空时输出一个占位标志
+						result.WriteByte('_')
+					case string:
+						result.WriteString(v)
+					case json.Number:
+						result.WriteString(v.String())
+					default:
+						result.WriteByte('#')
 					}
-					result += " " // 一行 Value 的数据之间用空格分隔
+					result.WriteByte(' ') // 一行 Value 的数据之间用空格分隔
 				}
-				result += "\r\n" // Values 之间换行
+				result.WriteString("\r\n") // Values 之间换行
 			}
-			//result += "\r\n" // Series 之间换行
 		}
-		//result += "\r\n" // Results 之间换行
 	}
-	result += "end" //标志响应转换结束
-	return result
+	result.WriteString("end") //标志响应转换结束
+	return result.String()
 }
 
 func (resp *Response) ToByteArray(queryString string) []byte {
-	result := make([]byte, 0)
+	return resp.toByteArray(queryString, "")
+}
 
+// encodeItem 和 toByteArray 相同，但用 ItemCodec 的格式
+func encodeItem(queryString, precision string, resp *Response) ([]byte, error) {
+	if ResponseIsEmpty(resp) {
+		return StringToByteArray("empty response"), nil
+	}
+	resp = StitchPartialSeries(resp)
+	return ItemCodec.Encode(resp, CodecMeta{Segments: SeperateSemanticSegment(queryString, resp), Precision: precision})
+}
+
+func (resp *Response) toByteArray(queryString, precision string) []byte {
 	/* 结果为空 */
 	if ResponseIsEmpty(resp) {
 		return StringToByteArray("empty response")
 	}
 
-	/* 获取每一列的数据类型 */
-	datatypes := DataTypeArrayFromResponse(resp)
+	/* 分块查询拆开的表先拼接起来，每张表只有一个语义段 */
+	resp = StitchPartialSeries(resp)
 
 	/* 获取每张表单独的语义段 */
 	seperateSemanticSegment := SeperateSemanticSegment(queryString, resp)
 
+	return resp.ToByteArrayWithPrecision(seperateSemanticSegment, precision)
+}
+
+// ToByteArrayWithSegments 用给定的每张表单独的语义段把结果转换成字节数组，语义段的数量和顺序要和结果中的表一致
+// 不依赖 InfluxQL 查询语句，Flux 等其他来源的结果也可以用同样的格式存入cache
+func (resp *Response) ToByteArrayWithSegments(seperateSemanticSegment []string) []byte {
+	return resp.ToByteArrayWithPrecision(seperateSemanticSegment, "")
+}
+
+// ToByteArrayWithPrecision 和 ToByteArrayWithSegments 相同，precision 是结果中 json.Number 时间戳的精度（为空时当作 ns）
+// 时间戳统一转换成纳秒存入，每张表的语义段末尾加上 #{precision} 记录原来的精度，RFC3339 字符串记录为 rfc3339；
+// FieldStats 为 true 时再加上每一列的统计，见 FieldStats；行数超过 BlockRows 的表再加上块索引，见 BlockRows
+func (resp *Response) ToByteArrayWithPrecision(seperateSemanticSegment []string, precision string) []byte {
+	/* NullSkipRow 时只存入没有空值的行 */
+	if Nulls.Policy == NullSkipRow {
+		resp = withoutNullRows(resp)
+	}
+
+	/* 结果为空 */
+	if ResponseIsEmpty(resp) {
+		return StringToByteArray("empty response")
+	}
+
+	/* 时间戳统一为纳秒 */
+	recorded := responsePrecision(resp, precision)
+	resp = responseWithPrecision(resp, recorded, "ns")
+
+	/* 获取每一列的数据类型 */
+	datatypes := DataTypeArrayFromResponse(resp)
+
 	/* 每行数据的字节数 */
 	bytesPerLine := BytesPerLine(datatypes)
 
+	/* 按每张表的语义段和行数预先分配空间，避免追加时反复复制 */
+	size := 0
+	for i, s := range resp.Results[0].Series {
+		size += len(seperateSemanticSegment[i]) + len(recorded) + 3 + 1 + 8 + bytesPerLine*len(s.Values)
+	}
+	result := make([]byte, 0, size)
+
 	for i, s := range resp.Results[0].Series {
 		numOfValues := len(s.Values)                                             // 表中数据行数
 		bytesPerSeries, _ := Int64ToByteArray(int64(bytesPerLine * numOfValues)) // 一张表的数据的总字节数：每行字节数 * 行数
 
 		/* 存入一张表的 semantic segment 和表内所有数据的总字节数 */
-		result = append(result, []byte(seperateSemanticSegment[i])...)
-		result = append(result, []byte(" ")...)
+		result = append(result, seperateSemanticSegment[i]...)
+		result = append(result, "#{"+recorded+"}"...)
+		if FieldStats {
+			result = append(result, "#"+statsSegment(s, datatypes)...)
+		}
+		if BlockRows > 0 && numOfValues > BlockRows {
+			result = append(result, "#"+blockIndexSegment(s, BlockRows)...)
+		}
+		result = append(result, ' ')
 		result = append(result, bytesPerSeries...)
 		//result = append(result, []byte("\r\n")...) // 是否需要换行	没啥必要，看看去掉了有什么影响 //todo 去掉元数据的这个换行符 从字节数组转换回来也要改
 
@@ -2141,9 +3111,7 @@ func (resp *Response) ToByteArray(queryString string) []byte {
 		/* 数据转换成字节数组，存入 */
 		for _, v := range s.Values {
 			for j, vv := range v {
-				datatype := datatypes[j]
-				tmpBytes := InterfaceToByteArray(j, datatype, vv)
-				result = append(result, tmpBytes...)
+				result = append(result, InterfaceToByteArray(j, datatypes[j], vv)...)
 
 			}
 			//fmt.Println(v)
@@ -2165,8 +3133,14 @@ GROUP BY tag 会和 tag 谓词一起出现在SM中
 如何区分两种tag：当前条件下没办法，但是可以通过调整查询语句避免这一问题：把出现在WHRER中的tag也写进GROUP BY，让转换前后的结果中都存在多余的谓词tag
 
 */
-// 字节数组转换成结果类型
+// 字节数组转换成结果类型，时间戳还原成存入时的精度
 func ByteArrayToResponse(byteArray []byte) *Response {
+	return ByteArrayToResponseWithPrecision(byteArray, "")
+}
+
+// ByteArrayToResponseWithPrecision 把字节数组转换成结果类型，时间戳转换成 precision 精度：
+// PrecisionRFC3339 为字符串，其他为 json.Number；precision 为空时还原成存入时记录的精度，没有记录时为纳秒
+func ByteArrayToResponseWithPrecision(byteArray []byte, precision string) *Response {
 
 	/* 没有数据 */
 	if len(byteArray) == 0 {
@@ -2233,6 +3207,11 @@ func ByteArrayToResponse(byteArray []byte) *Response {
 		/* 根据数据类型转换每行数据*/
 		bytesPerLine := BytesPerLine(datatypes) // 每行字节数
 		lines := int(curLen) / bytesPerLine     // 数据行数
+		if ArenaDecoding {
+			values, index = decodeSeriesArena(byteArray, index, datatypes, lines)
+			valuess = append(valuess, values)
+			continue
+		}
 		values = nil
 		for len(values) < lines { // 按行读取一张表中的所有数据
 			value = nil
@@ -2240,8 +3219,12 @@ func ByteArrayToResponse(byteArray []byte) *Response {
 				switch d { // 根据每列的数据类型选择转换方法
 				case "bool":
 					bStartIdx := index
-					index += 2 //	索引指向当前数据的后一个字节
+					index += 1 //	索引指向当前数据的后一个字节
 					bEndIdx := index
+					if Nulls.Policy == NullSentinel && byteArray[bStartIdx] == nullBool {
+						value = append(value, nil)
+						break
+					}
 					tmp, err := ByteArrayToBool(byteArray[bStartIdx:bEndIdx])
 					if err != nil {
 						log.Fatal(err)
@@ -2265,6 +3248,10 @@ func ByteArrayToResponse(byteArray []byte) *Response {
 					//	value = append(value, jNumber)
 					//}
 
+					if isNullInt64(tmp) {
+						value = append(value, nil)
+						break
+					}
 					// 根据查询时设置的参数不同，时间戳可能是字符串或int64，这里暂时当作int64处理
 					str := strconv.FormatInt(tmp, 10)
 					jNumber := json.Number(str) // int64 转换成 json.Number 类型	;Response中的数字类型只有json.Number	int64和float64都要转换成json.Number
@@ -2278,7 +3265,11 @@ func ByteArrayToResponse(byteArray []byte) *Response {
 					if err != nil {
 						log.Fatal(err)
 					}
-					str := strconv.FormatFloat(tmp, 'g', -1, 64)
+					if isNullFloat64(tmp) {
+						value = append(value, nil)
+						break
+					}
+					str := formatFloat(tmp)     // 文本形式见 NumberFormat
 					jNumber := json.Number(str) // 转换成json.Number
 					value = append(value, jNumber)
 					break
@@ -2287,6 +3278,10 @@ func ByteArrayToResponse(byteArray []byte) *Response {
 					index += STRINGBYTELENGTH // 索引指向当前数据的后一个字节
 					sEndIdx := index
 					tmp := ByteArrayToString(byteArray[sStartIdx:sEndIdx])
+					if isNullString(tmp) {
+						value = append(value, nil)
+						break
+					}
 					value = append(value, tmp) // 存放一行数据中的每一列
 					break
 				}
@@ -2312,7 +3307,7 @@ func ByteArrayToResponse(byteArray []byte) *Response {
 		ssm := messages[0][2 : len(messages[0])-2] // 去掉SM两侧的 大括号和小括号
 		merged := strings.Split(ssm, ",")
 		nameIndex := strings.Index(merged[0], ".") // 提取 measurement name
-		name := merged[0][:nameIndex]
+		name := unescapeSegment(merged[0][:nameIndex])
 		tags := make(map[string]string)
 		/* 取出所有tag */
 		for _, m := range merged {
@@ -2321,8 +3316,8 @@ func ByteArrayToResponse(byteArray []byte) *Response {
 			if eqIdx <= 0 {                  // 没有等号说明没有tag
 				break
 			}
-			key := tag[:eqIdx] // Response 中的 tag 结构为 map[string]string
-			val := tag[eqIdx+1 : len(tag)]
+			key := unescapeSegment(tag[:eqIdx]) // Response 中的 tag 结构为 map[string]string
+			val := unescapeSegment(tag[eqIdx+1 : len(tag)])
 			tags[key] = val // 存入 tag map
 		}
 
@@ -2334,17 +3329,41 @@ func ByteArrayToResponse(byteArray []byte) *Response {
 		splitSg := strings.Split(sg, ",")
 		aggr := splitSg[0]                       // 聚合函数名，小写的
 		if strings.Compare(aggr, "empty") != 0 { // 聚合函数不为空，列名应该是聚合函数的名字
-			columns = append(columns, "time")
-			columns = append(columns, aggr)
+			fields := strings.Split(sf, ",")[1:]
+			aggrs := strings.Split(aggr, "|") // 每列的聚合函数不同时用 '|' 连接
+			calls := make([]fieldAggregate, 0, len(fields))
+			for j, f := range fields {
+				name := aggregationColumn(aggrs[0])
+				if len(aggrs) == len(fields) {
+					name = aggregationColumn(aggrs[j])
+				}
+				if idx := strings.Index(f, "@"); idx >= 0 { // 有别名时列名是别名
+					name = unescapeSegment(f[idx+1 : strings.Index(f, "[")])
+				}
+				calls = append(calls, fieldAggregate{aggr: name})
+			}
+			columns = aggregateColumnNames(calls) // 多列时列名依次为 max, max_1 ...
 		} else { // 没有聚合函数，用正常的列名
 			fields := strings.Split(sf, ",") // time[int64],randtag[string]...
 			for _, f := range fields {
 				idx := strings.Index(f, "[") // "[" 前面的字符串是列名，后面的是数据类型
-				columnName := f[:idx]
+				columnName := sfColumnName(f[:idx])
 				columns = append(columns, columnName)
 			}
 		}
 
+		/* 时间戳从纳秒转换成需要的精度 */
+		target := precision
+		if target == "" {
+			target = segmentPrecision(s)
+		}
+		if target != "ns" {
+			for _, v := range valuess[i] {
+				ts, _ := timestampOf(v[0])
+				v[0] = nanoToTimestamp(ts, target)
+			}
+		}
+
 		/* 根据一条语义段构造一个 Series */
 		seriesTmp := Series{
 			Name:    name,
@@ -2399,8 +3418,7 @@ func InterfaceToByteArray(index int, datatype string, value interface{}) []byte
 				}
 			}
 		} else { // 值为空
-			bBytes, _ := BoolToByteArray(false)
-			result = append(result, bBytes...)
+			result = append(result, nullBytes(datatype)...)
 		}
 		break
 	case "int64":
@@ -2449,8 +3467,7 @@ func InterfaceToByteArray(index int, datatype string, value interface{}) []byte
 				}
 			}
 		} else { // 值为空时设置默认值
-			iBytes, _ := Int64ToByteArray(0)
-			result = append(result, iBytes...)
+			result = append(result, nullBytes(datatype)...)
 		}
 		break
 	case "float64":
@@ -2472,8 +3489,7 @@ func InterfaceToByteArray(index int, datatype string, value interface{}) []byte
 				}
 			}
 		} else {
-			fBytes, _ := Float64ToByteArray(0)
-			result = append(result, fBytes...)
+			result = append(result, nullBytes(datatype)...)
 		}
 		break
 	default: // string
@@ -2486,8 +3502,7 @@ func InterfaceToByteArray(index int, datatype string, value interface{}) []byte
 				result = append(result, sBytes...)
 			}
 		} else {
-			sBytes := StringToByteArray(string(byte(0))) // 空字符串
-			result = append(result, sBytes...)
+			result = append(result, nullBytes(datatype)...)
 		}
 		break
 	}
@@ -2540,11 +3555,17 @@ func ByteArrayToBool(byteArray []byte) (bool, error) {
 	return b, nil
 }
 
+// StringToByteArray 把字符串转换成 STRINGBYTELENGTH 字节，不足时末尾补0；
+// 超过时截断，截断的位置在完整的 UTF-8 字符之后，不会只保留多字节字符的一部分，剩下的字节补0
 func StringToByteArray(str string) []byte {
 	byteArray := make([]byte, 0, STRINGBYTELENGTH)
 	byteStr := []byte(str)
 	if len(byteStr) > STRINGBYTELENGTH {
-		return byteStr[:STRINGBYTELENGTH]
+		end := STRINGBYTELENGTH
+		for end > 0 && !utf8.RuneStart(byteStr[end]) {
+			end--
+		}
+		byteStr = byteStr[:end]
 	}
 	byteArray = append(byteArray, byteStr...)
 	for i := 0; i < cap(byteArray)-len(byteStr); i++ {
@@ -2560,13 +3581,9 @@ func ByteArrayToString(byteArray []byte) string {
 	return str
 }
 
+// Int64ToByteArray 把整数转换成小端序的 8 字节，和 binary.Write 的结果相同，不经过反射
 func Int64ToByteArray(number int64) ([]byte, error) {
-	byteBuffer := bytes.NewBuffer([]byte{})
-	err := binary.Write(byteBuffer, binary.LittleEndian, &number)
-	if err != nil {
-		return nil, err
-	}
-	return byteBuffer.Bytes(), nil
+	return binary.LittleEndian.AppendUint64(make([]byte, 0, 8), uint64(number)), nil
 }
 
 func ByteArrayToInt64(byteArray []byte) (int64, error) {
@@ -2582,13 +3599,9 @@ func ByteArrayToInt64(byteArray []byte) (int64, error) {
 	return number, nil
 }
 
+// Float64ToByteArray 把浮点数转换成小端序的 8 字节，和 binary.Write 的结果相同，不经过反射
 func Float64ToByteArray(number float64) ([]byte, error) {
-	byteBuffer := bytes.NewBuffer([]byte{})
-	err := binary.Write(byteBuffer, binary.LittleEndian, &number)
-	if err != nil {
-		return nil, err
-	}
-	return byteBuffer.Bytes(), nil
+	return binary.LittleEndian.AppendUint64(make([]byte, 0, 8), math.Float64bits(number)), nil
 }
 
 func ByteArrayToFloat64(byteArray []byte) (float64, error) {
@@ -2604,17 +3617,40 @@ func ByteArrayToFloat64(byteArray []byte) (float64, error) {
 	return number, nil
 }
 
+// timeLayouts 是 InfluxDB 接受的时间字符串格式：RFC3339（可以有小数秒和 +08:00 这样的时区偏移）、
+// 用空格分隔日期和时间的格式、只有日期的格式；没有时区的格式按 UTC 处理
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02",
+}
+
+// parseTimeString 把时间字符串解析成纳秒时间戳
+func parseTimeString(timestamp string) (int64, bool) {
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, timestamp); err == nil {
+			return t.UnixNano(), true
+		}
+	}
+	return 0, false
+}
+
+// TimeStringToInt64 把时间字符串转换成纳秒时间戳，支持小数秒和时区偏移
 func TimeStringToInt64(timestamp string) int64 {
-	timeT, _ := time.Parse(time.RFC3339, timestamp)
-	numberN := timeT.UnixNano()
+	numberN, ok := parseTimeString(timestamp)
+	if !ok {
+		return time.Time{}.UnixNano() // 和原来 time.Parse 失败时的结果相同
+	}
 
 	return numberN
 }
 
-// 从字节数组转换回来的时间戳是 int64 ,Response 结构中存的是 string	time.RFC3339
+// 从字节数组转换回来的时间戳是 int64 ,Response 结构中存的是 string	time.RFC3339Nano，有小数秒时保留，和 InfluxDB 返回的格式相同
 func TimeInt64ToString(number int64) string {
 	t := time.Unix(0, number).UTC()
-	timestamp := t.Format(time.RFC3339)
+	timestamp := t.Format(time.RFC3339Nano)
 
 	return timestamp
 }
@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"github.com/InfluxDB-client/memcache"
+	"github.com/influxdata/influxdb1-client/models"
 	"io/ioutil"
 	"log"
 	"math"
@@ -16,6 +17,7 @@ import (
 	"reflect"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -132,6 +134,65 @@ func TestUDPClient_Split(t *testing.T) {
 	}
 }
 
+func TestUDPClient_FlushInterval(t *testing.T) {
+	var logger writeLogger
+	cl := udpclient{conn: &logger, payloadSize: 20, flushInterval: time.Hour}
+
+	fields := map[string]interface{}{"a": 1}
+	p, _ := NewPoint("cpu", nil, fields, time.Time{})
+	bp, _ := NewBatchPoints(BatchPointsConfig{})
+	bp.AddPoint(p)
+
+	/* 两次写入的点缓存在一起，Close 时发送 */
+	for i := 0; i < 2; i++ {
+		if err := cl.Write(bp); err != nil {
+			t.Fatalf("Unexpected error during Write: %v", err)
+		}
+	}
+	if len(logger.writes) != 0 {
+		t.Errorf("Mismatched write count: got %v, exp %v", len(logger.writes), 0)
+	}
+	cl.Close()
+	if len(logger.writes) != 1 || string(logger.writes[0]) != "cpu a=1i\ncpu a=1i\n" {
+		t.Errorf("Mismatched writes: got %q", logger.writes)
+	}
+}
+
+func TestUDPClient_ErrorHandler(t *testing.T) {
+	var errs []error
+	cl := udpclient{conn: failingWriter{}, payloadSize: 10, errorHandler: func(err error) { errs = append(errs, err) }}
+
+	fields := map[string]interface{}{"a": 1}
+	p, _ := NewPoint("cpu", nil, fields, time.Time{})
+	bp, _ := NewBatchPoints(BatchPointsConfig{})
+	bp.AddPoint(p)
+	bp.AddPoint(p)
+
+	if err := cl.Write(bp); err == nil {
+		t.Errorf("Expected error during Write")
+	}
+	if len(errs) != 2 {
+		t.Errorf("Mismatched error count: got %v, exp %v", len(errs), 2)
+	}
+}
+
+func TestUDPClient_PayloadSize(t *testing.T) {
+	if _, err := NewUDPClient(UDPConfig{Addr: "localhost:8089", PayloadSize: UDPMaxPayloadSize + 1}); err == nil {
+		t.Errorf("Expected error for payload size larger than %d", UDPMaxPayloadSize)
+	}
+	c, err := NewUDPClient(UDPConfig{Addr: "localhost:8089", PayloadSize: UDPJumboPayloadSize})
+	if err != nil {
+		t.Fatalf("Unexpected error for jumbo payload size: %v", err)
+	}
+	c.Close()
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write(b []byte) (int, error) { return 0, errors.New("connection refused") }
+
+func (failingWriter) Close() error { return nil }
+
 type writeLogger struct {
 	writes [][]byte
 }
@@ -520,6 +581,63 @@ func TestClient_BasicAuth(t *testing.T) {
 	}
 }
 
+func TestClient_TokenAuth(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if auth := r.Header.Get("Authorization"); auth != "Token my-token" {
+			t.Errorf("unexpected authorization header, expected %q, actual %q", "Token my-token", auth)
+		}
+		if db := r.URL.Query().Get("db"); db != "mydb" {
+			t.Errorf("unexpected db, expected %q, actual %q", "mydb", db)
+		}
+		if rp := r.URL.Query().Get("rp"); rp != "autogen" {
+			t.Errorf("unexpected rp, expected %q, actual %q", "autogen", rp)
+		}
+		if strings.HasSuffix(r.URL.Path, "write") {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		var data Response
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_ = json.NewEncoder(w).Encode(data)
+	}))
+	defer ts.Close()
+
+	config := HTTPConfig{Addr: ts.URL, Username: "username", Password: "password", Token: "my-token"}
+	c, _ := NewHTTPClient(config)
+	defer c.Close()
+
+	query := Query{Database: "mydb/autogen"}
+	if _, err := c.Query(query); err != nil {
+		t.Errorf("unexpected error.  expected %v, actual %v", nil, err)
+	}
+
+	bp, _ := NewBatchPoints(BatchPointsConfig{Database: "mydb/autogen"})
+	if err := c.Write(bp); err != nil {
+		t.Errorf("unexpected error.  expected %v, actual %v", nil, err)
+	}
+}
+
+func TestSplitBucket(t *testing.T) {
+	tests := []struct {
+		bucket string
+		rp     string
+		db     string
+		wantRP string
+	}{
+		{bucket: "mydb", rp: "", db: "mydb", wantRP: ""},
+		{bucket: "mydb/autogen", rp: "", db: "mydb", wantRP: "autogen"},
+		{bucket: "mydb/autogen", rp: "one_week", db: "mydb", wantRP: "one_week"},
+	}
+
+	for _, tt := range tests {
+		db, rp := SplitBucket(tt.bucket, tt.rp)
+		if db != tt.db || rp != tt.wantRP {
+			t.Errorf("SplitBucket(%q, %q) = %q, %q; expected %q, %q", tt.bucket, tt.rp, db, rp, tt.db, tt.wantRP)
+		}
+	}
+}
+
 func TestClient_Ping(t *testing.T) {
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		var data Response
@@ -824,7 +942,7 @@ func TestBatchPoints_SettersGetters(t *testing.T) {
 		Precision:        "ns",
 		Database:         "db",
 		RetentionPolicy:  "rp",
-		WriteConsistency: "wc",
+		WriteConsistency: ConsistencyOne,
 	})
 	if bp.Precision() != "ns" {
 		t.Errorf("Expected: %s, got %s", bp.Precision(), "ns")
@@ -835,13 +953,13 @@ func TestBatchPoints_SettersGetters(t *testing.T) {
 	if bp.RetentionPolicy() != "rp" {
 		t.Errorf("Expected: %s, got %s", bp.RetentionPolicy(), "rp")
 	}
-	if bp.WriteConsistency() != "wc" {
-		t.Errorf("Expected: %s, got %s", bp.WriteConsistency(), "wc")
+	if bp.WriteConsistency() != ConsistencyOne {
+		t.Errorf("Expected: %s, got %s", bp.WriteConsistency(), ConsistencyOne)
 	}
 
 	bp.SetDatabase("db2")
 	bp.SetRetentionPolicy("rp2")
-	bp.SetWriteConsistency("wc2")
+	bp.SetWriteConsistency(ConsistencyQuorum)
 	err := bp.SetPrecision("s")
 	if err != nil {
 		t.Errorf("Did not expect error: %s", err.Error())
@@ -856,8 +974,69 @@ func TestBatchPoints_SettersGetters(t *testing.T) {
 	if bp.RetentionPolicy() != "rp2" {
 		t.Errorf("Expected: %s, got %s", bp.RetentionPolicy(), "rp2")
 	}
-	if bp.WriteConsistency() != "wc2" {
-		t.Errorf("Expected: %s, got %s", bp.WriteConsistency(), "wc2")
+	if bp.WriteConsistency() != ConsistencyQuorum {
+		t.Errorf("Expected: %s, got %s", bp.WriteConsistency(), ConsistencyQuorum)
+	}
+}
+
+func TestBatchPoints_WriteConsistency(t *testing.T) {
+	if _, err := NewBatchPoints(BatchPointsConfig{WriteConsistency: "wc"}); err == nil {
+		t.Errorf("WriteConsistency: wc should have errored")
+	}
+
+	var requests int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+	c, _ := NewHTTPClient(HTTPConfig{Addr: ts.URL})
+	defer c.Close()
+
+	bp, _ := NewBatchPoints(BatchPointsConfig{Database: "db", WriteConsistency: ConsistencyAll})
+	bp.SetWriteConsistency("wc2")
+	if err := c.Write(bp); err == nil {
+		t.Errorf("WriteConsistency: wc2 should have errored")
+	}
+	if n := atomic.LoadInt32(&requests); n != 0 {
+		t.Errorf("requests:\t%d\nexpected:\t%d", n, 0)
+	}
+	bp.SetWriteConsistency("")
+	if err := c.Write(bp); err != nil {
+		t.Errorf("Did not expect error: %s", err.Error())
+	}
+}
+
+func TestBatchPoints_ConvertPrecision(t *testing.T) {
+	bp, _ := NewBatchPoints(BatchPointsConfig{Precision: "ns"})
+	p0, _ := NewPoint("cpu", nil, map[string]interface{}{"value": 1.0}, time.Unix(0, 1566000000987654321))
+	p1, _ := NewPoint("cpu", nil, map[string]interface{}{"value": 2.0}, time.Unix(0, -1500000))
+	p2, _ := NewPoint("cpu", nil, map[string]interface{}{"value": 3.0})
+	bp.AddPoints([]*Point{p0, p1, p2})
+	before := []string{p0.PrecisionString("ms"), p1.PrecisionString("ms")}
+
+	if err := bp.ConvertPrecision("ms"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if bp.Precision() != "ms" {
+		t.Errorf("precision:\t%s\nexpected:\t%s", bp.Precision(), "ms")
+	}
+	/* 和 Write 一样截断，没有时间戳的点不变 */
+	expected := []int64{1566000000987000000, -1000000}
+	for i, ts := range expected {
+		if got := bp.Points()[i].UnixNano(); got != ts {
+			t.Errorf("point %d:\t%d\nexpected:\t%d", i, got, ts)
+		}
+		if got := bp.Points()[i].PrecisionString("ms"); got != before[i] {
+			t.Errorf("point %d:\t%s\nexpected:\t%s", i, got, before[i])
+		}
+	}
+	if !bp.Points()[2].Time().IsZero() {
+		t.Errorf("point 2:\t%v", bp.Points()[2].Time())
+	}
+
+	if err := bp.ConvertPrecision("days"); err == nil || bp.Precision() != "ms" {
+		t.Errorf("error:\t%v precision:\t%s", err, bp.Precision())
 	}
 }
 
@@ -943,6 +1122,82 @@ func TestClient_QueryAsChunk(t *testing.T) {
 	}
 }
 
+func TestChunkedResponse_ForEach(t *testing.T) {
+	stream := `{"results":[{"statement_id":0}]}` + "\n" + `{"results":[{"statement_id":1}]}` + "\n"
+
+	var ids []int
+	err := NewChunkedResponse(strings.NewReader(stream)).ForEach(func(r *Response) error {
+		ids = append(ids, r.Results[0].StatementId)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error.  expected %v, actual %v", nil, err)
+	}
+	if !reflect.DeepEqual(ids, []int{0, 1}) {
+		t.Errorf("statement ids:\t%v\nexpected:\t%v", ids, []int{0, 1})
+	}
+
+	/* 回调返回错误时停止读取，返回这个错误 */
+	stop := errors.New("stop")
+	calls := 0
+	err = NewChunkedResponse(strings.NewReader(stream)).ForEach(func(r *Response) error {
+		calls++
+		return stop
+	})
+	if err != stop || calls != 1 {
+		t.Errorf("unexpected error.  expected %v after 1 call, actual %v after %d calls", stop, err, calls)
+	}
+
+	/* 解码错误也会返回 */
+	err = NewChunkedResponse(strings.NewReader(`{"results":[{"statement_id":0}]}` + "\nquery interrupted")).ForEach(func(r *Response) error {
+		return nil
+	})
+	if err == nil {
+		t.Errorf("expected decoding error")
+	}
+}
+
+func TestClient_QueryTimeout(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var data Response
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		enc := json.NewEncoder(w)
+		_ = enc.Encode(data)
+		w.(http.Flusher).Flush()
+		select { // 第二个 chunk 迟迟不返回
+		case <-time.After(time.Second):
+		case <-r.Context().Done():
+		}
+		_ = enc.Encode(data)
+	}))
+	defer ts.Close()
+
+	c, _ := NewHTTPClient(HTTPConfig{Addr: ts.URL, Timeout: time.Minute})
+	defer c.Close()
+
+	query := Query{Chunked: true, Timeout: 50 * time.Millisecond}
+	start := time.Now()
+	if _, err := c.Query(query); err == nil {
+		t.Error("Query: expected timeout error")
+	}
+
+	resp, err := c.QueryAsChunk(query)
+	if err != nil {
+		t.Fatalf("unexpected error.  expected %v, actual %v", nil, err)
+	}
+	defer resp.Close()
+	if _, err := resp.NextResponse(); err != nil {
+		t.Fatalf("unexpected error.  expected %v, actual %v", nil, err)
+	}
+	if _, err := resp.NextResponse(); err == nil {
+		t.Error("QueryAsChunk: expected timeout error")
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("elapsed:\t%v", elapsed)
+	}
+}
+
 func TestClient_ReadStatementId(t *testing.T) {
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		data := Response{
@@ -997,7 +1252,7 @@ func TestSet(t *testing.T) {
 	}
 
 	for _, qs := range queryStrings {
-		err := Set(qs, c, mc)
+		err := Set(qs, DefaultClient(), DefaultCache())
 		if err != nil {
 			t.Errorf(err.Error())
 		}
@@ -1007,7 +1262,7 @@ func TestSet(t *testing.T) {
 
 func TestGetFieldKeys(t *testing.T) {
 
-	fieldKeys := GetFieldKeys(c, MyDB)
+	fieldKeys := GetFieldKeys(DefaultClient(), MyDB)
 
 	expected := make(map[string][]string)
 	expected["h2o_feet"] = []string{"level description", "water_level"}
@@ -1030,7 +1285,7 @@ func TestGetFieldKeys(t *testing.T) {
 }
 
 func TestGetTagKV(t *testing.T) {
-	measurementTagMap := GetTagKV(c, MyDB)
+	measurementTagMap := GetTagKV(DefaultClient(), MyDB)
 	expected := make(map[string][]string)
 	expected["h2o_feet"] = []string{"location"}
 	expected["h2o_pH"] = []string{"location"}
@@ -1138,13 +1393,13 @@ func TestGetSM(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			q := NewQuery(tt.queryString, MyDB, "")
-			response, err := c.Query(q)
+			response, err := DefaultClient().Query(q)
 
 			if err != nil {
 				log.Println(err)
 			}
 
-			_, tagPredicates := GetSP(tt.queryString, response, TagKV)
+			_, tagPredicates := GetSP(tt.queryString, response, CurrentSchema().TagKV)
 			SM := GetSM(response, tagPredicates)
 
 			if strings.Compare(SM, tt.expected) != 0 {
@@ -1205,8 +1460,8 @@ func TestGetSeperateSM(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			q := NewQuery(tt.queryString, MyDB, "")
-			resp, _ := c.Query(q)
-			_, tagPredicates := GetSP(tt.queryString, resp, TagKV)
+			resp, _ := DefaultClient().Query(q)
+			_, tagPredicates := GetSP(tt.queryString, resp, CurrentSchema().TagKV)
 
 			sepSM := GetSeperateSM(resp, tagPredicates)
 
@@ -1252,11 +1507,46 @@ func TestGetAggregation(t *testing.T) {
 			queryString: "SELECT MEAN(water_level) FROM h2o_feet WHERE time >= '2019-08-18T00:00:00Z' AND time <= '2019-08-18T00:30:00Z' GROUP BY time(12m)",
 			expected:    "mean",
 		},
+		{
+			name:        "distinct",
+			queryString: "SELECT DISTINCT(\"level description\") FROM h2o_feet WHERE time >= '2019-08-18T00:00:00Z' AND time <= '2019-08-18T00:30:00Z'",
+			expected:    "distinct",
+		},
+		{
+			name:        "distinct without parentheses",
+			queryString: "SELECT DISTINCT randtag FROM h2o_quality WHERE time >= '2019-08-18T00:00:00Z' AND time <= '2019-08-18T00:30:00Z'",
+			expected:    "distinct",
+		},
+		{
+			name:        "count distinct",
+			queryString: "SELECT COUNT(DISTINCT(water_level)) FROM h2o_feet WHERE time >= '2019-08-18T00:00:00Z' AND time <= '2019-08-18T00:30:00Z' GROUP BY time(12m)",
+			expected:    "count(distinct)",
+		},
+		{
+			name:        "arithmetic",
+			queryString: "SELECT (usage_user + usage_system) * 2 FROM cpu WHERE time >= '2019-08-18T00:00:00Z' AND time <= '2019-08-18T00:30:00Z'",
+			expected:    "empty",
+		},
+		{
+			name:        "percentile",
+			queryString: "SELECT PERCENTILE(water_level, 90) FROM h2o_feet WHERE time >= '2019-08-18T00:00:00Z' AND time <= '2019-08-18T00:30:00Z' GROUP BY time(12m)",
+			expected:    "percentile:90",
+		},
+		{
+			name:        "top with tag",
+			queryString: "SELECT TOP(water_level, location, 3) FROM h2o_feet WHERE time >= '2019-08-18T00:00:00Z' AND time <= '2019-08-18T00:30:00Z'",
+			expected:    "top:location:3",
+		},
+		{
+			name:        "nested moving_average",
+			queryString: "SELECT MOVING_AVERAGE(MEAN(water_level), 2) FROM h2o_feet WHERE time >= '2019-08-18T00:00:00Z' AND time <= '2019-08-18T00:30:00Z' GROUP BY time(12m)",
+			expected:    "moving_average(mean):2",
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			aggregation := GetAggregation(tt.queryString)
+			aggregation := GetAggregation(tt.queryString).String()
 			if strings.Compare(aggregation, tt.expected) != 0 {
 				t.Errorf("aggregation:%s", aggregation)
 				t.Errorf("expected:%s", tt.expected)
@@ -1302,6 +1592,36 @@ func TestGetSFSG(t *testing.T) {
 			queryString: "SELECT MEAN(water_level) FROM h2o_feet WHERE time >= '2019-08-18T00:00:00Z' AND time <= '2019-08-18T00:30:00Z' GROUP BY time(12m)",
 			expected:    []string{"water_level", "mean"},
 		},
+		{
+			name:        "distinct without parentheses",
+			queryString: "SELECT DISTINCT randtag FROM h2o_quality WHERE time >= '2019-08-18T00:00:00Z' AND time <= '2019-08-18T00:30:00Z'",
+			expected:    []string{"randtag", "distinct"},
+		},
+		{
+			name:        "arithmetic",
+			queryString: "SELECT usage_user + usage_system, usage_idle FROM cpu WHERE time >= '2019-08-18T00:00:00Z' AND time <= '2019-08-18T00:30:00Z'",
+			expected:    []string{"usage_user+usage_system,usage_idle", "empty"},
+		},
+		{
+			name:        "arithmetic with parentheses",
+			queryString: "SELECT (usage_user + usage_system) * 2 FROM cpu WHERE time >= '2019-08-18T00:00:00Z' AND time <= '2019-08-18T00:30:00Z'",
+			expected:    []string{"(usage_user+usage_system)*2", "empty"},
+		},
+		{
+			name:        "alias",
+			queryString: "SELECT water_level AS wl, location FROM h2o_feet WHERE time >= '2019-08-18T00:00:00Z' AND time <= '2019-08-18T00:30:00Z'",
+			expected:    []string{"water_level@wl,location", "empty"},
+		},
+		{
+			name:        "aggr with alias",
+			queryString: "SELECT MEAN(water_level) AS wl FROM h2o_feet WHERE time >= '2019-08-18T00:00:00Z' AND time <= '2019-08-18T00:30:00Z' GROUP BY time(12m)",
+			expected:    []string{"water_level@wl", "mean"},
+		},
+		{
+			name:        "count distinct",
+			queryString: "SELECT COUNT(DISTINCT(water_level)) FROM h2o_feet WHERE time >= '2019-08-18T00:00:00Z' AND time <= '2019-08-18T00:30:00Z' GROUP BY time(12m)",
+			expected:    []string{"water_level", "count(distinct)"},
+		},
 	}
 
 	for _, tt := range tests {
@@ -1319,6 +1639,117 @@ func TestGetSFSG(t *testing.T) {
 
 }
 
+func TestGetSFSG_Formatting(t *testing.T) {
+	tests := []struct {
+		name      string
+		formatted string
+		oneLine   string
+	}{
+		{
+			name:      "newlines and comment",
+			formatted: "SELECT MAX(water_level),\n  MIN(water_level)\nFROM h2o_feet\nWHERE location = 'coyote_creek' -- only one location\n  AND time >= '2019-08-18T00:00:00Z' AND time <= '2019-08-18T00:30:00Z'\nGROUP BY time(12m)",
+			oneLine:   "SELECT MAX(water_level),MIN(water_level) FROM h2o_feet WHERE location='coyote_creek' AND time >= '2019-08-18T00:00:00Z' AND time <= '2019-08-18T00:30:00Z' GROUP BY time(12m)",
+		},
+		{
+			name:      "nested parentheses",
+			formatted: "SELECT COUNT(DISTINCT(water_level)) FROM h2o_feet WHERE ((water_level > 5) OR (water_level < -1)) AND (time >= '2019-08-18T00:00:00Z' AND time <= '2019-08-18T00:30:00Z') GROUP BY time(12m)",
+			oneLine:   "SELECT COUNT(DISTINCT(water_level)) FROM h2o_feet WHERE (water_level > 5 OR water_level < -1) AND time >= '2019-08-18T00:00:00Z' AND time <= '2019-08-18T00:30:00Z' GROUP BY time(12m)",
+		},
+		{
+			name:      "function with several arguments",
+			formatted: "SELECT PERCENTILE(water_level, 95)\nFROM h2o_feet\nWHERE time >= '2019-08-18T00:00:00Z' AND time <= '2019-08-18T00:30:00Z'",
+			oneLine:   "SELECT PERCENTILE(water_level,95) FROM h2o_feet WHERE time >= '2019-08-18T00:00:00Z' AND time <= '2019-08-18T00:30:00Z'",
+		},
+	}
+
+	/* 换行、注释和多余的括号不影响结果 */
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if a, b := GetAggregation(tt.formatted).String(), GetAggregation(tt.oneLine).String(); a != b || a == "error" {
+				t.Errorf("aggregation:\t%s\nexpected:\t%s", a, b)
+			}
+			sf, sg := GetSFSG(tt.formatted)
+			expectedSF, expectedSG := GetSFSG(tt.oneLine)
+			if sf != expectedSF || sg != expectedSG {
+				t.Errorf("SF, SG:\t%s %s\nexpected:\t%s %s", sf, sg, expectedSF, expectedSG)
+			}
+			if a, b := GetSPST(tt.formatted), GetSPST(tt.oneLine); a != b {
+				t.Errorf("SPST:\t%s\nexpected:\t%s", a, b)
+			}
+		})
+	}
+
+	if sf, sg := GetSFSG(tests[0].formatted); sf != "water_level,water_level" || sg != "max|min" {
+		t.Errorf("SF, SG:\t%s %s\nexpected:\t%s %s", sf, sg, "water_level,water_level", "max|min")
+	}
+	if sf, sg := GetSFSG(tests[2].formatted); sf != "water_level" || sg != "percentile:95" {
+		t.Errorf("SF, SG:\t%s %s\nexpected:\t%s %s", sf, sg, "water_level", "percentile:95")
+	}
+	if spst := GetSPST(tests[1].formatted); !strings.Contains(spst, "(water_level<-1[") || !strings.Contains(spst, "(water_level>5[") {
+		t.Errorf("SPST:\t%s", spst)
+	}
+}
+
+func TestAggregation(t *testing.T) {
+	tests := []struct {
+		name        string
+		queryString string
+		expected    Aggregation
+	}{
+		{
+			name:        "without aggregation",
+			queryString: "SELECT water_level FROM h2o_feet WHERE time >= '2019-08-18T00:00:00Z' AND time <= '2019-08-18T00:30:00Z'",
+			expected:    Aggregation{FillMode: "null"},
+		},
+		{
+			name:        "fill none",
+			queryString: "SELECT MAX(water_level) FROM h2o_feet WHERE time >= '2019-08-18T00:00:00Z' AND time <= '2019-08-18T00:30:00Z' GROUP BY time(12m) fill(none)",
+			expected:    Aggregation{Func: "max", FillMode: "none"},
+		},
+		{
+			name:        "fill number",
+			queryString: "SELECT COUNT(water_level) FROM h2o_feet WHERE time >= '2019-08-18T00:00:00Z' AND time <= '2019-08-18T00:30:00Z' GROUP BY time(12m) fill(-1)",
+			expected:    Aggregation{Func: "count", FillMode: "-1"},
+		},
+		{
+			name:        "percentile with fraction",
+			queryString: "SELECT PERCENTILE(water_level, 99.5) FROM h2o_feet WHERE time >= '2019-08-18T00:00:00Z' AND time <= '2019-08-18T00:30:00Z' GROUP BY time(12m) fill(previous)",
+			expected:    Aggregation{Func: "percentile", Args: []string{"99.5"}, FillMode: "previous"},
+		},
+		{
+			name:        "moving_average of mean",
+			queryString: "SELECT MOVING_AVERAGE(MEAN(water_level), 2) FROM h2o_feet WHERE time >= '2019-08-18T00:00:00Z' AND time <= '2019-08-18T00:30:00Z' GROUP BY time(12m) fill(linear)",
+			expected:    Aggregation{Func: "moving_average(mean)", Args: []string{"2"}, FillMode: "linear"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := GetAggregation(tt.queryString)
+			if !reflect.DeepEqual(a, tt.expected) {
+				t.Errorf("aggregation:\t%#v\nexpected:\t%#v", a, tt.expected)
+			}
+			/* SG 中的写法可以还原出函数名和参数 */
+			parsed := ParseAggregation(a.String())
+			if parsed.Func != a.Func || !reflect.DeepEqual(parsed.Args, a.Args) {
+				t.Errorf("parsed:\t%#v\nexpected:\t%#v", parsed, a)
+			}
+		})
+	}
+
+	/* 参数中的分隔符被转义 */
+	a := Aggregation{Func: "top", Args: []string{"level description", "3"}}
+	if s := a.String(); s != "top:level%20description:3" {
+		t.Errorf("SG:\t%s\nexpected:\t%s", s, "top:level%20description:3")
+	}
+	if parsed := ParseAggregation(a.String()); !reflect.DeepEqual(parsed, a) {
+		t.Errorf("parsed:\t%#v\nexpected:\t%#v", parsed, a)
+	}
+	if column := aggregationColumn("moving_average(mean):2"); column != "moving_average" {
+		t.Errorf("column:\t%s\nexpected:\t%s", column, "moving_average")
+	}
+}
+
 func TestGetSFSGWithDataType(t *testing.T) {
 
 	tests := []struct {
@@ -1366,7 +1797,7 @@ func TestGetSFSGWithDataType(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			q := NewQuery(tt.queryString, MyDB, "ns")
-			resp, err := c.Query(q)
+			resp, err := DefaultClient().Query(q)
 			if err != nil {
 				t.Fatalf(err.Error())
 			}
@@ -1386,6 +1817,210 @@ func TestGetSFSGWithDataType(t *testing.T) {
 
 }
 
+func TestDistinctSemanticSegment(t *testing.T) {
+	tests := []struct {
+		name        string
+		queryString string
+		resp        *Response
+		sfsg        string
+		columns     []string
+	}{
+		{
+			name:        "distinct",
+			queryString: "SELECT DISTINCT(randtag) FROM h2o_quality WHERE time >= '2019-08-18T00:00:00Z' AND time <= '2019-08-18T00:30:00Z'",
+			resp: &Response{Results: []Result{{Series: []models.Row{{
+				Name:    "h2o_quality",
+				Columns: []string{"time", "distinct"},
+				Values:  [][]interface{}{{json.Number("1566086400000000000"), "1"}, {json.Number("1566086400000000000"), "3"}},
+			}}}}},
+			sfsg:    "#{randtag[string]}#{empty}#{distinct,empty}",
+			columns: []string{"time", "distinct"},
+		},
+		{
+			name:        "count distinct",
+			queryString: "SELECT COUNT(DISTINCT(water_level)) FROM h2o_feet WHERE time >= '2019-08-18T00:00:00Z' AND time <= '2019-08-18T00:30:00Z' GROUP BY time(12m)",
+			resp: &Response{Results: []Result{{Series: []models.Row{{
+				Name:    "h2o_feet",
+				Columns: []string{"time", "count"},
+				Values:  [][]interface{}{{json.Number("1566086400000000000"), json.Number("3")}},
+			}}}}},
+			sfsg:    "#{water_level[int64]}#{empty}#{count(distinct),12m}",
+			columns: []string{"time", "count"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			segment := SemanticSegment(tt.queryString, tt.resp)
+			if !strings.HasSuffix(segment, tt.sfsg) {
+				t.Errorf("segment:\t%s\nexpected suffix:\t%s", segment, tt.sfsg)
+			}
+			/* 存入cache再取出，列名不变 */
+			byteArray := append(tt.resp.ToByteArray(tt.queryString), []byte("\r\n")...)
+			converted := ByteArrayToResponse(byteArray)
+			if columns := converted.Results[0].Series[0].Columns; !reflect.DeepEqual(columns, tt.columns) {
+				t.Errorf("columns:\t%v\nexpected:\t%v", columns, tt.columns)
+			}
+		})
+	}
+}
+
+func TestArithmeticSemanticSegment(t *testing.T) {
+	queryString := "SELECT usage_user + usage_system, usage_idle FROM cpu WHERE time >= '2019-08-18T00:00:00Z' AND time <= '2019-08-18T00:30:00Z'"
+	resp := &Response{Results: []Result{{Series: []models.Row{{
+		Name:    "cpu",
+		Columns: []string{"time", "usage_user_usage_system", "usage_idle"},
+		Values:  [][]interface{}{{json.Number("1566086400000000000"), json.Number("12.5"), json.Number("87.5")}},
+	}}}}}
+
+	sf, aggr := GetSFSGWithDataType(queryString, resp)
+	if sf != "usage_user+usage_system[float64],usage_idle[float64]" || aggr != "empty" {
+		t.Errorf("fields:\t%s\naggregation:\t%s", sf, aggr)
+	}
+
+	/* 存入cache再取出，列名和 InfluxDB 返回的相同 */
+	byteArray := append(resp.ToByteArray(queryString), []byte("\r\n")...)
+	converted := ByteArrayToResponse(byteArray)
+	if columns := converted.Results[0].Series[0].Columns; !reflect.DeepEqual(columns, resp.Results[0].Series[0].Columns) {
+		t.Errorf("columns:\t%v\nexpected:\t%v", columns, resp.Results[0].Series[0].Columns)
+	}
+}
+
+func TestAliasSemanticSegment(t *testing.T) {
+	tests := []struct {
+		name        string
+		queryString string
+		columns     []string
+		sf          string
+	}{
+		{
+			name:        "raw data",
+			queryString: "SELECT water_level AS wl, index FROM h2o_feet WHERE time >= '2019-08-18T00:00:00Z' AND time <= '2019-08-18T00:30:00Z'",
+			columns:     []string{"time", "wl", "index"},
+			sf:          "water_level@wl[float64],index[int64]",
+		},
+		{
+			name:        "aggregation",
+			queryString: "SELECT MEAN(water_level) AS wl, MAX(index) FROM h2o_feet WHERE time >= '2019-08-18T00:00:00Z' AND time <= '2019-08-18T00:30:00Z' GROUP BY time(12m)",
+			columns:     []string{"time", "wl", "max"},
+			sf:          "water_level@wl[float64],index[int64]",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &Response{Results: []Result{{Series: []models.Row{{
+				Name:    "h2o_feet",
+				Columns: tt.columns,
+				Values:  [][]interface{}{{json.Number("1566086400000000000"), json.Number("8.5"), json.Number("85")}},
+			}}}}}
+			if sf, _ := GetSFSGWithDataType(tt.queryString, resp); sf != tt.sf {
+				t.Errorf("fields:\t%s\nexpected:\t%s", sf, tt.sf)
+			}
+
+			/* 存入cache再取出，列名是别名 */
+			byteArray := append(resp.ToByteArray(tt.queryString), []byte("\r\n")...)
+			converted := ByteArrayToResponse(byteArray)
+			if columns := converted.Results[0].Series[0].Columns; !reflect.DeepEqual(columns, tt.columns) {
+				t.Errorf("columns:\t%v\nexpected:\t%v", columns, tt.columns)
+			}
+		})
+	}
+}
+
+func TestTypeSelectorSemanticSegment(t *testing.T) {
+	defer SetSchema(SetSchema(&Schema{
+		Fields: map[string][]string{"h2o_feet": {"index", "water_level"}},
+		TagKV: MeasurementTagMap{Measurement: map[string][]TagKeyMap{
+			"h2o_feet": {{Tag: map[string]TagValues{"location": {Values: []string{"coyote_creek", "santa_monica"}}}}},
+		}},
+	}))
+
+	tests := []struct {
+		name        string
+		queryString string
+		columns     []string
+		sf          string
+		flds        string
+	}{
+		{
+			name:        "tag selector",
+			queryString: "SELECT location::tag, water_level FROM h2o_feet WHERE time >= '2019-08-18T00:00:00Z' AND time <= '2019-08-18T00:30:00Z'",
+			columns:     []string{"time", "location", "water_level"},
+			sf:          "location::tag[string],water_level[float64]",
+			flds:        "location::tag,water_level",
+		},
+		{
+			name:        "field selector",
+			queryString: "SELECT location::tag, water_level::field FROM h2o_feet WHERE time >= '2019-08-18T00:00:00Z' AND time <= '2019-08-18T00:30:00Z'",
+			columns:     []string{"time", "location", "water_level"},
+			sf:          "location::tag[string],water_level[float64]",
+			flds:        "location::tag,water_level",
+		},
+		{
+			name:        "tag selector with alias",
+			queryString: "SELECT location::tag AS loc, water_level FROM h2o_feet WHERE time >= '2019-08-18T00:00:00Z' AND time <= '2019-08-18T00:30:00Z'",
+			columns:     []string{"time", "loc", "water_level"},
+			sf:          "location::tag@loc[string],water_level[float64]",
+			flds:        "location::tag@loc,water_level",
+		},
+		{
+			name:        "field wildcard",
+			queryString: "SELECT *::field FROM h2o_feet WHERE time >= '2019-08-18T00:00:00Z' AND time <= '2019-08-18T00:30:00Z'",
+			columns:     []string{"time", "index", "water_level"},
+			sf:          "index[int64],water_level[float64]",
+			flds:        "index,water_level",
+		},
+		{
+			name:        "wildcard",
+			queryString: "SELECT * FROM h2o_feet WHERE time >= '2019-08-18T00:00:00Z' AND time <= '2019-08-18T00:30:00Z'",
+			columns:     []string{"time", "index", "location", "water_level"},
+			sf:          "index[int64],location[string],water_level[float64]",
+			flds:        "index,location,water_level",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &Response{Results: []Result{{Series: []models.Row{{
+				Name:    "h2o_feet",
+				Columns: tt.columns,
+				Values:  [][]interface{}{typeSelectorRow(tt.columns)},
+			}}}}}
+			if sf, _ := GetSFSGWithDataType(tt.queryString, resp); sf != tt.sf {
+				t.Errorf("fields:\t%s\nexpected:\t%s", sf, tt.sf)
+			}
+			if flds, _ := GetSFSG(tt.queryString); flds != tt.flds {
+				t.Errorf("flds:\t%s\nexpected:\t%s", flds, tt.flds)
+			}
+		})
+	}
+
+	/* 类型选择符不是列名的一部分 */
+	for name, expected := range map[string]string{"location::tag": "location", "location::tag@loc": "loc", "water_level": "water_level"} {
+		if column := sfColumnName(name); column != expected {
+			t.Errorf("column:\t%s\nexpected:\t%s", column, expected)
+		}
+	}
+
+	/* 没有类型选择符时按 schema 判断是否是 tag */
+	for name, expected := range map[string]bool{"location": true, "location::field": false, "water_level": false, "water_level::tag": true} {
+		if isTag := isTagColumn("h2o_feet", name); isTag != expected {
+			t.Errorf("%s is tag:\t%v\nexpected:\t%v", name, isTag, expected)
+		}
+	}
+}
+
+// typeSelectorRow 按列名构造 h2o_feet 的一行数据
+func typeSelectorRow(columns []string) []interface{} {
+	values := map[string]interface{}{"time": json.Number("1566086400000000000"), "index": json.Number("85"), "location": "coyote_creek", "loc": "coyote_creek", "water_level": json.Number("8.5")}
+	row := make([]interface{}, len(columns))
+	for i, c := range columns {
+		row[i] = values[c]
+	}
+	return row
+}
+
 func TestGetInterval(t *testing.T) {
 	tests := []struct {
 		name        string
@@ -1438,6 +2073,41 @@ func TestGetInterval(t *testing.T) {
 			queryString: "SELECT MAX(water_level) FROM h2o_feet WHERE location='coyote_creek' AND time >= '2015-09-18T16:00:00Z' AND time <= '2015-09-18T16:42:00Z' GROUP BY time(12h)",
 			expected:    "12h",
 		},
+		{
+			name:        "time() with offset",
+			queryString: "SELECT MAX(water_level) FROM h2o_feet WHERE time >= '2019-08-18T00:00:00Z' AND time <= '2019-08-18T00:30:00Z' GROUP BY time(12m,6m)",
+			expected:    "12m,6m",
+		},
+		{
+			name:        "negative offset",
+			queryString: "SELECT MAX(water_level) FROM h2o_feet WHERE time >= '2019-08-18T00:00:00Z' AND time <= '2019-08-18T00:30:00Z' GROUP BY time(12m,-6m)",
+			expected:    "12m,6m",
+		},
+		{
+			name:        "offset of whole intervals",
+			queryString: "SELECT MAX(water_level) FROM h2o_feet WHERE time >= '2019-08-18T00:00:00Z' AND time <= '2019-08-18T00:30:00Z' GROUP BY time(12m,24m)",
+			expected:    "12m",
+		},
+		{
+			name:        "week",
+			queryString: "SELECT MAX(water_level) FROM h2o_feet WHERE time >= '2019-08-18T00:00:00Z' AND time <= '2019-09-18T00:00:00Z' GROUP BY time(1w)",
+			expected:    "168h",
+		},
+		{
+			name:        "day with offset",
+			queryString: "SELECT MAX(water_level) FROM h2o_feet WHERE time >= '2019-08-18T00:00:00Z' AND time <= '2019-09-18T00:00:00Z' GROUP BY time(1d,90m)",
+			expected:    "24h,1h30m",
+		},
+		{
+			name:        "zero unit in the middle",
+			queryString: "SELECT MAX(water_level) FROM h2o_feet WHERE time >= '2019-08-18T00:00:00Z' AND time <= '2019-08-18T00:30:00Z' GROUP BY time(3630s)",
+			expected:    "1h30s",
+		},
+		{
+			name:        "milliseconds",
+			queryString: "SELECT MAX(water_level) FROM h2o_feet WHERE time >= '2019-08-18T00:00:00Z' AND time <= '2019-08-18T00:30:00Z' GROUP BY time(60500ms)",
+			expected:    "1m500ms",
+		},
 	}
 
 	for _, tt := range tests {
@@ -1450,6 +2120,22 @@ func TestGetInterval(t *testing.T) {
 	}
 }
 
+func TestFormatInterval(t *testing.T) {
+	/* 同一个区间的写法相同，可以用 time.ParseDuration 还原 */
+	intervals := []time.Duration{time.Nanosecond, 1500 * time.Microsecond, 90 * time.Second, time.Hour + 30*time.Second,
+		time.Hour + 30*time.Minute, 24 * time.Hour, 7 * 24 * time.Hour, 7*24*time.Hour + time.Millisecond}
+	for _, interval := range intervals {
+		s := formatInterval(interval)
+		d, err := time.ParseDuration(s)
+		if err != nil || d != interval {
+			t.Errorf("interval:\t%s -> %s -> %v\nexpected:\t%s", interval, s, d, interval)
+		}
+	}
+	if s := formatInterval(time.Hour + 30*time.Second); s != "1h30s" {
+		t.Errorf("interval:\t%s\nexpected:\t%s", s, "1h30s")
+	}
+}
+
 func TestGetBinaryExpr(t *testing.T) {
 	tests := []struct {
 		name       string
@@ -1502,7 +2188,7 @@ func TestPreOrderTraverseBinaryExpr(t *testing.T) {
 		{
 			name:             "complex situation",
 			binaryExprString: "location <> 'santa_monica' AND (water_level < -0.59 OR water_level > 9.95)",
-			expected:         [][]string{{"location", "location!='santa_monica'", "string"}, {"water_level", "water_level<-0.590", "float64"}, {"water_level", "water_level>9.950", "float64"}},
+			expected:         [][]string{{"location", "location!='santa_monica'", "string"}, {"water_level", "water_level<-0.59", "float64"}, {"water_level", "water_level>9.95", "float64"}},
 		},
 	}
 
@@ -1554,13 +2240,13 @@ func TestGetSP(t *testing.T) {
 		{
 			name:         "three conditions(OR)",
 			queryString:  "SELECT water_level FROM h2o_feet WHERE location != 'santa_monica' AND (water_level < -0.59 OR water_level > 9.95)",
-			expected:     "{(water_level<-0.590[float64])(water_level>9.950[float64])}",
+			expected:     "{((water_level<-0.59[float64])|(water_level>9.95[float64]))}",
 			expectedTags: []string{"location!=santa_monica"},
 		},
 		{
 			name:         "three conditions and time range",
 			queryString:  "SELECT water_level FROM h2o_feet WHERE location <> 'santa_monica' AND (water_level > -0.59 AND water_level < 9.95) AND time >= '2019-08-18T00:00:00Z' AND time <= '2019-08-18T00:30:00Z' GROUP BY location",
-			expected:     "{(water_level>-0.590[float64])(water_level<9.950[float64])}",
+			expected:     "{(water_level<9.95[float64])(water_level>-0.59[float64])}",
 			expectedTags: []string{"location!=santa_monica"},
 		},
 	}
@@ -1568,8 +2254,8 @@ func TestGetSP(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			q := NewQuery(tt.queryString, MyDB, "ns")
-			resp, _ := c.Query(q)
-			SP, tags := GetSP(tt.queryString, resp, TagKV)
+			resp, _ := DefaultClient().Query(q)
+			SP, tags := GetSP(tt.queryString, resp, CurrentSchema().TagKV)
 			//fmt.Println(SP)
 			if strings.Compare(SP, tt.expected) != 0 {
 				t.Errorf("SP:\t%s\nexpected:\t%s", SP, tt.expected)
@@ -1584,6 +2270,101 @@ func TestGetSP(t *testing.T) {
 
 }
 
+func TestCanonicalPredicates(t *testing.T) {
+	tests := []struct {
+		name        string
+		queryString string
+		expected    string
+	}{
+		{
+			name:        "predicates in different order",
+			queryString: "SELECT index FROM h2o_quality WHERE index>=50 AND randtag='2' AND time >= '2019-08-18T00:00:00Z' AND time <= '2019-08-18T00:30:00Z'",
+			expected:    "{(index>=50[int64])(randtag='2'[string])}#{1566086400000000000,1566088200000000000}",
+		},
+		{
+			name:        "different order and spacing",
+			queryString: "SELECT index FROM h2o_quality WHERE randtag = '2' AND index >= 50 AND time >= '2019-08-18T00:00:00Z' AND time <= '2019-08-18T00:30:00Z'",
+			expected:    "{(index>=50[int64])(randtag='2'[string])}#{1566086400000000000,1566088200000000000}",
+		},
+		{
+			name:        "constant on the left",
+			queryString: "SELECT index FROM h2o_quality WHERE 50 <= index AND '2' = randtag AND time >= '2019-08-18T00:00:00Z' AND time <= '2019-08-18T00:30:00Z'",
+			expected:    "{(index>=50[int64])(randtag='2'[string])}#{1566086400000000000,1566088200000000000}",
+		},
+		{
+			name:        "duplicate predicates",
+			queryString: "SELECT index FROM h2o_quality WHERE index >= 50 AND (randtag = '2' AND index >= 50) AND time >= '2019-08-18T00:00:00Z' AND time <= '2019-08-18T00:30:00Z'",
+			expected:    "{(index>=50[int64])(randtag='2'[string])}#{1566086400000000000,1566088200000000000}",
+		},
+		{
+			name:        "AND groups inside OR",
+			queryString: "SELECT index FROM h2o_quality WHERE ((index>1 AND index<5) OR (index>10 AND index<20)) AND time >= '2019-08-18T00:00:00Z' AND time <= '2019-08-18T00:30:00Z'",
+			expected:    "{((index<5[int64])(index>1[int64])|(index<20[int64])(index>10[int64]))}#{1566086400000000000,1566088200000000000}",
+		},
+		{
+			name:        "same predicates grouped differently",
+			queryString: "SELECT index FROM h2o_quality WHERE ((index>1 AND index<20) OR (index>10 AND index<5)) AND time >= '2019-08-18T00:00:00Z' AND time <= '2019-08-18T00:30:00Z'",
+			expected:    "{((index<20[int64])(index>1[int64])|(index<5[int64])(index>10[int64]))}#{1566086400000000000,1566088200000000000}",
+		},
+		{
+			name:        "OR is not a conjunction",
+			queryString: "SELECT index FROM h2o_quality WHERE index < 5 OR index > 10",
+			expected:    "{((index<5[int64])|(index>10[int64]))}#{empty,empty}",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if SPST := GetSPST(tt.queryString); SPST != tt.expected {
+				t.Errorf("SPST:\t%s\nexpected:\t%s", SPST, tt.expected)
+			}
+		})
+	}
+
+	/* GetSP 中 tag 的谓词放在 SM 中，其他谓词的顺序也和查询中的顺序无关 */
+	resp := &Response{Results: []Result{{Series: []models.Row{{Name: "h2o_quality", Columns: []string{"time", "index"}}}}}}
+	resp.Results[0].Series[0].Values = [][]interface{}{{json.Number("1566086400000000000"), json.Number("50")}}
+	SP1, _ := GetSP("SELECT index FROM h2o_quality WHERE index >= 50 AND index < 90", resp, MeasurementTagMap{})
+	SP2, _ := GetSP("SELECT index FROM h2o_quality WHERE 90 > index AND index >= 50", resp, MeasurementTagMap{})
+	if SP1 != SP2 || SP1 != "{(index<90[int64])(index>=50[int64])}" {
+		t.Errorf("SP:\t%s\nexpected:\t%s", SP2, SP1)
+	}
+}
+
+func TestPredicateFieldTypes(t *testing.T) {
+	defer SetSchema(SetSchema(&Schema{FieldTypes: map[string]map[string]string{"h2o_feet": {"water_level": "float64", "level": "string"}}}))
+	tagMap := MeasurementTagMap{Measurement: map[string][]TagKeyMap{
+		"h2o_feet": {{Tag: map[string]TagValues{"location": {Values: []string{"coyote_creek"}}, "level": {Values: []string{"high"}}}}},
+	}}
+
+	/* float field 和整数常量比较时类型是 float64，和 8.0 的谓词相同 */
+	if SPST := GetSPST("SELECT water_level FROM h2o_feet WHERE water_level > 8"); SPST != "{(water_level>8[float64])}#{empty,empty}" {
+		t.Errorf("SPST:\t%s", SPST)
+	}
+	if SPST := GetSPST("SELECT water_level FROM h2o_feet WHERE water_level > 8.0"); SPST != "{(water_level>8[float64])}#{empty,empty}" {
+		t.Errorf("SPST:\t%s", SPST)
+	}
+
+	/* 和 tag 同名的 field 的谓词在 SP 中，tag 的谓词在 SM 中 */
+	resp := &Response{Results: []Result{{Series: []models.Row{{
+		Name:    "h2o_feet",
+		Columns: []string{"time", "water_level"},
+		Values:  [][]interface{}{{json.Number("1566086400000000000"), json.Number("8.12")}},
+	}}}}}
+	SP, tags := GetSP("SELECT water_level FROM h2o_feet WHERE level = 'high' AND location = 'coyote_creek' AND water_level > 8", resp, tagMap)
+	if SP != "{(level='high'[string])(water_level>8[float64])}" {
+		t.Errorf("SP:\t%s", SP)
+	}
+	if !reflect.DeepEqual(tags, []string{"location=coyote_creek"}) {
+		t.Errorf("tags:\t%v", tags)
+	}
+
+	/* 没有记录类型的表按常量的写法推断 */
+	if SPST := GetSPST("SELECT index FROM h2o_quality WHERE index > 8"); SPST != "{(index>8[int64])}#{empty,empty}" {
+		t.Errorf("SPST:\t%s", SPST)
+	}
+}
+
 func TestGetSPST(t *testing.T) {
 	tests := []struct {
 		name        string
@@ -1673,17 +2454,22 @@ func TestGetSPST(t *testing.T) {
 		{
 			name:        "three conditions and time range with GROUP BY",
 			queryString: "SELECT index FROM h2o_quality WHERE location='coyote_creek' AND randtag='2' AND index>=50 AND time >= '2019-08-18T00:00:00Z' AND time <= '2019-08-18T00:30:00Z' GROUP BY location",
-			expected:    "{(location='coyote_creek'[string])(randtag='2'[string])(index>=50[int64])}#{1566086400000000000,1566088200000000000}",
+			expected:    "{(index>=50[int64])(location='coyote_creek'[string])(randtag='2'[string])}#{1566086400000000000,1566088200000000000}",
 		},
 		{
 			name:        "three conditions(OR)",
 			queryString: "SELECT water_level FROM h2o_feet WHERE location <> 'santa_monica' AND (water_level < -0.59 OR water_level > 9.95)",
-			expected:    "{(location!='santa_monica'[string])(water_level<-0.590[float64])(water_level>9.950[float64])}#{empty,empty}",
+			expected:    "{((water_level<-0.59[float64])|(water_level>9.95[float64]))(location!='santa_monica'[string])}#{empty,empty}",
 		},
 		{
 			name:        "three conditions(OR) and time range",
 			queryString: "SELECT water_level FROM h2o_feet WHERE location <> 'santa_monica' AND (water_level < -0.59 OR water_level > 9.95) AND time >= '2019-08-18T00:00:00Z' AND time <= '2019-08-18T00:30:00Z' GROUP BY location",
-			expected:    "{(location!='santa_monica'[string])(water_level<-0.590[float64])(water_level>9.950[float64])}#{1566086400000000000,1566088200000000000}",
+			expected:    "{((water_level<-0.59[float64])|(water_level>9.95[float64]))(location!='santa_monica'[string])}#{1566086400000000000,1566088200000000000}",
+		},
+		{
+			name:        "float literals keep full precision",
+			queryString: "SELECT water_level FROM h2o_feet WHERE water_level < -0.5901 AND water_level > 8.0 AND water_level * 1.25 < 10",
+			expected:    "{(water_level*1.25<10[float64])(water_level<-0.5901[float64])(water_level>8[float64])}#{empty,empty}",
 		},
 	}
 
@@ -1698,6 +2484,94 @@ func TestGetSPST(t *testing.T) {
 
 }
 
+func TestGetQueryTimeRange(t *testing.T) {
+	tests := []struct {
+		name        string
+		queryString string
+		start, end  int64
+		relative    bool
+	}{
+		{
+			name:        "without WHERE clause",
+			queryString: "SELECT index FROM h2o_quality",
+			start:       -1,
+			end:         -1,
+		},
+		{
+			name:        "RFC3339 time range",
+			queryString: "SELECT index FROM h2o_quality WHERE location='coyote_creek' AND time >= '2019-08-18T00:00:00Z' AND time <= '2019-08-18T00:30:00Z' GROUP BY randtag",
+			start:       1566086400000000000,
+			end:         1566088200000000000,
+		},
+		{
+			name:        "fractional seconds and timezone offset",
+			queryString: "SELECT index FROM h2o_quality WHERE time >= '2019-08-18T08:00:00.123456789+08:00' AND time <= '2019-08-18T00:30:00.5Z'",
+			start:       1566086400123456789,
+			end:         1566088200500000000,
+		},
+		{
+			name:        "nanosecond epoch literals",
+			queryString: "SELECT index FROM h2o_quality WHERE time >= 1566086400000000000 AND time <= 1566088200000000000",
+			start:       1566086400000000000,
+			end:         1566088200000000000,
+		},
+		{
+			name:        "epoch literals in seconds and milliseconds",
+			queryString: "SELECT index FROM h2o_quality WHERE time >= 1566086400s AND time < 1566088200000ms",
+			start:       1566086400000000000,
+			end:         1566088199999999999,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, end, relative := GetQueryTimeRange(tt.queryString)
+			if start != tt.start || end != tt.end || relative != tt.relative {
+				t.Errorf("range:\t%d %d %v\nexpected:\t%d %d %v", start, end, relative, tt.start, tt.end, tt.relative)
+			}
+		})
+	}
+}
+
+func TestGetQueryTimeRange_Relative(t *testing.T) {
+	tests := []struct {
+		name        string
+		queryString string
+		ago         time.Duration // 下界距离当前时间
+		length      time.Duration // 时间范围的长度
+	}{
+		{
+			name:        "now() arithmetic",
+			queryString: "SELECT index FROM h2o_quality WHERE time >= now() - 1h + 5m AND time <= now()",
+			ago:         55 * time.Minute,
+			length:      55 * time.Minute,
+		},
+		{
+			name:        "without upper bound",
+			queryString: "SELECT index FROM h2o_quality WHERE time >= now() - 2h",
+			ago:         2 * time.Hour,
+			length:      2 * time.Hour,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := time.Now().UnixNano()
+			start, end, relative := GetQueryTimeRange(tt.queryString)
+			after := time.Now().UnixNano()
+			if !relative {
+				t.Error("expected relative time range")
+			}
+			if start < before-int64(tt.ago) || start > after-int64(tt.ago) {
+				t.Errorf("start:\t%d\nexpected:\t%d", start, before-int64(tt.ago))
+			}
+			if end-start != int64(tt.length) {
+				t.Errorf("length:\t%v\nexpected:\t%v", time.Duration(end-start), tt.length)
+			}
+		})
+	}
+}
+
 func TestSemanticSegmentInstance(t *testing.T) {
 	tests := []struct {
 		name        string
@@ -1782,18 +2656,18 @@ func TestSemanticSegmentInstance(t *testing.T) {
 		{
 			name:        "6 1-1-T",
 			queryString: "select usage_guest from test..cpu where time >= '2022-01-01T09:00:00Z' and time < '2022-01-01T10:00:00Z' and hostname='host_0' and usage_guest > 99.0",
-			expected:    "{(cpu.hostname=host_0)}#{usage_guest[float64]}#{(usage_guest>99.000[float64])}#{empty,empty}",
+			expected:    "{(cpu.hostname=host_0)}#{usage_guest[float64]}#{(usage_guest>99[float64])}#{empty,empty}",
 		},
 		{
 			name:        "t7-1",
 			queryString: "select usage_guest from test..cpu where time >= '2022-01-01T17:50:00Z' and time < '2022-01-01T18:00:00Z' and usage_guest > 99.0 group by hostname",
-			expected:    "{(cpu.hostname=host_2)}#{usage_guest[float64]}#{(usage_guest>99.000[float64])}#{empty,empty}",
+			expected:    "{(cpu.hostname=host_2)}#{usage_guest[float64]}#{(usage_guest>99[float64])}#{empty,empty}",
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			query := NewQuery(tt.queryString, MyDB, "ns")
-			resp, err := c.Query(query)
+			resp, err := DefaultClient().Query(query)
 			if err != nil {
 				fmt.Println(err)
 			}
@@ -1836,22 +2710,22 @@ func TestSemanticSegmentDBTest(t *testing.T) {
 		{
 			name:        "5",
 			queryString: "SELECT usage_steal,usage_guest,usage_user FROM cpu WHERE rack = '4' AND usage_user > 30.0 AND usage_steal < 90 GROUP BY service,team limit 10",
-			expected:    "{(cpu.rack=4,cpu.service=18,cpu.team=CHI)}#{usage_steal[float64],usage_guest[float64],usage_user[float64]}#{(usage_user>30.000[float64])(usage_steal<90[int64])}#{empty,empty}",
+			expected:    "{(cpu.rack=4,cpu.service=18,cpu.team=CHI)}#{usage_steal[float64],usage_guest[float64],usage_user[float64]}#{(usage_steal<90[int64])(usage_user>30[float64])}#{empty,empty}",
 		},
 		{
 			name:        "6",
 			queryString: "SELECT MEAN(usage_steal) FROM cpu WHERE rack = '4' AND usage_user > 30.0 AND usage_steal < 90 GROUP BY service,team,time(1m) limit 10",
-			expected:    "{(cpu.rack=4,cpu.service=18,cpu.team=CHI)}#{usage_steal[float64]}#{(usage_user>30.000[float64])(usage_steal<90[int64])}#{mean,1m}",
+			expected:    "{(cpu.rack=4,cpu.service=18,cpu.team=CHI)}#{usage_steal[float64]}#{(usage_steal<90[int64])(usage_user>30[float64])}#{mean,1m}",
 		},
 		{
 			name:        "7", // 11.8s 运行所需时间长是由于向数据库查询的时间长，不是客户端的问题，客户端生成语义段只用到了查询结果的表结构，不需要遍历表里的数据
 			queryString: "SELECT MAX(usage_steal) FROM cpu WHERE usage_steal < 90.0 GROUP BY service,team,time(1m) limit 10",
-			expected:    "{(cpu.service=18,cpu.team=CHI)(cpu.service=2,cpu.team=LON)(cpu.service=4,cpu.team=NYC)(cpu.service=6,cpu.team=NYC)}#{usage_steal[float64]}#{(usage_steal<90.000[float64])}#{max,1m}",
+			expected:    "{(cpu.service=18,cpu.team=CHI)(cpu.service=2,cpu.team=LON)(cpu.service=4,cpu.team=NYC)(cpu.service=6,cpu.team=NYC)}#{usage_steal[float64]}#{(usage_steal<90[float64])}#{max,1m}",
 		},
 		{
 			name:        "8",
 			queryString: "SELECT usage_steal,usage_nice,usage_iowait FROM cpu WHERE usage_steal < 90.0 AND time > '2022-01-01T00:00:00Z' AND time < '2022-05-01T00:00:00Z' GROUP BY service,team limit 10",
-			expected:    "{(cpu.service=18,cpu.team=CHI)(cpu.service=2,cpu.team=LON)(cpu.service=4,cpu.team=NYC)(cpu.service=6,cpu.team=NYC)}#{usage_steal[float64],usage_nice[float64],usage_iowait[float64]}#{(usage_steal<90.000[float64])}#{empty,empty}",
+			expected:    "{(cpu.service=18,cpu.team=CHI)(cpu.service=2,cpu.team=LON)(cpu.service=4,cpu.team=NYC)(cpu.service=6,cpu.team=NYC)}#{usage_steal[float64],usage_nice[float64],usage_iowait[float64]}#{(usage_steal<90[float64])}#{empty,empty}",
 		},
 		{
 			name:        "9",
@@ -1861,28 +2735,28 @@ func TestSemanticSegmentDBTest(t *testing.T) {
 		{
 			name:        "10",
 			queryString: "SELECT usage_user,usage_nice,usage_irq,usage_system FROM cpu WHERE hostname = 'host_1' AND arch = 'x64' AND usage_user > 90.0 AND usage_irq > 10 AND service_version = '0' AND time > '2022-01-01T00:00:00Z' AND time < '2022-05-01T00:00:00Z' GROUP BY service,region,team limit 10",
-			expected:    "{(cpu.arch=x64,cpu.hostname=host_1,cpu.region=us-west-2,cpu.service=6,cpu.service_version=0,cpu.team=NYC)}#{usage_user[float64],usage_nice[float64],usage_irq[float64],usage_system[float64]}#{(usage_user>90.000[float64])(usage_irq>10[int64])}#{empty,empty}",
+			expected:    "{(cpu.arch=x64,cpu.hostname=host_1,cpu.region=us-west-2,cpu.service=6,cpu.service_version=0,cpu.team=NYC)}#{usage_user[float64],usage_nice[float64],usage_irq[float64],usage_system[float64]}#{(usage_irq>10[int64])(usage_user>90[float64])}#{empty,empty}",
 		},
 		{
 			name:        "11", // 0.9s
 			queryString: "SELECT COUNT(usage_user) FROM cpu WHERE hostname = 'host_1' AND arch = 'x64' AND usage_user > 90.0 AND usage_irq > 10.0 AND service_version = '0' AND time > '2022-01-01T00:00:00Z' AND time < '2022-05-01T00:00:00Z' GROUP BY service,region,team,time(3h) limit 10",
-			expected:    "{(cpu.arch=x64,cpu.hostname=host_1,cpu.region=us-west-2,cpu.service=6,cpu.service_version=0,cpu.team=NYC)}#{usage_user[int64]}#{(usage_user>90.000[float64])(usage_irq>10.000[float64])}#{count,3h}",
+			expected:    "{(cpu.arch=x64,cpu.hostname=host_1,cpu.region=us-west-2,cpu.service=6,cpu.service_version=0,cpu.team=NYC)}#{usage_user[int64]}#{(usage_irq>10[float64])(usage_user>90[float64])}#{count,3h}",
 		},
 		{
 			name:        "12", // 0.9s
 			queryString: "SELECT COUNT(usage_user) FROM cpu WHERE hostname = 'host_1' AND arch = 'x64' AND usage_user > 90.0 AND usage_irq > 10.0 AND service_version = '0' AND time > '2022-01-01T00:00:00Z' AND time < '2022-05-01T00:00:00Z' GROUP BY service,region,team,time(3h)",
-			expected:    "{(cpu.arch=x64,cpu.hostname=host_1,cpu.region=us-west-2,cpu.service=6,cpu.service_version=0,cpu.team=NYC)}#{usage_user[int64]}#{(usage_user>90.000[float64])(usage_irq>10.000[float64])}#{count,3h}",
+			expected:    "{(cpu.arch=x64,cpu.hostname=host_1,cpu.region=us-west-2,cpu.service=6,cpu.service_version=0,cpu.team=NYC)}#{usage_user[int64]}#{(usage_irq>10[float64])(usage_user>90[float64])}#{count,3h}",
 		},
 		{
 			name:        "13",
 			queryString: "SELECT MIN(usage_irq) FROM cpu WHERE hostname = 'host_1' AND usage_user > 90.0 AND usage_irq > 10.0 AND time > '2022-01-01T00:00:00Z' AND time < '2022-05-01T00:00:00Z' GROUP BY arch,service,region,team,time(3h) limit 10",
-			expected:    "{(cpu.arch=x64,cpu.hostname=host_1,cpu.region=us-west-2,cpu.service=6,cpu.team=NYC)}#{usage_irq[float64]}#{(usage_user>90.000[float64])(usage_irq>10.000[float64])}#{min,3h}",
+			expected:    "{(cpu.arch=x64,cpu.hostname=host_1,cpu.region=us-west-2,cpu.service=6,cpu.team=NYC)}#{usage_irq[float64]}#{(usage_irq>10[float64])(usage_user>90[float64])}#{min,3h}",
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			query := NewQuery(tt.queryString, MyDB, "ns")
-			resp, err := c.Query(query)
+			resp, err := DefaultClient().Query(query)
 			if err != nil {
 				fmt.Println(err)
 			}
@@ -1970,12 +2844,12 @@ func TestSemanticSegment(t *testing.T) {
 		{
 			name:        "three predicates(OR)",
 			queryString: "SELECT water_level FROM h2o_feet WHERE location <> 'santa_monica' AND (water_level < -0.59 OR water_level > 9.95) AND time >= '2019-08-18T00:00:00Z' AND time <= '2019-08-30T00:30:00Z' GROUP BY location",
-			expected:    "{(h2o_feet.location=coyote_creek)}#{water_level[float64]}#{(water_level<-0.590[float64])(water_level>9.950[float64])}#{empty,empty}",
+			expected:    "{(h2o_feet.location=coyote_creek)}#{water_level[float64]}#{((water_level<-0.59[float64])|(water_level>9.95[float64]))}#{empty,empty}",
 		},
 		{
 			name:        "three predicates(OR)",
 			queryString: "SELECT water_level FROM h2o_feet WHERE location <> 'santa_monica' AND (water_level < -0.59 OR water_level > 9.95) AND time >= '2019-08-18T00:00:00Z' AND time <= '2019-08-30T00:30:00Z'",
-			expected:    "{(h2o_feet.location!=santa_monica)}#{water_level[float64]}#{(water_level<-0.590[float64])(water_level>9.950[float64])}#{empty,empty}",
+			expected:    "{(h2o_feet.location!=santa_monica)}#{water_level[float64]}#{((water_level<-0.59[float64])|(water_level>9.95[float64]))}#{empty,empty}",
 		},
 		{
 			name:        "time() and two tags",
@@ -1992,7 +2866,7 @@ func TestSemanticSegment(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			q := NewQuery(tt.queryString, MyDB, "")
-			response, err := c.Query(q)
+			response, err := DefaultClient().Query(q)
 			if err != nil {
 				log.Println(err)
 			}
@@ -2049,16 +2923,16 @@ func TestSeperateSemanticSegment(t *testing.T) {
 			name:        "",
 			queryString: "SELECT index FROM h2o_quality WHERE randtag='2' AND index>40 AND index<60 AND time >= '2019-08-18T00:00:00Z' AND time <= '2019-09-30T00:30:00Z' GROUP BY location",
 			expected: []string{
-				"{(h2o_quality.location=coyote_creek,h2o_quality.randtag=2)}#{index[int64]}#{(index>40[int64])(index<60[int64])}#{empty,empty}",
-				"{(h2o_quality.location=santa_monica,h2o_quality.randtag=2)}#{index[int64]}#{(index>40[int64])(index<60[int64])}#{empty,empty}",
+				"{(h2o_quality.location=coyote_creek,h2o_quality.randtag=2)}#{index[int64]}#{(index<60[int64])(index>40[int64])}#{empty,empty}",
+				"{(h2o_quality.location=santa_monica,h2o_quality.randtag=2)}#{index[int64]}#{(index<60[int64])(index>40[int64])}#{empty,empty}",
 			},
 		},
 		{
 			name:        "",
 			queryString: "SELECT index FROM h2o_quality WHERE randtag='2' AND index>40 AND index<60 AND time >= '2019-08-18T00:00:00Z' AND time <= '2019-09-30T00:30:00Z' GROUP BY location,randtag",
 			expected: []string{
-				"{(h2o_quality.location=coyote_creek,h2o_quality.randtag=2)}#{index[int64]}#{(index>40[int64])(index<60[int64])}#{empty,empty}",
-				"{(h2o_quality.location=santa_monica,h2o_quality.randtag=2)}#{index[int64]}#{(index>40[int64])(index<60[int64])}#{empty,empty}",
+				"{(h2o_quality.location=coyote_creek,h2o_quality.randtag=2)}#{index[int64]}#{(index<60[int64])(index>40[int64])}#{empty,empty}",
+				"{(h2o_quality.location=santa_monica,h2o_quality.randtag=2)}#{index[int64]}#{(index<60[int64])(index>40[int64])}#{empty,empty}",
 			},
 		},
 	}
@@ -2066,7 +2940,7 @@ func TestSeperateSemanticSegment(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			q := NewQuery(tt.queryString, MyDB, "")
-			resp, _ := c.Query(q)
+			resp, _ := DefaultClient().Query(q)
 
 			sepSemanticSegment := SeperateSemanticSegment(tt.queryString, resp)
 
@@ -2135,7 +3009,7 @@ func TestGetTagArr(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			q := NewQuery(tt.queryString, MyDB, "")
-			response, err := c.Query(q)
+			response, err := DefaultClient().Query(q)
 			if err != nil {
 				log.Println(err)
 			}
@@ -2170,7 +3044,7 @@ func TestGetResponseTimeRange(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			q := NewQuery(tt.queryString, MyDB, "")
-			response, err := c.Query(q)
+			response, err := DefaultClient().Query(q)
 			if err != nil {
 				log.Println(err)
 			}
@@ -2185,23 +3059,64 @@ func TestGetResponseTimeRange(t *testing.T) {
 	}
 }
 
+func TestTrimResponse(t *testing.T) {
+	tests := []struct {
+		name      string
+		startTime int64
+		endTime   int64
+		expected  []int
+	}{
+		{
+			name:      "inside cached range",
+			startTime: 1566086700000000000, // 2019-08-18T00:05:00Z
+			endTime:   1566087480000000000, // 2019-08-18T00:18:00Z
+			expected:  []int{3},
+		},
+		{
+			name:      "superset of cached range",
+			startTime: 1566000000000000000,
+			endTime:   1567000000000000000,
+			expected:  []int{5},
+		},
+		{
+			name:      "outside cached range",
+			startTime: 1566090000000000000,
+			endTime:   1566093600000000000,
+			expected:  []int{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trimmed := TrimResponse(rawWaterLevel(), tt.startTime, tt.endTime)
+			lengths := make([]int, 0)
+			for _, s := range trimmed.Results[0].Series {
+				lengths = append(lengths, len(s.Values))
+			}
+			if !reflect.DeepEqual(lengths, tt.expected) {
+				t.Errorf("values per series:\t%v\nexpected:\t%v", lengths, tt.expected)
+			}
+		})
+	}
+}
+
 func TestSortResponseWithTimeRange(t *testing.T) {
 
 	queryString1 := "SELECT COUNT(water_level) FROM h2o_feet WHERE time >= '2019-08-18T00:00:00Z' AND time <= '2019-08-18T00:30:00Z' GROUP BY time(12m),location"
 	q := NewQuery(queryString1, MyDB, "")
-	response1, _ := c.Query(q)
+	response1, _ := DefaultClient().Query(q)
 	st1, et1 := GetResponseTimeRange(response1)
 
 	// 和 query1 相差一分钟	00:01:00Z
 	queryString2 := "SELECT COUNT(water_level) FROM h2o_feet WHERE time >= '2019-08-18T00:31:00Z' AND time <= '2019-08-18T01:00:00Z' GROUP BY time(12m),location"
 	q2 := NewQuery(queryString2, MyDB, "")
-	response2, _ := c.Query(q2)
+	response2, _ := DefaultClient().Query(q2)
 	st2, et2 := GetResponseTimeRange(response2)
 
 	// 和 query2 相差一小时	01:00:00Z
 	queryString3 := "SELECT COUNT(water_level) FROM h2o_feet WHERE time >= '2019-08-18T02:00:00Z' AND time <= '2019-08-18T02:30:00Z' GROUP BY time(12m),location"
 	q3 := NewQuery(queryString3, MyDB, "")
-	response3, _ := c.Query(q3)
+	response3, _ := DefaultClient().Query(q3)
 	st3, et3 := GetResponseTimeRange(response3)
 
 	tests := []struct {
@@ -2254,31 +3169,31 @@ func TestSortResponseWithTimeRange2(t *testing.T) {
 
 	queryString1 := "SELECT index,location,randtag FROM h2o_quality WHERE time >= '2019-08-18T00:00:00Z' AND time <= '2019-08-18T00:10:00Z' GROUP BY randtag,location"
 	q1 := NewQuery(queryString1, MyDB, "")
-	response1, _ := c.Query(q1)
+	response1, _ := DefaultClient().Query(q1)
 	st1, et1 := GetResponseTimeRange(response1)
 	rwtr1 := RespWithTimeRange{response1, st1, et1}
 
 	queryString2 := "SELECT index,location,randtag FROM h2o_quality WHERE time >= '2019-08-18T00:15:00Z' AND time <= '2019-08-18T00:30:00Z' GROUP BY randtag,location"
 	q2 := NewQuery(queryString2, MyDB, "")
-	response2, _ := c.Query(q2)
+	response2, _ := DefaultClient().Query(q2)
 	st2, et2 := GetResponseTimeRange(response2)
 	rwtr2 := RespWithTimeRange{response2, st2, et2}
 
 	queryString3 := "SELECT index,location,randtag FROM h2o_quality WHERE time >= '2019-08-18T01:31:00Z' AND time <= '2019-08-18T01:40:00Z' GROUP BY randtag,location"
 	q3 := NewQuery(queryString3, MyDB, "")
-	response3, _ := c.Query(q3)
+	response3, _ := DefaultClient().Query(q3)
 	st3, et3 := GetResponseTimeRange(response3)
 	rwtr3 := RespWithTimeRange{response3, st3, et3}
 
 	queryString4 := "SELECT index,location,randtag FROM h2o_quality WHERE time >= '2019-08-18T03:31:00Z' AND time <= '2019-08-18T03:40:00Z' GROUP BY randtag,location"
 	q4 := NewQuery(queryString4, MyDB, "")
-	response4, _ := c.Query(q4)
+	response4, _ := DefaultClient().Query(q4)
 	st4, et4 := GetResponseTimeRange(response4)
 	rwtr4 := RespWithTimeRange{response4, st4, et4}
 
 	queryString5 := "SELECT index,location,randtag FROM h2o_quality WHERE time >= '2019-08-18T03:40:00Z' AND time <= '2019-08-18T04:00:00Z' GROUP BY randtag,location"
 	q5 := NewQuery(queryString5, MyDB, "")
-	response5, _ := c.Query(q5)
+	response5, _ := DefaultClient().Query(q5)
 	st5, et5 := GetResponseTimeRange(response5)
 	rwtr5 := RespWithTimeRange{response5, st5, et5}
 
@@ -2327,44 +3242,44 @@ func TestSortResponses(t *testing.T) {
 
 	queryString1 := "SELECT COUNT(water_level) FROM h2o_feet WHERE time >= '2019-08-18T00:00:00Z' AND time <= '2019-08-18T00:30:00Z' GROUP BY time(12m),location"
 	q := NewQuery(queryString1, MyDB, "")
-	response1, _ := c.Query(q)
+	response1, _ := DefaultClient().Query(q)
 
 	// 和 query1 相差一分钟	00:01:00Z
 	queryString2 := "SELECT COUNT(water_level) FROM h2o_feet WHERE time >= '2019-08-18T00:31:00Z' AND time <= '2019-08-18T01:00:00Z' GROUP BY time(12m),location"
 	q2 := NewQuery(queryString2, MyDB, "")
-	response2, _ := c.Query(q2)
+	response2, _ := DefaultClient().Query(q2)
 
 	// 和 query2 相差一小时	01:00:00Z
 	queryString3 := "SELECT COUNT(water_level) FROM h2o_feet WHERE time >= '2019-08-18T02:00:00Z' AND time <= '2019-08-18T02:30:00Z' GROUP BY time(12m),location"
 	q3 := NewQuery(queryString3, MyDB, "")
-	response3, _ := c.Query(q3)
+	response3, _ := DefaultClient().Query(q3)
 
 	var responseNil *Response
 	responseNil = nil
 
 	query1 := "SELECT index,location,randtag FROM h2o_quality WHERE time >= '2019-08-18T00:00:00Z' AND time <= '2019-08-18T00:30:00Z' GROUP BY randtag"
 	nq1 := NewQuery(query1, MyDB, "")
-	resp1, _ := c.Query(nq1)
+	resp1, _ := DefaultClient().Query(nq1)
 
 	// 1 min
 	query2 := "SELECT index,location,randtag FROM h2o_quality WHERE time >= '2019-08-18T00:31:00Z' AND time <= '2019-08-18T01:00:00Z' GROUP BY randtag"
 	nq2 := NewQuery(query2, MyDB, "")
-	resp2, _ := c.Query(nq2)
+	resp2, _ := DefaultClient().Query(nq2)
 
 	// 0.5 h
 	query3 := "SELECT index,location,randtag FROM h2o_quality WHERE time >= '2019-08-18T01:31:00Z' AND time <= '2019-08-18T02:00:00Z' GROUP BY randtag"
 	nq3 := NewQuery(query3, MyDB, "")
-	resp3, _ := c.Query(nq3)
+	resp3, _ := DefaultClient().Query(nq3)
 
 	// 1 h
 	query4 := "SELECT index,location,randtag FROM h2o_quality WHERE time >= '2019-08-18T03:00:00Z' AND time <= '2019-08-18T04:00:00Z' GROUP BY randtag"
 	nq4 := NewQuery(query4, MyDB, "")
-	resp4, _ := c.Query(nq4)
+	resp4, _ := DefaultClient().Query(nq4)
 
 	// 1 s
 	query5 := "SELECT index,location,randtag FROM h2o_quality WHERE time >= '2019-08-18T04:00:01Z' AND time <= '2019-08-18T04:30:00Z' GROUP BY randtag"
 	nq5 := NewQuery(query5, MyDB, "")
-	resp5, _ := c.Query(nq5)
+	resp5, _ := DefaultClient().Query(nq5)
 
 	tests := []struct {
 		name     string
@@ -2437,23 +3352,23 @@ func TestSortResponses2(t *testing.T) {
 
 	queryString1 := "SELECT index,location,randtag FROM h2o_quality WHERE time >= '2019-08-18T00:00:00Z' AND time <= '2019-08-18T00:10:00Z' GROUP BY randtag,location"
 	q1 := NewQuery(queryString1, MyDB, "")
-	resp1, _ := c.Query(q1)
+	resp1, _ := DefaultClient().Query(q1)
 
 	queryString2 := "SELECT index,location,randtag FROM h2o_quality WHERE time >= '2019-08-18T00:15:00Z' AND time <= '2019-08-18T00:30:00Z' GROUP BY randtag,location"
 	q2 := NewQuery(queryString2, MyDB, "")
-	resp2, _ := c.Query(q2)
+	resp2, _ := DefaultClient().Query(q2)
 
 	queryString3 := "SELECT index,location,randtag FROM h2o_quality WHERE time >= '2019-08-18T01:31:00Z' AND time <= '2019-08-18T01:40:00Z' GROUP BY randtag,location"
 	q3 := NewQuery(queryString3, MyDB, "")
-	resp3, _ := c.Query(q3)
+	resp3, _ := DefaultClient().Query(q3)
 
 	queryString4 := "SELECT index,location,randtag FROM h2o_quality WHERE time >= '2019-08-18T03:31:00Z' AND time <= '2019-08-18T03:40:00Z' GROUP BY randtag,location"
 	q4 := NewQuery(queryString4, MyDB, "")
-	resp4, _ := c.Query(q4)
+	resp4, _ := DefaultClient().Query(q4)
 
 	queryString5 := "SELECT index,location,randtag FROM h2o_quality WHERE time >= '2019-08-18T03:40:00Z' AND time <= '2019-08-18T04:00:00Z' GROUP BY randtag,location"
 	q5 := NewQuery(queryString5, MyDB, "")
-	resp5, _ := c.Query(q5)
+	resp5, _ := DefaultClient().Query(q5)
 
 	var respNil *Response
 	respNil = nil
@@ -2503,7 +3418,7 @@ func TestMergeResultTable(t *testing.T) {
 
 	query1 := "SELECT index,location,randtag FROM h2o_quality WHERE time >= '2019-08-18T00:00:00Z' AND time <= '2019-08-18T00:30:00Z' GROUP BY randtag,location"
 	nq1 := NewQuery(query1, MyDB, "")
-	resp1, _ := c.Query(nq1)
+	resp1, _ := DefaultClient().Query(nq1)
 	resp1.ToString()
 	//SCHEMA time index location randtag location=coyote_creek randtag=1
 	//2019-08-18T00:06:00Z 66 coyote_creek 1
@@ -2528,7 +3443,7 @@ func TestMergeResultTable(t *testing.T) {
 	// 1 min
 	query2 := "SELECT index,location,randtag FROM h2o_quality WHERE time >= '2019-08-18T00:31:00Z' AND time <= '2019-08-18T01:00:00Z' GROUP BY randtag,location"
 	nq2 := NewQuery(query2, MyDB, "")
-	resp2, _ := c.Query(nq2)
+	resp2, _ := DefaultClient().Query(nq2)
 	resp2.ToString()
 	//SCHEMA time index location randtag location=coyote_creek randtag=1
 	//2019-08-18T00:42:00Z 55 coyote_creek 1
@@ -2550,19 +3465,19 @@ func TestMergeResultTable(t *testing.T) {
 	// 0.5 h
 	query3 := "SELECT index,location,randtag FROM h2o_quality WHERE time >= '2019-08-18T01:31:00Z' AND time <= '2019-08-18T02:00:00Z' GROUP BY randtag,location"
 	nq3 := NewQuery(query3, MyDB, "")
-	resp3, _ := c.Query(nq3)
+	resp3, _ := DefaultClient().Query(nq3)
 	fmt.Println(resp3)
 
 	// 1 h
 	query4 := "SELECT index,location,randtag FROM h2o_quality WHERE time >= '2019-08-18T03:00:00Z' AND time <= '2019-08-18T04:00:00Z' GROUP BY randtag,location"
 	nq4 := NewQuery(query4, MyDB, "")
-	resp4, _ := c.Query(nq4)
+	resp4, _ := DefaultClient().Query(nq4)
 	fmt.Println(resp4)
 
 	// 1 s
 	query5 := "SELECT index,location,randtag FROM h2o_quality WHERE time >= '2019-08-18T04:00:01Z' AND time <= '2019-08-18T04:30:00Z' GROUP BY randtag,location"
 	nq5 := NewQuery(query5, MyDB, "")
-	resp5, _ := c.Query(nq5)
+	resp5, _ := DefaultClient().Query(nq5)
 	fmt.Println(resp5)
 
 	tests := []struct {
@@ -2704,9 +3619,9 @@ func TestMergeResultTable(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			q1 := NewQuery(tt.queryString[0], MyDB, "")
-			resp1, _ := c.Query(q1)
+			resp1, _ := DefaultClient().Query(q1)
 			q2 := NewQuery(tt.queryString[1], MyDB, "")
-			resp2, _ := c.Query(q2)
+			resp2, _ := DefaultClient().Query(q2)
 			resp := MergeResultTable(resp1, resp2)
 			if resp.ToString() != tt.expected {
 				t.Error("merged resp:\t", resp.ToString())
@@ -2851,9 +3766,9 @@ func TestMergeResultTable2(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			query1 := NewQuery(tt.querys[0], MyDB, "")
-			resp1, _ := c.Query(query1)
+			resp1, _ := DefaultClient().Query(query1)
 			query2 := NewQuery(tt.querys[1], MyDB, "")
-			resp2, _ := c.Query(query2)
+			resp2, _ := DefaultClient().Query(query2)
 
 			merged := MergeResultTable(resp1, resp2)
 			if strings.Compare(merged.ToString(), tt.expected) != 0 {
@@ -2869,7 +3784,7 @@ func TestMerge(t *testing.T) {
 
 	query1 := "SELECT index,location,randtag FROM h2o_quality WHERE time >= '2019-08-18T00:00:00Z' AND time <= '2019-08-18T00:30:00Z' GROUP BY randtag,location"
 	nq1 := NewQuery(query1, MyDB, "")
-	resp1, _ := c.Query(nq1)
+	resp1, _ := DefaultClient().Query(nq1)
 	resp1.ToString()
 	//SCHEMA time index location randtag location=coyote_creek randtag=1
 	//2019-08-18T00:06:00Z 66 coyote_creek 1
@@ -2894,7 +3809,7 @@ func TestMerge(t *testing.T) {
 	// 1 min
 	query2 := "SELECT index,location,randtag FROM h2o_quality WHERE time >= '2019-08-18T00:31:00Z' AND time <= '2019-08-18T01:00:00Z' GROUP BY randtag,location"
 	nq2 := NewQuery(query2, MyDB, "")
-	resp2, _ := c.Query(nq2)
+	resp2, _ := DefaultClient().Query(nq2)
 	resp2.ToString()
 	//SCHEMA time index location randtag location=coyote_creek randtag=1
 	//2019-08-18T00:42:00Z 55 coyote_creek 1
@@ -2916,7 +3831,7 @@ func TestMerge(t *testing.T) {
 	// 30 min
 	query3 := "SELECT index,location,randtag FROM h2o_quality WHERE time >= '2019-08-18T01:31:00Z' AND time <= '2019-08-18T02:00:00Z' GROUP BY randtag,location"
 	nq3 := NewQuery(query3, MyDB, "")
-	resp3, _ := c.Query(nq3)
+	resp3, _ := DefaultClient().Query(nq3)
 	resp3.ToString()
 	//SCHEMA time index location randtag location=coyote_creek randtag=1
 	//2019-08-18T01:36:00Z 71 coyote_creek 1
@@ -2939,7 +3854,7 @@ func TestMerge(t *testing.T) {
 	// 1 h
 	query4 := "SELECT index,location,randtag FROM h2o_quality WHERE time >= '2019-08-18T03:00:00Z' AND time <= '2019-08-18T04:00:00Z' GROUP BY randtag,location"
 	nq4 := NewQuery(query4, MyDB, "")
-	resp4, _ := c.Query(nq4)
+	resp4, _ := DefaultClient().Query(nq4)
 	st4, et4 := GetResponseTimeRange(resp4)
 	fmt.Printf("st4:%d\tet4:%d\n", st4, et4)
 	resp4.ToString()
@@ -2976,7 +3891,7 @@ func TestMerge(t *testing.T) {
 	// 1 s
 	query5 := "SELECT index,location,randtag FROM h2o_quality WHERE time >= '2019-08-18T04:00:01Z' AND time <= '2019-08-18T04:30:00Z' GROUP BY randtag,location"
 	nq5 := NewQuery(query5, MyDB, "")
-	resp5, _ := c.Query(nq5)
+	resp5, _ := DefaultClient().Query(nq5)
 	st5, et5 := GetResponseTimeRange(resp5)
 	fmt.Printf("st5:%d\tet5:%d\n", st5, et5)
 	resp5.ToString()
@@ -3359,7 +4274,7 @@ func TestMerge2(t *testing.T) {
 			var resps []*Response
 			for i := range tt.querys {
 				query := NewQuery(tt.querys[i], MyDB, "")
-				respTmp, _ := c.Query(query)
+				respTmp, _ := DefaultClient().Query(query)
 				resps = append(resps, respTmp)
 			}
 			merged := Merge("h", resps...)
@@ -3375,6 +4290,49 @@ func TestMerge2(t *testing.T) {
 
 }
 
+func TestSortSeries(t *testing.T) {
+	row := func(name, location string) models.Row {
+		return models.Row{Name: name, Tags: map[string]string{"location": location}, Columns: []string{"time", "index"}}
+	}
+	resp := &Response{Results: []Result{{Series: []models.Row{
+		row("h2o_quality", "coyote_creek"),
+		row("h2o_feet", "santa_monica"),
+		row("h2o_feet", "coyote_creek"),
+	}}}}
+	expected := &Response{Results: []Result{{Series: []models.Row{
+		row("h2o_feet", "coyote_creek"),
+		row("h2o_feet", "santa_monica"),
+		row("h2o_quality", "coyote_creek"),
+	}}}}
+
+	sorted := SortSeries(resp)
+	if !reflect.DeepEqual(sorted, expected) {
+		t.Errorf("response:\t%v\nexpected:\t%v", sorted, expected)
+	}
+	if resp.Results[0].Series[0].Name != "h2o_quality" {
+		t.Errorf("input response was modified")
+	}
+	if same := SortSeries(expected); same != expected {
+		t.Errorf("sorted response should be returned as is")
+	}
+
+	/* 数据库返回的表不是有序的时候，Query 的结果也是有序的 */
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"results":[{"statement_id":0,"series":[{"name":"h2o_feet","tags":{"location":"santa_monica"},"columns":["time","index"]},{"name":"h2o_feet","tags":{"location":"coyote_creek"},"columns":["time","index"]}]}]}`))
+	}))
+	defer ts.Close()
+	c, _ := NewHTTPClient(HTTPConfig{Addr: ts.URL})
+	defer c.Close()
+	queried, err := c.Query(Query{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if queried.Results[0].Series[0].Tags["location"] != "coyote_creek" {
+		t.Errorf("series:\t%v", queried.Results[0].Series)
+	}
+}
+
 func TestGetSeriesTagsMap(t *testing.T) {
 
 	tests := []struct {
@@ -3412,7 +4370,7 @@ func TestGetSeriesTagsMap(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			query := NewQuery(tt.queryString, MyDB, "")
-			resp, _ := c.Query(query)
+			resp, _ := DefaultClient().Query(query)
 			tagsMap := GetSeriesTagsMap(resp)
 			fmt.Println(len(tagsMap))
 			fmt.Println(tagsMap)
@@ -3562,8 +4520,8 @@ func TestMergeSeries(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			q1 := NewQuery(tt.queryString[0], MyDB, "")
 			q2 := NewQuery(tt.queryString[1], MyDB, "")
-			resp1, _ := c.Query(q1)
-			resp2, _ := c.Query(q2)
+			resp1, _ := DefaultClient().Query(q1)
+			resp2, _ := DefaultClient().Query(q2)
 
 			seriesMerged := MergeSeries(resp1, resp2)
 			//fmt.Printf("len:%d\n", len(seriesMerged))
@@ -3765,8 +4723,8 @@ func TestMergeSeries2(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			q1 := NewQuery(tt.querys[0], MyDB, "")
 			q2 := NewQuery(tt.querys[1], MyDB, "")
-			resp1, _ := c.Query(q1)
-			resp2, _ := c.Query(q2)
+			resp1, _ := DefaultClient().Query(q1)
+			resp2, _ := DefaultClient().Query(q2)
 
 			seriesMerged := MergeSeries(resp1, resp2)
 			var tagStr string
@@ -3789,7 +4747,7 @@ func TestResponse_ToByteArray(t *testing.T) {
 	//queryMemcache := "SELECT randtag,index FROM h2o_quality limit 5"
 	queryMemcache := "SELECT index FROM h2o_quality WHERE location='coyote_creek' AND time >= '2019-08-18T00:00:00Z' AND time <= '2019-08-18T00:30:00Z' GROUP BY randtag"
 	qm := NewQuery(queryMemcache, MyDB, "")
-	respCache, _ := c.Query(qm)
+	respCache, _ := DefaultClient().Query(qm)
 
 	semanticSegment := SemanticSegment(queryMemcache, respCache)
 	respCacheByte := respCache.ToByteArray(queryMemcache)
@@ -3799,14 +4757,14 @@ func TestResponse_ToByteArray(t *testing.T) {
 	str = respCache.ToString()
 	fmt.Printf("To be set:\n%s\n\n", str)
 
-	err = mc.Set(&memcache.Item{Key: semanticSegment, Value: respCacheByte, Time_start: 134123, Time_end: 53421432123, NumOfTables: 1})
+	err := DefaultCache().Set(&memcache.Item{Key: semanticSegment, Value: respCacheByte, Time_start: 134123, Time_end: 53421432123, NumOfTables: 1})
 
 	if err != nil {
 		log.Fatalf("Error setting value: %v", err)
 	}
 
 	// 从缓存中获取值
-	itemValues, _, err := mc.Get(semanticSegment, 10, 20)
+	itemValues, _, err := DefaultCache().Get(semanticSegment, 10, 20)
 	if errors.Is(err, memcache.ErrCacheMiss) {
 		log.Printf("Key not found in cache")
 	} else if err != nil {
@@ -3824,7 +4782,7 @@ func TestResponse_ToByteArray(t *testing.T) {
 	fmt.Println()
 
 	// 在缓存中删除值
-	err = mc.Delete(semanticSegment)
+	err = DefaultCache().Delete(semanticSegment)
 	if err != nil {
 		log.Fatalf("Error deleting value: %v", err)
 	}
@@ -3923,7 +4881,7 @@ func TestByteArrayToResponse(t *testing.T) {
 		{
 			name:        "one table four columns",
 			queryString: "SELECT index,location,randtag FROM h2o_quality WHERE location='coyote_creek' AND randtag='2' AND index>50 AND time >= '2019-08-18T00:00:00Z' AND time <= '2019-08-18T00:30:00Z' GROUP BY randtag,location",
-			expected: "{(h2o_quality.location=coyote_creek,h2o_quality.randtag=2)}#{index[int64],location[string],randtag[string]}#{(randtag='2'[string])(index>50[int64])}#{empty,empty} [0 0 0 0 0 0 0 66]\r\n" +
+			expected: "{(h2o_quality.location=coyote_creek,h2o_quality.randtag=2)}#{index[int64],location[string],randtag[string]}#{(index>50[int64])(randtag='2'[string])}#{empty,empty} [0 0 0 0 0 0 0 66]\r\n" +
 				"[1566087120000000000 78 coyote_creek 2]\r\n",
 		},
 		{
@@ -3944,7 +4902,7 @@ func TestByteArrayToResponse(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			query := NewQuery(tt.queryString, MyDB, "ns")
-			resp, err := c.Query(query)
+			resp, err := DefaultClient().Query(query)
 			if err != nil {
 				t.Errorf(err.Error())
 			}
@@ -3952,10 +4910,9 @@ func TestByteArrayToResponse(t *testing.T) {
 			/* Set() 存入cache */
 			semanticSegment := SemanticSegment(tt.queryString, resp)
 			startTime, endTime := GetResponseTimeRange(resp)
-			respString := resp.ToString()
 			respCacheByte := resp.ToByteArray(tt.queryString)
 			tableNumbers := int64(len(resp.Results[0].Series))
-			err = mc.Set(&memcache.Item{Key: semanticSegment, Value: respCacheByte, Time_start: startTime, Time_end: endTime, NumOfTables: tableNumbers})
+			err = DefaultCache().Set(&memcache.Item{Key: semanticSegment, Value: respCacheByte, Time_start: startTime, Time_end: endTime, NumOfTables: tableNumbers})
 
 			if err != nil {
 				log.Fatalf("Set error: %v", err)
@@ -3963,7 +4920,7 @@ func TestByteArrayToResponse(t *testing.T) {
 			fmt.Println("Set successfully")
 
 			/* Get() 从cache取出 */
-			valueBytes, _, err := mc.Get(semanticSegment, startTime, endTime)
+			valueBytes, _, err := DefaultCache().Get(semanticSegment, startTime, endTime)
 			if err == memcache.ErrCacheMiss {
 				log.Printf("Key not found in cache")
 			} else if err != nil {
@@ -3975,7 +4932,7 @@ func TestByteArrayToResponse(t *testing.T) {
 			respConverted := ByteArrayToResponse(valueBytes)
 			fmt.Println("Convert successfully")
 
-			if strings.Compare(respString, respConverted.ToString()) != 0 {
+			if !ResponsesEqual(resp, respConverted, CompareOptions{}) {
 				t.Errorf("fail to convert:different response")
 			}
 			fmt.Println("Same before and after convert")
@@ -3991,6 +4948,74 @@ func TestByteArrayToResponse(t *testing.T) {
 
 }
 
+// benchmarkResponse 返回 series 张表、每张表 rows 行的结果和每张表的语义段
+func benchmarkResponse(series, rows int) (*Response, []string) {
+	resp := &Response{Results: []Result{{}}}
+	segments := make([]string, 0, series)
+	for i := 0; i < series; i++ {
+		location := fmt.Sprintf("location%d", i)
+		values := make([][]interface{}, 0, rows)
+		for j := 0; j < rows; j++ {
+			values = append(values, []interface{}{
+				json.Number(fmt.Sprint(1566086400000000000 + int64(j)*int64(time.Minute))),
+				json.Number(fmt.Sprint(j)),
+				json.Number(fmt.Sprintf("%d.%03d", j%10, j%1000)),
+				"between 6 and 9 feet",
+			})
+		}
+		resp.Results[0].Series = append(resp.Results[0].Series, models.Row{
+			Name:    "h2o_feet",
+			Tags:    map[string]string{"location": location},
+			Columns: []string{"time", "index", "water_level", "level description"},
+			Values:  values,
+		})
+		segments = append(segments, fmt.Sprintf("{(h2o_feet.location=%s)}#{index[int64],water_level[float64],level%%20description[string]}#{empty}#{empty,empty}", location))
+	}
+	return resp, segments
+}
+
+func TestResponse_ToString(t *testing.T) {
+	resp, _ := benchmarkResponse(2, 2)
+	resp.Results[0].Series[1].Values[1][3] = nil
+	expected := "SCHEMA time index water_level level description location=location0 \r\n" +
+		"1566086400000000000 0 0.000 between 6 and 9 feet \r\n" +
+		"1566086460000000000 1 1.001 between 6 and 9 feet \r\n" +
+		"SCHEMA time index water_level level description location=location1 \r\n" +
+		"1566086400000000000 0 0.000 between 6 and 9 feet \r\n" +
+		"1566086460000000000 1 1.001 _ \r\n" +
+		"end"
+	if str := resp.ToString(); str != expected {
+		t.Errorf("string:\t%q\nexpected:\t%q", str, expected)
+	}
+	if str := (&Response{Results: []Result{{}}}).ToString(); str != "empty response" {
+		t.Errorf("string:\t%q\nexpected:\t%q", str, "empty response")
+	}
+}
+
+func BenchmarkResponse_ToString(b *testing.B) {
+	for _, rows := range []int{100, 10000} {
+		resp, _ := benchmarkResponse(4, rows)
+		b.Run(fmt.Sprintf("rows=%d", rows), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				_ = resp.ToString()
+			}
+		})
+	}
+}
+
+func BenchmarkResponse_ToByteArrayWithSegments(b *testing.B) {
+	for _, rows := range []int{100, 10000} {
+		resp, segments := benchmarkResponse(4, rows)
+		b.Run(fmt.Sprintf("rows=%d", rows), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				_ = resp.ToByteArrayWithSegments(segments)
+			}
+		})
+	}
+}
+
 func TestBoolToByteArray(t *testing.T) {
 	bvs := []bool{true, false}
 	expected := [][]byte{{1}, {0}}
@@ -3998,7 +5023,7 @@ func TestBoolToByteArray(t *testing.T) {
 	for i := range bvs {
 		byteArr, err := BoolToByteArray(bvs[i])
 		if err != nil {
-			fmt.Println(err)
+			t.Error(err)
 		} else {
 			if !bytes.Equal(byteArr, expected[i]) {
 				t.Errorf("byte array%b", byteArr)
@@ -4017,7 +5042,7 @@ func TestByteArrayToBool(t *testing.T) {
 	for i := range byteArray {
 		b, err := ByteArrayToBool(byteArray[i])
 		if err != nil {
-			fmt.Println(err)
+			t.Error(err)
 		} else {
 			if b != expected[i] {
 				t.Errorf("bool:%v", b)
@@ -4155,7 +5180,7 @@ func TestInt64ToByteArray(t *testing.T) {
 	for i := range numbers {
 		bytesArray, err := Int64ToByteArray(numbers[i])
 		if err != nil {
-			fmt.Errorf(err.Error())
+			t.Error(err)
 		}
 		if !bytes.Equal(bytesArray, expected[i]) {
 			t.Errorf("byte array:%d", bytesArray)
@@ -4181,7 +5206,7 @@ func TestByteArrayToInt64(t *testing.T) {
 	for i := range byteArrays {
 		number, err := ByteArrayToInt64(byteArrays[i])
 		if err != nil {
-			fmt.Printf(err.Error())
+			t.Error(err)
 		}
 		if number != expected[i] {
 			t.Errorf("number:%d", number)
@@ -4210,7 +5235,7 @@ func TestFloat64ToByteArray(t *testing.T) {
 	for i := range numbers {
 		bytesArray, err := Float64ToByteArray(numbers[i])
 		if err != nil {
-			fmt.Println(err.Error())
+			t.Error(err)
 		}
 		if !bytes.Equal(bytesArray, expected[i]) {
 			t.Errorf("byte array:%b", bytesArray)
@@ -4240,7 +5265,7 @@ func TestByteArrayToFloat64(t *testing.T) {
 	for i := range byteArrays {
 		number, err := ByteArrayToFloat64(byteArrays[i])
 		if err != nil {
-			fmt.Println(err)
+			t.Error(err)
 		}
 		if number != expected[i] {
 			t.Errorf("number:%f", number)
@@ -4252,8 +5277,10 @@ func TestByteArrayToFloat64(t *testing.T) {
 }
 
 func TestTimeStringToInt64(t *testing.T) {
-	timeStrings := []string{"2019-08-18T00:00:00Z", "2000-01-01T00:00:00Z", "2261-01-01T00:00:00Z"}
-	expected := []int64{1566086400000000000, 946684800000000000, 9183110400000000000}
+	timeStrings := []string{"2019-08-18T00:00:00Z", "2000-01-01T00:00:00Z", "2261-01-01T00:00:00Z",
+		"2019-08-18T00:00:00.123456789Z", "2019-08-18T08:00:00.5+08:00", "2019-08-18 00:00:00", "2019-08-18"}
+	expected := []int64{1566086400000000000, 946684800000000000, 9183110400000000000,
+		1566086400123456789, 1566086400500000000, 1566086400000000000, 1566086400000000000}
 	for i := range timeStrings {
 		numberN := TimeStringToInt64(timeStrings[i])
 		if numberN != expected[i] {
@@ -4264,8 +5291,8 @@ func TestTimeStringToInt64(t *testing.T) {
 }
 
 func TestTimeInt64ToString(t *testing.T) {
-	timeIntegers := []int64{1566086400000000000, 946684800000000000, 9183110400000000000}
-	expected := []string{"2019-08-18T00:00:00Z", "2000-01-01T00:00:00Z", "2261-01-01T00:00:00Z"}
+	timeIntegers := []int64{1566086400000000000, 946684800000000000, 9183110400000000000, 1566086400123456789, 1566086400500000000}
+	expected := []string{"2019-08-18T00:00:00Z", "2000-01-01T00:00:00Z", "2261-01-01T00:00:00Z", "2019-08-18T00:00:00.123456789Z", "2019-08-18T00:00:00.5Z"}
 	for i := range timeIntegers {
 		numberStr := TimeInt64ToString(timeIntegers[i])
 		if numberStr != expected[i] {
@@ -0,0 +1,206 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/influxdata/influxql"
+)
+
+const (
+	// DefaultCoalesceWindow 是第一个查询到达后等待可以合并的查询的默认时间
+	DefaultCoalesceWindow = 100 * time.Millisecond
+	// DefaultCoalesceTolerance 是可以合并的查询起止时间的默认最大差距
+	DefaultCoalesceTolerance = time.Second
+)
+
+// CoalesceConfig 配置查询合并：同一模板的查询在 Window 内同时到达、起止时间和已经等待的查询相差不超过 Tolerance 时，
+// 只用覆盖所有时间范围的一个查询读取数据库，再把结果裁剪成每个查询的时间范围。
+// 仪表盘的多个面板刷新时几乎同时发出 now() - 1h 这样的查询，正是这种情况
+type CoalesceConfig struct {
+	Client    Client        // 实际查询数据库的连接，写入和不能合并的查询直接交给它
+	Window    time.Duration // 为 0 时使用 DefaultCoalesceWindow
+	Tolerance time.Duration // 为 0 时使用 DefaultCoalesceTolerance
+}
+
+// NewCoalescingClient 返回合并查询的 Client。只合并一条 SELECT 语句、没有 LIMIT、OFFSET、绑定参数、
+// 结果按时间升序、精度为纳秒或 RFC3339 的查询；GROUP BY time() 的查询要求每个查询的起止时间都和分组边界对齐，
+// 否则更大的时间范围会改变第一个和最后一个分组的聚合值
+func NewCoalescingClient(conf CoalesceConfig) (Client, error) {
+	if conf.Client == nil {
+		return nil, errors.New("coalescing needs a client")
+	}
+	if conf.Window <= 0 {
+		conf.Window = DefaultCoalesceWindow
+	}
+	if conf.Tolerance <= 0 {
+		conf.Tolerance = DefaultCoalesceTolerance
+	}
+	return &coalescingClient{conf: conf, pending: make(map[string][]*coalesceGroup)}, nil
+}
+
+type coalescingClient struct {
+	conf CoalesceConfig
+
+	mu      sync.Mutex
+	pending map[string][]*coalesceGroup // 还在等待的查询，按模板分组
+}
+
+// coalesceGroup 是合并成一次查询的一组查询
+type coalesceGroup struct {
+	union   Interval
+	callers []*coalesceCaller
+}
+
+// coalesceCaller 是组中的一个查询，结果从 done 返回
+type coalesceCaller struct {
+	q    Query
+	in   Interval
+	done chan coalesceResult
+}
+
+type coalesceResult struct {
+	resp *Response
+	err  error
+}
+
+// Query 合并可以合并的查询，其他查询直接执行
+func (cc *coalescingClient) Query(q Query) (*Response, error) {
+	key, in, ok := coalesceKey(q)
+	if !ok {
+		return cc.conf.Client.Query(q)
+	}
+	caller := &coalesceCaller{q: q, in: in, done: make(chan coalesceResult, 1)}
+	tolerance := int64(cc.conf.Tolerance)
+
+	cc.mu.Lock()
+	for _, g := range cc.pending[key] {
+		if abs(in.Start-g.union.Start) <= tolerance && abs(in.End-g.union.End) <= tolerance {
+			g.callers = append(g.callers, caller)
+			g.union = Interval{Start: min(g.union.Start, in.Start), End: max(g.union.End, in.End)}
+			cc.mu.Unlock()
+			r := <-caller.done
+			return r.resp, r.err
+		}
+	}
+	g := &coalesceGroup{union: in, callers: []*coalesceCaller{caller}}
+	cc.pending[key] = append(cc.pending[key], g)
+	cc.mu.Unlock()
+
+	time.Sleep(cc.conf.Window)
+
+	cc.mu.Lock()
+	groups := cc.pending[key]
+	for i := range groups {
+		if groups[i] == g {
+			groups = append(groups[:i], groups[i+1:]...)
+			break
+		}
+	}
+	if len(groups) == 0 {
+		delete(cc.pending, key)
+	} else {
+		cc.pending[key] = groups
+	}
+	cc.mu.Unlock()
+
+	cc.fetch(g)
+	r := <-caller.done
+	return r.resp, r.err
+}
+
+// fetch 用一个查询读取组的时间范围，把裁剪后的结果发给组中的每个查询；组中只有一个查询时原样执行
+func (cc *coalescingClient) fetch(g *coalesceGroup) {
+	if len(g.callers) == 1 {
+		resp, err := cc.conf.Client.Query(g.callers[0].q)
+		g.callers[0].done <- coalesceResult{resp, err}
+		return
+	}
+
+	q := g.callers[0].q
+	command, err := QueryWithTimeRange(q.Command, g.union.Start, g.union.End)
+	var resp *Response
+	if err == nil {
+		q.Command = command
+		resp, err = cc.conf.Client.Query(q)
+	}
+	for _, c := range g.callers {
+		if err != nil || resp == nil || resp.Error() != nil || len(resp.Results) != 1 {
+			c.done <- coalesceResult{resp, err}
+			continue
+		}
+		c.done <- coalesceResult{TrimResponse(resp, c.in.Start, c.in.End), nil}
+	}
+}
+
+// coalesceKey 返回可以合并的查询的模板和时间范围：查询的时间条件替换成同一个范围，加上查询的其他参数
+func coalesceKey(q Query) (string, Interval, bool) {
+	if q.Chunked || len(q.Parameters) > 0 || (q.Precision != "" && q.Precision != "ns" && q.Precision != "n") {
+		return "", Interval{}, false
+	}
+	query, err := influxql.ParseQuery(q.Command)
+	if err != nil || len(query.Statements) != 1 {
+		return "", Interval{}, false
+	}
+	s, ok := query.Statements[0].(*influxql.SelectStatement)
+	if !ok || s.Target != nil || s.Limit > 0 || s.Offset > 0 || s.SLimit > 0 || s.SOffset > 0 || !s.TimeAscending() {
+		return "", Interval{}, false
+	}
+	start, end, _ := GetQueryTimeRange(q.Command)
+	if start < 0 || end < start {
+		return "", Interval{}, false
+	}
+	if !s.IsRawQuery {
+		interval, err := s.GroupByInterval()
+		if err != nil || interval <= 0 {
+			return "", Interval{}, false
+		}
+		offset, err := s.GroupByOffset()
+		if err != nil {
+			return "", Interval{}, false
+		}
+		if (start-int64(offset))%int64(interval) != 0 || (end+1-int64(offset))%int64(interval) != 0 {
+			return "", Interval{}, false
+		}
+	}
+	template, err := QueryWithTimeRange(q.Command, 0, 0)
+	if err != nil {
+		return "", Interval{}, false
+	}
+	key := strings.Join([]string{template, q.Database, q.RetentionPolicy, q.Precision}, "\x00")
+	return key, Interval{Start: start, End: end}, true
+}
+
+func abs(n int64) int64 {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+func (cc *coalescingClient) Ping(timeout time.Duration) (time.Duration, string, error) {
+	return cc.conf.Client.Ping(timeout)
+}
+
+func (cc *coalescingClient) Write(bp BatchPoints) error {
+	return cc.conf.Client.Write(bp)
+}
+
+func (cc *coalescingClient) QueryAsChunk(q Query) (*ChunkedResponse, error) {
+	return cc.conf.Client.QueryAsChunk(q)
+}
+
+func (cc *coalescingClient) QueryFlux(ctx context.Context, flux string) (*Response, error) {
+	return queryFlux(ctx, cc.conf.Client, flux)
+}
+
+func (cc *coalescingClient) Close() error {
+	return cc.conf.Client.Close()
+}
+
+func (cc *coalescingClient) Shutdown(ctx context.Context) error {
+	return shutdownClient(ctx, cc.conf.Client)
+}
@@ -0,0 +1,116 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/influxdata/influxdb1-client/models"
+)
+
+func TestCoalescingClient_Query(t *testing.T) {
+	var mu sync.Mutex
+	queries := make([]string, 0)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.FormValue("q")
+		mu.Lock()
+		queries = append(queries, q)
+		mu.Unlock()
+		/* 时间范围内每秒一条数据 */
+		start, end, _ := GetQueryTimeRange(q)
+		values := make([][]interface{}, 0)
+		for ts := (start + 999999999) / 1e9 * 1e9; ts <= end; ts += 1e9 {
+			values = append(values, []interface{}{ts, 1.5})
+		}
+		resp := Response{Results: []Result{{Series: []models.Row{{Name: "cpu", Columns: []string{"time", "usage"}, Values: values}}}}}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer ts.Close()
+
+	inner, err := NewHTTPClient(HTTPConfig{Addr: ts.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := NewCoalescingClient(CoalesceConfig{Client: inner, Window: 50 * time.Millisecond, Tolerance: 2 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	query := func(host string, start, end int64) string {
+		return fmt.Sprintf("SELECT usage FROM cpu WHERE host = '%s' AND time >= %d AND time <= %d", host, start*1e9, end*1e9)
+	}
+	tests := []struct {
+		command    string
+		start, end int64 // 秒
+	}{
+		{query("a", 100, 200), 100, 200},
+		{query("a", 101, 201), 101, 201},
+		{query("a", 99, 199), 99, 199},
+		{query("a", 150, 250), 150, 250}, // 差距超过 Tolerance，单独查询
+		{query("b", 100, 200), 100, 200}, // 模板不同
+	}
+
+	var wg sync.WaitGroup
+	resps := make([]*Response, len(tests))
+	errs := make([]error, len(tests))
+	for i, tt := range tests {
+		wg.Add(1)
+		go func(i int, command string) {
+			defer wg.Done()
+			resps[i], errs[i] = c.Query(NewQuery(command, MyDB, "ns"))
+		}(i, tt.command)
+	}
+	wg.Wait()
+
+	for i, tt := range tests {
+		if errs[i] != nil {
+			t.Fatalf("query %d: %v", i, errs[i])
+		}
+		values := resps[i].Results[0].Series[0].Values
+		if len(values) != int(tt.end-tt.start+1) {
+			t.Errorf("query %d rows:\t%d\nexpected:\t%d", i, len(values), tt.end-tt.start+1)
+			continue
+		}
+		first, _ := timestampOf(values[0][0])
+		last, _ := timestampOf(values[len(values)-1][0])
+		if first != tt.start*1e9 || last != tt.end*1e9 {
+			t.Errorf("query %d range:\t[%d, %d]\nexpected:\t[%d, %d]", i, first, last, tt.start*1e9, tt.end*1e9)
+		}
+	}
+	if len(queries) != 3 {
+		t.Errorf("database queries:\t%d %v\nexpected:\t%d", len(queries), queries, 3)
+	}
+}
+
+func TestCoalesceKey(t *testing.T) {
+	tests := []struct {
+		name     string
+		command  string
+		expected bool
+	}{
+		{name: "raw", command: "SELECT usage FROM cpu WHERE time >= 0 AND time <= 59999999999", expected: true},
+		{name: "aligned group by", command: "SELECT mean(usage) FROM cpu WHERE time >= 60000000000 AND time <= 119999999999 GROUP BY time(1m)", expected: true},
+		{name: "unaligned group by", command: "SELECT mean(usage) FROM cpu WHERE time >= 30000000000 AND time <= 119999999999 GROUP BY time(1m)", expected: false},
+		{name: "aggregate without group by time", command: "SELECT mean(usage) FROM cpu WHERE time >= 0 AND time <= 59999999999", expected: false},
+		{name: "limit", command: "SELECT usage FROM cpu WHERE time >= 0 AND time <= 59999999999 LIMIT 10", expected: false},
+		{name: "descending", command: "SELECT usage FROM cpu WHERE time >= 0 AND time <= 59999999999 ORDER BY time DESC", expected: false},
+		{name: "into", command: "SELECT usage INTO cpu_copy FROM cpu WHERE time >= 0 AND time <= 59999999999", expected: false},
+		{name: "no time range", command: "SELECT usage FROM cpu", expected: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, ok := coalesceKey(NewQuery(tt.command, MyDB, "ns")); ok != tt.expected {
+				t.Errorf("coalesce:\t%v\nexpected:\t%v", ok, tt.expected)
+			}
+		})
+	}
+	if _, _, ok := coalesceKey(NewQuery("SELECT usage FROM cpu WHERE time >= 0 AND time <= 1", MyDB, "s")); ok {
+		t.Error("queries with second precision should not be coalesced")
+	}
+}
@@ -0,0 +1,294 @@
+package client
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// CodecMeta 是结果转换成字节数组时需要的、从字节数组还原时得到的元数据
+type CodecMeta struct {
+	Segments  []string // 每张表单独的语义段，数量和顺序和结果中的表一致
+	Precision string   // 结果中时间戳的精度，和 ToByteArrayWithPrecision 的参数相同
+}
+
+// Codec 把查询结果转换成cache中item的字节数组，以及从字节数组还原，item 的第一个字节是格式字节 Format()
+type Codec interface {
+	Format() byte
+	Encode(resp *Response, meta CodecMeta) ([]byte, error)
+	Decode(data []byte) (*Response, CodecMeta, error)
+}
+
+const (
+	// FormatRowV1 是原来的行式格式，没有单独的格式字节，item 以第一张表的语义段的 '{' 开始
+	FormatRowV1 byte = '{'
+	// FormatColumnar 是列式格式，每张表的数据按列存放，同一列的值连续存放
+	FormatColumnar byte = 0x02
+)
+
+// ItemCodec 是 Set、Append 和 FluxSet 存入cache时使用的格式，默认是行式格式。读取时按每个item的格式字节选择 Codec，
+// 修改格式之后已经存入的item仍然可以读取
+var ItemCodec Codec = RowCodecV1{}
+
+var (
+	codecsMu sync.RWMutex
+	codecs   = map[byte]Codec{
+		FormatRowV1:    RowCodecV1{},
+		FormatColumnar: ColumnarCodec{},
+	}
+)
+
+// RegisterCodec 注册一种格式，DecodeItem 根据 item 的格式字节选择 Codec；格式字节已经注册时替换原来的 Codec
+func RegisterCodec(c Codec) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	codecs[c.Format()] = c
+}
+
+// CodecFor 返回字节数组的格式对应的 Codec，没有数据的 "empty response" 是行式格式
+func CodecFor(data []byte) (Codec, error) {
+	if len(data) == 0 {
+		return nil, fmt.Errorf("%w: empty cache item", ErrEmptyResponse)
+	}
+	format := data[0]
+	if isEmptyItem(data) {
+		format = FormatRowV1
+	}
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	c, ok := codecs[format]
+	if !ok {
+		return nil, fmt.Errorf("unknown cache item format 0x%02x", format)
+	}
+	return c, nil
+}
+
+// DecodeItem 用字节数组的格式对应的 Codec 还原结果
+func DecodeItem(data []byte) (*Response, CodecMeta, error) {
+	c, err := CodecFor(data)
+	if err != nil {
+		return nil, CodecMeta{}, err
+	}
+	return c.Decode(data)
+}
+
+// recodeItem 把行式格式的item转换成 ItemCodec 的格式
+func recodeItem(rows []byte) ([]byte, error) {
+	if ItemCodec.Format() == FormatRowV1 || isEmptyItem(rows) {
+		return rows, nil
+	}
+	resp, meta, err := RowCodecV1{}.Decode(rows)
+	if err != nil {
+		return nil, err
+	}
+	return ItemCodec.Encode(resp, meta)
+}
+
+// RowCodecV1 是 ToByteArrayWithPrecision 和 ByteArrayToResponse 使用的行式格式：
+// 每张表是 语义段#{precision} + 空格 + 8字节的数据长度 + 按行依次存放的数据
+type RowCodecV1 struct{}
+
+func (RowCodecV1) Format() byte { return FormatRowV1 }
+
+func (RowCodecV1) Encode(resp *Response, meta CodecMeta) ([]byte, error) {
+	if !ResponseIsEmpty(resp) && len(meta.Segments) != len(resp.Results[0].Series) {
+		return nil, fmt.Errorf("%w: %d segments for %d series", ErrSchemaMismatch, len(meta.Segments), len(resp.Results[0].Series))
+	}
+	return resp.ToByteArrayWithPrecision(meta.Segments, meta.Precision), nil
+}
+
+// Decode 也能还原 Get 把多个item拼接在一起的字节数组，其中的列式表先转换成行式
+func (RowCodecV1) Decode(data []byte) (*Response, CodecMeta, error) {
+	rows, tables, err := itemRows(data)
+	if err != nil {
+		return nil, CodecMeta{}, err
+	}
+	if len(tables) == 0 {
+		return &Response{Results: []Result{{}}}, CodecMeta{}, nil
+	}
+	return ByteArrayToResponseWithPrecision(rows, ""), tablesMeta(tables), nil
+}
+
+// ColumnarCodec 是列式格式：每张表以 FormatColumnar 开始，语义段和数据长度和行式格式相同，
+// 数据按列存放，先是所有行的时间戳，然后依次是每一列的所有值，同一列的值类型相同、便于压缩和只读取部分列。
+// 每张表都有格式字节，Get 拼接在一起的行式和列式的item可以逐表区分
+type ColumnarCodec struct{}
+
+func (ColumnarCodec) Format() byte { return FormatColumnar }
+
+func (ColumnarCodec) Encode(resp *Response, meta CodecMeta) ([]byte, error) {
+	rows, err := RowCodecV1{}.Encode(resp, meta)
+	if err != nil || isEmptyItem(rows) {
+		return rows, err
+	}
+	tables, err := parseItemTables(rows)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]byte, 0, len(rows)+len(tables))
+	for _, t := range tables {
+		result = append(result, FormatColumnar)
+		result = append(result, t.header...)
+		result = append(result, transposeRows(t.data, t.widths)...)
+	}
+	return result, nil
+}
+
+func (ColumnarCodec) Decode(data []byte) (*Response, CodecMeta, error) {
+	if len(data) == 0 || data[0] != FormatColumnar {
+		return nil, CodecMeta{}, errors.New("not a columnar cache item")
+	}
+	return RowCodecV1{}.Decode(data)
+}
+
+// itemRows 把字节数组中的列式表转换成行式、去掉其中的 "empty response"，返回行式的字节数组和其中的表；
+// 本来就是行式时返回原来的字节数组。
+// 字节数组可以是 Get 拼接在一起的多个item，每个item是行式、列式或者 "empty response"
+func itemRows(data []byte) ([]byte, []itemTable, error) {
+	tables, err := parseItemTables(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	columnar, size := false, 0
+	for _, t := range tables {
+		columnar = columnar || t.columnar
+		size += len(t.header) + len(t.data)
+	}
+	if len(tables) == 0 {
+		return StringToByteArray("empty response"), tables, nil
+	}
+	if !columnar && size == len(bytes.TrimSuffix(data, []byte("\r\n"))) {
+		return data, tables, nil
+	}
+	rows := make([]byte, 0, len(data))
+	for i, t := range tables {
+		rows = append(rows, t.header...)
+		if t.columnar {
+			t.data = transposeColumns(t.data, t.widths)
+			t.columnar = false
+			tables[i] = t
+		}
+		rows = append(rows, t.data...)
+	}
+	if bytes.HasSuffix(data, []byte("\r\n")) {
+		rows = append(rows, "\r\n"...)
+	}
+	return rows, tables, nil
+}
+
+// itemTable 是字节数组中的一张表
+type itemTable struct {
+	columnar bool   // 数据按列存放，表头之前有 FormatColumnar
+	header   []byte // 语义段#{precision} + 空格 + 8字节的数据长度
+	segment  string // 语义段#{precision}
+	data     []byte
+	widths   []int // 每一列的字节数
+}
+
+// parseItemTables 按表头拆分出每张表，列式的表以 FormatColumnar 开始；
+// Get 拼接在一起的 "empty response" 和末尾 Get 添加的 "\r\n" 被忽略
+func parseItemTables(data []byte) ([]itemTable, error) {
+	data = bytes.TrimSuffix(data, []byte("\r\n"))
+	tables := make([]itemTable, 0)
+	for index := 0; index < len(data); {
+		if isEmptyItem(data[index:]) {
+			index += STRINGBYTELENGTH // 转换成字节数组的 "empty response" 补齐到 STRINGBYTELENGTH
+			continue
+		}
+		columnar := data[index] == FormatColumnar
+		if columnar {
+			index++
+		}
+		if !bytes.HasPrefix(data[index:], []byte("{(")) {
+			return nil, fmt.Errorf("expect a semantic segment at byte %d", index)
+		}
+		space := bytes.IndexByte(data[index:], ' ')
+		if space < 0 || index+space+9 > len(data) {
+			return nil, fmt.Errorf("truncated table header at byte %d", index)
+		}
+		t := itemTable{columnar: columnar, segment: string(data[index : index+space])}
+		length, err := ByteArrayToInt64(data[index+space+1 : index+space+9])
+		if err != nil {
+			return nil, err
+		}
+		start := index + space + 9
+		if length < 0 || start+int(length) > len(data) {
+			return nil, fmt.Errorf("table %s needs %d bytes, %d left", t.segment, length, len(data)-start)
+		}
+		t.header = data[index:start]
+		t.data = data[start : start+int(length)]
+
+		parts := strings.Split(t.segment, "#")
+		if len(parts) < 4 {
+			return nil, fmt.Errorf("malformed semantic segment %s", t.segment)
+		}
+		bytesPerLine := 0
+		for _, d := range DataTypeArrayFromSF("time[int64]," + strings.Trim(parts[1], "{}")) {
+			w := BytesPerLine([]string{d})
+			t.widths = append(t.widths, w)
+			bytesPerLine += w
+		}
+		if bytesPerLine == 0 || len(t.data)%bytesPerLine != 0 {
+			return nil, fmt.Errorf("table %s has %d bytes, not a multiple of %d", t.segment, len(t.data), bytesPerLine)
+		}
+		tables = append(tables, t)
+		index = start + int(length)
+	}
+	return tables, nil
+}
+
+// tablesMeta 从每张表的语义段取出元数据，语义段去掉末尾的 #{precision}
+func tablesMeta(tables []itemTable) CodecMeta {
+	meta := CodecMeta{Segments: make([]string, 0, len(tables))}
+	for _, t := range tables {
+		parts := strings.Split(t.segment, "#")
+		meta.Segments = append(meta.Segments, strings.Join(parts[:4], "#"))
+		if meta.Precision == "" {
+			meta.Precision = segmentPrecision(t.segment)
+		}
+	}
+	return meta
+}
+
+// transposeRows 把按行存放的数据转换成按列存放，widths 是每一列的字节数
+func transposeRows(data []byte, widths []int) []byte {
+	bytesPerLine := 0
+	for _, w := range widths {
+		bytesPerLine += w
+	}
+	rows := len(data) / bytesPerLine
+	result := make([]byte, 0, len(data))
+	offset := 0
+	for _, w := range widths {
+		for i := 0; i < rows; i++ {
+			result = append(result, data[i*bytesPerLine+offset:i*bytesPerLine+offset+w]...)
+		}
+		offset += w
+	}
+	return result
+}
+
+// transposeColumns 是 transposeRows 的逆变换
+func transposeColumns(data []byte, widths []int) []byte {
+	bytesPerLine := 0
+	for _, w := range widths {
+		bytesPerLine += w
+	}
+	rows := len(data) / bytesPerLine
+	result := make([]byte, len(data))
+	offset := 0
+	for _, w := range widths {
+		for i := 0; i < rows; i++ {
+			copy(result[i*bytesPerLine+offset:], data[offset*rows+i*w:offset*rows+(i+1)*w])
+		}
+		offset += w
+	}
+	return result
+}
+
+// isEmptyItem 判断字节数组是否是空结果转换成的 "empty response"
+func isEmptyItem(data []byte) bool {
+	return bytes.HasPrefix(data, StringToByteArray("empty response"))
+}
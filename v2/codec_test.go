@@ -0,0 +1,171 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/InfluxDB-client/memcache"
+)
+
+func TestCodecs(t *testing.T) {
+	segments := []string{"{(h2o_feet.location=coyote_creek)}#{index[int64],water_level[float64]}#{empty}#{empty,empty}"}
+	resp := rawWaterLevel()
+	resp.Results[0].Series[0].Values = resp.Results[0].Series[0].Values[:3]
+	meta := CodecMeta{Segments: segments, Precision: PrecisionRFC3339}
+	expected := ByteArrayToResponse(append(resp.ToByteArrayWithPrecision(segments, ""), []byte("\r\n")...))
+
+	for _, codec := range []Codec{RowCodecV1{}, ColumnarCodec{}} {
+		data, err := codec.Encode(resp, meta)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if data[0] != codec.Format() {
+			t.Errorf("format:\t0x%02x\nexpected:\t0x%02x", data[0], codec.Format())
+		}
+
+		/* 根据格式字节选择 Codec 还原 */
+		decoded, decodedMeta, err := DecodeItem(data)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !reflect.DeepEqual(decoded, expected) {
+			t.Errorf("response:\t%v\nexpected:\t%v", decoded, expected)
+		}
+		if !reflect.DeepEqual(decodedMeta, meta) {
+			t.Errorf("meta:\t%v\nexpected:\t%v", decodedMeta, meta)
+		}
+	}
+
+	/* 列式格式中同一列的值连续存放 */
+	data, _ := ColumnarCodec{}.Encode(resp, meta)
+	header := len(segments[0]) + len("#{"+PrecisionRFC3339+"}") + 9
+	for i, ts := range []int64{1566086400000000000, 1566086760000000000, 1566087120000000000} {
+		if v, _ := ByteArrayToInt64(data[1+header+8*i : 1+header+8*(i+1)]); v != ts {
+			t.Errorf("timestamp %d:\t%d\nexpected:\t%d", i, v, ts)
+		}
+	}
+
+	/* 行式格式和原来的字节数组相同 */
+	if data, _ := (RowCodecV1{}).Encode(resp, meta); string(data) != string(resp.ToByteArrayWithSegments(segments)) {
+		t.Errorf("row format differs from ToByteArrayWithSegments")
+	}
+	if v := expected.Results[0].Series[0].Values[1][2]; v != json.Number("8.005") {
+		t.Errorf("value:\t%v\nexpected:\t%v", v, json.Number("8.005"))
+	}
+}
+
+type testCodec struct{ ColumnarCodec }
+
+func (testCodec) Format() byte { return 0x7f }
+
+func TestRegisterCodec(t *testing.T) {
+	if _, err := CodecFor([]byte{0x7f}); err == nil {
+		t.Errorf("unknown format should have errored")
+	}
+	RegisterCodec(testCodec{})
+	defer func() {
+		codecsMu.Lock()
+		delete(codecs, 0x7f)
+		codecsMu.Unlock()
+	}()
+	if c, err := CodecFor([]byte{0x7f}); err != nil || c.Format() != 0x7f {
+		t.Errorf("codec:\t%v\nerror:\t%v", c, err)
+	}
+
+	if c, err := CodecFor(StringToByteArray("empty response")); err != nil || c.Format() != FormatRowV1 {
+		t.Errorf("empty response should use the row format: %v %v", c, err)
+	}
+	if _, _, err := DecodeItem([]byte("{(h2o_feet.empty)}#{index[int64]}#{empty}#{empty,empty} 123")); err == nil {
+		t.Errorf("truncated item should have errored")
+	}
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Format() byte { return 0x7e }
+
+func (jsonCodec) Encode(resp *Response, meta CodecMeta) ([]byte, error) {
+	body, err := json.Marshal(resp)
+	return append([]byte{0x7e}, body...), err
+}
+
+func (jsonCodec) Decode(data []byte) (*Response, CodecMeta, error) {
+	resp := new(Response)
+	dec := json.NewDecoder(bytes.NewReader(bytes.TrimSuffix(data[1:], []byte("\r\n"))))
+	dec.UseNumber()
+	return resp, CodecMeta{Precision: "ns"}, dec.Decode(resp)
+}
+
+func TestDecodeRange_ItemFormats(t *testing.T) {
+	segments := []string{"{(h2o_feet.location=coyote_creek)}#{index[int64],water_level[float64]}#{empty}#{empty,empty}"}
+	resp := rawWaterLevel()
+	rows := resp.ToByteArrayWithPrecision(segments, "ns")
+	expected := ByteArrayToResponse(append(rows, []byte("\r\n")...))
+
+	/* Get 拼接的多个item可以是不同的格式，中间可以有 empty response */
+	columnar, _ := ColumnarCodec{}.Encode(resp, CodecMeta{Segments: segments, Precision: "ns"})
+	values := append(append(append([]byte(nil), rows...), StringToByteArray("empty response")...), columnar...)
+	got, err := decodeRange(append(values, []byte("\r\n")...), "", -1, -1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(got.Results[0].Series) != 2 || !reflect.DeepEqual(got.Results[0].Series[1], expected.Results[0].Series[0]) {
+		t.Errorf("response:\t%v\nexpected two copies of:\t%v", got, expected)
+	}
+
+	/* 不是内置格式的item交给注册的 Codec */
+	if _, err := decodeRange([]byte{0x7e, '{', '}'}, "", -1, -1); err == nil {
+		t.Errorf("unregistered format should have errored")
+	}
+	RegisterCodec(jsonCodec{})
+	defer func() {
+		codecsMu.Lock()
+		delete(codecs, 0x7e)
+		codecsMu.Unlock()
+	}()
+	data, _ := jsonCodec{}.Encode(expected, CodecMeta{})
+	got, err = decodeRange(append(data, []byte("\r\n")...), "", -1, -1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("response:\t%v\nexpected:\t%v", got, expected)
+	}
+}
+
+func TestItemCodec(t *testing.T) {
+	defer func(c Codec) { ItemCodec = c }(ItemCodec)
+	ItemCodec = ColumnarCodec{}
+
+	segments := []string{"{(h2o_feet.location=coyote_creek)}#{index[int64],water_level[float64]}#{empty}#{empty,empty}"}
+	rows := rawWaterLevel().ToByteArrayWithPrecision(segments, "ns")
+	expected := ByteArrayToResponse(append(rows, []byte("\r\n")...))
+
+	/* 存入cache的item使用 ItemCodec 的格式，读取时还原成原来的结果 */
+	items := make([]*memcache.Item, 0)
+	err := setSpilledItems("key", bufio.NewReader(bytes.NewReader(rows)), 1<<20, func(item *memcache.Item) error {
+		items = append(items, item)
+		return nil
+	})
+	if err != nil || len(items) != 1 {
+		t.Fatalf("items:\t%d\nerror:\t%v", len(items), err)
+	}
+	if items[0].Value[0] != FormatColumnar || items[0].NumOfTables != 1 {
+		t.Errorf("item:\tformat 0x%02x, %d tables", items[0].Value[0], items[0].NumOfTables)
+	}
+	got, err := decodeRange(append(items[0].Value, []byte("\r\n")...), "", -1, -1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("response:\t%v\nexpected:\t%v", got, expected)
+	}
+
+	/* 空结果仍然存为 empty response */
+	if value, _ := recodeItem(StringToByteArray("empty response")); !isEmptyItem(value) {
+		t.Errorf("empty item:\t%q", value)
+	}
+}
@@ -0,0 +1,331 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/influxdata/influxdb1-client/models"
+)
+
+// TypedColumn 是结果中一张表的一列，值按数据类型放在对应的切片中：DataType 为 float64、int64、string、bool，
+// 只有对应的一个切片有值，长度和表的行数相同。空值在切片中是零值，由 Nulls 标记
+type TypedColumn struct {
+	Name     string
+	DataType string
+	Floats   []float64
+	Ints     []int64
+	Strings  []string
+	Bools    []bool
+	Nulls    []bool // 第 i 行是空值时 Nulls[i] 为 true，整列都没有空值时为 nil
+}
+
+// Len 返回列的行数
+func (tc TypedColumn) Len() int {
+	switch tc.DataType {
+	case "float64":
+		return len(tc.Floats)
+	case "int64":
+		return len(tc.Ints)
+	case "string":
+		return len(tc.Strings)
+	case "bool":
+		return len(tc.Bools)
+	}
+	return 0
+}
+
+// IsNull 返回第 i 行是否是空值
+func (tc TypedColumn) IsNull(i int) bool {
+	return tc.Nulls != nil && tc.Nulls[i]
+}
+
+// columnCache 保存一个结果中已经转换过的列，按表的序号和列名查找
+type columnCache struct {
+	mu     sync.Mutex
+	series map[int]map[string]TypedColumn
+	bytes  int64  // 转换好的列大约占用的字节数，计入 columnMemory
+	used   uint64 // 最近一次访问时 columnMemory 的 tick，由 columnMemory.mu 保护
+}
+
+// columnCacheMu 保护 Response.columns 的创建
+var columnCacheMu sync.Mutex
+
+// columnOverhead 估计一列除了值之外占用的字节数：map 的项、结构体和切片头
+const columnOverhead = 200
+
+// columnTier 统计所有结果中转换好的列大约占用的字节数。设置了内存预算时记录各个结果的列缓存，
+// 超出预算时丢弃最久没有访问的，之后再访问这些列时重新转换
+type columnTier struct {
+	bytes atomic.Int64
+
+	mu     sync.Mutex
+	tick   uint64
+	caches map[*columnCache]struct{}
+}
+
+var columnMemory = &columnTier{caches: make(map[*columnCache]struct{})}
+
+// add 记录列缓存新增了 size 字节
+func (t *columnTier) add(cache *columnCache, size int64) {
+	t.bytes.Add(size)
+	t.touch(cache)
+}
+
+// touch 更新列缓存最近一次访问的时间，没有内存预算时不记录列缓存，不影响结果被回收
+func (t *columnTier) touch(cache *columnCache) {
+	if memoryBudget.Load() <= 0 {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.tick++
+	cache.used = t.tick
+	t.caches[cache] = struct{}{}
+}
+
+// release 不再记录任何列缓存，取消内存预算时调用
+func (t *columnTier) release() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.caches = make(map[*columnCache]struct{})
+}
+
+// shrink 按最久没有访问的顺序清空记录的列缓存，直到占用的字节数不超过 target，返回清空的列缓存数
+func (t *columnTier) shrink(target int64) uint64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	caches := make([]*columnCache, 0, len(t.caches))
+	for cache := range t.caches {
+		caches = append(caches, cache)
+	}
+	sort.Slice(caches, func(i, j int) bool { return caches[i].used < caches[j].used })
+	evicted := uint64(0)
+	for _, cache := range caches {
+		if t.bytes.Load() <= target {
+			break
+		}
+		cache.mu.Lock()
+		size := cache.bytes
+		cache.series = make(map[int]map[string]TypedColumn)
+		cache.bytes = 0
+		cache.mu.Unlock()
+		t.bytes.Add(-size)
+		delete(t.caches, cache)
+		evicted++
+	}
+	return evicted
+}
+
+// Column 返回结果中第 series 张表（按所有语句的表依次编号，从 0 开始）名为 name 的列。
+// 每一列只转换一次，之后的调用返回同一组切片，不能修改；调用之后也不能再修改结果中的数据。
+// 时间列转换成 int64，RFC3339 字符串的时间戳转换成纳秒；field 的数据类型优先使用 schema 中记录的类型，
+// 没有记录时根据值推断：所有数值都是整数时为 int64，否则为 float64，整列都是空值时为 float64
+func (r *Response) Column(series int, name string) (TypedColumn, error) {
+	s, ok := r.seriesAt(series)
+	if !ok {
+		return TypedColumn{}, fmt.Errorf("series %d out of range", series)
+	}
+
+	cache := r.columnCache()
+	cache.mu.Lock()
+	tc, ok := cache.series[series][name]
+	cache.mu.Unlock()
+	if ok {
+		columnMemory.touch(cache)
+		return tc, nil
+	}
+
+	index := -1
+	for j, column := range s.Columns {
+		if column == name {
+			index = j
+			break
+		}
+	}
+	if index < 0 {
+		return TypedColumn{}, fmt.Errorf("series %d (%s) has no column %s", series, s.Name, name)
+	}
+	tc, err := buildColumn(s, index)
+	if err != nil {
+		return TypedColumn{}, err
+	}
+
+	cache.mu.Lock()
+	if cached, ok := cache.series[series][name]; ok { // 同时转换同一列时使用先存入的结果
+		cache.mu.Unlock()
+		return cached, nil
+	}
+	if cache.series[series] == nil {
+		cache.series[series] = make(map[string]TypedColumn)
+	}
+	cache.series[series][name] = tc
+	size := tc.bytes()
+	cache.bytes += size
+	cache.mu.Unlock()
+
+	columnMemory.add(cache, size)
+	enforceMemoryBudget()
+	return tc, nil
+}
+
+// bytes 估计列占用的字节数
+func (tc TypedColumn) bytes() int64 {
+	size := int64(columnOverhead + len(tc.Name) + 8*len(tc.Floats) + 8*len(tc.Ints) + 16*len(tc.Strings) + len(tc.Bools) + len(tc.Nulls))
+	for _, s := range tc.Strings {
+		size += int64(len(s))
+	}
+	return size
+}
+
+// seriesAt 返回所有语句的结果中第 i 张表
+func (r *Response) seriesAt(i int) (models.Row, bool) {
+	if i < 0 {
+		return models.Row{}, false
+	}
+	for _, result := range r.Results {
+		if i < len(result.Series) {
+			return result.Series[i], true
+		}
+		i -= len(result.Series)
+	}
+	return models.Row{}, false
+}
+
+func (r *Response) columnCache() *columnCache {
+	columnCacheMu.Lock()
+	defer columnCacheMu.Unlock()
+	if r.columns == nil {
+		r.columns = &columnCache{series: make(map[int]map[string]TypedColumn)}
+		/* 结果被回收时从 columnMemory 中减去它的列，columnMemory 记录的列缓存在丢弃之前不会被回收 */
+		runtime.SetFinalizer(r.columns, func(c *columnCache) { columnMemory.bytes.Add(-c.bytes) })
+	}
+	return r.columns
+}
+
+// buildColumn 把表中第 index 列的值转换成 TypedColumn
+func buildColumn(s models.Row, index int) (TypedColumn, error) {
+	name := s.Columns[index]
+	tc := TypedColumn{Name: name, DataType: columnDataType(s, index)}
+	n := len(s.Values)
+	switch tc.DataType {
+	case "float64":
+		tc.Floats = make([]float64, n)
+	case "int64":
+		tc.Ints = make([]int64, n)
+	case "string":
+		tc.Strings = make([]string, n)
+	case "bool":
+		tc.Bools = make([]bool, n)
+	}
+
+	for i, row := range s.Values {
+		var v interface{}
+		if index < len(row) {
+			v = row[index]
+		}
+		if v == nil {
+			if tc.Nulls == nil {
+				tc.Nulls = make([]bool, n)
+			}
+			tc.Nulls[i] = true
+			continue
+		}
+		var ok bool
+		switch tc.DataType {
+		case "float64":
+			tc.Floats[i], ok = floatValue(v)
+		case "int64":
+			if index == 0 && name == "time" {
+				tc.Ints[i], ok = timeValue(v)
+			} else {
+				tc.Ints[i], ok = intValue(v)
+			}
+		case "string":
+			tc.Strings[i], ok = v.(string)
+		case "bool":
+			tc.Bools[i], ok = v.(bool)
+		}
+		if !ok {
+			return TypedColumn{}, fmt.Errorf("column %s of %s row %d: %v is not %s", name, s.Name, i, v, tc.DataType)
+		}
+	}
+	return tc, nil
+}
+
+// columnDataType 返回表中第 index 列的数据类型
+func columnDataType(s models.Row, index int) string {
+	name := s.Columns[index]
+	if index == 0 && name == "time" {
+		return "int64"
+	}
+	if datatype, ok := CurrentSchema().FieldTypes[s.Name][name]; ok {
+		return datatype
+	}
+	datatype := ""
+	for _, row := range s.Values {
+		if index >= len(row) {
+			continue
+		}
+		switch v := row[index].(type) {
+		case string:
+			return "string"
+		case bool:
+			return "bool"
+		case float64:
+			datatype = "float64"
+		case json.Number:
+			if strings.ContainsAny(v.String(), ".eE") {
+				datatype = "float64"
+			} else if datatype == "" {
+				datatype = "int64"
+			}
+		case int64:
+			if datatype == "" {
+				datatype = "int64"
+			}
+		}
+	}
+	if datatype == "" {
+		return "float64"
+	}
+	return datatype
+}
+
+func floatValue(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	case float64:
+		return n, true
+	case int64:
+		return float64(n), true
+	}
+	return 0, false
+}
+
+func intValue(v interface{}) (int64, bool) {
+	switch n := v.(type) {
+	case json.Number:
+		i, err := n.Int64()
+		return i, err == nil
+	case int64:
+		return n, true
+	}
+	return 0, false
+}
+
+// timeValue 转换时间戳，json.Number 保持查询时的精度，RFC3339 字符串转换成纳秒
+func timeValue(v interface{}) (int64, bool) {
+	if s, ok := v.(string); ok {
+		t, err := time.Parse(time.RFC3339Nano, s)
+		return t.UnixNano(), err == nil
+	}
+	return intValue(v)
+}
@@ -0,0 +1,119 @@
+package client
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/influxdata/influxdb1-client/models"
+)
+
+func TestResponse_Column(t *testing.T) {
+	defer SetSchema(SetSchema(&Schema{FieldTypes: map[string]map[string]string{"h2o_feet": {"water_level": "float64"}}}))
+
+	resp := &Response{Results: []Result{
+		{Series: []models.Row{{
+			Name:    "h2o_feet",
+			Columns: []string{"time", "water_level", "index", "location", "ok"},
+			Values: [][]interface{}{
+				{json.Number("1566086400000000000"), json.Number("8"), json.Number("1"), "coyote_creek", true},
+				{json.Number("1566086760000000000"), json.Number("8.005"), nil, "coyote_creek", false},
+			},
+		}}},
+		{Series: []models.Row{{
+			Name:    "h2o_pH",
+			Columns: []string{"time", "pH"},
+			Values:  [][]interface{}{{"2019-08-18T00:00:00Z", json.Number("7")}, {"2019-08-18T00:06:00Z", json.Number("7.5")}},
+		}}},
+	}}
+
+	tests := []struct {
+		name     string
+		series   int
+		column   string
+		expected TypedColumn
+	}{
+		{
+			name:     "time",
+			series:   0,
+			column:   "time",
+			expected: TypedColumn{Name: "time", DataType: "int64", Ints: []int64{1566086400000000000, 1566086760000000000}},
+		},
+		{
+			name:     "schema type",
+			series:   0,
+			column:   "water_level",
+			expected: TypedColumn{Name: "water_level", DataType: "float64", Floats: []float64{8, 8.005}},
+		},
+		{
+			name:     "null",
+			series:   0,
+			column:   "index",
+			expected: TypedColumn{Name: "index", DataType: "int64", Ints: []int64{1, 0}, Nulls: []bool{false, true}},
+		},
+		{
+			name:     "string",
+			series:   0,
+			column:   "location",
+			expected: TypedColumn{Name: "location", DataType: "string", Strings: []string{"coyote_creek", "coyote_creek"}},
+		},
+		{
+			name:     "bool",
+			series:   0,
+			column:   "ok",
+			expected: TypedColumn{Name: "ok", DataType: "bool", Bools: []bool{true, false}},
+		},
+		{
+			name:     "second statement",
+			series:   1,
+			column:   "time",
+			expected: TypedColumn{Name: "time", DataType: "int64", Ints: []int64{1566086400000000000, 1566086760000000000}},
+		},
+		{
+			name:     "inferred float",
+			series:   1,
+			column:   "pH",
+			expected: TypedColumn{Name: "pH", DataType: "float64", Floats: []float64{7, 7.5}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tc, err := resp.Column(tt.series, tt.column)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(tc, tt.expected) {
+				t.Errorf("column:\t%+v\nexpected:\t%+v", tc, tt.expected)
+			}
+			if tc.Len() != 2 {
+				t.Errorf("len:\t%d\nexpected:\t%d", tc.Len(), 2)
+			}
+		})
+	}
+
+	/* 同一列只转换一次，之后返回同一个切片 */
+	first, _ := resp.Column(0, "water_level")
+	second, _ := resp.Column(0, "water_level")
+	if &first.Floats[0] != &second.Floats[0] {
+		t.Error("column converted twice")
+	}
+	if first.IsNull(0) || first.IsNull(1) {
+		t.Error("water_level has no nulls")
+	}
+
+	if _, err := resp.Column(2, "time"); err == nil {
+		t.Error("expected an error for a series out of range")
+	}
+	if _, err := resp.Column(0, "unknown"); err == nil {
+		t.Error("expected an error for an unknown column")
+	}
+
+	bad := &Response{Results: []Result{{Series: []models.Row{{
+		Name:    "h2o_feet",
+		Columns: []string{"time", "water_level"},
+		Values:  [][]interface{}{{json.Number("1"), json.Number("8")}, {json.Number("2"), "high"}},
+	}}}}}
+	if _, err := bad.Column(0, "water_level"); err == nil {
+		t.Error("expected an error for a string in a float column")
+	}
+}
@@ -0,0 +1,150 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/influxdata/influxdb1-client/models"
+)
+
+// CompareOptions 决定 ResponsesEqual 比较两个结果时的容差
+type CompareOptions struct {
+	Epsilon float64 // 浮点数允许的绝对误差，为 0 时要求完全相等
+}
+
+// NormalizeResponse 返回结果的规范形式，用于比较来源不同的结果（数据库、cache、客户端计算）：
+// 表按 measurement 和 tags 排序；时间戳统一为纳秒的 json.Number；整数保持整数形式，浮点数用不带指数的最短形式；
+// 空的 tags 统一为空 map。不修改传入的结果
+func NormalizeResponse(resp *Response) *Response {
+	if resp == nil {
+		return nil
+	}
+	result := &Response{Err: resp.Err, Results: make([]Result, len(resp.Results))}
+	for i, r := range resp.Results {
+		series := make([]models.Row, len(r.Series))
+		for j, s := range r.Series {
+			tags := make(map[string]string, len(s.Tags))
+			for k, v := range s.Tags {
+				tags[k] = v
+			}
+			values := make([][]interface{}, len(s.Values))
+			for k, row := range s.Values {
+				values[k] = make([]interface{}, len(row))
+				for l, v := range row {
+					if l == 0 {
+						if ts, ok := timestampOf(v); ok {
+							values[k][l] = json.Number(strconv.FormatInt(ts, 10))
+							continue
+						}
+					}
+					values[k][l] = normalizeValue(v)
+				}
+			}
+			series[j] = models.Row{Name: s.Name, Tags: tags, Columns: append([]string(nil), s.Columns...), Values: values, Partial: s.Partial}
+		}
+		sort.SliceStable(series, func(a, b int) bool {
+			if series[a].Name != series[b].Name {
+				return series[a].Name < series[b].Name
+			}
+			return TagsMapToString(series[a].Tags) < TagsMapToString(series[b].Tags)
+		})
+		result.Results[i] = Result{StatementId: r.StatementId, Series: series, Messages: r.Messages, Err: r.Err}
+	}
+	return result
+}
+
+// normalizeValue 统一 json.Number 的写法，如 8.0 和 8、1e+06 和 1000000 视为同一个值
+func normalizeValue(v interface{}) interface{} {
+	n, ok := v.(json.Number)
+	if !ok {
+		return v
+	}
+	if i, err := n.Int64(); err == nil {
+		return json.Number(strconv.FormatInt(i, 10))
+	}
+	if f, err := n.Float64(); err == nil {
+		if f == math.Trunc(f) && math.Abs(f) < 1<<53 {
+			return json.Number(strconv.FormatInt(int64(f), 10))
+		}
+		return json.Number(strconv.FormatFloat(f, 'f', -1, 64))
+	}
+	return v
+}
+
+// ResponsesEqual 比较两个结果规范化之后是否相同，浮点数的误差不超过 opts.Epsilon 时视为相等
+func ResponsesEqual(a, b *Response, opts CompareOptions) bool {
+	return DiffResponses(a, b, opts) == ""
+}
+
+// DiffResponses 返回两个结果规范化之后第一处不同的描述，相同时返回空字符串
+func DiffResponses(a, b *Response, opts CompareOptions) string {
+	if a == nil || b == nil {
+		if a == b {
+			return ""
+		}
+		return fmt.Sprintf("response %v != %v", a, b)
+	}
+	na, nb := NormalizeResponse(a), NormalizeResponse(b)
+	if na.Err != nb.Err {
+		return fmt.Sprintf("error %q != %q", na.Err, nb.Err)
+	}
+	if len(na.Results) != len(nb.Results) {
+		return fmt.Sprintf("results %d != %d", len(na.Results), len(nb.Results))
+	}
+	for i := range na.Results {
+		ra, rb := na.Results[i], nb.Results[i]
+		if ra.Err != rb.Err {
+			return fmt.Sprintf("result %d: error %q != %q", i, ra.Err, rb.Err)
+		}
+		if len(ra.Series) != len(rb.Series) {
+			return fmt.Sprintf("result %d: series %d != %d", i, len(ra.Series), len(rb.Series))
+		}
+		for j := range ra.Series {
+			if diff := diffSeries(ra.Series[j], rb.Series[j], opts); diff != "" {
+				return fmt.Sprintf("result %d: series %s %s: %s", i, ra.Series[j].Name, TagsMapToString(ra.Series[j].Tags), diff)
+			}
+		}
+	}
+	return ""
+}
+
+func diffSeries(a, b models.Row, opts CompareOptions) string {
+	if a.Name != b.Name || TagsMapToString(a.Tags) != TagsMapToString(b.Tags) {
+		return fmt.Sprintf("series %s %s != %s %s", a.Name, TagsMapToString(a.Tags), b.Name, TagsMapToString(b.Tags))
+	}
+	if strings.Join(a.Columns, ",") != strings.Join(b.Columns, ",") {
+		return fmt.Sprintf("columns %v != %v", a.Columns, b.Columns)
+	}
+	if len(a.Values) != len(b.Values) {
+		return fmt.Sprintf("rows %d != %d", len(a.Values), len(b.Values))
+	}
+	for i := range a.Values {
+		if len(a.Values[i]) != len(b.Values[i]) {
+			return fmt.Sprintf("row %d: %v != %v", i, a.Values[i], b.Values[i])
+		}
+		for j := range a.Values[i] {
+			if !valueEqual(a.Values[i][j], b.Values[i][j], opts.Epsilon) {
+				return fmt.Sprintf("row %d: %v != %v", i, a.Values[i], b.Values[i])
+			}
+		}
+	}
+	return ""
+}
+
+func valueEqual(a, b interface{}, epsilon float64) bool {
+	na, aok := a.(json.Number)
+	nb, bok := b.(json.Number)
+	if aok && bok {
+		if na == nb {
+			return true
+		}
+		fa, errA := na.Float64()
+		fb, errB := nb.Float64()
+		return errA == nil && errB == nil && math.Abs(fa-fb) <= epsilon
+	}
+	return a == b
+}
@@ -0,0 +1,90 @@
+package client
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/influxdata/influxdb1-client/models"
+)
+
+func TestNormalizeResponse(t *testing.T) {
+	resp := &Response{Results: []Result{{Series: []models.Row{
+		{Name: "h2o_feet", Tags: map[string]string{"location": "santa_monica"}, Columns: []string{"time", "water_level"},
+			Values: [][]interface{}{{"2019-08-18T00:00:00Z", json.Number("2.064")}}},
+		{Name: "h2o_feet", Tags: map[string]string{"location": "coyote_creek"}, Columns: []string{"time", "water_level"},
+			Values: [][]interface{}{{"2019-08-18T00:00:00Z", json.Number("8e+00")}}},
+	}}}}
+
+	normalized := NormalizeResponse(resp)
+	s := normalized.Results[0].Series
+	if s[0].Tags["location"] != "coyote_creek" || s[1].Tags["location"] != "santa_monica" {
+		t.Errorf("series order:\t%v %v", s[0].Tags, s[1].Tags)
+	}
+	if s[0].Values[0][0] != json.Number("1566086400000000000") {
+		t.Errorf("timestamp:\t%v", s[0].Values[0][0])
+	}
+	if s[0].Values[0][1] != json.Number("8") {
+		t.Errorf("value:\t%v", s[0].Values[0][1])
+	}
+	if resp.Results[0].Series[0].Tags["location"] != "santa_monica" {
+		t.Error("NormalizeResponse must not modify its input")
+	}
+}
+
+func TestResponsesEqual(t *testing.T) {
+	row := func(tags map[string]string, ts, v interface{}) models.Row {
+		return models.Row{Name: "h2o_feet", Tags: tags, Columns: []string{"time", "mean"}, Values: [][]interface{}{{ts, v}}}
+	}
+	db := &Response{Results: []Result{{Series: []models.Row{
+		row(map[string]string{"location": "coyote_creek"}, "2019-08-18T00:00:00Z", json.Number("8.0625")),
+		row(map[string]string{"location": "santa_monica"}, "2019-08-18T00:00:00Z", json.Number("2")),
+	}}}}
+
+	tests := []struct {
+		name     string
+		other    *Response
+		opts     CompareOptions
+		expected bool
+	}{
+		{
+			name: "different series order and timestamp format",
+			other: &Response{Results: []Result{{Series: []models.Row{
+				row(map[string]string{"location": "santa_monica"}, json.Number("1566086400000000000"), json.Number("2.0")),
+				row(map[string]string{"location": "coyote_creek"}, json.Number("1566086400000000000"), json.Number("8.0625")),
+			}}}},
+			expected: true,
+		},
+		{
+			name: "float within epsilon",
+			other: &Response{Results: []Result{{Series: []models.Row{
+				row(map[string]string{"location": "coyote_creek"}, "2019-08-18T00:00:00Z", json.Number("8.06250000001")),
+				row(map[string]string{"location": "santa_monica"}, "2019-08-18T00:00:00Z", json.Number("2")),
+			}}}},
+			opts:     CompareOptions{Epsilon: 1e-9},
+			expected: true,
+		},
+		{
+			name: "float without epsilon",
+			other: &Response{Results: []Result{{Series: []models.Row{
+				row(map[string]string{"location": "coyote_creek"}, "2019-08-18T00:00:00Z", json.Number("8.06250000001")),
+				row(map[string]string{"location": "santa_monica"}, "2019-08-18T00:00:00Z", json.Number("2")),
+			}}}},
+			expected: false,
+		},
+		{
+			name: "missing series",
+			other: &Response{Results: []Result{{Series: []models.Row{
+				row(map[string]string{"location": "coyote_creek"}, "2019-08-18T00:00:00Z", json.Number("8.0625")),
+			}}}},
+			expected: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if equal := ResponsesEqual(db, tt.other, tt.opts); equal != tt.expected {
+				t.Errorf("equal:\t%v\nexpected:\t%v", equal, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,393 @@
+package client
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/InfluxDB-client/memcache"
+)
+
+// EnvPrefix is the prefix of the environment variables overriding the
+// configuration file. The variable for key "max_item_bytes" of section
+// "cache" is INFLUX_CACHE_MAX_ITEM_BYTES; lists are comma separated.
+const EnvPrefix = "INFLUX_"
+
+// Config is the whole configuration of the client, the cache and the
+// caching policies, as loaded by LoadConfig.
+type Config struct {
+	Client ClientConfig `config:"client"`
+	Cache  CacheConfig  `config:"cache"`
+	Policy PolicyConfig `config:"policy"`
+}
+
+// ClientConfig configures the connection to InfluxDB. See HTTPConfig for
+// the meaning of every field.
+type ClientConfig struct {
+	Addr                string        `config:"addr"`
+	Addrs               []string      `config:"addrs"`
+	Database            string        `config:"database"`
+	Username            string        `config:"username"`
+	Password            string        `config:"password"`
+	Token               string        `config:"token"`
+	Org                 string        `config:"org"`
+	UserAgent           string        `config:"user_agent"`
+	Timeout             time.Duration `config:"timeout"`
+	InsecureSkipVerify  bool          `config:"insecure_skip_verify"`
+	Balancer            string        `config:"balancer"`
+	HealthCheckInterval time.Duration `config:"health_check_interval"`
+	MaxRetries          int           `config:"max_retries"`
+	RetryInterval       time.Duration `config:"retry_interval"`
+	ValidateWrites      bool          `config:"validate_writes"`
+	ChunkSize           int           `config:"chunk_size"`
+	AutoChunkRows       int64         `config:"auto_chunk_rows"`
+}
+
+// CacheConfig configures the cache servers and what is stored in them.
+type CacheConfig struct {
+	// Servers lists the cache servers of the form "host:port".
+	Servers []string `config:"servers"`
+
+	// MaxItemBytes and SplitItems set ItemLimit.
+	MaxItemBytes int  `config:"max_item_bytes"`
+	SplitItems   bool `config:"split_items"`
+
+	// MaxKeyLength sets MaxKeyLength.
+	MaxKeyLength int `config:"max_key_length"`
+
+	// MaxResponseBytes sets MaxResponseBytes.
+	MaxResponseBytes int `config:"max_response_bytes"`
+
+	// FieldKeysTTL, TagKeysTTL and TagValuesTTL set MetadataTTL.
+	FieldKeysTTL time.Duration `config:"field_keys_ttl"`
+	TagKeysTTL   time.Duration `config:"tag_keys_ttl"`
+	TagValuesTTL time.Duration `config:"tag_values_ttl"`
+}
+
+// PolicyConfig configures how query results are cached.
+type PolicyConfig struct {
+	// ClientAggregation sets ClientAggregation.
+	ClientAggregation bool `config:"client_aggregation"`
+
+	// Nulls sets Nulls.Policy, one of "zero", "error", "skip-row" and
+	// "sentinel".
+	Nulls string `config:"nulls"`
+
+	// CardinalityWarn and CardinalityRefuse set CardinalityLimit.
+	CardinalityWarn   int64 `config:"cardinality_warn"`
+	CardinalityRefuse int64 `config:"cardinality_refuse"`
+
+	// QuantizeStep sets the default step of Quantization, zero disables
+	// it.
+	QuantizeStep time.Duration `config:"quantize_step"`
+}
+
+var nullPolicies = map[string]NullPolicy{
+	"zero":     NullZero,
+	"error":    NullError,
+	"skip-row": NullSkipRow,
+	"sentinel": NullSentinel,
+}
+
+// DefaultConfig returns the configuration matching the package defaults,
+// with InfluxDB on localhost.
+func DefaultConfig() *Config {
+	return &Config{
+		Client: ClientConfig{Addr: "http://localhost:8086", Database: MyDB, Balancer: string(RoundRobin)},
+		Cache:  CacheConfig{Servers: []string{"localhost:11213"}, MaxItemBytes: ItemLimit.MaxBytes},
+		Policy: PolicyConfig{Nulls: "zero"},
+	}
+}
+
+// LoadConfig reads the configuration file at path, YAML if it ends in
+// ".yaml" or ".yml" and TOML if it ends in ".toml", on top of
+// DefaultConfig, then applies the environment variables starting with
+// EnvPrefix. An empty path loads the defaults and the environment only.
+//
+// Only the subset of YAML and TOML needed for the configuration is
+// understood: one level of sections holding scalars and lists of scalars.
+func LoadConfig(path string) (*Config, error) {
+	conf := DefaultConfig()
+	if path != "" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		var values map[string]string
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".yaml", ".yml":
+			values, err = parseYAMLConfig(f)
+		case ".toml":
+			values, err = parseTOMLConfig(f)
+		default:
+			return nil, fmt.Errorf("unknown config format %q", filepath.Ext(path))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		for key, value := range values {
+			if err := conf.set(key, value); err != nil {
+				return nil, fmt.Errorf("%s: %w", path, err)
+			}
+		}
+	}
+
+	for _, env := range os.Environ() {
+		name, value, _ := strings.Cut(env, "=")
+		if !strings.HasPrefix(name, EnvPrefix) {
+			continue
+		}
+		section, key, ok := strings.Cut(strings.ToLower(strings.TrimPrefix(name, EnvPrefix)), "_")
+		if _, known := configField(reflect.ValueOf(conf).Elem(), section); !ok || !known {
+			continue // other tools' variables, such as INFLUX_TOKEN of the influx CLI
+		}
+		if err := conf.set(section+"."+key, value); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return conf, conf.Validate()
+}
+
+// Validate reports values no setting accepts.
+func (conf *Config) Validate() error {
+	if conf.Client.Addr == "" {
+		return fmt.Errorf("client.addr is required")
+	}
+	switch BalanceStrategy(conf.Client.Balancer) {
+	case "", RoundRobin, LeastLatency:
+	default:
+		return fmt.Errorf("unknown client.balancer %q", conf.Client.Balancer)
+	}
+	if _, ok := nullPolicies[conf.Policy.Nulls]; !ok {
+		return fmt.Errorf("unknown policy.nulls %q", conf.Policy.Nulls)
+	}
+	if len(conf.Cache.Servers) == 0 {
+		return fmt.Errorf("cache.servers is required")
+	}
+	return nil
+}
+
+// HTTPConfig returns the HTTPConfig for NewHTTPClient.
+func (conf *Config) HTTPConfig() HTTPConfig {
+	return HTTPConfig{
+		Addr:                conf.Client.Addr,
+		Addrs:               conf.Client.Addrs,
+		Username:            conf.Client.Username,
+		Password:            conf.Client.Password,
+		Token:               conf.Client.Token,
+		Org:                 conf.Client.Org,
+		UserAgent:           conf.Client.UserAgent,
+		Timeout:             conf.Client.Timeout,
+		InsecureSkipVerify:  conf.Client.InsecureSkipVerify,
+		Balancer:            BalanceStrategy(conf.Client.Balancer),
+		HealthCheckInterval: conf.Client.HealthCheckInterval,
+		MaxRetries:          conf.Client.MaxRetries,
+		RetryInterval:       conf.Client.RetryInterval,
+		ValidateWrites:      conf.Client.ValidateWrites,
+		ChunkSize:           conf.Client.ChunkSize,
+		AutoChunkRows:       conf.Client.AutoChunkRows,
+	}
+}
+
+// NewCache returns a client of the configured cache servers.
+func (conf *Config) NewCache() *memcache.Client {
+	return memcache.New(conf.Cache.Servers...)
+}
+
+// Apply sets the package level cache settings and policies to conf.
+func (conf *Config) Apply() error {
+	if err := conf.Validate(); err != nil {
+		return err
+	}
+	ItemLimit = ItemSizeLimit{MaxBytes: conf.Cache.MaxItemBytes, Split: conf.Cache.SplitItems}
+	MaxKeyLength = conf.Cache.MaxKeyLength
+	MaxResponseBytes = conf.Cache.MaxResponseBytes
+	MetadataTTL = MetadataTTLs{FieldKeys: conf.Cache.FieldKeysTTL, TagKeys: conf.Cache.TagKeysTTL, TagValues: conf.Cache.TagValuesTTL}
+	ClientAggregation = conf.Policy.ClientAggregation
+	Nulls.Policy = nullPolicies[conf.Policy.Nulls]
+	CardinalityLimit = CardinalityLimits{Warn: conf.Policy.CardinalityWarn, Refuse: conf.Policy.CardinalityRefuse}
+	Quantization = nil
+	if conf.Policy.QuantizeStep > 0 {
+		Quantization = NewQuantizer(conf.Policy.QuantizeStep)
+	}
+	return nil
+}
+
+// set assigns value to the field tagged with key, which has the form
+// "section.name". Lists are comma separated.
+func (conf *Config) set(key, value string) error {
+	section, name, ok := strings.Cut(key, ".")
+	if !ok {
+		return fmt.Errorf("key %q is outside a section", key)
+	}
+	field, ok := configField(reflect.ValueOf(conf).Elem(), section)
+	if !ok {
+		return fmt.Errorf("unknown section %q", section)
+	}
+	if field, ok = configField(field, name); !ok {
+		return fmt.Errorf("unknown key %q", key)
+	}
+
+	var err error
+	switch field.Interface().(type) {
+	case string:
+		field.SetString(value)
+	case []string:
+		list := make([]string, 0)
+		for _, v := range strings.Split(value, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				list = append(list, v)
+			}
+		}
+		field.Set(reflect.ValueOf(list))
+	case bool:
+		var b bool
+		b, err = strconv.ParseBool(value)
+		field.SetBool(b)
+	case time.Duration:
+		var d time.Duration
+		d, err = time.ParseDuration(value)
+		field.SetInt(int64(d))
+	case int, int64:
+		var n int64
+		n, err = strconv.ParseInt(value, 10, 64)
+		field.SetInt(n)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid %s %q: %w", key, value, err)
+	}
+	return nil
+}
+
+// configField returns the field of struct v tagged with name.
+func configField(v reflect.Value, name string) (reflect.Value, bool) {
+	for i := 0; i < v.NumField(); i++ {
+		if v.Type().Field(i).Tag.Get("config") == name {
+			return v.Field(i), true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+// parseYAMLConfig reads top level sections of "key: value" pairs. A list
+// is either inline, "[a, b]", or one "- item" per line below its key.
+func parseYAMLConfig(r io.Reader) (map[string]string, error) {
+	values := make(map[string]string)
+	section, list := "", ""
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := stripConfigComment(scanner.Text())
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || trimmed == "---" {
+			continue
+		}
+		indented := line[0] == ' ' || line[0] == '\t'
+
+		if item, ok := strings.CutPrefix(trimmed, "- "); ok && indented && list != "" {
+			if values[list] != "" {
+				values[list] += ","
+			}
+			values[list] += unquoteConfigValue(item)
+			continue
+		}
+		key, value, ok := strings.Cut(trimmed, ":")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected \"key: value\"", n)
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		list = ""
+		if !indented {
+			if value != "" {
+				return nil, fmt.Errorf("line %d: key %q is outside a section", n, key)
+			}
+			section = key
+			continue
+		}
+		if section == "" {
+			return nil, fmt.Errorf("line %d: key %q is outside a section", n, key)
+		}
+		key = section + "." + key
+		if value == "" {
+			list = key
+		}
+		values[key] = parseConfigValue(value)
+	}
+	return values, scanner.Err()
+}
+
+// parseTOMLConfig reads "[section]" tables of "key = value" pairs, lists
+// are written inline, ["a", "b"].
+func parseTOMLConfig(r io.Reader) (map[string]string, error) {
+	values := make(map[string]string)
+	section := ""
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(stripConfigComment(scanner.Text()))
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected \"key = value\"", n)
+		}
+		if section == "" {
+			return nil, fmt.Errorf("line %d: key %q is outside a section", n, strings.TrimSpace(key))
+		}
+		values[section+"."+strings.TrimSpace(key)] = parseConfigValue(strings.TrimSpace(value))
+	}
+	return values, scanner.Err()
+}
+
+// parseConfigValue unquotes a scalar and joins an inline list with commas.
+func parseConfigValue(value string) string {
+	if !strings.HasPrefix(value, "[") || !strings.HasSuffix(value, "]") {
+		return unquoteConfigValue(value)
+	}
+	items := make([]string, 0)
+	for _, item := range strings.Split(value[1:len(value)-1], ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, unquoteConfigValue(item))
+		}
+	}
+	return strings.Join(items, ",")
+}
+
+func unquoteConfigValue(value string) string {
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+		if s, err := strconv.Unquote(value); value[0] == '"' && err == nil {
+			return s
+		}
+		return value[1 : len(value)-1]
+	}
+	return value
+}
+
+// stripConfigComment removes a "#" comment that is not inside quotes.
+func stripConfigComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		switch {
+		case quote != 0:
+			if line[i] == quote {
+				quote = 0
+			}
+		case line[i] == '"' || line[i] == '\'':
+			quote = line[i]
+		case line[i] == '#':
+			return line[:i]
+		}
+	}
+	return line
+}
@@ -0,0 +1,122 @@
+package client
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLoadConfig(t *testing.T) {
+	yaml := `# InfluxDB and cache
+client:
+  addr: "http://influxdb:8086"
+  addrs: [http://replica1:8086, 'http://replica2:8086']
+  timeout: 5s
+  balancer: least-latency
+cache:
+  servers:
+    - cache1:11211
+    - cache2:11211   # second server
+  max_item_bytes: 4096
+  tag_values_ttl: 1m
+policy:
+  nulls: sentinel
+  client_aggregation: true
+`
+	toml := `# InfluxDB and cache
+[client]
+addr = "http://influxdb:8086"
+addrs = ["http://replica1:8086", "http://replica2:8086"]
+timeout = "5s"
+balancer = "least-latency"
+
+[cache]
+servers = ["cache1:11211", "cache2:11211"] # second server
+max_item_bytes = 4096
+tag_values_ttl = "1m"
+
+[policy]
+nulls = "sentinel"
+client_aggregation = true
+`
+	expected := DefaultConfig()
+	expected.Client.Addr = "http://influxdb:8086"
+	expected.Client.Addrs = []string{"http://replica1:8086", "http://replica2:8086"}
+	expected.Client.Timeout = 5 * time.Second
+	expected.Client.Balancer = "least-latency"
+	expected.Client.Token = "from-env"
+	expected.Cache.Servers = []string{"cache1:11211", "cache2:11211"}
+	expected.Cache.MaxItemBytes = 1 << 20
+	expected.Cache.TagValuesTTL = time.Minute
+	expected.Policy.Nulls = "sentinel"
+	expected.Policy.ClientAggregation = true
+
+	t.Setenv("INFLUX_CLIENT_TOKEN", "from-env")
+	t.Setenv("INFLUX_CACHE_MAX_ITEM_BYTES", "1048576")
+	t.Setenv("INFLUX_TOKEN", "not ours") // 其他工具的环境变量被忽略
+
+	dir := t.TempDir()
+	for name, content := range map[string]string{"client.yaml": yaml, "client.toml": toml} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(dir, name)
+			os.WriteFile(path, []byte(content), 0o644)
+			conf, err := LoadConfig(path)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(conf, expected) {
+				t.Errorf("config:\t%+v\nexpected:\t%+v", conf, expected)
+			}
+			if hc := conf.HTTPConfig(); hc.Balancer != LeastLatency || hc.Token != "from-env" {
+				t.Errorf("http config:\t%+v", hc)
+			}
+		})
+	}
+}
+
+func TestLoadConfig_Errors(t *testing.T) {
+	dir := t.TempDir()
+	tests := map[string]string{
+		"unknown.yaml":  "client:\n  address: http://influxdb:8086\n",
+		"outside.yaml":  "addr: http://influxdb:8086\n",
+		"invalid.toml":  "[client]\ntimeout = \"five seconds\"\n",
+		"policy.toml":   "[policy]\nnulls = \"drop\"\n",
+		"format.json":   "{}",
+		"balancer.toml": "[client]\nbalancer = \"random\"\n",
+	}
+	for name, content := range tests {
+		path := filepath.Join(dir, name)
+		os.WriteFile(path, []byte(content), 0o644)
+		if _, err := LoadConfig(path); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestConfig_Apply(t *testing.T) {
+	itemLimit, clientAggregation, nulls, metadataTTL, quantization := ItemLimit, ClientAggregation, Nulls, MetadataTTL, Quantization
+	defer func() {
+		ItemLimit, ClientAggregation, Nulls, MetadataTTL, Quantization = itemLimit, clientAggregation, nulls, metadataTTL, quantization
+	}()
+
+	conf := DefaultConfig()
+	conf.Cache.MaxItemBytes = 512
+	conf.Policy.ClientAggregation = true
+	conf.Policy.Nulls = "skip-row"
+	conf.Cache.FieldKeysTTL = time.Hour
+	conf.Policy.QuantizeStep = time.Minute
+	if err := conf.Apply(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ItemLimit.MaxBytes != 512 || !ClientAggregation || Nulls.Policy != NullSkipRow {
+		t.Errorf("item limit:\t%v\nclient aggregation:\t%v\nnulls:\t%v", ItemLimit, ClientAggregation, Nulls.Policy)
+	}
+	if MetadataTTL != (MetadataTTLs{FieldKeys: time.Hour}) {
+		t.Errorf("metadata ttl:\t%+v", MetadataTTL)
+	}
+	if Quantization == nil || Quantization.Step("SELECT usage FROM cpu") != time.Minute {
+		t.Errorf("quantization:\t%+v", Quantization)
+	}
+}
@@ -0,0 +1,197 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/influxdata/influxql"
+)
+
+// DefaultCopyBatchSize is the number of points per chunk and per
+// BatchPoints when CopyMeasurement is given no batch size.
+const DefaultCopyBatchSize = 5000
+
+// CopyProgress reports how far CopyMeasurement got. Next is the start of the
+// first time window that was not completely written; a copy resumed from it
+// rewrites at most one window, which InfluxDB overwrites with the same points.
+type CopyProgress struct {
+	Points int   // points written so far
+	Next   int64 // nanoseconds
+}
+
+// CopyOptions is the optional configuration of CopyMeasurement.
+type CopyOptions struct {
+	// SrcDatabase and DstDatabase are the databases to copy from and to,
+	// both default to MyDB.
+	SrcDatabase string
+	DstDatabase string
+
+	// DstRetentionPolicy is the retention policy of the written points,
+	// optional.
+	DstRetentionPolicy string
+
+	// Window splits the time range into windows copied one after the other,
+	// the unit of resuming. Zero copies the whole range as one window.
+	Window time.Duration
+
+	// Progress is called after every written batch.
+	Progress func(CopyProgress)
+
+	// Resume continues a copy that stopped with the returned progress.
+	Resume *CopyProgress
+}
+
+// CopyMeasurement copies the points of measurement in timeRange (inclusive,
+// in nanoseconds) from src to dst. It reads every window with a chunked
+// query of batchSize rows per chunk, converts the rows back to points with
+// ResponseToPoints using the field types of the source, and writes them in
+// batches of batchSize points. On error the returned progress can be passed
+// as CopyOptions.Resume to continue.
+func CopyMeasurement(src, dst Client, measurement string, timeRange Interval, batchSize int, opts CopyOptions) (CopyProgress, error) {
+	if batchSize <= 0 {
+		batchSize = DefaultCopyBatchSize
+	}
+	if opts.SrcDatabase == "" {
+		opts.SrcDatabase = MyDB
+	}
+	if opts.DstDatabase == "" {
+		opts.DstDatabase = MyDB
+	}
+	progress := CopyProgress{Next: timeRange.Start}
+	if opts.Resume != nil {
+		progress = *opts.Resume
+		if progress.Next < timeRange.Start {
+			progress.Next = timeRange.Start
+		}
+	}
+
+	fieldKeys, err := ShowFieldKeys(src, opts.SrcDatabase)
+	if err != nil {
+		return progress, fmt.Errorf("copy %s: %w", measurement, err)
+	}
+	types := fieldTypes(fieldKeys)
+
+	bpConf := BatchPointsConfig{Database: opts.DstDatabase, RetentionPolicy: opts.DstRetentionPolicy}
+	pending := make([]*Point, 0, batchSize)
+	flush := func() error {
+		if len(pending) == 0 {
+			return nil
+		}
+		bp, _ := NewBatchPoints(bpConf)
+		bp.AddPoints(pending)
+		if err := dst.Write(bp); err != nil {
+			return fmt.Errorf("copy %s: write %d points: %w", measurement, len(pending), err)
+		}
+		progress.Points += len(pending)
+		pending = pending[:0]
+		if opts.Progress != nil {
+			opts.Progress(progress)
+		}
+		return nil
+	}
+
+	for progress.Next <= timeRange.End {
+		end := timeRange.End
+		if opts.Window > 0 && progress.Next+int64(opts.Window)-1 < end {
+			end = progress.Next + int64(opts.Window) - 1
+		}
+		q := NewQuery(fmt.Sprintf("SELECT * FROM %s WHERE time >= %d AND time <= %d GROUP BY *",
+			influxql.QuoteIdent(measurement), progress.Next, end), opts.SrcDatabase, "ns")
+		q.Chunked = true
+		q.ChunkSize = batchSize
+		cr, err := src.QueryAsChunk(q)
+		if err != nil {
+			return progress, fmt.Errorf("copy %s: %w", measurement, err)
+		}
+		err = cr.ForEach(func(chunk *Response) error {
+			if err := chunk.Error(); err != nil {
+				return err
+			}
+			points, err := ResponseToPoints(chunk, types)
+			if err != nil {
+				return err
+			}
+			for _, pt := range points {
+				pending = append(pending, pt)
+				if len(pending) >= batchSize {
+					if err := flush(); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		})
+		if err == nil {
+			err = flush()
+		}
+		if err != nil {
+			pending = pending[:0]
+			return progress, fmt.Errorf("copy %s: %w", measurement, err)
+		}
+		progress.Next = end + 1
+		if opts.Progress != nil {
+			opts.Progress(progress)
+		}
+	}
+	return progress, nil
+}
+
+// ResponseToPoints converts the rows of a query result back into points,
+// the inverse of querying them: the first column is the time, the other
+// non-null columns are fields and the series tags, as returned with
+// GROUP BY *, are the tags. types holds the data type of every field of
+// every measurement, in the form of FieldTypes, so integer fields stay
+// integers; numbers of fields of unknown type are integers when they have no
+// fraction or exponent, and floats otherwise.
+func ResponseToPoints(resp *Response, types map[string]map[string]string) ([]*Point, error) {
+	points := make([]*Point, 0)
+	for _, r := range resp.Results {
+		for _, s := range r.Series {
+			for _, row := range s.Values {
+				if len(row) == 0 {
+					continue
+				}
+				ts, ok := timestampOf(row[0])
+				if !ok {
+					return nil, fmt.Errorf("%s: invalid time %v", s.Name, row[0])
+				}
+				fields := make(map[string]interface{}, len(row)-1)
+				for j := 1; j < len(row) && j < len(s.Columns); j++ {
+					if row[j] == nil {
+						continue
+					}
+					v, err := pointFieldValue(row[j], types[s.Name][s.Columns[j]])
+					if err != nil {
+						return nil, fmt.Errorf("%s: field %s: %w", s.Name, s.Columns[j], err)
+					}
+					fields[s.Columns[j]] = v
+				}
+				if len(fields) == 0 {
+					continue
+				}
+				pt, err := NewPoint(s.Name, s.Tags, fields, time.Unix(0, ts))
+				if err != nil {
+					return nil, err
+				}
+				points = append(points, pt)
+			}
+		}
+	}
+	return points, nil
+}
+
+// pointFieldValue converts a value of a query result into a field value of
+// the data type.
+func pointFieldValue(v interface{}, datatype string) (interface{}, error) {
+	n, ok := v.(json.Number)
+	if !ok {
+		return v, nil // strings and booleans
+	}
+	switch {
+	case datatype == "int64", datatype == "" && !strings.ContainsAny(n.String(), ".eE"):
+		return n.Int64()
+	}
+	return n.Float64()
+}
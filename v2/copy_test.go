@@ -0,0 +1,150 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/influxdata/influxdb1-client/models"
+)
+
+/* 源数据库：h2o 每 5ns 一个点，按查询的时间范围逐行分块返回 */
+func newCopySource(t *testing.T) *httptest.Server {
+	timeRange := regexp.MustCompile(`time >= (\d+) AND time <= (\d+)`)
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		q := r.FormValue("q")
+		if strings.HasPrefix(q, "SHOW FIELD KEYS") {
+			w.Write([]byte(`{"results":[{"statement_id":0,"series":[{"name":"h2o","columns":["fieldKey","fieldType"],"values":[["level","float"],["index","integer"],["note","string"]]}]}]}`))
+			return
+		}
+		m := timeRange.FindStringSubmatch(q)
+		if m == nil || r.FormValue("chunked") != "true" || r.FormValue("epoch") != "ns" {
+			t.Errorf("unexpected query:\t%s", r.URL.RawQuery)
+			return
+		}
+		start, _ := strconv.Atoi(m[1])
+		end, _ := strconv.Atoi(m[2])
+		for ts := (start + 4) / 5 * 5; ts <= end; ts += 5 {
+			fmt.Fprintf(w, `{"results":[{"statement_id":0,"series":[{"name":"h2o","tags":{"location":"coyote_creek"},"columns":["time","index","level","note"],"values":[[%d,%d,%d,null]]}],"partial":true}]}`+"\n", ts, ts, ts*2)
+		}
+	}))
+}
+
+func TestCopyMeasurement(t *testing.T) {
+	src := newCopySource(t)
+	defer src.Close()
+	var mu sync.Mutex
+	var lines []string
+	failAt := 20 // 写入这个时间戳的点时失败一次
+	dst := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		var body bytes.Buffer
+		io.Copy(&body, r.Body)
+		if r.FormValue("db") != "copied" {
+			t.Errorf("db:\t%s\nexpected:\t%s", r.FormValue("db"), "copied")
+		}
+		if failAt >= 0 && strings.Contains(body.String(), " "+strconv.Itoa(failAt)+"\n") {
+			failAt = -1
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(`{"error":"timeout"}`))
+			return
+		}
+		lines = append(lines, strings.Split(strings.TrimSpace(body.String()), "\n")...)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer dst.Close()
+	srcClient, _ := NewHTTPClient(HTTPConfig{Addr: src.URL})
+	defer srcClient.Close()
+	dstClient, _ := NewHTTPClient(HTTPConfig{Addr: dst.URL})
+	defer dstClient.Close()
+
+	var reported []CopyProgress
+	opts := CopyOptions{
+		SrcDatabase: "source",
+		DstDatabase: "copied",
+		Window:      10 * time.Nanosecond,
+		Progress:    func(p CopyProgress) { reported = append(reported, p) },
+	}
+
+	/* 第三个窗口写入失败，进度停在它的起点 */
+	progress, err := CopyMeasurement(srcClient, dstClient, "h2o", Interval{Start: 0, End: 29}, 1, opts)
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if expected := (CopyProgress{Points: 4, Next: 20}); progress != expected {
+		t.Errorf("progress:\t%+v\nexpected:\t%+v", progress, expected)
+	}
+	if len(reported) != 6 || reported[5] != progress {
+		t.Errorf("reported:\t%+v", reported)
+	}
+
+	/* 从返回的进度继续 */
+	opts.Resume = &progress
+	progress, err = CopyMeasurement(srcClient, dstClient, "h2o", Interval{Start: 0, End: 29}, 1, opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := (CopyProgress{Points: 6, Next: 30}); progress != expected {
+		t.Errorf("progress:\t%+v\nexpected:\t%+v", progress, expected)
+	}
+	expected := []string{
+		"h2o,location=coyote_creek index=0i,level=0 0",
+		"h2o,location=coyote_creek index=5i,level=10 5",
+		"h2o,location=coyote_creek index=10i,level=20 10",
+		"h2o,location=coyote_creek index=15i,level=30 15",
+		"h2o,location=coyote_creek index=20i,level=40 20",
+		"h2o,location=coyote_creek index=25i,level=50 25",
+	}
+	if strings.Join(lines, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("lines:\n%s\nexpected:\n%s", strings.Join(lines, "\n"), strings.Join(expected, "\n"))
+	}
+}
+
+func TestResponseToPoints(t *testing.T) {
+	resp := &Response{Results: []Result{{Series: []models.Row{
+		{Name: "h2o", Tags: map[string]string{"location": "santa_monica"}, Columns: []string{"time", "degrees", "level", "note", "ok"}, Values: [][]interface{}{
+			{"2019-08-18T00:00:00Z", json.Number("4"), json.Number("3"), "low", true},
+			{"2019-08-18T00:06:00Z", json.Number("5"), nil, nil, nil},
+			{"2019-08-18T00:12:00Z", nil, nil, nil, nil},
+		}},
+		{Name: "cpu", Columns: []string{"time", "usage"}, Values: [][]interface{}{
+			{json.Number("1566086400000000000"), json.Number("2.5")},
+		}},
+	}}}}
+	types := map[string]map[string]string{"h2o": {"level": "float64"}}
+
+	/* level 按源的类型写成浮点数，类型未知的 degrees 按数字的写法，全为空的行被跳过 */
+	points, err := ResponseToPoints(resp, types)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []string{
+		`h2o,location=santa_monica degrees=4i,level=3,note="low",ok=true 1566086400000000000`,
+		`h2o,location=santa_monica degrees=5i 1566086760000000000`,
+		`cpu usage=2.5 1566086400000000000`,
+	}
+	if len(points) != len(expected) {
+		t.Fatalf("points:\t%v\nexpected:\t%v", points, expected)
+	}
+	for i, pt := range points {
+		if pt.String() != expected[i] {
+			t.Errorf("point:\t%s\nexpected:\t%s", pt.String(), expected[i])
+		}
+	}
+
+	resp.Results[0].Series[1].Values[0][0] = "yesterday"
+	if _, err := ResponseToPoints(resp, types); err == nil {
+		t.Error("expected error for invalid time")
+	}
+}
@@ -0,0 +1,152 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/influxdata/influxql"
+)
+
+// QueryCost 是查询结果规模的粗略估计
+type QueryCost struct {
+	Series int64 // 结果的表数
+	Rows   int64 // 所有表的总行数
+	Fields int   // 每行除 time 之外的列数
+	Bytes  int64 // 结果存入cache的字节数，数值列按 8 字节计算
+}
+
+// RawPointInterval 是估计原始数据查询的行数时假设的采样间隔，默认是 NOAA_water_database 的 6 分钟
+var RawPointInterval = 6 * time.Minute
+
+// ErrUnboundedQuery 表示查询既没有时间范围的下界也没有 LIMIT，无法估计行数
+var ErrUnboundedQuery = errors.New("query has neither a time range nor a LIMIT")
+
+// EstimateCost 用时间范围的长度、GROUP BY time() 的间隔、schema 缓存（TagKV、Fields）中的 tag 值数量和 field 数量估计查询结果的规模，
+// 可以在执行代价很高的扫描之前给出警告或者拒绝。WHERE 中 tag = 'value' 的条件让这个 tag 只贡献一张表，其他 tag 条件不考虑
+func EstimateCost(queryString string) (QueryCost, error) {
+	stmt, err := influxql.ParseStatement(queryString)
+	if err != nil {
+		return QueryCost{}, err
+	}
+	s, ok := stmt.(*influxql.SelectStatement)
+	if !ok {
+		return QueryCost{}, fmt.Errorf("%w: not a SELECT statement: %s", ErrUnsupportedQuery, queryString)
+	}
+
+	/* 每张表的行数：时间范围内的区间数，再受 LIMIT 限制 */
+	var rowsPerSeries int64
+	startTime, endTime, _ := GetQueryTimeRange(queryString)
+	if startTime >= 0 {
+		interval, _ := s.GroupByInterval()
+		switch {
+		case interval > 0:
+			rowsPerSeries = (endTime-startTime)/int64(interval) + 1
+		case GetAggregation(queryString).Func != "":
+			rowsPerSeries = 1 // 没有 GROUP BY time() 的聚合查询每张表只有一行
+		default:
+			rowsPerSeries = (endTime-startTime)/int64(RawPointInterval) + 1
+		}
+	}
+	if s.Limit > 0 && (startTime < 0 || int64(s.Limit) < rowsPerSeries) {
+		rowsPerSeries = int64(s.Limit)
+	}
+	if startTime < 0 && s.Limit <= 0 {
+		return QueryCost{}, fmt.Errorf("%w: %s", ErrUnboundedQuery, queryString)
+	}
+
+	equalTags := equalTagPredicates(s.Condition)
+	cost := QueryCost{}
+	for _, source := range s.Sources {
+		m, ok := source.(*influxql.Measurement)
+		if !ok || m.Name == "" {
+			continue
+		}
+		cost.Series += seriesEstimate(s, m.Name, equalTags)
+		if fields := fieldEstimate(s, m.Name); fields > cost.Fields {
+			cost.Fields = fields
+		}
+	}
+	if s.SLimit > 0 && int64(s.SLimit) < cost.Series {
+		cost.Series = int64(s.SLimit)
+	}
+
+	cost.Rows = cost.Series * rowsPerSeries
+	cost.Bytes = cost.Rows * int64(8+8*cost.Fields)
+	return cost, nil
+}
+
+// seriesEstimate 用 TagKV 估计一张表按 GROUP BY 划分出的表数：每个 GROUP BY tag 的值数量相乘
+func seriesEstimate(s *influxql.SelectStatement, measurement string, equalTags map[string]bool) int64 {
+	values := make(map[string]int)
+	for _, tkm := range CurrentSchema().TagKV.Measurement[measurement] {
+		for key, tv := range tkm.Tag {
+			values[key] = len(tv.Values)
+		}
+	}
+
+	series := int64(1)
+	multiply := func(tag string) {
+		if n := values[tag]; n > 0 && !equalTags[tag] {
+			series *= int64(n)
+		}
+	}
+	for _, d := range s.Dimensions {
+		switch expr := d.Expr.(type) {
+		case *influxql.VarRef:
+			multiply(expr.Val)
+		case *influxql.Wildcard:
+			for tag := range values {
+				multiply(tag)
+			}
+		}
+	}
+	return series
+}
+
+// fieldEstimate 返回查询的列数，SELECT * 时是 Fields 中这张表的 field 数量
+func fieldEstimate(s *influxql.SelectStatement, measurement string) int {
+	fields := 0
+	known := CurrentSchema().Fields[measurement]
+	for _, f := range s.Fields {
+		if _, ok := f.Expr.(*influxql.Wildcard); ok {
+			fields += len(known)
+			continue
+		}
+		if call, ok := f.Expr.(*influxql.Call); ok && len(call.Args) > 0 {
+			if _, ok := call.Args[0].(*influxql.Wildcard); ok {
+				fields += len(known)
+				continue
+			}
+		}
+		fields++
+	}
+	return fields
+}
+
+// equalTagPredicates 返回 WHERE 中用 AND 连接的 tag = 'value' 条件中的 tag
+func equalTagPredicates(cond influxql.Expr) map[string]bool {
+	tags := make(map[string]bool)
+	var walk func(expr influxql.Expr)
+	walk = func(expr influxql.Expr) {
+		switch e := expr.(type) {
+		case *influxql.ParenExpr:
+			walk(e.Expr)
+		case *influxql.BinaryExpr:
+			switch e.Op {
+			case influxql.AND:
+				walk(e.LHS)
+				walk(e.RHS)
+			case influxql.EQ:
+				ref, ok := e.LHS.(*influxql.VarRef)
+				if _, isString := e.RHS.(*influxql.StringLiteral); ok && isString {
+					tags[ref.Val] = true
+				}
+			}
+		}
+	}
+	if cond != nil {
+		walk(cond)
+	}
+	return tags
+}
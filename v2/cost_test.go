@@ -0,0 +1,66 @@
+package client
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestEstimateCost(t *testing.T) {
+	defer SetSchema(SetSchema(&Schema{
+		Fields: map[string][]string{"h2o_feet": {"level description", "water_level"}},
+		TagKV: MeasurementTagMap{Measurement: map[string][]TagKeyMap{
+			"h2o_feet": {
+				{Tag: map[string]TagValues{"location": {Values: []string{"coyote_creek", "santa_monica"}}}},
+				{Tag: map[string]TagValues{"randtag": {Values: []string{"1", "2", "3"}}}},
+			},
+		}},
+	}))
+
+	tests := []struct {
+		name        string
+		queryString string
+		expected    QueryCost
+	}{
+		{
+			name:        "raw data of one hour",
+			queryString: "SELECT water_level FROM h2o_feet WHERE time >= '2019-08-18T00:00:00Z' AND time < '2019-08-18T01:00:00Z'",
+			expected:    QueryCost{Series: 1, Rows: 10, Fields: 1, Bytes: 160},
+		},
+		{
+			name:        "group by time and tags",
+			queryString: "SELECT MEAN(water_level) FROM h2o_feet WHERE time >= '2019-08-18T00:00:00Z' AND time < '2019-08-18T01:00:00Z' GROUP BY time(12m), location, randtag",
+			expected:    QueryCost{Series: 6, Rows: 30, Fields: 1, Bytes: 480},
+		},
+		{
+			name:        "tag fixed by WHERE",
+			queryString: "SELECT * FROM h2o_feet WHERE location = 'coyote_creek' AND time >= '2019-08-18T00:00:00Z' AND time < '2019-08-18T01:00:00Z' GROUP BY *",
+			expected:    QueryCost{Series: 3, Rows: 30, Fields: 2, Bytes: 720},
+		},
+		{
+			name:        "aggregation without time interval",
+			queryString: "SELECT MAX(water_level) FROM h2o_feet WHERE time >= '2019-08-18T00:00:00Z' AND time < '2019-08-19T00:00:00Z' GROUP BY location",
+			expected:    QueryCost{Series: 2, Rows: 2, Fields: 1, Bytes: 32},
+		},
+		{
+			name:        "limit without time range",
+			queryString: "SELECT water_level FROM h2o_feet LIMIT 5",
+			expected:    QueryCost{Series: 1, Rows: 5, Fields: 1, Bytes: 80},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cost, err := EstimateCost(tt.queryString)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cost != tt.expected {
+				t.Errorf("cost:\t%+v\nexpected:\t%+v", cost, tt.expected)
+			}
+		})
+	}
+
+	if _, err := EstimateCost("SELECT water_level FROM h2o_feet"); !errors.Is(err, ErrUnboundedQuery) {
+		t.Errorf("error:\t%v\nexpected:\t%v", err, ErrUnboundedQuery)
+	}
+}
@@ -0,0 +1,157 @@
+package client
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/InfluxDB-client/memcache"
+	"github.com/influxdata/influxql"
+)
+
+// CoverageIndex 记录每个语义段在cache中已经存入的时间范围，用来判断查询的哪些时间范围需要查询数据库；
+// 同时统计每个语义段的命中次数和最后访问时间，可以用 Save 和 Load 保存到磁盘，见 catalog.go
+type CoverageIndex struct {
+	mu      sync.RWMutex
+	entries map[string]*coverageEntry
+}
+
+// coverageEntry 是一个语义段的覆盖范围和访问统计
+type coverageEntry struct {
+	intervals  []Interval
+	hits       uint64
+	lastAccess time.Time
+}
+
+// Coverage 是 Set 存入cache时更新的覆盖范围索引
+var Coverage = NewCoverageIndex()
+
+// NewCoverageIndex 返回一个空的覆盖范围索引
+func NewCoverageIndex() *CoverageIndex {
+	return &CoverageIndex{entries: make(map[string]*coverageEntry)}
+}
+
+// Add 记录语义段 segment 覆盖了时间范围 interval，和已有的相交或相邻的时间范围合并
+func (ci *CoverageIndex) Add(segment string, interval Interval) {
+	if interval.Start > interval.End {
+		return
+	}
+	ci.mu.Lock()
+	defer ci.mu.Unlock()
+	e, ok := ci.entries[segment]
+	if !ok {
+		e = &coverageEntry{lastAccess: time.Now()}
+		ci.entries[segment] = e
+	}
+	e.intervals = mergeIntervals(append(e.intervals, interval))
+}
+
+// Covered 返回语义段已经覆盖的时间范围，按起始时间升序排列，互不相交
+func (ci *CoverageIndex) Covered(segment string) ([]Interval, bool) {
+	ci.mu.RLock()
+	defer ci.mu.RUnlock()
+	e, ok := ci.entries[segment]
+	if !ok {
+		return nil, false
+	}
+	return append([]Interval(nil), e.intervals...), true
+}
+
+// Hit 记录一次从cache读到了语义段的数据，没有覆盖范围记录的语义段不统计
+func (ci *CoverageIndex) Hit(segment string) {
+	ci.mu.Lock()
+	defer ci.mu.Unlock()
+	if e, ok := ci.entries[segment]; ok {
+		e.hits++
+		e.lastAccess = time.Now()
+	}
+}
+
+// Segments 返回所有有覆盖范围记录的语义段
+func (ci *CoverageIndex) Segments() []string {
+	ci.mu.RLock()
+	defer ci.mu.RUnlock()
+	segments := make([]string, 0, len(ci.entries))
+	for segment := range ci.entries {
+		segments = append(segments, segment)
+	}
+	sort.Strings(segments)
+	return segments
+}
+
+// Remove 删除语义段的覆盖范围记录，cache中的数据被删除或过期时调用
+func (ci *CoverageIndex) Remove(segment string) {
+	ci.mu.Lock()
+	defer ci.mu.Unlock()
+	delete(ci.entries, segment)
+}
+
+// FindGaps 返回 [start, end] 中语义段 segment 在cache中没有覆盖的时间范围，用来生成只查询缺失部分的查询语句
+// 覆盖范围索引中有这个语义段时直接使用索引，否则用 GetFragmentResponse 探测每个片段存入时的时间范围，
+// cache不支持分片段读取时 GetFragmentResponse 用 Get 返回数据的时间范围当作已覆盖的范围
+func FindGaps(segment string, start, end int64) []Interval {
+	return findGaps(segment, start, end, DefaultCache())
+}
+
+// findGaps 和 FindGaps 相同，从 mc 探测覆盖范围
+func findGaps(segment string, start, end int64, mc *memcache.Client) []Interval {
+	if covered, ok := Coverage.Covered(segment); ok {
+		return subtractIntervals(Interval{start, end}, covered)
+	}
+	if _, covered, err := GetFragmentResponse(segment, start, end, mc); err == nil {
+		return subtractIntervals(Interval{start, end}, covered)
+	}
+	return []Interval{{start, end}}
+}
+
+// mergeIntervals 合并相交或相邻的时间范围，结果按起始时间升序排列
+func mergeIntervals(intervals []Interval) []Interval {
+	sort.Slice(intervals, func(i, j int) bool { return intervals[i].Start < intervals[j].Start })
+	merged := make([]Interval, 0, len(intervals))
+	for _, in := range intervals {
+		if n := len(merged); n > 0 && in.Start <= merged[n-1].End+1 {
+			if in.End > merged[n-1].End {
+				merged[n-1].End = in.End
+			}
+			continue
+		}
+		merged = append(merged, in)
+	}
+	return merged
+}
+
+// subtractIntervals 返回 target 中不被 covered 覆盖的部分，covered 需要按起始时间升序排列且互不相交
+func subtractIntervals(target Interval, covered []Interval) []Interval {
+	gaps := make([]Interval, 0)
+	cur := target.Start
+	for _, c := range covered {
+		if c.End < cur {
+			continue
+		}
+		if c.Start > target.End {
+			break
+		}
+		if c.Start > cur {
+			gaps = append(gaps, Interval{cur, c.Start - 1})
+		}
+		cur = c.End + 1
+		if cur > target.End {
+			return gaps
+		}
+	}
+	return append(gaps, Interval{cur, target.End})
+}
+
+// queryCoverage 返回存入cache的查询结果覆盖的时间范围：查询有完整的时间范围时使用查询的范围，否则使用结果中数据的范围
+func queryCoverage(queryString string, resp *Response) Interval {
+	if stmt, err := influxql.ParseStatement(queryString); err == nil {
+		if s, ok := stmt.(*influxql.SelectStatement); ok {
+			start, end := selectTimeRange(s)
+			if start != influxql.MinTime && end != influxql.MaxTime {
+				return Interval{start, end}
+			}
+		}
+	}
+	start, end := GetResponseTimeRange(resp)
+	return Interval{start, end}
+}
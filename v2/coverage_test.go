@@ -0,0 +1,55 @@
+package client
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCoverageIndex(t *testing.T) {
+	ci := NewCoverageIndex()
+	ci.Add("seg", Interval{10, 20})
+	ci.Add("seg", Interval{40, 50})
+	ci.Add("seg", Interval{21, 25}) // 和 [10,20] 相邻，合并
+	ci.Add("seg", Interval{45, 60})
+
+	covered, ok := ci.Covered("seg")
+	if !ok {
+		t.Fatal("segment not found")
+	}
+	expected := []Interval{{10, 25}, {40, 60}}
+	if !reflect.DeepEqual(covered, expected) {
+		t.Errorf("covered:\t%v\nexpected:\t%v", covered, expected)
+	}
+
+	ci.Remove("seg")
+	if _, ok := ci.Covered("seg"); ok {
+		t.Error("segment should be removed")
+	}
+}
+
+func TestFindGaps(t *testing.T) {
+	segment := "{(h2o_feet.location=coyote_creek)}#{water_level[float64]}#{empty}#{empty,empty}"
+	Coverage.Add(segment, Interval{10, 25})
+	Coverage.Add(segment, Interval{40, 60})
+	defer Coverage.Remove(segment)
+
+	tests := []struct {
+		name       string
+		start, end int64
+		expected   []Interval
+	}{
+		{name: "fully covered", start: 12, end: 20, expected: []Interval{}},
+		{name: "gap in the middle", start: 0, end: 100, expected: []Interval{{0, 9}, {26, 39}, {61, 100}}},
+		{name: "head covered", start: 20, end: 45, expected: []Interval{{26, 39}}},
+		{name: "not covered", start: 70, end: 80, expected: []Interval{{70, 80}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gaps := FindGaps(segment, tt.start, tt.end)
+			if !reflect.DeepEqual(gaps, tt.expected) {
+				t.Errorf("gaps:\t%v\nexpected:\t%v", gaps, tt.expected)
+			}
+		})
+	}
+}
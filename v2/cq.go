@@ -0,0 +1,136 @@
+package client
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/influxdata/influxql"
+)
+
+// ContinuousQuery is a query the server runs periodically, writing its
+// results into another measurement.
+type ContinuousQuery struct {
+	Name     string
+	Database string
+
+	// Query is the SELECT ... INTO ... GROUP BY time(...) statement.
+	Query string
+
+	// ResampleEvery and ResampleFor set the RESAMPLE clause, zero values
+	// use the server defaults.
+	ResampleEvery time.Duration
+	ResampleFor   time.Duration
+}
+
+// CreateContinuousQuery creates cq on the server. If register is true, the
+// measurement the query writes into is added to the Fields and TagKV schema
+// caches, so queries against it can be cached before the caches are reloaded.
+func CreateContinuousQuery(c Client, cq ContinuousQuery, register bool) error {
+	stmt, err := continuousQueryStatement(cq)
+	if err != nil {
+		return err
+	}
+	if _, err := execute(c, stmt.String(), cq.Database); err != nil {
+		return err
+	}
+	if register {
+		registerTarget(stmt.Source)
+	}
+	return nil
+}
+
+// DropContinuousQuery deletes the continuous query from the database.
+func DropContinuousQuery(c Client, database, name string) error {
+	_, err := execute(c, fmt.Sprintf("DROP CONTINUOUS QUERY %s ON %s", influxql.QuoteIdent(name), influxql.QuoteIdent(database)), database)
+	return err
+}
+
+// ShowContinuousQueries lists the continuous queries of every database.
+func ShowContinuousQueries(c Client) ([]ContinuousQuery, error) {
+	resp, err := execute(c, "SHOW CONTINUOUS QUERIES", "")
+	if err != nil {
+		return nil, err
+	}
+
+	// Every database is a series named after it, with one row per query
+	// holding its name and full CREATE CONTINUOUS QUERY statement.
+	queries := make([]ContinuousQuery, 0)
+	for _, r := range rows(resp) {
+		var create string
+		for i, column := range r.columns {
+			if column == "query" {
+				create, _ = r.values[i].(string)
+			}
+		}
+		stmt, err := influxql.ParseStatement(create)
+		if err != nil {
+			return nil, fmt.Errorf("continuous query on %s: %w", r.name, err)
+		}
+		cq, ok := stmt.(*influxql.CreateContinuousQueryStatement)
+		if !ok {
+			return nil, fmt.Errorf("continuous query on %s: unexpected statement %s", r.name, create)
+		}
+		queries = append(queries, ContinuousQuery{
+			Name:          cq.Name,
+			Database:      cq.Database,
+			Query:         cq.Source.String(),
+			ResampleEvery: cq.ResampleEvery,
+			ResampleFor:   cq.ResampleFor,
+		})
+	}
+	return queries, nil
+}
+
+func continuousQueryStatement(cq ContinuousQuery) (*influxql.CreateContinuousQueryStatement, error) {
+	stmt, err := influxql.ParseStatement(cq.Query)
+	if err != nil {
+		return nil, err
+	}
+	source, ok := stmt.(*influxql.SelectStatement)
+	if !ok || source.Target == nil {
+		return nil, fmt.Errorf("continuous query %s must be a SELECT ... INTO statement", cq.Name)
+	}
+	return &influxql.CreateContinuousQueryStatement{
+		Name:          cq.Name,
+		Database:      cq.Database,
+		Source:        source,
+		ResampleEvery: cq.ResampleEvery,
+		ResampleFor:   cq.ResampleFor,
+	}, nil
+}
+
+// registerTarget adds the INTO measurement of s to the schema caches. Its
+// fields are the output columns of s and its tags are the GROUP BY tags,
+// whose values are copied from the source measurement.
+func registerTarget(s *influxql.SelectStatement) {
+	target := s.Target.Measurement.Name
+	if target == "" {
+		return
+	}
+
+	var source string
+	if len(s.Sources) > 0 {
+		if m, ok := s.Sources[0].(*influxql.Measurement); ok {
+			source = m.Name
+		}
+	}
+	fields := append([]string(nil), s.ColumnNames()[1:]...)
+	updateSchema(func(schema *Schema) {
+		tags := make([]TagKeyMap, 0)
+		for _, d := range s.Dimensions {
+			ref, ok := d.Expr.(*influxql.VarRef)
+			if !ok {
+				continue
+			}
+			values := TagValues{}
+			for _, km := range schema.TagKV.Measurement[source] {
+				if v, ok := km.Tag[ref.Val]; ok {
+					values = v
+				}
+			}
+			tags = append(tags, TagKeyMap{Tag: map[string]TagValues{ref.Val: values}})
+		}
+		schema.Fields[target] = fields
+		schema.TagKV.Measurement[target] = tags
+	})
+}
@@ -0,0 +1,74 @@
+package client
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCreateContinuousQuery(t *testing.T) {
+	var commands []string
+	ts := newAdminServer(&commands, `{"results":[{"statement_id":0}]}`)
+	defer ts.Close()
+	c, _ := NewHTTPClient(HTTPConfig{Addr: ts.URL})
+	defer c.Close()
+
+	defer SetSchema(SetSchema(&Schema{
+		Fields: map[string][]string{},
+		TagKV: MeasurementTagMap{Measurement: map[string][]TagKeyMap{
+			"h2o_feet": {{Tag: map[string]TagValues{"location": {Values: []string{"coyote_creek", "santa_monica"}}}}},
+		}},
+	}))
+
+	cq := ContinuousQuery{
+		Name:          "cq_12m",
+		Database:      MyDB,
+		Query:         "SELECT mean(water_level) INTO h2o_feet_12m FROM h2o_feet GROUP BY time(12m), location",
+		ResampleEvery: 24 * time.Minute,
+	}
+	if err := CreateContinuousQuery(c, cq, true); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `CREATE CONTINUOUS QUERY cq_12m ON NOAA_water_database RESAMPLE EVERY 24m BEGIN SELECT mean(water_level) INTO h2o_feet_12m FROM h2o_feet GROUP BY time(12m), location END`
+	if commands[0] != expected {
+		t.Errorf("command:\t%s\nexpected:\t%s", commands[0], expected)
+	}
+	schema := CurrentSchema()
+	if !reflect.DeepEqual(schema.Fields["h2o_feet_12m"], []string{"mean"}) {
+		t.Errorf("fields:\t%v", schema.Fields["h2o_feet_12m"])
+	}
+	if tags := schema.TagKV.Measurement["h2o_feet_12m"]; len(tags) != 1 || len(tags[0].Tag["location"].Values) != 2 {
+		t.Errorf("tags:\t%v", tags)
+	}
+
+	cq.Query = "SELECT mean(water_level) FROM h2o_feet GROUP BY time(12m)"
+	if err := CreateContinuousQuery(c, cq, false); err == nil {
+		t.Error("expected error for query without INTO")
+	}
+}
+
+func TestShowContinuousQueries(t *testing.T) {
+	var commands []string
+	ts := newAdminServer(&commands, `{"results":[{"statement_id":0,"series":[
+		{"name":"_internal","columns":["name","query"]},
+		{"name":"NOAA_water_database","columns":["name","query"],"values":[
+			["cq_12m","CREATE CONTINUOUS QUERY cq_12m ON NOAA_water_database RESAMPLE FOR 1h BEGIN SELECT mean(water_level) INTO NOAA_water_database.autogen.h2o_feet_12m FROM NOAA_water_database.autogen.h2o_feet GROUP BY time(12m), location END"]]}]}]}`)
+	defer ts.Close()
+	c, _ := NewHTTPClient(HTTPConfig{Addr: ts.URL})
+	defer c.Close()
+
+	queries, err := ShowContinuousQueries(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []ContinuousQuery{{
+		Name:        "cq_12m",
+		Database:    "NOAA_water_database",
+		Query:       "SELECT mean(water_level) INTO NOAA_water_database.autogen.h2o_feet_12m FROM NOAA_water_database.autogen.h2o_feet GROUP BY time(12m), location",
+		ResampleFor: time.Hour,
+	}}
+	if !reflect.DeepEqual(queries, expected) {
+		t.Errorf("queries:\t%+v\nexpected:\t%+v", queries, expected)
+	}
+}
@@ -0,0 +1,122 @@
+package client
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/influxdata/influxdb1-client/models"
+	"github.com/influxdata/influxql"
+)
+
+// Downsample 在客户端把结果中每张表按 interval 划分时间区间，对每个可以聚合的列计算 agg，得到和数据库执行
+// SELECT agg(field), ... GROUP BY time(interval) 相同的结果：区间从 1970-01-01 起按 interval 的整数倍对齐，和数据库的 GROUP BY time() 相同，
+// 每行的时间是区间的起始时间，列名按数据库的规则生成（mean, mean_1 ...），tags 不变，每条语句的结果分别处理。
+// agg.Func 是 clientAggregations 中的函数，agg.Args 是函数在列名之后的参数，比如 percentile 的百分比。
+// agg.FillMode 为 none 时只输出有数据的区间；为 null 或空字符串时和数据库一样补全查询的时间范围 [startTime, endTime] 内没有数据的区间，
+// count 为 0，其他为空值；为数值时用这个数值填充；previous 和 linear 返回 ErrUnsupportedQuery。
+// 时间范围没有下界或上界（influxql.MinTime、influxql.MaxTime）时，这一侧只补全到每张表第一个或最后一个有数据的区间。
+// 时间戳需要是 RFC3339 字符串或纳秒精度的 json.Number
+func Downsample(resp *Response, interval time.Duration, agg Aggregation, startTime, endTime int64) (*Response, error) {
+	if interval <= 0 {
+		return nil, fmt.Errorf("invalid downsample interval %v", interval)
+	}
+	args, ok := clientAggregations[agg.Func]
+	if !ok || len(agg.Args) != args {
+		return nil, fmt.Errorf("%w: aggregation %s cannot be computed by the client", ErrUnsupportedQuery, agg)
+	}
+	var fillValue interface{}
+	switch agg.FillMode {
+	case "", "null", "none":
+	case "previous", "linear":
+		return nil, fmt.Errorf("%w: fill(%s) is not supported by downsampling", ErrUnsupportedQuery, agg.FillMode)
+	default:
+		v, err := strconv.ParseFloat(agg.FillMode, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid fill mode %s", agg.FillMode)
+		}
+		fillValue = v
+	}
+	if ResponseIsEmpty(resp) {
+		return resp, nil
+	}
+
+	calls := make([]fieldAggregate, 0)
+	for _, col := range aggregatableColumns(resp, agg.Func) {
+		calls = append(calls, fieldAggregate{aggr: agg.Func, args: agg.Args, field: col})
+	}
+	if len(calls) == 0 {
+		return nil, fmt.Errorf("no column can be aggregated with %s", agg)
+	}
+	columns := aggregateColumnNames(calls)
+
+	result := &Response{Results: make([]Result, 0, len(resp.Results)), statusCode: resp.statusCode}
+	for _, r := range resp.Results {
+		if r.Err != "" || len(r.Series) == 0 {
+			result.Results = append(result.Results, r)
+			continue
+		}
+		sorted, err := seriesByTime(r)
+		if err != nil {
+			return nil, err
+		}
+		aggregated, err := aggregateResponse(&Response{Results: []Result{sorted}}, calls, columns, interval, 0, 0)
+		if err != nil {
+			return nil, err
+		}
+		if agg.FillMode != "none" {
+			for i, s := range aggregated.Results[0].Series {
+				if len(s.Values) == 0 {
+					continue
+				}
+				first, last := startTime, endTime
+				if first == influxql.MinTime {
+					first, _ = timestampOf(s.Values[0][0])
+				}
+				if last == influxql.MaxTime {
+					last, _ = timestampOf(s.Values[len(s.Values)-1][0])
+				}
+				aggregated.Results[0].Series[i].Values = fillIntervals(s.Values, calls, fillValue, first, last, int64(interval), 0)
+			}
+		}
+		result.Results = append(result.Results, aggregated.Results[0])
+	}
+	return result, nil
+}
+
+// seriesByTime 返回每张表按时间升序排列的结果，比如 ORDER BY time DESC 的结果；已经有序时返回 r 本身，不修改 r
+func seriesByTime(r Result) (Result, error) {
+	sorted := r
+	copied := false
+	for i, s := range r.Series {
+		times := make([]int64, len(s.Values))
+		ascending := true
+		for j, row := range s.Values {
+			ts, ok := timestampOf(row[0])
+			if !ok {
+				return Result{}, fmt.Errorf("unsupported timestamp %v", row[0])
+			}
+			times[j] = ts
+			ascending = ascending && (j == 0 || times[j-1] <= ts)
+		}
+		if ascending {
+			continue
+		}
+		if !copied {
+			sorted.Series = append([]models.Row(nil), r.Series...)
+			copied = true
+		}
+		index := make([]int, len(s.Values))
+		for j := range index {
+			index[j] = j
+		}
+		sort.SliceStable(index, func(a, b int) bool { return times[index[a]] < times[index[b]] })
+		values := make([][]interface{}, len(index))
+		for j, idx := range index {
+			values[j] = s.Values[idx]
+		}
+		sorted.Series[i].Values = values
+	}
+	return sorted, nil
+}
@@ -0,0 +1,116 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/influxdata/influxdb1-client/models"
+	"github.com/influxdata/influxql"
+)
+
+func downsampleRaw() *Response {
+	return &Response{Results: []Result{{Series: []models.Row{{
+		Name:    "cpu",
+		Tags:    map[string]string{"host": "server01"},
+		Columns: []string{"time", "usage"},
+		Values: [][]interface{}{
+			{json.Number("0"), json.Number("1")},
+			{json.Number("30000000000"), json.Number("3")},
+			{json.Number("65000000000"), json.Number("5")},
+			{json.Number("200000000000"), json.Number("7.5")},
+		},
+	}}}}}
+}
+
+func TestDownsample(t *testing.T) {
+	tests := []struct {
+		name     string
+		agg      Aggregation
+		expected [][]interface{}
+	}{
+		{"null", Aggregation{Func: "mean"}, [][]interface{}{
+			{json.Number("0"), json.Number("2")}, {json.Number("60000000000"), json.Number("5")},
+			{json.Number("120000000000"), nil}, {json.Number("180000000000"), json.Number("7.5")}}},
+		{"none", Aggregation{Func: "max", FillMode: "none"}, [][]interface{}{
+			{json.Number("0"), json.Number("3")}, {json.Number("60000000000"), json.Number("5")}, {json.Number("180000000000"), json.Number("7.5")}}},
+		{"count", Aggregation{Func: "count"}, [][]interface{}{
+			{json.Number("0"), json.Number("2")}, {json.Number("60000000000"), json.Number("1")},
+			{json.Number("120000000000"), json.Number("0")}, {json.Number("180000000000"), json.Number("1")}}},
+		{"number", Aggregation{Func: "sum", FillMode: "-1"}, [][]interface{}{
+			{json.Number("0"), json.Number("4")}, {json.Number("60000000000"), json.Number("5")},
+			{json.Number("120000000000"), json.Number("-1")}, {json.Number("180000000000"), json.Number("7.5")}}},
+		{"percentile", Aggregation{Func: "percentile", Args: []string{"50"}, FillMode: "none"}, [][]interface{}{
+			{json.Number("0"), json.Number("1")}, {json.Number("60000000000"), json.Number("5")}, {json.Number("180000000000"), json.Number("7.5")}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := Downsample(downsampleRaw(), time.Minute, tt.agg, influxql.MinTime, influxql.MaxTime)
+			if err != nil {
+				t.Fatal(err)
+			}
+			s := resp.Results[0].Series[0]
+			if s.Columns[1] != tt.agg.Func || !reflect.DeepEqual(s.Tags, map[string]string{"host": "server01"}) {
+				t.Errorf("series:\t%v %v", s.Columns, s.Tags)
+			}
+			if !reflect.DeepEqual(s.Values, tt.expected) {
+				t.Errorf("values:\t%v\nexpected:\t%v", s.Values, tt.expected)
+			}
+		})
+	}
+
+	/* 和数据库的 GROUP BY time() 相同：补全查询的整个时间范围，和 AggregateQuery 的结果相同 */
+	query := "SELECT mean(usage) FROM cpu WHERE time >= 10000000000 AND time <= 330000000000 GROUP BY time(1m)"
+	expected, err := AggregateQuery(query, downsampleRaw())
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, _ := Downsample(downsampleRaw(), time.Minute, Aggregation{Func: "mean"}, 10000000000, 330000000000)
+	if !reflect.DeepEqual(resp.Results[0].Series, expected.Results[0].Series) {
+		t.Errorf("downsampled:\t%v\nexpected:\t%v", resp.Results[0].Series, expected.Results[0].Series)
+	}
+	if values := resp.Results[0].Series[0].Values; len(values) != 6 || values[5][0] != json.Number("300000000000") || values[5][1] != nil {
+		t.Errorf("filled range:\t%v", values)
+	}
+
+	/* 区间对齐到 1970-01-01 起的整数倍，1970 年之前的时间和 RFC3339 时间戳也一样 */
+	rfc := &Response{Results: []Result{{Series: []models.Row{{Name: "cpu", Columns: []string{"time", "usage"}, Values: [][]interface{}{
+		{"1969-12-31T23:59:30Z", json.Number("1")},
+		{"2019-08-18T00:30:00Z", json.Number("2")},
+	}}}}}}
+	resp, err = Downsample(rfc, time.Hour, Aggregation{Func: "first", FillMode: "none"}, influxql.MinTime, influxql.MaxTime)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if values := resp.Results[0].Series[0].Values; values[0][0] != "1969-12-31T23:00:00Z" || values[1][0] != "2019-08-18T00:00:00Z" {
+		t.Errorf("buckets:\t%v", values)
+	}
+
+	/* 时间倒序的结果先按时间排列，不修改原来的结果 */
+	desc := downsampleRaw()
+	rows := desc.Results[0].Series[0].Values
+	for i, j := 0, len(rows)-1; i < j; i, j = i+1, j-1 {
+		rows[i], rows[j] = rows[j], rows[i]
+	}
+	resp, err = Downsample(desc, time.Minute, Aggregation{Func: "max", FillMode: "none"}, influxql.MinTime, influxql.MaxTime)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if values := resp.Results[0].Series[0].Values; len(values) != 3 || values[0][1] != json.Number("3") {
+		t.Errorf("descending:\t%v", values)
+	}
+	if rows[0][0] != json.Number("200000000000") {
+		t.Errorf("input modified:\t%v", rows)
+	}
+
+	for _, agg := range []Aggregation{{Func: "median"}, {Func: "percentile"}, {Func: "mean", FillMode: "linear"}} {
+		if _, err := Downsample(downsampleRaw(), time.Minute, agg, influxql.MinTime, influxql.MaxTime); !errors.Is(err, ErrUnsupportedQuery) {
+			t.Errorf("%v:\t%v\nexpected:\t%v", agg, err, ErrUnsupportedQuery)
+		}
+	}
+	if _, err := Downsample(downsampleRaw(), 0, Aggregation{Func: "mean"}, influxql.MinTime, influxql.MaxTime); err == nil {
+		t.Error("zero interval accepted")
+	}
+}
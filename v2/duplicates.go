@@ -0,0 +1,116 @@
+package client
+
+import (
+	"fmt"
+
+	"github.com/influxdata/influxdb1-client/models"
+)
+
+// DuplicatePolicy decides what Write does with points of a batch that share
+// the measurement, tag set and timestamp, at the precision of the batch.
+// InfluxDB stores such points as one, each overwriting the fields of the
+// ones before it.
+type DuplicatePolicy string
+
+const (
+	// DuplicateOverwrite sends duplicate points as they are and leaves them
+	// to InfluxDB, the default.
+	DuplicateOverwrite DuplicatePolicy = ""
+	// DuplicateMerge merges the fields of duplicate points into the first of
+	// them; later values win.
+	DuplicateMerge DuplicatePolicy = "merge"
+	// DuplicateKeepLast keeps only the last of duplicate points, dropping the
+	// fields only the earlier ones have.
+	DuplicateKeepLast DuplicatePolicy = "last"
+	// DuplicateError fails the write with a *ValidationError listing the
+	// duplicate points.
+	DuplicateError DuplicatePolicy = "error"
+)
+
+// Validate returns an error if d is not one of the DuplicatePolicy constants.
+func (d DuplicatePolicy) Validate() error {
+	switch d {
+	case DuplicateOverwrite, DuplicateMerge, DuplicateKeepLast, DuplicateError:
+		return nil
+	}
+	return fmt.Errorf("invalid duplicate policy %q: must be empty or one of %q, %q or %q",
+		string(d), DuplicateMerge, DuplicateKeepLast, DuplicateError)
+}
+
+// DuplicatePointError is a point of a batch with the same measurement, tag
+// set and timestamp as an earlier one.
+type DuplicatePointError struct {
+	First int // index of the earlier point
+}
+
+func (e *DuplicatePointError) Error() string {
+	return fmt.Sprintf("duplicate of point %d", e.First)
+}
+
+// ResolveDuplicates applies the policy to points written with the
+// precision. Merged and kept points take the place of the first of their
+// duplicates; points without a timestamp are never duplicates, the server
+// assigns them one.
+func ResolveDuplicates(points []*Point, precision string, policy DuplicatePolicy) ([]*Point, error) {
+	if policy == DuplicateOverwrite || len(points) < 2 {
+		return points, nil
+	}
+	multiplier := models.GetPrecisionMultiplier(precision)
+	type pointKey struct {
+		series string
+		ts     int64
+	}
+	type firstPoint struct {
+		index int // in points
+		at    int // in resolved
+	}
+	first := make(map[pointKey]firstPoint, len(points))
+	resolved := make([]*Point, 0, len(points))
+	var invalid []InvalidPoint
+	for i, p := range points {
+		if p == nil || p.Time().IsZero() {
+			resolved = append(resolved, p)
+			continue
+		}
+		key := pointKey{string(p.pt.Key()), p.UnixNano() / multiplier}
+		f, ok := first[key]
+		if !ok {
+			first[key] = firstPoint{index: i, at: len(resolved)}
+			resolved = append(resolved, p)
+			continue
+		}
+		switch policy {
+		case DuplicateError:
+			invalid = append(invalid, InvalidPoint{Index: i, Line: p.String(), Err: &DuplicatePointError{First: f.index}})
+		case DuplicateKeepLast:
+			resolved[f.at] = p
+		case DuplicateMerge:
+			merged, err := mergePoints(resolved[f.at], p)
+			if err != nil {
+				return nil, err
+			}
+			resolved[f.at] = merged
+		}
+	}
+	if len(invalid) > 0 {
+		return nil, &ValidationError{Points: invalid}
+	}
+	return resolved, nil
+}
+
+// mergePoints returns a point with the fields of a overwritten by those of
+// b, at the time of a.
+func mergePoints(a, b *Point) (*Point, error) {
+	fields, err := a.Fields()
+	if err != nil {
+		return nil, err
+	}
+	more, err := b.Fields()
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range more {
+		fields[k] = v
+	}
+	return NewPoint(a.Name(), a.Tags(), fields, a.Time())
+}
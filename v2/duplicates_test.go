@@ -0,0 +1,109 @@
+package client
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func duplicatePoints() []*Point {
+	ts := time.Unix(0, 1566000000123000000)
+	p0, _ := NewPoint("h2o_feet", map[string]string{"location": "coyote_creek"}, map[string]interface{}{"water_level": 8.12, "note": "first"}, ts)
+	p1, _ := NewPoint("h2o_feet", map[string]string{"location": "santa_monica"}, map[string]interface{}{"water_level": 2.064}, ts)
+	p2, _ := NewPoint("h2o_feet", map[string]string{"location": "coyote_creek"}, map[string]interface{}{"water_level": 8.005}, ts.Add(time.Microsecond))
+	p3, _ := NewPoint("h2o_feet", map[string]string{"location": "coyote_creek"}, map[string]interface{}{"water_level": 7.887}, ts.Add(time.Second))
+	return []*Point{p0, p1, p2, p3}
+}
+
+func TestResolveDuplicates(t *testing.T) {
+	lines := func(points []*Point) string {
+		s := make([]string, 0, len(points))
+		for _, p := range points {
+			s = append(s, p.pt.PrecisionString("ms"))
+		}
+		return strings.Join(s, "\n")
+	}
+
+	/* 毫秒精度下第 0、2 个点重复 */
+	tests := []struct {
+		policy   DuplicatePolicy
+		expected string
+	}{
+		{DuplicateOverwrite, `h2o_feet,location=coyote_creek note="first",water_level=8.12 1566000000123
+h2o_feet,location=santa_monica water_level=2.064 1566000000123
+h2o_feet,location=coyote_creek water_level=8.005 1566000000123
+h2o_feet,location=coyote_creek water_level=7.887 1566000001123`},
+		{DuplicateMerge, `h2o_feet,location=coyote_creek note="first",water_level=8.005 1566000000123
+h2o_feet,location=santa_monica water_level=2.064 1566000000123
+h2o_feet,location=coyote_creek water_level=7.887 1566000001123`},
+		{DuplicateKeepLast, `h2o_feet,location=coyote_creek water_level=8.005 1566000000123
+h2o_feet,location=santa_monica water_level=2.064 1566000000123
+h2o_feet,location=coyote_creek water_level=7.887 1566000001123`},
+	}
+	for _, test := range tests {
+		resolved, err := ResolveDuplicates(duplicatePoints(), "ms", test.policy)
+		if err != nil {
+			t.Fatalf("%q: unexpected error: %v", test.policy, err)
+		}
+		if got := lines(resolved); got != test.expected {
+			t.Errorf("%q:\n%s\nexpected:\n%s", test.policy, got, test.expected)
+		}
+	}
+
+	/* 纳秒精度下没有重复 */
+	if resolved, err := ResolveDuplicates(duplicatePoints(), "ns", DuplicateError); err != nil || len(resolved) != 4 {
+		t.Errorf("resolved:\t%d error:\t%v", len(resolved), err)
+	}
+
+	_, err := ResolveDuplicates(duplicatePoints(), "ms", DuplicateError)
+	var verr *ValidationError
+	if !errors.As(err, &verr) || len(verr.Points) != 1 || verr.Points[0].Index != 2 {
+		t.Fatalf("error:\t%v", err)
+	}
+	var derr *DuplicatePointError
+	if !errors.As(verr.Points[0].Err, &derr) || derr.First != 0 {
+		t.Errorf("error:\t%v\nexpected:\t%s", verr.Points[0].Err, "duplicate of point 0")
+	}
+
+	if err := DuplicatePolicy("first").Validate(); err == nil {
+		t.Error("expected error for invalid duplicate policy")
+	}
+}
+
+func TestClient_WriteDuplicates(t *testing.T) {
+	var body string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var b bytes.Buffer
+		io.Copy(&b, r.Body)
+		body = b.String()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+	c, _ := NewHTTPClient(HTTPConfig{Addr: ts.URL})
+	defer c.Close()
+
+	if _, err := NewBatchPoints(BatchPointsConfig{Duplicates: "first"}); err == nil {
+		t.Error("expected error for invalid duplicate policy")
+	}
+	bp, _ := NewBatchPoints(BatchPointsConfig{Database: MyDB, Precision: "s", Duplicates: DuplicateMerge})
+	bp.AddPoints(duplicatePoints())
+	if err := c.Write(bp); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Count(body, "\n") != 3 {
+		t.Errorf("body:\n%s", body)
+	}
+
+	body = ""
+	if err := bp.SetDuplicatePolicy(DuplicateError); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := c.Write(bp); err == nil || body != "" {
+		t.Errorf("error:\t%v body:\t%s", err, body)
+	}
+}
@@ -0,0 +1,241 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/InfluxDB-client/memcache"
+)
+
+var (
+	// ErrCacheMiss 表示要查询的数据不在cache中，调用方应该查询数据库；和 memcache.ErrCacheMiss 是同一个值
+	ErrCacheMiss = memcache.ErrCacheMiss
+
+	// ErrEmptyResponse 表示需要数据的地方得到的是没有数据的结果
+	ErrEmptyResponse = errors.New("empty response")
+
+	// ErrUnsupportedQuery 表示查询语句不是客户端能处理的形式，比如不是 SELECT 语句或者使用了不支持的聚合函数、fill 选项
+	ErrUnsupportedQuery = errors.New("unsupported query")
+
+	// ErrKeyTooLong 表示cache的 key 超过 MaxKeyLength，没有存入cache
+	ErrKeyTooLong = errors.New("cache key too long")
+
+	// ErrSchemaMismatch 表示两个结果或者结果和语义段的表、列不对应
+	ErrSchemaMismatch = errors.New("schema mismatch")
+)
+
+// MaxKeyLength 是存入cache的 key（见 Keys）的最大字节数，为 0 时不限制；fatcache 没有 memcached 的 250 字节限制，默认不限制
+var MaxKeyLength = 0
+
+// QueryError 是数据库返回的查询错误，Message 是数据库返回的错误信息，StatusCode 是 HTTP 状态码，
+// 从分块查询的块中得到的错误没有状态码，为 0
+type QueryError struct {
+	Message    string
+	StatusCode int
+}
+
+func (e *QueryError) Error() string {
+	return e.Message
+}
+
+// QueryErrorKind 是查询错误的类别，由数据库返回的错误信息和状态码确定
+type QueryErrorKind int
+
+const (
+	QueryErrorNone                    QueryErrorKind = iota // 没有错误
+	QueryErrorUnknown                                       // 不能识别的错误
+	QueryErrorSyntax                                        // 语句不能解析
+	QueryErrorDatabaseNotFound                              // 数据库不存在
+	QueryErrorRetentionPolicyNotFound                       // 保留策略不存在
+	QueryErrorUnauthorized                                  // 认证或授权失败
+	QueryErrorLimitExceeded                                 // 超过 max-select-series、max-select-point、max-select-buckets 等限制
+	QueryErrorTimeout                                       // 超时或者被中断
+	QueryErrorTooManyQueries                                // 超过 max-concurrent-queries
+	QueryErrorUnavailable                                   // 数据库或者中间的代理暂时不可用（502, 503, 504）
+)
+
+var queryErrorKindNames = []string{"none", "unknown", "syntax", "database not found", "retention policy not found",
+	"unauthorized", "limit exceeded", "timeout", "too many queries", "unavailable"}
+
+func (k QueryErrorKind) String() string {
+	if k < 0 || int(k) >= len(queryErrorKindNames) {
+		return "QueryErrorKind(" + strconv.Itoa(int(k)) + ")"
+	}
+	return queryErrorKindNames[k]
+}
+
+// Retryable 表示同样的查询稍后重新发送可能成功：超时、并发查询过多和暂时不可用；其他类别重试也会得到同样的错误
+func (k QueryErrorKind) Retryable() bool {
+	switch k {
+	case QueryErrorTimeout, QueryErrorTooManyQueries, QueryErrorUnavailable:
+		return true
+	}
+	return false
+}
+
+// queryErrorPatterns 按顺序匹配错误信息，InfluxDB 1.x 的错误信息
+var queryErrorPatterns = []struct {
+	substr string
+	kind   QueryErrorKind
+}{
+	{"error parsing query", QueryErrorSyntax},
+	{"database not found", QueryErrorDatabaseNotFound},
+	{"retention policy not found", QueryErrorRetentionPolicyNotFound},
+	{"authorization failed", QueryErrorUnauthorized},
+	{"unable to parse authentication credentials", QueryErrorUnauthorized},
+	{"not authorized", QueryErrorUnauthorized},
+	{"max-concurrent-queries limit exceeded", QueryErrorTooManyQueries},
+	{"query-timeout limit exceeded", QueryErrorTimeout},
+	{"limit exceeded", QueryErrorLimitExceeded}, // max-select-series, max-select-buckets
+	{"limit exceeed", QueryErrorLimitExceeded},  // max-select-point，InfluxDB 的错误信息拼错了
+	{"query interrupted", QueryErrorTimeout},
+	{"timeout", QueryErrorTimeout},
+	{"deadline exceeded", QueryErrorTimeout},
+}
+
+// Kind 返回错误的类别：先按错误信息匹配，不能识别时按状态码
+func (e *QueryError) Kind() QueryErrorKind {
+	msg := strings.ToLower(e.Message)
+	for _, p := range queryErrorPatterns {
+		if strings.Contains(msg, p.substr) {
+			return p.kind
+		}
+	}
+	switch e.StatusCode {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return QueryErrorUnauthorized
+	case http.StatusRequestTimeout:
+		return QueryErrorTimeout
+	case http.StatusTooManyRequests:
+		return QueryErrorTooManyQueries
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return QueryErrorUnavailable
+	}
+	return QueryErrorUnknown
+}
+
+// Retryable 表示错误是否值得重试，见 QueryErrorKind.Retryable
+func (e *QueryError) Retryable() bool {
+	return e.Kind().Retryable()
+}
+
+// QueryErrorKindOf 返回 err 链中的 *QueryError 的类别，err 为 nil 时返回 QueryErrorNone，
+// 不是 *QueryError 时返回 QueryErrorUnknown
+func QueryErrorKindOf(err error) QueryErrorKind {
+	if err == nil {
+		return QueryErrorNone
+	}
+	var qe *QueryError
+	if errors.As(err, &qe) {
+		return qe.Kind()
+	}
+	return QueryErrorUnknown
+}
+
+// PointError 是数据库拒绝的一个点，Index 是它在写入的点中的下标（没有设置 DuplicatePolicy 时和 bp.Points() 相同），
+// Line 是它的 line protocol，Message 是数据库给出的原因
+type PointError struct {
+	Index   int
+	Line    string
+	Message string
+}
+
+// WriteError 是数据库拒绝写入时返回的错误，Message 是数据库返回的错误信息，StatusCode 是 HTTP 状态码；
+// Failed 是能从错误信息中找到的被拒绝的点，Dropped 是数据库报告的丢弃的点数（partial write 的 dropped=N），
+// 没有报告时为 0。调用方可以去掉 Failed 中的点重试，或者只重写它们
+type WriteError struct {
+	Message    string
+	StatusCode int
+	Failed     []PointError
+	Dropped    int
+}
+
+func (e *WriteError) Error() string {
+	return e.Message
+}
+
+var (
+	// InfluxDB 1.x：unable to parse '<line>': <reason>，多个点的错误用换行分隔
+	unableToParse = regexp.MustCompile(`^unable to parse '(.*)': (.*)$`)
+	// InfluxDB 2.x：failed to parse line protocol: error parsing line <n> (1-based): <reason>
+	errorParsingLine = regexp.MustCompile(`error parsing line (\d+) \(1-based\): (.*)$`)
+	// field type conflict: input field "<field>" on measurement "<measurement>" is type <type>, already exists as type <type>
+	fieldTypeConflict = regexp.MustCompile(`field type conflict: input field "(.+)" on measurement "(.+)" is type (\w+), already exists as type (\w+)`)
+	droppedPoints     = regexp.MustCompile(`dropped=(\d+)`)
+)
+
+// influxFieldTypes 把 InfluxDB 错误信息中的类型转换成 FieldTypes 中的类型
+var influxFieldTypes = map[string]string{"float": "float64", "integer": "int64", "unsigned": "int64", "string": "string", "boolean": "bool"}
+
+// newWriteError 解析数据库拒绝写入时的响应体，points 是按 precision 写入的点
+func newWriteError(statusCode int, body []byte, points []*Point, precision string) *WriteError {
+	var msg struct {
+		Error   string `json:"error"`
+		Message string `json:"message"` // InfluxDB 2.x
+	}
+	e := &WriteError{Message: strings.TrimSpace(string(body)), StatusCode: statusCode}
+	if err := json.Unmarshal(body, &msg); err == nil {
+		if msg.Error != "" {
+			e.Message = msg.Error
+		} else if msg.Message != "" {
+			e.Message = msg.Message
+		}
+	}
+	if m := droppedPoints.FindStringSubmatch(e.Message); m != nil {
+		e.Dropped, _ = strconv.Atoi(m[1])
+	}
+
+	var lines []string // 只在需要按内容找点时生成
+	lineOf := func(i int) string {
+		if lines == nil {
+			lines = make([]string, len(points))
+			for j, p := range points {
+				if p != nil {
+					lines[j] = p.pt.PrecisionString(precision)
+				}
+			}
+		}
+		return lines[i]
+	}
+	failed := make(map[int]bool)
+	fail := func(i int, reason string) {
+		if i >= 0 && i < len(points) && points[i] != nil && !failed[i] {
+			failed[i] = true
+			e.Failed = append(e.Failed, PointError{Index: i, Line: lineOf(i), Message: reason})
+		}
+	}
+
+	for _, part := range strings.Split(e.Message, "\n") {
+		part = strings.TrimPrefix(strings.TrimSpace(part), "partial write: ")
+		if m := unableToParse.FindStringSubmatch(part); m != nil {
+			for i := range points {
+				if points[i] != nil && !failed[i] && lineOf(i) == m[1] {
+					fail(i, m[2])
+					break
+				}
+			}
+		} else if m := errorParsingLine.FindStringSubmatch(part); m != nil {
+			n, _ := strconv.Atoi(m[1])
+			fail(n-1, m[2])
+		} else if m := fieldTypeConflict.FindStringSubmatch(part); m != nil {
+			// 数据库只报告字段和类型，同一张表中这个字段是输入类型的点都被拒绝
+			reason := strings.TrimSpace(droppedPoints.ReplaceAllString(m[0], ""))
+			for i, p := range points {
+				if p == nil || p.Name() != m[2] {
+					continue
+				}
+				fields, err := p.Fields()
+				if v, ok := fields[m[1]]; err == nil && ok && fieldValueType(v) == influxFieldTypes[m[3]] {
+					fail(i, reason)
+				}
+			}
+		}
+	}
+	sort.Slice(e.Failed, func(i, j int) bool { return e.Failed[i].Index < e.Failed[j].Index })
+	return e
+}
@@ -0,0 +1,229 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/InfluxDB-client/memcache"
+	"github.com/influxdata/influxdb1-client/models"
+)
+
+func TestClient_QueryError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Influxdb-Version", "1.8")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error":"error parsing query: found EOF, expected FROM at line 1, char 9"}`))
+	}))
+	defer ts.Close()
+
+	c, _ := NewHTTPClient(HTTPConfig{Addr: ts.URL})
+	defer c.Close()
+
+	resp, err := c.Query(Query{Command: "SELECT *"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var qe *QueryError
+	if !errors.As(resp.Error(), &qe) {
+		t.Fatalf("error:\t%T\nexpected:\t%T", resp.Error(), qe)
+	}
+	expected := QueryError{Message: "error parsing query: found EOF, expected FROM at line 1, char 9", StatusCode: http.StatusBadRequest}
+	if *qe != expected {
+		t.Errorf("error:\t%v\nexpected:\t%v", *qe, expected)
+	}
+	if resp.Error().Error() != expected.Message {
+		t.Errorf("message:\t%s\nexpected:\t%s", resp.Error().Error(), expected.Message)
+	}
+}
+
+func TestErrorSentinels(t *testing.T) {
+	if ErrCacheMiss != memcache.ErrCacheMiss {
+		t.Errorf("ErrCacheMiss should be memcache.ErrCacheMiss")
+	}
+
+	/* 不是 SELECT 语句 */
+	if _, err := EstimateCost("SHOW MEASUREMENTS"); !errors.Is(err, ErrUnsupportedQuery) {
+		t.Errorf("error:\t%v\nexpected:\t%v", err, ErrUnsupportedQuery)
+	}
+
+	/* 语义段数量和表的数量不同 */
+	row := models.Row{Name: "m", Columns: []string{"time", "v"}, Values: [][]interface{}{{json.Number("1"), json.Number("2")}}}
+	resp := &Response{Results: []Result{{Series: []models.Row{row, row}}}}
+	if _, err := (RowCodecV1{}).Encode(resp, CodecMeta{Segments: []string{"{(m.empty)}#{v[int64]}#{empty}#{empty,empty}"}}); !errors.Is(err, ErrSchemaMismatch) {
+		t.Errorf("error:\t%v\nexpected:\t%v", err, ErrSchemaMismatch)
+	}
+
+	/* 语义段过长 */
+	maxKeyLength := MaxKeyLength
+	defer func() { MaxKeyLength = maxKeyLength }()
+	MaxKeyLength = 8
+	if err := setItem("{(m.empty)}#{v[int64]}#{empty}#{empty,empty}", "", "ns", resp, memcache.New("localhost:0")); !errors.Is(err, ErrKeyTooLong) {
+		t.Errorf("error:\t%v\nexpected:\t%v", err, ErrKeyTooLong)
+	}
+}
+
+func TestClient_WriteError(t *testing.T) {
+	var body string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(body))
+	}))
+	defer ts.Close()
+	c, _ := NewHTTPClient(HTTPConfig{Addr: ts.URL})
+	defer c.Close()
+
+	bp, _ := NewBatchPoints(BatchPointsConfig{Database: MyDB, Precision: "s"})
+	for i, fields := range []map[string]interface{}{
+		{"water_level": 8.12},
+		{"water_level": int64(8)},
+		{"water_level": "high"},
+		{"water_level": int64(7)},
+	} {
+		pt, _ := NewPoint("h2o_feet", map[string]string{"location": "coyote_creek"}, fields, time.Unix(1566000000+int64(i), 0))
+		bp.AddPoint(pt)
+	}
+	pH, _ := NewPoint("h2o_pH", nil, map[string]interface{}{"water_level": int64(8)}, time.Unix(1566000000, 0))
+	bp.AddPoint(pH)
+
+	tests := []struct {
+		name     string
+		body     string
+		message  string
+		failed   []int
+		dropped  int
+		messages []string
+	}{
+		{
+			name:     "field type conflict",
+			body:     `{"error":"partial write: field type conflict: input field \"water_level\" on measurement \"h2o_feet\" is type integer, already exists as type float dropped=2"}`,
+			message:  `partial write: field type conflict: input field "water_level" on measurement "h2o_feet" is type integer, already exists as type float dropped=2`,
+			failed:   []int{1, 3},
+			dropped:  2,
+			messages: []string{`field type conflict: input field "water_level" on measurement "h2o_feet" is type integer, already exists as type float`},
+		},
+		{
+			name:     "unable to parse",
+			body:     `{"error":"unable to parse 'h2o_feet,location=coyote_creek water_level=\"high\" 1566000002': invalid boolean\nunable to parse 'cpu value=': missing field value"}`,
+			failed:   []int{2},
+			messages: []string{"invalid boolean"},
+		},
+		{
+			name:     "influxdb 2",
+			body:     `{"code":"invalid","message":"failed to parse line protocol: error parsing line 5 (1-based): invalid field format"}`,
+			message:  "failed to parse line protocol: error parsing line 5 (1-based): invalid field format",
+			failed:   []int{4},
+			messages: []string{"invalid field format"},
+		},
+		{
+			name:    "not json",
+			body:    "bad request\n",
+			message: "bad request",
+		},
+	}
+	for _, test := range tests {
+		body = test.body
+		err := c.Write(bp)
+		var we *WriteError
+		if !errors.As(err, &we) {
+			t.Fatalf("%s: error:\t%T\nexpected:\t%T", test.name, err, we)
+		}
+		if test.message != "" && we.Message != test.message {
+			t.Errorf("%s: message:\t%s\nexpected:\t%s", test.name, we.Message, test.message)
+		}
+		if we.StatusCode != http.StatusBadRequest || we.Dropped != test.dropped || len(we.Failed) != len(test.failed) {
+			t.Errorf("%s: error:\t%+v", test.name, *we)
+			continue
+		}
+		for i, index := range test.failed {
+			f := we.Failed[i]
+			if f.Index != index || f.Line != bp.Points()[index].PrecisionString("s") || f.Message != test.messages[min(i, len(test.messages)-1)] {
+				t.Errorf("%s: failed point:\t%+v", test.name, f)
+			}
+		}
+	}
+}
+
+func TestQueryError_Kind(t *testing.T) {
+	tests := []struct {
+		err       QueryError
+		kind      QueryErrorKind
+		retryable bool
+	}{
+		{QueryError{Message: "error parsing query: found EOF, expected FROM at line 1, char 9", StatusCode: 400}, QueryErrorSyntax, false},
+		{QueryError{Message: "database not found: NOAA"}, QueryErrorDatabaseNotFound, false},
+		{QueryError{Message: "retention policy not found: weekly"}, QueryErrorRetentionPolicyNotFound, false},
+		{QueryError{Message: "authorization failed", StatusCode: 401}, QueryErrorUnauthorized, false},
+		{QueryError{Message: "max-select-series limit exceeded: (12000/10000)"}, QueryErrorLimitExceeded, false},
+		{QueryError{Message: "max-select-point limit exceeed: (10001/10000)"}, QueryErrorLimitExceeded, false},
+		{QueryError{Message: "query-timeout limit exceeded"}, QueryErrorTimeout, true},
+		{QueryError{Message: "max-concurrent-queries limit exceeded(20, 20)"}, QueryErrorTooManyQueries, true},
+		{QueryError{Message: "timeout"}, QueryErrorTimeout, true},
+		{QueryError{Message: "received status code 503 from server", StatusCode: 503}, QueryErrorUnavailable, true},
+		{QueryError{Message: "received status code 403 from server", StatusCode: 403}, QueryErrorUnauthorized, false},
+	}
+	for _, test := range tests {
+		if kind := test.err.Kind(); kind != test.kind || test.err.Retryable() != test.retryable {
+			t.Errorf("%s:\t%v %v\nexpected:\t%v %v", test.err.Message, kind, test.err.Retryable(), test.kind, test.retryable)
+		}
+	}
+
+	if kind := QueryErrorKindOf(nil); kind != QueryErrorNone {
+		t.Errorf("kind:\t%v\nexpected:\t%v", kind, QueryErrorNone)
+	}
+	if kind := QueryErrorKindOf(errors.New("database not found: NOAA")); kind != QueryErrorUnknown {
+		t.Errorf("kind:\t%v\nexpected:\t%v", kind, QueryErrorUnknown)
+	}
+	if s := QueryErrorRetentionPolicyNotFound.String(); s != "retention policy not found" {
+		t.Errorf("string:\t%s", s)
+	}
+}
+
+func TestClient_QueryRetry(t *testing.T) {
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Influxdb-Version", "1.8")
+		if r.FormValue("db") == "missing" {
+			w.Write([]byte(`{"results":[{"statement_id":0,"error":"database not found: missing"}]}`))
+			return
+		}
+		if requests < 3 {
+			w.Write([]byte(`{"results":[{"statement_id":0,"error":"query-timeout limit exceeded"}]}`))
+			return
+		}
+		w.Write([]byte(`{"results":[{"statement_id":0,"series":[{"name":"cpu","columns":["time","value"],"values":[[0,1]]}]}]}`))
+	}))
+	defer ts.Close()
+
+	/* 超时的查询重试到成功 */
+	c, _ := NewHTTPClient(HTTPConfig{Addr: ts.URL, MaxRetries: 3})
+	defer c.Close()
+	resp, err := c.Query(Query{Command: "SELECT value FROM cpu"})
+	if err != nil || resp.Error() != nil || requests != 3 {
+		t.Fatalf("requests:\t%d error:\t%v %v", requests, err, resp.Error())
+	}
+	if resp.ErrorKind() != QueryErrorNone {
+		t.Errorf("kind:\t%v", resp.ErrorKind())
+	}
+
+	/* 不能重试的错误只查询一次 */
+	requests = 0
+	resp, err = c.Query(Query{Command: "SELECT value FROM cpu", Database: "missing"})
+	if err != nil || requests != 1 || resp.ErrorKind() != QueryErrorDatabaseNotFound {
+		t.Errorf("requests:\t%d error:\t%v kind:\t%v", requests, err, resp.ErrorKind())
+	}
+
+	/* 写入数据的命令不重试，已经执行的语句不会再执行一次 */
+	requests = 0
+	resp, _ = c.Query(Query{Command: "SELECT value INTO cpu_copy FROM cpu; SELECT value FROM cpu"})
+	if requests != 1 || resp.ErrorKind() != QueryErrorTimeout {
+		t.Errorf("requests:\t%d kind:\t%v", requests, resp.ErrorKind())
+	}
+}
@@ -0,0 +1,128 @@
+package client
+
+import (
+	"strings"
+)
+
+// 语义段中用来分隔各部分的字符。表名、tag、列名和常量中出现这些字符时（比如 NOAA 数据集的 "level description"）
+// 写成 %XX，语义段中不会出现空格，ByteArrayToResponse 按空格找到语义段的结尾；还原结果时再转换回原来的字符。
+// 不包含这些字符的名字保持不变，和以前的语义段相同
+// 控制字符（memcache 的 key 不能包含）总是转义；多字节的 UTF-8 字符每个字节都不小于 0x80，不会和分隔符混淆，保持不变
+const (
+	smReserved  = " #,{}()=!<>~%'\"" // SM 和 SP：(m.tag=v,...)、(field>'v'[string])
+	sfReserved  = " #,{}[]@%'\""     // SF：col@alias[type],...
+	sfOperators = "+-*/&|^"          // SF 中算术表达式的运算符
+	sgReserved  = " #,{}()|:%'\""    // SG：{aggr:arg|aggr,interval}
+)
+
+// escapeSM 转义 SM 和 SP 中的 tag、tag 值和常量
+func escapeSM(s string) string {
+	return escapeSegment(s, smReserved)
+}
+
+// escapeMeasurement 转义 SM 中的表名，表名和 tag 之间用 '.' 连接，表名中的 '.' 也要转义
+func escapeMeasurement(s string) string {
+	return escapeSegment(s, smReserved+".")
+}
+
+// escapeSF 转义 SF 中的列名或别名，列名中的 '@' 也被转义，和连接别名的 '@' 区分；
+// 算术运算符也被转义，water-level 不会被 sfColumnName 当作算术表达式
+func escapeSF(name string) string {
+	return escapeSegment(name, sfReserved+sfOperators)
+}
+
+// escapeSFExpr 转义 SF 中的算术表达式，保留其中的运算符
+func escapeSFExpr(expr string) string {
+	return escapeSegment(expr, sfReserved)
+}
+
+// escapeSG 转义 SG 中聚合函数的参数
+func escapeSG(arg string) string {
+	return escapeSegment(arg, sgReserved)
+}
+
+func escapeSegment(s string, reserved string) string {
+	if !needsEscape(s, reserved) {
+		return s
+	}
+	const hex = "0123456789ABCDEF"
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if isControl(s[i]) || strings.IndexByte(reserved, s[i]) >= 0 {
+			b.WriteByte('%')
+			b.WriteByte(hex[s[i]>>4])
+			b.WriteByte(hex[s[i]&15])
+			continue
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+func needsEscape(s string, reserved string) bool {
+	for i := 0; i < len(s); i++ {
+		if isControl(s[i]) || strings.IndexByte(reserved, s[i]) >= 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func isControl(c byte) bool {
+	return c < ' ' || c == 0x7f
+}
+
+// unescapeSegment 把语义段中的 %XX 还原成原来的字符，不是合法的 %XX 时保持不变
+func unescapeSegment(s string) string {
+	if !strings.Contains(s, "%") {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '%' && i+2 < len(s) {
+			hi, ok1 := unhex(s[i+1])
+			lo, ok2 := unhex(s[i+2])
+			if ok1 && ok2 {
+				b.WriteByte(hi<<4 | lo)
+				i += 2
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+func unhex(c byte) (byte, bool) {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0', true
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10, true
+	case 'A' <= c && c <= 'F':
+		return c - 'A' + 10, true
+	}
+	return 0, false
+}
+
+// compactExpr 去掉表达式中引号外面的空格，如 usage_user + usage_system 写成 usage_user+usage_system，
+// 引号中的空格保留，"level description" + 1 写成 "level description"+1
+func compactExpr(expr string) string {
+	var b strings.Builder
+	var quote byte
+	for i := 0; i < len(expr); i++ {
+		c := expr[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == ' ':
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
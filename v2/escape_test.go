@@ -0,0 +1,189 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/influxdata/influxdb1-client/models"
+	"github.com/influxdata/influxql"
+)
+
+func TestEscapeSegment(t *testing.T) {
+	tests := []struct {
+		name     string
+		escaped  string
+		expected string
+	}{
+		{name: "coyote_creek", escaped: escapeSM("coyote_creek"), expected: "coyote_creek"},
+		{name: "below 3 feet", escaped: escapeSM("below 3 feet"), expected: "below%203%20feet"},
+		{name: "a,b=(c)", escaped: escapeSM("a,b=(c)"), expected: "a%2Cb%3D%28c%29"},
+		{name: "h2o.feet", escaped: escapeMeasurement("h2o.feet"), expected: "h2o%2Efeet"},
+		{name: "level description@desc", escaped: escapeSF("level description@desc"), expected: "level%20description%40desc"},
+		{name: "100%", escaped: escapeSF("100%"), expected: "100%25"},
+	}
+	for _, tt := range tests {
+		if tt.escaped != tt.expected {
+			t.Errorf("escaped:\t%s\nexpected:\t%s", tt.escaped, tt.expected)
+		}
+		if name := unescapeSegment(tt.escaped); name != tt.name {
+			t.Errorf("unescaped:\t%s\nexpected:\t%s", name, tt.name)
+		}
+	}
+}
+
+func TestSemanticSegment_QuotedIdentifiers(t *testing.T) {
+	defer SetSchema(SetSchema(&Schema{
+		TagKV: MeasurementTagMap{Measurement: map[string][]TagKeyMap{
+			"h2o_feet": {{Tag: map[string]TagValues{"location": {Values: []string{"coyote creek", "santa_monica"}}}}},
+		}},
+		Fields: map[string][]string{"h2o_feet": {"level description", "water_level"}},
+	}))
+
+	queryString := `SELECT "level description", water_level FROM h2o_feet WHERE "level description" = 'below 3 feet' AND location = 'coyote creek' AND time >= '2019-08-18T00:00:00Z' AND time <= '2019-08-18T00:30:00Z' GROUP BY location`
+	resp := &Response{Results: []Result{{Series: []models.Row{{
+		Name:    "h2o_feet",
+		Tags:    map[string]string{"location": "coyote creek"},
+		Columns: []string{"time", "level description", "water_level"},
+		Values: [][]interface{}{
+			{json.Number("1566086400000000000"), "below 3 feet", json.Number("2.064")},
+			{json.Number("1566086760000000000"), "below 3 feet", json.Number("2.116")},
+		},
+	}}}}}
+
+	segment := SemanticSegment(queryString, resp)
+	expected := "{(h2o_feet.location=coyote%20creek)}#{level%20description[string],water_level[float64]}#{(level%20description='below%203%20feet'[string])}#{empty,empty}"
+	if segment != expected {
+		t.Errorf("semantic segment:\t%s\nexpected:\t%s", segment, expected)
+	}
+	if strings.Contains(segment, " ") {
+		t.Errorf("semantic segment should not contain spaces: %s", segment)
+	}
+
+	/* 存入cache的字节数组还原成相同的表名、tag 和列名 */
+	byteArray := resp.ToByteArrayWithPrecision(SeperateSemanticSegment(queryString, resp), "ns")
+	got := ByteArrayToResponse(append(byteArray, []byte("\r\n")...)).Results[0].Series[0]
+	if s := resp.Results[0].Series[0]; got.Name != s.Name || !reflect.DeepEqual(got.Tags, s.Tags) || !reflect.DeepEqual(got.Columns, s.Columns) || len(got.Values) != len(s.Values) {
+		t.Errorf("series:\t%v\nexpected:\t%v", got, s)
+	}
+
+	/* 别名和算术表达式中的双引号 */
+	aliased := `SELECT "level description" AS "desc ription", "water level" + 1 FROM h2o_feet WHERE time >= '2019-08-18T00:00:00Z' AND time <= '2019-08-18T00:30:00Z'`
+	names := sfFieldNames(mustSelect(t, aliased), 2)
+	if names[0] != "level%20description@desc%20ription" || names[1] != `%22water%20level%22+1` {
+		t.Errorf("names:\t%q", names)
+	}
+	if name := sfColumnName(names[0]); name != "desc ription" {
+		t.Errorf("column name:\t%s\nexpected:\t%s", name, "desc ription")
+	}
+	if name := sfColumnName(names[1]); name != "water level" {
+		t.Errorf("column name:\t%s\nexpected:\t%s", name, "water level")
+	}
+}
+
+func mustSelect(t *testing.T, queryString string) *influxql.SelectStatement {
+	s, ok := selectStatement(queryString)
+	if !ok {
+		t.Fatalf("cannot parse %s", queryString)
+	}
+	return s
+}
+
+func TestStringToByteArray_UTF8(t *testing.T) {
+	tests := []struct {
+		str      string
+		expected string
+	}{
+		{str: "海岸", expected: "海岸"},
+		{str: strings.Repeat("a", 24) + "é", expected: strings.Repeat("a", 24)},                       // 第 25 字节在 é 的中间
+		{str: strings.Repeat("水位", 5), expected: "水位水位水位水位"},                                          // 每个字符 3 字节，只保留 24 字节
+		{str: "🌊🌊🌊🌊🌊🌊🌊", expected: "🌊🌊🌊🌊🌊🌊"},                                                          // 每个字符 4 字节
+		{str: strings.Repeat("b", STRINGBYTELENGTH), expected: strings.Repeat("b", STRINGBYTELENGTH)}, // 正好 STRINGBYTELENGTH 字节
+	}
+	for _, tt := range tests {
+		b := StringToByteArray(tt.str)
+		if len(b) != STRINGBYTELENGTH {
+			t.Errorf("length:\t%d\nexpected:\t%d", len(b), STRINGBYTELENGTH)
+		}
+		str := strings.TrimRight(ByteArrayToString(b), "\x00")
+		if str != tt.expected || !utf8.ValidString(str) {
+			t.Errorf("string:\t%q\nexpected:\t%q", str, tt.expected)
+		}
+	}
+}
+
+// randomName 生成包含多字节字符和语义段分隔符的名字
+func randomName(r *rand.Rand, maxRunes int) string {
+	alphabet := []rune("abcxyz_019 ,=#.(){}[]@|%'\"éüñ水位海岸测量データ🌊🚀")
+	n := 1 + r.Intn(maxRunes)
+	runes := make([]rune, n)
+	for i := range runes {
+		runes[i] = alphabet[r.Intn(len(alphabet))]
+	}
+	return string(runes)
+}
+
+func TestSemanticSegment_UnicodeRoundTrip(t *testing.T) {
+	r := rand.New(rand.NewSource(3679))
+	for i := 0; i < 200; i++ {
+		measurement, tagKey := randomName(r, 8), randomName(r, 8)
+		stringField, floatField := randomName(r, 8), randomName(r, 8)
+		if len(map[string]bool{tagKey: true, stringField: true, floatField: true, "time": true}) != 4 {
+			continue
+		}
+		values := map[string]bool{randomName(r, 6): true, randomName(r, 6): true}
+
+		series := make([]models.Row, 0, len(values))
+		for v := range values {
+			series = append(series, models.Row{
+				Name:    measurement,
+				Tags:    map[string]string{tagKey: v},
+				Columns: []string{"time", stringField, floatField},
+				Values: [][]interface{}{
+					{json.Number("1566086400000000000"), randomName(r, 12), json.Number("2.064")},
+					{json.Number("1566086760000000000"), randomName(r, 12), json.Number("-0.5")},
+				},
+			})
+		}
+		resp := SortSeries(&Response{Results: []Result{{Series: series}}})
+		queryString := fmt.Sprintf("SELECT %s,%s FROM %s WHERE time >= '2019-08-18T00:00:00Z' AND time <= '2019-08-18T00:30:00Z' GROUP BY %s",
+			influxql.QuoteIdent(stringField), influxql.QuoteIdent(floatField), influxql.QuoteIdent(measurement), influxql.QuoteIdent(tagKey))
+
+		/* 语义段是合法的 UTF-8，没有空格，分隔符只出现在原来的位置 */
+		segment := SemanticSegment(queryString, resp)
+		if !utf8.ValidString(segment) || strings.Contains(segment, " ") || len(strings.Split(segment, "#")) != 4 {
+			t.Fatalf("semantic segment of %s:\t%s", queryString, segment)
+		}
+		segments := SeperateSemanticSegment(queryString, resp)
+		if len(segments) != len(values) {
+			t.Fatalf("seperate semantic segments of %s:\t%v", queryString, segments)
+		}
+
+		/* 还原出相同的表名、tag、列名和数据，超过 STRINGBYTELENGTH 的字符串在完整的字符之后截断 */
+		byteArray := resp.ToByteArrayWithPrecision(segments, "ns")
+		got := ByteArrayToResponse(append(byteArray, []byte("\r\n")...))
+		if len(got.Results[0].Series) != len(series) {
+			t.Fatalf("series:\t%d\nexpected:\t%d", len(got.Results[0].Series), len(series))
+		}
+		for j, s := range resp.Results[0].Series {
+			g := got.Results[0].Series[j]
+			if g.Name != s.Name || !reflect.DeepEqual(g.Tags, s.Tags) || !reflect.DeepEqual(g.Columns, s.Columns) {
+				t.Fatalf("series:\t%q %q %q\nexpected:\t%q %q %q", g.Name, g.Tags, g.Columns, s.Name, s.Tags, s.Columns)
+			}
+			for k, row := range s.Values {
+				str := strings.TrimRight(g.Values[k][1].(string), "\x00")
+				expected := strings.TrimRight(ByteArrayToString(StringToByteArray(row[1].(string))), "\x00")
+				if str != expected || !utf8.ValidString(str) || !strings.HasPrefix(row[1].(string), str) {
+					t.Errorf("string value:\t%q\nexpected:\t%q", str, row[1])
+				}
+				if g.Values[k][2] != row[2] {
+					t.Errorf("float value:\t%v\nexpected:\t%v", g.Values[k][2], row[2])
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,259 @@
+package client
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/influxdata/influxql"
+)
+
+// CachePlanStepKind 是执行计划中一步的类型
+type CachePlanStepKind string
+
+const (
+	PlanCacheRead CachePlanStepKind = "cache"    // 从cache读取一个语义段在一个时间范围内的结果
+	PlanDBQuery   CachePlanStepKind = "database" // 查询数据库中cache没有覆盖的时间范围
+	PlanMerge     CachePlanStepKind = "merge"    // 按时间顺序合并前面各步的结果，见 MergeResultTable
+)
+
+// CachePlanStep 是执行计划中的一步，Bytes 是按 EstimateCost 估计的这一步读取的字节数
+type CachePlanStep struct {
+	Kind  CachePlanStepKind
+	Key   string // 读取的语义段，查询数据库时是存入结果的语义段
+	Query string // 查询数据库的语句，只在 PlanDBQuery 时有
+	Range Interval
+	Bytes int64
+}
+
+// CachePlan 描述一个查询经过cache时会怎样执行：使用的key、cache已经覆盖和需要查询数据库的时间范围、合并的步骤，
+// 以及从cache和数据库读取的估计字节数，用来排查查询为什么没有命中
+type CachePlan struct {
+	Query     string   // 实际执行的查询，设置了 Quantization 时是对齐之后的查询
+	Keys      []string // 结果在cache中的语义段
+	Predicted bool     // Keys 是根据 schema 推测的：覆盖范围索引中没有这个查询的结果，推测的 SF 数据类型可能和存入时从数据推断的不同
+
+	Ranges   []Interval // 查询的时间范围，OR 连接的多个时间范围分别列出，没有时间范围时为空
+	Covered  []Interval // Ranges 中cache已经覆盖的部分
+	Residual []Interval // Ranges 中需要查询数据库的部分
+
+	Steps      []CachePlanStep
+	CacheBytes int64 // 从cache读取的估计字节数
+	DBBytes    int64 // 从数据库读取的估计字节数
+
+	// Alternatives 是直接的语义段没有完全覆盖时可以借用的语义段：按 tag 分组的结果（见 GetTagSubset）
+	// 和包含更多列的结果（见 GetFieldSubset），只列出key，不计入 Steps
+	Alternatives []string
+}
+
+// ExplainCachePlan 返回查询的执行计划，不读取cache也不查询数据库：key 在覆盖范围索引中查找，
+// 没有记录时根据 schema 推测；覆盖范围来自覆盖范围索引，字节数来自 EstimateCost
+func ExplainCachePlan(queryString string) (*CachePlan, error) {
+	s, ok := selectStatement(queryString)
+	if !ok {
+		return nil, fmt.Errorf("%w: not a SELECT statement: %s", ErrUnsupportedQuery, queryString)
+	}
+	if len(s.Sources) != 1 {
+		return nil, fmt.Errorf("%w: query must select from one measurement: %s", ErrUnsupportedQuery, queryString)
+	}
+	if Quantization != nil {
+		queryString = Quantization.Query(queryString)
+	}
+	plan := &CachePlan{Query: queryString}
+
+	predicted, err := predictSegment(queryString)
+	if err != nil {
+		return nil, err
+	}
+	plan.Keys = matchingSegments(predicted)
+	if len(plan.Keys) == 0 {
+		plan.Keys, plan.Predicted = []string{predicted}, true
+	}
+	key := plan.Keys[0]
+
+	if _, ranges := splitTimeRanges(queryString); len(ranges) > 0 {
+		plan.Ranges = ranges
+	} else if start, end, _ := GetQueryTimeRange(queryString); start >= 0 {
+		plan.Ranges = []Interval{{start, end}}
+	}
+	if len(plan.Ranges) == 0 { // 没有时间范围的查询不使用覆盖范围，整个查询数据库
+		plan.addDBQuery(key, queryString, Interval{})
+		return plan, nil
+	}
+
+	covered, _ := Coverage.Covered(key)
+	for _, r := range plan.Ranges {
+		for _, c := range covered {
+			if c.End < r.Start || c.Start > r.End {
+				continue
+			}
+			plan.Covered = append(plan.Covered, Interval{max(c.Start, r.Start), min(c.End, r.End)})
+		}
+		plan.Residual = append(plan.Residual, subtractIntervals(r, covered)...)
+	}
+	/* 按时间顺序交替列出读取cache和查询数据库的各部分 */
+	ci, ri := 0, 0
+	for ci < len(plan.Covered) || ri < len(plan.Residual) {
+		if ri == len(plan.Residual) || (ci < len(plan.Covered) && plan.Covered[ci].Start < plan.Residual[ri].Start) {
+			plan.addCacheRead(key, queryString, plan.Covered[ci])
+			ci++
+			continue
+		}
+		r := plan.Residual[ri]
+		q, err := QueryWithTimeRange(queryString, r.Start, r.End)
+		if err != nil {
+			return nil, err
+		}
+		plan.addDBQuery(key, q, r)
+		ri++
+	}
+	if len(plan.Steps) > 1 {
+		plan.Steps = append(plan.Steps, CachePlanStep{Kind: PlanMerge, Key: key, Range: Interval{plan.Ranges[0].Start, plan.Ranges[len(plan.Ranges)-1].End}})
+	}
+
+	if len(plan.Residual) > 0 {
+		if superset, err := TagSubsetSegment(queryString, key); err == nil {
+			plan.Alternatives = append(plan.Alternatives, superset)
+		}
+		for _, r := range plan.Ranges {
+			for _, superset := range SupersetSegments(key, r.Start, r.End) {
+				if !slices.Contains(plan.Alternatives, superset) {
+					plan.Alternatives = append(plan.Alternatives, superset)
+				}
+			}
+		}
+	}
+	return plan, nil
+}
+
+func (p *CachePlan) addCacheRead(key, queryString string, r Interval) {
+	bytes := estimateRangeBytes(queryString, r)
+	p.Steps = append(p.Steps, CachePlanStep{Kind: PlanCacheRead, Key: key, Range: r, Bytes: bytes})
+	p.CacheBytes += bytes
+}
+
+func (p *CachePlan) addDBQuery(key, query string, r Interval) {
+	bytes := int64(0)
+	if cost, err := EstimateCost(query); err == nil {
+		bytes = cost.Bytes
+	}
+	p.Steps = append(p.Steps, CachePlanStep{Kind: PlanDBQuery, Key: key, Query: query, Range: r, Bytes: bytes})
+	p.DBBytes += bytes
+}
+
+// estimateRangeBytes 估计查询在时间范围 r 内的结果的字节数
+func estimateRangeBytes(queryString string, r Interval) int64 {
+	q, err := QueryWithTimeRange(queryString, r.Start, r.End)
+	if err != nil {
+		return 0
+	}
+	cost, err := EstimateCost(q)
+	if err != nil {
+		return 0
+	}
+	return cost.Bytes
+}
+
+// String 把执行计划写成多行文本，每一步一行
+func (p *CachePlan) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "query: %s\n", p.Query)
+	for _, key := range p.Keys {
+		if p.Predicted {
+			fmt.Fprintf(&b, "key (predicted): %s\n", key)
+		} else {
+			fmt.Fprintf(&b, "key: %s\n", key)
+		}
+	}
+	fmt.Fprintf(&b, "covered: %v\nresidual: %v\n", p.Covered, p.Residual)
+	for i, step := range p.Steps {
+		switch step.Kind {
+		case PlanDBQuery:
+			fmt.Fprintf(&b, "%d. %s [%d, %d] ~%d bytes: %s\n", i+1, step.Kind, step.Range.Start, step.Range.End, step.Bytes, step.Query)
+		case PlanMerge:
+			fmt.Fprintf(&b, "%d. %s [%d, %d]\n", i+1, step.Kind, step.Range.Start, step.Range.End)
+		default:
+			fmt.Fprintf(&b, "%d. %s [%d, %d] ~%d bytes\n", i+1, step.Kind, step.Range.Start, step.Range.End, step.Bytes)
+		}
+	}
+	fmt.Fprintf(&b, "bytes: cache ~%d, database ~%d\n", p.CacheBytes, p.DBBytes)
+	for _, alt := range p.Alternatives {
+		fmt.Fprintf(&b, "alternative: %s\n", alt)
+	}
+	return b.String()
+}
+
+// matchingSegments 返回覆盖范围索引中除 SF 的数据类型之外都和 predicted 相同的语义段
+func matchingSegments(predicted string) []string {
+	shape := untypedSegment(predicted)
+	segments := make([]string, 0)
+	for _, segment := range Coverage.Segments() {
+		if untypedSegment(segment) == shape {
+			segments = append(segments, segment)
+		}
+	}
+	return segments
+}
+
+// untypedSegment 去掉语义段 SF 中每一列的数据类型
+func untypedSegment(segment string) string {
+	parts := strings.Split(segment, "#")
+	if len(parts) != 4 {
+		return segment
+	}
+	columns := sfColumns(parts[1])
+	for i, c := range columns {
+		if idx := strings.LastIndex(c, "["); idx >= 0 {
+			columns[i] = c[:idx]
+		}
+	}
+	parts[1] = "{" + strings.Join(columns, ",") + "}"
+	return strings.Join(parts, "#")
+}
+
+// predictSegment 不查询数据库，用 schema 推测查询结果的语义段：SM 见 GetSMFromQuery；
+// SF 的数据类型 count 为 int64，mean 等求平均的函数为 float64，其他取 schema 中 field 的类型，tag 为 string，不知道时为 float64
+func predictSegment(queryString string) (string, error) {
+	s, ok := selectStatement(queryString)
+	if !ok {
+		return "", fmt.Errorf("%w: not a SELECT statement: %s", ErrUnsupportedQuery, queryString)
+	}
+	m, ok := s.Sources[0].(*influxql.Measurement)
+	if !ok || m.Regex != nil {
+		return "", fmt.Errorf("%w: query must select from one measurement: %s", ErrUnsupportedQuery, queryString)
+	}
+	schema := CurrentSchema()
+	sm, err := GetSMFromQuery(queryString, schema.TagKV)
+	if err != nil {
+		return "", err
+	}
+	sp, _ := getSP(queryString, m.Name, schema.TagKV)
+	flds, aggr := GetSFSG(queryString)
+	columns := strings.Split(flds, ",")
+	aggregations := strings.Split(aggr, "|")
+	for i, c := range columns {
+		columns[i] = fmt.Sprintf("%s[%s]", c, predictDataType(m.Name, c, aggregationOf(aggregations, i)))
+	}
+	return fmt.Sprintf("%s#{%s}#%s#{%s,%s}", sm, strings.Join(columns, ","), sp, aggr, GetInterval(queryString)), nil
+}
+
+// predictDataType 推测 SF 中一列的数据类型
+func predictDataType(measurement, column, aggr string) string {
+	name := column
+	if idx := strings.LastIndex(name, "@"); idx >= 0 { // 别名
+		name = name[:idx]
+	}
+	switch strings.ToLower(ParseAggregation(aggr).Func) {
+	case "count":
+		return "int64"
+	case "mean", "median", "stddev", "integral", "derivative", "non_negative_derivative", "moving_average":
+		return "float64"
+	}
+	if aggr == "empty" && isTagColumn(measurement, name) {
+		return "string"
+	}
+	if datatype, ok := CurrentSchema().FieldTypes[measurement][unescapeSegment(name)]; ok {
+		return datatype
+	}
+	return "float64"
+}
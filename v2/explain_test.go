@@ -0,0 +1,79 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/influxdata/influxdb1-client/models"
+)
+
+func TestExplainCachePlan(t *testing.T) {
+	defer SetSchema(SetSchema(&Schema{
+		Fields:     map[string][]string{"h2o_feet": {"water_level"}},
+		FieldTypes: map[string]map[string]string{"h2o_feet": {"water_level": "float64"}},
+		TagKV: MeasurementTagMap{Measurement: map[string][]TagKeyMap{
+			"h2o_feet": {{Tag: map[string]TagValues{"location": {Values: []string{"coyote_creek", "santa_monica"}}}}},
+		}},
+	}))
+	defer func(ci *CoverageIndex) { Coverage = ci }(Coverage)
+	Coverage = NewCoverageIndex()
+
+	/* cache中有前一半时间的结果，整数形式的值存入时推断为 int64 */
+	query := "SELECT water_level FROM h2o_feet WHERE location = 'coyote_creek' AND time >= 0 AND time <= 3600000000000 GROUP BY location"
+	resp := &Response{Results: []Result{{Series: []models.Row{{
+		Name:    "h2o_feet",
+		Tags:    map[string]string{"location": "coyote_creek"},
+		Columns: []string{"time", "water_level"},
+		Values:  [][]interface{}{{json.Number("0"), json.Number("8")}},
+	}}}}}
+	segment := SemanticSegment(query, resp)
+	Coverage.Add(segment, Interval{0, 1800000000000})
+
+	plan, err := ExplainCachePlan(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.Predicted || !reflect.DeepEqual(plan.Keys, []string{segment}) {
+		t.Errorf("keys:\t%v %v\nexpected:\t%v", plan.Keys, plan.Predicted, segment)
+	}
+	if !reflect.DeepEqual(plan.Covered, []Interval{{0, 1800000000000}}) || !reflect.DeepEqual(plan.Residual, []Interval{{1800000000001, 3600000000000}}) {
+		t.Errorf("covered:\t%v\nresidual:\t%v", plan.Covered, plan.Residual)
+	}
+	kinds := make([]CachePlanStepKind, 0)
+	for _, step := range plan.Steps {
+		kinds = append(kinds, step.Kind)
+	}
+	if !reflect.DeepEqual(kinds, []CachePlanStepKind{PlanCacheRead, PlanDBQuery, PlanMerge}) {
+		t.Fatalf("steps:\t%v", kinds)
+	}
+	if plan.CacheBytes <= 0 || plan.CacheBytes != plan.Steps[0].Bytes || plan.DBBytes != plan.Steps[1].Bytes {
+		t.Errorf("bytes:\tcache %d, database %d", plan.CacheBytes, plan.DBBytes)
+	}
+	if start, end, _ := GetQueryTimeRange(plan.Steps[1].Query); start != 1800000000001 || end != 3600000000000 {
+		t.Errorf("residual query:\t%s", plan.Steps[1].Query)
+	}
+	if !strings.Contains(plan.String(), "2. database") {
+		t.Errorf("plan:\n%s", plan)
+	}
+
+	/* 没有记录时推测 key，整个查询数据库 */
+	Coverage = NewCoverageIndex()
+	plan, err = ExplainCachePlan(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	predicted := strings.Replace(segment, "[int64]", "[float64]", 1)
+	if !plan.Predicted || !reflect.DeepEqual(plan.Keys, []string{predicted}) {
+		t.Errorf("keys:\t%v %v\nexpected:\t%v", plan.Keys, plan.Predicted, predicted)
+	}
+	if len(plan.Steps) != 1 || plan.Steps[0].Kind != PlanDBQuery || plan.CacheBytes != 0 {
+		t.Errorf("steps:\t%+v", plan.Steps)
+	}
+
+	if _, err := ExplainCachePlan("SHOW MEASUREMENTS"); !errors.Is(err, ErrUnsupportedQuery) {
+		t.Errorf("error:\t%v\nexpected:\t%v", err, ErrUnsupportedQuery)
+	}
+}
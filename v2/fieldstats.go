@@ -0,0 +1,277 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/influxdata/influxdb1-client/models"
+)
+
+// FieldStats 为 true 时，结果转换成字节数组时每张表的表头在 #{precision} 之后再记录 #{行数,min~max,...}：
+// 每一列（包括 time）非空值的最小值和最大值。查询有额外的 field 谓词时，PruneItem 可以只读表头就去掉不可能满足的表
+var FieldStats = false
+
+// ColumnStats 是一张表中一列非空值的最小值和最大值，数值为 json.Number，没有非空值时都为 nil
+type ColumnStats struct {
+	Min interface{}
+	Max interface{}
+}
+
+// TableStats 是表头中记录的一张表的统计，Columns 的顺序和 SF 相同，第一列是 time；
+// 一张表拆成多个item存入时，每一部分的表头记录的都是整张表的统计
+type TableStats struct {
+	Segment string // 语义段，不包括 #{precision} 和统计
+	Rows    int64
+	Columns []ColumnStats
+}
+
+// statsSegment 返回一张表的统计在表头中的写法，datatypes 是每一列的数据类型，字符串中的分隔符用 %XX 转义
+func statsSegment(s models.Row, datatypes []string) string {
+	parts := make([]string, 0, len(datatypes)+1)
+	parts = append(parts, strconv.Itoa(len(s.Values)))
+	for j, datatype := range datatypes {
+		var min, max interface{}
+		for _, row := range s.Values {
+			if j >= len(row) || row[j] == nil {
+				continue
+			}
+			v := row[j]
+			if min == nil || compareStats(datatype, v, min) < 0 {
+				min = v
+			}
+			if max == nil || compareStats(datatype, v, max) > 0 {
+				max = v
+			}
+		}
+		if min == nil {
+			parts = append(parts, "")
+			continue
+		}
+		parts = append(parts, formatStatsValue(datatype, min)+"~"+formatStatsValue(datatype, max))
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+// compareStats 按列的数据类型比较两个值，bool 中 false 小于 true
+func compareStats(datatype string, a, b interface{}) int {
+	switch datatype {
+	case "string":
+		return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+	case "bool":
+		ab, _ := a.(bool)
+		bb, _ := b.(bool)
+		switch {
+		case ab == bb:
+			return 0
+		case bb:
+			return -1
+		}
+		return 1
+	}
+	cmp, _ := compareNumbers(a, b)
+	return cmp
+}
+
+// formatStatsValue 把值写成和字节数组中存入的值相同的形式，浮点数用能精确还原的最短形式
+func formatStatsValue(datatype string, v interface{}) string {
+	switch datatype {
+	case "string":
+		return escapeSegment(fmt.Sprint(v), smReserved+"~")
+	case "float64":
+		if f, ok := numberOf(v); ok {
+			return strconv.FormatFloat(f, 'g', -1, 64)
+		}
+	}
+	return fmt.Sprint(v)
+}
+
+// parseStatsValue 是 formatStatsValue 的逆过程
+func parseStatsValue(datatype string, s string) (interface{}, error) {
+	switch datatype {
+	case "string":
+		return unescapeSegment(s), nil
+	case "bool":
+		return strconv.ParseBool(s)
+	case "int64":
+		if _, err := strconv.ParseInt(s, 10, 64); err != nil {
+			return nil, err
+		}
+	case "float64":
+		if _, err := strconv.ParseFloat(s, 64); err != nil {
+			return nil, err
+		}
+	}
+	return json.Number(s), nil
+}
+
+// parseTableStats 从表头的语义段（包括 #{precision}）读取统计，没有记录统计时 ok 为 false
+func parseTableStats(segment string) (stats TableStats, ok bool, err error) {
+	section, _ := headerExtras(segment)
+	if section == "" {
+		return TableStats{}, false, nil
+	}
+	parts := strings.Split(segment, "#")
+	stats.Segment = strings.Join(parts[:4], "#")
+	datatypes := DataTypeArrayFromSF("time[int64]," + strings.Trim(parts[1], "{}"))
+	items := strings.Split(strings.Trim(section, "{}"), ",")
+	if len(items) != len(datatypes)+1 {
+		return TableStats{}, false, fmt.Errorf("malformed statistics %s for %d columns", section, len(datatypes))
+	}
+	if stats.Rows, err = strconv.ParseInt(items[0], 10, 64); err != nil {
+		return TableStats{}, false, err
+	}
+	stats.Columns = make([]ColumnStats, len(datatypes))
+	for j, item := range items[1:] {
+		if item == "" {
+			continue
+		}
+		idx := strings.Index(item, "~")
+		if idx < 0 {
+			return TableStats{}, false, fmt.Errorf("malformed statistics %s", item)
+		}
+		if stats.Columns[j].Min, err = parseStatsValue(datatypes[j], item[:idx]); err != nil {
+			return TableStats{}, false, err
+		}
+		if stats.Columns[j].Max, err = parseStatsValue(datatypes[j], item[idx+1:]); err != nil {
+			return TableStats{}, false, err
+		}
+	}
+	return stats, true, nil
+}
+
+// ItemStats 只读取字节数组中每张表的表头，返回记录了统计的表的统计，不转换表中的数据
+func ItemStats(data []byte) ([]TableStats, error) {
+	tables, err := parseItemTables(data)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]TableStats, 0, len(tables))
+	for _, t := range tables {
+		stats, ok, err := parseTableStats(t.segment)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			result = append(result, stats)
+		}
+	}
+	return result, nil
+}
+
+// PruneItem 根据表头中的统计去掉不可能有数据满足 predicates 中 field 谓词的表，只读取表头，不转换表中的数据；
+// 没有记录统计的表、聚合结果（谓词作用于聚合之前的数据）和 SF 中没有谓词的列时保留表。所有表都被去掉时返回 "empty response"
+func PruneItem(data []byte, predicates []Predicate) ([]byte, error) {
+	if len(data) == 0 || isEmptyItem(data) {
+		return data, nil
+	}
+	tables, err := parseItemTables(data)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]byte, 0, len(data))
+	kept := 0
+	for _, t := range tables {
+		stats, ok, err := parseTableStats(t.segment)
+		if err != nil {
+			return nil, err
+		}
+		if ok && !tableMayMatch(stats, predicates) {
+			continue
+		}
+		if t.columnar {
+			result = append(result, FormatColumnar)
+		}
+		result = append(result, t.header...)
+		result = append(result, t.data...)
+		kept++
+	}
+	if kept == 0 {
+		return StringToByteArray("empty response"), nil
+	}
+	return result, nil
+}
+
+// tableMayMatch 判断表中是否可能有数据满足所有 field 谓词
+func tableMayMatch(stats TableStats, predicates []Predicate) bool {
+	parts := strings.Split(stats.Segment, "#")
+	if sg := strings.Split(strings.Trim(parts[3], "{}"), ","); sg[0] != "empty" {
+		return true
+	}
+	columns := make(map[string]int)
+	for j, f := range strings.Split(strings.Trim(parts[1], "{}"), ",") {
+		name := f
+		if idx := strings.Index(name, "["); idx >= 0 {
+			name = name[:idx]
+		}
+		if idx := strings.Index(name, "@"); idx >= 0 {
+			name = name[:idx]
+		}
+		if idx := strings.Index(name, "::"); idx >= 0 {
+			name = name[:idx]
+		}
+		columns[unescapeSegment(name)] = j + 1 // 第一列是 time
+	}
+	for _, p := range predicates {
+		if p.IsTag {
+			continue
+		}
+		j, ok := columns[p.Key]
+		if !ok || j >= len(stats.Columns) {
+			continue
+		}
+		if !p.MayMatch(stats.Columns[j]) {
+			return false
+		}
+	}
+	return true
+}
+
+// MayMatch 判断最小值和最大值在 c 范围内的一列数据是否可能有值满足谓词；正则表达式的谓词总是可能满足
+func (p Predicate) MayMatch(c ColumnStats) bool {
+	if c.Min == nil || c.Max == nil {
+		return false
+	}
+	cmpMin, ok1 := comparePredicateValue(c.Min, p.Value)
+	cmpMax, ok2 := comparePredicateValue(c.Max, p.Value)
+	if !ok1 || !ok2 {
+		return true
+	}
+	switch p.Op {
+	case "=":
+		return cmpMin <= 0 && cmpMax >= 0
+	case "!=":
+		return !(cmpMin == 0 && cmpMax == 0)
+	case "<":
+		return cmpMin < 0
+	case "<=":
+		return cmpMin <= 0
+	case ">":
+		return cmpMax > 0
+	case ">=":
+		return cmpMax >= 0
+	}
+	return true
+}
+
+// comparePredicateValue 比较统计中的值和谓词中的常量，类型不能比较时 ok 为 false
+func comparePredicateValue(v interface{}, want interface{}) (int, bool) {
+	switch w := want.(type) {
+	case string:
+		s, ok := v.(string)
+		if !ok {
+			return 0, false
+		}
+		return strings.Compare(s, w), true
+	case bool:
+		b, ok := v.(bool)
+		if !ok {
+			return 0, false
+		}
+		return compareStats("bool", b, w), true
+	case int64, float64:
+		return compareNumbers(v, w)
+	}
+	return 0, false
+}
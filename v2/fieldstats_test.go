@@ -0,0 +1,161 @@
+package client
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/influxdata/influxdb1-client/models"
+)
+
+func statsResponse() *Response {
+	return &Response{Results: []Result{{Series: []models.Row{
+		{
+			Name:    "h2o_feet",
+			Tags:    map[string]string{"location": "coyote_creek"},
+			Columns: []string{"time", "level description", "water_level"},
+			Values: [][]interface{}{
+				{json.Number("1566086400000000000"), "between 6 and 9 feet", json.Number("8.12")},
+				{json.Number("1566086760000000000"), "between 6 and 9 feet", json.Number("7.887")},
+				{json.Number("1566087120000000000"), nil, nil},
+			},
+		},
+		{
+			Name:    "h2o_feet",
+			Tags:    map[string]string{"location": "santa_monica"},
+			Columns: []string{"time", "level description", "water_level"},
+			Values: [][]interface{}{
+				{json.Number("1566086400000000000"), "below 3 feet", json.Number("2.064")},
+				{json.Number("1566086760000000000"), "below 3 feet", json.Number("-0.5")},
+			},
+		},
+	}}}}
+}
+
+var statsSegments = []string{
+	"{(h2o_feet.location=coyote_creek)}#{level%20description[string],water_level[float64]}#{empty}#{empty,empty}",
+	"{(h2o_feet.location=santa_monica)}#{level%20description[string],water_level[float64]}#{empty}#{empty,empty}",
+}
+
+func TestItemStats(t *testing.T) {
+	defer func() { FieldStats = false }()
+	FieldStats = true
+
+	data := statsResponse().ToByteArrayWithSegments(statsSegments)
+	stats, err := ItemStats(data)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []TableStats{
+		{Segment: statsSegments[0], Rows: 3, Columns: []ColumnStats{
+			{json.Number("1566086400000000000"), json.Number("1566087120000000000")},
+			{"between 6 and 9 feet", "between 6 and 9 feet"},
+			{json.Number("7.887"), json.Number("8.12")},
+		}},
+		{Segment: statsSegments[1], Rows: 2, Columns: []ColumnStats{
+			{json.Number("1566086400000000000"), json.Number("1566086760000000000")},
+			{"below 3 feet", "below 3 feet"},
+			{json.Number("-0.5"), json.Number("2.064")},
+		}},
+	}
+	if !reflect.DeepEqual(stats, expected) {
+		t.Errorf("stats:\t%v\nexpected:\t%v", stats, expected)
+	}
+
+	/* 表头中的统计不影响还原结果 */
+	FieldStats = false
+	plain := statsResponse().ToByteArrayWithSegments(statsSegments)
+	if !ResponsesEqual(ByteArrayToResponse(data), ByteArrayToResponse(plain), CompareOptions{}) {
+		t.Errorf("response:\n%s\nexpected:\n%s", ByteArrayToResponse(data).ToString(), ByteArrayToResponse(plain).ToString())
+	}
+	if stats, err := ItemStats(plain); err != nil || len(stats) != 0 {
+		t.Errorf("stats without FieldStats:\t%v %v", stats, err)
+	}
+}
+
+func TestPruneItem(t *testing.T) {
+	defer func() { FieldStats = false }()
+	FieldStats = true
+	data := statsResponse().ToByteArrayWithSegments(statsSegments)
+	columnar, err := ColumnarCodec{}.Encode(statsResponse(), CodecMeta{Segments: statsSegments})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		predicates []Predicate
+		locations  []string
+	}{
+		{"greater than max of one table", []Predicate{{Key: "water_level", Op: ">", Value: int64(3)}}, []string{"coyote_creek"}},
+		{"between min and max", []Predicate{{Key: "water_level", Op: "=", Value: 8.0}}, []string{"coyote_creek"}},
+		{"less than every min", []Predicate{{Key: "water_level", Op: "<", Value: -1.0}}, nil},
+		{"string", []Predicate{{Key: "level description", Op: "=", Value: "below 3 feet"}}, []string{"santa_monica"}},
+		{"unknown column is ignored", []Predicate{{Key: "index", Op: ">", Value: int64(100)}}, []string{"coyote_creek", "santa_monica"}},
+		{"tag predicate is ignored", []Predicate{{Key: "location", Op: "=", Value: "x", IsTag: true}}, []string{"coyote_creek", "santa_monica"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, item := range [][]byte{data, columnar} {
+				pruned, err := PruneItem(item, tt.predicates)
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				resp, _, err := DecodeItem(pruned)
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				locations := make([]string, 0)
+				for _, s := range resp.Results[0].Series {
+					locations = append(locations, s.Tags["location"])
+				}
+				if len(tt.locations) == 0 && len(locations) == 0 {
+					continue
+				}
+				if !reflect.DeepEqual(locations, tt.locations) {
+					t.Errorf("locations:\t%v\nexpected:\t%v", locations, tt.locations)
+				}
+			}
+		})
+	}
+
+	/* 聚合结果的表不按原始数据的谓词去掉 */
+	segments := []string{
+		"{(h2o_feet.location=coyote_creek)}#{level%20description[string],water_level[float64]}#{empty}#{max,12m}",
+		"{(h2o_feet.location=santa_monica)}#{level%20description[string],water_level[float64]}#{empty}#{max,12m}",
+	}
+	aggregated := statsResponse().ToByteArrayWithSegments(segments)
+	pruned, err := PruneItem(aggregated, []Predicate{{Key: "water_level", Op: "<", Value: -1.0}})
+	if err != nil || !reflect.DeepEqual(pruned, aggregated) {
+		t.Errorf("aggregated item was pruned: %v", err)
+	}
+}
+
+func TestPredicateMayMatch(t *testing.T) {
+	c := ColumnStats{Min: json.Number("29"), Max: json.Number("91")}
+	tests := []struct {
+		predicate Predicate
+		expected  bool
+	}{
+		{Predicate{Op: "=", Value: int64(29)}, true},
+		{Predicate{Op: "=", Value: int64(92)}, false},
+		{Predicate{Op: "!=", Value: int64(29)}, true},
+		{Predicate{Op: "<", Value: int64(29)}, false},
+		{Predicate{Op: "<=", Value: int64(29)}, true},
+		{Predicate{Op: ">", Value: 91.0}, false},
+		{Predicate{Op: ">=", Value: 90.5}, true},
+		{Predicate{Op: "=", Value: "29"}, true}, // 类型不同时不能判断
+	}
+	for _, tt := range tests {
+		if match := tt.predicate.MayMatch(c); match != tt.expected {
+			t.Errorf("%s %v:\t%v\nexpected:\t%v", tt.predicate.Op, tt.predicate.Value, match, tt.expected)
+		}
+	}
+	if (Predicate{Op: "!=", Value: int64(1)}).MayMatch(ColumnStats{Min: json.Number("1"), Max: json.Number("1")}) {
+		t.Error("!= should not match a column with a single value")
+	}
+	if (Predicate{Op: ">", Value: int64(1)}).MayMatch(ColumnStats{}) {
+		t.Error("a column without values should not match")
+	}
+}
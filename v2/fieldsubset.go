@@ -0,0 +1,163 @@
+package client
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/InfluxDB-client/memcache"
+	"github.com/influxdata/influxdb1-client/models"
+)
+
+// SupersetSegments 返回覆盖范围索引中可以投影出语义段 segment 的语义段：SM 和 SP 相同，SG 的区间相同，
+// SF 包含 segment 的所有列（列名和数据类型都相同）且对应列的聚合函数相同，并且在cache中覆盖了 [start, end]。
+// 按列数从少到多排列，读取时优先使用数据量最小的语义段；segment 本身不在结果中
+func SupersetSegments(segment string, start, end int64) []string {
+	parts := strings.Split(segment, "#")
+	if len(parts) != 4 {
+		return nil
+	}
+	type candidate struct {
+		segment string
+		fields  int
+	}
+	candidates := make([]candidate, 0)
+	for _, s := range Coverage.Segments() {
+		if s == segment {
+			continue
+		}
+		sp := strings.Split(s, "#")
+		if len(sp) != 4 || sp[0] != parts[0] || sp[2] != parts[2] {
+			continue
+		}
+		if _, ok := projectionIndexes(parts[1], parts[3], sp[1], sp[3]); !ok {
+			continue
+		}
+		covered, _ := Coverage.Covered(s)
+		if len(subtractIntervals(Interval{start, end}, covered)) > 0 {
+			continue
+		}
+		candidates = append(candidates, candidate{segment: s, fields: len(sfColumns(sp[1]))})
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].fields < candidates[j].fields })
+	segments := make([]string, len(candidates))
+	for i, c := range candidates {
+		segments[i] = c.segment
+	}
+	return segments
+}
+
+// sfColumns 返回 SF 中的各列，如 {usage_user[float64],usage_idle[float64]} 中的 usage_user[float64] 和 usage_idle[float64]
+func sfColumns(sf string) []string {
+	sf = strings.TrimSuffix(strings.TrimPrefix(sf, "{"), "}")
+	if sf == "" {
+		return nil
+	}
+	return strings.Split(sf, ",") // 列名中的逗号已经转义
+}
+
+// projectionIndexes 返回 SF 和 SG 为 sf、sg 的结果的每一列在 SF 和 SG 为 supersetSF、supersetSG 的结果中的位置（不包括 time）；
+// 某一列不在其中，或者聚合函数、区间不同时返回 false
+func projectionIndexes(sf, sg, supersetSF, supersetSG string) ([]int, bool) {
+	groups := strings.Split(strings.Trim(sg, "{}"), ",")
+	supersetGroups := strings.Split(strings.Trim(supersetSG, "{}"), ",")
+	if len(groups) < 2 || len(groups) != len(supersetGroups) || !slices.Equal(groups[1:], supersetGroups[1:]) {
+		return nil, false
+	}
+	columns, supersetColumns := sfColumns(sf), sfColumns(supersetSF)
+	if len(columns) == 0 {
+		return nil, false
+	}
+	aggregations, supersetAggregations := strings.Split(groups[0], "|"), strings.Split(supersetGroups[0], "|")
+
+	indexes := make([]int, len(columns))
+	for i, column := range columns {
+		indexes[i] = -1
+		for j, c := range supersetColumns {
+			if c == column && aggregationOf(aggregations, i) == aggregationOf(supersetAggregations, j) {
+				indexes[i] = j
+				break
+			}
+		}
+		if indexes[i] < 0 {
+			return nil, false
+		}
+	}
+	return indexes, true
+}
+
+// GetFieldSubset 查询的语义段在cache中未命中时，从 SupersetSegments 找到的包含更多列的结果中取出查询的列，
+// 列名按查询语句生成，和数据库返回的相同。没有聚合函数时去掉取出的列都为空值的行和没有行的表，和数据库的处理相同；
+// 这需要cache中保留了空值：Nulls 为 NullZero 时空值变成零值，为 NullSkipRow 时缺少有空值的行，都不能投影。
+// 没有可用的语义段时返回 memcache.ErrCacheMiss
+func GetFieldSubset(queryString, segment string, startTime, endTime int64, mc *memcache.Client) (*Response, error) {
+	if Nulls.Policy != NullSentinel && Nulls.Policy != NullError {
+		return nil, memcache.ErrCacheMiss
+	}
+	s, ok := selectStatement(queryString)
+	if !ok {
+		return nil, fmt.Errorf("%w: not a SELECT statement: %s", ErrUnsupportedQuery, queryString)
+	}
+	for _, f := range s.Fields {
+		if hasWildcard(f.Expr) {
+			return nil, fmt.Errorf("%w: wildcard fields cannot be projected: %s", ErrUnsupportedQuery, queryString)
+		}
+	}
+	parts := strings.Split(segment, "#")
+	if len(parts) != 4 {
+		return nil, fmt.Errorf("invalid semantic segment %s", segment)
+	}
+	columns := s.ColumnNames()
+	if len(columns) != len(sfColumns(parts[1]))+1 {
+		return nil, fmt.Errorf("%w: columns of %s do not match SF %s", ErrUnsupportedQuery, queryString, parts[1])
+	}
+
+	for _, superset := range SupersetSegments(segment, startTime, endTime) {
+		sp := strings.Split(superset, "#")
+		indexes, _ := projectionIndexes(parts[1], parts[3], sp[1], sp[3])
+		resp, err := getResponse(superset, startTime, startTime, endTime, mc)
+		if err == memcache.ErrCacheMiss {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		return projectColumns(resp, indexes, columns, strings.HasPrefix(parts[3], "{empty,")), nil
+	}
+	return nil, memcache.ErrCacheMiss
+}
+
+// projectColumns 从结果的每张表中取出 time 和 indexes 中的列（不包括 time 的位置），列名换成 columns；
+// dropNullRows 为 true 时去掉取出的列都为空值的行，以及因此没有行的表
+func projectColumns(resp *Response, indexes []int, columns []string, dropNullRows bool) *Response {
+	result := &Response{Err: resp.Err, Results: make([]Result, len(resp.Results)), statusCode: resp.statusCode}
+	for i, r := range resp.Results {
+		r.Series = make([]models.Row, 0, len(resp.Results[i].Series))
+		for _, s := range resp.Results[i].Series {
+			values := make([][]interface{}, 0, len(s.Values))
+			for _, row := range s.Values {
+				projected := make([]interface{}, len(indexes)+1)
+				projected[0] = row[0]
+				empty := true
+				for k, idx := range indexes {
+					if idx+1 < len(row) {
+						projected[k+1] = row[idx+1]
+					}
+					if projected[k+1] != nil {
+						empty = false
+					}
+				}
+				if dropNullRows && empty {
+					continue
+				}
+				values = append(values, projected)
+			}
+			if dropNullRows && len(values) == 0 {
+				continue
+			}
+			r.Series = append(r.Series, models.Row{Name: s.Name, Tags: s.Tags, Columns: columns, Values: values, Partial: s.Partial})
+		}
+		result.Results[i] = r
+	}
+	return result
+}
@@ -0,0 +1,86 @@
+package client
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/InfluxDB-client/diskcache"
+	"github.com/InfluxDB-client/memcache"
+	"github.com/influxdata/influxdb1-client/models"
+)
+
+func TestGetFieldSubset(t *testing.T) {
+	s, err := diskcache.Listen(filepath.Join(t.TempDir(), "cache.db"), "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	mc := memcache.New(s.Addr())
+	defer func(ci *CoverageIndex, nulls NullHandling) { Coverage, Nulls = ci, nulls }(Coverage, Nulls)
+	Coverage = NewCoverageIndex()
+	Nulls.Policy = NullSentinel
+
+	/* 三列的结果存入cache，第二行只有 usage_idle 有值 */
+	superset := "SELECT usage_user,usage_system,usage_idle FROM cpu WHERE time >= 0 AND time <= 100"
+	supersetResp := &Response{Results: []Result{{Series: []models.Row{{
+		Name:    "cpu",
+		Columns: []string{"time", "usage_user", "usage_system", "usage_idle"},
+		Values: [][]interface{}{
+			{json.Number("10"), json.Number("1.5"), json.Number("2.5"), json.Number("96.5")},
+			{json.Number("20"), nil, nil, json.Number("97.5")},
+		},
+	}}}}}
+	if err := setResponse(superset, "ns", supersetResp, mc); err != nil {
+		t.Fatal(err)
+	}
+
+	query := "SELECT usage_system, usage_user FROM cpu WHERE time >= 0 AND time <= 50"
+	segment := "{(cpu.empty)}#{usage_system[float64],usage_user[float64]}#{empty}#{empty,empty}"
+	if segments := SupersetSegments(segment, 0, 50); len(segments) != 1 || segments[0] != SemanticSegment(superset, supersetResp) {
+		t.Fatalf("superset segments:\t%v\nexpected:\t%v", segments, SemanticSegment(superset, supersetResp))
+	}
+	if segments := SupersetSegments(segment, 0, 200); len(segments) != 0 {
+		t.Errorf("superset segments not covering the range:\t%v", segments)
+	}
+
+	resp, err := GetFieldSubset(query, segment, 0, 50, mc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	/* 第二行取出的列都是空值，去掉 */
+	columns := []string{"time", "usage_system", "usage_user"}
+	values := [][]interface{}{{json.Number("10"), json.Number("2.5"), json.Number("1.5")}}
+	if series := resp.Results[0].Series; len(series) != 1 || !reflect.DeepEqual(series[0].Columns, columns) || !reflect.DeepEqual(series[0].Values, values) {
+		t.Errorf("series:\t%v\nexpected:\t%v %v", series, columns, values)
+	}
+
+	/* 空值存成零值时不知道哪些行需要去掉，不能投影 */
+	Nulls.Policy = NullZero
+	if _, err := GetFieldSubset(query, segment, 0, 50, mc); err != memcache.ErrCacheMiss {
+		t.Errorf("NullZero:\t%v\nexpected:\t%v", err, memcache.ErrCacheMiss)
+	}
+	Nulls.Policy = NullSentinel
+
+	/* 列的数据类型或聚合函数不同时不能投影 */
+	for _, segment := range []string{
+		"{(cpu.empty)}#{usage_user[int64]}#{empty}#{empty,empty}",
+		"{(cpu.empty)}#{usage_user[float64]}#{empty}#{max,1m}",
+		"{(cpu.empty)}#{usage_guest[float64]}#{empty}#{empty,empty}",
+	} {
+		if _, err := GetFieldSubset("SELECT usage_user FROM cpu", segment, 0, 50, mc); err != memcache.ErrCacheMiss {
+			t.Errorf("%s:\t%v\nexpected:\t%v", segment, err, memcache.ErrCacheMiss)
+		}
+	}
+}
+
+func TestProjectionIndexes(t *testing.T) {
+	indexes, ok := projectionIndexes("{usage_idle[float64]}", "{max,1m}", "{usage_user[float64],usage_idle[float64]}", "{min|max,1m}")
+	if !ok || !reflect.DeepEqual(indexes, []int{1}) {
+		t.Errorf("indexes:\t%v %v\nexpected:\t%v", indexes, ok, []int{1})
+	}
+	if _, ok := projectionIndexes("{usage_idle[float64]}", "{max,1m}", "{usage_user[float64],usage_idle[float64]}", "{max,5m}"); ok {
+		t.Error("intervals differ")
+	}
+}
@@ -0,0 +1,550 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/InfluxDB-client/memcache"
+)
+
+// fluxDialect requests annotated CSV with every annotation needed to rebuild typed series.
+var fluxDialect = map[string]interface{}{
+	"header":         true,
+	"delimiter":      ",",
+	"annotations":    []string{"datatype", "group", "default"},
+	"commentPrefix":  "#",
+	"dateTimeFormat": "RFC3339",
+}
+
+// QueryFlux sends a Flux query to /api/v2/query and returns the result
+// converted into the Response/Series model. Every Flux table becomes one
+// Series: _measurement is the series name, the remaining group key columns
+// are the tags and _value is named after _field when the table has one.
+func (c *client) QueryFlux(ctx context.Context, flux string) (*Response, error) {
+	u := c.url
+	u.Path = path.Join(u.Path, "api/v2/query")
+
+	body, err := json.Marshal(map[string]interface{}{
+		"query":   flux,
+		"type":    "flux",
+		"dialect": fluxDialect,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/csv")
+	req.Header.Set("User-Agent", c.useragent)
+	c.setAuth(req)
+	if c.org != "" {
+		params := req.URL.Query()
+		params.Set("org", c.org)
+		req.URL.RawQuery = params.Encode()
+	}
+
+	resp, err := c.do(req, true)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		var fluxErr struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		}
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		if json.Unmarshal(msg, &fluxErr) == nil && fluxErr.Message != "" {
+			return nil, fmt.Errorf("flux query failed with status %d: %s", resp.StatusCode, fluxErr.Message)
+		}
+		return nil, fmt.Errorf("flux query failed with status %d: %q", resp.StatusCode, msg)
+	}
+
+	return ParseFluxCSV(resp.Body)
+}
+
+// queryFlux makes the Flux query with c, failing if c is not a FluxQuerier.
+func queryFlux(ctx context.Context, c Client, flux string) (*Response, error) {
+	fq, ok := c.(FluxQuerier)
+	if !ok {
+		return nil, fmt.Errorf("%T does not support Flux queries", c)
+	}
+	return fq.QueryFlux(ctx, flux)
+}
+
+// fluxMetaColumns are annotated CSV columns that never become tags or values.
+var fluxMetaColumns = map[string]bool{
+	"":             true,
+	"result":       true,
+	"table":        true,
+	"_start":       true,
+	"_stop":        true,
+	"_time":        true,
+	"_measurement": true,
+	"_field":       true,
+}
+
+// ParseFluxCSV converts an annotated CSV Flux response into a Response.
+// Each Flux result becomes one Result and each table one Series.
+func ParseFluxCSV(r io.Reader) (*Response, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = false
+
+	var (
+		response  Response
+		datatypes []string
+		groups    []string
+		defaults  []string
+		header    []string
+		column    map[string]int
+		section   int
+	)
+	resultIndex := make(map[string]int)
+	seriesIndex := make(map[string]int)
+
+	for {
+		rec, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse flux csv: %w", err)
+		}
+
+		switch {
+		case rec[0] == "#datatype":
+			datatypes, header = rec, nil
+			section++
+			continue
+		case rec[0] == "#group":
+			groups = rec
+			continue
+		case rec[0] == "#default":
+			defaults = rec
+			continue
+		case strings.HasPrefix(rec[0], "#"):
+			continue
+		case header == nil:
+			header = rec
+			column = make(map[string]int, len(rec))
+			for i, name := range rec {
+				column[name] = i
+			}
+			if _, ok := column["error"]; ok {
+				row, err := reader.Read()
+				if err == nil && len(row) > column["error"] {
+					return nil, errors.New(row[column["error"]])
+				}
+				return nil, errors.New("flux query returned an error table")
+			}
+			continue
+		}
+
+		cell := func(name string) string {
+			idx, ok := column[name]
+			if !ok || idx >= len(rec) {
+				return ""
+			}
+			if rec[idx] == "" && idx < len(defaults) {
+				return defaults[idx]
+			}
+			return rec[idx]
+		}
+
+		resultName := cell("result")
+		ri, ok := resultIndex[resultName]
+		if !ok {
+			ri = len(response.Results)
+			resultIndex[resultName] = ri
+			response.Results = append(response.Results, Result{StatementId: ri})
+		}
+
+		key := fmt.Sprintf("%d#%s#%s", section, resultName, cell("table"))
+		si, ok := seriesIndex[key]
+		if !ok {
+			tags := make(map[string]string)
+			columns := []string{"time"}
+			for i, name := range header {
+				if fluxMetaColumns[name] {
+					continue
+				}
+				if i < len(groups) && groups[i] == "true" {
+					tags[name] = cell(name)
+					continue
+				}
+				if name == "_value" && cell("_field") != "" {
+					name = cell("_field")
+				}
+				columns = append(columns, name)
+			}
+			si = len(response.Results[ri].Series)
+			seriesIndex[key] = si
+			response.Results[ri].Series = append(response.Results[ri].Series, SeriesToRow(Series{
+				Name:    cell("_measurement"),
+				Tags:    tags,
+				Columns: columns,
+				Values:  make([][]interface{}, 0),
+			}))
+		}
+
+		value := []interface{}{cell("_time")}
+		for i, name := range header {
+			if fluxMetaColumns[name] || (i < len(groups) && groups[i] == "true") {
+				continue
+			}
+			datatype := ""
+			if i < len(datatypes) {
+				datatype = datatypes[i]
+			}
+			value = append(value, fluxValue(datatype, cell(name)))
+		}
+		series := &response.Results[ri].Series[si]
+		series.Values = append(series.Values, value)
+	}
+
+	return &response, nil
+}
+
+// fluxValue converts an annotated CSV cell into the value types used by Response.
+func fluxValue(datatype, cell string) interface{} {
+	if cell == "" && datatype != "string" {
+		return nil
+	}
+	switch datatype {
+	case "long", "unsignedLong", "double":
+		return json.Number(cell)
+	case "boolean":
+		return cell == "true"
+	default:
+		return cell
+	}
+}
+
+var (
+	fluxBucketExpr    = regexp.MustCompile(`from\s*\(\s*bucket\s*:\s*"([^"]*)"\s*\)`)
+	fluxRangeExpr     = regexp.MustCompile(`range\s*\(([^)]*)\)`)
+	fluxFilterExpr    = regexp.MustCompile(`(?s)^filter\s*\(\s*fn\s*:\s*\(\s*r\s*\)\s*=>\s*(.+)\)$`)
+	fluxAggrWinExpr   = regexp.MustCompile(`aggregateWindow\s*\(([^)]*)\)`)
+	fluxStageSplitter = regexp.MustCompile(`\|>`)
+)
+
+// FluxSemanticSegment 根据 Flux 查询语句生成用作cache key的语义段，格式和 InfluxQL 的语义段对应：
+//
+//	{bucket}#{filters}#{other stages}#{aggr,every}
+//
+// range() 不属于语义段，时间范围和 InfluxQL 一样通过 cache item 的起止时间表示；
+// 语义段只依赖查询语句本身，不需要先查询数据库，所以可以直接用来从cache读取
+func FluxSemanticSegment(flux string) string {
+	bucket := "empty"
+	if m := fluxBucketExpr.FindStringSubmatch(flux); m != nil {
+		bucket = m[1]
+	}
+
+	aggr, every := "empty", "empty"
+	if m := fluxAggrWinExpr.FindStringSubmatch(flux); m != nil {
+		args := fluxArgs(m[1])
+		if v, ok := args["fn"]; ok {
+			aggr = strings.ToLower(v)
+		}
+		if v, ok := args["every"]; ok {
+			every = v
+		}
+	}
+
+	/* 所有 filter 的谓词，去掉空格后按字典序排列，让顺序不同的等价 filter 得到相同的key；
+	   无法解析的 filter 和其余的管道操作（pivot、keep 等）一样会影响结果，原样保留在语义段中 */
+	filters := make([]string, 0)
+	others := make([]string, 0)
+	for _, stage := range fluxStageSplitter.Split(flux, -1) {
+		stage = strings.TrimSpace(stage)
+		if stage == "" || fluxBucketExpr.MatchString(stage) || strings.HasPrefix(stage, "range") ||
+			strings.HasPrefix(stage, "aggregateWindow") || strings.HasPrefix(stage, "yield") {
+			continue
+		}
+		if strings.HasPrefix(stage, "filter") {
+			if predicate, ok := fluxFilterPredicate(stage); ok {
+				filters = append(filters, "("+compactFlux(predicate)+")")
+				continue
+			}
+		}
+		others = append(others, compactFlux(stage))
+	}
+	sort.Strings(filters)
+
+	result := fmt.Sprintf("{%s}#{%s}#{%s}#{%s,%s}", bucket, strings.Join(filters, ""), strings.Join(others, "|>"), aggr, every)
+	return result
+}
+
+// fluxFilterPredicate 返回 filter(fn: (r) => ...) 中的谓词，谓词可以跨越多行；
+// filter 的括号按引号之外的括号配对，括号之后还有其他内容或者不是 fn: (r) => 的形式时 ok 为 false
+func fluxFilterPredicate(stage string) (predicate string, ok bool) {
+	open := strings.IndexByte(stage, '(')
+	if open < 0 {
+		return "", false
+	}
+	depth, quoted := 0, false
+	for i := open; i < len(stage); i++ {
+		switch ch := stage[i]; {
+		case ch == '\\' && quoted:
+			i++
+		case ch == '"':
+			quoted = !quoted
+		case ch == '(' && !quoted:
+			depth++
+		case ch == ')' && !quoted:
+			depth--
+			if depth == 0 {
+				if strings.TrimSpace(stage[i+1:]) != "" {
+					return "", false
+				}
+				m := fluxFilterExpr.FindStringSubmatch(stage[:i+1])
+				if m == nil {
+					return "", false
+				}
+				return m[1], true
+			}
+		}
+	}
+	return "", false
+}
+
+// compactFlux 去掉引号之外的空白字符，引号内的空格替换成 %20，保证语义段中没有空格（cache 协议用空格分隔参数）
+func compactFlux(expr string) string {
+	var b strings.Builder
+	quoted := false
+	for _, ch := range expr {
+		switch {
+		case ch == '"':
+			quoted = !quoted
+			b.WriteRune(ch)
+		case ch == ' ' && quoted:
+			b.WriteString("%20")
+		case (ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r') && !quoted:
+		default:
+			b.WriteRune(ch)
+		}
+	}
+	return b.String()
+}
+
+// fluxArgs 把 "every: 1m, fn: mean" 形式的参数列表解析成 map
+func fluxArgs(args string) map[string]string {
+	result := make(map[string]string)
+	for _, arg := range strings.Split(args, ",") {
+		idx := strings.Index(arg, ":")
+		if idx < 0 {
+			continue
+		}
+		key := strings.TrimSpace(arg[:idx])
+		val := strings.Trim(strings.TrimSpace(arg[idx+1:]), `"`)
+		result[key] = val
+	}
+	return result
+}
+
+// GetFluxTimeRange 从 range(start:, stop:) 中获取查询的时间范围（纳秒），
+// 支持 RFC3339 时间、Unix 秒、相对于 now() 的 duration（-1h、-7d）；没有 stop 时为当前时间
+// 无法解析时返回 -1, -1
+func GetFluxTimeRange(flux string) (int64, int64) {
+	m := fluxRangeExpr.FindStringSubmatch(flux)
+	if m == nil {
+		return -1, -1
+	}
+	now := time.Now()
+	args := fluxArgs(m[1])
+
+	start, ok := fluxTime(args["start"], now)
+	if !ok {
+		return -1, -1
+	}
+	end := now.UnixNano()
+	if stop, exists := args["stop"]; exists {
+		if end, ok = fluxTime(stop, now); !ok {
+			return -1, -1
+		}
+	}
+	return start, end
+}
+
+// fluxTime 解析 range() 中的一个时间参数
+func fluxTime(arg string, now time.Time) (int64, bool) {
+	arg = strings.TrimSpace(arg)
+	if arg == "" {
+		return 0, false
+	}
+	if arg == "now()" {
+		return now.UnixNano(), true
+	}
+	if t, err := time.Parse(time.RFC3339Nano, arg); err == nil {
+		return t.UnixNano(), true
+	}
+	if sec, err := strconv.ParseInt(arg, 10, 64); err == nil {
+		return sec * int64(time.Second), true
+	}
+	if d, ok := parseFluxDuration(arg); ok {
+		return now.Add(d).UnixNano(), true
+	}
+	return 0, false
+}
+
+// parseFluxDuration 在 time.ParseDuration 的基础上支持 Flux 的 d（天）和 w（周）单位
+func parseFluxDuration(s string) (time.Duration, bool) {
+	if d, err := time.ParseDuration(s); err == nil {
+		return d, true
+	}
+	sign := time.Duration(1)
+	if strings.HasPrefix(s, "-") {
+		sign, s = -1, s[1:]
+	}
+	var total time.Duration
+	for len(s) > 0 {
+		i := 0
+		for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+			i++
+		}
+		if i == 0 || i == len(s) {
+			return 0, false
+		}
+		n, _ := strconv.ParseInt(s[:i], 10, 64)
+		j := i
+		for j < len(s) && (s[j] < '0' || s[j] > '9') {
+			j++
+		}
+		unit := s[i:j]
+		switch unit {
+		case "w":
+			total += time.Duration(n) * 7 * 24 * time.Hour
+		case "d":
+			total += time.Duration(n) * 24 * time.Hour
+		default:
+			d, err := time.ParseDuration(s[:j])
+			if err != nil {
+				return 0, false
+			}
+			total += d
+		}
+		s = s[j:]
+	}
+	return sign * total, true
+}
+
+// FluxSeperateSemanticSegment 生成 Flux 结果中每张表单独的语义段，格式和 SeperateSemanticSegment 相同，
+// 供 ToByteArrayWithSegments 和 ByteArrayToResponse 使用；列名直接保存在SF中，所以SG固定为 {empty,empty}
+func FluxSeperateSemanticSegment(flux string, resp *Response) []string {
+	if ResponseIsEmpty(resp) {
+		return []string{"{empty}"}
+	}
+	datatypes := DataTypeArrayFromResponse(resp)
+	segments := strings.Split(FluxSemanticSegment(flux), "#")
+	sp := segments[1]
+
+	result := make([]string, 0, len(resp.Results[0].Series))
+	for _, s := range resp.Results[0].Series {
+		tags := make([]string, 0, len(s.Tags))
+		for k, v := range s.Tags {
+			tags = append(tags, fmt.Sprintf("%s.%s=%s", escapeMeasurement(s.Name), escapeSM(k), escapeSM(v)))
+		}
+		sort.Strings(tags)
+		if len(tags) == 0 {
+			tags = append(tags, fmt.Sprintf("%s.empty", escapeMeasurement(s.Name)))
+		}
+
+		fields := make([]string, 0, len(s.Columns))
+		for i, col := range s.Columns {
+			if i == 0 || i >= len(datatypes) {
+				continue
+			}
+			fields = append(fields, fmt.Sprintf("%s[%s]", escapeSF(col), datatypes[i]))
+		}
+		result = append(result, fmt.Sprintf("{(%s)}#{%s}#%s#{empty,empty}", strings.Join(tags, ","), strings.Join(fields, ","), sp))
+	}
+	return result
+}
+
+// FluxSet 执行 Flux 查询并把结果存入cache，key 为 FluxSemanticSegment
+func FluxSet(flux string, c Client, mc *memcache.Client) error {
+	resp, err := queryFlux(context.Background(), c, flux)
+	if err != nil {
+		return err
+	}
+	if ResponseIsEmpty(resp) {
+		return nil
+	}
+
+	value, err := ItemCodec.Encode(resp, CodecMeta{Segments: FluxSeperateSemanticSegment(flux, resp)})
+	if err != nil {
+		return err
+	}
+	startTime, endTime := GetResponseTimeRange(resp)
+	segment := FluxSemanticSegment(flux)
+	item := memcache.Item{
+		Key:         cacheKey(segment),
+		Value:       value,
+		Time_start:  startTime,
+		Time_end:    endTime,
+		NumOfTables: int64(len(resp.Results[0].Series)),
+	}
+	if err := mc.Set(&item); err != nil {
+		return err
+	}
+
+	/* range() 有起止时间时，整个范围都已经存入cache */
+	if st, et := GetFluxTimeRange(flux); st >= 0 {
+		startTime, endTime = st, et
+	}
+	Coverage.Add(segment, Interval{startTime, endTime})
+	return nil
+}
+
+// FluxGet 根据 Flux 查询语句的语义段和 range() 时间范围从cache读取结果，未命中时返回 memcache.ErrCacheMiss
+func FluxGet(flux string, mc *memcache.Client) (*Response, error) {
+	startTime, endTime := GetFluxTimeRange(flux)
+	segment := FluxSemanticSegment(flux)
+	HotKeys.Observe(segment)
+	start := time.Now()
+	values, _, err := mc.Get(cacheKey(segment), startTime, endTime)
+	observeLatency(StageCacheGet, start)
+	if err != nil {
+		return nil, err
+	}
+	if len(values) == 0 {
+		return nil, memcache.ErrCacheMiss
+	}
+	Coverage.Hit(segment)
+	start = time.Now()
+	resp, err := decodeRange(values, "", startTime, endTime)
+	if err != nil {
+		return nil, err
+	}
+	observeLatency(StageDeserialize, start)
+	if startTime >= 0 {
+		resp = TrimResponse(resp, startTime, endTime)
+	}
+	if Shadow != nil {
+		Shadow.Observe(flux, FluxSemanticSegment(flux), resp, func() (*Response, error) {
+			return queryFlux(context.Background(), Shadow.conf.Client, flux)
+		})
+	}
+	return resp, nil
+}
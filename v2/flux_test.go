@@ -0,0 +1,212 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/InfluxDB-client/memcache"
+)
+
+const fluxCSV = "#datatype,string,long,dateTime:RFC3339,dateTime:RFC3339,dateTime:RFC3339,double,string,string,string\r\n" +
+	"#group,false,false,true,true,false,false,true,true,true\r\n" +
+	"#default,_result,,,,,,,,\r\n" +
+	",result,table,_start,_stop,_time,_value,_field,_measurement,location\r\n" +
+	",,0,2019-08-18T00:00:00Z,2019-08-18T00:30:00Z,2019-08-18T00:00:00Z,8.12,water_level,h2o_feet,coyote_creek\r\n" +
+	",,0,2019-08-18T00:00:00Z,2019-08-18T00:30:00Z,2019-08-18T00:06:00Z,8.005,water_level,h2o_feet,coyote_creek\r\n" +
+	",,1,2019-08-18T00:00:00Z,2019-08-18T00:30:00Z,2019-08-18T00:00:00Z,2.064,water_level,h2o_feet,santa_monica\r\n" +
+	"\r\n"
+
+func TestParseFluxCSV(t *testing.T) {
+	resp, err := ParseFluxCSV(strings.NewReader(fluxCSV))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(resp.Results) != 1 || len(resp.Results[0].Series) != 2 {
+		t.Fatalf("unexpected shape: %+v", resp)
+	}
+
+	s := resp.Results[0].Series[0]
+	if s.Name != "h2o_feet" {
+		t.Errorf("name:\t%s\nexpected:\t%s", s.Name, "h2o_feet")
+	}
+	if !reflect.DeepEqual(s.Tags, map[string]string{"location": "coyote_creek"}) {
+		t.Errorf("tags:\t%v", s.Tags)
+	}
+	if !reflect.DeepEqual(s.Columns, []string{"time", "water_level"}) {
+		t.Errorf("columns:\t%v", s.Columns)
+	}
+	expected := [][]interface{}{
+		{"2019-08-18T00:00:00Z", json.Number("8.12")},
+		{"2019-08-18T00:06:00Z", json.Number("8.005")},
+	}
+	if !reflect.DeepEqual(s.Values, expected) {
+		t.Errorf("values:\t%v\nexpected:\t%v", s.Values, expected)
+	}
+}
+
+func TestParseFluxCSV_Error(t *testing.T) {
+	body := "#datatype,string,string\r\n#group,true,true\r\n#default,,\r\n,error,reference\r\n,failed to execute query,897\r\n"
+	if _, err := ParseFluxCSV(strings.NewReader(body)); err == nil || err.Error() != "failed to execute query" {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestClient_QueryFlux(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v2/query" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		if org := r.URL.Query().Get("org"); org != "my-org" {
+			t.Errorf("unexpected org %q", org)
+		}
+		if auth := r.Header.Get("Authorization"); auth != "Token my-token" {
+			t.Errorf("unexpected authorization header %q", auth)
+		}
+		var body map[string]interface{}
+		b, _ := io.ReadAll(r.Body)
+		_ = json.Unmarshal(b, &body)
+		if body["type"] != "flux" {
+			t.Errorf("unexpected query type %v", body["type"])
+		}
+		w.Header().Set("Content-Type", "text/csv")
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, fluxCSV)
+	}))
+	defer ts.Close()
+
+	c, _ := NewHTTPClient(HTTPConfig{Addr: ts.URL, Token: "my-token", Org: "my-org"})
+	defer c.Close()
+
+	resp, err := c.(FluxQuerier).QueryFlux(context.Background(), `from(bucket:"NOAA_water_database") |> range(start: -1h)`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(resp.Results[0].Series) != 2 {
+		t.Errorf("series:\t%d\nexpected:\t%d", len(resp.Results[0].Series), 2)
+	}
+}
+
+func TestQueryFlux_Unsupported(t *testing.T) {
+	/* 包装的客户端转发 Flux 查询，不支持 Flux 的客户端返回错误 */
+	uc := &udpclient{conn: &writeLogger{}, payloadSize: 512}
+	wc, _ := NewWriteThroughClient(WriteThroughConfig{Client: uc, Cache: memcache.New("localhost:0")})
+	if _, err := wc.(FluxQuerier).QueryFlux(context.Background(), `from(bucket:"b")`); err == nil {
+		t.Error("expected an error from a client without Flux support")
+	}
+	if _, ok := Client(uc).(FluxQuerier); ok {
+		t.Error("udp client should not be a FluxQuerier")
+	}
+}
+
+func TestFluxSemanticSegment(t *testing.T) {
+	tests := []struct {
+		name     string
+		flux     string
+		expected string
+	}{
+		{
+			name: "filters and aggregateWindow",
+			flux: `from(bucket: "NOAA_water_database")
+				|> range(start: 2019-08-18T00:00:00Z, stop: 2019-08-18T00:30:00Z)
+				|> filter(fn: (r) => r._measurement == "h2o_feet")
+				|> filter(fn: (r) => r._field == "water_level")
+				|> aggregateWindow(every: 12m, fn: mean)`,
+			expected: `{NOAA_water_database}#{(r._field=="water_level")(r._measurement=="h2o_feet")}#{}#{mean,12m}`,
+		},
+		{
+			name:     "filter order and time range do not change the key",
+			flux:     `from(bucket: "NOAA_water_database") |> range(start: -1h) |> filter(fn: (r) => r._field == "water_level") |> filter(fn: (r) => r._measurement == "h2o_feet") |> aggregateWindow(every: 12m, fn: mean)`,
+			expected: `{NOAA_water_database}#{(r._field=="water_level")(r._measurement=="h2o_feet")}#{}#{mean,12m}`,
+		},
+		{
+			name:     "other stages and quoted spaces",
+			flux:     `from(bucket: "db") |> range(start: -1h) |> filter(fn: (r) => r._field == "level description") |> keep(columns: ["_time", "_value"])`,
+			expected: `{db}#{(r._field=="level%20description")}#{keep(columns:["_time","_value"])}#{empty,empty}`,
+		},
+		{
+			name: "multi-line filter",
+			flux: `from(bucket: "b") |> range(start: -1h)
+				|> filter(fn: (r) => r._measurement == "cpu" and
+					(r.host == "a"))
+				|> mean()`,
+			expected: `{b}#{(r._measurement=="cpu"and(r.host=="a"))}#{mean()}#{empty,empty}`,
+		},
+		{
+			name:     "filter without a predicate is kept as a stage",
+			flux:     `from(bucket: "b") |> range(start: -1h) |> filter(fn: keepCPU) |> mean()`,
+			expected: `{b}#{}#{filter(fn:keepCPU)|>mean()}#{empty,empty}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			segment := FluxSemanticSegment(tt.flux)
+			if segment != tt.expected {
+				t.Errorf("segment:\t%s\nexpected:\t%s", segment, tt.expected)
+			}
+		})
+	}
+}
+
+func TestFluxSemanticSegment_MultiLineFilter(t *testing.T) {
+	/* 跨越多行的 filter 谓词不同时语义段也不同 */
+	flux := "from(bucket: \"b\") |> range(start: -1h) |> filter(fn: (r) => r._measurement == \"cpu\" and\n r.host == \"%s\") |> mean()"
+	a, b := FluxSemanticSegment(fmt.Sprintf(flux, "a")), FluxSemanticSegment(fmt.Sprintf(flux, "b"))
+	if a == b {
+		t.Errorf("segments of different filters are equal:\t%s", a)
+	}
+}
+
+func TestGetFluxTimeRange(t *testing.T) {
+	st, et := GetFluxTimeRange(`from(bucket: "db") |> range(start: 2019-08-18T00:00:00Z, stop: 2019-08-18T00:30:00Z)`)
+	if st != 1566086400000000000 || et != 1566088200000000000 {
+		t.Errorf("time range:\t%d %d", st, et)
+	}
+
+	st, et = GetFluxTimeRange(`from(bucket: "db") |> range(start: 1566086400, stop: 1566088200)`)
+	if st != 1566086400000000000 || et != 1566088200000000000 {
+		t.Errorf("time range:\t%d %d", st, et)
+	}
+
+	st, et = GetFluxTimeRange(`from(bucket: "db") |> range(start: -7d)`)
+	if d := time.Duration(et - st); d < 7*24*time.Hour || d > 7*24*time.Hour+time.Second {
+		t.Errorf("relative range:\t%v", d)
+	}
+
+	if st, et = GetFluxTimeRange(`from(bucket: "db")`); st != -1 || et != -1 {
+		t.Errorf("time range without range():\t%d %d", st, et)
+	}
+}
+
+func TestFluxSeperateSemanticSegment_RoundTrip(t *testing.T) {
+	flux := `from(bucket: "db") |> range(start: -1h) |> filter(fn: (r) => r._measurement == "h2o_feet")`
+	resp, _ := ParseFluxCSV(strings.NewReader(fluxCSV))
+
+	segments := FluxSeperateSemanticSegment(flux, resp)
+	expected := `{(h2o_feet.location=coyote_creek)}#{water_level[float64]}#{(r._measurement=="h2o_feet")}#{empty,empty}`
+	if segments[0] != expected {
+		t.Errorf("segment:\t%s\nexpected:\t%s", segments[0], expected)
+	}
+
+	byteArray := resp.ToByteArrayWithSegments(segments)
+	byteArray = append(byteArray, []byte("\r\n")...) // Get() 返回的数据末尾带有 CRLF
+	converted := ByteArrayToResponse(byteArray)
+	if len(converted.Results[0].Series) != 2 {
+		t.Fatalf("series:\t%d", len(converted.Results[0].Series))
+	}
+	s := converted.Results[0].Series[0]
+	if s.Name != "h2o_feet" || s.Tags["location"] != "coyote_creek" || !reflect.DeepEqual(s.Columns, []string{"time", "water_level"}) {
+		t.Errorf("converted series:\t%v", s)
+	}
+	if s.Values[1][1] != json.Number("8.005") {
+		t.Errorf("converted value:\t%v", s.Values[1][1])
+	}
+}
@@ -0,0 +1,63 @@
+package client
+
+import (
+	"errors"
+	"time"
+
+	"github.com/InfluxDB-client/memcache"
+	"github.com/influxdata/influxdb1-client/models"
+)
+
+// GetFragmentResponse 从cache读取一个语义段和 [startTime, endTime] 相交的所有片段，拼接成一个结果，同时返回这些片段覆盖的时间范围。
+// 同一个语义段可能由多次查询分别存入不同的时间范围，不需要有一个片段完整覆盖查询的时间范围；
+// 片段按起始时间升序处理，和前面的片段重叠的部分只保留前面片段的数据，覆盖范围按起始时间升序排列、互不相交。
+// fatcache 不支持 getf 时改用 Get 读取，Get 不返回每个片段的时间范围，用结果中数据的时间范围作为覆盖范围
+func GetFragmentResponse(segment string, startTime, endTime int64, mc *memcache.Client) (*Response, []Interval, error) {
+	HotKeys.Observe(segment)
+	start := time.Now()
+	items, err := mc.GetFragments(cacheKey(segment), startTime, endTime+1) // getf 的结束时间不包括在范围内
+	observeLatency(StageCacheGet, start)
+	if errors.Is(err, memcache.ErrFragmentsUnsupported) {
+		resp, err := getResponse(segment, startTime, startTime, endTime, mc)
+		if err != nil {
+			return nil, nil, err
+		}
+		if ResponseIsEmpty(resp) {
+			return nil, nil, memcache.ErrCacheMiss
+		}
+		st, et := GetResponseTimeRange(resp)
+		return resp, []Interval{{st, et}}, nil
+	} else if err != nil {
+		return nil, nil, err
+	}
+
+	start = time.Now()
+	defer observeLatency(StageDeserialize, start)
+	covered := make([]Interval, 0, len(items))
+	series := make([]models.Row, 0)
+	next := startTime // 前面的片段已经覆盖到 next 之前
+	for _, item := range items {
+		in := Interval{Start: max(item.Time_start, next), End: min(item.Time_end, endTime)}
+		if in.Start > in.End {
+			continue
+		}
+		covered = append(covered, in)
+		next = in.End + 1
+
+		decoded, err := decodeRange(item.Value, "ns", in.Start, in.End)
+		if err != nil {
+			return nil, nil, err
+		}
+		resp := TrimResponse(StitchPartialSeries(decoded), in.Start, in.End)
+		if !ResponseIsEmpty(resp) {
+			series = append(series, resp.Results[0].Series...)
+		}
+	}
+	if len(covered) == 0 {
+		return nil, nil, memcache.ErrCacheMiss
+	}
+	Coverage.Hit(segment)
+
+	resp := &Response{Results: []Result{{Series: series}}}
+	return SortSeries(StitchPartialSeries(resp)), mergeIntervals(covered), nil
+}
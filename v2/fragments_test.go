@@ -0,0 +1,183 @@
+package client
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/InfluxDB-client/memcache"
+	"github.com/influxdata/influxdb1-client/models"
+)
+
+// newFragmentServer 返回一个支持 get 和 getf 的cache，每个 key 存入多个片段
+func newFragmentServer(t *testing.T, fragments map[string][]*memcache.Item) net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					var key string
+					var start, end int64
+					if n, _ := fmt.Sscanf(line, "get %s %d %d\r\n", &key, &start, &end); n == 3 {
+						/* get 把相交的片段拼接成一个字节数组 */
+						w := bufio.NewWriter(conn)
+						found := false
+						for _, it := range fragments[key] {
+							if it.Time_start <= end && it.Time_end >= start {
+								w.Write(it.Value)
+								found = true
+							}
+						}
+						if found {
+							w.Write([]byte("\r\n"))
+						}
+						w.Write([]byte("END\r\n"))
+						w.Flush()
+						continue
+					}
+					if n, _ := fmt.Sscanf(line, "getf %s %d %d\r\n", &key, &start, &end); n != 3 {
+						conn.Write([]byte("ERROR\r\n"))
+						continue
+					}
+					w := bufio.NewWriter(conn)
+					for _, it := range fragments[key] {
+						if it.Time_start < end && it.Time_end >= start {
+							fmt.Fprintf(w, "VALUE %s %d %d %d\r\n", key, it.Time_start, it.Time_end, len(it.Value))
+							w.Write(it.Value)
+							w.Write([]byte("\r\n"))
+						}
+					}
+					w.Write([]byte("END\r\n"))
+					w.Flush()
+				}
+			}()
+		}
+	}()
+	return l
+}
+
+func fragmentItem(segment string, times ...int64) *memcache.Item {
+	values := make([][]interface{}, 0, len(times))
+	for _, ts := range times {
+		values = append(values, []interface{}{json.Number(fmt.Sprint(ts)), json.Number(fmt.Sprint(ts * 10))})
+	}
+	resp := &Response{Results: []Result{{Series: []models.Row{
+		{Name: "h2o_feet", Tags: map[string]string{"location": "coyote_creek"}, Columns: []string{"time", "index"}, Values: values},
+	}}}}
+	return &memcache.Item{Key: segment, Value: resp.ToByteArrayWithPrecision([]string{segment}, "ns"), Time_start: times[0], Time_end: times[len(times)-1]}
+}
+
+func TestGetFragmentResponse(t *testing.T) {
+	segment := "{(h2o_feet.location=coyote_creek)}#{index[int64]}#{empty}#{empty,empty}"
+	/* 三次查询分别存入的片段，第二个和第三个片段在 [55, 60] 重叠 */
+	l := newFragmentServer(t, map[string][]*memcache.Item{segment: {
+		fragmentItem(segment, 40, 50, 60),
+		fragmentItem(segment, 10, 20),
+		fragmentItem(segment, 55, 60, 70),
+	}})
+	defer l.Close()
+	client := memcache.New(l.Addr().String())
+
+	resp, covered, err := GetFragmentResponse(segment, 15, 65, client)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expectedCovered := []Interval{{15, 20}, {40, 65}}
+	if !reflect.DeepEqual(covered, expectedCovered) {
+		t.Errorf("covered:\t%v\nexpected:\t%v", covered, expectedCovered)
+	}
+	times := make([]interface{}, 0)
+	for _, row := range resp.Results[0].Series[0].Values {
+		times = append(times, row[0])
+	}
+	expectedTimes := []interface{}{json.Number("20"), json.Number("40"), json.Number("50"), json.Number("60")}
+	if len(resp.Results[0].Series) != 1 || !reflect.DeepEqual(times, expectedTimes) {
+		t.Errorf("response:\n%s", resp.ToString())
+	}
+
+	/* 没有相交的片段 */
+	if _, _, err := GetFragmentResponse(segment, 100, 200, client); err != memcache.ErrCacheMiss {
+		t.Errorf("error:\t%v\nexpected:\t%v", err, memcache.ErrCacheMiss)
+	}
+}
+
+func TestFindGaps_Fragments(t *testing.T) {
+	segment := "{(h2o_feet.location=coyote_creek)}#{index[int64]}#{empty}#{empty,empty}"
+	l := newFragmentServer(t, map[string][]*memcache.Item{segment: {
+		fragmentItem(segment, 10, 20),
+		fragmentItem(segment, 40, 50, 60),
+	}})
+	defer l.Close()
+	defer SetDefaultCache(SetDefaultCache(memcache.New(l.Addr().String())))
+
+	/* 覆盖范围索引中没有这个语义段，根据片段存入时的时间范围找出缺失的部分 */
+	gaps := FindGaps(segment, 0, 100)
+	expected := []Interval{{0, 9}, {21, 39}, {61, 100}}
+	if !reflect.DeepEqual(gaps, expected) {
+		t.Errorf("gaps:\t%v\nexpected:\t%v", gaps, expected)
+	}
+}
+
+func TestGetFragmentResponse_Get(t *testing.T) {
+	segment := "{(h2o_feet.location=coyote_creek)}#{index[int64]}#{empty}#{empty,empty}"
+	item := fragmentItem(segment, 40, 50, 60)
+
+	/* fatcache 只支持 get，不认识 getf */
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					var key string
+					var start, end int64
+					if n, _ := fmt.Sscanf(line, "get %s %d %d\r\n", &key, &start, &end); n != 3 {
+						conn.Write([]byte("ERROR\r\n"))
+						continue
+					}
+					conn.Write(append(append(append([]byte(nil), item.Value...), "\r\n"...), "END\r\n"...))
+				}
+			}()
+		}
+	}()
+
+	resp, covered, err := GetFragmentResponse(segment, 0, 100, memcache.New(l.Addr().String()))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := []Interval{{40, 60}}; !reflect.DeepEqual(covered, expected) {
+		t.Errorf("covered:\t%v\nexpected:\t%v", covered, expected)
+	}
+	if values := resp.Results[0].Series[0].Values; len(values) != 3 || values[0][0] != json.Number("40") {
+		t.Errorf("response:\n%s", resp.ToString())
+	}
+}
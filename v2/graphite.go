@@ -0,0 +1,213 @@
+package client
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultGraphiteTemplate keeps the whole dotted metric name as the measurement.
+	DefaultGraphiteTemplate = "measurement*"
+
+	// DefaultGraphiteSeparator joins multiple measurement or field parts.
+	DefaultGraphiteSeparator = "."
+
+	// DefaultIngestField is the field name used when a line carries a single value.
+	DefaultIngestField = "value"
+)
+
+// GraphiteConfig is the config data needed to create a GraphiteParser.
+type GraphiteConfig struct {
+	// Template maps the dot separated parts of a metric name to the point.
+	// Each template part is one of "measurement", "field", a tag key, or an
+	// empty string to drop the part. Appending "*" to "measurement" or "field"
+	// consumes all remaining parts, e.g. "host.measurement.field*".
+	// Defaults to DefaultGraphiteTemplate.
+	Template string
+
+	// Separator joins multiple measurement or field parts,
+	// defaults to DefaultGraphiteSeparator.
+	Separator string
+
+	// Tags are added to every point unless the metric name sets the same key.
+	Tags map[string]string
+}
+
+// GraphiteParser converts Graphite plaintext protocol lines into Points.
+type GraphiteParser struct {
+	template  []string
+	separator string
+	tags      map[string]string
+}
+
+// NewGraphiteParser returns a GraphiteParser from the provided config.
+func NewGraphiteParser(conf GraphiteConfig) (*GraphiteParser, error) {
+	if conf.Template == "" {
+		conf.Template = DefaultGraphiteTemplate
+	}
+	if conf.Separator == "" {
+		conf.Separator = DefaultGraphiteSeparator
+	}
+
+	template := strings.Split(conf.Template, ".")
+	hasMeasurement := false
+	for i, part := range template {
+		if strings.HasSuffix(part, "*") && i != len(template)-1 {
+			return nil, fmt.Errorf("graphite: wildcard must be the last template part: %s", conf.Template)
+		}
+		if strings.TrimSuffix(part, "*") == "measurement" {
+			hasMeasurement = true
+		}
+	}
+	if !hasMeasurement {
+		return nil, fmt.Errorf("graphite: template must contain measurement: %s", conf.Template)
+	}
+
+	return &GraphiteParser{
+		template:  template,
+		separator: conf.Separator,
+		tags:      conf.Tags,
+	}, nil
+}
+
+// Parse converts a single "metric.path value [timestamp]" line into a Point.
+// The timestamp is in seconds; when missing or negative the point is sent
+// without a timestamp so the server assigns one.
+func (p *GraphiteParser) Parse(line string) (*Point, error) {
+	parts := strings.Fields(line)
+	if len(parts) != 2 && len(parts) != 3 {
+		return nil, fmt.Errorf("graphite: expected 2 or 3 fields, got %d: %q", len(parts), line)
+	}
+
+	measurement, field, tags := p.apply(parts[0])
+	if measurement == "" {
+		return nil, fmt.Errorf("graphite: no measurement in %q", parts[0])
+	}
+
+	value, err := strconv.ParseFloat(parts[1], 64)
+	if err != nil {
+		return nil, fmt.Errorf("graphite: invalid value %q: %w", parts[1], err)
+	}
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return nil, fmt.Errorf("graphite: unsupported value %q", parts[1])
+	}
+
+	var ts []time.Time
+	if len(parts) == 3 {
+		sec, err := strconv.ParseFloat(parts[2], 64)
+		if err != nil {
+			return nil, fmt.Errorf("graphite: invalid timestamp %q: %w", parts[2], err)
+		}
+		if sec >= 0 {
+			ts = append(ts, time.Unix(0, int64(sec*float64(time.Second))))
+		}
+	}
+
+	return NewPoint(measurement, tags, map[string]interface{}{field: value}, ts...)
+}
+
+// apply splits a metric name according to the template.
+func (p *GraphiteParser) apply(metric string) (string, string, map[string]string) {
+	var measurement, field []string
+	tags := make(map[string]string, len(p.tags))
+	for k, v := range p.tags {
+		tags[k] = v
+	}
+
+	names := strings.Split(metric, ".")
+	for i, name := range names {
+		if i >= len(p.template) {
+			break
+		}
+		part := p.template[i]
+		switch part {
+		case "":
+		case "measurement":
+			measurement = append(measurement, name)
+		case "field":
+			field = append(field, name)
+		case "measurement*":
+			measurement = append(measurement, names[i:]...)
+		case "field*":
+			field = append(field, names[i:]...)
+		default:
+			tags[part] = name
+		}
+		if strings.HasSuffix(part, "*") {
+			break
+		}
+	}
+
+	fieldName := DefaultIngestField
+	if len(field) > 0 {
+		fieldName = strings.Join(field, p.separator)
+	}
+	return strings.Join(measurement, p.separator), fieldName, tags
+}
+
+// ParseOpenTSDBLine converts an OpenTSDB telnet "put" line into a Point:
+//
+//	put <metric> <timestamp> <value> <tagk1=tagv1 ...>
+//
+// Timestamps with more than 10 digits are treated as milliseconds, otherwise
+// as seconds, following OpenTSDB.
+func ParseOpenTSDBLine(line string) (*Point, error) {
+	parts := strings.Fields(line)
+	if len(parts) < 4 || parts[0] != "put" {
+		return nil, fmt.Errorf("opentsdb: malformed put line: %q", line)
+	}
+
+	ts, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("opentsdb: invalid timestamp %q: %w", parts[2], err)
+	}
+	var t time.Time
+	if len(parts[2]) > 10 {
+		t = time.Unix(0, ts*int64(time.Millisecond))
+	} else {
+		t = time.Unix(ts, 0)
+	}
+
+	value, err := strconv.ParseFloat(parts[3], 64)
+	if err != nil {
+		return nil, fmt.Errorf("opentsdb: invalid value %q: %w", parts[3], err)
+	}
+
+	tags := make(map[string]string, len(parts)-4)
+	for _, kv := range parts[4:] {
+		idx := strings.Index(kv, "=")
+		if idx <= 0 || idx == len(kv)-1 {
+			return nil, fmt.Errorf("opentsdb: malformed tag %q", kv)
+		}
+		tags[kv[:idx]] = kv[idx+1:]
+	}
+
+	return NewPoint(parts[1], tags, map[string]interface{}{DefaultIngestField: value}, t)
+}
+
+// ParseLines reads r line by line and converts every non-empty line with parse.
+// Lines that fail to parse are collected in errs together with their line
+// number, so a collector can report them without dropping the whole input.
+func ParseLines(r io.Reader, parse func(string) (*Point, error)) (points []*Point, errs []error, err error) {
+	scanner := bufio.NewScanner(r)
+	n := 0
+	for scanner.Scan() {
+		n++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		pt, perr := parse(line)
+		if perr != nil {
+			errs = append(errs, fmt.Errorf("line %d: %w", n, perr))
+			continue
+		}
+		points = append(points, pt)
+	}
+	return points, errs, scanner.Err()
+}
@@ -0,0 +1,123 @@
+package client
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGraphiteParser_Parse(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   GraphiteConfig
+		line     string
+		expected string
+	}{
+		{
+			name:     "default template",
+			config:   GraphiteConfig{},
+			line:     "servers.host_0.cpu 0.64 1566086400",
+			expected: "servers.host_0.cpu value=0.64 1566086400000000000",
+		},
+		{
+			name:     "tags and field",
+			config:   GraphiteConfig{Template: "region.host.measurement.field"},
+			line:     "us-west.host_0.cpu.usage_user 12 1566086400",
+			expected: "cpu,host=host_0,region=us-west usage_user=12 1566086400000000000",
+		},
+		{
+			name:     "skipped part and wildcard measurement",
+			config:   GraphiteConfig{Template: ".host.measurement*", Separator: "_"},
+			line:     "servers.host_0.disk.io.read 3 1566086400",
+			expected: "disk_io_read,host=host_0 value=3 1566086400000000000",
+		},
+		{
+			name:     "default tags",
+			config:   GraphiteConfig{Template: "measurement.field*", Tags: map[string]string{"dc": "eu"}},
+			line:     "mem.used.bytes 1024 1566086400",
+			expected: "mem,dc=eu used.bytes=1024 1566086400000000000",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := NewGraphiteParser(tt.config)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			pt, err := p.Parse(tt.line)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if pt.String() != tt.expected {
+				t.Errorf("point:\t%s\nexpected:\t%s", pt.String(), tt.expected)
+			}
+		})
+	}
+}
+
+func TestGraphiteParser_Errors(t *testing.T) {
+	if _, err := NewGraphiteParser(GraphiteConfig{Template: "host.field"}); err == nil {
+		t.Error("expected error for template without measurement")
+	}
+	if _, err := NewGraphiteParser(GraphiteConfig{Template: "measurement*.host"}); err == nil {
+		t.Error("expected error for wildcard in the middle")
+	}
+
+	p, _ := NewGraphiteParser(GraphiteConfig{})
+	for _, line := range []string{"cpu", "cpu abc 1566086400", "cpu 1 abc", "cpu NaN 1566086400"} {
+		if _, err := p.Parse(line); err == nil {
+			t.Errorf("expected error for %q", line)
+		}
+	}
+}
+
+func TestParseOpenTSDBLine(t *testing.T) {
+	tests := []struct {
+		name     string
+		line     string
+		expected string
+	}{
+		{
+			name:     "seconds",
+			line:     "put sys.cpu.user 1566086400 42.5 host=host_0 cpu=0",
+			expected: "sys.cpu.user,cpu=0,host=host_0 value=42.5 1566086400000000000",
+		},
+		{
+			name:     "milliseconds",
+			line:     "put sys.cpu.user 1566086400500 1 host=host_0",
+			expected: "sys.cpu.user,host=host_0 value=1 1566086400500000000",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pt, err := ParseOpenTSDBLine(tt.line)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if pt.String() != tt.expected {
+				t.Errorf("point:\t%s\nexpected:\t%s", pt.String(), tt.expected)
+			}
+		})
+	}
+
+	for _, line := range []string{"get x 1 2", "put x 1", "put x abc 1", "put x 1 2 host"} {
+		if _, err := ParseOpenTSDBLine(line); err == nil {
+			t.Errorf("expected error for %q", line)
+		}
+	}
+}
+
+func TestParseLines(t *testing.T) {
+	input := "put cpu 1566086400 1 host=a\n\nput cpu bad 1\nput cpu 1566086460 2 host=b\n"
+	points, errs, err := ParseLines(strings.NewReader(input), ParseOpenTSDBLine)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(points) != 2 {
+		t.Errorf("points:\t%d\nexpected:\t%d", len(points), 2)
+	}
+	if len(errs) != 1 || !strings.HasPrefix(errs[0].Error(), "line 3:") {
+		t.Errorf("unexpected parse errors: %v", errs)
+	}
+}
@@ -0,0 +1,76 @@
+package client
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/InfluxDB-client/memcache"
+)
+
+// Health 是 HealthCheck 的结果，包括数据库和每个cache节点的状态，可以直接编码成 JSON 返回给编排系统
+type Health struct {
+	Healthy  bool          `json:"healthy"` // 数据库和所有cache节点都正常
+	InfluxDB DBHealth      `json:"influxdb"`
+	Cache    []CacheHealth `json:"cache"` // 按地址排序
+}
+
+// DBHealth 是数据库 Ping 的结果
+type DBHealth struct {
+	Healthy bool          `json:"healthy"`
+	Latency time.Duration `json:"latency"`
+	Version string        `json:"version,omitempty"`
+	Error   string        `json:"error,omitempty"`
+}
+
+// CacheHealth 是一个cache节点的探测结果
+type CacheHealth struct {
+	Addr    string `json:"addr"`
+	Healthy bool   `json:"healthy"`
+	Error   string `json:"error,omitempty"`
+}
+
+// HealthCheck 同时 Ping 数据库和所有cache节点，ctx 结束时还没有返回的探测记为失败
+func HealthCheck(ctx context.Context, c Client, mc *memcache.Client) Health {
+	dbDone := make(chan DBHealth, 1)
+	go func() {
+		latency, version, err := c.Ping(0)
+		h := DBHealth{Healthy: err == nil, Latency: latency, Version: version}
+		if err != nil {
+			h.Error = err.Error()
+		}
+		dbDone <- h
+	}()
+
+	cacheDone := make(chan []CacheHealth, 1)
+	go func() {
+		nodes := make([]CacheHealth, 0)
+		for addr, err := range mc.PingServers() {
+			node := CacheHealth{Addr: addr, Healthy: err == nil}
+			if err != nil {
+				node.Error = err.Error()
+			}
+			nodes = append(nodes, node)
+		}
+		sort.Slice(nodes, func(i, j int) bool { return nodes[i].Addr < nodes[j].Addr })
+		cacheDone <- nodes
+	}()
+
+	var health Health
+	select {
+	case health.InfluxDB = <-dbDone:
+	case <-ctx.Done():
+		health.InfluxDB = DBHealth{Error: ctx.Err().Error()}
+	}
+	select {
+	case health.Cache = <-cacheDone:
+	case <-ctx.Done():
+		health.Cache = []CacheHealth{{Error: ctx.Err().Error()}}
+	}
+
+	health.Healthy = health.InfluxDB.Healthy
+	for _, node := range health.Cache {
+		health.Healthy = health.Healthy && node.Healthy
+	}
+	return health
+}
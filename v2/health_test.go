@@ -0,0 +1,82 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/InfluxDB-client/memcache"
+)
+
+// newVersionServer 启动一个只响应 version 命令的cache节点
+func newVersionServer(t *testing.T) net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				for {
+					if _, err := r.ReadString('\n'); err != nil {
+						return
+					}
+					conn.Write([]byte("VERSION 1.0\r\n"))
+				}
+			}()
+		}
+	}()
+	return l
+}
+
+func TestHealthCheck(t *testing.T) {
+	db := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Influxdb-Version", "1.8.10")
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer db.Close()
+	c, _ := NewHTTPClient(HTTPConfig{Addr: db.URL})
+	defer c.Close()
+
+	alive := newVersionServer(t)
+	defer alive.Close()
+	dead := newVersionServer(t)
+	dead.Close()
+
+	tests := []struct {
+		name    string
+		servers []string
+		healthy bool
+	}{
+		{name: "all healthy", servers: []string{alive.Addr().String()}, healthy: true},
+		{name: "cache node down", servers: []string{alive.Addr().String(), dead.Addr().String()}, healthy: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+
+			health := HealthCheck(ctx, c, memcache.New(tt.servers...))
+			if health.Healthy != tt.healthy {
+				t.Errorf("healthy:\t%v\nexpected:\t%v\n%+v", health.Healthy, tt.healthy, health)
+			}
+			if !health.InfluxDB.Healthy || health.InfluxDB.Version != "1.8.10" {
+				t.Errorf("influxdb:\t%+v", health.InfluxDB)
+			}
+			if len(health.Cache) != len(tt.servers) {
+				t.Errorf("cache nodes:\t%d\nexpected:\t%d", len(health.Cache), len(tt.servers))
+			}
+		})
+	}
+}
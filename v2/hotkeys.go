@@ -0,0 +1,139 @@
+package client
+
+import (
+	"hash/fnv"
+	"sort"
+	"sync"
+)
+
+// HotKey 是一个语义段和它被访问次数的估计值
+type HotKey struct {
+	Key   string `json:"key"`
+	Count uint64 `json:"count"`
+}
+
+// HotKeySketch 用 count-min sketch 估计每个语义段的访问次数，占用的内存和语义段的数量无关
+// 同时保留估计值最大的 topN 个语义段，用来找出值得预聚合或者常驻cache的查询
+type HotKeySketch struct {
+	mu     sync.Mutex
+	width  uint64
+	counts [][]uint64 // depth 行，每行 width 个计数器
+	topN   int
+	top    map[string]uint64 // 当前估计值最大的语义段
+}
+
+// HotKeys 记录从cache读取的每个语义段的访问次数
+var HotKeys = NewHotKeySketch(2048, 4, 100)
+
+// NewHotKeySketch 创建 depth 行、每行 width 个计数器的 sketch，保留访问次数最多的 topN 个语义段
+// 估计值只会偏大，偏大的程度随 width 增大而减小，depth 越大偏大的概率越小
+func NewHotKeySketch(width, depth, topN int) *HotKeySketch {
+	if width <= 0 {
+		width = 1
+	}
+	if depth <= 0 {
+		depth = 1
+	}
+	counts := make([][]uint64, depth)
+	for i := range counts {
+		counts[i] = make([]uint64, width)
+	}
+	return &HotKeySketch{width: uint64(width), counts: counts, topN: topN, top: make(map[string]uint64)}
+}
+
+// Observe 记录一次对语义段 key 的访问
+func (hs *HotKeySketch) Observe(key string) {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+
+	estimate := ^uint64(0)
+	for i, idx := range hs.indexes(key) {
+		hs.counts[i][idx]++
+		if hs.counts[i][idx] < estimate {
+			estimate = hs.counts[i][idx]
+		}
+	}
+	hs.updateTop(key, estimate)
+}
+
+// Estimate 返回语义段 key 的访问次数的估计值
+func (hs *HotKeySketch) Estimate(key string) uint64 {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+
+	estimate := ^uint64(0)
+	for i, idx := range hs.indexes(key) {
+		if hs.counts[i][idx] < estimate {
+			estimate = hs.counts[i][idx]
+		}
+	}
+	return estimate
+}
+
+// Top 返回访问次数最多的 n 个语义段，按次数降序排列，n 不能超过创建时的 topN
+func (hs *HotKeySketch) Top(n int) []HotKey {
+	hs.mu.Lock()
+	keys := make([]HotKey, 0, len(hs.top))
+	for key, count := range hs.top {
+		keys = append(keys, HotKey{Key: key, Count: count})
+	}
+	hs.mu.Unlock()
+
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Count != keys[j].Count {
+			return keys[i].Count > keys[j].Count
+		}
+		return keys[i].Key < keys[j].Key
+	})
+	if n >= 0 && n < len(keys) {
+		keys = keys[:n]
+	}
+	return keys
+}
+
+// Reset 清空所有计数，比如定期调用让统计只反映最近的访问
+func (hs *HotKeySketch) Reset() {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+	for _, row := range hs.counts {
+		for i := range row {
+			row[i] = 0
+		}
+	}
+	hs.top = make(map[string]uint64)
+}
+
+// indexes 用两个哈希值组合出每一行的计数器位置
+func (hs *HotKeySketch) indexes(key string) []uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	sum := h.Sum64()
+	h1, h2 := sum&0xffffffff, sum>>32|1
+
+	indexes := make([]uint64, len(hs.counts))
+	for i := range indexes {
+		indexes[i] = (h1 + uint64(i)*h2) % hs.width
+	}
+	return indexes
+}
+
+// updateTop 更新 key 的估计值，topN 已满时替换掉估计值最小的语义段
+func (hs *HotKeySketch) updateTop(key string, estimate uint64) {
+	if hs.topN <= 0 {
+		return
+	}
+	if _, ok := hs.top[key]; ok || len(hs.top) < hs.topN {
+		hs.top[key] = estimate
+		return
+	}
+	minKey, minCount := "", ^uint64(0)
+	for k, count := range hs.top {
+		if count < minCount {
+			minKey, minCount = k, count
+		}
+	}
+	if estimate > minCount {
+		delete(hs.top, minKey)
+		hs.top[key] = estimate
+	}
+}
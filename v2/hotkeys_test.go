@@ -0,0 +1,32 @@
+package client
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestHotKeySketch(t *testing.T) {
+	hs := NewHotKeySketch(64, 4, 2)
+	/* a 访问 5 次，b 访问 3 次，c 访问 1 次，topN 为 2 时 c 不在结果中 */
+	for key, n := range map[string]int{"a": 5, "b": 3, "c": 1} {
+		for i := 0; i < n; i++ {
+			hs.Observe(key)
+		}
+	}
+
+	if estimate := hs.Estimate("a"); estimate < 5 {
+		t.Errorf("estimate:\t%d\nexpected:\t>= %d", estimate, 5)
+	}
+	expected := []HotKey{{Key: "a", Count: 5}, {Key: "b", Count: 3}}
+	if top := hs.Top(10); !reflect.DeepEqual(top, expected) {
+		t.Errorf("top:\t%v\nexpected:\t%v", top, expected)
+	}
+	if top := hs.Top(1); !reflect.DeepEqual(top, expected[:1]) {
+		t.Errorf("top:\t%v\nexpected:\t%v", top, expected[:1])
+	}
+
+	hs.Reset()
+	if top := hs.Top(10); len(top) != 0 {
+		t.Errorf("top after reset:\t%v", top)
+	}
+}
@@ -0,0 +1,90 @@
+package client
+
+import (
+	"math"
+
+	"github.com/InfluxDB-client/memcache"
+	"github.com/influxdata/influxql"
+)
+
+// intoTarget 是一条 SELECT INTO 语句写入的表和时间范围
+type intoTarget struct {
+	measurement func(name string) bool // 写入的表
+	start, end  int64
+}
+
+// selectIntoTargets 返回查询中每条 SELECT INTO 语句写入的表和时间范围，没有 SELECT INTO 时返回 nil。
+// INTO :MEASUREMENT 写入和来源同名的表，来源是正则表达式时匹配的表都可能被写入；
+// GROUP BY time() 的第一个分组从查询起始时间所在分组的开始写入，没有时间范围时整个时间轴都可能被写入
+func selectIntoTargets(queryString string) []intoTarget {
+	query, err := influxql.ParseQuery(queryString)
+	if err != nil {
+		return nil
+	}
+	var targets []intoTarget
+	for _, stmt := range query.Statements {
+		s, ok := stmt.(*influxql.SelectStatement)
+		if !ok || s.Target == nil || s.Target.Measurement == nil {
+			continue
+		}
+		target := intoTarget{start: math.MinInt64, end: math.MaxInt64}
+		if start, end, _ := GetQueryTimeRange(s.String()); start >= 0 {
+			target.start, target.end = start, end
+			if interval, err := s.GroupByInterval(); err == nil && interval > 0 {
+				offset, _ := s.GroupByOffset()
+				if r := (start - int64(offset)) % int64(interval); r > 0 {
+					target.start -= r
+				} else if r < 0 {
+					target.start -= r + int64(interval)
+				}
+			}
+		}
+
+		if name := s.Target.Measurement.Name; name != "" {
+			target.measurement = func(m string) bool { return m == name }
+			targets = append(targets, target)
+			continue
+		}
+		for _, source := range s.Sources {
+			m, ok := source.(*influxql.Measurement)
+			if !ok {
+				continue
+			}
+			t := target
+			if m.Regex != nil {
+				re := m.Regex.Val
+				t.measurement = re.MatchString
+			} else {
+				name := m.Name
+				t.measurement = func(m string) bool { return m == name }
+			}
+			targets = append(targets, t)
+		}
+	}
+	return targets
+}
+
+// InvalidateSelectInto 删除查询中 SELECT INTO 语句写入的表在cache中和写入的时间范围相交的语义段，返回删除的语义段。
+// SELECT INTO 在数据库内部写入数据，不经过 Write，写穿透和其他只观察 Write 的失效机制都看不到这些数据，
+// 执行 SELECT INTO 之后需要调用它；不是 SELECT INTO 的查询什么也不做
+func InvalidateSelectInto(queryString string, mc *memcache.Client) ([]string, error) {
+	targets := selectIntoTargets(queryString)
+	if len(targets) == 0 {
+		return nil, nil
+	}
+	return purge(Coverage, mc, func(entry CatalogEntry) bool {
+		for _, t := range targets {
+			for _, m := range entry.Measurements {
+				if !t.measurement(m) {
+					continue
+				}
+				for _, in := range entry.Intervals {
+					if in.Start <= t.end && in.End >= t.start {
+						return true
+					}
+				}
+			}
+		}
+		return false
+	})
+}
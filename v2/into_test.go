@@ -0,0 +1,127 @@
+package client
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/InfluxDB-client/diskcache"
+	"github.com/InfluxDB-client/memcache"
+)
+
+func TestSelectIntoTargets(t *testing.T) {
+	tests := []struct {
+		name       string
+		query      string
+		matches    []string
+		others     []string
+		start, end int64
+	}{
+		{
+			name:    "named target",
+			query:   "SELECT water_level INTO h2o_copy FROM h2o_feet WHERE time >= 100 AND time <= 200",
+			matches: []string{"h2o_copy"},
+			others:  []string{"h2o_feet"},
+			start:   100, end: 200,
+		},
+		{
+			name:    "group by time starts at the first bucket",
+			query:   "SELECT mean(water_level) INTO h2o_1m FROM h2o_feet WHERE time >= 90000000000 AND time <= 179999999999 GROUP BY time(1m)",
+			matches: []string{"h2o_1m"},
+			start:   60000000000, end: 179999999999,
+		},
+		{
+			name:    "source measurement",
+			query:   "SELECT * INTO other_db..:MEASUREMENT FROM h2o_feet, h2o_pH",
+			matches: []string{"h2o_feet", "h2o_pH"},
+			others:  []string{"h2o_temperature"},
+			start:   math.MinInt64, end: math.MaxInt64,
+		},
+		{
+			name:    "regex source",
+			query:   "SELECT * INTO other_db..:MEASUREMENT FROM /^h2o_/ WHERE time >= 100 AND time <= 200",
+			matches: []string{"h2o_feet", "h2o_pH"},
+			others:  []string{"cpu"},
+			start:   100, end: 200,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			targets := selectIntoTargets(tt.query)
+			if len(targets) == 0 {
+				t.Fatal("no targets")
+			}
+			match := func(m string) bool {
+				for _, target := range targets {
+					if target.measurement(m) {
+						return true
+					}
+				}
+				return false
+			}
+			for _, m := range tt.matches {
+				if !match(m) {
+					t.Errorf("%s should be a target", m)
+				}
+			}
+			for _, m := range tt.others {
+				if match(m) {
+					t.Errorf("%s should not be a target", m)
+				}
+			}
+			if targets[0].start != tt.start || targets[0].end != tt.end {
+				t.Errorf("range:\t[%d, %d]\nexpected:\t[%d, %d]", targets[0].start, targets[0].end, tt.start, tt.end)
+			}
+		})
+	}
+
+	if targets := selectIntoTargets("SELECT water_level FROM h2o_feet"); targets != nil {
+		t.Errorf("targets of a plain SELECT:\t%v", targets)
+	}
+}
+
+func TestWriteThroughClient_SelectInto(t *testing.T) {
+	s, err := diskcache.Listen(filepath.Join(t.TempDir(), "cache.db"), "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	cache := memcache.New(s.Addr())
+
+	coverage := Coverage
+	defer func() { Coverage = coverage }()
+	Coverage = NewCoverageIndex()
+	inRange := "{(h2o_copy.empty)}#{water_level[float64]}#{empty}#{empty,empty}"
+	outOfRange := "{(h2o_copy.location=santa_monica)}#{water_level[float64]}#{empty}#{empty,empty}"
+	source := "{(h2o_feet.empty)}#{water_level[float64]}#{empty}#{empty,empty}"
+	for segment, in := range map[string]Interval{inRange: {0, 150}, outOfRange: {300, 400}, source: {0, 150}} {
+		if err := cache.Set(&memcache.Item{Key: segment, Value: []byte("value"), Time_start: in.Start, Time_end: in.End}); err != nil {
+			t.Fatal(err)
+		}
+		Coverage.Add(segment, in)
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"results":[{"statement_id":0,"series":[{"name":"result","columns":["time","written"],"values":[[0,3]]}]}]}`))
+	}))
+	defer ts.Close()
+	db, _ := NewHTTPClient(HTTPConfig{Addr: ts.URL})
+	c, err := NewWriteThroughClient(WriteThroughConfig{Client: db, Cache: cache})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.Query(NewQuery("SELECT water_level INTO h2o_copy FROM h2o_feet WHERE time >= 100 AND time <= 200", MyDB, "ns")); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(Coverage.Segments(), []string{outOfRange, source}) {
+		t.Errorf("remaining:\t%v\nexpected:\t%v", Coverage.Segments(), []string{outOfRange, source})
+	}
+	if _, _, err := cache.Get(inRange, 0, 150); err != memcache.ErrCacheMiss {
+		t.Errorf("get invalidated segment:\t%v\nexpected:\t%v", err, memcache.ErrCacheMiss)
+	}
+}
@@ -0,0 +1,58 @@
+package client
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// KeyStrategy 决定语义段的结果存放在cache中的哪个 key。覆盖范围、借用其他语义段的结果和还原表结构都仍然使用语义段，
+// 只有读写cache时才转换成 key，换一种 key 不影响这些功能。同一个语义段必须总是得到同一个 key，不同语义段的 key 不能相同
+type KeyStrategy interface {
+	Key(segment string) string
+}
+
+// SemanticSegmentKey 直接用语义段作为 key，是默认的方式
+type SemanticSegmentKey struct{}
+
+// Key 返回语义段本身
+func (SemanticSegmentKey) Key(segment string) string {
+	return segment
+}
+
+// HashedKey 用语义段的 SHA-256 作为 key，长度固定为 64 个十六进制字符加上 Prefix，适合限制 key 长度的cache，
+// 比如 memcached 的 250 字节；cache中的 key 不再能看出查询的内容，PurgeKeyPrefix 等按语义段匹配的功能不受影响
+type HashedKey struct {
+	Prefix string
+}
+
+// Key 返回 Prefix 和语义段的 SHA-256
+func (h HashedKey) Key(segment string) string {
+	sum := sha256.Sum256([]byte(segment))
+	return h.Prefix + hex.EncodeToString(sum[:])
+}
+
+// PrefixedKey 在 Next 生成的 key 前面加上 Prefix，比如多个租户共用cache时用租户名区分；Next 为 nil 时使用语义段
+type PrefixedKey struct {
+	Prefix string
+	Next   KeyStrategy
+}
+
+// Key 返回 Prefix 和 Next 生成的 key
+func (p PrefixedKey) Key(segment string) string {
+	if p.Next == nil {
+		return p.Prefix + segment
+	}
+	return p.Prefix + p.Next.Key(segment)
+}
+
+// Keys 是读写cache时使用的 KeyStrategy，为 nil 时和 SemanticSegmentKey 相同。
+// 修改之后已经存入cache的结果不能再读取，需要同时清空覆盖范围索引
+var Keys KeyStrategy = SemanticSegmentKey{}
+
+// cacheKey 返回语义段在cache中的 key
+func cacheKey(segment string) string {
+	if Keys == nil {
+		return segment
+	}
+	return Keys.Key(segment)
+}
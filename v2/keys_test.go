@@ -0,0 +1,77 @@
+package client
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/InfluxDB-client/diskcache"
+	"github.com/InfluxDB-client/memcache"
+	"github.com/influxdata/influxdb1-client/models"
+)
+
+func TestKeyStrategy(t *testing.T) {
+	s, err := diskcache.Listen(filepath.Join(t.TempDir(), "cache.db"), "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	mc := memcache.New(s.Addr())
+	defer SetDefaultCache(SetDefaultCache(mc))
+	defer func(ci *CoverageIndex, keys KeyStrategy, limit int) { Coverage, Keys, MaxKeyLength = ci, keys, limit }(Coverage, Keys, MaxKeyLength)
+	Coverage = NewCoverageIndex()
+	Keys = PrefixedKey{Prefix: "tenant1/", Next: HashedKey{}}
+	MaxKeyLength = 100
+
+	query := "SELECT usage FROM cpu WHERE time >= 0 AND time <= 100"
+	resp := &Response{Results: []Result{{Series: []models.Row{{
+		Name:    "cpu",
+		Columns: []string{"time", "usage"},
+		Values:  [][]interface{}{{json.Number("10"), json.Number("1.5")}},
+	}}}}}
+	if err := setResponse(query, "ns", resp, mc); err != nil {
+		t.Fatal(err)
+	}
+	segment := SemanticSegment(query, resp)
+	key := cacheKey(segment)
+	if len(key) != len("tenant1/")+64 {
+		t.Errorf("key:\t%s", key)
+	}
+
+	/* 覆盖范围仍然按语义段记录，cache中只有转换之后的 key */
+	if covered, _ := Coverage.Covered(segment); !reflect.DeepEqual(covered, []Interval{{0, 100}}) {
+		t.Errorf("covered:\t%v\nexpected:\t%v", covered, []Interval{{0, 100}})
+	}
+	if _, _, err := mc.Get(segment, 0, 100); err != memcache.ErrCacheMiss {
+		t.Errorf("semantic segment:\t%v\nexpected:\t%v", err, memcache.ErrCacheMiss)
+	}
+	cached, err := getResponse(segment, 0, 0, 100, mc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(cached.Results[0].Series[0].Values, resp.Results[0].Series[0].Values) {
+		t.Errorf("values:\t%v\nexpected:\t%v", cached.Results[0].Series[0].Values, resp.Results[0].Series[0].Values)
+	}
+
+	/* 另一个租户读不到 */
+	Keys = PrefixedKey{Prefix: "tenant2/", Next: HashedKey{}}
+	if _, err := getResponse(segment, 0, 0, 100, mc); err != memcache.ErrCacheMiss {
+		t.Errorf("tenant2:\t%v\nexpected:\t%v", err, memcache.ErrCacheMiss)
+	}
+
+	/* 按语义段的前缀删除 */
+	Keys = PrefixedKey{Prefix: "tenant1/", Next: HashedKey{}}
+	if purged, err := PurgeKeyPrefix("{(cpu."); err != nil || !reflect.DeepEqual(purged, []string{segment}) {
+		t.Fatalf("purged:\t%v %v\nexpected:\t%v", purged, err, segment)
+	}
+	if _, _, err := mc.Get(key, 0, 100); err != memcache.ErrCacheMiss {
+		t.Errorf("after purge:\t%v\nexpected:\t%v", err, memcache.ErrCacheMiss)
+	}
+
+	/* 默认直接使用语义段 */
+	Keys = nil
+	if k := cacheKey(segment); k != segment || (SemanticSegmentKey{}).Key(segment) != segment {
+		t.Errorf("default key:\t%s\nexpected:\t%s", k, segment)
+	}
+}
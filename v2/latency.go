@@ -0,0 +1,160 @@
+package client
+
+import (
+	"math/bits"
+	"sync"
+	"time"
+)
+
+// cache 流程中统计耗时的阶段
+const (
+	StageCacheGet    = "cache_get"   // 从cache读取
+	StageDBQuery     = "db_query"    // 查询数据库
+	StageDeserialize = "deserialize" // 字节数组转换成结果
+	StageMerge       = "merge"       // 合并查询结果
+	StageSerialize   = "serialize"   // 结果转换成字节数组
+)
+
+// Latencies 是每个阶段的耗时分布
+var Latencies = map[string]*LatencyHistogram{
+	StageCacheGet:    NewLatencyHistogram(),
+	StageDBQuery:     NewLatencyHistogram(),
+	StageDeserialize: NewLatencyHistogram(),
+	StageMerge:       NewLatencyHistogram(),
+	StageSerialize:   NewLatencyHistogram(),
+}
+
+// 每个 2 的幂次区间分成 1<<subBucketBits 个桶，相对误差不超过 1/16
+const (
+	subBucketBits  = 4
+	subBucketCount = 1 << subBucketBits
+	bucketCount    = (64 - subBucketBits + 1) * subBucketCount
+)
+
+// LatencyHistogram 是和 HDR histogram 一样按对数划分、每段再线性划分的耗时直方图，
+// 占用固定的内存，记录和计算分位数的相对误差有界
+type LatencyHistogram struct {
+	mu       sync.Mutex
+	counts   [bucketCount]uint64
+	count    uint64
+	sum      time.Duration
+	min, max time.Duration
+}
+
+// LatencyStats 是直方图的汇总，可以直接编码成 JSON 输出
+type LatencyStats struct {
+	Count uint64        `json:"count"`
+	Min   time.Duration `json:"min"`
+	Max   time.Duration `json:"max"`
+	Mean  time.Duration `json:"mean"`
+	P50   time.Duration `json:"p50"`
+	P90   time.Duration `json:"p90"`
+	P99   time.Duration `json:"p99"`
+}
+
+// NewLatencyHistogram 创建空的耗时直方图
+func NewLatencyHistogram() *LatencyHistogram {
+	return &LatencyHistogram{}
+}
+
+// Record 记录一次耗时，负数记为 0
+func (h *LatencyHistogram) Record(d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.counts[bucketIndex(uint64(d))]++
+	if h.count == 0 || d < h.min {
+		h.min = d
+	}
+	if d > h.max {
+		h.max = d
+	}
+	h.count++
+	h.sum += d
+}
+
+// Quantile 返回分位数 q（0 到 1）的估计值，是对应的桶中的最大值，不超过记录过的最大值
+func (h *LatencyHistogram) Quantile(q float64) time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.quantile(q)
+}
+
+func (h *LatencyHistogram) quantile(q float64) time.Duration {
+	if h.count == 0 {
+		return 0
+	}
+	rank := uint64(q * float64(h.count))
+	if rank == 0 {
+		rank = 1
+	}
+	var seen uint64
+	for i, n := range h.counts {
+		seen += n
+		if seen >= rank {
+			if d := time.Duration(bucketUpper(i)); d < h.max {
+				return d
+			}
+			return h.max
+		}
+	}
+	return h.max
+}
+
+// Stats 返回直方图的汇总
+func (h *LatencyHistogram) Stats() LatencyStats {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	stats := LatencyStats{Count: h.count, Min: h.min, Max: h.max}
+	if h.count > 0 {
+		stats.Mean = h.sum / time.Duration(h.count)
+		stats.P50, stats.P90, stats.P99 = h.quantile(0.5), h.quantile(0.9), h.quantile(0.99)
+	}
+	return stats
+}
+
+// Reset 清空直方图
+func (h *LatencyHistogram) Reset() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.counts = [bucketCount]uint64{}
+	h.count, h.sum, h.min, h.max = 0, 0, 0, 0
+}
+
+// bucketIndex 返回 v 所在的桶：小于 subBucketCount 的值每个值一个桶，
+// 之后每个 [2^k, 2^(k+1)) 区间分成 subBucketCount 个等宽的桶
+func bucketIndex(v uint64) int {
+	if v < subBucketCount {
+		return int(v)
+	}
+	shift := bits.Len64(v) - subBucketBits - 1
+	return (shift+1)*subBucketCount + int(v>>uint(shift)) - subBucketCount
+}
+
+// bucketUpper 返回桶中的最大值
+func bucketUpper(i int) uint64 {
+	if i < subBucketCount {
+		return uint64(i)
+	}
+	shift := uint(i/subBucketCount - 1)
+	lower := uint64(i%subBucketCount+subBucketCount) << shift
+	return lower + (1 << shift) - 1
+}
+
+// observeLatency 记录阶段 stage 从 start 开始的耗时，用法是 defer observeLatency(stage, time.Now())
+func observeLatency(stage string, start time.Time) {
+	if h, ok := Latencies[stage]; ok {
+		h.Record(time.Since(start))
+	}
+}
+
+// latencyStats 返回所有阶段的耗时汇总
+func latencyStats() map[string]LatencyStats {
+	stats := make(map[string]LatencyStats, len(Latencies))
+	for stage, h := range Latencies {
+		stats[stage] = h.Stats()
+	}
+	return stats
+}
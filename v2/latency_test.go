@@ -0,0 +1,53 @@
+package client
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLatencyHistogram(t *testing.T) {
+	h := NewLatencyHistogram()
+	/* 1ms 到 100ms 各记录一次 */
+	for i := 1; i <= 100; i++ {
+		h.Record(time.Duration(i) * time.Millisecond)
+	}
+
+	stats := h.Stats()
+	if stats.Count != 100 || stats.Min != time.Millisecond || stats.Max != 100*time.Millisecond {
+		t.Errorf("stats:\t%+v", stats)
+	}
+	if stats.Mean != 50500*time.Microsecond {
+		t.Errorf("mean:\t%v\nexpected:\t%v", stats.Mean, 50500*time.Microsecond)
+	}
+
+	/* 分位数的相对误差不超过 1/16 */
+	tests := []struct {
+		q        float64
+		expected time.Duration
+	}{
+		{q: 0.5, expected: 50 * time.Millisecond},
+		{q: 0.9, expected: 90 * time.Millisecond},
+		{q: 0.99, expected: 99 * time.Millisecond},
+		{q: 1, expected: 100 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		got := h.Quantile(tt.q)
+		if got < tt.expected || got > tt.expected+tt.expected/16 {
+			t.Errorf("quantile %v:\t%v\nexpected:\t%v", tt.q, got, tt.expected)
+		}
+	}
+
+	h.Reset()
+	if stats := h.Stats(); stats.Count != 0 {
+		t.Errorf("stats after reset:\t%+v", stats)
+	}
+}
+
+func TestBucketIndex(t *testing.T) {
+	for _, v := range []uint64{0, 1, 15, 16, 17, 31, 32, 33, 1000, 123456789, 1<<63 + 12345} {
+		i := bucketIndex(v)
+		if upper := bucketUpper(i); v > upper || (i > 0 && v <= bucketUpper(i-1)) {
+			t.Errorf("value %d in bucket %d with upper bound %d", v, i, upper)
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/InfluxDB-client/memcache"
+)
+
+// MaterializedQuery 是一个物化查询：后台每隔 Refresh 查询一次最近 Window 时间的数据并存入cache，
+// 相当于在客户端执行的连续查询，读取时总是命中cache
+type MaterializedQuery struct {
+	Name    string        // 注册和读取时使用的名字
+	Query   string        // SELECT 语句，其中的时间条件被替换成 [now - Window, now]
+	Window  time.Duration // 滚动时间窗口的长度
+	Refresh time.Duration // 刷新间隔
+}
+
+// MaterializedStatus 是物化查询的状态
+type MaterializedStatus struct {
+	MaterializedQuery
+	Segment     string    // 最近一次刷新的结果的语义段
+	Start, End  int64     // 最近一次刷新的时间范围（纳秒）
+	LastRefresh time.Time // 最近一次成功刷新的时间
+	Refreshes   uint64    // 成功刷新的次数
+	LastError   error     // 最近一次刷新的错误，成功时为 nil
+}
+
+// MaterializedConfig 配置物化查询
+type MaterializedConfig struct {
+	Client  Client                       // 执行刷新查询的数据库连接
+	Cache   *memcache.Client             // 存入刷新结果的cache
+	OnError func(name string, err error) // 刷新失败时调用
+}
+
+// ErrMaterializedNotReady 表示物化查询还没有成功刷新过
+var ErrMaterializedNotReady = errors.New("materialized query not refreshed yet")
+
+// MaterializedRegistry 保存注册的物化查询，并在后台按各自的间隔刷新
+type MaterializedRegistry struct {
+	conf MaterializedConfig
+
+	mu      sync.Mutex
+	queries map[string]*materialized
+	stopped bool
+	wg      sync.WaitGroup
+}
+
+type materialized struct {
+	status MaterializedStatus
+	empty  bool // 最近一次刷新的结果为空，没有存入cache
+	done   chan struct{}
+
+	// cacheMu 在替换cache中的结果和更新时间范围时加写锁，读取时加读锁，
+	// 读取不会用旧的时间范围裁剪新的结果，也不会落在删除和存入之间
+	cacheMu sync.RWMutex
+}
+
+// NewMaterializedRegistry 创建物化查询的注册表
+func NewMaterializedRegistry(conf MaterializedConfig) (*MaterializedRegistry, error) {
+	if conf.Client == nil || conf.Cache == nil {
+		return nil, errors.New("materialized queries need both a client and a cache")
+	}
+	return &MaterializedRegistry{conf: conf, queries: make(map[string]*materialized)}, nil
+}
+
+// Register 注册物化查询并立即在后台刷新一次，之后每隔 Refresh 刷新；同名的查询被替换
+func (mr *MaterializedRegistry) Register(mq MaterializedQuery) error {
+	if mq.Name == "" {
+		return errors.New("materialized query needs a name")
+	}
+	if mq.Window <= 0 || mq.Refresh <= 0 {
+		return fmt.Errorf("materialized query %s: window and refresh interval must be positive", mq.Name)
+	}
+	if _, err := QueryWithTimeRange(mq.Query, 0, 0); err != nil {
+		return fmt.Errorf("materialized query %s: %w", mq.Name, err)
+	}
+
+	m := &materialized{status: MaterializedStatus{MaterializedQuery: mq}, done: make(chan struct{})}
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+	if mr.stopped {
+		return errors.New("materialized query registry is stopped")
+	}
+	if old, ok := mr.queries[mq.Name]; ok {
+		close(old.done)
+	}
+	mr.queries[mq.Name] = m
+	mr.wg.Add(1)
+	go mr.loop(m)
+	return nil
+}
+
+// Unregister 停止刷新物化查询，返回它是否存在；已经存入cache的结果保留
+func (mr *MaterializedRegistry) Unregister(name string) bool {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+	m, ok := mr.queries[name]
+	if ok {
+		close(m.done)
+		delete(mr.queries, name)
+	}
+	return ok
+}
+
+// loop 立即刷新一次，之后每隔 Refresh 刷新，直到查询被注销或替换
+func (mr *MaterializedRegistry) loop(m *materialized) {
+	defer mr.wg.Done()
+	mr.refresh(m)
+	ticker := time.NewTicker(m.status.Refresh)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.done:
+			return
+		case <-ticker.C:
+			mr.refresh(m)
+		}
+	}
+}
+
+// refresh 查询 [now - Window, now] 的数据，替换cache中这个语义段以前的结果：
+// 以前的窗口和新窗口重叠，留在cache中会让读取时拼接出旧的数据
+func (mr *MaterializedRegistry) refresh(m *materialized) {
+	end := time.Now().UnixNano()
+	start := end - int64(m.status.Window)
+	queryString, resp, err := mr.fetch(m.status.Query, start, end)
+	if err == nil {
+		err = mr.store(m, queryString, resp, start, end)
+	}
+	if err != nil {
+		mr.mu.Lock()
+		m.status.LastError = err
+		mr.mu.Unlock()
+		if mr.conf.OnError != nil {
+			mr.conf.OnError(m.status.Name, err)
+		}
+	}
+}
+
+// fetch 查询数据库中一个窗口的数据
+func (mr *MaterializedRegistry) fetch(query string, start, end int64) (string, *Response, error) {
+	queryString, err := QueryWithTimeRange(query, start, end)
+	if err != nil {
+		return "", nil, err
+	}
+	if err := waitDBLimiter(queryString); err != nil {
+		return "", nil, err
+	}
+	resp, err := mr.conf.Client.Query(NewQuery(queryString, MyDB, "ns"))
+	if err != nil {
+		return "", nil, err
+	}
+	if err := resp.Error(); err != nil {
+		return "", nil, err
+	}
+	return queryString, resp, nil
+}
+
+// store 用一个窗口的结果替换cache中以前的结果，并更新状态；结果为空时不存入cache
+func (mr *MaterializedRegistry) store(m *materialized, queryString string, resp *Response, start, end int64) error {
+	m.cacheMu.Lock()
+	defer m.cacheMu.Unlock()
+	segment, empty := "", ResponseIsEmpty(resp)
+	if !empty {
+		segment = SemanticSegment(queryString, resp)
+		if err := mr.conf.Cache.Delete(cacheKey(segment)); err != nil && err != memcache.ErrCacheMiss {
+			return err
+		}
+		Coverage.Remove(segment)
+		if err := setResponse(queryString, "ns", resp, mr.conf.Cache); err != nil {
+			return err
+		}
+	}
+
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+	m.status.Segment, m.status.Start, m.status.End = segment, start, end
+	m.status.LastRefresh = time.Now()
+	m.status.Refreshes++
+	m.status.LastError = nil
+	m.empty = empty
+	return nil
+}
+
+// Get 从cache读取物化查询最近一次刷新的结果；还没有刷新成功时返回 ErrMaterializedNotReady，
+// 结果被挤出cache时返回 memcache.ErrCacheMiss，下一次刷新后恢复
+func (mr *MaterializedRegistry) Get(name string) (*Response, error) {
+	mr.mu.Lock()
+	m, ok := mr.queries[name]
+	mr.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown materialized query %s", name)
+	}
+	m.cacheMu.RLock()
+	defer m.cacheMu.RUnlock()
+	mr.mu.Lock()
+	status, empty := m.status, m.empty
+	mr.mu.Unlock()
+	if status.Refreshes == 0 {
+		return nil, ErrMaterializedNotReady
+	}
+	if empty {
+		return &Response{Results: []Result{{}}}, nil
+	}
+	return getResponse(status.Segment, status.Start, status.Start, status.End, mr.conf.Cache)
+}
+
+// Queries 返回所有物化查询的状态，按名字排序
+func (mr *MaterializedRegistry) Queries() []MaterializedStatus {
+	mr.mu.Lock()
+	statuses := make([]MaterializedStatus, 0, len(mr.queries))
+	for _, m := range mr.queries {
+		statuses = append(statuses, m.status)
+	}
+	mr.mu.Unlock()
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+	return statuses
+}
+
+// Stop 停止所有物化查询的刷新，并等待正在执行的刷新完成
+func (mr *MaterializedRegistry) Stop() {
+	mr.mu.Lock()
+	if !mr.stopped {
+		mr.stopped = true
+		for name, m := range mr.queries {
+			close(m.done)
+			delete(mr.queries, name)
+		}
+	}
+	mr.mu.Unlock()
+	mr.wg.Wait()
+}
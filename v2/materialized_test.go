@@ -0,0 +1,88 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/InfluxDB-client/diskcache"
+	"github.com/InfluxDB-client/memcache"
+	"github.com/influxdata/influxdb1-client/models"
+)
+
+func TestMaterializedRegistry(t *testing.T) {
+	s, err := diskcache.Listen(filepath.Join(t.TempDir(), "cache.db"), "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	coverage := Coverage
+	defer func() { Coverage = coverage }()
+	Coverage = NewCoverageIndex()
+
+	/* 窗口的最后三秒每秒一条数据，值是第几次查询 */
+	var queries int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&queries, 1)
+		_, end, _ := GetQueryTimeRange(r.FormValue("q"))
+		values := make([][]interface{}, 0)
+		for i := int64(2); i >= 0; i-- {
+			values = append(values, []interface{}{end - i*1e9, n})
+		}
+		resp := Response{Results: []Result{{Series: []models.Row{{Name: "cpu", Columns: []string{"time", "usage"}, Values: values}}}}}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer ts.Close()
+	db, _ := NewHTTPClient(HTTPConfig{Addr: ts.URL})
+
+	mr, err := NewMaterializedRegistry(MaterializedConfig{Client: db, Cache: memcache.New(s.Addr())})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mr.Stop()
+
+	if err := mr.Register(MaterializedQuery{Name: "cpu", Query: "SELECT usage FROM cpu", Window: time.Hour}); err == nil {
+		t.Error("expected an error for a zero refresh interval")
+	}
+	if err := mr.Register(MaterializedQuery{Name: "cpu", Query: "SELECT usage FROM cpu", Window: time.Hour, Refresh: 20 * time.Millisecond}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mr.Get("unknown"); err == nil {
+		t.Error("expected an error for an unknown query")
+	}
+
+	/* 等待刷新几次，每次的结果替换以前的结果 */
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadInt32(&queries) < 3 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	resp, err := mr.Get("cpu")
+	if errors.Is(err, ErrMaterializedNotReady) {
+		t.Fatal("not refreshed")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := resp.Results[0].Series[0].Values
+	if len(values) != 3 {
+		t.Fatalf("rows:\t%d %v\nexpected:\t%d", len(values), values, 3)
+	}
+	if first, last := values[0][1], values[2][1]; first != last {
+		t.Errorf("rows of different refreshes:\t%v", values)
+	}
+
+	statuses := mr.Queries()
+	if len(statuses) != 1 || statuses[0].Refreshes < 2 || statuses[0].LastError != nil || statuses[0].End-statuses[0].Start != int64(time.Hour) {
+		t.Errorf("status:\t%+v", statuses)
+	}
+
+	if !mr.Unregister("cpu") || mr.Unregister("cpu") {
+		t.Error("unregister should succeed only once")
+	}
+}
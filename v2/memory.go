@@ -0,0 +1,59 @@
+package client
+
+import "sync/atomic"
+
+// 进程内的内存预算：限制语义段缓存 Segments 和 Response.Column 转换好的列一共大约占用的字节数。
+// 字节数是按字符串和切片的长度估计的，不包括 Go 运行时的其他开销，只用来控制量级
+
+var (
+	memoryBudget    atomic.Int64
+	memoryEvictions atomic.Uint64
+)
+
+// MemoryStats 是进程内各层大约占用的字节数
+type MemoryStats struct {
+	Budget       int64  `json:"budget"`        // 内存预算，0 表示不限制
+	SegmentBytes int64  `json:"segment_bytes"` // 语义段缓存 Segments 记录的模板
+	ColumnBytes  int64  `json:"column_bytes"`  // 所有结果中 Column 转换好的列，结果被回收之后减去
+	Total        int64  `json:"total"`
+	Evictions    uint64 `json:"evictions"` // 因为超出预算丢弃的模板和结果的列缓存数
+}
+
+// MemoryUsage 返回进程内各层大约占用的字节数
+func MemoryUsage() MemoryStats {
+	stats := MemoryStats{Budget: memoryBudget.Load(), ColumnBytes: columnMemory.bytes.Load(), Evictions: memoryEvictions.Load()}
+	if segments := Segments; segments != nil {
+		stats.SegmentBytes = segments.Stats().Bytes
+	}
+	stats.Total = stats.SegmentBytes + stats.ColumnBytes
+	return stats
+}
+
+// SetMemoryBudget 设置进程内各层一共可以占用的字节数，返回之前的预算，不大于 0 表示不限制。
+// 超出预算时每一层按各自占用的比例缩小，丢弃最久没有访问的内容，直到总量回到预算之内；
+// 丢弃的列在下次调用 Column 时重新转换。只有设置了预算之后访问过的结果的列可以丢弃，之前的在结果被回收时减去
+func SetMemoryBudget(bytes int64) int64 {
+	old := memoryBudget.Swap(max(bytes, 0))
+	if bytes <= 0 {
+		columnMemory.release()
+	}
+	enforceMemoryBudget()
+	return old
+}
+
+// enforceMemoryBudget 在总量超出预算时让每一层缩小到 占用 * 预算 / 总量
+func enforceMemoryBudget() {
+	budget := memoryBudget.Load()
+	if budget <= 0 {
+		return
+	}
+	usage := MemoryUsage()
+	if usage.Total <= budget {
+		return
+	}
+	ratio := float64(budget) / float64(usage.Total)
+	if segments := Segments; segments != nil {
+		memoryEvictions.Add(segments.shrink(int64(float64(usage.SegmentBytes) * ratio)))
+	}
+	memoryEvictions.Add(columnMemory.shrink(int64(float64(usage.ColumnBytes) * ratio)))
+}
@@ -0,0 +1,68 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/influxdata/influxdb1-client/models"
+)
+
+func TestMemoryBudget(t *testing.T) {
+	segments := Segments
+	defer func() { Segments = segments }()
+	defer SetMemoryBudget(SetMemoryBudget(1 << 40))
+	Segments = NewSegmentMemo(100)
+
+	/* 10 个模板的语义段 */
+	resp := &Response{Results: []Result{{Series: []models.Row{
+		{Name: "h2o_quality", Tags: map[string]string{"location": "coyote_creek"}, Columns: []string{"time", "index"},
+			Values: [][]interface{}{{json.Number("1566086400000000000"), json.Number("41")}}},
+	}}}}
+	for i := 0; i < 10; i++ {
+		SemanticSegment(fmt.Sprintf("SELECT index FROM h2o_quality WHERE location='coyote_creek' AND index>%d AND time >= '2019-08-18T00:00:00Z' AND time <= '2019-08-18T00:30:00Z' GROUP BY location", i), resp)
+	}
+	segmentBytes := Segments.Stats().Bytes
+	if usage := MemoryUsage(); usage.SegmentBytes != segmentBytes || segmentBytes < 10*segmentEntryOverhead {
+		t.Fatalf("segment bytes:\t%d\nexpected:\t%d", usage.SegmentBytes, segmentBytes)
+	}
+
+	/* 1000 行的 float64 列至少 8000 字节 */
+	values := make([][]interface{}, 1000)
+	for i := range values {
+		values[i] = []interface{}{json.Number(fmt.Sprint(i)), json.Number(fmt.Sprintf("%d.5", i))}
+	}
+	large := &Response{Results: []Result{{Series: []models.Row{{Name: "cpu", Columns: []string{"time", "usage"}, Values: values}}}}}
+	before := MemoryUsage().ColumnBytes
+	column, err := large.Column(0, "usage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	columnBytes := MemoryUsage().ColumnBytes - before
+	if columnBytes < 8000 {
+		t.Errorf("column bytes:\t%d\nexpected:\t>= %d", columnBytes, 8000)
+	}
+
+	/* 预算降到一半时两层都按比例缩小，丢弃的列重新转换 */
+	usage := MemoryUsage()
+	evictions := usage.Evictions
+	SetMemoryBudget(usage.Total / 2)
+	if bytes := Segments.Stats().Bytes; bytes > segmentBytes/2+1 || bytes == 0 {
+		t.Errorf("segment bytes:\t%d\nexpected:\t<= %d", bytes, segmentBytes/2)
+	}
+	if large.columns.bytes != 0 || MemoryUsage().Evictions <= evictions {
+		t.Errorf("column cache not evicted:\t%d bytes, %+v", large.columns.bytes, MemoryUsage())
+	}
+	if again, err := large.Column(0, "usage"); err != nil || !reflect.DeepEqual(again, column) {
+		t.Errorf("column after eviction:\t%v %v", again.Floats[:2], err)
+	}
+
+	/* 不限制时不再丢弃 */
+	SetMemoryBudget(0)
+	entries := Segments.Stats().Entries
+	SemanticSegment("SELECT index FROM h2o_quality WHERE location='coyote_creek' AND index>100 AND time >= '2019-08-18T00:00:00Z' AND time <= '2019-08-18T00:30:00Z' GROUP BY location", resp)
+	if stats := Segments.Stats(); stats.Entries != entries+1 {
+		t.Errorf("entries:\t%d\nexpected:\t%d", stats.Entries, entries+1)
+	}
+}
@@ -0,0 +1,85 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/InfluxDB-client/memcache"
+)
+
+// MetadataTTLs sets how long the results of the metadata queries issued by
+// GetFieldKeys, GetTagKV and LoadSchema stay in the cache. A zero TTL
+// queries the database every time.
+type MetadataTTLs struct {
+	FieldKeys time.Duration // SHOW FIELD KEYS
+	TagKeys   time.Duration // SHOW TAG KEYS
+	TagValues time.Duration // SHOW TAG VALUES
+}
+
+// MetadataTTL caches the metadata queries in the cache servers of mc, so
+// that client instances sharing the cache, or restarted, do not query the
+// meta store again until the TTL expires. It is disabled by default.
+var MetadataTTL = MetadataTTLs{}
+
+// metadataKey is the cache key of the result of a metadata query.
+func metadataKey(command string) string {
+	return "{meta}#{" + escapeSegment(command, " %#{}") + "}"
+}
+
+// executeMetadata executes a metadata query like execute, reading the
+// result from the cache while it is younger than ttl and storing it
+// otherwise. Cache errors fall back to the database.
+func executeMetadata(c Client, command, database string, ttl time.Duration) (*Response, error) {
+	mc := DefaultCache()
+	if ttl <= 0 || mc == nil {
+		return execute(c, command, database)
+	}
+	key := cacheKey(metadataKey(command))
+	if values, _, err := mc.Get(key, 0, 0); err == nil {
+		if resp, ok := decodeMetadata(values, time.Now()); ok {
+			return resp, nil
+		}
+	}
+
+	resp, err := execute(c, command, database)
+	if err != nil {
+		return nil, err
+	}
+	if value, err := encodeMetadata(resp, time.Now().Add(ttl)); err == nil {
+		_ = mc.Set(&memcache.Item{Key: key, Value: value, NumOfTables: int64(len(resp.Results))})
+	}
+	return resp, nil
+}
+
+// encodeMetadata stores the expiry time in nanoseconds before the JSON of
+// resp, since the cache servers do not expire items themselves.
+func encodeMetadata(resp *Response, expires time.Time) ([]byte, error) {
+	body, err := json.Marshal(resp)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(strconv.FormatInt(expires.UnixNano(), 10)+" "), body...), nil
+}
+
+// decodeMetadata returns the response stored by encodeMetadata, ok is false
+// when it has expired at now or cannot be read.
+func decodeMetadata(value []byte, now time.Time) (resp *Response, ok bool) {
+	value = bytes.TrimSuffix(value, []byte("\r\n"))
+	expires, body, found := bytes.Cut(value, []byte(" "))
+	if !found {
+		return nil, false
+	}
+	ns, err := strconv.ParseInt(string(expires), 10, 64)
+	if err != nil || now.UnixNano() >= ns {
+		return nil, false
+	}
+	resp = new(Response)
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	if err := dec.Decode(resp); err != nil {
+		return nil, false
+	}
+	return resp, true
+}
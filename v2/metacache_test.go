@@ -0,0 +1,127 @@
+package client
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/InfluxDB-client/memcache"
+)
+
+// newValueCache 返回一个只支持 get 和 set 的cache，数据是一行
+func newValueCache(t *testing.T) net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mu sync.Mutex
+	values := make(map[string]string)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					var key string
+					var st, et, n int64
+					switch {
+					case strings.HasPrefix(line, "set "):
+						fmt.Sscanf(line, "set %s %d %d %d\r\n", &key, &st, &et, &n)
+						value, _ := r.ReadString('\n')
+						mu.Lock()
+						values[key] = value
+						mu.Unlock()
+						conn.Write([]byte("STORED\r\n"))
+					case strings.HasPrefix(line, "get "):
+						fmt.Sscanf(line, "get %s %d %d\r\n", &key, &st, &et)
+						mu.Lock()
+						value := values[key]
+						mu.Unlock()
+						conn.Write([]byte(value + "END\r\n"))
+					default:
+						conn.Write([]byte("ERROR\r\n"))
+					}
+				}
+			}()
+		}
+	}()
+	return l
+}
+
+func TestExecuteMetadata(t *testing.T) {
+	var mu sync.Mutex
+	queries := make(map[string]int)
+	schema := newSchemaServer()
+	defer schema.Close()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		queries[r.URL.Query().Get("q")]++
+		mu.Unlock()
+		schema.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	l := newValueCache(t)
+	defer l.Close()
+	defer SetDefaultCache(SetDefaultCache(memcache.New(l.Addr().String())))
+	defer func(ttl MetadataTTLs) { MetadataTTL = ttl }(MetadataTTL)
+	MetadataTTL = MetadataTTLs{FieldKeys: time.Hour, TagKeys: time.Hour, TagValues: time.Hour}
+
+	/* 另一个客户端读取前一个客户端存入cache的结果，不查询数据库 */
+	for i := 0; i < 2; i++ {
+		c, _ := NewHTTPClient(HTTPConfig{Addr: ts.URL})
+		tagKV, err := loadTagKV(c, MyDB)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if values := tagKV.Measurement["h2o_feet"][0].Tag["location"].Values; !reflect.DeepEqual(values, []string{"coyote_creek", "santa_monica"}) {
+			t.Errorf("tag values:\t%v", values)
+		}
+		fieldKeys, err := ShowFieldKeys(c, MyDB)
+		if err != nil || len(fieldKeys["h2o_feet"]) != 2 {
+			t.Errorf("field keys:\t%v %v", fieldKeys, err)
+		}
+		c.Close()
+	}
+	expected := map[string]int{
+		"SHOW TAG KEYS ON NOAA_water_database":                                     1,
+		"SHOW TAG VALUES ON NOAA_water_database FROM h2o_feet WITH KEY = location": 1,
+		"SHOW FIELD KEYS ON NOAA_water_database":                                   1,
+	}
+	if !reflect.DeepEqual(queries, expected) {
+		t.Errorf("queries:\t%v\nexpected:\t%v", queries, expected)
+	}
+}
+
+func TestDecodeMetadata(t *testing.T) {
+	resp := &Response{Results: []Result{{}}}
+	now := time.Now()
+	value, err := encodeMetadata(resp, now.Add(time.Minute))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := decodeMetadata(append(value, "\r\n"...), now); !ok {
+		t.Errorf("cannot decode %q", value)
+	}
+	if _, ok := decodeMetadata(value, now.Add(time.Minute)); ok {
+		t.Error("expired metadata was decoded")
+	}
+	if _, ok := decodeMetadata([]byte("{\"results\":[]}"), now); ok {
+		t.Error("metadata without expiry was decoded")
+	}
+}
@@ -0,0 +1,143 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/influxdata/influxdb1-client/models"
+)
+
+// NullPolicy 决定结果中的空值（nil）转换成字节数组时如何处理
+type NullPolicy int
+
+const (
+	NullZero     NullPolicy = iota // 写入对应类型的零值：false、0、空字符串，取回后和真实的零值无法区分
+	NullError                      // 结果中有空值时不存入cache，Set 返回 ErrNullValue
+	NullSkipRow                    // 跳过有空值的行，只存入完整的行
+	NullSentinel                   // 写入 Nulls 中设置的哨兵值，取回时还原成 nil
+)
+
+// NullHandling 是空值的处理方式和各类型的哨兵值，哨兵值只在 NullSentinel 时使用；
+// bool 只有一个字节，哨兵值固定为 0xff
+type NullHandling struct {
+	Policy  NullPolicy
+	Int64   int64
+	Float64 float64 // NaN 时所有 NaN 都当作空值
+	String  string
+}
+
+// Nulls 是存入和读取cache时使用的空值处理方式，默认和原来一样写入零值
+var Nulls = NullHandling{Policy: NullZero, Int64: math.MinInt64, Float64: math.NaN(), String: "\x00null"}
+
+// ErrNullValue 表示 NullError 时结果中有空值，没有存入cache
+var ErrNullValue = errors.New("null value in response")
+
+// nullBool 是 bool 空值的哨兵字节，binary.Read 会把它读成 true，需要在转换之前判断
+const nullBool = 0xff
+
+// nullBytes 返回 datatype 类型的空值转换成的字节数组：NullSentinel 时是哨兵值，否则是零值
+func nullBytes(datatype string) []byte {
+	sentinel := Nulls.Policy == NullSentinel
+	switch datatype {
+	case "bool":
+		if sentinel {
+			return []byte{nullBool}
+		}
+		bBytes, _ := BoolToByteArray(false)
+		return bBytes
+	case "int64":
+		v := int64(0)
+		if sentinel {
+			v = Nulls.Int64
+		}
+		iBytes, _ := Int64ToByteArray(v)
+		return iBytes
+	case "float64":
+		v := float64(0)
+		if sentinel {
+			v = Nulls.Float64
+		}
+		fBytes, _ := Float64ToByteArray(v)
+		return fBytes
+	default: // string
+		if sentinel {
+			return StringToByteArray(Nulls.String)
+		}
+		return StringToByteArray(string(byte(0))) // 空字符串
+	}
+}
+
+// isNullInt64 判断读取的 int64 是否是空值的哨兵值，只在 NullSentinel 时判断
+func isNullInt64(v int64) bool {
+	return Nulls.Policy == NullSentinel && v == Nulls.Int64
+}
+
+func isNullFloat64(v float64) bool {
+	if Nulls.Policy != NullSentinel {
+		return false
+	}
+	if math.IsNaN(Nulls.Float64) {
+		return math.IsNaN(v)
+	}
+	return v == Nulls.Float64
+}
+
+// isNullString 判断读取的字符串是否是哨兵值，读取的字符串包含末尾补齐的0字节，所以和补齐后的哨兵值比较
+func isNullString(v string) bool {
+	return Nulls.Policy == NullSentinel && v == ByteArrayToString(StringToByteArray(Nulls.String))
+}
+
+// findNull 返回结果中第一个空值所在的表、行和列，没有空值时 ok 为 false
+func findNull(resp *Response) (series, row, col int, ok bool) {
+	if ResponseIsEmpty(resp) {
+		return 0, 0, 0, false
+	}
+	for i, s := range resp.Results[0].Series {
+		for j, v := range s.Values {
+			for k, vv := range v {
+				if vv == nil {
+					return i, j, k, true
+				}
+			}
+		}
+	}
+	return 0, 0, 0, false
+}
+
+// checkNulls 在 NullError 时检查结果中是否有空值，有空值时返回 ErrNullValue
+func checkNulls(resp *Response) error {
+	if Nulls.Policy != NullError {
+		return nil
+	}
+	i, j, k, ok := findNull(resp)
+	if !ok {
+		return nil
+	}
+	s := resp.Results[0].Series[i]
+	return fmt.Errorf("%w: %s row %d column %s", ErrNullValue, s.Name, j, s.Columns[k])
+}
+
+// withoutNullRows 返回去掉所有包含空值的行之后的结果，没有空值时返回原来的结果，不修改传入的结果
+func withoutNullRows(resp *Response) *Response {
+	if _, _, _, ok := findNull(resp); !ok {
+		return resp
+	}
+	result := Response{Results: append([]Result(nil), resp.Results...), Err: resp.Err, statusCode: resp.statusCode}
+	series := make([]models.Row, len(resp.Results[0].Series))
+	for i, s := range resp.Results[0].Series {
+		series[i] = s
+		series[i].Values = make([][]interface{}, 0, len(s.Values))
+	rows:
+		for _, v := range s.Values {
+			for _, vv := range v {
+				if vv == nil {
+					continue rows
+				}
+			}
+			series[i].Values = append(series[i].Values, v)
+		}
+	}
+	result.Results[0].Series = series
+	return &result
+}
@@ -0,0 +1,114 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/influxdata/influxdb1-client/models"
+)
+
+// nullResponse 第一行完整，第二行除了时间戳都是空值
+func nullResponse() *Response {
+	return &Response{Results: []Result{{Series: []models.Row{{
+		Name:    "h2o_feet",
+		Tags:    map[string]string{"location": "coyote_creek"},
+		Columns: []string{"time", "ok", "index", "water_level", "level description"},
+		Values: [][]interface{}{
+			{json.Number("1566086400000000000"), true, json.Number("7"), json.Number("8.5"), "below 9 feet"},
+			{json.Number("1566086760000000000"), nil, nil, nil, nil},
+		},
+	}}}}}
+}
+
+func TestNullPolicy(t *testing.T) {
+	nulls := Nulls
+	defer func() { Nulls = nulls }()
+
+	segment := "{(h2o_feet.location=coyote_creek)}#{ok[bool],index[int64],water_level[float64],level_description[string]}#{empty}#{empty,empty}"
+	roundTrip := func() [][]interface{} {
+		byteArray := nullResponse().ToByteArrayWithSegments([]string{segment})
+		converted := ByteArrayToResponse(append(byteArray, []byte("\r\n")...))
+		if ResponseIsEmpty(converted) {
+			return nil
+		}
+		return converted.Results[0].Series[0].Values
+	}
+	full := []interface{}{json.Number("1566086400000000000"), true, json.Number("7"), json.Number("8.5"), "below 9 feet"}
+
+	tests := []struct {
+		name     string
+		policy   NullPolicy
+		expected [][]interface{}
+	}{
+		{
+			name:     "sentinel",
+			policy:   NullSentinel,
+			expected: [][]interface{}{full, {json.Number("1566086760000000000"), nil, nil, nil, nil}},
+		},
+		{
+			name:     "skip row",
+			policy:   NullSkipRow,
+			expected: [][]interface{}{full},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			Nulls.Policy = tt.policy
+			values := roundTrip()
+			for _, v := range values {
+				if s, ok := v[4].(string); ok {
+					v[4] = strings.TrimRight(s, "\x00") // 去掉补齐的0字节
+				}
+			}
+			if !reflect.DeepEqual(values, tt.expected) {
+				t.Errorf("values:\t%v\nexpected:\t%v", values, tt.expected)
+			}
+		})
+	}
+
+	/* 默认写入零值，取回后无法区分 */
+	Nulls.Policy = NullZero
+	if values := roundTrip(); len(values) != 2 || values[1][2] != json.Number("0") || values[1][3] != json.Number("0") {
+		t.Errorf("values:\t%v\nexpected zero values", values)
+	}
+
+	/* 只有哨兵值会被当作空值 */
+	Nulls.Policy = NullSentinel
+	if isNullInt64(0) || isNullFloat64(0) || !isNullFloat64(Nulls.Float64) {
+		t.Errorf("sentinel detection is wrong")
+	}
+
+	Nulls.Policy = NullError
+	if err := checkNulls(nullResponse()); !errors.Is(err, ErrNullValue) {
+		t.Errorf("error:\t%v\nexpected:\t%v", err, ErrNullValue)
+	}
+	if err := setResponse("SELECT * FROM h2o_feet", "ns", nullResponse(), nil); !errors.Is(err, ErrNullValue) {
+		t.Errorf("error:\t%v\nexpected:\t%v", err, ErrNullValue)
+	}
+}
+
+func TestByteArrayToResponse_AdjacentBools(t *testing.T) {
+	/* 每个 bool 占一个字节，相邻的 bool 列不能错位 */
+	resp := &Response{Results: []Result{{Series: []models.Row{{
+		Name:    "m",
+		Columns: []string{"time", "b1", "b2", "b3", "index"},
+		Values: [][]interface{}{
+			{json.Number("1566086400000000000"), true, false, true, json.Number("7")},
+			{json.Number("1566086760000000000"), false, true, false, json.Number("8")},
+		},
+	}}}}}
+	segment := "{(m.empty)}#{b1[bool],b2[bool],b3[bool],index[int64]}#{empty}#{empty,empty}"
+
+	byteArray := resp.ToByteArrayWithSegments([]string{segment})
+	converted := ByteArrayToResponse(append(byteArray, []byte("\r\n")...))
+	if ResponseIsEmpty(converted) {
+		t.Fatalf("empty response")
+	}
+	values := converted.Results[0].Series[0].Values
+	if !reflect.DeepEqual(values, resp.Results[0].Series[0].Values) {
+		t.Errorf("values:\t%v\nexpected:\t%v", values, resp.Results[0].Series[0].Values)
+	}
+}
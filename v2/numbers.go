@@ -0,0 +1,59 @@
+package client
+
+import (
+	"math"
+	"strconv"
+)
+
+// NumberFormatPolicy 决定从cache读取的 float64 写成 json.Number 时的文本形式
+type NumberFormatPolicy int
+
+const (
+	// NumberFormatJSON 和 InfluxDB 用 encoding/json 返回的文本相同：绝对值在 [1e-6, 1e21) 内写成小数，否则写成指数，
+	// 如 1234567、0.000001、1e+21、1e-7，同一个值从cache和数据库读取时文本相同
+	NumberFormatJSON NumberFormatPolicy = iota
+	// NumberFormatShortest 是 strconv.FormatFloat(f, 'g', -1, 64)，指数不小于 21 或小于 -4 时写成指数，如 1.234567e+06
+	NumberFormatShortest
+)
+
+// NumberFormat 是从cache读取的 float64 的文本形式，默认和数据库返回的相同。
+// 两种形式都是能还原出同一个 float64 的最短的十进制数，数值和数据库返回的相同；int64 总是写成十进制整数
+var NumberFormat = NumberFormatJSON
+
+// appendFloat 把 f 按 NumberFormat 写成文本追加到 buf
+func appendFloat(buf []byte, f float64) []byte {
+	if NumberFormat == NumberFormatShortest || math.IsNaN(f) || math.IsInf(f, 0) {
+		return strconv.AppendFloat(buf, f, 'g', -1, 64)
+	}
+	return appendJSONFloat(buf, f)
+}
+
+// formatFloat 把 f 按 NumberFormat 写成文本
+func formatFloat(f float64) string {
+	return string(appendFloat(make([]byte, 0, 24), f))
+}
+
+// appendJSONFloat 和 encoding/json 编码 float64 的规则相同；NaN 和无穷在 JSON 中没有对应的写法，调用方不能传入
+func appendJSONFloat(buf []byte, f float64) []byte {
+	format := byte('f')
+	if abs := math.Abs(f); abs != 0 && (abs < 1e-6 || abs >= 1e21) {
+		format = 'e'
+	}
+	buf = strconv.AppendFloat(buf, f, format, -1, 64)
+	if format == 'e' { // e-07 写成 e-7
+		n := len(buf)
+		if n >= 4 && buf[n-4] == 'e' && buf[n-3] == '-' && buf[n-2] == '0' {
+			buf[n-2] = buf[n-1]
+			buf = buf[:n-1]
+		}
+	}
+	return buf
+}
+
+// jsonFloat 把客户端计算出的 float64（重新聚合、rollup 等）写成和数据库返回的相同的文本，不受 NumberFormat 影响
+func jsonFloat(f float64) string {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return strconv.FormatFloat(f, 'g', -1, 64)
+	}
+	return string(appendJSONFloat(make([]byte, 0, 24), f))
+}
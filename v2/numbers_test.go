@@ -0,0 +1,59 @@
+package client
+
+import (
+	"encoding/json"
+	"math"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/influxdata/influxdb1-client/models"
+)
+
+var fidelityFloats = []float64{0, 0.1, -2.5, 100, 1234567, 123456789.123, 1e20, 1e21, -1e21, 0.000001, 1e-7, 1.5e-300, 5e-324, math.MaxFloat64, math.Pi * 1e15}
+
+func TestAppendJSONFloat(t *testing.T) {
+	for _, f := range fidelityFloats {
+		expected, _ := json.Marshal(f)
+		if s := jsonFloat(f); s != string(expected) {
+			t.Errorf("%v:\t%s\nexpected:\t%s", f, s, expected)
+		}
+	}
+}
+
+func TestNumberFidelity(t *testing.T) {
+	defer func(format NumberFormatPolicy, arena bool) { NumberFormat, ArenaDecoding = format, arena }(NumberFormat, ArenaDecoding)
+
+	/* 数据库返回的结果：数值是 encoding/json 写出的文本 */
+	ints := []int64{0, -1, 42, math.MaxInt64, math.MinInt64 + 1, 1 << 53}
+	values := make([][]interface{}, 0, len(fidelityFloats))
+	for i, f := range fidelityFloats {
+		text, _ := json.Marshal(f)
+		values = append(values, []interface{}{json.Number(strconv.Itoa(1000 + i)), json.Number(text), json.Number(strconv.FormatInt(ints[i%len(ints)], 10))})
+	}
+	live := &Response{Results: []Result{{Series: []models.Row{{Name: "m", Columns: []string{"time", "f", "i"}, Values: values}}}}}
+	segments := []string{"{(m.empty)}#{f[float64],i[int64]}#{empty}#{empty,empty}"}
+	data := append(live.ToByteArrayWithPrecision(segments, "ns"), "\r\n"...)
+
+	/* 从cache读取的文本和数据库返回的相同，两种读取方式都一样 */
+	for _, arena := range []bool{false, true} {
+		ArenaDecoding = arena
+		cached := ByteArrayToResponse(data)
+		if !reflect.DeepEqual(cached.Results[0].Series[0].Values, values) {
+			t.Errorf("arena %v:\t%v\nexpected:\t%v", arena, cached.Results[0].Series[0].Values, values)
+		}
+	}
+
+	/* NumberFormatShortest 的文本可能不同，但数值相同 */
+	NumberFormat, ArenaDecoding = NumberFormatShortest, false
+	cached := ByteArrayToResponse(data)
+	for i, row := range cached.Results[0].Series[0].Values {
+		f, err := row[1].(json.Number).Float64()
+		if err != nil || f != fidelityFloats[i] {
+			t.Errorf("row %d:\t%v %v\nexpected:\t%v", i, row[1], err, fidelityFloats[i])
+		}
+	}
+	if text := cached.Results[0].Series[0].Values[4][1]; text != json.Number("1.234567e+06") {
+		t.Errorf("shortest:\t%v\nexpected:\t%v", text, "1.234567e+06")
+	}
+}
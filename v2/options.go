@@ -0,0 +1,123 @@
+package client
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Option configures the HTTPConfig built by NewHTTPClientWithOptions.
+type Option func(*HTTPConfig)
+
+// NewHTTPClientWithOptions returns a new Client for the server at addr,
+// configured by opts. It is equivalent to calling NewHTTPClient with an
+// HTTPConfig that has Addr set and every option applied in order.
+func NewHTTPClientWithOptions(addr string, opts ...Option) (Client, error) {
+	conf := HTTPConfig{Addr: addr}
+	for _, opt := range opts {
+		opt(&conf)
+	}
+	return NewHTTPClient(conf)
+}
+
+// WithConfig replaces the whole config, except Addr, with conf. Options
+// applied after it override its fields.
+func WithConfig(conf HTTPConfig) Option {
+	return func(c *HTTPConfig) {
+		addr := c.Addr
+		*c = conf
+		c.Addr = addr
+	}
+}
+
+// WithTimeout sets the timeout of every request.
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *HTTPConfig) {
+		c.Timeout = timeout
+	}
+}
+
+// WithProxy sets the Proxy function of the HTTP transport.
+func WithProxy(proxy func(req *http.Request) (*url.URL, error)) Option {
+	return func(c *HTTPConfig) {
+		c.Proxy = proxy
+	}
+}
+
+// WithTransport sets the RoundTripper used for all requests.
+func WithTransport(transport http.RoundTripper) Option {
+	return func(c *HTTPConfig) {
+		c.Transport = transport
+	}
+}
+
+// WithUserAgent sets the User-Agent header sent with every request.
+func WithUserAgent(userAgent string) Option {
+	return func(c *HTTPConfig) {
+		c.UserAgent = userAgent
+	}
+}
+
+// WithBasicAuth sets the InfluxDB 1.x username and password.
+func WithBasicAuth(username, password string) Option {
+	return func(c *HTTPConfig) {
+		c.Username = username
+		c.Password = password
+	}
+}
+
+// WithToken sets the InfluxDB 2.x API token.
+func WithToken(token string) Option {
+	return func(c *HTTPConfig) {
+		c.Token = token
+	}
+}
+
+// WithRetry retries requests that reached no server or got a 502, 503 or
+// 504 response up to maxRetries times, waiting interval before the first
+// retry and doubling it for every following one.
+func WithRetry(maxRetries int, interval time.Duration) Option {
+	return func(c *HTTPConfig) {
+		c.MaxRetries = maxRetries
+		c.RetryInterval = interval
+	}
+}
+
+// WithDialContext sets the function dialing the connections to the servers.
+func WithDialContext(dial func(ctx context.Context, network, addr string) (net.Conn, error)) Option {
+	return func(c *HTTPConfig) {
+		c.DialContext = dial
+	}
+}
+
+// WithIdleConns sets how many idle keep-alive connections are kept per
+// server and for how long.
+func WithIdleConns(maxPerHost int, timeout time.Duration) Option {
+	return func(c *HTTPConfig) {
+		c.MaxIdleConnsPerHost = maxPerHost
+		c.IdleConnTimeout = timeout
+	}
+}
+
+// WithKeepAlive sets the interval between TCP keep-alive probes.
+func WithKeepAlive(interval time.Duration) Option {
+	return func(c *HTTPConfig) {
+		c.KeepAlive = interval
+	}
+}
+
+// WithResponseHeaderTimeout limits how long to wait for the response headers.
+func WithResponseHeaderTimeout(timeout time.Duration) Option {
+	return func(c *HTTPConfig) {
+		c.ResponseHeaderTimeout = timeout
+	}
+}
+
+// WithoutHTTP2 keeps the client on HTTP/1.1.
+func WithoutHTTP2() Option {
+	return func(c *HTTPConfig) {
+		c.DisableHTTP2 = true
+	}
+}
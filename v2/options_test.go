@@ -0,0 +1,216 @@
+package client
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type countingTransport struct {
+	requests int32
+}
+
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	atomic.AddInt32(&t.requests, 1)
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestNewHTTPClientWithOptions(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ua := r.Header.Get("User-Agent"); ua != "bench" {
+			t.Errorf("user agent:\t%s\nexpected:\tbench", ua)
+		}
+		if auth := r.Header.Get("Authorization"); auth != "Token secret" {
+			t.Errorf("authorization:\t%s\nexpected:\tToken secret", auth)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(`{"results":[{"statement_id":0}]}`))
+	}))
+	defer ts.Close()
+
+	tr := &countingTransport{}
+	c, err := NewHTTPClientWithOptions(ts.URL,
+		WithUserAgent("bench"),
+		WithToken("secret"),
+		WithTimeout(time.Second),
+		WithTransport(tr),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer c.Close()
+
+	if _, err := c.Query(NewQuery("SELECT * FROM cpu", "db", "")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if tr.requests != 1 {
+		t.Errorf("transport requests:\t%d\nexpected:\t1", tr.requests)
+	}
+}
+
+func TestClient_Retry(t *testing.T) {
+	var hits int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if string(body) != "cpu value=1 0\n" {
+			t.Errorf("body:\t%q", body)
+		}
+		if atomic.AddInt32(&hits, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+
+	c, err := NewHTTPClientWithOptions(ts.URL, WithRetry(2, time.Millisecond))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer c.Close()
+
+	bp, _ := NewBatchPoints(BatchPointsConfig{Database: "db"})
+	pt, _ := NewPoint("cpu", nil, map[string]interface{}{"value": 1.0}, time.Unix(0, 0))
+	bp.AddPoint(pt)
+	if err := c.Write(bp); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if hits != 3 {
+		t.Errorf("hits:\t%d\nexpected:\t3", hits)
+	}
+}
+
+func TestClient_RetryExhausted(t *testing.T) {
+	var hits int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	c, _ := NewHTTPClientWithOptions(ts.URL, WithRetry(1, time.Millisecond))
+	defer c.Close()
+
+	if _, _, err := c.Ping(0); err == nil {
+		t.Error("expected error")
+	}
+	if hits != 2 {
+		t.Errorf("hits:\t%d\nexpected:\t2", hits)
+	}
+}
+
+func TestClient_DialContext(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+
+	var dials int32
+	dial := func(ctx context.Context, network, addr string) (net.Conn, error) {
+		atomic.AddInt32(&dials, 1)
+		return (&net.Dialer{}).DialContext(ctx, network, addr)
+	}
+	c, err := NewHTTPClientWithOptions(ts.URL, WithDialContext(dial), WithIdleConns(4, time.Minute))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer c.Close()
+
+	for i := 0; i < 3; i++ {
+		if _, _, err := c.Ping(0); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if dials != 1 {
+		t.Errorf("dials:\t%d\nexpected:\t1", dials)
+	}
+}
+
+func TestClient_HTTP2(t *testing.T) {
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Influxdb-Version", r.Proto)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	ts.EnableHTTP2 = true
+	ts.StartTLS()
+	defer ts.Close()
+
+	tests := []struct {
+		name     string
+		opts     []Option
+		expected string
+	}{
+		{name: "negotiated", expected: "HTTP/2.0"},
+		{name: "disabled", opts: []Option{WithoutHTTP2()}, expected: "HTTP/1.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := append([]Option{WithConfig(HTTPConfig{InsecureSkipVerify: true})}, tt.opts...)
+			c, err := NewHTTPClientWithOptions(ts.URL, opts...)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			defer c.Close()
+
+			_, proto, err := c.Ping(0)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if proto != tt.expected {
+				t.Errorf("protocol:\t%s\nexpected:\t%s", proto, tt.expected)
+			}
+		})
+	}
+}
+
+func TestClient_ResponseHeaderTimeout(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+
+	c, _ := NewHTTPClientWithOptions(ts.URL, WithResponseHeaderTimeout(20*time.Millisecond), WithKeepAlive(time.Second))
+	defer c.Close()
+
+	if _, _, err := c.Ping(0); err == nil {
+		t.Error("expected timeout error")
+	}
+}
+
+func TestClient_UnixSocket(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "influxdb.sock")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Skipf("unix sockets not supported: %v", err)
+	}
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Influxdb-Version", "1.8")
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	ts.Listener = l
+	ts.Start()
+	defer ts.Close()
+
+	c, err := NewHTTPClient(HTTPConfig{Addr: "unix://" + socket})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer c.Close()
+
+	_, version, err := c.Ping(0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if version != "1.8" {
+		t.Errorf("version:\t%s\nexpected:\t1.8", version)
+	}
+}
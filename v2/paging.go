@@ -0,0 +1,119 @@
+package client
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/influxdata/influxql"
+)
+
+// Pager walks through a result one page at a time. Like LIMIT and OFFSET
+// in InfluxQL, a page holds up to pageSize rows of every series.
+type Pager struct {
+	next func(page int) (*Response, bool, error)
+	page int
+	done bool
+}
+
+// NextPage returns the next page, or io.EOF once every row was returned.
+func (p *Pager) NextPage() (*Response, error) {
+	if p.done {
+		return nil, io.EOF
+	}
+	resp, last, err := p.next(p.page)
+	if err != nil {
+		return nil, err
+	}
+	p.page++
+	p.done = last
+	if ResponseIsEmpty(resp) {
+		p.done = true
+		return nil, io.EOF
+	}
+	return resp, nil
+}
+
+// QueryPaged returns a Pager that runs q once per page, rewritten with the
+// page's LIMIT and OFFSET, so only one page is held in memory at a time.
+// An existing LIMIT or OFFSET in q restricts the rows that are paged through.
+func QueryPaged(c Client, q Query, pageSize int) (*Pager, error) {
+	if pageSize <= 0 {
+		return nil, fmt.Errorf("invalid page size %d", pageSize)
+	}
+	stmt, err := influxql.ParseStatement(q.Command)
+	if err != nil {
+		return nil, err
+	}
+	s, ok := stmt.(*influxql.SelectStatement)
+	if !ok {
+		return nil, fmt.Errorf("%w: QueryPaged needs a SELECT statement", ErrUnsupportedQuery)
+	}
+	limit, offset := s.Limit, s.Offset
+
+	return &Pager{next: func(page int) (*Response, bool, error) {
+		size := pageSize
+		if limit > 0 && (page+1)*pageSize >= limit {
+			size = limit - page*pageSize
+		}
+		if size <= 0 {
+			return nil, true, nil
+		}
+
+		paged := s.Clone()
+		paged.Limit = size
+		paged.Offset = offset + page*pageSize
+		pq := q
+		pq.Command = paged.String()
+		resp, err := c.Query(pq)
+		if err != nil {
+			return nil, false, err
+		}
+		if err := resp.Error(); err != nil {
+			return nil, false, err
+		}
+		return resp, size < pageSize || !fullPage(resp, size), nil
+	}}, nil
+}
+
+// PageResponse returns a Pager over a result already in memory, such as one
+// read from the cache, with the same paging as QueryPaged.
+func PageResponse(resp *Response, pageSize int) (*Pager, error) {
+	if pageSize <= 0 {
+		return nil, fmt.Errorf("invalid page size %d", pageSize)
+	}
+	return &Pager{next: func(page int) (*Response, bool, error) {
+		if ResponseIsEmpty(resp) {
+			return nil, true, nil
+		}
+		start := page * pageSize
+		result := Result{StatementId: resp.Results[0].StatementId}
+		last := true
+		for _, s := range resp.Results[0].Series {
+			if start >= len(s.Values) {
+				continue
+			}
+			end := start + pageSize
+			if end < len(s.Values) {
+				last = false
+			} else {
+				end = len(s.Values)
+			}
+			s.Values = s.Values[start:end]
+			result.Series = append(result.Series, s)
+		}
+		return &Response{Results: []Result{result}}, last, nil
+	}}, nil
+}
+
+// fullPage reports whether any series of resp has size rows, meaning more
+// rows may follow.
+func fullPage(resp *Response, size int) bool {
+	for _, r := range resp.Results {
+		for _, s := range r.Series {
+			if len(s.Values) >= size {
+				return true
+			}
+		}
+	}
+	return false
+}
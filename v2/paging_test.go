@@ -0,0 +1,96 @@
+package client
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/influxdata/influxql"
+)
+
+// pageSizes 取出 pager 的所有页，返回每页第一张表的行数
+func pageSizes(t *testing.T, p *Pager) []int {
+	sizes := make([]int, 0)
+	for {
+		resp, err := p.NextPage()
+		if err == io.EOF {
+			return sizes
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		sizes = append(sizes, len(resp.Results[0].Series[0].Values))
+	}
+}
+
+func TestQueryPaged(t *testing.T) {
+	var commands []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		command := r.URL.Query().Get("q")
+		commands = append(commands, command)
+		stmt, _ := influxql.ParseStatement(command)
+		s := stmt.(*influxql.SelectStatement)
+
+		/* 按 LIMIT 和 OFFSET 返回 rawWaterLevel 的一部分 */
+		resp := rawWaterLevel()
+		values := resp.Results[0].Series[0].Values
+		start, end := s.Offset, s.Offset+s.Limit
+		if start > len(values) {
+			start = len(values)
+		}
+		if end > len(values) {
+			end = len(values)
+		}
+		resp.Results[0].Series[0].Values = values[start:end]
+		if start == end {
+			resp.Results[0].Series = nil
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_ = json.NewEncoder(w).Encode(resp)
+	}))
+	defer ts.Close()
+	c, _ := NewHTTPClient(HTTPConfig{Addr: ts.URL})
+	defer c.Close()
+
+	tests := []struct {
+		name        string
+		queryString string
+		pageSize    int
+		sizes       []int
+		queries     int
+	}{
+		{name: "last page partly filled", queryString: "SELECT water_level FROM h2o_feet", pageSize: 2, sizes: []int{2, 2, 1}, queries: 3},
+		{name: "last page full", queryString: "SELECT water_level FROM h2o_feet", pageSize: 5, sizes: []int{5}, queries: 2},
+		{name: "query with LIMIT and OFFSET", queryString: "SELECT water_level FROM h2o_feet LIMIT 3 OFFSET 1", pageSize: 2, sizes: []int{2, 1}, queries: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			commands = nil
+			p, err := QueryPaged(c, NewQuery(tt.queryString, MyDB, ""), tt.pageSize)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if sizes := pageSizes(t, p); !reflect.DeepEqual(sizes, tt.sizes) {
+				t.Errorf("pages:\t%v\nexpected:\t%v", sizes, tt.sizes)
+			}
+			if len(commands) != tt.queries {
+				t.Errorf("queries:\t%q", commands)
+			}
+		})
+	}
+}
+
+func TestPageResponse(t *testing.T) {
+	p, err := PageResponse(rawWaterLevel(), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sizes := pageSizes(t, p); !reflect.DeepEqual(sizes, []int{2, 2, 1}) {
+		t.Errorf("pages:\t%v\nexpected:\t%v", sizes, []int{2, 2, 1})
+	}
+}
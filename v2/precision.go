@@ -0,0 +1,112 @@
+package client
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/InfluxDB-client/memcache"
+	"github.com/influxdata/influxdb1-client/models"
+)
+
+// PrecisionRFC3339 表示结果中的时间戳是 RFC3339 字符串，查询时没有设置 epoch 参数
+const PrecisionRFC3339 = "rfc3339"
+
+// precisionUnit 返回 epoch 精度对应的时间单位，支持 InfluxDB 的 h, m, s, ms, u, us, n, ns
+func precisionUnit(precision string) (time.Duration, bool) {
+	switch precision {
+	case "", PrecisionRFC3339:
+		return 0, false
+	case "n":
+		return time.Nanosecond, true
+	case "u":
+		return time.Microsecond, true
+	}
+	d, err := time.ParseDuration("1" + precision)
+	if err != nil || d <= 0 {
+		return 0, false
+	}
+	return d, true
+}
+
+// timestampToNano 把 precision 精度的时间戳转换成纳秒，RFC3339 字符串不受 precision 影响
+func timestampToNano(v interface{}, precision string) (int64, bool) {
+	ts, ok := timestampOf(v)
+	if !ok {
+		return 0, false
+	}
+	if _, isNumber := v.(json.Number); isNumber {
+		if unit, ok := precisionUnit(precision); ok {
+			return ts * int64(unit), true
+		}
+	}
+	return ts, true
+}
+
+// nanoToTimestamp 把纳秒时间戳转换成 precision 精度的表示：PrecisionRFC3339 为字符串，其他为 json.Number
+func nanoToTimestamp(ts int64, precision string) interface{} {
+	unit, ok := precisionUnit(precision)
+	if !ok {
+		return time.Unix(0, ts).UTC().Format(time.RFC3339Nano)
+	}
+	return json.Number(strconv.FormatInt(ts/int64(unit), 10))
+}
+
+// responsePrecision 推断结果中时间戳的精度：字符串为 PrecisionRFC3339，数字使用查询时的 precision，没有设置时为 ns
+func responsePrecision(resp *Response, precision string) string {
+	if ResponseIsEmpty(resp) {
+		return "ns"
+	}
+	if _, ok := resp.Results[0].Series[0].Values[0][0].(string); ok {
+		return PrecisionRFC3339
+	}
+	if _, ok := precisionUnit(precision); ok {
+		return precision
+	}
+	return "ns"
+}
+
+// segmentPrecision 从cache中每张表的语义段读取存入时记录的时间戳精度，旧格式没有记录时为 ns
+func segmentPrecision(segment string) string {
+	parts := strings.Split(segment, "#")
+	if len(parts) < 5 {
+		return "ns"
+	}
+	return strings.Trim(parts[4], "{}")
+}
+
+// responseWithPrecision 返回把时间列从 from 精度转换成 to 精度的结果，不修改传入的结果
+func responseWithPrecision(resp *Response, from, to string) *Response {
+	if ResponseIsEmpty(resp) || from == to {
+		return resp
+	}
+	result := &Response{Err: resp.Err, Results: make([]Result, len(resp.Results))}
+	for i, r := range resp.Results {
+		series := make([]models.Row, len(r.Series))
+		for j, s := range r.Series {
+			values := make([][]interface{}, len(s.Values))
+			for k, row := range s.Values {
+				values[k] = append([]interface{}(nil), row...)
+				if ts, ok := timestampToNano(row[0], from); ok {
+					values[k][0] = nanoToTimestamp(ts, to)
+				}
+			}
+			s.Values = values
+			series[j] = s
+		}
+		r.Series = series
+		result.Results[i] = r
+	}
+	return result
+}
+
+// GetWithPrecision 从cache读取语义段在 [startTime, endTime]（纳秒）内的结果，时间戳转换成 precision 精度：
+// 和 NewQuery 的参数相同，PrecisionRFC3339 或空字符串时为 RFC3339 字符串。未命中时返回 memcache.ErrCacheMiss
+func GetWithPrecision(segment string, startTime, endTime int64, precision string, mc *memcache.Client) (*Response, error) {
+	resp, err := getResponse(segment, startTime, startTime, endTime, mc)
+	if err != nil {
+		return nil, err
+	}
+	return responseWithPrecision(resp, "ns", precision), nil
+}
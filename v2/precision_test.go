@@ -0,0 +1,109 @@
+package client
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestByteArrayToResponseWithPrecision(t *testing.T) {
+	segments := []string{"{(h2o_feet.location=coyote_creek)}#{index[int64],water_level[float64]}#{empty}#{empty,empty}"}
+	rfc3339 := rawWaterLevel()
+	seconds := rawWaterLevel()
+	for _, v := range seconds.Results[0].Series[0].Values {
+		ts, _ := timestampOf(v[0])
+		v[0] = nanoToTimestamp(ts, "s")
+	}
+
+	tests := []struct {
+		name     string
+		resp     *Response
+		setPrec  string
+		getPrec  string
+		expected interface{}
+		recorded string
+	}{
+		{
+			name:     "rfc3339 restored",
+			resp:     rfc3339,
+			expected: "2019-08-18T00:00:00Z",
+			recorded: PrecisionRFC3339,
+		},
+		{
+			name:     "rfc3339 as seconds",
+			resp:     rfc3339,
+			getPrec:  "s",
+			expected: json.Number("1566086400"),
+			recorded: PrecisionRFC3339,
+		},
+		{
+			name:     "seconds restored",
+			resp:     seconds,
+			setPrec:  "s",
+			expected: json.Number("1566086400"),
+			recorded: "s",
+		},
+		{
+			name:     "seconds as nanoseconds",
+			resp:     seconds,
+			setPrec:  "s",
+			getPrec:  "ns",
+			expected: json.Number("1566086400000000000"),
+			recorded: "s",
+		},
+		{
+			name:     "seconds as rfc3339",
+			resp:     seconds,
+			setPrec:  "s",
+			getPrec:  PrecisionRFC3339,
+			expected: "2019-08-18T00:00:00Z",
+			recorded: "s",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			byteArray := append(tt.resp.ToByteArrayWithPrecision(segments, tt.setPrec), []byte("\r\n")...)
+			converted := ByteArrayToResponseWithPrecision(byteArray, tt.getPrec)
+			if ts := converted.Results[0].Series[0].Values[0][0]; ts != tt.expected {
+				t.Errorf("timestamp:\t%v\nexpected:\t%v", ts, tt.expected)
+			}
+
+			/* 字节数组中的时间戳都是纳秒 */
+			ts, _ := ByteArrayToInt64(byteArray[len(segments[0])+len("#{"+tt.recorded+"}")+9:][:8])
+			if ts != 1566086400000000000 {
+				t.Errorf("stored timestamp:\t%d", ts)
+			}
+		})
+	}
+}
+
+func TestByteArrayToResponse_WithoutPrecision(t *testing.T) {
+	resp := rawWaterLevel()
+	segment := "{(h2o_feet.location=coyote_creek)}#{index[int64],water_level[float64]}#{empty}#{empty,empty}"
+
+	/* 没有记录精度的旧格式按纳秒还原 */
+	byteArray := resp.ToByteArrayWithSegments([]string{segment})
+	byteArray = append(byteArray[:len(segment)], byteArray[len(segment)+len("#{"+PrecisionRFC3339+"}"):]...)
+	converted := ByteArrayToResponse(append(byteArray, []byte("\r\n")...))
+	if ts := converted.Results[0].Series[0].Values[0][0]; ts != json.Number("1566086400000000000") {
+		t.Errorf("timestamp:\t%v\nexpected:\t%v", ts, "1566086400000000000")
+	}
+}
+
+func TestByteArrayToResponse_RestoresRFC3339(t *testing.T) {
+	segment := "{(h2o_feet.location=coyote_creek)}#{index[int64],water_level[float64]}#{empty}#{empty,empty}"
+	resp := rawWaterLevel()
+	resp.Results[0].Series[0].Values = resp.Results[0].Series[0].Values[:3]
+	resp.Results[0].Series[0].Values[1][0] = "2019-08-18T00:06:00.123456789Z"
+	resp.Results[0].Series[0].Values[2][0] = "2019-08-18T00:12:00.5Z"
+
+	/* 没有设置 epoch 的查询结果从cache取回后仍然是 RFC3339 字符串，和数据库返回的结果结构相同 */
+	byteArray := resp.ToByteArrayWithSegments([]string{segment})
+	converted := ByteArrayToResponse(append(byteArray, []byte("\r\n")...))
+	for i, v := range converted.Results[0].Series[0].Values {
+		expected := resp.Results[0].Series[0].Values[i][0]
+		if v[0] != expected {
+			t.Errorf("timestamp:\t%#v\nexpected:\t%#v", v[0], expected)
+		}
+	}
+}
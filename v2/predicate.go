@@ -0,0 +1,372 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/influxdata/influxql"
+)
+
+// Predicate 是 WHERE 子句中除时间范围之外的一个谓词，如 location = 'coyote_creek'、water_level > 8
+// 部分命中时可以用它在客户端对cache中的数据重新过滤，或者重新生成剩余部分的查询，不需要处理 SP 字符串
+type Predicate struct {
+	Key   string      // 列名，不包含双引号和类型选择符
+	Op    string      // 比较运算符：=、!=、<、<=、>、>=、=~、!~
+	Value interface{} // 常量：string、int64、float64、bool，=~ 和 !~ 时是 *regexp.Regexp
+	Type  string      // 数据类型，和 SP 中的相同：string、int64、float64、bool
+	IsTag bool        // tag 的谓词在 SM 中，其他的在 SP 中
+}
+
+// predicateOperators 是谓词中可以使用的比较运算符
+var predicateOperators = map[string]influxql.Token{
+	influxql.EQ.String():       influxql.EQ,
+	influxql.NEQ.String():      influxql.NEQ,
+	influxql.LT.String():       influxql.LT,
+	influxql.LTE.String():      influxql.LTE,
+	influxql.GT.String():       influxql.GT,
+	influxql.GTE.String():      influxql.GTE,
+	influxql.EQREGEX.String():  influxql.EQREGEX,
+	influxql.NEQREGEX.String(): influxql.NEQREGEX,
+}
+
+// GetPredicates 返回查询中除时间范围之外的谓词，区分 tag 和 field、推断数据类型的规则和 GetSP 相同，
+// 常量在左边的比较换成列名在左边的形式。谓词之间有 OR、或者有不是列和常量比较的谓词时 ok 为 false，
+// 这些谓词不能逐个在客户端重新计算
+func GetPredicates(query string, resp *Response, tagMap MeasurementTagMap) (predicates []Predicate, ok bool) {
+	s, ok := selectStatement(query)
+	if !ok {
+		return nil, false
+	}
+	if s.Condition == nil {
+		return nil, true
+	}
+	cond, _, err := influxql.ConditionExpr(s.Condition, &influxql.NowValuer{Now: time.Now()})
+	if err != nil {
+		return nil, false
+	}
+
+	measurement := queryMeasurement(query)
+	if !ResponseIsEmpty(resp) {
+		measurement = resp.Results[0].Series[0].Name
+	}
+	predicates = make([]Predicate, 0)
+	if cond != nil && !collectPredicates(cond, measurement, tagMap, &predicates) {
+		return nil, false
+	}
+	return predicates, true
+}
+
+// collectPredicates 遍历由 AND 连接的谓词，遇到 OR 或者无法表示成 Predicate 的谓词时返回 false
+func collectPredicates(expr influxql.Expr, measurement string, tagMap MeasurementTagMap, predicates *[]Predicate) bool {
+	for {
+		paren, ok := expr.(*influxql.ParenExpr)
+		if !ok {
+			break
+		}
+		expr = paren.Expr
+	}
+	node, ok := expr.(*influxql.BinaryExpr)
+	if !ok {
+		return false
+	}
+	if node.Op == influxql.AND {
+		return collectPredicates(node.LHS, measurement, tagMap, predicates) &&
+			collectPredicates(node.RHS, measurement, tagMap, predicates)
+	}
+
+	node = canonicalComparison(node)
+	ref, ok := node.LHS.(*influxql.VarRef)
+	if !ok {
+		return false
+	}
+	if _, ok := predicateOperators[node.Op.String()]; !ok {
+		return false
+	}
+	value, guessed, ok := literalValue(node.RHS)
+	if !ok {
+		return false
+	}
+	datatype, isField := predicateDatatype(measurement, ref.Val, guessed)
+	isTag := ref.Type == influxql.Tag || ref.Type == influxql.Unknown && !isField && isTagKey(tagMap, measurement, ref.Val)
+	if isTag {
+		datatype = "string"
+	}
+	*predicates = append(*predicates, Predicate{Key: ref.Val, Op: node.Op.String(), Value: value, Type: datatype, IsTag: isTag})
+	return true
+}
+
+// literalValue 返回常量的值和按常量的写法推断的数据类型
+func literalValue(expr influxql.Expr) (value interface{}, datatype string, ok bool) {
+	switch e := expr.(type) {
+	case *influxql.StringLiteral:
+		return e.Val, "string", true
+	case *influxql.IntegerLiteral:
+		return e.Val, "int64", true
+	case *influxql.NumberLiteral:
+		return e.Val, "float64", true
+	case *influxql.BooleanLiteral:
+		return e.Val, "bool", true
+	case *influxql.RegexLiteral:
+		return e.Val, "string", true
+	}
+	return nil, "", false
+}
+
+// Expr 返回谓词的语法树
+func (p Predicate) Expr() influxql.Expr {
+	var rhs influxql.Expr
+	switch v := p.Value.(type) {
+	case string:
+		rhs = &influxql.StringLiteral{Val: v}
+	case int64:
+		rhs = &influxql.IntegerLiteral{Val: v}
+	case float64:
+		rhs = &influxql.NumberLiteral{Val: v}
+	case bool:
+		rhs = &influxql.BooleanLiteral{Val: v}
+	case *regexp.Regexp:
+		rhs = &influxql.RegexLiteral{Val: v}
+	default:
+		rhs = &influxql.StringLiteral{Val: fmt.Sprint(v)}
+	}
+	return &influxql.BinaryExpr{Op: predicateOperators[p.Op], LHS: &influxql.VarRef{Val: p.Key}, RHS: rhs}
+}
+
+// String 返回谓词在 InfluxQL 中的写法，浮点数常量不丢失精度，如 "level description" = 'below 3 feet'、water_level > 8.1234
+func (p Predicate) String() string {
+	return exprString(p.Expr())
+}
+
+// Match 判断一个值是否满足谓词，v 是 Response 中的值（json.Number、string、bool）或者 tag 的值；
+// 空值不满足任何谓词，数值之间按大小比较，整数列和浮点数常量也可以比较
+func (p Predicate) Match(v interface{}) bool {
+	if v == nil {
+		return false
+	}
+	switch want := p.Value.(type) {
+	case *regexp.Regexp:
+		s, ok := v.(string)
+		return ok && want.MatchString(s) == (p.Op == influxql.EQREGEX.String())
+	case string:
+		s, ok := v.(string)
+		return ok && compareResult(p.Op, strings.Compare(s, want))
+	case bool:
+		b, ok := v.(bool)
+		if !ok {
+			return false
+		}
+		switch p.Op {
+		case influxql.EQ.String():
+			return b == want
+		case influxql.NEQ.String():
+			return b != want
+		}
+		return false
+	}
+	cmp, ok := compareNumbers(v, p.Value)
+	return ok && compareResult(p.Op, cmp)
+}
+
+// compareNumbers 比较两个数值，都是整数时按整数比较，否则按浮点数比较
+func compareNumbers(a, b interface{}) (int, bool) {
+	ai, aIsInt := integerOf(a)
+	bi, bIsInt := integerOf(b)
+	if aIsInt && bIsInt {
+		switch {
+		case ai < bi:
+			return -1, true
+		case ai > bi:
+			return 1, true
+		}
+		return 0, true
+	}
+	af, ok1 := numberOf(a)
+	bf, ok2 := numberOf(b)
+	if !ok1 || !ok2 {
+		return 0, false
+	}
+	switch {
+	case af < bf:
+		return -1, true
+	case af > bf:
+		return 1, true
+	}
+	return 0, true
+}
+
+// integerOf 返回整数值，不是整数时 ok 为 false
+func integerOf(v interface{}) (int64, bool) {
+	switch n := v.(type) {
+	case int64:
+		return n, true
+	case int:
+		return int64(n), true
+	case json.Number:
+		i, err := n.Int64()
+		return i, err == nil
+	}
+	return 0, false
+}
+
+// numberOf 返回数值的浮点数值，不是数值时 ok 为 false
+func numberOf(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case int64:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// compareResult 根据比较的结果 cmp（-1、0、1）判断是否满足运算符 op
+func compareResult(op string, cmp int) bool {
+	switch op {
+	case influxql.EQ.String():
+		return cmp == 0
+	case influxql.NEQ.String():
+		return cmp != 0
+	case influxql.LT.String():
+		return cmp < 0
+	case influxql.LTE.String():
+		return cmp <= 0
+	case influxql.GT.String():
+		return cmp > 0
+	case influxql.GTE.String():
+		return cmp >= 0
+	}
+	return false
+}
+
+// FilterResponse 在客户端对结果重新应用谓词：tag 的谓词过滤表，其他谓词过滤行，过滤后没有数据的表被去掉；
+// 结果中没有谓词的列或 tag 时该谓词被忽略，resp 不会被修改
+func FilterResponse(resp *Response, predicates []Predicate) *Response {
+	if ResponseIsEmpty(resp) || len(predicates) == 0 {
+		return resp
+	}
+	result := &Response{Results: []Result{{StatementId: resp.Results[0].StatementId}}}
+	for _, s := range resp.Results[0].Series {
+		if !matchTags(s.Tags, predicates) {
+			continue
+		}
+		colIndex := make(map[string]int, len(s.Columns))
+		for i, col := range s.Columns {
+			colIndex[col] = i
+		}
+		values := make([][]interface{}, 0, len(s.Values))
+		for _, row := range s.Values {
+			if matchRow(row, colIndex, predicates) {
+				values = append(values, row)
+			}
+		}
+		if len(values) == 0 {
+			continue
+		}
+		s.Values = values
+		result.Results[0].Series = append(result.Results[0].Series, s)
+	}
+	return result
+}
+
+// matchTags 判断表的 tag 是否满足所有 tag 的谓词，没有 GROUP BY 的 tag 不在表的 tags 中，这些谓词被忽略
+func matchTags(tags map[string]string, predicates []Predicate) bool {
+	for _, p := range predicates {
+		if !p.IsTag {
+			continue
+		}
+		if v, ok := tags[p.Key]; ok && !p.Match(v) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchRow 判断一行数据是否满足所有 field 的谓词
+func matchRow(row []interface{}, colIndex map[string]int, predicates []Predicate) bool {
+	for _, p := range predicates {
+		if p.IsTag {
+			continue
+		}
+		idx, ok := colIndex[p.Key]
+		if !ok {
+			continue
+		}
+		if idx >= len(row) || !p.Match(row[idx]) {
+			return false
+		}
+	}
+	return true
+}
+
+// QueryWithPredicates 把查询的 WHERE 子句换成原来的时间范围和 predicates，其他部分保持不变，
+// 用来生成只查询部分数据的查询，不需要修改查询语句的字符串
+func QueryWithPredicates(queryString string, predicates []Predicate) (string, error) {
+	stmt, err := influxql.ParseStatement(queryString)
+	if err != nil {
+		return "", err
+	}
+	s, ok := stmt.(*influxql.SelectStatement)
+	if !ok {
+		return "", fmt.Errorf("%w: not a SELECT statement: %s", ErrUnsupportedQuery, queryString)
+	}
+
+	conds := make([]string, 0, len(predicates)+1)
+	if timeCond := timeCondition(s.Condition); timeCond != nil {
+		conds = append(conds, exprString(timeCond))
+	}
+	for _, p := range predicates {
+		if _, ok := predicateOperators[p.Op]; !ok {
+			return "", fmt.Errorf("invalid operator %q in predicate on %s", p.Op, p.Key)
+		}
+		conds = append(conds, p.String())
+	}
+	if len(conds) == 0 {
+		s.Condition = nil
+		return s.String(), nil
+	}
+
+	/* influxql 的浮点数常量只保留 3 位小数，条件用 exprString 生成，先用参数占位 */
+	const placeholder = "predicates"
+	s.Condition = &influxql.BoundParameter{Name: placeholder}
+	return strings.Replace(s.String(), "$"+placeholder, strings.Join(conds, " AND "), 1), nil
+}
+
+// timeCondition 返回条件中只和时间有关的部分，由 AND 连接的其他谓词被去掉，没有时间范围时返回 nil
+func timeCondition(expr influxql.Expr) influxql.Expr {
+	if expr == nil {
+		return nil
+	}
+	if b, ok := expr.(*influxql.BinaryExpr); ok && b.Op == influxql.AND {
+		lhs, rhs := timeCondition(b.LHS), timeCondition(b.RHS)
+		switch {
+		case lhs == nil:
+			return rhs
+		case rhs == nil:
+			return lhs
+		}
+		return &influxql.BinaryExpr{Op: influxql.AND, LHS: lhs, RHS: rhs}
+	}
+
+	onlyTime, hasTime := true, false
+	influxql.WalkFunc(expr, func(node influxql.Node) {
+		if ref, ok := node.(*influxql.VarRef); ok {
+			if isTimeRef(ref) {
+				hasTime = true
+			} else {
+				onlyTime = false
+			}
+		}
+	})
+	if onlyTime && hasTime {
+		return expr
+	}
+	return nil
+}
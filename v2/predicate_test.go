@@ -0,0 +1,148 @@
+package client
+
+import (
+	"encoding/json"
+	"reflect"
+	"regexp"
+	"testing"
+
+	"github.com/influxdata/influxdb1-client/models"
+)
+
+func TestGetPredicates(t *testing.T) {
+	defer SetSchema(SetSchema(&Schema{FieldTypes: map[string]map[string]string{"h2o_feet": {"water_level": "float64", "level": "string"}}}))
+	tagMap := MeasurementTagMap{Measurement: map[string][]TagKeyMap{
+		"h2o_feet": {{Tag: map[string]TagValues{"location": {Values: []string{"coyote_creek"}}, "level": {Values: []string{"high"}}}}},
+	}}
+
+	/* 和 tag 同名的 field 是 field，常量在左边的比较换成列名在左边，时间范围不是谓词 */
+	query := "SELECT water_level FROM h2o_feet WHERE level = 'high' AND location = 'coyote_creek' AND 8 < water_level AND time >= '2019-08-18T00:00:00Z'"
+	predicates, ok := GetPredicates(query, nil, tagMap)
+	expected := []Predicate{
+		{Key: "level", Op: "=", Value: "high", Type: "string"},
+		{Key: "location", Op: "=", Value: "coyote_creek", Type: "string", IsTag: true},
+		{Key: "water_level", Op: ">", Value: int64(8), Type: "float64"},
+	}
+	if !ok || !reflect.DeepEqual(predicates, expected) {
+		t.Errorf("predicates:\t%v\nexpected:\t%v", predicates, expected)
+	}
+
+	/* 正则表达式和类型选择符 */
+	predicates, ok = GetPredicates("SELECT water_level FROM h2o_feet WHERE location::tag =~ /^santa/ AND \"level description\" != 'below 3 feet'", nil, tagMap)
+	if !ok || len(predicates) != 2 || !predicates[0].IsTag || predicates[0].Value.(*regexp.Regexp).String() != "^santa" ||
+		predicates[1].Key != "level description" || predicates[1].IsTag {
+		t.Errorf("predicates:\t%v", predicates)
+	}
+
+	/* 没有谓词 */
+	if predicates, ok := GetPredicates("SELECT water_level FROM h2o_feet WHERE time >= '2019-08-18T00:00:00Z'", nil, tagMap); !ok || len(predicates) != 0 {
+		t.Errorf("predicates:\t%v %v", predicates, ok)
+	}
+
+	/* OR 和列之间的比较不能逐个计算 */
+	for _, q := range []string{
+		"SELECT water_level FROM h2o_feet WHERE location = 'coyote_creek' OR water_level > 8",
+		"SELECT water_level FROM h2o_feet WHERE water_level > index",
+		"SELECT water_level FROM h2o_feet WHERE water_level + 1 > 8",
+		"SELECT",
+	} {
+		if predicates, ok := GetPredicates(q, nil, tagMap); ok {
+			t.Errorf("expected failure for %q, got %v", q, predicates)
+		}
+	}
+}
+
+func TestPredicateMatch(t *testing.T) {
+	tests := []struct {
+		predicate Predicate
+		value     interface{}
+		expected  bool
+	}{
+		{Predicate{Key: "water_level", Op: ">", Value: int64(8)}, json.Number("8.12"), true},
+		{Predicate{Key: "water_level", Op: ">", Value: int64(8)}, json.Number("8"), false},
+		{Predicate{Key: "water_level", Op: "<=", Value: 7.5}, json.Number("7.5"), true},
+		{Predicate{Key: "index", Op: "!=", Value: int64(9007199254740993)}, json.Number("9007199254740992"), true},
+		{Predicate{Key: "index", Op: "=", Value: int64(1)}, nil, false},
+		{Predicate{Key: "location", Op: "=", Value: "coyote_creek"}, "coyote_creek", true},
+		{Predicate{Key: "location", Op: "!=", Value: "coyote_creek"}, "santa_monica", true},
+		{Predicate{Key: "location", Op: "=~", Value: regexp.MustCompile("^santa")}, "santa_monica", true},
+		{Predicate{Key: "location", Op: "!~", Value: regexp.MustCompile("^santa")}, "santa_monica", false},
+		{Predicate{Key: "ok", Op: "=", Value: true}, true, true},
+		{Predicate{Key: "ok", Op: ">", Value: true}, true, false},
+		{Predicate{Key: "location", Op: "=", Value: "1"}, json.Number("1"), false},
+	}
+
+	for _, tt := range tests {
+		if match := tt.predicate.Match(tt.value); match != tt.expected {
+			t.Errorf("%s on %v:\t%v\nexpected:\t%v", tt.predicate, tt.value, match, tt.expected)
+		}
+	}
+}
+
+func TestFilterResponse(t *testing.T) {
+	resp := &Response{Results: []Result{{Series: []models.Row{
+		{
+			Name:    "h2o_feet",
+			Tags:    map[string]string{"location": "coyote_creek"},
+			Columns: []string{"time", "water_level"},
+			Values: [][]interface{}{
+				{json.Number("1566086400000000000"), json.Number("8.12")},
+				{json.Number("1566086760000000000"), json.Number("7.887")},
+				{json.Number("1566087120000000000"), nil},
+			},
+		},
+		{
+			Name:    "h2o_feet",
+			Tags:    map[string]string{"location": "santa_monica"},
+			Columns: []string{"time", "water_level"},
+			Values:  [][]interface{}{{json.Number("1566086400000000000"), json.Number("2.064")}},
+		},
+	}}}}
+	predicates := []Predicate{
+		{Key: "location", Op: "=", Value: "coyote_creek", IsTag: true},
+		{Key: "water_level", Op: ">", Value: int64(8)},
+		{Key: "randtag", Op: "=", Value: "1", IsTag: true}, // 不在结果的 tags 中，被忽略
+	}
+
+	filtered := FilterResponse(resp, predicates)
+	expected := [][]interface{}{{json.Number("1566086400000000000"), json.Number("8.12")}}
+	if len(filtered.Results[0].Series) != 1 || !reflect.DeepEqual(filtered.Results[0].Series[0].Values, expected) {
+		t.Errorf("filtered:\n%s", filtered.ToString())
+	}
+	if len(resp.Results[0].Series[0].Values) != 3 {
+		t.Errorf("original response was modified:\n%s", resp.ToString())
+	}
+}
+
+func TestQueryWithPredicates(t *testing.T) {
+	query := "SELECT water_level FROM h2o_feet WHERE location = 'coyote_creek' AND time >= '2019-08-18T00:00:00Z' AND time <= '2019-08-18T00:30:00Z' GROUP BY location"
+	predicates := []Predicate{
+		{Key: "location", Op: "=", Value: "santa_monica", IsTag: true},
+		{Key: "water_level", Op: ">", Value: 8.1234},
+		{Key: "level description", Op: "=~", Value: regexp.MustCompile("feet$")},
+	}
+	result, err := QueryWithPredicates(query, predicates)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := "SELECT water_level FROM h2o_feet WHERE time >= '2019-08-18T00:00:00Z' AND time <= '2019-08-18T00:30:00Z' AND location = 'santa_monica' AND water_level > 8.1234 AND \"level description\" =~ /feet$/ GROUP BY location"
+	if result != expected {
+		t.Errorf("query:\t%s\nexpected:\t%s", result, expected)
+	}
+
+	/* 重新生成的查询得到相同的谓词 */
+	parsed, ok := GetPredicates(result, nil, MeasurementTagMap{})
+	if !ok || len(parsed) != 3 || parsed[1].Value != 8.1234 {
+		t.Errorf("predicates:\t%v", parsed)
+	}
+
+	/* 去掉所有谓词 */
+	result, err = QueryWithPredicates("SELECT water_level FROM h2o_feet WHERE location = 'coyote_creek'", nil)
+	if err != nil || result != "SELECT water_level FROM h2o_feet" {
+		t.Errorf("query:\t%s %v", result, err)
+	}
+
+	if _, err := QueryWithPredicates(query, []Predicate{{Key: "water_level", Op: "+", Value: int64(1)}}); err == nil {
+		t.Error("expected error for invalid operator")
+	}
+}
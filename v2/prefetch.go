@@ -0,0 +1,205 @@
+package client
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/InfluxDB-client/memcache"
+	"github.com/influxdata/influxql"
+)
+
+// PrefetchConfig 配置相邻时间窗口的预取：查询 [t0, t1] 之后在后台查询并缓存 [t1, t1+Window]（或者之前的窗口），
+// 仪表盘向后滚动或者定时刷新时可以直接命中cache
+type PrefetchConfig struct {
+	Client      Client           // 执行预取查询的数据库连接
+	Cache       *memcache.Client // 存入预取结果的cache
+	Window      time.Duration    // 预取窗口的长度，为 0 时和原查询的时间范围一样长
+	Backward    bool             // 预取之前的窗口，否则预取之后的窗口
+	Concurrency int              // 同时执行的预取查询数，默认为 1，已满时新的预取被跳过
+}
+
+// PrefetchStats 是预取的计数
+type PrefetchStats struct {
+	Prefetched uint64 // 完成的预取查询数
+	Skipped    uint64 // 因为已经在cache中、窗口在未来或者并发已满而跳过的次数
+	Errors     uint64 // 失败的预取查询数
+}
+
+// Prefetcher 在后台预取相邻的时间窗口
+type Prefetcher struct {
+	conf PrefetchConfig
+	sem  chan struct{}
+
+	prefetched uint64
+	skipped    uint64
+	errors     uint64
+
+	mu       sync.Mutex
+	inflight map[string]bool // 正在执行的预取查询
+	wg       sync.WaitGroup
+	stopped  bool // Stop 之后不再开始新的预取
+}
+
+// Prefetch 不为 nil 时，Set 查询数据库之后用它预取相邻的时间窗口
+var Prefetch *Prefetcher
+
+// NewPrefetcher 创建预取器
+func NewPrefetcher(conf PrefetchConfig) *Prefetcher {
+	if conf.Concurrency <= 0 {
+		conf.Concurrency = 1
+	}
+	return &Prefetcher{conf: conf, sem: make(chan struct{}, conf.Concurrency), inflight: make(map[string]bool)}
+}
+
+// Observe 记录查询 queryString 已经返回给调用方，在后台预取它相邻的时间窗口
+// segment 是查询结果的语义段，不为空时跳过cache中已经覆盖的窗口
+func (p *Prefetcher) Observe(queryString, segment string) {
+	startTime, endTime, relative := GetQueryTimeRange(queryString)
+	if startTime < 0 {
+		atomic.AddUint64(&p.skipped, 1)
+		return
+	}
+	window := int64(p.conf.Window)
+	if window <= 0 {
+		window = endTime - startTime
+	}
+	if window <= 0 {
+		window = 1
+	}
+	next := Interval{Start: endTime + 1, End: endTime + window}
+	if p.conf.Backward {
+		next = Interval{Start: startTime - window, End: startTime - 1}
+	}
+
+	/* 未来的数据还没有写入，依赖当前时间的查询之后的窗口总是在未来；已经在cache中的窗口不需要预取 */
+	if !p.conf.Backward && (relative || next.Start > time.Now().UnixNano()) {
+		atomic.AddUint64(&p.skipped, 1)
+		return
+	}
+	if covered, ok := Coverage.Covered(segment); segment != "" && ok && len(subtractIntervals(next, covered)) == 0 {
+		atomic.AddUint64(&p.skipped, 1)
+		return
+	}
+
+	prefetchQuery, err := QueryWithTimeRange(queryString, next.Start, next.End)
+	if err != nil {
+		atomic.AddUint64(&p.errors, 1)
+		return
+	}
+
+	select {
+	case p.sem <- struct{}{}:
+	default:
+		atomic.AddUint64(&p.skipped, 1)
+		return
+	}
+	p.mu.Lock()
+	if p.stopped || p.inflight[prefetchQuery] {
+		p.mu.Unlock()
+		<-p.sem
+		atomic.AddUint64(&p.skipped, 1)
+		return
+	}
+	p.inflight[prefetchQuery] = true
+	p.wg.Add(1)
+	p.mu.Unlock()
+
+	go func() {
+		defer func() {
+			p.mu.Lock()
+			delete(p.inflight, prefetchQuery)
+			p.mu.Unlock()
+			<-p.sem
+			p.wg.Done()
+		}()
+		if err := p.fetch(prefetchQuery); err != nil {
+			atomic.AddUint64(&p.errors, 1)
+			return
+		}
+		atomic.AddUint64(&p.prefetched, 1)
+	}()
+}
+
+// fetch 查询数据库并存入cache，不经过 Set，预取的结果不会再触发预取
+func (p *Prefetcher) fetch(queryString string) error {
+	if err := waitDBLimiter(queryString); err != nil {
+		return err
+	}
+	resp, err := p.conf.Client.Query(NewQuery(queryString, MyDB, "ns"))
+	if err != nil {
+		return err
+	}
+	if err := resp.Error(); err != nil {
+		return err
+	}
+	return setResponse(queryString, "ns", resp, p.conf.Cache)
+}
+
+// Stats 返回当前的计数
+func (p *Prefetcher) Stats() PrefetchStats {
+	return PrefetchStats{
+		Prefetched: atomic.LoadUint64(&p.prefetched),
+		Skipped:    atomic.LoadUint64(&p.skipped),
+		Errors:     atomic.LoadUint64(&p.errors),
+	}
+}
+
+// Wait 等待所有正在执行的预取完成
+func (p *Prefetcher) Wait() {
+	p.wg.Wait()
+}
+
+// Stop 不再开始新的预取，并等待正在执行的预取完成
+func (p *Prefetcher) Stop() {
+	p.mu.Lock()
+	p.stopped = true
+	p.mu.Unlock()
+	p.wg.Wait()
+}
+
+// QueryWithTimeRange 把查询的时间条件替换成 [startTime, endTime]（纳秒），其他条件不变
+func QueryWithTimeRange(queryString string, startTime, endTime int64) (string, error) {
+	stmt, err := influxql.ParseStatement(queryString)
+	if err != nil {
+		return "", err
+	}
+	s, ok := stmt.(*influxql.SelectStatement)
+	if !ok {
+		return "", fmt.Errorf("%w: not a SELECT statement: %s", ErrUnsupportedQuery, queryString)
+	}
+
+	var cond influxql.Expr
+	if s.Condition != nil {
+		if cond, _, err = influxql.ConditionExpr(s.Condition, &influxql.NowValuer{Now: time.Now()}); err != nil {
+			return "", err
+		}
+	}
+	timeCond := &influxql.BinaryExpr{
+		Op: influxql.AND,
+		LHS: &influxql.BinaryExpr{
+			Op:  influxql.GTE,
+			LHS: &influxql.VarRef{Val: "time"},
+			RHS: &influxql.TimeLiteral{Val: time.Unix(0, startTime).UTC()},
+		},
+		RHS: &influxql.BinaryExpr{
+			Op:  influxql.LTE,
+			LHS: &influxql.VarRef{Val: "time"},
+			RHS: &influxql.TimeLiteral{Val: time.Unix(0, endTime).UTC()},
+		},
+	}
+	switch e := cond.(type) {
+	case nil:
+		s.Condition = timeCond
+	case *influxql.BinaryExpr:
+		/* OR 连接的条件需要加括号，其他条件保持原样，语义段和原查询相同 */
+		if e.Op == influxql.OR {
+			cond = &influxql.ParenExpr{Expr: cond}
+		}
+		s.Condition = &influxql.BinaryExpr{Op: influxql.AND, LHS: cond, RHS: timeCond}
+	default:
+		s.Condition = &influxql.BinaryExpr{Op: influxql.AND, LHS: cond, RHS: timeCond}
+	}
+	return s.String(), nil
+}
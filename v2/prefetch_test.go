@@ -0,0 +1,93 @@
+package client
+
+import (
+	"testing"
+	"time"
+
+	"github.com/InfluxDB-client/memcache"
+)
+
+func TestQueryWithTimeRange(t *testing.T) {
+	const t0 = 1566086400000000000 // 2019-08-18T00:00:00Z
+	tests := []struct {
+		name        string
+		queryString string
+		expected    string
+	}{
+		{
+			name:        "replace time range",
+			queryString: "SELECT water_level FROM h2o_feet WHERE location = 'coyote_creek' AND time >= '2019-08-17T00:00:00Z' AND time <= '2019-08-17T00:30:00Z' GROUP BY randtag",
+			expected:    "SELECT water_level FROM h2o_feet WHERE location = 'coyote_creek' AND time >= '2019-08-18T00:00:00Z' AND time <= '2019-08-18T00:30:00Z' GROUP BY randtag",
+		},
+		{
+			name:        "OR condition",
+			queryString: "SELECT water_level FROM h2o_feet WHERE (location = 'coyote_creek' OR location = 'santa_monica') AND time >= '2019-08-17T00:00:00Z'",
+			expected:    "SELECT water_level FROM h2o_feet WHERE (location = 'coyote_creek' OR location = 'santa_monica') AND time >= '2019-08-18T00:00:00Z' AND time <= '2019-08-18T00:30:00Z'",
+		},
+		{
+			name:        "without condition",
+			queryString: "SELECT water_level FROM h2o_feet",
+			expected:    "SELECT water_level FROM h2o_feet WHERE time >= '2019-08-18T00:00:00Z' AND time <= '2019-08-18T00:30:00Z'",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, err := QueryWithTimeRange(tt.queryString, t0, t0+int64(30*time.Minute))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if query != tt.expected {
+				t.Errorf("query:\t%s\nexpected:\t%s", query, tt.expected)
+			}
+		})
+	}
+}
+
+func TestPrefetcher(t *testing.T) {
+	var commands []string
+	ts := newAdminServer(&commands, `{"results":[{"statement_id":0}]}`)
+	defer ts.Close()
+	c, _ := NewHTTPClient(HTTPConfig{Addr: ts.URL})
+	defer c.Close()
+
+	queryString := "SELECT water_level FROM h2o_feet WHERE time >= '2019-08-18T00:00:00Z' AND time <= '2019-08-18T00:30:00Z'"
+	tests := []struct {
+		name     string
+		conf     PrefetchConfig
+		expected string
+	}{
+		{
+			name:     "next window of the same length",
+			conf:     PrefetchConfig{},
+			expected: "SELECT water_level FROM h2o_feet WHERE time >= '2019-08-18T00:30:00.000000001Z' AND time <= '2019-08-18T01:00:00Z'",
+		},
+		{
+			name:     "previous window",
+			conf:     PrefetchConfig{Window: time.Hour, Backward: true},
+			expected: "SELECT water_level FROM h2o_feet WHERE time >= '2019-08-17T23:00:00Z' AND time <= '2019-08-17T23:59:59.999999999Z'",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			commands = nil
+			tt.conf.Client, tt.conf.Cache = c, memcache.New("localhost:0")
+			p := NewPrefetcher(tt.conf)
+			p.Observe(queryString, "")
+			p.Wait()
+			if len(commands) != 1 || commands[0] != tt.expected {
+				t.Errorf("queries:\t%q\nexpected:\t%q", commands, tt.expected)
+			}
+		})
+	}
+
+	/* 未来的窗口不预取 */
+	commands = nil
+	p := NewPrefetcher(PrefetchConfig{Client: c, Cache: memcache.New("localhost:0")})
+	p.Observe("SELECT water_level FROM h2o_feet WHERE time >= now() - 1h", "")
+	p.Wait()
+	if len(commands) != 0 || p.Stats().Skipped != 1 {
+		t.Errorf("queries:\t%q\nstats:\t%+v", commands, p.Stats())
+	}
+}
@@ -0,0 +1,298 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/golang/snappy"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+const (
+	// PrometheusNameLabel is the label holding the metric name in remote_write samples.
+	PrometheusNameLabel = "__name__"
+
+	// PrometheusValueField is the field name the sample value is written to.
+	PrometheusValueField = "value"
+
+	// DefaultRemoteWriteBatchSize is the number of points per BatchPoints
+	// when RemoteWriteConfig.BatchSize is not set.
+	DefaultRemoteWriteBatchSize = 5000
+)
+
+// RemoteWriteConfig is the config data needed to convert Prometheus
+// remote_write requests into BatchPoints.
+type RemoteWriteConfig struct {
+	// Database is the database to write points to.
+	Database string
+
+	// RetentionPolicy is the retention policy of the points, optional.
+	RetentionPolicy string
+
+	// BatchSize is the maximum number of points in a single BatchPoints,
+	// defaults to DefaultRemoteWriteBatchSize.
+	BatchSize int
+}
+
+// prometheusLabel is a name/value pair of a remote_write time series.
+type prometheusLabel struct {
+	name  string
+	value string
+}
+
+// prometheusSample is a single value of a remote_write time series.
+type prometheusSample struct {
+	value     float64
+	timestamp int64 // milliseconds since Unix epoch
+}
+
+// prometheusTimeSeries is a decoded remote_write TimeSeries message.
+type prometheusTimeSeries struct {
+	labels  []prometheusLabel
+	samples []prometheusSample
+}
+
+// ParseRemoteWriteRequest decodes a snappy compressed Prometheus remote_write
+// WriteRequest and converts every sample into a Point. The metric name becomes
+// the measurement, the remaining labels become tags and the sample value is
+// written to the "value" field. Samples whose value is NaN or ±Inf cannot be
+// stored by InfluxDB and are counted in dropped instead.
+func ParseRemoteWriteRequest(compressed []byte) (points []*Point, dropped int, err error) {
+	data, err := snappy.Decode(nil, compressed)
+	if err != nil {
+		return nil, 0, fmt.Errorf("remote_write: snappy decode: %w", err)
+	}
+	series, err := decodeWriteRequest(data)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	for _, ts := range series {
+		name := ""
+		tags := make(map[string]string, len(ts.labels))
+		for _, l := range ts.labels {
+			if l.name == PrometheusNameLabel {
+				name = l.value
+				continue
+			}
+			if l.value != "" {
+				tags[l.name] = l.value
+			}
+		}
+		if name == "" {
+			dropped += len(ts.samples)
+			continue
+		}
+
+		for _, s := range ts.samples {
+			if math.IsNaN(s.value) || math.IsInf(s.value, 0) {
+				dropped++
+				continue
+			}
+			fields := map[string]interface{}{PrometheusValueField: s.value}
+			pt, err := NewPoint(name, tags, fields, time.Unix(0, s.timestamp*int64(time.Millisecond)))
+			if err != nil {
+				return nil, dropped, fmt.Errorf("remote_write: %s: %w", name, err)
+			}
+			points = append(points, pt)
+		}
+	}
+	return points, dropped, nil
+}
+
+// RemoteWriteToBatchPoints converts a remote_write request into one or more
+// BatchPoints of at most conf.BatchSize points each.
+func RemoteWriteToBatchPoints(compressed []byte, conf RemoteWriteConfig) ([]BatchPoints, int, error) {
+	points, dropped, err := ParseRemoteWriteRequest(compressed)
+	if err != nil {
+		return nil, dropped, err
+	}
+
+	batchSize := conf.BatchSize
+	if batchSize <= 0 {
+		batchSize = DefaultRemoteWriteBatchSize
+	}
+
+	var batches []BatchPoints
+	for start := 0; start < len(points); start += batchSize {
+		end := start + batchSize
+		if end > len(points) {
+			end = len(points)
+		}
+		bp, err := NewBatchPoints(BatchPointsConfig{
+			Precision:       "ms",
+			Database:        conf.Database,
+			RetentionPolicy: conf.RetentionPolicy,
+		})
+		if err != nil {
+			return nil, dropped, err
+		}
+		bp.AddPoints(points[start:end])
+		batches = append(batches, bp)
+	}
+	return batches, dropped, nil
+}
+
+// WriteRemoteWrite converts a remote_write request and writes all batches
+// through c. It stops at the first failed batch and returns how many points
+// were written before it.
+func WriteRemoteWrite(c Client, compressed []byte, conf RemoteWriteConfig) (written int, err error) {
+	batches, _, err := RemoteWriteToBatchPoints(compressed, conf)
+	if err != nil {
+		return 0, err
+	}
+	for _, bp := range batches {
+		if err := c.Write(bp); err != nil {
+			return written, fmt.Errorf("remote_write: write %d points: %w", len(bp.Points()), err)
+		}
+		written += len(bp.Points())
+	}
+	return written, nil
+}
+
+// RemoteWriteHandler is an http.Handler accepting Prometheus remote_write
+// requests and writing them into InfluxDB through Client.
+type RemoteWriteHandler struct {
+	Client Client
+	Config RemoteWriteConfig
+}
+
+// NewRemoteWriteHandler returns a handler that writes remote_write samples
+// through c using the given config.
+func NewRemoteWriteHandler(c Client, conf RemoteWriteConfig) *RemoteWriteHandler {
+	return &RemoteWriteHandler{Client: c, Config: conf}
+}
+
+// ServeHTTP answers 204 when every sample was written, 400 when the request
+// cannot be decoded and 500 when InfluxDB rejected a batch.
+func (h *RemoteWriteHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	batches, _, err := RemoteWriteToBatchPoints(body, h.Config)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	for _, bp := range batches {
+		if err := h.Client.Write(bp); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+var errRemoteWriteMalformed = errors.New("remote_write: malformed protobuf message")
+
+// decodeWriteRequest decodes the timeseries (field 1) of a WriteRequest,
+// skipping metadata and any other fields.
+func decodeWriteRequest(b []byte) ([]prometheusTimeSeries, error) {
+	var series []prometheusTimeSeries
+	err := walkMessage(b, func(num protowire.Number, typ protowire.Type, v []byte, x uint64) error {
+		if num != 1 || typ != protowire.BytesType {
+			return nil
+		}
+		ts, err := decodeTimeSeries(v)
+		if err != nil {
+			return err
+		}
+		series = append(series, ts)
+		return nil
+	})
+	return series, err
+}
+
+func decodeTimeSeries(b []byte) (prometheusTimeSeries, error) {
+	var ts prometheusTimeSeries
+	err := walkMessage(b, func(num protowire.Number, typ protowire.Type, v []byte, x uint64) error {
+		if typ != protowire.BytesType {
+			return nil
+		}
+		switch num {
+		case 1: // Label
+			var l prometheusLabel
+			err := walkMessage(v, func(num protowire.Number, typ protowire.Type, v []byte, x uint64) error {
+				if typ != protowire.BytesType {
+					return nil
+				}
+				switch num {
+				case 1:
+					l.name = string(v)
+				case 2:
+					l.value = string(v)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			ts.labels = append(ts.labels, l)
+		case 2: // Sample
+			var s prometheusSample
+			err := walkMessage(v, func(num protowire.Number, typ protowire.Type, v []byte, x uint64) error {
+				switch {
+				case num == 1 && typ == protowire.Fixed64Type:
+					s.value = math.Float64frombits(x)
+				case num == 2 && typ == protowire.VarintType:
+					s.timestamp = int64(x)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			ts.samples = append(ts.samples, s)
+		}
+		return nil
+	})
+	return ts, err
+}
+
+// walkMessage calls fn for every field of a protobuf message. For length
+// delimited fields v is the payload, for varint and fixed64 fields x is the
+// decoded value. Other wire types are skipped.
+func walkMessage(b []byte, fn func(num protowire.Number, typ protowire.Type, v []byte, x uint64) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return errRemoteWriteMalformed
+		}
+		b = b[n:]
+
+		var v []byte
+		var x uint64
+		deliver := true
+		switch typ {
+		case protowire.BytesType:
+			v, n = protowire.ConsumeBytes(b)
+		case protowire.Fixed64Type:
+			x, n = protowire.ConsumeFixed64(b)
+		case protowire.VarintType:
+			x, n = protowire.ConsumeVarint(b)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+			deliver = false
+		}
+		if n < 0 {
+			return errRemoteWriteMalformed
+		}
+		if deliver {
+			if err := fn(num, typ, v, x); err != nil {
+				return err
+			}
+		}
+		b = b[n:]
+	}
+	return nil
+}
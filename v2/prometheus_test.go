@@ -0,0 +1,124 @@
+package client
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang/snappy"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// encodeRemoteWrite builds a snappy compressed WriteRequest with one time series.
+func encodeRemoteWrite(labels [][2]string, samples []prometheusSample) []byte {
+	var ts []byte
+	for _, l := range labels {
+		var lb []byte
+		lb = protowire.AppendTag(lb, 1, protowire.BytesType)
+		lb = protowire.AppendString(lb, l[0])
+		lb = protowire.AppendTag(lb, 2, protowire.BytesType)
+		lb = protowire.AppendString(lb, l[1])
+		ts = protowire.AppendTag(ts, 1, protowire.BytesType)
+		ts = protowire.AppendBytes(ts, lb)
+	}
+	for _, s := range samples {
+		var sb []byte
+		sb = protowire.AppendTag(sb, 1, protowire.Fixed64Type)
+		sb = protowire.AppendFixed64(sb, math.Float64bits(s.value))
+		sb = protowire.AppendTag(sb, 2, protowire.VarintType)
+		sb = protowire.AppendVarint(sb, uint64(s.timestamp))
+		ts = protowire.AppendTag(ts, 2, protowire.BytesType)
+		ts = protowire.AppendBytes(ts, sb)
+	}
+	var req []byte
+	req = protowire.AppendTag(req, 1, protowire.BytesType)
+	req = protowire.AppendBytes(req, ts)
+	return snappy.Encode(nil, req)
+}
+
+func TestParseRemoteWriteRequest(t *testing.T) {
+	body := encodeRemoteWrite(
+		[][2]string{{"__name__", "cpu_usage"}, {"host", "host_0"}, {"empty", ""}},
+		[]prometheusSample{{1.5, 1566086400000}, {math.NaN(), 1566086401000}, {2, 1566086402000}},
+	)
+
+	points, dropped, err := ParseRemoteWriteRequest(body)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if dropped != 1 {
+		t.Errorf("dropped:\t%d\nexpected:\t%d", dropped, 1)
+	}
+	expected := []string{
+		"cpu_usage,host=host_0 value=1.5 1566086400000000000",
+		"cpu_usage,host=host_0 value=2 1566086402000000000",
+	}
+	if len(points) != len(expected) {
+		t.Fatalf("points:\t%d\nexpected:\t%d", len(points), len(expected))
+	}
+	for i, p := range points {
+		if p.String() != expected[i] {
+			t.Errorf("point:\t%s\nexpected:\t%s", p.String(), expected[i])
+		}
+	}
+
+	if _, _, err := ParseRemoteWriteRequest([]byte("not snappy")); err == nil {
+		t.Error("expected error for malformed body")
+	}
+}
+
+func TestRemoteWriteToBatchPoints(t *testing.T) {
+	body := encodeRemoteWrite(
+		[][2]string{{"__name__", "up"}},
+		[]prometheusSample{{1, 1000}, {1, 2000}, {0, 3000}},
+	)
+	batches, _, err := RemoteWriteToBatchPoints(body, RemoteWriteConfig{Database: "prom", BatchSize: 2})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(batches) != 2 {
+		t.Fatalf("batches:\t%d\nexpected:\t%d", len(batches), 2)
+	}
+	if len(batches[0].Points()) != 2 || len(batches[1].Points()) != 1 {
+		t.Errorf("unexpected batch sizes %d, %d", len(batches[0].Points()), len(batches[1].Points()))
+	}
+	if batches[0].Database() != "prom" || batches[0].Precision() != "ms" {
+		t.Errorf("unexpected batch config db=%s precision=%s", batches[0].Database(), batches[0].Precision())
+	}
+}
+
+func TestRemoteWriteHandler(t *testing.T) {
+	var written bytes.Buffer
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("db") != "prom" {
+			t.Errorf("unexpected db %q", r.URL.Query().Get("db"))
+		}
+		io.Copy(&written, r.Body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+
+	c, _ := NewHTTPClient(HTTPConfig{Addr: ts.URL})
+	defer c.Close()
+	h := NewRemoteWriteHandler(c, RemoteWriteConfig{Database: "prom"})
+
+	body := encodeRemoteWrite([][2]string{{"__name__", "up"}, {"job", "node"}}, []prometheusSample{{1, 1000}})
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("POST", "/api/v1/prom/write", bytes.NewReader(body)))
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("status:\t%d\nexpected:\t%d", rec.Code, http.StatusNoContent)
+	}
+	if got := strings.TrimSpace(written.String()); got != "up,job=node value=1 1000" {
+		t.Errorf("written:\t%s", got)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("POST", "/api/v1/prom/write", strings.NewReader("garbage")))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status:\t%d\nexpected:\t%d", rec.Code, http.StatusBadRequest)
+	}
+}
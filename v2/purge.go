@@ -0,0 +1,54 @@
+package client
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/InfluxDB-client/memcache"
+)
+
+// Purge 删除键目录中涉及表 measurement、覆盖范围和 [start, end] 相交的语义段在cache中的数据，并删除它们的覆盖范围记录，
+// 返回删除的语义段。InfluxDB 中的历史数据被改写（重新写入、DELETE、DROP SERIES）之后用来让从这些数据得到的cache失效。
+// cache只能整个删除一个语义段，和时间范围部分相交的语义段也整个删除，之后的查询重新从数据库读取
+func Purge(measurement string, start, end int64) ([]string, error) {
+	return purge(Coverage, DefaultCache(), func(entry CatalogEntry) bool {
+		if !slices.Contains(entry.Measurements, measurement) {
+			return false
+		}
+		for _, in := range entry.Intervals {
+			if in.Start <= end && in.End >= start {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// PurgeKeyPrefix 删除键目录中以 prefix 开头的语义段在cache中的数据，并删除它们的覆盖范围记录，返回删除的语义段。
+// 比如 "{(h2o_feet." 匹配第一张表是 h2o_feet 的语义段，空的 prefix 匹配所有语义段
+func PurgeKeyPrefix(prefix string) ([]string, error) {
+	return purge(Coverage, DefaultCache(), func(entry CatalogEntry) bool {
+		return strings.HasPrefix(entry.Segment, prefix)
+	})
+}
+
+// purge 删除 ci 中满足 match 的语义段；cache中已经没有的语义段也删除覆盖范围记录，
+// 删除失败的语义段保留记录，下次 Purge 时重试，返回第一个错误
+func purge(ci *CoverageIndex, mc *memcache.Client, match func(CatalogEntry) bool) ([]string, error) {
+	purged := make([]string, 0)
+	var firstErr error
+	for _, entry := range ci.Catalog() {
+		if !match(entry) {
+			continue
+		}
+		if err := mc.Delete(cacheKey(entry.Segment)); err != nil && err != memcache.ErrCacheMiss {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		ci.Remove(entry.Segment)
+		purged = append(purged, entry.Segment)
+	}
+	return purged, firstErr
+}
@@ -0,0 +1,75 @@
+package client
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/InfluxDB-client/diskcache"
+	"github.com/InfluxDB-client/memcache"
+)
+
+func TestPurge(t *testing.T) {
+	s, err := diskcache.Listen(filepath.Join(t.TempDir(), "cache.db"), "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	mc := memcache.New(s.Addr())
+	defer SetDefaultCache(SetDefaultCache(mc))
+	defer func(ci *CoverageIndex) { Coverage = ci }(Coverage)
+
+	feet := "{(h2o_feet.location=coyote_creek)}#{water_level[float64]}#{empty}#{empty,empty}"
+	feetLater := "{(h2o_feet.location=santa_monica)}#{water_level[float64]}#{empty}#{empty,empty}"
+	both := "{(h2o_feet.empty)(h2o_pH.empty)}#{water_level[float64],pH[int64]}#{empty}#{empty,empty}"
+	ph := "{(h2o_pH.location=coyote_creek)}#{pH[int64]}#{empty}#{empty,empty}"
+	notCached := "{(h2o_feet.location=other)}#{water_level[float64]}#{empty}#{empty,empty}"
+
+	reset := func() {
+		Coverage = NewCoverageIndex()
+		for segment, in := range map[string]Interval{feet: {0, 100}, feetLater: {200, 300}, both: {50, 60}, ph: {0, 100}} {
+			if err := mc.Set(&memcache.Item{Key: segment, Value: []byte("value"), Time_start: in.Start, Time_end: in.End}); err != nil {
+				t.Fatal(err)
+			}
+			Coverage.Add(segment, in)
+		}
+		Coverage.Add(notCached, Interval{0, 100})
+	}
+
+	/* 只删除涉及 h2o_feet 且和 [50, 150] 相交的语义段，cache中没有的语义段也删除记录 */
+	reset()
+	purged, err := Purge("h2o_feet", 50, 150)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{both, feet, notCached}
+	if !reflect.DeepEqual(purged, expected) {
+		t.Errorf("purged:\t%v\nexpected:\t%v", purged, expected)
+	}
+	if !reflect.DeepEqual(Coverage.Segments(), []string{feetLater, ph}) {
+		t.Errorf("remaining:\t%v\nexpected:\t%v", Coverage.Segments(), []string{feetLater, ph})
+	}
+	if _, _, err := mc.Get(feet, 0, 100); err != memcache.ErrCacheMiss {
+		t.Errorf("get purged segment:\t%v\nexpected:\t%v", err, memcache.ErrCacheMiss)
+	}
+	if _, _, err := mc.Get(ph, 0, 100); err != nil {
+		t.Errorf("get remaining segment:\t%v", err)
+	}
+
+	reset()
+	purged, err = PurgeKeyPrefix("{(h2o_pH.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(purged, []string{ph}) {
+		t.Errorf("purged:\t%v\nexpected:\t%v", purged, []string{ph})
+	}
+
+	purged, err = PurgeKeyPrefix("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(purged) != 4 || len(Coverage.Segments()) != 0 {
+		t.Errorf("purged:\t%v\nremaining:\t%v", purged, Coverage.Segments())
+	}
+}
@@ -0,0 +1,82 @@
+package client
+
+import (
+	"sync"
+	"time"
+)
+
+// Quantizer 把查询的时间范围对齐到步长：起始时间向下取整、结束时间向上取整到步长的整数倍。
+// 时间范围随意的查询（仪表盘拖动、now() - 1h）对齐之后落到少数几个范围上，cache命中率大大提高，
+// 代价是每次最多多查询两边各一个步长的数据。步长按查询模板（见 QueryTemplate）设置，没有设置的模板使用默认步长
+type Quantizer struct {
+	mu          sync.RWMutex
+	defaultStep time.Duration
+	steps       map[string]time.Duration
+}
+
+// Quantization 不为 nil 时，SetStream 查询数据库和存入cache之前按它对齐查询的时间范围；
+// 从cache读取时用 Quantization.Range 对齐时间范围，和存入时一致
+var Quantization *Quantizer
+
+// NewQuantizer 创建默认步长为 defaultStep 的 Quantizer，为 0 时只对齐设置了步长的模板
+func NewQuantizer(defaultStep time.Duration) *Quantizer {
+	return &Quantizer{defaultStep: defaultStep, steps: make(map[string]time.Duration)}
+}
+
+// SetStep 设置和 queryString 同一模板的查询的步长，为 0 时这个模板的查询不对齐。
+// 模板包含条件的形式，queryString 要和实际的查询一样带有时间条件
+func (qz *Quantizer) SetStep(queryString string, step time.Duration) {
+	template := QueryTemplate(queryString)
+	qz.mu.Lock()
+	defer qz.mu.Unlock()
+	qz.steps[template] = step
+}
+
+// Step 返回查询使用的步长
+func (qz *Quantizer) Step(queryString string) time.Duration {
+	template := QueryTemplate(queryString)
+	qz.mu.RLock()
+	defer qz.mu.RUnlock()
+	if step, ok := qz.steps[template]; ok {
+		return step
+	}
+	return qz.defaultStep
+}
+
+// Range 返回查询的时间范围 [start, end]（纳秒）对齐之后的范围；结束时间向上取整后超过当前时间时不超过当前时间，
+// 否则还没有写入的数据会被当作已经覆盖
+func (qz *Quantizer) Range(queryString string, start, end int64) (int64, int64) {
+	step := int64(qz.Step(queryString))
+	if step <= 0 || start < 0 || end < start {
+		return start, end
+	}
+	qStart := start - start%step
+	qEnd := end
+	if r := (end + 1) % step; r != 0 {
+		qEnd = end + step - r
+	}
+	if now := time.Now().UnixNano(); qEnd > now {
+		qEnd = max(end, now)
+	}
+	return qStart, qEnd
+}
+
+// Query 返回时间范围对齐之后的查询语句；没有步长、没有完整的时间范围或者有 OR 连接的多个时间范围的查询原样返回
+func (qz *Quantizer) Query(queryString string) string {
+	if qz.Step(queryString) <= 0 {
+		return queryString
+	}
+	if queries, _ := splitTimeRanges(queryString); len(queries) > 0 {
+		return queryString
+	}
+	start, end, _ := GetQueryTimeRange(queryString)
+	qStart, qEnd := qz.Range(queryString, start, end)
+	if qStart == start && qEnd == end {
+		return queryString
+	}
+	quantized, err := QueryWithTimeRange(queryString, qStart, qEnd)
+	if err != nil {
+		return queryString
+	}
+	return quantized
+}
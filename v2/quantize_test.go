@@ -0,0 +1,56 @@
+package client
+
+import (
+	"testing"
+	"time"
+)
+
+func TestQuantizer(t *testing.T) {
+	qz := NewQuantizer(time.Minute)
+	qz.SetStep("SELECT usage FROM cpu WHERE host = 'a'", time.Hour)
+	qz.SetStep("SELECT usage FROM mem WHERE time >= 0 AND time <= 1", 0)
+
+	const m = int64(time.Minute)
+	const h = int64(time.Hour)
+	tests := []struct {
+		name             string
+		query            string
+		start, end       int64
+		expStart, expEnd int64
+	}{
+		{name: "default step", query: "SELECT usage FROM disk", start: 90e9, end: 150e9, expStart: m, expEnd: 3*m - 1},
+		{name: "aligned", query: "SELECT usage FROM disk", start: m, end: 2*m - 1, expStart: m, expEnd: 2*m - 1},
+		/* 同一模板的查询，tag 的值不同 */
+		{name: "template step", query: "SELECT usage FROM cpu WHERE host = 'b'", start: 90e9, end: 150e9, expStart: 0, expEnd: h - 1},
+		{name: "disabled", query: "SELECT usage FROM mem WHERE time >= 0 AND time <= 1", start: 90e9, end: 150e9, expStart: 90e9, expEnd: 150e9},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, end := qz.Range(tt.query, tt.start, tt.end)
+			if start != tt.expStart || end != tt.expEnd {
+				t.Errorf("range:\t[%d, %d]\nexpected:\t[%d, %d]", start, end, tt.expStart, tt.expEnd)
+			}
+		})
+	}
+
+	/* 结束时间不超过当前时间 */
+	now := time.Now().UnixNano()
+	if _, end := qz.Range("SELECT usage FROM disk", now-m, now-1); end > time.Now().UnixNano() {
+		t.Errorf("end %d is in the future", end)
+	}
+
+	query := qz.Query("SELECT usage FROM disk WHERE host = 'a' AND time >= 90000000000 AND time <= 150000000000")
+	expected := "SELECT usage FROM disk WHERE host = 'a' AND time >= '1970-01-01T00:01:00Z' AND time <= '1970-01-01T00:02:59.999999999Z'"
+	if query != expected {
+		t.Errorf("query:\t%s\nexpected:\t%s", query, expected)
+	}
+	for _, q := range []string{
+		"SELECT usage FROM disk",
+		"SELECT usage FROM mem WHERE time >= 90000000000 AND time <= 150000000000",
+		"SELECT usage FROM disk WHERE time >= 0 AND time <= 10 OR time >= 90000000000 AND time <= 150000000000",
+	} {
+		if got := qz.Query(q); got != q {
+			t.Errorf("query:\t%s\nexpected unchanged:\t%s", got, q)
+		}
+	}
+}
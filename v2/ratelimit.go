@@ -0,0 +1,182 @@
+package client
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/influxdata/influxql"
+)
+
+// RateLimit 配置一个令牌桶：每秒补充 Rate 个令牌，最多积累 Burst 个，Rate 为 0 时不限制
+type RateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+// QueryLimiter 限制 Set 查询数据库的速率，避免cache被清空或冷启动时大量未命中的查询同时压到数据库
+// Global 限制所有查询，PerTemplate 限制同一模板（只有时间范围、常量、LIMIT 不同）的查询
+type QueryLimiter struct {
+	global      *tokenBucket
+	perTemplate RateLimit
+
+	mu        sync.Mutex
+	templates map[string]*tokenBucket
+}
+
+// DBLimiter 不为 nil 时，Set 查询数据库之前先从它取得令牌
+var DBLimiter *QueryLimiter
+
+// maxTemplateBuckets 是保留的模板令牌桶数量，超过时删除已经补满的令牌桶
+const maxTemplateBuckets = 10000
+
+// NewQueryLimiter 创建查询限流器
+func NewQueryLimiter(global, perTemplate RateLimit) *QueryLimiter {
+	return &QueryLimiter{
+		global:      newTokenBucket(global, time.Now()),
+		perTemplate: perTemplate,
+		templates:   make(map[string]*tokenBucket),
+	}
+}
+
+// Wait 阻塞到查询可以发送给数据库，ctx 先结束时返回 ctx.Err()，已经取得的令牌会归还
+func (ql *QueryLimiter) Wait(ctx context.Context, queryString string) error {
+	now := time.Now()
+	buckets := []*tokenBucket{ql.global}
+	if ql.perTemplate.Rate > 0 {
+		buckets = append(buckets, ql.templateBucket(QueryTemplate(queryString), now))
+	}
+
+	var delay time.Duration
+	for _, b := range buckets {
+		if d := b.reserve(now); d > delay {
+			delay = d
+		}
+	}
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		for _, b := range buckets {
+			b.cancel()
+		}
+		return ctx.Err()
+	}
+}
+
+func (ql *QueryLimiter) templateBucket(template string, now time.Time) *tokenBucket {
+	ql.mu.Lock()
+	defer ql.mu.Unlock()
+	if b, ok := ql.templates[template]; ok {
+		return b
+	}
+	if len(ql.templates) >= maxTemplateBuckets {
+		for t, b := range ql.templates {
+			if b.full(now) {
+				delete(ql.templates, t)
+			}
+		}
+	}
+	b := newTokenBucket(ql.perTemplate, now)
+	ql.templates[template] = b
+	return b
+}
+
+// QueryTemplate 返回查询的模板：条件中的常量替换成参数 $v，去掉 LIMIT、OFFSET，
+// 同一个模板的查询只有时间范围和常量不同。无法解析的查询以原语句作为模板
+func QueryTemplate(queryString string) string {
+	stmt, err := influxql.ParseStatement(queryString)
+	if err != nil {
+		return queryString
+	}
+	s, ok := stmt.(*influxql.SelectStatement)
+	if !ok {
+		return queryString
+	}
+	s = s.Clone()
+	if s.Condition != nil {
+		s.Condition = influxql.RewriteExpr(s.Condition, func(e influxql.Expr) influxql.Expr {
+			switch e.(type) {
+			case *influxql.StringLiteral, *influxql.NumberLiteral, *influxql.IntegerLiteral,
+				*influxql.UnsignedLiteral, *influxql.BooleanLiteral, *influxql.TimeLiteral,
+				*influxql.DurationLiteral, *influxql.RegexLiteral:
+				return &influxql.BoundParameter{Name: "v"}
+			}
+			return e
+		})
+	}
+	s.Limit, s.Offset, s.SLimit, s.SOffset = 0, 0, 0, 0
+	return s.String()
+}
+
+// waitDBLimiter 在查询数据库之前等待 DBLimiter
+func waitDBLimiter(queryString string) error {
+	if DBLimiter == nil {
+		return nil
+	}
+	return DBLimiter.Wait(context.Background(), queryString)
+}
+
+// tokenBucket 是令牌桶，令牌数可以是负数，表示已经被预约的令牌
+type tokenBucket struct {
+	limit RateLimit
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(limit RateLimit, now time.Time) *tokenBucket {
+	if limit.Burst < 1 {
+		limit.Burst = 1
+	}
+	return &tokenBucket{limit: limit, tokens: float64(limit.Burst), last: now}
+}
+
+// reserve 取走一个令牌，返回令牌补充到之前需要等待的时间
+func (b *tokenBucket) reserve(now time.Time) time.Duration {
+	if b.limit.Rate <= 0 {
+		return 0
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill(now)
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.limit.Rate * float64(time.Second))
+}
+
+// cancel 归还 reserve 取走的令牌
+func (b *tokenBucket) cancel() {
+	if b.limit.Rate <= 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens++
+}
+
+func (b *tokenBucket) full(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill(now)
+	return b.tokens >= float64(b.limit.Burst)
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens += elapsed.Seconds() * b.limit.Rate
+		if b.tokens > float64(b.limit.Burst) {
+			b.tokens = float64(b.limit.Burst)
+		}
+		b.last = now
+	}
+}
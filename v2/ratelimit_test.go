@@ -0,0 +1,51 @@
+package client
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestQueryTemplate(t *testing.T) {
+	a := QueryTemplate("SELECT index FROM h2o_quality WHERE location='coyote_creek' AND time >= '2019-08-18T00:00:00Z' AND time <= '2019-08-18T00:30:00Z' LIMIT 5")
+	b := QueryTemplate("SELECT index FROM h2o_quality WHERE location='santa_monica' AND time >= '2019-08-19T00:00:00Z' AND time <= '2019-08-19T00:30:00Z'")
+	c := QueryTemplate("SELECT water_level FROM h2o_feet WHERE location='santa_monica' AND time >= '2019-08-19T00:00:00Z' AND time <= '2019-08-19T00:30:00Z'")
+	if a != b {
+		t.Errorf("template:\t%s\nexpected:\t%s", a, b)
+	}
+	if a == c {
+		t.Errorf("different queries have the same template:\t%s", a)
+	}
+}
+
+func TestQueryLimiter(t *testing.T) {
+	ql := NewQueryLimiter(RateLimit{}, RateLimit{Rate: 1, Burst: 2})
+	q := "SELECT index FROM h2o_quality WHERE location='coyote_creek'"
+	other := "SELECT water_level FROM h2o_feet"
+
+	/* 每个模板先用掉 burst 个令牌，之后需要等待 */
+	for i := 0; i < 2; i++ {
+		if err := ql.Wait(context.Background(), q); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := ql.Wait(ctx, q); err != context.DeadlineExceeded {
+		t.Errorf("error:\t%v\nexpected:\t%v", err, context.DeadlineExceeded)
+	}
+	/* 其他模板不受影响 */
+	if err := ql.Wait(ctx, other); err != nil {
+		t.Errorf("error:\t%v\nexpected:\t%v", err, nil)
+	}
+
+	global := NewQueryLimiter(RateLimit{Rate: 1, Burst: 1}, RateLimit{})
+	if err := global.Wait(context.Background(), q); err != nil {
+		t.Fatal(err)
+	}
+	ctx2, cancel2 := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel2()
+	if err := global.Wait(ctx2, other); err != context.DeadlineExceeded {
+		t.Errorf("error:\t%v\nexpected:\t%v", err, context.DeadlineExceeded)
+	}
+}
@@ -0,0 +1,276 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/InfluxDB-client/memcache"
+)
+
+// reaggregations 记录每种聚合函数由更细粒度的结果合并时使用的函数，mean 需要同一区间的 count 加权，单独处理
+var reaggregations = map[string]string{
+	"count": "sum",
+	"sum":   "sum",
+	"max":   "max",
+	"min":   "min",
+	"first": "first",
+	"last":  "last",
+}
+
+// ReaggregateResponse 把 GROUP BY time(fine) 的聚合结果合并成 GROUP BY time(interval) 的结果，interval 必须是 fine 的整数倍
+// aggregations 是每一列（不包括 time）的聚合函数，写法和 SG 相同，只有一个时所有列使用同一个函数
+// 含有 mean 时需要传入同一查询、同一 fine 区间的 COUNT 结果 counts，按每个区间的数据量加权求平均，否则 counts 可以为 nil
+func ReaggregateResponse(fine *Response, aggregations []string, fineInterval, interval time.Duration, counts *Response) (*Response, error) {
+	return ReaggregateResponseWithOffset(fine, aggregations, fineInterval, interval, 0, counts)
+}
+
+// ReaggregateResponseWithOffset 和 ReaggregateResponse 相同，合并后区间的边界是 offset 加上 interval 的整数倍，
+// 对应 GROUP BY time(interval, offset)；fine 的区间边界需要和它对齐，即 time(fine, offset) 的结果
+func ReaggregateResponseWithOffset(fine *Response, aggregations []string, fineInterval, interval, offset time.Duration, counts *Response) (*Response, error) {
+	if fineInterval <= 0 || interval <= 0 || interval%fineInterval != 0 {
+		return nil, fmt.Errorf("cannot re-aggregate time(%v) into time(%v)", fineInterval, interval)
+	}
+	if ResponseIsEmpty(fine) {
+		return fine, nil
+	}
+	if len(aggregations) == 0 {
+		return nil, fmt.Errorf("missing aggregation")
+	}
+
+	columns := fine.Results[0].Series[0].Columns
+	calls := make([]fieldAggregate, 0, len(columns)-1)
+	hasMean := false
+	for i, col := range columns[1:] {
+		aggr := aggregations[0]
+		if len(aggregations) == len(columns)-1 {
+			aggr = aggregations[i]
+		}
+		aggr = strings.ToLower(ParseAggregation(aggr).Func) // 有参数的函数如 percentile:90 不能合并
+		if aggr == "mean" {
+			hasMean = true
+			calls = append(calls, fieldAggregate{aggr: "sum", field: col})
+			continue
+		}
+		op, ok := reaggregations[aggr]
+		if !ok {
+			return nil, fmt.Errorf("aggregation %s cannot be re-aggregated", aggr)
+		}
+		calls = append(calls, fieldAggregate{aggr: op, field: col})
+	}
+
+	if !hasMean {
+		return aggregateResponse(fine, calls, columns, interval, offset, 0)
+	}
+
+	/* mean 先乘以区间内的数据量得到总和，合并之后再除以合并后的数据量 */
+	if ResponseIsEmpty(counts) {
+		return nil, fmt.Errorf("%w: re-aggregating mean needs the count of every fine interval", ErrEmptyResponse)
+	}
+	if len(counts.Results[0].Series) != len(fine.Results[0].Series) {
+		return nil, fmt.Errorf("%w: re-aggregating mean needs the count of every fine interval", ErrSchemaMismatch)
+	}
+	weighted := &Response{Results: []Result{{StatementId: fine.Results[0].StatementId}}}
+	countCalls := make([]fieldAggregate, 0, len(calls))
+	for _, col := range counts.Results[0].Series[0].Columns[1:] {
+		countCalls = append(countCalls, fieldAggregate{aggr: "sum", field: col})
+	}
+	for i, s := range fine.Results[0].Series {
+		cs := counts.Results[0].Series[i]
+		if len(cs.Values) != len(s.Values) || len(cs.Columns) != len(s.Columns) {
+			return nil, fmt.Errorf("%w: count of series %s does not match its fine intervals", ErrSchemaMismatch, s.Name)
+		}
+		values := make([][]interface{}, len(s.Values))
+		for j, row := range s.Values {
+			values[j] = append([]interface{}{}, row...)
+			for k := range calls {
+				if strings.ToLower(aggregationOf(aggregations, k)) != "mean" || row[k+1] == nil {
+					continue
+				}
+				mean, ok1 := floatOf(row[k+1])
+				n, ok2 := floatOf(cs.Values[j][k+1])
+				if !ok1 || !ok2 {
+					return nil, fmt.Errorf("invalid mean %v or count %v in series %s", row[k+1], cs.Values[j][k+1], s.Name)
+				}
+				values[j][k+1] = json.Number(jsonFloat(mean * n))
+			}
+		}
+		weighted.Results[0].Series = append(weighted.Results[0].Series, SeriesToRow(Series{Name: s.Name, Tags: s.Tags, Columns: s.Columns, Values: values}))
+	}
+
+	result, err := aggregateResponse(weighted, calls, columns, interval, offset, 0)
+	if err != nil {
+		return nil, err
+	}
+	totals, err := aggregateResponse(counts, countCalls, counts.Results[0].Series[0].Columns, interval, offset, 0)
+	if err != nil {
+		return nil, err
+	}
+	for i, s := range result.Results[0].Series {
+		for j, row := range s.Values {
+			for k := range calls {
+				if strings.ToLower(aggregationOf(aggregations, k)) != "mean" || row[k+1] == nil {
+					continue
+				}
+				sum, _ := floatOf(row[k+1])
+				n, _ := floatOf(totals.Results[0].Series[i].Values[j][k+1])
+				if n == 0 {
+					row[k+1] = nil
+					continue
+				}
+				row[k+1] = json.Number(jsonFloat(sum / n))
+			}
+		}
+	}
+	return result, nil
+}
+
+// aggregationOf 返回第 i 列的聚合函数
+func aggregationOf(aggregations []string, i int) string {
+	if i < len(aggregations) {
+		return aggregations[i]
+	}
+	return aggregations[0]
+}
+
+// floatOf 把结果中的数值转换成 float64
+func floatOf(v interface{}) (float64, bool) {
+	n, ok := v.(json.Number)
+	if !ok {
+		return 0, false
+	}
+	f, err := n.Float64()
+	return f, err == nil
+}
+
+// FinerSegment 把语义段 SG 中的聚合函数和区间替换成 aggr 和 interval，得到同一查询其他粒度的结果在cache中的key
+// aggr 为空时保留原来的聚合函数；换成 count 时 SF 中所有列的数据类型都是 int64；
+// SG 中有偏移量时保留，换算到新的区间内，和数据库对 time(interval, offset) 的处理相同
+func FinerSegment(segment string, aggr string, interval time.Duration) (string, error) {
+	parts := strings.Split(segment, "#")
+	if len(parts) != 4 {
+		return "", fmt.Errorf("invalid semantic segment %s", segment)
+	}
+	sg := strings.Split(strings.Trim(parts[3], "{}"), ",")
+	if len(sg) != 2 && len(sg) != 3 {
+		return "", fmt.Errorf("invalid SG in semantic segment %s", segment)
+	}
+	offset, err := sgOffset(sg)
+	if err != nil {
+		return "", err
+	}
+	if aggr == "" {
+		aggr = sg[0]
+	}
+	if aggr == "count" {
+		fields := strings.Split(strings.Trim(parts[1], "{}"), ",")
+		for i, f := range fields {
+			if idx := strings.Index(f, "["); idx > 0 {
+				fields[i] = f[:idx] + "[int64]"
+			}
+		}
+		parts[1] = "{" + strings.Join(fields, ",") + "}"
+	}
+	parts[3] = fmt.Sprintf("{%s,%s}", aggr, formatInterval(interval))
+	if interval > 0 && mod(int64(offset), int64(interval)) != 0 {
+		parts[3] = fmt.Sprintf("{%s,%s,%s}", aggr, formatInterval(interval), formatInterval(time.Duration(mod(int64(offset), int64(interval)))))
+	}
+	return strings.Join(parts, "#"), nil
+}
+
+// sgOffset 返回 SG 中 GROUP BY time() 的偏移量，SG 是 {aggr,interval} 或 {aggr,interval,offset}
+func sgOffset(sg []string) (time.Duration, error) {
+	if len(sg) < 3 {
+		return 0, nil
+	}
+	return time.ParseDuration(sg[2])
+}
+
+// GetReaggregated 查询的语义段在cache中未命中时，依次查找 fineIntervals 中能整除查询区间的更细粒度的结果，
+// 在客户端重新聚合得到查询结果；所有粒度都未命中时返回 memcache.ErrCacheMiss
+func GetReaggregated(segment string, startTime, endTime int64, mc *memcache.Client, fineIntervals ...time.Duration) (*Response, error) {
+	parts := strings.Split(segment, "#")
+	if len(parts) != 4 {
+		return nil, fmt.Errorf("invalid semantic segment %s", segment)
+	}
+	sg := strings.Split(strings.Trim(parts[3], "{}"), ",")
+	if (len(sg) != 2 && len(sg) != 3) || sg[0] == "empty" || sg[1] == "empty" {
+		return nil, fmt.Errorf("semantic segment %s is not a GROUP BY time() aggregation", segment)
+	}
+	interval, err := time.ParseDuration(sg[1])
+	if err != nil {
+		return nil, err
+	}
+	offset, err := sgOffset(sg)
+	if err != nil {
+		return nil, err
+	}
+	aggregations := strings.Split(sg[0], "|")
+
+	for _, fine := range fineIntervals {
+		if fine <= 0 || fine >= interval || interval%fine != 0 {
+			continue
+		}
+		/* 粗粒度区间的起始时间可能早于查询的起始时间，需要第一个区间内的所有细粒度区间，
+		   细粒度的结果没有完整覆盖 [fineStart, endTime] 时，重新聚合的结果是错误的 */
+		fineStart := startTime - mod(startTime-int64(offset), int64(interval))
+		fineSegment, _ := FinerSegment(segment, "", fine)
+		fineResp, err := getCoveredResponse(fineSegment, fineStart, endTime, mc)
+		if err == memcache.ErrCacheMiss {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		var counts *Response
+		for _, aggr := range aggregations {
+			if aggr != "mean" {
+				continue
+			}
+			countSegment, _ := FinerSegment(segment, "count", fine)
+			counts, err = getCoveredResponse(countSegment, fineStart, endTime, mc)
+			break
+		}
+		if err == memcache.ErrCacheMiss {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		return ReaggregateResponseWithOffset(fineResp, aggregations, fine, interval, offset, counts)
+	}
+
+	return nil, memcache.ErrCacheMiss
+}
+
+// getCoveredResponse 从cache读取一个语义段在 [startTime, endTime] 内的结果，语义段没有完整覆盖这个时间范围时返回 memcache.ErrCacheMiss
+func getCoveredResponse(segment string, startTime, endTime int64, mc *memcache.Client) (*Response, error) {
+	if len(findGaps(segment, startTime, endTime, mc)) > 0 {
+		return nil, memcache.ErrCacheMiss
+	}
+	return getResponse(segment, startTime, startTime, endTime, mc)
+}
+
+// getResponse 从cache读取一个语义段在时间范围内的结果，结果裁剪到 [trimStart, endTime]
+func getResponse(segment string, trimStart, startTime, endTime int64, mc *memcache.Client) (*Response, error) {
+	HotKeys.Observe(segment)
+	start := time.Now()
+	values, _, err := mc.Get(cacheKey(segment), startTime, endTime)
+	observeLatency(StageCacheGet, start)
+	if err != nil {
+		return nil, err
+	}
+	if len(values) == 0 {
+		return nil, memcache.ErrCacheMiss
+	}
+	Coverage.Hit(segment)
+	start = time.Now()
+	decoded, err := decodeRange(values, "ns", trimStart, endTime)
+	if err != nil {
+		return nil, err
+	}
+	resp := SortSeries(StitchPartialSeries(decoded)) // 同一张表可能分开存放在多个item中
+	observeLatency(StageDeserialize, start)
+	return TrimResponse(resp, trimStart, endTime), nil
+}
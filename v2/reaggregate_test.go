@@ -0,0 +1,140 @@
+package client
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/InfluxDB-client/memcache"
+	"github.com/influxdata/influxql"
+)
+
+func TestReaggregateResponse(t *testing.T) {
+	raw := rawWaterLevel()
+	fineMax, _ := AggregateResponse(raw, "max", 6*time.Minute, influxql.MinTime, influxql.MaxTime)
+	fineMean, _ := AggregateResponse(raw, "mean", 6*time.Minute, influxql.MinTime, influxql.MaxTime)
+	fineCount, _ := AggregateResponse(raw, "count", 6*time.Minute, influxql.MinTime, influxql.MaxTime)
+
+	tests := []struct {
+		name        string
+		fine        *Response
+		aggregation string
+		counts      *Response
+	}{
+		{name: "max", fine: fineMax, aggregation: "max"},
+		{name: "count", fine: fineCount, aggregation: "count"},
+		{name: "mean weighted by count", fine: fineMean, aggregation: "mean", counts: fineCount},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := ReaggregateResponse(tt.fine, []string{tt.aggregation}, 6*time.Minute, 12*time.Minute, tt.counts)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			expected, _ := AggregateResponse(raw, tt.aggregation, 12*time.Minute, influxql.MinTime, influxql.MaxTime)
+			if !reflect.DeepEqual(resp.Results[0].Series[0].Values, expected.Results[0].Series[0].Values) {
+				t.Errorf("values:\t%v\nexpected:\t%v", resp.Results[0].Series[0].Values, expected.Results[0].Series[0].Values)
+			}
+		})
+	}
+
+	if _, err := ReaggregateResponse(fineMean, []string{"mean"}, 6*time.Minute, 12*time.Minute, nil); err == nil {
+		t.Error("expected error for mean without counts")
+	}
+	if _, err := ReaggregateResponse(fineMax, []string{"max"}, 6*time.Minute, 15*time.Minute, nil); err == nil {
+		t.Error("expected error for interval that is not a multiple")
+	}
+}
+
+func TestReaggregateResponseWithOffset(t *testing.T) {
+	fineMax, _ := AggregateResponse(rawWaterLevel(), "max", 6*time.Minute, influxql.MinTime, influxql.MaxTime)
+	resp, err := ReaggregateResponseWithOffset(fineMax, []string{"max"}, 6*time.Minute, 12*time.Minute, 6*time.Minute, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	/* 区间的起始时间是 6m 加上 12m 的整数倍 */
+	expected := [][]interface{}{
+		{"2019-08-17T23:54:00Z", json.Number("85"), json.Number("8.12")},
+		{"2019-08-18T00:06:00Z", json.Number("78"), json.Number("8.005")},
+		{"2019-08-18T00:18:00Z", json.Number("91"), json.Number("7.635")},
+	}
+	if values := resp.Results[0].Series[0].Values; !reflect.DeepEqual(values, expected) {
+		t.Errorf("values:\t%v\nexpected:\t%v", values, expected)
+	}
+}
+
+func TestFinerSegment(t *testing.T) {
+	segment := "{(h2o_feet.location=coyote_creek)}#{water_level[float64]}#{empty}#{mean,1h}"
+
+	fine, err := FinerSegment(segment, "", 12*time.Minute)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := "{(h2o_feet.location=coyote_creek)}#{water_level[float64]}#{empty}#{mean,12m}"; fine != expected {
+		t.Errorf("segment:\t%s\nexpected:\t%s", fine, expected)
+	}
+
+	count, _ := FinerSegment(segment, "count", 12*time.Minute)
+	if expected := "{(h2o_feet.location=coyote_creek)}#{water_level[int64]}#{empty}#{count,12m}"; count != expected {
+		t.Errorf("segment:\t%s\nexpected:\t%s", count, expected)
+	}
+
+	/* 偏移量换算到更细的区间内，整数倍时去掉 */
+	offsetSegment := "{(h2o_feet.location=coyote_creek)}#{water_level[float64]}#{empty}#{mean,1h,15m}"
+	if fine, _ := FinerSegment(offsetSegment, "", 10*time.Minute); fine != "{(h2o_feet.location=coyote_creek)}#{water_level[float64]}#{empty}#{mean,10m,5m}" {
+		t.Errorf("segment:\t%s", fine)
+	}
+	if fine, _ := FinerSegment(offsetSegment, "", 5*time.Minute); fine != "{(h2o_feet.location=coyote_creek)}#{water_level[float64]}#{empty}#{mean,5m}" {
+		t.Errorf("segment:\t%s", fine)
+	}
+}
+
+func TestByteArrayToResponse_MixedAggregations(t *testing.T) {
+	resp := &Response{Results: []Result{{Series: rawWaterLevel().Results[0].Series}}}
+	resp.Results[0].Series[0].Values = [][]interface{}{
+		{json.Number("1566086400000000000"), json.Number("85"), json.Number("8.0625")},
+	}
+	segments := []string{"{(h2o_feet.location=coyote_creek)}#{index[int64],water_level[float64]}#{empty}#{max|mean,12m}"}
+
+	byteArray := append(resp.ToByteArrayWithSegments(segments), []byte("\r\n")...)
+	converted := ByteArrayToResponse(byteArray)
+	if columns := converted.Results[0].Series[0].Columns; !reflect.DeepEqual(columns, []string{"time", "max", "mean"}) {
+		t.Errorf("columns:\t%v", columns)
+	}
+}
+
+func TestGetReaggregated_Coverage(t *testing.T) {
+	segment := "{(h2o_feet.location=coyote_creek)}#{index[int64]}#{empty}#{max,20s}"
+	fineSegment, _ := FinerSegment(segment, "", 10*time.Second)
+	s := int64(time.Second)
+	l := newFragmentServer(t, map[string][]*memcache.Item{fineSegment: {
+		fragmentItem(fineSegment, 20*s),
+		fragmentItem(fineSegment, 30*s, 40*s, 50*s, 60*s, 70*s),
+	}})
+	defer l.Close()
+	mc := memcache.New(l.Addr().String())
+	defer Coverage.Remove(fineSegment)
+
+	/* 第一个 20s 区间从 20s 开始，细粒度的结果只覆盖了查询的时间范围时不能重新聚合 */
+	Coverage.Add(fineSegment, Interval{30 * s, 70 * s})
+	if _, err := GetReaggregated(segment, 30*s, 70*s, mc, 10*time.Second); err != memcache.ErrCacheMiss {
+		t.Errorf("error:\t%v\nexpected:\t%v", err, memcache.ErrCacheMiss)
+	}
+
+	Coverage.Add(fineSegment, Interval{20 * s, 30 * s})
+	resp, err := GetReaggregated(segment, 30*s, 70*s, mc, 10*time.Second)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := [][]interface{}{
+		{json.Number("20000000000"), json.Number("300000000000")},
+		{json.Number("40000000000"), json.Number("500000000000")},
+		{json.Number("60000000000"), json.Number("700000000000")},
+	}
+	if values := resp.Results[0].Series[0].Values; !reflect.DeepEqual(values, expected) {
+		t.Errorf("values:\t%v\nexpected:\t%v", values, expected)
+	}
+}
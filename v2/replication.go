@@ -0,0 +1,202 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DefaultSecondaryQueueSize is the number of BatchPoints buffered for an
+// asynchronous secondary when DualWriteConfig.QueueSize is not set.
+const DefaultSecondaryQueueSize = 1000
+
+// ErrSecondaryQueueFull is reported for an asynchronous secondary write that
+// was dropped because the queue was full.
+var ErrSecondaryQueueFull = errors.New("secondary write queue is full")
+
+// DualWriteConfig is the config data needed to create a dual-write Client.
+type DualWriteConfig struct {
+	// Primary serves every query and must accept every write.
+	Primary Client
+
+	// Secondary receives a copy of every write, e.g. the new cluster during
+	// a migration or the disaster recovery site.
+	Secondary Client
+
+	// Async writes to Secondary in a background goroutine so that a slow or
+	// unavailable secondary does not delay the primary write path.
+	Async bool
+
+	// QueueSize bounds the number of BatchPoints waiting for an asynchronous
+	// secondary, defaults to DefaultSecondaryQueueSize. Writes arriving while
+	// the queue is full are dropped and reported to OnSecondaryError.
+	QueueSize int
+
+	// OnSecondaryError is called with every asynchronous secondary write
+	// error. Synchronous secondary errors are returned by Write instead.
+	OnSecondaryError func(bp BatchPoints, err error)
+}
+
+// DualWriteError is returned by Write when the primary, the secondary or
+// both failed, keeping the two errors apart so the caller can decide
+// whether the write has to be retried.
+type DualWriteError struct {
+	Primary   error
+	Secondary error
+}
+
+func (e *DualWriteError) Error() string {
+	switch {
+	case e.Primary != nil && e.Secondary != nil:
+		return fmt.Sprintf("primary write failed: %v; secondary write failed: %v", e.Primary, e.Secondary)
+	case e.Primary != nil:
+		return fmt.Sprintf("primary write failed: %v", e.Primary)
+	default:
+		return fmt.Sprintf("secondary write failed: %v", e.Secondary)
+	}
+}
+
+// NewDualWriteClient returns a Client that writes every BatchPoints to both
+// the primary and the secondary client. Queries and pings only go to the
+// primary. Closing the returned client waits for queued secondary writes and
+// closes both clients.
+func NewDualWriteClient(conf DualWriteConfig) (Client, error) {
+	if conf.Primary == nil || conf.Secondary == nil {
+		return nil, errors.New("dual write needs both a primary and a secondary client")
+	}
+	dc := &dualWriteClient{conf: conf}
+	if conf.Async {
+		if conf.QueueSize <= 0 {
+			conf.QueueSize = DefaultSecondaryQueueSize
+		}
+		dc.queue = make(chan BatchPoints, conf.QueueSize)
+		dc.wg.Add(1)
+		go dc.replicate()
+	}
+	return dc, nil
+}
+
+type dualWriteClient struct {
+	conf  DualWriteConfig
+	queue chan BatchPoints
+	wg    sync.WaitGroup
+
+	mu     sync.RWMutex // held for reading by Write, for writing by closeQueue
+	closed bool
+}
+
+// Write writes bp to the primary and the secondary. With an asynchronous
+// secondary only the primary error is returned. Write fails once the client
+// is closed.
+func (dc *dualWriteClient) Write(bp BatchPoints) error {
+	dc.mu.RLock()
+	defer dc.mu.RUnlock()
+	if dc.closed {
+		return errors.New("client closed")
+	}
+	if dc.queue != nil {
+		err := dc.conf.Primary.Write(bp)
+		select {
+		case dc.queue <- bp:
+		default:
+			dc.secondaryError(bp, ErrSecondaryQueueFull)
+		}
+		if err != nil {
+			return &DualWriteError{Primary: err}
+		}
+		return nil
+	}
+
+	var wg sync.WaitGroup
+	var secondaryErr error
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		secondaryErr = dc.conf.Secondary.Write(bp)
+	}()
+	primaryErr := dc.conf.Primary.Write(bp)
+	wg.Wait()
+
+	if primaryErr != nil || secondaryErr != nil {
+		return &DualWriteError{Primary: primaryErr, Secondary: secondaryErr}
+	}
+	return nil
+}
+
+func (dc *dualWriteClient) replicate() {
+	defer dc.wg.Done()
+	for bp := range dc.queue {
+		if err := dc.conf.Secondary.Write(bp); err != nil {
+			dc.secondaryError(bp, err)
+		}
+	}
+}
+
+func (dc *dualWriteClient) secondaryError(bp BatchPoints, err error) {
+	if dc.conf.OnSecondaryError != nil {
+		dc.conf.OnSecondaryError(bp, err)
+	}
+}
+
+func (dc *dualWriteClient) Ping(timeout time.Duration) (time.Duration, string, error) {
+	return dc.conf.Primary.Ping(timeout)
+}
+
+func (dc *dualWriteClient) Query(q Query) (*Response, error) {
+	return dc.conf.Primary.Query(q)
+}
+
+func (dc *dualWriteClient) QueryAsChunk(q Query) (*ChunkedResponse, error) {
+	return dc.conf.Primary.QueryAsChunk(q)
+}
+
+func (dc *dualWriteClient) QueryFlux(ctx context.Context, flux string) (*Response, error) {
+	return queryFlux(ctx, dc.conf.Primary, flux)
+}
+
+// closeQueue stops accepting writes and closes the asynchronous secondary
+// queue, once the running writes are done.
+func (dc *dualWriteClient) closeQueue() {
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+	if dc.closed {
+		return
+	}
+	dc.closed = true
+	if dc.queue != nil {
+		close(dc.queue)
+	}
+}
+
+// Close drains the asynchronous secondary queue and closes both clients.
+func (dc *dualWriteClient) Close() error {
+	dc.closeQueue()
+	dc.wg.Wait()
+	perr := dc.conf.Primary.Close()
+	serr := dc.conf.Secondary.Close()
+	if perr != nil {
+		return perr
+	}
+	return serr
+}
+
+// Shutdown drains the asynchronous secondary queue and shuts down both
+// clients.
+func (dc *dualWriteClient) Shutdown(ctx context.Context) error {
+	err := waitContext(ctx, func() error {
+		dc.closeQueue()
+		dc.wg.Wait()
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	perr := shutdownClient(ctx, dc.conf.Primary)
+	serr := shutdownClient(ctx, dc.conf.Secondary)
+	if perr != nil {
+		return perr
+	}
+	return serr
+}
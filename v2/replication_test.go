@@ -0,0 +1,125 @@
+package client
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newWriteServer(writes *int32, status int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(writes, 1)
+		w.WriteHeader(status)
+	}))
+}
+
+func testBatchPoints() BatchPoints {
+	bp, _ := NewBatchPoints(BatchPointsConfig{Database: "db"})
+	pt, _ := NewPoint("cpu", nil, map[string]interface{}{"value": 1.0}, time.Unix(0, 0))
+	bp.AddPoint(pt)
+	return bp
+}
+
+func TestDualWriteClient_Sync(t *testing.T) {
+	var primaryWrites, secondaryWrites int32
+	primary := newWriteServer(&primaryWrites, http.StatusNoContent)
+	defer primary.Close()
+	secondary := newWriteServer(&secondaryWrites, http.StatusInternalServerError)
+	defer secondary.Close()
+
+	p, _ := NewHTTPClient(HTTPConfig{Addr: primary.URL})
+	s, _ := NewHTTPClient(HTTPConfig{Addr: secondary.URL})
+	c, err := NewDualWriteClient(DualWriteConfig{Primary: p, Secondary: s})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer c.Close()
+
+	err = c.Write(testBatchPoints())
+	var dwErr *DualWriteError
+	if !errors.As(err, &dwErr) {
+		t.Fatalf("expected DualWriteError, got %v", err)
+	}
+	if dwErr.Primary != nil || dwErr.Secondary == nil {
+		t.Errorf("unexpected errors: primary %v, secondary %v", dwErr.Primary, dwErr.Secondary)
+	}
+	if primaryWrites != 1 || secondaryWrites != 1 {
+		t.Errorf("writes:\t%d %d\nexpected:\t1 1", primaryWrites, secondaryWrites)
+	}
+}
+
+func TestDualWriteClient_Async(t *testing.T) {
+	var primaryWrites, secondaryWrites int32
+	primary := newWriteServer(&primaryWrites, http.StatusNoContent)
+	defer primary.Close()
+	secondary := newWriteServer(&secondaryWrites, http.StatusInternalServerError)
+	defer secondary.Close()
+
+	p, _ := NewHTTPClient(HTTPConfig{Addr: primary.URL})
+	s, _ := NewHTTPClient(HTTPConfig{Addr: secondary.URL})
+	var secondaryErrors int32
+	c, _ := NewDualWriteClient(DualWriteConfig{
+		Primary:   p,
+		Secondary: s,
+		Async:     true,
+		OnSecondaryError: func(bp BatchPoints, err error) {
+			atomic.AddInt32(&secondaryErrors, 1)
+		},
+	})
+
+	for i := 0; i < 3; i++ {
+		if err := c.Write(testBatchPoints()); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+	c.Close()
+
+	if primaryWrites != 3 || secondaryWrites != 3 {
+		t.Errorf("writes:\t%d %d\nexpected:\t3 3", primaryWrites, secondaryWrites)
+	}
+	if secondaryErrors != 3 {
+		t.Errorf("secondary errors:\t%d\nexpected:\t%d", secondaryErrors, 3)
+	}
+}
+
+func TestDualWriteClient_WriteAfterClose(t *testing.T) {
+	var primaryWrites, secondaryWrites int32
+	primary := newWriteServer(&primaryWrites, http.StatusNoContent)
+	defer primary.Close()
+	secondary := newWriteServer(&secondaryWrites, http.StatusNoContent)
+	defer secondary.Close()
+
+	p, _ := NewHTTPClient(HTTPConfig{Addr: primary.URL})
+	s, _ := NewHTTPClient(HTTPConfig{Addr: secondary.URL})
+	c, _ := NewDualWriteClient(DualWriteConfig{Primary: p, Secondary: s, Async: true})
+
+	/* 和 Close 同时进行的写入要么完成，要么返回错误，不会向关闭的队列发送 */
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.Write(testBatchPoints())
+		}()
+	}
+	c.Close()
+	wg.Wait()
+
+	if err := c.Write(testBatchPoints()); err == nil {
+		t.Error("expected error writing to a closed client")
+	}
+	if err := c.Close(); err != nil {
+		t.Errorf("second Close: %v", err)
+	}
+}
+
+func TestNewDualWriteClient_MissingClient(t *testing.T) {
+	p, _ := NewHTTPClient(HTTPConfig{Addr: "http://localhost:8086"})
+	if _, err := NewDualWriteClient(DualWriteConfig{Primary: p}); err == nil {
+		t.Error("expected error without secondary client")
+	}
+}
@@ -0,0 +1,368 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/InfluxDB-client/memcache"
+	"github.com/influxdata/influxql"
+)
+
+// Rollup 描述一种预聚合：把原始数据按 Interval 划分时间区间，每个区间内的每个数值列用 Aggregation 聚合
+// 比如 Rollup{"mean", time.Minute} 对应 SELECT MEAN(field) ... GROUP BY time(1m)
+type Rollup struct {
+	Aggregation string // count, sum, mean, max, min, first, last
+	Interval    time.Duration
+}
+
+// fieldAggregate 表示查询中的一个聚合函数调用，比如 MAX(water_level)、PERCENTILE(water_level, 90)
+type fieldAggregate struct {
+	aggr  string
+	args  []string // 列名之后的参数，见 Aggregation.Args
+	field string
+}
+
+// SetWithRollups 和 Set 一样把原始数据查询的结果存入cache，同时对每种 rollup 在客户端计算聚合结果，
+// 用等价的聚合查询生成的语义段作为key一起存入，之后同一时间范围的 GROUP BY time() 查询可以直接从cache得到结果
+func SetWithRollups(queryString string, c Client, mc *memcache.Client, rollups ...Rollup) error {
+	if err := checkCardinality(c, queryString); err != nil {
+		return err
+	}
+	if err := waitDBLimiter(queryString); err != nil {
+		return err
+	}
+	query := NewQuery(queryString, MyDB, "ns")
+	start := time.Now()
+	resp, err := c.Query(query)
+	observeLatency(StageDBQuery, start)
+	if err != nil {
+		return err
+	}
+	if err := setResponse(queryString, "ns", resp, mc); err != nil {
+		return err
+	}
+	if ResponseIsEmpty(resp) {
+		return nil
+	}
+
+	startTime, endTime := int64(influxql.MinTime), int64(influxql.MaxTime)
+	if s, ok := selectStatement(queryString); ok {
+		startTime, endTime = selectTimeRange(s)
+	}
+	for _, rollup := range rollups {
+		rollupQuery, err := RollupQuery(queryString, resp, rollup)
+		if err != nil {
+			return err
+		}
+		rollupResp, err := AggregateResponse(resp, rollup.Aggregation, rollup.Interval, startTime, endTime)
+		if err != nil {
+			return err
+		}
+		if err := setResponse(rollupQuery, "ns", rollupResp, mc); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// RollupQuery 把原始数据查询改写成 rollup 对应的聚合查询，用于生成 rollup 结果的语义段
+// 只有数值类型的列会被聚合（count、first、last 也包括其他类型），原有的 GROUP BY tag 保持不变
+func RollupQuery(queryString string, resp *Response, rollup Rollup) (string, error) {
+	stmt, err := influxql.ParseStatement(queryString)
+	if err != nil {
+		return "", err
+	}
+	s, ok := stmt.(*influxql.SelectStatement)
+	if !ok {
+		return "", fmt.Errorf("%w: rollup needs a SELECT statement: %s", ErrUnsupportedQuery, queryString)
+	}
+	if interval, _ := s.GroupByInterval(); interval != 0 || GetAggregation(queryString).Func != "" {
+		return "", fmt.Errorf("%w: rollup needs a raw data query: %s", ErrUnsupportedQuery, queryString)
+	}
+	if rollup.Interval <= 0 {
+		return "", fmt.Errorf("invalid rollup interval %v", rollup.Interval)
+	}
+
+	columns := aggregatableColumns(resp, rollup.Aggregation)
+	if len(columns) == 0 {
+		return "", fmt.Errorf("no column of %s can be aggregated with %s", queryString, rollup.Aggregation)
+	}
+
+	fields := make(influxql.Fields, 0, len(columns))
+	for _, col := range columns {
+		fields = append(fields, &influxql.Field{Expr: &influxql.Call{
+			Name: strings.ToLower(rollup.Aggregation),
+			Args: []influxql.Expr{&influxql.VarRef{Val: col}},
+		}})
+	}
+	s.Fields = fields
+
+	dimensions := influxql.Dimensions{{Expr: &influxql.Call{
+		Name: "time",
+		Args: []influxql.Expr{&influxql.DurationLiteral{Val: rollup.Interval}},
+	}}}
+	s.Dimensions = append(dimensions, s.Dimensions...)
+
+	return s.String(), nil
+}
+
+// AggregateResponse 在客户端对原始数据的查询结果按时间区间聚合，得到和数据库执行对应聚合查询相同格式的结果：
+// 每张表的tags不变，列名为 time 和聚合函数名（多列时依次为 max, max_1, max_2 ...），每个区间的时间是区间的起始时间
+// 和 RollupQuery 生成的查询一样是默认的 fill(null)，补全查询的时间范围 [startTime, endTime] 内没有数据的区间，见 Downsample
+func AggregateResponse(resp *Response, aggregation string, interval time.Duration, startTime, endTime int64) (*Response, error) {
+	return Downsample(resp, interval, Aggregation{Func: strings.ToLower(aggregation)}, startTime, endTime)
+}
+
+// aggregatableColumns 返回结果中可以用 aggregation 聚合的列名（不包括 time）
+func aggregatableColumns(resp *Response, aggregation string) []string {
+	columns := make([]string, 0)
+	if ResponseIsEmpty(resp) {
+		return columns
+	}
+	datatypes := DataTypeArrayFromResponse(resp)
+	for i, col := range resp.Results[0].Series[0].Columns {
+		if i == 0 || i >= len(datatypes) {
+			continue
+		}
+		switch strings.ToLower(aggregation) {
+		case "count", "first", "last":
+			columns = append(columns, col)
+		case "sum", "mean", "max", "min", "percentile":
+			if datatypes[i] == "int64" || datatypes[i] == "float64" {
+				columns = append(columns, col)
+			}
+		}
+	}
+	return columns
+}
+
+// aggregateColumnNames 按照 InfluxDB 的规则生成聚合结果的列名，重复的函数名依次加上 _1, _2 ...
+func aggregateColumnNames(calls []fieldAggregate) []string {
+	names := []string{"time"}
+	used := make(map[string]int)
+	for _, call := range calls {
+		name := call.aggr
+		if n, ok := used[call.aggr]; ok {
+			name = fmt.Sprintf("%s_%d", call.aggr, n)
+		}
+		used[call.aggr]++
+		names = append(names, name)
+	}
+	return names
+}
+
+// aggregateResponse 对每张表按 interval 划分时间区间，逐个区间计算 calls 中的聚合函数，区间的边界是 offset 加上 interval 的整数倍
+// interval 为 0 时整张表作为一个区间，结果的时间戳为 zero
+func aggregateResponse(resp *Response, calls []fieldAggregate, columns []string, interval, offset time.Duration, zero int64) (*Response, error) {
+	result := &Response{Results: []Result{{StatementId: resp.Results[0].StatementId}}}
+
+	for _, s := range resp.Results[0].Series {
+		colIndex := make(map[string]int, len(s.Columns))
+		for i, col := range s.Columns {
+			colIndex[col] = i
+		}
+
+		series := Series{Name: s.Name, Tags: s.Tags, Columns: columns, Values: make([][]interface{}, 0)}
+		for start := 0; start < len(s.Values); {
+			ts, ok := timestampOf(s.Values[start][0])
+			if !ok {
+				return nil, fmt.Errorf("unsupported timestamp %v", s.Values[start][0])
+			}
+			bucket := zero
+			if interval > 0 {
+				bucket = ts - mod(ts-int64(offset), int64(interval))
+			}
+
+			/* 找出同一个时间区间内的所有数据，查询结果按时间升序排列 */
+			end := start + 1
+			for interval > 0 && end < len(s.Values) {
+				t, ok := timestampOf(s.Values[end][0])
+				if !ok {
+					return nil, fmt.Errorf("unsupported timestamp %v", s.Values[end][0])
+				}
+				if t-mod(t-int64(offset), int64(interval)) != bucket {
+					break
+				}
+				end++
+			}
+			if interval == 0 {
+				end = len(s.Values)
+			}
+
+			row := []interface{}{timestampLike(s.Values[start][0], bucket)}
+			for _, call := range calls {
+				idx, ok := colIndex[call.field]
+				if !ok {
+					return nil, fmt.Errorf("column %s not found in series %s", call.field, s.Name)
+				}
+				values := make([]interface{}, 0, end-start)
+				for _, v := range s.Values[start:end] {
+					if idx < len(v) && v[idx] != nil {
+						values = append(values, v[idx])
+					}
+				}
+				value, err := aggregateValues(call.aggr, call.args, values)
+				if err != nil {
+					return nil, err
+				}
+				row = append(row, value)
+			}
+			series.Values = append(series.Values, row)
+			start = end
+		}
+		result.Results[0].Series = append(result.Results[0].Series, SeriesToRow(series))
+	}
+
+	return result, nil
+}
+
+// aggregateValues 计算一个时间区间内一列非空数据的聚合值，整数列的 sum、max、min 仍然是整数
+// args 是聚合函数在列名之后的参数，比如 percentile 的百分比
+func aggregateValues(aggr string, args []string, values []interface{}) (interface{}, error) {
+	switch aggr {
+	case "count":
+		return json.Number(strconv.Itoa(len(values))), nil
+	case "first":
+		if len(values) == 0 {
+			return nil, nil
+		}
+		return values[0], nil
+	case "last":
+		if len(values) == 0 {
+			return nil, nil
+		}
+		return values[len(values)-1], nil
+	case "percentile":
+		return percentileValue(args, values)
+	case "sum", "mean", "max", "min":
+	default:
+		return nil, fmt.Errorf("unsupported aggregation %s", aggr)
+	}
+	if len(values) == 0 {
+		return nil, nil
+	}
+
+	isInt := true
+	ints := make([]int64, len(values))
+	floats := make([]float64, len(values))
+	for i, v := range values {
+		n, ok := v.(json.Number)
+		if !ok {
+			return nil, fmt.Errorf("%s is not supported for value %v", aggr, v)
+		}
+		if iv, err := n.Int64(); err == nil {
+			ints[i], floats[i] = iv, float64(iv)
+			continue
+		}
+		fv, err := n.Float64()
+		if err != nil {
+			return nil, err
+		}
+		isInt, floats[i] = false, fv
+	}
+
+	if isInt && aggr != "mean" {
+		r := ints[0]
+		for _, v := range ints[1:] {
+			switch aggr {
+			case "sum":
+				r += v
+			case "max":
+				if v > r {
+					r = v
+				}
+			case "min":
+				if v < r {
+					r = v
+				}
+			}
+		}
+		return json.Number(strconv.FormatInt(r, 10)), nil
+	}
+
+	r := floats[0]
+	for _, v := range floats[1:] {
+		switch aggr {
+		case "sum", "mean":
+			r += v
+		case "max":
+			r = math.Max(r, v)
+		case "min":
+			r = math.Min(r, v)
+		}
+	}
+	if aggr == "mean" {
+		r /= float64(len(floats))
+	}
+	return json.Number(jsonFloat(r)), nil
+}
+
+// percentileValue 和数据库的 PERCENTILE 相同：按从小到大的顺序取第 round(n*p/100) 个值，保持原来的数据类型，
+// 位置超出范围时为空
+func percentileValue(args []string, values []interface{}) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("percentile needs one argument, got %d", len(args))
+	}
+	p, err := strconv.ParseFloat(args[0], 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid percentile %s: %w", args[0], err)
+	}
+
+	floats := make([]float64, len(values))
+	for i, v := range values {
+		n, ok := v.(json.Number)
+		if !ok {
+			return nil, fmt.Errorf("percentile is not supported for value %v", v)
+		}
+		if floats[i], err = n.Float64(); err != nil {
+			return nil, err
+		}
+	}
+	order := make([]int, len(values))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return floats[order[i]] < floats[order[j]] })
+
+	i := int(math.Floor(float64(len(values))*p/100+0.5)) - 1
+	if i < 0 || i >= len(values) {
+		return nil, nil
+	}
+	return values[order[i]], nil
+}
+
+// timestampOf 返回结果中时间戳的纳秒值，时间戳可以是 RFC3339 字符串或 json.Number
+func timestampOf(v interface{}) (int64, bool) {
+	switch ts := v.(type) {
+	case string:
+		return parseTimeString(ts)
+	case json.Number:
+		n, err := ts.Int64()
+		return n, err == nil
+	default:
+		return 0, false
+	}
+}
+
+// timestampLike 把纳秒时间戳转换成和 sample 相同的表示方式
+func timestampLike(sample interface{}, ts int64) interface{} {
+	if _, ok := sample.(string); ok {
+		return time.Unix(0, ts).UTC().Format(time.RFC3339Nano)
+	}
+	return json.Number(strconv.FormatInt(ts, 10))
+}
+
+// mod 返回非负的余数，让 1970 年之前的时间戳也落在正确的区间
+func mod(a, b int64) int64 {
+	r := a % b
+	if r < 0 {
+		r += b
+	}
+	return r
+}
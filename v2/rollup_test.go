@@ -0,0 +1,131 @@
+package client
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/influxdata/influxdb1-client/models"
+	"github.com/influxdata/influxql"
+)
+
+// rawWaterLevel 原始数据查询的结果，包含整数列 index 和浮点数列 water_level
+func rawWaterLevel() *Response {
+	return &Response{Results: []Result{{Series: []models.Row{SeriesToRow(Series{
+		Name:    "h2o_feet",
+		Tags:    map[string]string{"location": "coyote_creek"},
+		Columns: []string{"time", "index", "water_level"},
+		Values: [][]interface{}{
+			{"2019-08-18T00:00:00Z", json.Number("85"), json.Number("8.12")},
+			{"2019-08-18T00:06:00Z", json.Number("66"), json.Number("8.005")},
+			{"2019-08-18T00:12:00Z", json.Number("78"), json.Number("7.887")},
+			{"2019-08-18T00:18:00Z", json.Number("91"), nil},
+			{"2019-08-18T00:24:00Z", json.Number("29"), json.Number("7.635")},
+		},
+	})}}}}
+}
+
+func TestAggregateResponse(t *testing.T) {
+	tests := []struct {
+		name        string
+		aggregation string
+		interval    time.Duration
+		columns     []string
+		expected    [][]interface{}
+	}{
+		{
+			name:        "max keeps integer type",
+			aggregation: "max",
+			interval:    12 * time.Minute,
+			columns:     []string{"time", "max", "max_1"},
+			expected: [][]interface{}{
+				{"2019-08-18T00:00:00Z", json.Number("85"), json.Number("8.12")},
+				{"2019-08-18T00:12:00Z", json.Number("91"), json.Number("7.887")},
+				{"2019-08-18T00:24:00Z", json.Number("29"), json.Number("7.635")},
+			},
+		},
+		{
+			name:        "mean skips null values",
+			aggregation: "MEAN",
+			interval:    12 * time.Minute,
+			columns:     []string{"time", "mean", "mean_1"},
+			expected: [][]interface{}{
+				{"2019-08-18T00:00:00Z", json.Number("75.5"), json.Number("8.0625")},
+				{"2019-08-18T00:12:00Z", json.Number("84.5"), json.Number("7.887")},
+				{"2019-08-18T00:24:00Z", json.Number("29"), json.Number("7.635")},
+			},
+		},
+		{
+			name:        "count",
+			aggregation: "count",
+			interval:    30 * time.Minute,
+			columns:     []string{"time", "count", "count_1"},
+			expected: [][]interface{}{
+				{"2019-08-18T00:00:00Z", json.Number("5"), json.Number("4")},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := AggregateResponse(rawWaterLevel(), tt.aggregation, tt.interval, influxql.MinTime, influxql.MaxTime)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			s := resp.Results[0].Series[0]
+			if s.Name != "h2o_feet" || s.Tags["location"] != "coyote_creek" {
+				t.Errorf("series:\t%v", s)
+			}
+			if !reflect.DeepEqual(s.Columns, tt.columns) {
+				t.Errorf("columns:\t%v\nexpected:\t%v", s.Columns, tt.columns)
+			}
+			if !reflect.DeepEqual(s.Values, tt.expected) {
+				t.Errorf("values:\t%v\nexpected:\t%v", s.Values, tt.expected)
+			}
+		})
+	}
+
+	/* 和 RollupQuery 的默认 fill(null) 相同，补全查询的时间范围内没有数据的区间 */
+	resp, err := AggregateResponse(rawWaterLevel(), "count", 12*time.Minute, 1566086400000000000, 1566089100000000000)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := [][]interface{}{
+		{"2019-08-18T00:00:00Z", json.Number("2"), json.Number("2")},
+		{"2019-08-18T00:12:00Z", json.Number("2"), json.Number("1")},
+		{"2019-08-18T00:24:00Z", json.Number("1"), json.Number("1")},
+		{"2019-08-18T00:36:00Z", json.Number("0"), json.Number("0")},
+	}
+	if values := resp.Results[0].Series[0].Values; !reflect.DeepEqual(values, expected) {
+		t.Errorf("values:\t%v\nexpected:\t%v", values, expected)
+	}
+
+	if _, err := AggregateResponse(rawWaterLevel(), "median", time.Minute, influxql.MinTime, influxql.MaxTime); err == nil {
+		t.Error("expected error for unsupported aggregation")
+	}
+}
+
+func TestRollupQuery(t *testing.T) {
+	queryString := "SELECT index,water_level FROM h2o_feet WHERE time >= '2019-08-18T00:00:00Z' AND time <= '2019-08-18T00:30:00Z' GROUP BY location"
+	rollupQuery, err := RollupQuery(queryString, rawWaterLevel(), Rollup{Aggregation: "max", Interval: 12 * time.Minute})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := "SELECT max(index), max(water_level) FROM h2o_feet WHERE time >= '2019-08-18T00:00:00Z' AND time <= '2019-08-18T00:30:00Z' GROUP BY time(12m), location"
+	if rollupQuery != expected {
+		t.Errorf("rollup query:\t%s\nexpected:\t%s", rollupQuery, expected)
+	}
+
+	/* rollup 查询的语义段和用户直接执行的聚合查询一致 */
+	if aggr := GetAggregation(rollupQuery).Func; aggr != "max" {
+		t.Errorf("aggregation:\t%s\nexpected:\t%s", aggr, "max")
+	}
+	if interval := GetInterval(rollupQuery); interval != "12m" {
+		t.Errorf("interval:\t%s\nexpected:\t%s", interval, "12m")
+	}
+
+	if _, err := RollupQuery("SELECT MAX(index) FROM h2o_feet GROUP BY time(12m)", rawWaterLevel(), Rollup{Aggregation: "max", Interval: time.Minute}); err == nil {
+		t.Error("expected error for aggregated query")
+	}
+}
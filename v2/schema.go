@@ -0,0 +1,412 @@
+package client
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/influxdata/influxdb1-client/models"
+	"github.com/influxdata/influxql"
+)
+
+// SeriesKey identifies one series of a measurement.
+type SeriesKey struct {
+	Measurement string
+	Tags        map[string]string
+}
+
+// FieldKey is a field of a measurement and its data type, one of float,
+// integer, string or boolean.
+type FieldKey struct {
+	Name string
+	Type string
+}
+
+// ShowMeasurements lists the measurements of the database.
+func ShowMeasurements(c Client, database string) ([]string, error) {
+	resp, err := execute(c, "SHOW MEASUREMENTS ON "+influxql.QuoteIdent(database), database)
+	if err != nil {
+		return nil, err
+	}
+	measurements := make([]string, 0)
+	for _, r := range rows(resp) {
+		if name, ok := r.values[0].(string); ok {
+			measurements = append(measurements, name)
+		}
+	}
+	return measurements, nil
+}
+
+// ShowSeries lists the series of the database, or only those of measurement
+// if it is not empty.
+func ShowSeries(c Client, database, measurement string) ([]SeriesKey, error) {
+	command := "SHOW SERIES ON " + influxql.QuoteIdent(database)
+	if measurement != "" {
+		command += " FROM " + influxql.QuoteIdent(measurement)
+	}
+	resp, err := execute(c, command, database)
+	if err != nil {
+		return nil, err
+	}
+	series := make([]SeriesKey, 0)
+	for _, r := range rows(resp) {
+		key, ok := r.values[0].(string)
+		if !ok {
+			continue
+		}
+		name, tags := models.ParseKey([]byte(key))
+		series = append(series, SeriesKey{Measurement: name, Tags: tags.Map()})
+	}
+	return series, nil
+}
+
+// ShowTagKeys returns the tag keys of every measurement in the database.
+// The result is cached for MetadataTTL.TagKeys.
+func ShowTagKeys(c Client, database string) (map[string][]string, error) {
+	resp, err := executeMetadata(c, "SHOW TAG KEYS ON "+influxql.QuoteIdent(database), database, MetadataTTL.TagKeys)
+	if err != nil {
+		return nil, err
+	}
+	tagKeys := make(map[string][]string)
+	for _, r := range rows(resp) {
+		key, ok := r.values[0].(string)
+		if !ok {
+			return nil, fmt.Errorf("tag key of %s: unexpected value %v", r.name, r.values[0])
+		}
+		tagKeys[r.name] = append(tagKeys[r.name], key)
+	}
+	return tagKeys, nil
+}
+
+// ShowTagValues returns the values of the tag key in measurement. The
+// result is cached for MetadataTTL.TagValues.
+func ShowTagValues(c Client, database, measurement, key string) ([]string, error) {
+	command := fmt.Sprintf("SHOW TAG VALUES ON %s FROM %s WITH KEY = %s",
+		influxql.QuoteIdent(database), influxql.QuoteIdent(measurement), influxql.QuoteIdent(key))
+	resp, err := executeMetadata(c, command, database, MetadataTTL.TagValues)
+	if err != nil {
+		return nil, err
+	}
+	values := make([]string, 0)
+	for _, r := range rows(resp) {
+		// Columns are "key" and "value".
+		if v, ok := r.values[len(r.values)-1].(string); ok {
+			values = append(values, v)
+		}
+	}
+	return values, nil
+}
+
+// ShowFieldKeys returns the fields of every measurement in the database.
+// The result is cached for MetadataTTL.FieldKeys.
+func ShowFieldKeys(c Client, database string) (map[string][]FieldKey, error) {
+	resp, err := executeMetadata(c, "SHOW FIELD KEYS ON "+influxql.QuoteIdent(database), database, MetadataTTL.FieldKeys)
+	if err != nil {
+		return nil, err
+	}
+	fieldKeys := make(map[string][]FieldKey)
+	for _, r := range rows(resp) {
+		var field FieldKey
+		for i, column := range r.columns {
+			switch column {
+			case "fieldKey":
+				field.Name, _ = r.values[i].(string)
+			case "fieldType":
+				field.Type, _ = r.values[i].(string)
+			}
+		}
+		if field.Name == "" {
+			return nil, fmt.Errorf("field key of %s: unexpected row %v", r.name, r.values)
+		}
+		fieldKeys[r.name] = append(fieldKeys[r.name], field)
+	}
+	return fieldKeys, nil
+}
+
+// LoadSchema reloads the schema snapshot returned by CurrentSchema from the
+// database. Readers keep the previous snapshot until the new one is complete.
+func LoadSchema(c Client, database string) error {
+	fieldKeys, err := ShowFieldKeys(c, database)
+	if err != nil {
+		return err
+	}
+	tagKV, err := loadTagKV(c, database)
+	if err != nil {
+		return err
+	}
+	SetSchema(&Schema{TagKV: tagKV, Fields: fieldNames(fieldKeys), FieldTypes: fieldTypes(fieldKeys)})
+	return nil
+}
+
+// fieldTypes converts the InfluxDB field types into the data types used in
+// semantic segments, the form stored in Schema.FieldTypes.
+func fieldTypes(fieldKeys map[string][]FieldKey) map[string]map[string]string {
+	typeMap := make(map[string]map[string]string)
+	for measurement, fields := range fieldKeys {
+		types := make(map[string]string, len(fields))
+		for _, f := range fields {
+			switch f.Type {
+			case "float":
+				types[f.Name] = "float64"
+			case "integer", "unsigned":
+				types[f.Name] = "int64"
+			case "string":
+				types[f.Name] = "string"
+			case "boolean":
+				types[f.Name] = "bool"
+			}
+		}
+		typeMap[measurement] = types
+	}
+	return typeMap
+}
+
+// fieldNames keeps only the names of the fields, the form stored in Schema.Fields.
+func fieldNames(fieldKeys map[string][]FieldKey) map[string][]string {
+	fieldMap := make(map[string][]string)
+	for measurement, fields := range fieldKeys {
+		names := make([]string, 0, len(fields))
+		for _, f := range fields {
+			names = append(names, f.Name)
+		}
+		fieldMap[measurement] = names
+	}
+	return fieldMap
+}
+
+// loadTagKV collects the values of every tag key of every measurement.
+func loadTagKV(c Client, database string) (MeasurementTagMap, error) {
+	measurementTagMap := MeasurementTagMap{Measurement: make(map[string][]TagKeyMap)}
+	tagKeys, err := ShowTagKeys(c, database)
+	if err != nil {
+		return measurementTagMap, err
+	}
+	for measurement, keys := range tagKeys {
+		for _, key := range keys {
+			values, err := ShowTagValues(c, database, measurement, key)
+			if err != nil {
+				return measurementTagMap, err
+			}
+			tagKeyMap := TagKeyMap{Tag: map[string]TagValues{key: {Values: values}}}
+			measurementTagMap.Measurement[measurement] = append(measurementTagMap.Measurement[measurement], tagKeyMap)
+		}
+	}
+	return measurementTagMap, nil
+}
+
+// schemaFieldMapper resolves field and tag names against the current schema
+// snapshot, so wildcards and type selectors can be
+// expanded without querying the database. Fields of unknown type map to
+// AnyField.
+type schemaFieldMapper struct{}
+
+// influxqlTypes maps the data types in Schema.FieldTypes to influxql data types.
+var influxqlTypes = map[string]influxql.DataType{
+	"float64": influxql.Float,
+	"int64":   influxql.Integer,
+	"string":  influxql.String,
+	"bool":    influxql.Boolean,
+}
+
+func (schemaFieldMapper) FieldDimensions(m *influxql.Measurement) (map[string]influxql.DataType, map[string]struct{}, error) {
+	schema := CurrentSchema()
+	fields := make(map[string]influxql.DataType)
+	for _, name := range schema.Fields[m.Name] {
+		fields[name] = influxql.AnyField
+		if typ, ok := influxqlTypes[schema.FieldTypes[m.Name][name]]; ok {
+			fields[name] = typ
+		}
+	}
+	dimensions := make(map[string]struct{})
+	for _, tkm := range schema.TagKV.Measurement[m.Name] {
+		for key := range tkm.Tag {
+			if _, ok := fields[key]; !ok {
+				dimensions[key] = struct{}{}
+			}
+		}
+	}
+	return fields, dimensions, nil
+}
+
+func (schemaFieldMapper) MapType(m *influxql.Measurement, field string) influxql.DataType {
+	schema := CurrentSchema()
+	for _, name := range schema.Fields[m.Name] {
+		if name == field {
+			if typ, ok := influxqlTypes[schema.FieldTypes[m.Name][name]]; ok {
+				return typ
+			}
+			return influxql.AnyField
+		}
+	}
+	for _, tkm := range schema.TagKV.Measurement[m.Name] {
+		if _, ok := tkm.Tag[field]; ok {
+			return influxql.Tag
+		}
+	}
+	return influxql.Unknown
+}
+
+func (schemaFieldMapper) CallType(name string, args []influxql.DataType) (influxql.DataType, error) {
+	return influxql.Unknown, nil
+}
+
+// GetSMFromQuery derives the SM part of the semantic segment of queryString
+// from the query and the tag values of schema, without a query result. Every
+// combination of values of the GROUP BY tags that the tag predicates do not
+// exclude is one table, so the SM is the one GetSM builds from the result
+// when the database has data for every combination. It gives the cache key
+// of a query that has never been executed, as needed for cache-only serving
+// and negative caching.
+//
+// Predicates "tag=value" on a GROUP BY tag keep only the listed values and
+// "tag!=value" removes one; other predicates on tags are kept in every table
+// like GetSM does. An SM of "{empty}" means no combination is left.
+func GetSMFromQuery(queryString string, schema MeasurementTagMap) (string, error) {
+	stmt, err := influxql.ParseStatement(queryString)
+	if err != nil {
+		return "", err
+	}
+	s, ok := stmt.(*influxql.SelectStatement)
+	if !ok {
+		return "", fmt.Errorf("%w: not a SELECT statement: %s", ErrUnsupportedQuery, queryString)
+	}
+	if len(s.Sources) != 1 {
+		return "", fmt.Errorf("%w: query must select from one measurement: %s", ErrUnsupportedQuery, queryString)
+	}
+	m, ok := s.Sources[0].(*influxql.Measurement)
+	if !ok || m.Regex != nil {
+		return "", fmt.Errorf("%w: query must select from one measurement: %s", ErrUnsupportedQuery, queryString)
+	}
+	measurement := m.Name
+	tagValues, ok := schemaTagValues(schema, measurement)
+	if !ok {
+		return "", fmt.Errorf("measurement %s is not in the schema", measurement)
+	}
+
+	/* GROUP BY tags, sorted like GetTagNameArr */
+	keys := make([]string, 0)
+	for _, d := range s.Dimensions {
+		switch expr := d.Expr.(type) {
+		case *influxql.VarRef:
+			if _, ok := tagValues[expr.Val]; !ok {
+				return "", fmt.Errorf("tag %s of measurement %s is not in the schema", expr.Val, measurement)
+			}
+			keys = append(keys, expr.Val)
+		case *influxql.Wildcard:
+			for key := range tagValues {
+				keys = append(keys, key)
+			}
+		}
+	}
+	sort.Strings(keys)
+	keys = slices.Compact(keys)
+
+	/* predicates on GROUP BY tags select the values, the others are part of every table */
+	_, tagPredicates := getSP(queryString, measurement, schema)
+	equal := make(map[string]map[string]bool)
+	notEqual := make(map[string]map[string]bool)
+	tagPre := make([]string, 0)
+	for _, p := range tagPredicates {
+		key, op, value := splitTagPredicate(p)
+		key, value = unescapeSegment(key), unescapeSegment(value)
+		if !slices.Contains(keys, key) {
+			tagPre = append(tagPre, p)
+			continue
+		}
+		switch op {
+		case "=":
+			if equal[key] == nil {
+				equal[key] = make(map[string]bool)
+			}
+			equal[key][value] = true
+		case "!=":
+			if notEqual[key] == nil {
+				notEqual[key] = make(map[string]bool)
+			}
+			notEqual[key][value] = true
+		}
+	}
+
+	name := escapeMeasurement(measurement)
+	if len(keys) == 0 {
+		if len(tagPre) == 0 {
+			return fmt.Sprintf("{(%s.empty)}", name), nil
+		}
+		for i, p := range tagPre {
+			tagPre[i] = fmt.Sprintf("%s.%s", name, p)
+		}
+		return fmt.Sprintf("{(%s)}", strings.Join(tagPre, ",")), nil
+	}
+
+	/* every combination of the selected values, in the order of SortSeries */
+	combinations := []map[string]string{{}}
+	for _, key := range keys {
+		next := make([]map[string]string, 0)
+		for _, value := range tagValues[key] {
+			if (equal[key] != nil && !equal[key][value]) || notEqual[key][value] {
+				continue
+			}
+			for _, c := range combinations {
+				tags := make(map[string]string, len(c)+1)
+				for k, v := range c {
+					tags[k] = v
+				}
+				tags[key] = value
+				next = append(next, tags)
+			}
+		}
+		combinations = next
+	}
+	if len(combinations) == 0 {
+		return "{empty}", nil
+	}
+	sort.Slice(combinations, func(i, j int) bool {
+		return TagsMapToString(combinations[i]) < TagsMapToString(combinations[j])
+	})
+
+	var sm strings.Builder
+	sm.WriteString("{")
+	for _, tags := range combinations {
+		table := make([]string, 0, len(keys)+len(tagPre))
+		for _, key := range keys {
+			table = append(table, fmt.Sprintf("%s.%s=%s", name, escapeSM(key), escapeSM(tags[key])))
+		}
+		for _, p := range tagPre {
+			table = append(table, fmt.Sprintf("%s.%s", name, p))
+		}
+		sort.Strings(table)
+		sm.WriteString("(" + strings.Join(table, ",") + ")")
+	}
+	sm.WriteString("}")
+	return sm.String(), nil
+}
+
+// schemaTagValues returns the values of every tag of measurement in schema.
+func schemaTagValues(schema MeasurementTagMap, measurement string) (map[string][]string, bool) {
+	tagKeyMaps, ok := schema.Measurement[measurement]
+	if !ok {
+		return nil, false
+	}
+	values := make(map[string][]string)
+	for _, t := range tagKeyMaps {
+		for key, v := range t.Tag {
+			values[key] = append(values[key], v.Values...)
+		}
+	}
+	return values, true
+}
+
+// splitTagPredicate splits a tag predicate of GetSP, such as
+// "location!=santa_monica", into the tag, the operator and the value.
+func splitTagPredicate(p string) (key, op, value string) {
+	i := strings.IndexAny(p, "!=<>")
+	if i < 0 {
+		return p, "", ""
+	}
+	j := i
+	for j < len(p) && strings.IndexByte("!=<>~", p[j]) >= 0 {
+		j++
+	}
+	return p[:i], p[i:j], p[j:]
+}
@@ -0,0 +1,171 @@
+package client
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/influxdata/influxdb1-client/models"
+)
+
+// newSchemaServer 按语句返回 NOAA_water_database 中 h2o_feet 的元数据
+func newSchemaServer() *httptest.Server {
+	bodies := map[string]string{
+		"SHOW MEASUREMENTS ON NOAA_water_database":                                 `{"results":[{"statement_id":0,"series":[{"name":"measurements","columns":["name"],"values":[["h2o_feet"],["h2o_quality"]]}]}]}`,
+		"SHOW SERIES ON NOAA_water_database FROM h2o_feet":                         `{"results":[{"statement_id":0,"series":[{"columns":["key"],"values":[["h2o_feet,location=coyote_creek"],["h2o_feet,location=santa_monica"]]}]}]}`,
+		"SHOW TAG KEYS ON NOAA_water_database":                                     `{"results":[{"statement_id":0,"series":[{"name":"h2o_feet","columns":["tagKey"],"values":[["location"]]}]}]}`,
+		"SHOW TAG VALUES ON NOAA_water_database FROM h2o_feet WITH KEY = location": `{"results":[{"statement_id":0,"series":[{"name":"h2o_feet","columns":["key","value"],"values":[["location","coyote_creek"],["location","santa_monica"]]}]}]}`,
+		"SHOW FIELD KEYS ON NOAA_water_database":                                   `{"results":[{"statement_id":0,"series":[{"name":"h2o_feet","columns":["fieldKey","fieldType"],"values":[["level description","string"],["water_level","float"]]}]}]}`,
+	}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := bodies[r.URL.Query().Get("q")]
+		if !ok {
+			body = `{"results":[{"statement_id":0,"error":"unexpected statement"}]}`
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(body))
+	}))
+}
+
+func TestShowMetadata(t *testing.T) {
+	ts := newSchemaServer()
+	defer ts.Close()
+	c, _ := NewHTTPClient(HTTPConfig{Addr: ts.URL})
+	defer c.Close()
+
+	measurements, err := ShowMeasurements(c, MyDB)
+	if err != nil || !reflect.DeepEqual(measurements, []string{"h2o_feet", "h2o_quality"}) {
+		t.Errorf("measurements:\t%v %v", measurements, err)
+	}
+
+	series, err := ShowSeries(c, MyDB, "h2o_feet")
+	expectedSeries := []SeriesKey{
+		{Measurement: "h2o_feet", Tags: map[string]string{"location": "coyote_creek"}},
+		{Measurement: "h2o_feet", Tags: map[string]string{"location": "santa_monica"}},
+	}
+	if err != nil || !reflect.DeepEqual(series, expectedSeries) {
+		t.Errorf("series:\t%v %v\nexpected:\t%v", series, err, expectedSeries)
+	}
+
+	tagKeys, err := ShowTagKeys(c, MyDB)
+	if err != nil || !reflect.DeepEqual(tagKeys, map[string][]string{"h2o_feet": {"location"}}) {
+		t.Errorf("tag keys:\t%v %v", tagKeys, err)
+	}
+
+	values, err := ShowTagValues(c, MyDB, "h2o_feet", "location")
+	if err != nil || !reflect.DeepEqual(values, []string{"coyote_creek", "santa_monica"}) {
+		t.Errorf("tag values:\t%v %v", values, err)
+	}
+
+	fieldKeys, err := ShowFieldKeys(c, MyDB)
+	expectedFields := map[string][]FieldKey{"h2o_feet": {{Name: "level description", Type: "string"}, {Name: "water_level", Type: "float"}}}
+	if err != nil || !reflect.DeepEqual(fieldKeys, expectedFields) {
+		t.Errorf("field keys:\t%v %v\nexpected:\t%v", fieldKeys, err, expectedFields)
+	}
+}
+
+func TestLoadSchema(t *testing.T) {
+	ts := newSchemaServer()
+	defer ts.Close()
+	c, _ := NewHTTPClient(HTTPConfig{Addr: ts.URL})
+	defer c.Close()
+
+	defer SetSchema(CurrentSchema())
+
+	if err := LoadSchema(c, MyDB); err != nil {
+		t.Fatal(err)
+	}
+	schema := CurrentSchema()
+	if !reflect.DeepEqual(schema.Fields, map[string][]string{"h2o_feet": {"level description", "water_level"}}) {
+		t.Errorf("fields:\t%v", schema.Fields)
+	}
+	if expected := map[string]map[string]string{"h2o_feet": {"level description": "string", "water_level": "float64"}}; !reflect.DeepEqual(schema.FieldTypes, expected) {
+		t.Errorf("field types:\t%v\nexpected:\t%v", schema.FieldTypes, expected)
+	}
+	expected := MeasurementTagMap{Measurement: map[string][]TagKeyMap{
+		"h2o_feet": {{Tag: map[string]TagValues{"location": {Values: []string{"coyote_creek", "santa_monica"}}}}},
+	}}
+	if !reflect.DeepEqual(schema.TagKV, expected) {
+		t.Errorf("tags:\t%v\nexpected:\t%v", schema.TagKV, expected)
+	}
+	if !reflect.DeepEqual(GetTagKV(c, MyDB), expected) {
+		t.Errorf("GetTagKV:\t%v", GetTagKV(c, MyDB))
+	}
+}
+
+func TestGetSMFromQuery(t *testing.T) {
+	schema := MeasurementTagMap{Measurement: map[string][]TagKeyMap{
+		"h2o_quality": {{Tag: map[string]TagValues{
+			"location": {Values: []string{"coyote_creek", "santa_monica"}},
+			"randtag":  {Values: []string{"1", "2", "3"}},
+		}}},
+	}}
+	timeRange := "time >= '2019-08-18T00:00:00Z' AND time <= '2019-08-18T00:30:00Z'"
+	tests := []struct {
+		name     string
+		query    string
+		expected string
+	}{
+		{
+			name:     "no tags",
+			query:    "SELECT index FROM h2o_quality WHERE " + timeRange,
+			expected: "{(h2o_quality.empty)}",
+		},
+		{
+			name:     "tag predicate without GROUP BY",
+			query:    "SELECT index FROM h2o_quality WHERE location='coyote_creek' AND " + timeRange,
+			expected: "{(h2o_quality.location=coyote_creek)}",
+		},
+		{
+			name:     "GROUP BY with excluded value",
+			query:    "SELECT index FROM h2o_quality WHERE randtag!='1' AND " + timeRange + " GROUP BY location,randtag",
+			expected: "{(h2o_quality.location=coyote_creek,h2o_quality.randtag=2)(h2o_quality.location=coyote_creek,h2o_quality.randtag=3)(h2o_quality.location=santa_monica,h2o_quality.randtag=2)(h2o_quality.location=santa_monica,h2o_quality.randtag=3)}",
+		},
+		{
+			name:     "GROUP BY with predicate on another tag",
+			query:    "SELECT index FROM h2o_quality WHERE location='santa_monica' AND " + timeRange + " GROUP BY randtag",
+			expected: "{(h2o_quality.location=santa_monica,h2o_quality.randtag=1)(h2o_quality.location=santa_monica,h2o_quality.randtag=2)(h2o_quality.location=santa_monica,h2o_quality.randtag=3)}",
+		},
+		{
+			name:     "GROUP BY with every value excluded",
+			query:    "SELECT index FROM h2o_quality WHERE location='santa_fe' AND " + timeRange + " GROUP BY location",
+			expected: "{empty}",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sm, err := GetSMFromQuery(tt.query, schema)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if sm != tt.expected {
+				t.Errorf("SM:\t%s\nexpected:\t%s", sm, tt.expected)
+			}
+		})
+	}
+
+	/* 和用查询结果生成的SM相同 */
+	query := tests[2].query
+	series := make([]models.Row, 0)
+	for _, location := range []string{"coyote_creek", "santa_monica"} {
+		for _, randtag := range []string{"2", "3"} {
+			series = append(series, models.Row{Name: "h2o_quality", Tags: map[string]string{"location": location, "randtag": randtag},
+				Columns: []string{"time", "index"}, Values: [][]interface{}{{json.Number("1"), json.Number("41")}}})
+		}
+	}
+	resp := &Response{Results: []Result{{Series: series}}}
+	_, tagPredicates := GetSP(query, resp, schema)
+	if sm := GetSM(resp, tagPredicates); sm != tests[2].expected {
+		t.Errorf("SM from result:\t%s\nexpected:\t%s", sm, tests[2].expected)
+	}
+
+	if _, err := GetSMFromQuery("SELECT index FROM h2o_feet", schema); err == nil {
+		t.Errorf("measurement not in the schema should be an error")
+	}
+	if _, err := GetSMFromQuery("SELECT index FROM h2o_quality GROUP BY level", schema); err == nil {
+		t.Errorf("tag not in the schema should be an error")
+	}
+}
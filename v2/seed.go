@@ -0,0 +1,209 @@
+package client
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"time"
+)
+
+// DefaultSeedBatchSize is the number of points per BatchPoints when
+// SeedConfig.BatchSize is not set.
+const DefaultSeedBatchSize = 5000
+
+// SeedMeasurements lists the measurements Seed generates: those of
+// NOAA_water_database, which the tests and examples query, and a telegraf
+// style cpu measurement.
+var SeedMeasurements = []string{"h2o_feet", "h2o_quality", "h2o_pH", "h2o_temperature", "average_temperature", "cpu"}
+
+// SeedConfig is the config data needed to generate synthetic data with Seed.
+type SeedConfig struct {
+	// Database is the database to write points to. It is created if it
+	// does not exist.
+	Database string
+
+	// RetentionPolicy is the retention policy of the points, optional.
+	RetentionPolicy string
+
+	// Measurements are the measurements to generate, defaults to
+	// SeedMeasurements.
+	Measurements []string
+
+	// Locations is the number of values of the location tag, defaults to 2:
+	// coyote_creek and santa_monica, followed by location_3 and so on.
+	Locations int
+
+	// Hosts is the number of values of the host tag of cpu, defaults to 4.
+	Hosts int
+
+	// Start, Span and Interval set the timestamps of the points: one point
+	// per series every Interval in [Start, Start+Span). They default to
+	// 2019-08-17T00:00:00Z, one day and 6 minutes, like NOAA_water_database.
+	Start    time.Time
+	Span     time.Duration
+	Interval time.Duration
+
+	// BatchSize is the maximum number of points in a single BatchPoints,
+	// defaults to DefaultSeedBatchSize.
+	BatchSize int
+
+	// Seed is the seed of the random values; the same config generates the
+	// same points.
+	Seed int64
+}
+
+// seedSeries is one series of a generated measurement.
+type seedSeries struct {
+	measurement string
+	tags        map[string]string
+	fields      func(rng *rand.Rand, step int) map[string]interface{}
+}
+
+// seedLocation is the value of the location tag of the i-th location.
+func seedLocation(i int) string {
+	switch i {
+	case 0:
+		return "coyote_creek"
+	case 1:
+		return "santa_monica"
+	}
+	return "location_" + strconv.Itoa(i+1)
+}
+
+// waterLevelDescription describes a water level like NOAA_water_database.
+func waterLevelDescription(level float64) string {
+	switch {
+	case level < 3:
+		return "below 3 feet"
+	case level < 6:
+		return "between 3 and 6 feet"
+	case level < 9:
+		return "between 6 and 9 feet"
+	}
+	return "at or greater than 9 feet"
+}
+
+// seedSeriesOf returns the series of measurement for the config.
+func seedSeriesOf(measurement string, conf SeedConfig) ([]seedSeries, error) {
+	series := make([]seedSeries, 0)
+	if measurement == "cpu" {
+		for i := 0; i < conf.Hosts; i++ {
+			tags := map[string]string{"host": fmt.Sprintf("server%02d", i+1), "region": []string{"us-west", "us-east"}[i%2]}
+			series = append(series, seedSeries{measurement, tags, func(rng *rand.Rand, step int) map[string]interface{} {
+				user := math.Round(rng.Float64()*600) / 10
+				system := math.Round(rng.Float64()*(1000-user*10)/2) / 10
+				return map[string]interface{}{"usage_user": user, "usage_system": system, "usage_idle": math.Round((100-user-system)*10) / 10}
+			}})
+		}
+		return series, nil
+	}
+
+	for i := 0; i < conf.Locations; i++ {
+		location := seedLocation(i)
+		phase := float64(i)
+		switch measurement {
+		case "h2o_feet":
+			series = append(series, seedSeries{measurement, map[string]string{"location": location}, func(rng *rand.Rand, step int) map[string]interface{} {
+				level := math.Round((4.5+4*math.Sin(float64(step)/40+phase)+rng.Float64()/2)*1000) / 1000
+				return map[string]interface{}{"water_level": level, "level description": waterLevelDescription(level)}
+			}})
+		case "h2o_quality":
+			for randtag := 1; randtag <= 3; randtag++ {
+				series = append(series, seedSeries{measurement, map[string]string{"location": location, "randtag": strconv.Itoa(randtag)}, func(rng *rand.Rand, step int) map[string]interface{} {
+					return map[string]interface{}{"index": int64(rng.Intn(100))}
+				}})
+			}
+		case "h2o_pH":
+			series = append(series, seedSeries{measurement, map[string]string{"location": location}, func(rng *rand.Rand, step int) map[string]interface{} {
+				return map[string]interface{}{"pH": int64(6 + rng.Intn(3))}
+			}})
+		case "h2o_temperature", "average_temperature":
+			series = append(series, seedSeries{measurement, map[string]string{"location": location}, func(rng *rand.Rand, step int) map[string]interface{} {
+				return map[string]interface{}{"degrees": int64(60 + rng.Intn(20))}
+			}})
+		default:
+			return nil, fmt.Errorf("seed: unknown measurement %q", measurement)
+		}
+	}
+	return series, nil
+}
+
+// withDefaults fills in the unset fields of conf.
+func (conf SeedConfig) withDefaults() SeedConfig {
+	if len(conf.Measurements) == 0 {
+		conf.Measurements = SeedMeasurements
+	}
+	if conf.Locations <= 0 {
+		conf.Locations = 2
+	}
+	if conf.Hosts <= 0 {
+		conf.Hosts = 4
+	}
+	if conf.Start.IsZero() {
+		conf.Start = time.Date(2019, 8, 17, 0, 0, 0, 0, time.UTC)
+	}
+	if conf.Span <= 0 {
+		conf.Span = 24 * time.Hour
+	}
+	if conf.Interval <= 0 {
+		conf.Interval = 6 * time.Minute
+	}
+	if conf.BatchSize <= 0 {
+		conf.BatchSize = DefaultSeedBatchSize
+	}
+	return conf
+}
+
+// Seed creates conf.Database and writes synthetic points of the configured
+// measurements through c in batches of conf.BatchSize points, in time order.
+// It stops at the first failed batch and returns how many points were
+// written before it.
+func Seed(c Client, conf SeedConfig) (written int, err error) {
+	conf = conf.withDefaults()
+	series := make([]seedSeries, 0)
+	for _, m := range conf.Measurements {
+		s, err := seedSeriesOf(m, conf)
+		if err != nil {
+			return 0, err
+		}
+		series = append(series, s...)
+	}
+	if err := CreateDatabase(c, conf.Database); err != nil {
+		return 0, fmt.Errorf("seed: %w", err)
+	}
+
+	rng := rand.New(rand.NewSource(conf.Seed))
+	bpConf := BatchPointsConfig{Database: conf.Database, RetentionPolicy: conf.RetentionPolicy}
+	bp, _ := NewBatchPoints(bpConf)
+	flush := func() error {
+		n := len(bp.Points())
+		if n == 0 {
+			return nil
+		}
+		if err := c.Write(bp); err != nil {
+			return fmt.Errorf("seed: write %d points: %w", n, err)
+		}
+		written += n
+		bp, _ = NewBatchPoints(bpConf)
+		return nil
+	}
+
+	steps := int((conf.Span + conf.Interval - 1) / conf.Interval)
+	for step := 0; step < steps; step++ {
+		ts := conf.Start.Add(time.Duration(step) * conf.Interval)
+		for _, s := range series {
+			pt, err := NewPoint(s.measurement, s.tags, s.fields(rng, step), ts)
+			if err != nil {
+				return written, fmt.Errorf("seed: %w", err)
+			}
+			bp.AddPoint(pt)
+			if len(bp.Points()) >= conf.BatchSize {
+				if err := flush(); err != nil {
+					return written, err
+				}
+			}
+		}
+	}
+	return written, flush()
+}
@@ -0,0 +1,81 @@
+package client
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSeed(t *testing.T) {
+	var mu sync.Mutex
+	var commands []string
+	var batches []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.URL.Path == "/query" {
+			commands = append(commands, r.FormValue("q"))
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"results":[{"statement_id":0}]}`))
+			return
+		}
+		var body bytes.Buffer
+		io.Copy(&body, r.Body)
+		batches = append(batches, body.String())
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+	c, _ := NewHTTPClient(HTTPConfig{Addr: ts.URL})
+	defer c.Close()
+
+	conf := SeedConfig{
+		Database:     "seeded",
+		Measurements: []string{"h2o_feet", "h2o_quality", "cpu"},
+		Locations:    3,
+		Hosts:        2,
+		Span:         time.Hour,
+		BatchSize:    40,
+	}
+	written, err := Seed(c, conf)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	/* 10 个时间点，每个时间点 3 + 3*3 + 2 个 series */
+	if written != 10*14 {
+		t.Errorf("written:\t%d\nexpected:\t%d", written, 10*14)
+	}
+	if len(commands) != 1 || commands[0] != "CREATE DATABASE seeded" {
+		t.Errorf("commands:\t%v", commands)
+	}
+	lines := strings.Split(strings.TrimSpace(strings.Join(batches, "")), "\n")
+	if len(batches) != 4 || len(lines) != written {
+		t.Errorf("batches:\t%d lines:\t%d", len(batches), len(lines))
+	}
+	expectedFirst := "h2o_feet,location=coyote_creek level\\ description=\"between 3 and 6 feet\",water_level="
+	if !strings.HasPrefix(lines[0], expectedFirst) || !strings.HasSuffix(lines[0], " 1566000000000000000") {
+		t.Errorf("first line:\t%s", lines[0])
+	}
+	if !strings.HasPrefix(lines[len(lines)-1], "cpu,host=server02,region=us-east ") {
+		t.Errorf("last line:\t%s", lines[len(lines)-1])
+	}
+
+	/* 相同的配置生成相同的数据 */
+	first := strings.Join(batches, "")
+	batches = nil
+	if _, err := Seed(c, conf); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Join(batches, "") != first {
+		t.Error("the same config generated different points")
+	}
+
+	if _, err := Seed(c, SeedConfig{Database: "seeded", Measurements: []string{"disk"}}); err == nil {
+		t.Error("expected error for unknown measurement")
+	}
+}
@@ -0,0 +1,205 @@
+package client
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/influxdata/influxql"
+)
+
+// SegmentMemo 记录查询模板到语义段中 SF、SP、SG 的映射，同一个模板的查询（只有时间范围不同，比如定时刷新的仪表盘）
+// 不再重复用正则和解析器处理查询语句。SM 由结果中的 tag 决定，每次都重新生成。
+// SP 和 SF 依赖 TagKV 和 Fields，修改它们之后需要调用 Reset
+type SegmentMemo struct {
+	limit int
+
+	mu      sync.Mutex
+	entries map[string]*segmentEntry
+	tick    uint64 // 每次访问加一，用来找出最久没有访问的模板
+	bytes   int64  // 记录的模板大约占用的字节数
+	hits    uint64
+	misses  uint64
+}
+
+// SegmentMemoStats 是语义段缓存的计数
+type SegmentMemoStats struct {
+	Entries int    // 记录的模板数
+	Bytes   int64  // 记录的模板大约占用的字节数，见 MemoryUsage
+	Hits    uint64 // 命中的次数
+	Misses  uint64 // 重新生成的次数
+}
+
+type segmentEntry struct {
+	sf, sp, sg    string
+	tagPredicates []string
+	interval      string
+	used          uint64
+	size          int64 // key 和各部分的字节数
+}
+
+// segmentEntryOverhead 估计一个模板除了字符串内容之外占用的字节数：map 的项、结构体和字符串头
+const segmentEntryOverhead = 160
+
+// Segments 不为 nil 时，SemanticSegment 和 SeperateSemanticSegment 用它缓存同一个模板的 SF、SP、SG
+var Segments *SegmentMemo
+
+// NewSegmentMemo 创建最多记录 limit 个模板的语义段缓存，超过时丢弃最久没有访问的，limit 不大于 0 时为 1024
+func NewSegmentMemo(limit int) *SegmentMemo {
+	if limit <= 0 {
+		limit = 1024
+	}
+	return &SegmentMemo{limit: limit, entries: make(map[string]*segmentEntry)}
+}
+
+// Stats 返回语义段缓存的计数
+func (m *SegmentMemo) Stats() SegmentMemoStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return SegmentMemoStats{Entries: len(m.entries), Bytes: m.bytes, Hits: m.hits, Misses: m.misses}
+}
+
+// Reset 清空记录的模板
+func (m *SegmentMemo) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.entries = make(map[string]*segmentEntry)
+	m.bytes = 0
+}
+
+func (m *SegmentMemo) get(key string) (*segmentEntry, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.tick++
+	e, ok := m.entries[key]
+	if !ok {
+		m.misses++
+		return nil, false
+	}
+	m.hits++
+	e.used = m.tick
+	return e, true
+}
+
+func (m *SegmentMemo) put(key string, e *segmentEntry) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if old, ok := m.entries[key]; ok {
+		m.bytes -= old.size
+	} else if len(m.entries) >= m.limit {
+		m.evict()
+	}
+	m.tick++
+	e.used = m.tick
+	e.size = int64(segmentEntryOverhead + 2*len(key) + len(e.sf) + len(e.sp) + len(e.sg) + len(e.interval))
+	for _, p := range e.tagPredicates {
+		e.size += int64(16 + len(p))
+	}
+	m.entries[key] = e
+	m.bytes += e.size
+}
+
+// shrink 丢弃最久没有访问的模板，直到占用的字节数不超过 target，返回丢弃的模板数
+func (m *SegmentMemo) shrink(target int64) uint64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	evicted := uint64(0)
+	for m.bytes > target && len(m.entries) > 0 {
+		m.evict()
+		evicted++
+	}
+	return evicted
+}
+
+// evict 丢弃最久没有访问的模板
+func (m *SegmentMemo) evict() {
+	var oldest string
+	for key, e := range m.entries {
+		if oldest == "" || e.used < m.entries[oldest].used {
+			oldest = key
+		}
+	}
+	m.bytes -= m.entries[oldest].size
+	delete(m.entries, oldest)
+}
+
+// segmentParts 返回语义段中除 SM 之外的部分，Segments 不为 nil 时先查找同一个模板的结果；
+// 返回的 tagPredicates 是共享的，调用方不能修改
+func segmentParts(queryString string, resp *Response) (sf, sp, sg string, tagPredicates []string, interval string) {
+	var key string
+	if Segments != nil {
+		key = segmentMemoKey(queryString, resp)
+		if key != "" {
+			if e, ok := Segments.get(key); ok {
+				return e.sf, e.sp, e.sg, e.tagPredicates, e.interval
+			}
+		}
+	}
+
+	sf, sg = GetSFSGWithDataType(queryString, resp)
+	sp, tagPredicates = GetSP(queryString, resp, CurrentSchema().TagKV)
+	interval = GetInterval(queryString)
+	if key != "" {
+		Segments.put(key, &segmentEntry{sf: sf, sp: sp, sg: sg, tagPredicates: tagPredicates, interval: interval})
+		enforceMemoryBudget()
+	}
+	return sf, sp, sg, tagPredicates, interval
+}
+
+// segmentMemoKey 返回查询在语义段缓存中的key：时间范围替换成参数的查询语句、SELECT 子句的原文，
+// 以及结果中表的名字、列名和每一列的数据类型；无法解析的查询返回空字符串，不使用缓存
+func segmentMemoKey(queryString string, resp *Response) string {
+	if ResponseIsEmpty(resp) {
+		return ""
+	}
+	template := segmentTemplate(queryString)
+	if template == "" {
+		return ""
+	}
+	/* SF 从 SELECT 子句的原文生成，模板相同时原文仍然可能不同，比如列名是否有双引号 */
+	fields := queryString
+	if idx := strings.Index(strings.ToUpper(queryString), " FROM "); idx >= 0 {
+		fields = queryString[:idx]
+	}
+
+	var b strings.Builder
+	b.WriteString(template)
+	b.WriteString("#")
+	b.WriteString(fields)
+	s := resp.Results[0].Series[0]
+	b.WriteString("#")
+	b.WriteString(s.Name)
+	b.WriteString("#")
+	b.WriteString(strings.Join(s.Columns, ","))
+	b.WriteString("#")
+	b.WriteString(strings.Join(DataTypeArrayFromResponse(resp), ","))
+	return b.String()
+}
+
+// segmentTemplate 和 QueryTemplate 类似，只把时间范围中的常量替换成参数 $v，其他常量和 LIMIT、OFFSET 保持不变，
+// 模板相同的查询的 SF、SP、SG 相同。无法解析或者不是 SELECT 的查询返回空字符串
+func segmentTemplate(queryString string) string {
+	stmt, err := influxql.ParseStatement(queryString)
+	if err != nil {
+		return ""
+	}
+	s, ok := stmt.(*influxql.SelectStatement)
+	if !ok {
+		return ""
+	}
+	if s.Condition != nil {
+		s.Condition = influxql.RewriteExpr(s.Condition, func(e influxql.Expr) influxql.Expr {
+			b, ok := e.(*influxql.BinaryExpr)
+			if !ok {
+				return e
+			}
+			if isTimeRef(b.LHS) {
+				return &influxql.BinaryExpr{Op: b.Op, LHS: b.LHS, RHS: &influxql.BoundParameter{Name: "v"}}
+			}
+			if isTimeRef(b.RHS) {
+				return &influxql.BinaryExpr{Op: b.Op, LHS: &influxql.BoundParameter{Name: "v"}, RHS: b.RHS}
+			}
+			return e
+		})
+	}
+	return s.String()
+}
@@ -0,0 +1,61 @@
+package client
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/influxdata/influxdb1-client/models"
+)
+
+func TestSegmentMemo(t *testing.T) {
+	segments := Segments
+	defer func() { Segments = segments }()
+
+	resp := &Response{Results: []Result{{Series: []models.Row{
+		{Name: "h2o_quality", Tags: map[string]string{"location": "coyote_creek"}, Columns: []string{"time", "index"},
+			Values: [][]interface{}{{json.Number("1566086400000000000"), json.Number("41")}}},
+	}}}}
+	queries := []string{
+		"SELECT index FROM h2o_quality WHERE location='coyote_creek' AND index>50 AND time >= '2019-08-18T00:00:00Z' AND time <= '2019-08-18T00:30:00Z' GROUP BY location",
+		"SELECT index FROM h2o_quality WHERE location='coyote_creek' AND index>50 AND time >= '2019-08-19T00:00:00Z' AND time <= '2019-08-19T00:30:00Z' GROUP BY location",
+		"SELECT index FROM h2o_quality WHERE location='coyote_creek' AND index>60 AND time >= '2019-08-19T00:00:00Z' AND time <= '2019-08-19T00:30:00Z' GROUP BY location",
+	}
+
+	/* 和不使用缓存时生成的语义段相同 */
+	Segments = nil
+	expected := make([]string, 0, len(queries))
+	for _, q := range queries {
+		expected = append(expected, SemanticSegment(q, resp))
+	}
+	Segments = NewSegmentMemo(1)
+	for i, q := range queries {
+		if ss := SemanticSegment(q, resp); ss != expected[i] {
+			t.Errorf("semantic segment:\t%s\nexpected:\t%s", ss, expected[i])
+		}
+		if ss := SeperateSemanticSegment(q, resp); len(ss) != 1 || ss[0] != expected[i] {
+			t.Errorf("seperate semantic segment:\t%v\nexpected:\t%s", ss, expected[i])
+		}
+	}
+
+	/* 只有时间范围不同的查询命中，谓词中的常量不同时是另一个模板，超过上限时丢弃旧的模板 */
+	stats := Segments.Stats()
+	if stats.Entries != 1 || stats.Hits != 4 || stats.Misses != 2 {
+		t.Errorf("stats:\t%+v\nexpected:\t%+v", stats, SegmentMemoStats{Entries: 1, Hits: 4, Misses: 2})
+	}
+	Segments.Reset()
+	if stats := Segments.Stats(); stats.Entries != 0 {
+		t.Errorf("entries:\t%d\nexpected:\t%d", stats.Entries, 0)
+	}
+}
+
+func TestSegmentTemplate(t *testing.T) {
+	a := segmentTemplate("SELECT index FROM h2o_quality WHERE location='coyote_creek' AND time >= '2019-08-18T00:00:00Z' AND time <= now() - 1h LIMIT 5")
+	b := segmentTemplate("SELECT index FROM h2o_quality WHERE location='coyote_creek' AND time >= '2019-08-19T00:00:00Z' AND time <= now() - 2h LIMIT 5")
+	c := segmentTemplate("SELECT index FROM h2o_quality WHERE location='santa_monica' AND time >= '2019-08-19T00:00:00Z' AND time <= now() - 2h LIMIT 5")
+	if a != b || a == c {
+		t.Errorf("templates:\n%s\n%s\n%s", a, b, c)
+	}
+	if segmentTemplate("SHOW DATABASES") != "" {
+		t.Errorf("non-SELECT statement should not have a template")
+	}
+}
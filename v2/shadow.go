@@ -0,0 +1,157 @@
+package client
+
+import (
+	"log"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ShadowConfig 配置影子读取：按比例抽取一部分cache命中，在后台再查询一次数据库并和cache的结果比较，持续验证cache的正确性
+type ShadowConfig struct {
+	Client      Client         // 执行影子查询的数据库连接
+	SampleRate  float64        // 触发影子查询的命中比例，0 到 1
+	Concurrency int            // 同时执行的影子查询数，默认为 1，已满时抽中的命中被跳过
+	Options     CompareOptions // 比较结果时的容差
+	OnMismatch  func(Mismatch) // 发现不一致时调用，默认写日志
+}
+
+// Mismatch 记录一次cache结果和数据库结果不一致
+type Mismatch struct {
+	Query  string
+	Key    string
+	Diff   string // DiffResponses 给出的第一处不同
+	Cached *Response
+	Actual *Response
+}
+
+// ShadowStats 是影子读取的计数
+type ShadowStats struct {
+	Hits       uint64 // 观察到的cache命中数
+	Checked    uint64 // 完成比较的影子查询数
+	Mismatches uint64 // 结果不一致的次数
+	Errors     uint64 // 影子查询失败的次数
+	Skipped    uint64 // 抽中但并发已满而跳过的次数
+}
+
+// ShadowReader 在后台对抽样的cache命中执行影子查询
+type ShadowReader struct {
+	conf ShadowConfig
+	sem  chan struct{} // 限制同时执行的影子查询数
+
+	hits       uint64
+	checked    uint64
+	mismatches uint64
+	errors     uint64
+	skipped    uint64
+
+	mu      sync.Mutex // 保护 rand 和 stopped
+	rand    *rand.Rand
+	stopped bool // Stop 之后不再开始新的影子查询
+	wg      sync.WaitGroup
+}
+
+// Shadow 不为 nil 时，从cache读取的结果都交给它抽样验证
+var Shadow *ShadowReader
+
+// NewShadowReader 创建影子读取器
+func NewShadowReader(conf ShadowConfig) *ShadowReader {
+	if conf.OnMismatch == nil {
+		conf.OnMismatch = func(m Mismatch) {
+			log.Printf("shadow read mismatch: key %s query %q: %s", m.Key, m.Query, m.Diff)
+		}
+	}
+	if conf.Concurrency <= 0 {
+		conf.Concurrency = 1
+	}
+	return &ShadowReader{conf: conf, sem: make(chan struct{}, conf.Concurrency), rand: rand.New(rand.NewSource(time.Now().UnixNano()))}
+}
+
+// ObserveQuery 记录一次 InfluxQL 查询的cache命中，抽中时在后台用同一个 Query 查询数据库并比较，
+// cached 的时间戳精度需要和 query.Precision 相同
+func (sr *ShadowReader) ObserveQuery(query Query, key string, cached *Response) {
+	sr.Observe(query.Command, key, cached, func() (*Response, error) {
+		return sr.conf.Client.Query(query)
+	})
+}
+
+// Observe 记录一次cache命中，抽中时在后台用 fetch 获取数据库的结果并和 cached 比较。
+// cached 属于调用方，返回之前复制一份用于比较，之后调用方可以修改它
+func (sr *ShadowReader) Observe(query, key string, cached *Response, fetch func() (*Response, error)) {
+	atomic.AddUint64(&sr.hits, 1)
+	if !sr.sample() {
+		return
+	}
+	select {
+	case sr.sem <- struct{}{}:
+	default:
+		atomic.AddUint64(&sr.skipped, 1)
+		return
+	}
+	sr.mu.Lock()
+	if sr.stopped {
+		sr.mu.Unlock()
+		<-sr.sem
+		return
+	}
+	sr.wg.Add(1)
+	sr.mu.Unlock()
+
+	cached = NormalizeResponse(cached)
+	go func() {
+		defer func() {
+			<-sr.sem
+			sr.wg.Done()
+		}()
+		actual, err := fetch()
+		if err == nil {
+			err = actual.Error()
+		}
+		if err != nil {
+			atomic.AddUint64(&sr.errors, 1)
+			return
+		}
+		atomic.AddUint64(&sr.checked, 1)
+		if diff := DiffResponses(cached, actual, sr.conf.Options); diff != "" {
+			atomic.AddUint64(&sr.mismatches, 1)
+			sr.conf.OnMismatch(Mismatch{Query: query, Key: key, Diff: diff, Cached: cached, Actual: actual})
+		}
+	}()
+}
+
+func (sr *ShadowReader) sample() bool {
+	if sr.conf.SampleRate <= 0 {
+		return false
+	}
+	if sr.conf.SampleRate >= 1 {
+		return true
+	}
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+	return sr.rand.Float64() < sr.conf.SampleRate
+}
+
+// Stats 返回当前的计数
+func (sr *ShadowReader) Stats() ShadowStats {
+	return ShadowStats{
+		Hits:       atomic.LoadUint64(&sr.hits),
+		Checked:    atomic.LoadUint64(&sr.checked),
+		Mismatches: atomic.LoadUint64(&sr.mismatches),
+		Errors:     atomic.LoadUint64(&sr.errors),
+		Skipped:    atomic.LoadUint64(&sr.skipped),
+	}
+}
+
+// Wait 等待所有正在执行的影子查询完成
+func (sr *ShadowReader) Wait() {
+	sr.wg.Wait()
+}
+
+// Stop 不再开始新的影子查询，并等待正在执行的影子查询完成
+func (sr *ShadowReader) Stop() {
+	sr.mu.Lock()
+	sr.stopped = true
+	sr.mu.Unlock()
+	sr.wg.Wait()
+}
@@ -0,0 +1,96 @@
+package client
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestShadowReader(t *testing.T) {
+	var mu sync.Mutex
+	params := make([]string, 0)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		params = append(params, r.FormValue("db")+","+r.FormValue("epoch"))
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(`{"results":[{"statement_id":0,"series":[{"name":"h2o_feet","tags":{"location":"coyote_creek"},"columns":["time","index","water_level"],"values":[` +
+			`[1566086400000000000,85,8.12],[1566086760000000000,66,8.005],[1566087120000000000,78,7.887],[1566087480000000000,91,null],[1566087840000000000,29,7.635]]}]}]}`))
+	}))
+	defer ts.Close()
+	c, _ := NewHTTPClient(HTTPConfig{Addr: ts.URL})
+	defer c.Close()
+
+	mismatches := make([]Mismatch, 0)
+	sr := NewShadowReader(ShadowConfig{
+		Client:      c,
+		SampleRate:  1,
+		Concurrency: 2,
+		OnMismatch: func(m Mismatch) {
+			mu.Lock()
+			defer mu.Unlock()
+			mismatches = append(mismatches, m)
+		},
+	})
+
+	/* 影子查询使用原查询的数据库和精度 */
+	query := NewQuery("SELECT index,water_level FROM h2o_feet GROUP BY location", "shadow_db", "ns")
+	sr.ObserveQuery(query, "key", rawWaterLevel())
+	stale := rawWaterLevel()
+	stale.Results[0].Series[0].Values = stale.Results[0].Series[0].Values[:4]
+	sr.ObserveQuery(query, "stale key", stale)
+	sr.Wait()
+
+	if len(params) != 2 || params[0] != "shadow_db,ns" || params[1] != "shadow_db,ns" {
+		t.Errorf("db and epoch of shadow queries:\t%v\nexpected:\t%v", params, []string{"shadow_db,ns", "shadow_db,ns"})
+	}
+
+	stats := sr.Stats()
+	if stats.Hits != 2 || stats.Checked != 2 || stats.Mismatches != 1 {
+		t.Errorf("stats:\t%+v", stats)
+	}
+	if len(mismatches) != 1 || mismatches[0].Key != "stale key" || mismatches[0].Diff == "" {
+		t.Errorf("mismatches:\t%+v", mismatches)
+	}
+}
+
+func TestShadowReader_SampleRate(t *testing.T) {
+	sr := NewShadowReader(ShadowConfig{SampleRate: 0})
+	sr.Observe("q", "key", nil, func() (*Response, error) {
+		t.Error("shadow query should not run with sample rate 0")
+		return nil, nil
+	})
+	sr.Wait()
+	if stats := sr.Stats(); stats.Hits != 1 || stats.Checked != 0 {
+		t.Errorf("stats:\t%+v", stats)
+	}
+}
+
+func TestShadowReader_Concurrency(t *testing.T) {
+	release := make(chan struct{})
+	var mismatches int32
+	sr := NewShadowReader(ShadowConfig{SampleRate: 1, OnMismatch: func(Mismatch) { atomic.AddInt32(&mismatches, 1) }})
+
+	/* 并发已满时跳过，调用方在 Observe 返回之后修改结果不影响比较 */
+	cached := rawWaterLevel()
+	for i := 0; i < 3; i++ {
+		sr.Observe("q", "key", cached, func() (*Response, error) {
+			<-release
+			return rawWaterLevel(), nil
+		})
+	}
+	cached.Results[0].Series[0].Values = cached.Results[0].Series[0].Values[:1]
+	cached.Results[0].Series[0].Tags["location"] = "santa_monica"
+	close(release)
+	sr.Wait()
+
+	if stats := sr.Stats(); stats.Hits != 3 || stats.Checked != 1 || stats.Skipped != 2 {
+		t.Errorf("stats:\t%+v", stats)
+	}
+	if n := atomic.LoadInt32(&mismatches); n != 0 {
+		t.Errorf("mismatches:\t%d", n)
+	}
+}
@@ -0,0 +1,52 @@
+package client
+
+import (
+	"context"
+)
+
+// Shutdown closes the client. The package level workers are shared by every
+// client and keep running, they are stopped by StopBackgroundWork.
+func (c *client) Shutdown(ctx context.Context) error {
+	return waitContext(ctx, c.Close)
+}
+
+// shutdownClient shuts c down if it is a Shutdowner and closes it otherwise.
+func shutdownClient(ctx context.Context, c Client) error {
+	if s, ok := c.(Shutdowner); ok {
+		return s.Shutdown(ctx)
+	}
+	return waitContext(ctx, c.Close)
+}
+
+// StopBackgroundWork stops the package level workers started by Set and Get,
+// that is Workload refreshes, Prefetch and Shadow queries, and waits for the
+// running ones. If ctx is done first it returns ctx.Err() and the running
+// work finishes in the background. Clients and the connections to the cache
+// are not closed.
+func StopBackgroundWork(ctx context.Context) error {
+	return waitContext(ctx, func() error {
+		if Workload != nil {
+			Workload.Stop()
+		}
+		if Prefetch != nil {
+			Prefetch.Stop()
+		}
+		if Shadow != nil {
+			Shadow.Stop()
+		}
+		return nil
+	})
+}
+
+// waitContext runs fn and returns its error, or ctx.Err() if ctx is done
+// before fn returns. fn keeps running in the background in that case.
+func waitContext(ctx context.Context, fn func() error) error {
+	done := make(chan error, 1)
+	go func() { done <- fn() }()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,104 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/InfluxDB-client/memcache"
+)
+
+func TestStopBackgroundWork(t *testing.T) {
+	prefetch := Prefetch
+	defer func() { Prefetch = prefetch }()
+
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"results":[{"statement_id":0}]}`))
+	}))
+	defer ts.Close()
+	db, _ := NewHTTPClient(HTTPConfig{Addr: ts.URL})
+	other, _ := NewHTTPClient(HTTPConfig{Addr: ts.URL})
+
+	Prefetch = NewPrefetcher(PrefetchConfig{Client: db, Cache: memcache.New("localhost:0")})
+	queryString := "SELECT index FROM h2o_quality WHERE time >= '2019-08-18T00:00:00Z' AND time <= '2019-08-18T00:30:00Z'"
+	Prefetch.Observe(queryString, "")
+
+	/* 关闭其他客户端不影响包级别的预取 */
+	if err := other.(Shutdowner).Shutdown(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if stats := Prefetch.Stats(); stats.Skipped != 0 {
+		t.Errorf("prefetch stopped by a client shutdown: %+v", stats)
+	}
+
+	/* 预取还在执行，超时返回 */
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := StopBackgroundWork(ctx); err != context.DeadlineExceeded {
+		t.Errorf("error:\t%v\nexpected:\t%v", err, context.DeadlineExceeded)
+	}
+
+	close(release)
+	if err := StopBackgroundWork(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if stats := Prefetch.Stats(); stats.Prefetched+stats.Errors != 1 {
+		t.Errorf("prefetch should be finished: %+v", stats)
+	}
+
+	/* 停止之后不再开始新的预取 */
+	Prefetch.Observe(queryString, "")
+	if stats := Prefetch.Stats(); stats.Skipped != 1 {
+		t.Errorf("skipped:\t%d\nexpected:\t%d", stats.Skipped, 1)
+	}
+	db.Close()
+}
+
+func TestDualWriteClient_Shutdown(t *testing.T) {
+	var primaryWrites, secondaryWrites int32
+	primary := newWriteServer(&primaryWrites, http.StatusNoContent)
+	defer primary.Close()
+	secondary := newWriteServer(&secondaryWrites, http.StatusNoContent)
+	defer secondary.Close()
+
+	p, _ := NewHTTPClient(HTTPConfig{Addr: primary.URL})
+	s, _ := NewHTTPClient(HTTPConfig{Addr: secondary.URL})
+	c, _ := NewDualWriteClient(DualWriteConfig{Primary: p, Secondary: s, Async: true})
+	for i := 0; i < 3; i++ {
+		c.Write(testBatchPoints())
+	}
+
+	/* 队列中的写入都完成之后才返回 */
+	if err := c.(Shutdowner).Shutdown(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n := atomic.LoadInt32(&secondaryWrites); n != 3 {
+		t.Errorf("secondary writes:\t%d\nexpected:\t%d", n, 3)
+	}
+}
+
+func TestUDPClient_Shutdown(t *testing.T) {
+	var logger writeLogger
+	cl := &udpclient{conn: &logger, payloadSize: 512, flushInterval: time.Hour}
+
+	p, _ := NewPoint("cpu", nil, map[string]interface{}{"a": 1}, time.Time{})
+	bp, _ := NewBatchPoints(BatchPointsConfig{})
+	bp.AddPoint(p)
+	cl.Write(bp)
+
+	if err := cl.Shutdown(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(logger.writes) != 1 {
+		t.Errorf("Mismatched write count: got %v, exp %v", len(logger.writes), 1)
+	}
+	if err := cl.Close(); err != nil {
+		t.Errorf("Close after Shutdown should not fail: %v", err)
+	}
+}
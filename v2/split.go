@@ -0,0 +1,83 @@
+package client
+
+import (
+	"sort"
+	"time"
+)
+
+// Interval 是一段闭区间时间范围 [Start, End]，单位为纳秒
+type Interval struct {
+	Start int64
+	End   int64
+}
+
+// SplitOptions 决定 SplitResponseValuesByTime 如何划分查询结果，同时设置多个条件时满足任意一个就开始新的一段
+// 都不设置时不划分
+type SplitOptions struct {
+	Duration time.Duration // 每段覆盖的时间范围，区间按 Duration 对齐，如 1h 时每段都在同一个整点小时内
+	MaxRows  int           // 每段中所有表的数据总行数上限
+	MaxBytes int           // 每段转换成字节数组后数据部分的大小上限，按每行的字节数计算，不包括语义段
+}
+
+// SplitResponseValuesByTime 按时间把查询结果划分成多段，每段包含所有表在这段时间内的数据，可以作为单独的cache item存入，
+// 避免一个item过大；同一时间戳的数据总是在同一段中。返回每段的结果和时间范围，相邻的时间范围首尾相接，覆盖整个结果
+func SplitResponseValuesByTime(resp *Response, opts SplitOptions) ([]*Response, []Interval) {
+	if ResponseIsEmpty(resp) {
+		return []*Response{resp}, nil
+	}
+
+	/* 每个时间戳在所有表中的数据行数 */
+	rowsAt := make(map[int64]int)
+	for _, s := range resp.Results[0].Series {
+		for _, v := range s.Values {
+			ts, _ := timestampOf(v[0])
+			rowsAt[ts]++
+		}
+	}
+	timestamps := make([]int64, 0, len(rowsAt))
+	for ts := range rowsAt {
+		timestamps = append(timestamps, ts)
+	}
+	sort.Slice(timestamps, func(i, j int) bool { return timestamps[i] < timestamps[j] })
+
+	bytesPerLine := BytesPerLine(DataTypeArrayFromResponse(resp))
+
+	/* 确定每段的最后一个时间戳 */
+	ends := make([]int64, 0)
+	rows, bucket := 0, int64(0)
+	for i, ts := range timestamps {
+		n := rowsAt[ts]
+		if i > 0 {
+			split := false
+			if opts.Duration > 0 && ts-mod(ts, int64(opts.Duration)) != bucket {
+				split = true
+			}
+			if opts.MaxRows > 0 && rows+n > opts.MaxRows {
+				split = true
+			}
+			if opts.MaxBytes > 0 && (rows+n)*bytesPerLine > opts.MaxBytes {
+				split = true
+			}
+			if split {
+				ends = append(ends, timestamps[i-1])
+				rows = 0
+			}
+		}
+		if opts.Duration > 0 {
+			bucket = ts - mod(ts, int64(opts.Duration))
+		}
+		rows += n
+	}
+	ends = append(ends, timestamps[len(timestamps)-1])
+
+	responses := make([]*Response, 0, len(ends))
+	intervals := make([]Interval, 0, len(ends))
+	start := timestamps[0]
+	for _, end := range ends {
+		responses = append(responses, TrimResponse(resp, start, end))
+		intervals = append(intervals, Interval{Start: start, End: end})
+		start = end + 1
+	}
+
+	return responses, intervals
+}
@@ -0,0 +1,105 @@
+package client
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/InfluxDB-client/memcache"
+)
+
+func TestSplitResponseValuesByTime(t *testing.T) {
+	const t0 = 1566086400000000000 // 2019-08-18T00:00:00Z
+	minute := int64(time.Minute)
+
+	tests := []struct {
+		name      string
+		opts      SplitOptions
+		rows      []int
+		intervals []Interval
+	}{
+		{
+			name:      "no option",
+			opts:      SplitOptions{},
+			rows:      []int{5},
+			intervals: []Interval{{t0, t0 + 24*minute}},
+		},
+		{
+			name:      "by duration",
+			opts:      SplitOptions{Duration: 12 * time.Minute},
+			rows:      []int{2, 2, 1},
+			intervals: []Interval{{t0, t0 + 6*minute}, {t0 + 6*minute + 1, t0 + 18*minute}, {t0 + 18*minute + 1, t0 + 24*minute}},
+		},
+		{
+			name:      "by rows",
+			opts:      SplitOptions{MaxRows: 3},
+			rows:      []int{3, 2},
+			intervals: []Interval{{t0, t0 + 12*minute}, {t0 + 12*minute + 1, t0 + 24*minute}},
+		},
+		{
+			name:      "by bytes",
+			opts:      SplitOptions{MaxBytes: 48}, // 每行 time、index、water_level 共 24 字节
+			rows:      []int{2, 2, 1},
+			intervals: []Interval{{t0, t0 + 6*minute}, {t0 + 6*minute + 1, t0 + 18*minute}, {t0 + 18*minute + 1, t0 + 24*minute}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resps, intervals := SplitResponseValuesByTime(rawWaterLevel(), tt.opts)
+			rows := make([]int, 0)
+			for _, r := range resps {
+				rows = append(rows, len(r.Results[0].Series[0].Values))
+			}
+			if !reflect.DeepEqual(rows, tt.rows) {
+				t.Errorf("rows:\t%v\nexpected:\t%v", rows, tt.rows)
+			}
+			if !reflect.DeepEqual(intervals, tt.intervals) {
+				t.Errorf("intervals:\t%v\nexpected:\t%v", intervals, tt.intervals)
+			}
+		})
+	}
+}
+
+func TestEstimateItemSize(t *testing.T) {
+	queryString := "SELECT index,water_level FROM h2o_feet WHERE time >= '2019-08-18T00:00:00Z' AND time <= '2019-08-18T00:30:00Z' GROUP BY location"
+	resp := rawWaterLevel()
+
+	/* 估计值按最长的精度计算语义段，不小于实际存入的字节数 */
+	estimate := EstimateItemSize(queryString, resp)
+	actual := len(resp.toByteArray(queryString, "ns"))
+	if estimate < actual || estimate > actual+len(PrecisionRFC3339) {
+		t.Errorf("estimate:\t%d\nactual:\t%d", estimate, actual)
+	}
+}
+
+func TestSetResponse_ItemLimit(t *testing.T) {
+	queryString := "SELECT index,water_level FROM h2o_feet WHERE time >= '2019-08-18T00:00:00Z' AND time <= '2019-08-18T00:30:00Z' GROUP BY location"
+	limit := ItemLimit
+	defer func() { ItemLimit = limit }()
+
+	tests := []struct {
+		name  string
+		limit ItemSizeLimit
+	}{
+		{name: "larger than limit", limit: ItemSizeLimit{MaxBytes: 100}},
+		{name: "limit smaller than one row", limit: ItemSizeLimit{MaxBytes: 100, Split: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ItemLimit = tt.limit
+			/* 超过上限时不会连接cache */
+			err := setResponse(queryString, "rfc3339", rawWaterLevel(), memcache.New("localhost:0"))
+			if !errors.Is(err, ErrItemTooLarge) {
+				t.Errorf("error:\t%v\nexpected:\t%v", err, ErrItemTooLarge)
+			}
+		})
+	}
+	/* 默认不限制大小，结果交给cache，这里是连接cache失败的错误 */
+	ItemLimit = limit
+	if err := setResponse(queryString, "rfc3339", rawWaterLevel(), memcache.New("localhost:0")); errors.Is(err, ErrItemTooLarge) {
+		t.Errorf("default limit rejected the result: %v", err)
+	}
+}
@@ -0,0 +1,146 @@
+package client
+
+import (
+	"log"
+	"sync"
+	"sync/atomic"
+
+	"github.com/InfluxDB-client/memcache"
+)
+
+// Schema 是一个数据库的 schema 快照：每张表的 tag 和 tag 值、field 名和 field 的数据类型。
+// 快照发布之后不再修改，更新时整个替换（见 SetSchema、LoadSchema），读取时不需要加锁
+type Schema struct {
+	// TagKV 是数据库中所有表的 tag 和 tag 值，用来判断谓词是否是 tag
+	TagKV MeasurementTagMap
+
+	// Fields 是每张表的 field 名
+	Fields map[string][]string
+
+	// FieldTypes 记录每张表每个 field 的数据类型（float64, int64, string, bool），
+	// 用来确定谓词中常量的数据类型和检查写入的数据点；没有记录的 field 按常量的写法推断
+	FieldTypes map[string]map[string]string
+}
+
+// clone 返回 s 的副本，修改副本的 map 不影响 s
+func (s *Schema) clone() *Schema {
+	clone := &Schema{
+		TagKV:      MeasurementTagMap{Measurement: make(map[string][]TagKeyMap, len(s.TagKV.Measurement))},
+		Fields:     make(map[string][]string, len(s.Fields)),
+		FieldTypes: make(map[string]map[string]string, len(s.FieldTypes)),
+	}
+	for m, tags := range s.TagKV.Measurement {
+		clone.TagKV.Measurement[m] = tags
+	}
+	for m, fields := range s.Fields {
+		clone.Fields[m] = fields
+	}
+	for m, types := range s.FieldTypes {
+		clone.FieldTypes[m] = types
+	}
+	return clone
+}
+
+// 默认的数据库和cache地址，第一次使用包级别的连接时才连接，在此之前可以用 SetDefaultClient、SetDefaultCache 替换
+const (
+	defaultAddr      = "http://10.170.48.244:8086"
+	defaultCacheAddr = "localhost:11213"
+)
+
+// 包级别的共享状态：schema 快照、默认的数据库连接和cache连接。
+// 多个 goroutine 同时读取和替换，都通过原子指针访问。
+//
+// 其他包级别的配置变量，例如 Prefetch、Shadow、Workload、Segments、Keys、Nulls、ItemLimit、
+// ArenaDecoding、NumberFormat、Quantization、DBLimiter、MaxResponseBytes、CardinalityLimit、
+// MetadataTTL 等，读取时不加锁：只能在开始并发查询和写入cache之前设置，之后不能再修改
+var (
+	schema       atomic.Pointer[Schema]
+	schemaLoad   sync.Once
+	defaultConn  atomic.Pointer[clientHolder]
+	defaultCache atomic.Pointer[memcache.Client]
+)
+
+// clientHolder 让接口类型的 Client 可以放在原子指针中
+type clientHolder struct {
+	c Client
+}
+
+// CurrentSchema 返回当前的 schema 快照，不能修改。没有设置过 schema 时，第一次调用从默认连接的 MyDB 加载，
+// 加载失败时使用空的 schema，之后可以再调用 LoadSchema
+func CurrentSchema() *Schema {
+	if s := schema.Load(); s != nil {
+		return s
+	}
+	schemaLoad.Do(loadDefaultSchema)
+	if s := schema.Load(); s != nil {
+		return s
+	}
+	return &Schema{}
+}
+
+// loadDefaultSchema 先发布一个空的快照，加载过程中的查询读到空的 schema 而不会再次进入加载
+func loadDefaultSchema() {
+	if !schema.CompareAndSwap(nil, &Schema{}) {
+		return
+	}
+	if err := LoadSchema(DefaultClient(), MyDB); err != nil {
+		log.Printf("load schema of %s: %v", MyDB, err)
+	}
+}
+
+// SetSchema 用 s 替换当前的 schema 快照并返回原来的快照；s 发布之后不能再修改
+func SetSchema(s *Schema) *Schema {
+	if s == nil {
+		s = &Schema{}
+	}
+	return schema.Swap(s)
+}
+
+// updateSchema 在当前快照的副本上执行 fn 并发布，和同时进行的更新冲突时在新的快照上重试
+func updateSchema(fn func(*Schema)) {
+	for {
+		old := schema.Load()
+		next := CurrentSchema().clone()
+		fn(next)
+		if schema.CompareAndSwap(old, next) {
+			return
+		}
+	}
+}
+
+// DefaultClient 返回包级别函数使用的数据库连接，没有设置过时创建连接到默认地址的客户端
+func DefaultClient() Client {
+	if h := defaultConn.Load(); h != nil {
+		return h.c
+	}
+	c, err := NewHTTPClient(HTTPConfig{Addr: defaultAddr})
+	if err != nil {
+		return nil
+	}
+	if !defaultConn.CompareAndSwap(nil, &clientHolder{c: c}) {
+		c.Close()
+	}
+	return defaultConn.Load().c
+}
+
+// SetDefaultClient 替换包级别函数使用的数据库连接并返回原来的连接，原来的连接不会被关闭
+func SetDefaultClient(c Client) Client {
+	if old := defaultConn.Swap(&clientHolder{c: c}); old != nil {
+		return old.c
+	}
+	return nil
+}
+
+// DefaultCache 返回 FindGaps、Purge、元数据缓存等包级别函数使用的cache连接，没有设置过时创建连接到默认地址的客户端
+func DefaultCache() *memcache.Client {
+	if mc := defaultCache.Load(); mc != nil {
+		return mc
+	}
+	defaultCache.CompareAndSwap(nil, memcache.New(defaultCacheAddr))
+	return defaultCache.Load()
+}
+
+// SetDefaultCache 替换包级别函数使用的cache连接并返回原来的连接，原来的连接不会被关闭
+func SetDefaultCache(mc *memcache.Client) *memcache.Client {
+	return defaultCache.Swap(mc)
+}
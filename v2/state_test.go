@@ -0,0 +1,134 @@
+package client
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/InfluxDB-client/memcache"
+	"github.com/influxdata/influxql"
+)
+
+func TestUpdateSchema_Concurrent(t *testing.T) {
+	defer SetSchema(SetSchema(&Schema{
+		Fields: map[string][]string{"h2o_feet": {"water_level"}},
+		TagKV: MeasurementTagMap{Measurement: map[string][]TagKeyMap{
+			"h2o_feet": {{Tag: map[string]TagValues{"location": {Values: []string{"coyote_creek", "santa_monica"}}}}},
+		}},
+	}))
+
+	/* 同时注册多个连续查询的目标表，每个更新都不会丢失 */
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			stmt, err := influxql.ParseStatement(fmt.Sprintf("SELECT mean(water_level) INTO h2o_feet_%d FROM h2o_feet GROUP BY time(12m), location", i))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			registerTarget(stmt.(*influxql.SelectStatement))
+		}(i)
+	}
+	wg.Wait()
+
+	schema := CurrentSchema()
+	for i := 0; i < 20; i++ {
+		target := fmt.Sprintf("h2o_feet_%d", i)
+		if len(schema.Fields[target]) != 1 || len(schema.TagKV.Measurement[target]) != 1 {
+			t.Errorf("%s:\t%v %v", target, schema.Fields[target], schema.TagKV.Measurement[target])
+		}
+	}
+	if len(schema.Fields["h2o_feet"]) != 1 {
+		t.Errorf("source fields:\t%v", schema.Fields["h2o_feet"])
+	}
+}
+
+func TestSharedState_Concurrent(t *testing.T) {
+	ts := newSchemaServer()
+	defer ts.Close()
+	c, _ := NewHTTPClient(HTTPConfig{Addr: ts.URL})
+	defer c.Close()
+	defer SetSchema(CurrentSchema())
+	defer SetDefaultCache(DefaultCache())
+	defer SetDefaultClient(DefaultClient())
+
+	/* 在 -race 下运行：刷新 schema、替换连接的同时生成语义段、估算代价 */
+	queryString := `SELECT water_level FROM h2o_feet WHERE location = 'coyote_creek' AND time >= '2019-08-18T00:00:00Z' AND time <= '2019-08-18T00:30:00Z'`
+	stop := make(chan struct{})
+	var writers, readers sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		writers.Add(1)
+		go func(i int) {
+			defer writers.Done()
+			for j := 0; j < 5; j++ {
+				switch i {
+				case 0:
+					if err := LoadSchema(c, MyDB); err != nil {
+						t.Error(err)
+					}
+				case 1:
+					SetDefaultCache(memcache.New("127.0.0.1:0"))
+				case 2:
+					SetDefaultClient(c)
+				default:
+					stmt, _ := influxql.ParseStatement(fmt.Sprintf("SELECT mean(water_level) INTO h2o_feet_%d FROM h2o_feet GROUP BY time(12m)", j))
+					registerTarget(stmt.(*influxql.SelectStatement))
+				}
+			}
+		}(i)
+	}
+	for i := 0; i < 4; i++ {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				SemanticSegment(queryString, nil)
+				EstimateCost(queryString)
+				isTagColumn("h2o_feet", "location")
+				DefaultClient()
+			}
+		}()
+	}
+	writers.Wait()
+	close(stop)
+	readers.Wait()
+
+	if fields := CurrentSchema().Fields["h2o_feet"]; len(fields) == 0 {
+		t.Errorf("fields after reload:\t%v", fields)
+	}
+}
+
+func TestDefaultConnections_Lazy(t *testing.T) {
+	defer defaultConn.Store(defaultConn.Swap(nil))
+	defer defaultCache.Store(defaultCache.Swap(nil))
+
+	/* 没有设置过连接时才创建，创建时不访问网络；之后返回同一个连接 */
+	c := DefaultClient()
+	if c == nil {
+		t.Fatal("default client is nil")
+	}
+	if DefaultClient() != c {
+		t.Error("default client created twice")
+	}
+	if mc := DefaultCache(); mc == nil || DefaultCache() != mc {
+		t.Errorf("default cache:\t%v", mc)
+	}
+
+	ts := newSchemaServer()
+	defer ts.Close()
+	other, _ := NewHTTPClient(HTTPConfig{Addr: ts.URL})
+	defer other.Close()
+	if old := SetDefaultClient(other); old != c {
+		t.Errorf("replaced client:\t%v", old)
+	}
+	if DefaultClient() != other {
+		t.Error("default client not replaced")
+	}
+}
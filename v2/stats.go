@@ -0,0 +1,77 @@
+package client
+
+// CacheStats 是客户端cache的运行统计，可以直接编码成 JSON 输出
+type CacheStats struct {
+	HotKeys  []HotKey                `json:"hot_keys"` // 访问次数最多的语义段
+	Latency  map[string]LatencyStats `json:"latency"`  // 每个阶段的耗时
+	Shadow   *ShadowStats            `json:"shadow,omitempty"`
+	Prefetch *PrefetchStats          `json:"prefetch,omitempty"`
+	Workload *WorkloadStats          `json:"workload,omitempty"`
+	Memory   MemoryStats             `json:"memory"` // 进程内各层大约占用的字节数
+}
+
+// Stats 返回访问次数最多的 topN 个语义段、每个阶段的耗时和进程内占用的内存，打开影子读取、预取、查询模式学习时还包括它们的计数
+func Stats(topN int) CacheStats {
+	stats := CacheStats{HotKeys: HotKeys.Top(topN), Latency: latencyStats(), Memory: MemoryUsage()}
+	if Shadow != nil {
+		shadow := Shadow.Stats()
+		stats.Shadow = &shadow
+	}
+	if Prefetch != nil {
+		prefetch := Prefetch.Stats()
+		stats.Prefetch = &prefetch
+	}
+	if Workload != nil {
+		workload := Workload.Stats()
+		stats.Workload = &workload
+	}
+	return stats
+}
+
+// SeriesStats 是查询结果中一张表的统计
+type SeriesStats struct {
+	Name  string            `json:"name"`
+	Tags  map[string]string `json:"tags,omitempty"`
+	Rows  int               `json:"rows"`
+	Bytes int               `json:"bytes"` // 转换成字节数组后数据部分的字节数，行数 * 每行字节数，不包括语义段
+	Start int64             `json:"start"` // 第一行的时间，和 GetResponseTimeRange 相同：RFC3339 字符串转换成纳秒，数字保持查询时的精度
+	End   int64             `json:"end"`   // 最后一行的时间
+}
+
+// ResponseStats 是查询结果中每张表和所有表的统计，Start 和 End 是所有表的时间范围
+type ResponseStats struct {
+	Series []SeriesStats `json:"series"`
+	Rows   int           `json:"rows"`
+	Bytes  int           `json:"bytes"`
+	Start  int64         `json:"start"`
+	End    int64         `json:"end"`
+}
+
+// Stats 返回结果中每张表的行数、字节数和时间范围，用于存入cache之前估计大小、划分结果和诊断；
+// 只统计第一条语句的结果，和存入cache的部分一致。结果为空时返回零值
+func (resp *Response) Stats() ResponseStats {
+	stats := ResponseStats{Series: make([]SeriesStats, 0)}
+	if resp == nil || len(resp.Results) == 0 {
+		return stats
+	}
+	bytesPerLine := 0
+	if !ResponseIsEmpty(resp) {
+		bytesPerLine = BytesPerLine(DataTypeArrayFromResponse(resp))
+	}
+	for _, s := range resp.Results[0].Series {
+		ss := SeriesStats{Name: s.Name, Tags: s.Tags, Rows: len(s.Values), Bytes: len(s.Values) * bytesPerLine}
+		if len(s.Values) > 0 {
+			ss.Start, ss.End = seriesTimeRange(s)
+			if stats.Rows == 0 || ss.Start < stats.Start {
+				stats.Start = ss.Start
+			}
+			if stats.Rows == 0 || ss.End > stats.End {
+				stats.End = ss.End
+			}
+		}
+		stats.Series = append(stats.Series, ss)
+		stats.Rows += ss.Rows
+		stats.Bytes += ss.Bytes
+	}
+	return stats
+}
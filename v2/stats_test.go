@@ -0,0 +1,40 @@
+package client
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/influxdata/influxdb1-client/models"
+)
+
+func TestResponse_Stats(t *testing.T) {
+	resp := &Response{Results: []Result{{Series: []models.Row{
+		{Name: "h2o_feet", Tags: map[string]string{"location": "coyote_creek"}, Columns: []string{"time", "index"},
+			Values: [][]interface{}{{json.Number("10"), json.Number("85")}, {json.Number("30"), json.Number("66")}}},
+		{Name: "h2o_feet", Tags: map[string]string{"location": "santa_monica"}, Columns: []string{"time", "index"},
+			Values: [][]interface{}{{json.Number("5"), json.Number("29")}, {json.Number("20"), json.Number("41")}, {json.Number("25"), json.Number("60")}}},
+	}}}}
+	expected := ResponseStats{
+		Series: []SeriesStats{
+			{Name: "h2o_feet", Tags: map[string]string{"location": "coyote_creek"}, Rows: 2, Bytes: 32, Start: 10, End: 30},
+			{Name: "h2o_feet", Tags: map[string]string{"location": "santa_monica"}, Rows: 3, Bytes: 48, Start: 5, End: 25},
+		},
+		Rows:  5,
+		Bytes: 80,
+		Start: 5,
+		End:   30,
+	}
+	if stats := resp.Stats(); !reflect.DeepEqual(stats, expected) {
+		t.Errorf("stats:\t%+v\nexpected:\t%+v", stats, expected)
+	}
+	if start, end := GetResponseTimeRange(resp); start != expected.Start || end != expected.End {
+		t.Errorf("time range:\t%d %d\nexpected:\t%d %d", start, end, expected.Start, expected.End)
+	}
+
+	/* 空结果 */
+	empty := &Response{Results: []Result{{}}}
+	if stats := empty.Stats(); stats.Rows != 0 || len(stats.Series) != 0 {
+		t.Errorf("stats:\t%+v", stats)
+	}
+}
@@ -0,0 +1,288 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/InfluxDB-client/memcache"
+)
+
+// MaxResponseBytes 是 Set 在内存中保存的查询结果的大小上限（按 EstimateItemSize 估计），为 0 时不限制。
+// 设置之后 Set 分块查询数据库，结果超过上限时不再合并成一个 Response：之后的每一块交给调用方后转换成字节数组写入临时文件，
+// 查询结束后从临时文件按块存入cache，内存中只保留当前的一块和每张表的第一行
+var MaxResponseBytes = 0
+
+// StreamChunkSize 是设置了 MaxResponseBytes 时分块查询每块的行数
+var StreamChunkSize = 10000
+
+// SetStream 和 SetWithPrecision 相同，并把查询结果交给 fn：结果不超过 MaxResponseBytes 时 fn 只调用一次，参数是完整的结果；
+// 超过时依次用每一块调用 fn，同一张表可能被拆到相邻的多块中。fn 返回错误时停止查询，结果不存入cache。
+// 设置了 Quantization 时查询的是对齐之后的时间范围，fn 得到的也是这个范围的结果
+func SetStream(queryString, precision string, c Client, mc *memcache.Client, fn func(*Response) error) error {
+	if fn == nil {
+		fn = func(*Response) error { return nil }
+	}
+	if Quantization != nil {
+		queryString = Quantization.Query(queryString)
+	}
+	if err := checkCardinality(c, queryString); err != nil {
+		return err
+	}
+	if err := waitDBLimiter(queryString); err != nil {
+		return err
+	}
+	query := NewQuery(queryString, MyDB, precision)
+
+	var resp *Response
+	if MaxResponseBytes <= 0 {
+		start := time.Now()
+		r, err := c.Query(query)
+		observeLatency(StageDBQuery, start)
+		if err != nil {
+			return err
+		}
+		resp = r
+	} else {
+		query.ChunkSize = StreamChunkSize
+		start := time.Now()
+		cr, err := c.QueryAsChunk(query)
+		observeLatency(StageDBQuery, start)
+		if err != nil {
+			return err
+		}
+		defer cr.Close()
+
+		resp = &Response{}
+		for {
+			chunk, err := cr.NextResponse()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return err
+			}
+			if err := chunk.Error(); err != nil {
+				return err
+			}
+			appendChunk(resp, chunk)
+			if len(resp.Results) > 0 && EstimateItemSize(queryString, resp) > MaxResponseBytes {
+				return streamResponse(queryString, precision, resp, cr, mc, fn)
+			}
+		}
+		if len(resp.Results) == 0 {
+			resp.Results = []Result{{}}
+		}
+	}
+
+	if err := fn(resp); err != nil {
+		return err
+	}
+	if err := setResponse(queryString, precision, resp, mc); err != nil {
+		return err
+	}
+	if Prefetch != nil && !ResponseIsEmpty(resp) {
+		Prefetch.Observe(queryString, SemanticSegment(queryString, resp))
+	}
+	return nil
+}
+
+// streamResponse 是结果超过 MaxResponseBytes 之后的分块路径：已经读取的部分 first 和之后的每一块依次交给 fn，
+// 转换成字节数组写入临时文件，读取完之后用每张表的第一行生成整个结果的语义段，从临时文件按块存入cache。
+// 不能存入cache时（ItemLimit 不允许划分、有空值、OR 连接的多个时间范围）仍然把所有块交给 fn，最后返回不能存入的原因
+func streamResponse(queryString, precision string, first *Response, cr *ChunkedResponse, mc *memcache.Client, fn func(*Response) error) error {
+	var cacheErr error
+	if ItemLimit.MaxBytes > 0 && !ItemLimit.Split {
+		cacheErr = fmt.Errorf("%w: result of %s exceeds %d bytes", ErrItemTooLarge, queryString, MaxResponseBytes)
+	} else if queries, _ := splitTimeRanges(queryString); len(queries) > 0 {
+		cacheErr = fmt.Errorf("%w: streamed result of several time ranges is not cached: %s", ErrUnsupportedQuery, queryString)
+	}
+
+	var spill *os.File
+	var spilled *bufio.Writer
+	if cacheErr == nil {
+		f, err := os.CreateTemp("", "influxdb-client-spill-*")
+		if err != nil {
+			return err
+		}
+		defer os.Remove(f.Name())
+		defer f.Close()
+		spill, spilled = f, bufio.NewWriter(f)
+	}
+	skeleton := &Response{Results: []Result{{}}} // 每张表只保留第一行，用来生成语义段
+
+	add := func(chunk *Response) error {
+		if err := fn(chunk); err != nil {
+			return err
+		}
+		if cacheErr != nil || ResponseIsEmpty(chunk) {
+			return nil
+		}
+		if cacheErr = checkNulls(chunk); cacheErr != nil {
+			return nil
+		}
+		addSkeleton(skeleton, chunk)
+		_, err := spilled.Write(chunk.ToByteArrayWithPrecision(SeperateSemanticSegment(queryString, chunk), precision))
+		return err
+	}
+
+	if err := add(StitchPartialSeries(first)); err != nil {
+		return err
+	}
+	for {
+		chunk, err := cr.NextResponse()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if err := chunk.Error(); err != nil {
+			return err
+		}
+		if err := add(chunk); err != nil {
+			return err
+		}
+	}
+	if cacheErr != nil {
+		return cacheErr
+	}
+	if ResponseIsEmpty(skeleton) {
+		return nil
+	}
+	if err := spilled.Flush(); err != nil {
+		return err
+	}
+	if _, err := spill.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	skeleton = SortSeries(skeleton)
+	semanticSegment := SemanticSegment(queryString, skeleton)
+	maxBytes := MaxResponseBytes
+	if ItemLimit.MaxBytes > 0 && ItemLimit.MaxBytes < maxBytes {
+		maxBytes = ItemLimit.MaxBytes
+	}
+	if err := setSpilledItems(cacheKey(semanticSegment), bufio.NewReader(spill), maxBytes, mc.Set); err != nil {
+		return err
+	}
+	Coverage.Add(semanticSegment, queryCoverage(queryString, responseWithPrecision(skeleton, responsePrecision(skeleton, precision), "ns")))
+	if Prefetch != nil {
+		Prefetch.Observe(queryString, semanticSegment)
+	}
+	return nil
+}
+
+// addSkeleton 把 chunk 中还没有出现过的表的第一行加入 skeleton
+func addSkeleton(skeleton *Response, chunk *Response) {
+	seen := make(map[string]bool, len(skeleton.Results[0].Series))
+	for _, s := range skeleton.Results[0].Series {
+		seen[s.Name+TagsMapToString(s.Tags)] = true
+	}
+	for _, s := range chunk.Results[0].Series {
+		if key := s.Name + TagsMapToString(s.Tags); !seen[key] && len(s.Values) > 0 {
+			seen[key] = true
+			s.Values = s.Values[:1:1]
+			s.Partial = false
+			skeleton.Results[0].Series = append(skeleton.Results[0].Series, s)
+		}
+	}
+}
+
+// setSpilledItems 从 r 依次读取每张表（语义段#{precision} + 空格 + 8字节的数据长度 + 数据），
+// 组成不超过 maxBytes 的item用 set 存入cache，数据过多的表按行拆开；同一张表拆开的部分读取时由 getResponse 拼接
+func setSpilledItems(key string, r *bufio.Reader, maxBytes int, set func(*memcache.Item) error) error {
+	if MaxKeyLength > 0 && len(key) > MaxKeyLength {
+		return fmt.Errorf("%w: %d bytes, limit %d", ErrKeyTooLong, len(key), MaxKeyLength)
+	}
+	var item bytes.Buffer
+	tables := int64(0)
+	startTime, endTime := int64(0), int64(0)
+
+	flush := func() error {
+		if tables == 0 {
+			return nil
+		}
+		value, err := recodeItem(append([]byte(nil), item.Bytes()...))
+		if err != nil {
+			return err
+		}
+		err = set(&memcache.Item{
+			Key:         key,
+			Value:       value,
+			Time_start:  startTime,
+			Time_end:    endTime,
+			NumOfTables: tables,
+		})
+		item.Reset()
+		tables = 0
+		return err
+	}
+
+	for {
+		segment, err := r.ReadString(' ')
+		if err == io.EOF && segment == "" {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		segment = strings.TrimSuffix(segment, " ")
+		lenBytes := make([]byte, 8)
+		if _, err := io.ReadFull(r, lenBytes); err != nil {
+			return err
+		}
+		length, err := ByteArrayToInt64(lenBytes)
+		if err != nil {
+			return err
+		}
+		data := make([]byte, length)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return err
+		}
+
+		bytesPerLine := BytesPerLine(DataTypeArrayFromSF("time[int64]," + strings.Trim(strings.Split(segment, "#")[1], "{}")))
+		if len(segment)+1+8+len(data) > maxBytes {
+			segment = withoutBlockIndex(segment) // 表被拆开存放，块索引不再对应每一部分的数据
+		}
+		header := len(segment) + 1 + 8
+		for len(data) > 0 {
+			if item.Len()+header+bytesPerLine > maxBytes {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+			rows := (maxBytes - item.Len() - header) / bytesPerLine
+			if rows < 1 {
+				rows = 1
+			}
+			if rows*bytesPerLine > len(data) {
+				rows = len(data) / bytesPerLine
+			}
+			piece := data[:rows*bytesPerLine]
+			data = data[rows*bytesPerLine:]
+
+			first, _ := ByteArrayToInt64(piece[:8])
+			last, _ := ByteArrayToInt64(piece[len(piece)-bytesPerLine : len(piece)-bytesPerLine+8])
+			if tables == 0 || first < startTime {
+				startTime = first
+			}
+			if tables == 0 || last > endTime {
+				endTime = last
+			}
+			pieceLen, err := Int64ToByteArray(int64(len(piece)))
+			if err != nil {
+				return err
+			}
+			item.WriteString(segment + " ")
+			item.Write(pieceLen)
+			item.Write(piece)
+			tables++
+		}
+	}
+	return flush()
+}
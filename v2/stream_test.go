@@ -0,0 +1,115 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/InfluxDB-client/memcache"
+	"github.com/influxdata/influxdb1-client/models"
+)
+
+func newChunkedServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"results":[{"statement_id":0,"series":[{"name":"h2o_feet","tags":{"location":"coyote_creek"},"columns":["time","index"],"values":[[1,85],[2,66]],"partial":true}],"partial":true}]}` + "\n"))
+		w.Write([]byte(`{"results":[{"statement_id":0,"series":[{"name":"h2o_feet","tags":{"location":"coyote_creek"},"columns":["time","index"],"values":[[3,78]]}],"partial":true}]}` + "\n"))
+		w.Write([]byte(`{"results":[{"statement_id":0,"series":[{"name":"h2o_feet","tags":{"location":"santa_monica"},"columns":["time","index"],"values":[[1,29]]}]}]}` + "\n"))
+	}))
+}
+
+func TestSetStream(t *testing.T) {
+	maxResponseBytes, itemLimit := MaxResponseBytes, ItemLimit
+	defer func() { MaxResponseBytes, ItemLimit = maxResponseBytes, itemLimit }()
+
+	ts := newChunkedServer()
+	defer ts.Close()
+	db, _ := NewHTTPClient(HTTPConfig{Addr: ts.URL})
+	defer db.Close()
+	queryString := "SELECT index FROM h2o_feet WHERE time >= '2019-08-18T00:00:00Z' AND time <= '2019-08-18T00:30:00Z' GROUP BY location"
+
+	/* 不超过上限时只调用一次 fn，参数是拼接好的完整结果 */
+	MaxResponseBytes = 1 << 20
+	var calls []*Response
+	collect := func(resp *Response) error {
+		calls = append(calls, resp)
+		return nil
+	}
+	SetStream(queryString, "ns", db, memcache.New("localhost:0"), collect)
+	if len(calls) != 1 || len(calls[0].Results[0].Series) != 2 || len(calls[0].Results[0].Series[0].Values) != 3 {
+		t.Errorf("calls:\t%v", calls)
+	}
+
+	/* 超过上限之后每一块分别交给 fn，ItemLimit 不允许划分时不存入cache */
+	MaxResponseBytes = 1
+	ItemLimit = ItemSizeLimit{MaxBytes: 1 << 20}
+	calls = nil
+	err := SetStream(queryString, "ns", db, memcache.New("localhost:0"), collect)
+	if !errors.Is(err, ErrItemTooLarge) {
+		t.Errorf("error:\t%v\nexpected:\t%v", err, ErrItemTooLarge)
+	}
+	if len(calls) != 3 {
+		t.Errorf("calls:\t%d\nexpected:\t%d", len(calls), 3)
+	}
+
+	/* fn 返回错误时停止 */
+	stop := errors.New("stop")
+	if err := SetStream(queryString, "ns", db, memcache.New("localhost:0"), func(*Response) error { return stop }); err != stop {
+		t.Errorf("error:\t%v\nexpected:\t%v", err, stop)
+	}
+}
+
+func TestSetSpilledItems(t *testing.T) {
+	rows := func(n int) [][]interface{} {
+		values := make([][]interface{}, 0, n)
+		for i := 1; i <= n; i++ {
+			values = append(values, []interface{}{json.Number(strconv.Itoa(i)), json.Number(strconv.Itoa(i * 10))})
+		}
+		return values
+	}
+	resp := &Response{Results: []Result{{Series: []models.Row{
+		{Name: "h2o_feet", Tags: map[string]string{"location": "coyote_creek"}, Columns: []string{"time", "index"}, Values: rows(10)},
+		{Name: "h2o_feet", Tags: map[string]string{"location": "santa_monica"}, Columns: []string{"time", "index"}, Values: rows(3)},
+	}}}}
+	segments := []string{
+		"{(h2o_feet.location=coyote_creek)}#{index[int64]}#{empty}#{empty,empty}",
+		"{(h2o_feet.location=santa_monica)}#{index[int64]}#{empty}#{empty,empty}",
+	}
+	spill := resp.ToByteArrayWithPrecision(segments, "ns")
+
+	/* 每个item最多 200 字节，第一张表被拆开 */
+	items := make([]*memcache.Item, 0)
+	err := setSpilledItems("key", bufio.NewReader(bytes.NewReader(spill)), 200, func(item *memcache.Item) error {
+		items = append(items, item)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(items) < 2 {
+		t.Fatalf("items:\t%d\nexpected more than one item", len(items))
+	}
+	values := make([]byte, 0)
+	for _, item := range items {
+		if len(item.Value) > 200 || item.Key != "key" || item.NumOfTables != countTables(item.Value) {
+			t.Errorf("item:\t%d bytes, key %s, %d tables", len(item.Value), item.Key, item.NumOfTables)
+		}
+		values = append(values, item.Value...)
+	}
+	if items[0].Time_start != 1 || items[len(items)-1].Time_end != 3 {
+		t.Errorf("time range:\t%d %d", items[0].Time_start, items[len(items)-1].Time_end)
+	}
+
+	/* 读取时拼接成原来的表 */
+	got := StitchPartialSeries(ByteArrayToResponse(append(values, []byte("\r\n")...)))
+	if !reflect.DeepEqual(got.Results[0].Series[0].Values, resp.Results[0].Series[0].Values) ||
+		!reflect.DeepEqual(got.Results[0].Series[1].Values, resp.Results[0].Series[1].Values) {
+		t.Errorf("response:\t%v\nexpected:\t%v", got, resp)
+	}
+}
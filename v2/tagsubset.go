@@ -0,0 +1,237 @@
+package client
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/InfluxDB-client/memcache"
+	"github.com/influxdata/influxdb1-client/models"
+	"github.com/influxdata/influxql"
+)
+
+// tagSubset 是一个有 tag 过滤条件的查询拆成的两部分：去掉 tag 条件、按这些 tag 分组的查询，
+// 以及从它的结果中选出表的条件
+type tagSubset struct {
+	superset *influxql.SelectStatement
+	filter   influxql.Expr       // 只涉及 tag 的条件，按表的 tag 求值
+	tags     []string            // filter 中的 tag
+	groupBy  map[string]struct{} // 原查询 GROUP BY 的 tag，结果中的表只保留这些 tag
+}
+
+// parseTagSubset 拆分查询：WHERE 中用 AND 连接的条件里，只涉及 tag 的条件从查询中去掉，相应的 tag 加入 GROUP BY。
+// 同时涉及 tag 和 field 或时间的条件不能拆开，返回 ErrUnsupportedQuery；没有 tag 条件时也返回 ErrUnsupportedQuery
+func parseTagSubset(queryString string) (*tagSubset, error) {
+	s, ok := selectStatement(queryString)
+	if !ok {
+		return nil, fmt.Errorf("%w: not a SELECT statement: %s", ErrUnsupportedQuery, queryString)
+	}
+	if len(s.Sources) != 1 {
+		return nil, fmt.Errorf("%w: query must select from one measurement: %s", ErrUnsupportedQuery, queryString)
+	}
+	m, ok := s.Sources[0].(*influxql.Measurement)
+	if !ok || m.Regex != nil {
+		return nil, fmt.Errorf("%w: query must select from one measurement: %s", ErrUnsupportedQuery, queryString)
+	}
+	if s.Limit > 0 || s.Offset > 0 || s.SLimit > 0 || s.SOffset > 0 || s.Target != nil {
+		return nil, fmt.Errorf("%w: LIMIT, OFFSET and INTO cannot select series from another result: %s", ErrUnsupportedQuery, queryString)
+	}
+
+	var rest, filters []influxql.Expr
+	for _, expr := range conjuncts(s.Condition) {
+		if isTagExpr(m.Name, expr) {
+			filters = append(filters, expr)
+		} else {
+			rest = append(rest, expr)
+		}
+	}
+	if len(filters) == 0 {
+		return nil, fmt.Errorf("%w: no tag predicates in %s", ErrUnsupportedQuery, queryString)
+	}
+	for _, expr := range rest {
+		if len(exprTags(m.Name, expr)) > 0 {
+			return nil, fmt.Errorf("%w: tag predicate combined with other predicates: %s", ErrUnsupportedQuery, expr)
+		}
+	}
+
+	ts := &tagSubset{superset: s.Clone(), groupBy: make(map[string]struct{})}
+	ts.superset.Condition = conjunction(rest)
+	ts.filter = conjunction(filters)
+	ts.tags = exprTags(m.Name, ts.filter)
+	grouped := make(map[string]bool)
+	for _, d := range s.Dimensions {
+		switch expr := d.Expr.(type) {
+		case *influxql.VarRef:
+			ts.groupBy[expr.Val] = struct{}{}
+			grouped[expr.Val] = true
+		case *influxql.Wildcard:
+			grouped["*"] = true
+		}
+	}
+	if grouped["*"] {
+		for _, tag := range ts.tags {
+			ts.groupBy[tag] = struct{}{}
+		}
+		return ts, nil
+	}
+	for _, tag := range ts.tags {
+		if !grouped[tag] {
+			ts.superset.Dimensions = append(ts.superset.Dimensions, &influxql.Dimension{Expr: &influxql.VarRef{Val: tag}})
+		}
+	}
+	return ts, nil
+}
+
+// conjuncts 返回用 AND 连接的各个条件
+func conjuncts(expr influxql.Expr) []influxql.Expr {
+	switch e := expr.(type) {
+	case nil:
+		return nil
+	case *influxql.ParenExpr:
+		return conjuncts(e.Expr)
+	case *influxql.BinaryExpr:
+		if e.Op == influxql.AND {
+			return append(conjuncts(e.LHS), conjuncts(e.RHS)...)
+		}
+	}
+	return []influxql.Expr{expr}
+}
+
+// conjunction 用 AND 连接条件，没有条件时返回 nil
+func conjunction(exprs []influxql.Expr) influxql.Expr {
+	var result influxql.Expr
+	for _, expr := range exprs {
+		if e, ok := expr.(*influxql.BinaryExpr); ok && e.Op == influxql.OR {
+			expr = &influxql.ParenExpr{Expr: expr}
+		}
+		if result == nil {
+			result = expr
+			continue
+		}
+		result = &influxql.BinaryExpr{Op: influxql.AND, LHS: result, RHS: expr}
+	}
+	return result
+}
+
+// isTagExpr 判断条件是否只涉及 tag
+func isTagExpr(measurement string, expr influxql.Expr) bool {
+	onlyTags := true
+	refs := 0
+	influxql.WalkFunc(expr, func(n influxql.Node) {
+		ref, ok := n.(*influxql.VarRef)
+		if !ok {
+			return
+		}
+		refs++
+		if !isTagRef(measurement, ref) {
+			onlyTags = false
+		}
+	})
+	return refs > 0 && onlyTags
+}
+
+// exprTags 返回条件中的 tag，按名字排序
+func exprTags(measurement string, expr influxql.Expr) []string {
+	tags := make([]string, 0)
+	influxql.WalkFunc(expr, func(n influxql.Node) {
+		if ref, ok := n.(*influxql.VarRef); ok && isTagRef(measurement, ref) {
+			tags = append(tags, ref.Val)
+		}
+	})
+	sort.Strings(tags)
+	return slices.Compact(tags)
+}
+
+// isTagRef 判断条件中的列是否是 tag：::tag 和 ::field 指定的类型优先，否则和 isTagColumn 一样查找 schema
+func isTagRef(measurement string, ref *influxql.VarRef) bool {
+	if ref.Type != influxql.Unknown {
+		return ref.Type == influxql.Tag
+	}
+	schema := CurrentSchema()
+	for _, f := range schema.Fields[measurement] {
+		if f == ref.Val {
+			return false
+		}
+	}
+	for _, tkm := range schema.TagKV.Measurement[measurement] {
+		if _, ok := tkm.Tag[ref.Val]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// TagSubsetSegment 返回有 tag 过滤条件的查询可以借用的cache中的key：去掉只涉及 tag 的条件、按这些 tag 分组的同一查询的语义段。
+// segment 是查询本身的语义段，SF、SP 和 SG 不受 tag 条件影响，只有 SM 按 schema 中的 tag 值重新生成，见 GetSMFromQuery；
+// 数据库中没有某些 tag 值的组合时，存入时的 SM 和这里生成的不同，借用不到
+func TagSubsetSegment(queryString, segment string) (string, error) {
+	ts, err := parseTagSubset(queryString)
+	if err != nil {
+		return "", err
+	}
+	parts := strings.Split(segment, "#")
+	if len(parts) != 4 {
+		return "", fmt.Errorf("invalid semantic segment %s", segment)
+	}
+	sm, err := GetSMFromQuery(ts.superset.String(), CurrentSchema().TagKV)
+	if err != nil {
+		return "", err
+	}
+	parts[0] = sm
+	return strings.Join(parts, "#"), nil
+}
+
+// GetTagSubset 查询的语义段在cache中未命中时，读取 TagSubsetSegment 得到的按 tag 分组的结果，
+// 选出满足查询中 tag 条件的表作为查询结果。查询没有按条件中的 tag 分组时，
+// 同一分组只能有一张表满足条件，否则需要合并多张表的数据，返回 ErrUnsupportedQuery；未命中时返回 memcache.ErrCacheMiss
+func GetTagSubset(queryString, segment string, startTime, endTime int64, mc *memcache.Client) (*Response, error) {
+	ts, err := parseTagSubset(queryString)
+	if err != nil {
+		return nil, err
+	}
+	superset, err := TagSubsetSegment(queryString, segment)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := getResponse(superset, startTime, startTime, endTime, mc)
+	if err != nil {
+		return nil, err
+	}
+	return ts.selectSeries(resp)
+}
+
+// selectSeries 选出满足 tag 条件的表，去掉原查询没有分组的 tag
+func (ts *tagSubset) selectSeries(resp *Response) (*Response, error) {
+	result := &Response{Err: resp.Err, Results: make([]Result, len(resp.Results)), statusCode: resp.statusCode}
+	for i, r := range resp.Results {
+		r.Series = nil
+		groups := make(map[string]bool)
+		for _, s := range resp.Results[i].Series {
+			values := make(map[string]interface{}, len(ts.tags))
+			for _, tag := range ts.tags {
+				values[tag] = s.Tags[tag] // 没有这个 tag 的表的值是空字符串，和数据库相同
+			}
+			if !influxql.EvalBool(ts.filter, values) {
+				continue
+			}
+			tags := make(map[string]string, len(s.Tags))
+			for k, v := range s.Tags {
+				if _, ok := ts.groupBy[k]; ok {
+					tags[k] = v
+				}
+			}
+			if len(tags) == 0 {
+				tags = nil
+			}
+			group := TagsMapToString(tags)
+			if groups[group] {
+				return nil, fmt.Errorf("%w: more than one series of %s match the tag predicates in group %s", ErrUnsupportedQuery, s.Name, group)
+			}
+			groups[group] = true
+			r.Series = append(r.Series, models.Row{Name: s.Name, Tags: tags, Columns: s.Columns, Values: s.Values, Partial: s.Partial})
+		}
+		result.Results[i] = r
+	}
+	return SortSeries(result), nil
+}
@@ -0,0 +1,100 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/InfluxDB-client/diskcache"
+	"github.com/InfluxDB-client/memcache"
+	"github.com/influxdata/influxdb1-client/models"
+)
+
+func TestGetTagSubset(t *testing.T) {
+	s, err := diskcache.Listen(filepath.Join(t.TempDir(), "cache.db"), "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	mc := memcache.New(s.Addr())
+	defer SetSchema(SetSchema(&Schema{
+		Fields: map[string][]string{"h2o_feet": {"water_level"}},
+		TagKV: MeasurementTagMap{Measurement: map[string][]TagKeyMap{
+			"h2o_feet": {{Tag: map[string]TagValues{"location": {Values: []string{"coyote_creek", "santa_monica"}}}}},
+		}},
+	}))
+
+	/* 按 location 分组的结果存入cache */
+	row := func(location string, level string) models.Row {
+		return models.Row{
+			Name:    "h2o_feet",
+			Tags:    map[string]string{"location": location},
+			Columns: []string{"time", "water_level"},
+			Values:  [][]interface{}{{json.Number("1566086400000000000"), json.Number(level)}},
+		}
+	}
+	superset := "SELECT water_level FROM h2o_feet WHERE time >= '2019-08-18T00:00:00Z' AND time <= '2019-08-18T00:30:00Z' GROUP BY location"
+	supersetResp := &Response{Results: []Result{{Series: []models.Row{row("coyote_creek", "8.12"), row("santa_monica", "2.064")}}}}
+	if err := setResponse(superset, "ns", supersetResp, mc); err != nil {
+		t.Fatal(err)
+	}
+	start, end := int64(1566086400000000000), int64(1566088200000000000)
+
+	tests := []struct {
+		name     string
+		query    string
+		expected models.Row
+	}{
+		{
+			name:     "grouped",
+			query:    "SELECT water_level FROM h2o_feet WHERE location = 'coyote_creek' AND time >= '2019-08-18T00:00:00Z' AND time <= '2019-08-18T00:30:00Z' GROUP BY location",
+			expected: row("coyote_creek", "8.12"),
+		},
+		{
+			name:  "not grouped",
+			query: "SELECT water_level FROM h2o_feet WHERE time >= '2019-08-18T00:00:00Z' AND time <= '2019-08-18T00:30:00Z' AND location <> 'coyote_creek'",
+			expected: models.Row{
+				Name:    "h2o_feet",
+				Columns: []string{"time", "water_level"},
+				Values:  [][]interface{}{{json.Number("1566086400000000000"), json.Number("2.064")}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			/* 查询本身的语义段是直接查询数据库时存入的key，借用的key和按 location 分组存入时相同 */
+			expected := &Response{Results: []Result{{Series: []models.Row{tt.expected}}}}
+			segment := SemanticSegment(tt.query, expected)
+			derived, err := TagSubsetSegment(tt.query, segment)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if derived != SemanticSegment(superset, supersetResp) {
+				t.Errorf("derived segment:\t%s\nexpected:\t%s", derived, SemanticSegment(superset, supersetResp))
+			}
+
+			resp, err := GetTagSubset(tt.query, segment, start, end, mc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(resp.Results) != 1 || !reflect.DeepEqual(resp.Results[0].Series, []models.Row{tt.expected}) {
+				t.Errorf("series:\t%v\nexpected:\t%v", resp.Results, tt.expected)
+			}
+		})
+	}
+
+	/* 没有按 location 分组时两张表都满足条件，需要合并，不能借用 */
+	query := "SELECT water_level FROM h2o_feet WHERE time >= '2019-08-18T00:00:00Z' AND time <= '2019-08-18T00:30:00Z' AND (location = 'coyote_creek' OR location = 'santa_monica')"
+	segment := "{(h2o_feet.location=coyote_creek,h2o_feet.location=santa_monica)}#{water_level[float64]}#{empty}#{empty,empty}"
+	if _, err := GetTagSubset(query, segment, start, end, mc); !errors.Is(err, ErrUnsupportedQuery) {
+		t.Errorf("error:\t%v\nexpected:\t%v", err, ErrUnsupportedQuery)
+	}
+
+	/* tag 条件和 field 条件用 OR 连接时不能拆开 */
+	query = "SELECT water_level FROM h2o_feet WHERE time >= '2019-08-18T00:00:00Z' AND (location = 'coyote_creek' OR water_level > 5)"
+	if _, err := TagSubsetSegment(query, segment); !errors.Is(err, ErrUnsupportedQuery) {
+		t.Errorf("error:\t%v\nexpected:\t%v", err, ErrUnsupportedQuery)
+	}
+}
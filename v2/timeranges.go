@@ -0,0 +1,173 @@
+package client
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/InfluxDB-client/memcache"
+	"github.com/influxdata/influxql"
+)
+
+// errMixedTimeCondition 表示时间条件和其他条件用 OR 连接，无法拆分成多个时间范围
+var errMixedTimeCondition = errors.New("time condition is OR-ed with other conditions")
+
+// GetQueryTimeRanges 返回查询 WHERE 中的所有时间范围（纳秒），如 (time >= A AND time < B) OR (time >= C AND time < D)
+// 拆分成 [A, B-1] 和 [C, D-1] 两个范围，按起始时间升序排列，相交或相邻的范围合并。
+// 和 GetQueryTimeRange 一样，没有下界时无法确定范围，没有上界时上界是当前时间；
+// 没有时间条件、某个范围没有下界、或者时间条件和其他条件用 OR 连接时返回 nil
+func GetQueryTimeRanges(queryString string) (ranges []Interval, relative bool) {
+	s, ok := selectStatement(queryString)
+	if !ok || s.Condition == nil {
+		return nil, false
+	}
+
+	now := time.Now()
+	ranges, hasTime, err := timeRanges(s.Condition, &influxql.NowValuer{Now: now})
+	if err != nil || !hasTime {
+		return nil, false
+	}
+	influxql.WalkFunc(s.Condition, func(node influxql.Node) {
+		if call, ok := node.(*influxql.Call); ok && strings.EqualFold(call.Name, "now") {
+			relative = true
+		}
+	})
+	for i := range ranges {
+		if ranges[i].Start == influxql.MinTime {
+			return nil, false
+		}
+		if ranges[i].End == influxql.MaxTime {
+			ranges[i].End = now.UnixNano()
+			relative = true
+		}
+	}
+	return mergeIntervals(ranges), relative
+}
+
+// timeRanges 递归地求条件中的时间范围：AND 两边的范围两两求交集，OR 两边的范围合在一起；
+// hasTime 为 false 表示条件中没有时间条件，不限制时间范围
+func timeRanges(expr influxql.Expr, valuer influxql.Valuer) (ranges []Interval, hasTime bool, err error) {
+	switch e := expr.(type) {
+	case *influxql.ParenExpr:
+		return timeRanges(e.Expr, valuer)
+	case *influxql.BinaryExpr:
+		switch e.Op {
+		case influxql.AND, influxql.OR:
+			lhs, lhsTime, err := timeRanges(e.LHS, valuer)
+			if err != nil {
+				return nil, false, err
+			}
+			rhs, rhsTime, err := timeRanges(e.RHS, valuer)
+			if err != nil {
+				return nil, false, err
+			}
+			switch {
+			case !lhsTime && !rhsTime:
+				return nil, false, nil
+			case e.Op == influxql.OR && lhsTime != rhsTime:
+				return nil, false, errMixedTimeCondition
+			case e.Op == influxql.OR:
+				return append(lhs, rhs...), true, nil
+			case !rhsTime:
+				return lhs, true, nil
+			case !lhsTime:
+				return rhs, true, nil
+			}
+			intersections := make([]Interval, 0)
+			for _, l := range lhs {
+				for _, r := range rhs {
+					in := Interval{Start: l.Start, End: l.End}
+					if r.Start > in.Start {
+						in.Start = r.Start
+					}
+					if r.End < in.End {
+						in.End = r.End
+					}
+					if in.Start <= in.End {
+						intersections = append(intersections, in)
+					}
+				}
+			}
+			return intersections, true, nil
+		}
+		if !isTimeRef(e.LHS) && !isTimeRef(e.RHS) {
+			return nil, false, nil
+		}
+		_, timeRange, err := influxql.ConditionExpr(e, valuer)
+		if err != nil {
+			return nil, false, err
+		}
+		return []Interval{{Start: timeRange.MinTimeNano(), End: timeRange.MaxTimeNano()}}, true, nil
+	}
+	return nil, false, nil
+}
+
+// isTimeRef 判断表达式是否是 time 列
+func isTimeRef(expr influxql.Expr) bool {
+	ref, ok := expr.(*influxql.VarRef)
+	return ok && strings.EqualFold(ref.Val, "time")
+}
+
+// splitTimeRanges 把有多个时间范围的查询拆分成每个时间范围一条查询，和对应的时间范围一起返回；
+// 只有一个时间范围或者无法拆分时返回 nil
+func splitTimeRanges(queryString string) ([]string, []Interval) {
+	ranges, _ := GetQueryTimeRanges(queryString)
+	if len(ranges) <= 1 {
+		return nil, nil
+	}
+	queries := make([]string, 0, len(ranges))
+	for _, r := range ranges {
+		q, err := QueryWithTimeRange(queryString, r.Start, r.End)
+		if err != nil {
+			return nil, nil
+		}
+		queries = append(queries, q)
+	}
+	return queries, ranges
+}
+
+// setTimeRanges 把多个时间范围的查询结果按时间范围拆开，每一部分用只有这个时间范围的查询生成语义段分别存入cache，
+// 没有数据的部分不存入
+func setTimeRanges(queries []string, ranges []Interval, precision string, resp *Response, mc *memcache.Client) error {
+	from := responsePrecision(resp, precision)
+	nsResp := responseWithPrecision(resp, from, "ns")
+	for i, r := range ranges {
+		part := TrimResponse(nsResp, r.Start, r.End)
+		if ResponseIsEmpty(part) {
+			continue
+		}
+		if err := setResponse(queries[i], precision, responseWithPrecision(part, "ns", from), mc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetTimeRanges 对语义段 segment 的每个时间范围分别读取cache，把命中的结果按时间顺序合并，时间戳转换成 precision 精度；
+// 同时返回未命中的时间范围，调用方只需要查询这些范围。所有范围都未命中时返回的结果为 nil
+func GetTimeRanges(segment string, ranges []Interval, precision string, mc *memcache.Client) (*Response, []Interval, error) {
+	var merged *Response
+	missing := make([]Interval, 0)
+	for _, r := range ranges {
+		resp, err := getResponse(segment, r.Start, r.Start, r.End, mc)
+		if err == memcache.ErrCacheMiss {
+			missing = append(missing, r)
+			continue
+		} else if err != nil {
+			return nil, nil, err
+		}
+		if ResponseIsEmpty(resp) {
+			missing = append(missing, r)
+			continue
+		}
+		if merged == nil {
+			merged = resp
+			continue
+		}
+		merged = MergeResultTable(merged, resp)
+	}
+	if merged == nil {
+		return nil, missing, nil
+	}
+	return responseWithPrecision(merged, "ns", precision), missing, nil
+}
@@ -0,0 +1,97 @@
+package client
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/influxdata/influxdb1-client/models"
+)
+
+func TestGetQueryTimeRanges(t *testing.T) {
+	const t0 = 1566086400000000000 // 2019-08-18T00:00:00Z
+	minute := int64(time.Minute)
+	tests := []struct {
+		name        string
+		queryString string
+		expected    []Interval
+	}{
+		{
+			name:        "two ranges",
+			queryString: "SELECT water_level FROM h2o_feet WHERE (time >= '2019-08-18T00:00:00Z' AND time < '2019-08-18T00:30:00Z') OR (time >= '2019-08-18T01:00:00Z' AND time < '2019-08-18T01:30:00Z')",
+			expected:    []Interval{{t0, t0 + 30*minute - 1}, {t0 + 60*minute, t0 + 90*minute - 1}},
+		},
+		{
+			name:        "ranges with tag predicate",
+			queryString: "SELECT water_level FROM h2o_feet WHERE location = 'coyote_creek' AND ((time >= '2019-08-18T01:00:00Z' AND time <= '2019-08-18T01:30:00Z') OR (time >= '2019-08-18T00:00:00Z' AND time <= '2019-08-18T00:30:00Z'))",
+			expected:    []Interval{{t0, t0 + 30*minute}, {t0 + 60*minute, t0 + 90*minute}},
+		},
+		{
+			name:        "overlapping ranges are merged",
+			queryString: "SELECT water_level FROM h2o_feet WHERE (time >= '2019-08-18T00:00:00Z' AND time <= '2019-08-18T00:40:00Z') OR (time >= '2019-08-18T00:30:00Z' AND time <= '2019-08-18T01:00:00Z')",
+			expected:    []Interval{{t0, t0 + 60*minute}},
+		},
+		{
+			name:        "range intersected with OR",
+			queryString: "SELECT water_level FROM h2o_feet WHERE time >= '2019-08-18T00:20:00Z' AND ((time >= '2019-08-18T00:00:00Z' AND time <= '2019-08-18T00:30:00Z') OR (time >= '2019-08-18T01:00:00Z' AND time <= '2019-08-18T01:30:00Z'))",
+			expected:    []Interval{{t0 + 20*minute, t0 + 30*minute}, {t0 + 60*minute, t0 + 90*minute}},
+		},
+		{
+			name:        "single range",
+			queryString: "SELECT water_level FROM h2o_feet WHERE time >= '2019-08-18T00:00:00Z' AND time <= '2019-08-18T00:30:00Z'",
+			expected:    []Interval{{t0, t0 + 30*minute}},
+		},
+		{
+			name:        "time OR tag cannot be split",
+			queryString: "SELECT water_level FROM h2o_feet WHERE time >= '2019-08-18T00:00:00Z' OR location = 'coyote_creek'",
+			expected:    nil,
+		},
+		{
+			name:        "without lower bound",
+			queryString: "SELECT water_level FROM h2o_feet WHERE time <= '2019-08-18T00:30:00Z' OR time >= '2019-08-18T01:00:00Z'",
+			expected:    nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ranges, _ := GetQueryTimeRanges(tt.queryString)
+			if !reflect.DeepEqual(ranges, tt.expected) {
+				t.Errorf("ranges:\t%v\nexpected:\t%v", ranges, tt.expected)
+			}
+		})
+	}
+
+	/* 只需要一个时间范围时是包含所有范围的时间范围 */
+	startTime, endTime, _ := GetQueryTimeRange(tests[0].queryString)
+	if startTime != t0 || endTime != t0+90*minute-1 {
+		t.Errorf("time range:\t[%d, %d]\nexpected:\t[%d, %d]", startTime, endTime, t0, t0+90*minute-1)
+	}
+}
+
+func TestSplitTimeRanges(t *testing.T) {
+	queryString := "SELECT water_level FROM h2o_feet WHERE location = 'coyote_creek' AND ((time >= '2019-08-18T00:00:00Z' AND time <= '2019-08-18T00:30:00Z') OR (time >= '2019-08-18T01:00:00Z' AND time <= '2019-08-18T01:30:00Z'))"
+	queries, ranges := splitTimeRanges(queryString)
+	expected := []string{
+		"SELECT water_level FROM h2o_feet WHERE location = 'coyote_creek' AND time >= '2019-08-18T00:00:00Z' AND time <= '2019-08-18T00:30:00Z'",
+		"SELECT water_level FROM h2o_feet WHERE location = 'coyote_creek' AND time >= '2019-08-18T01:00:00Z' AND time <= '2019-08-18T01:30:00Z'",
+	}
+	if !reflect.DeepEqual(queries, expected) || len(ranges) != 2 {
+		t.Fatalf("queries:\t%v\nexpected:\t%v", queries, expected)
+	}
+
+	/* 每个时间范围的语义段相同，可以分别读取cache再合并 */
+	resp := &Response{Results: []Result{{Series: []models.Row{{
+		Name:    "h2o_feet",
+		Columns: []string{"time", "water_level"},
+		Values:  [][]interface{}{{json.Number("1566086400000000000"), json.Number("8.12")}},
+	}}}}}
+	if s0, s1 := SemanticSegment(queries[0], resp), SemanticSegment(queries[1], resp); s0 != s1 {
+		t.Errorf("segment:\t%s\nexpected:\t%s", s1, s0)
+	}
+
+	if queries, _ := splitTimeRanges(expected[0]); queries != nil {
+		t.Errorf("single range should not be split: %v", queries)
+	}
+}
@@ -1,9 +1,11 @@
 package client
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"net"
+	"sync"
 	"time"
 )
 
@@ -11,6 +13,13 @@ const (
 	// UDPPayloadSize is a reasonable default payload size for UDP packets that
 	// could be travelling over the internet.
 	UDPPayloadSize = 512
+
+	// UDPJumboPayloadSize fits a 9000 byte jumbo frame after the IPv4 and
+	// UDP headers, for networks that are known to carry jumbo frames.
+	UDPJumboPayloadSize = 8972
+
+	// UDPMaxPayloadSize is the largest payload a single UDP datagram can carry.
+	UDPMaxPayloadSize = 65507
 )
 
 // UDPConfig is the config data needed to create a UDP Client.
@@ -21,12 +30,27 @@ type UDPConfig struct {
 
 	// PayloadSize is the maximum size of a UDP client message, optional
 	// Tune this based on your network. Defaults to UDPPayloadSize.
+	// Must not exceed UDPMaxPayloadSize.
 	PayloadSize int
+
+	// FlushInterval, if non-zero, makes Write buffer points instead of
+	// sending them immediately. Buffered points are sent once a full payload
+	// is ready, every FlushInterval, and on Close.
+	FlushInterval time.Duration
+
+	// ErrorHandler, if set, is called with every error returned by the
+	// underlying connection. Errors from background flushes are only
+	// reported here.
+	ErrorHandler func(error)
 }
 
 // NewUDPClient returns a client interface for writing to an InfluxDB UDP
 // service from the given config.
 func NewUDPClient(conf UDPConfig) (Client, error) {
+	if conf.PayloadSize > UDPMaxPayloadSize {
+		return nil, fmt.Errorf("udp payload size %d exceeds the maximum of %d", conf.PayloadSize, UDPMaxPayloadSize)
+	}
+
 	var udpAddr *net.UDPAddr
 	udpAddr, err := net.ResolveUDPAddr("udp", conf.Addr)
 	if err != nil {
@@ -43,38 +67,111 @@ func NewUDPClient(conf UDPConfig) (Client, error) {
 		payloadSize = UDPPayloadSize
 	}
 
-	return &udpclient{
-		conn:        conn,
-		payloadSize: payloadSize,
-	}, nil
+	uc := &udpclient{
+		conn:          conn,
+		payloadSize:   payloadSize,
+		flushInterval: conf.FlushInterval,
+		errorHandler:  conf.ErrorHandler,
+	}
+	if uc.flushInterval > 0 {
+		uc.done = make(chan struct{})
+		uc.wg.Add(1)
+		go uc.flushLoop()
+	}
+	return uc, nil
 }
 
-// Close releases the udpclient's resources.
+// Close flushes any buffered points and releases the udpclient's resources.
+// Calling it more than once returns the error of the first call.
 func (uc *udpclient) Close() error {
-	return uc.conn.Close()
+	uc.closeOnce.Do(func() {
+		if uc.done != nil {
+			close(uc.done)
+			uc.wg.Wait()
+		}
+		uc.mu.Lock()
+		uc.closeErr = uc.flush()
+		uc.mu.Unlock()
+		if err := uc.conn.Close(); uc.closeErr == nil {
+			uc.closeErr = err
+		}
+	})
+	return uc.closeErr
+}
+
+// Shutdown flushes any buffered points and closes the udpclient.
+func (uc *udpclient) Shutdown(ctx context.Context) error {
+	return waitContext(ctx, uc.Close)
 }
 
 type udpclient struct {
-	conn        io.WriteCloser
-	payloadSize int
+	conn          io.WriteCloser
+	payloadSize   int
+	flushInterval time.Duration
+	errorHandler  func(error)
+
+	mu   sync.Mutex
+	buf  []byte // points buffered until the next flush when flushInterval is set
+	done chan struct{}
+	wg   sync.WaitGroup
+
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// flushLoop sends the buffered points every flushInterval until Close.
+func (uc *udpclient) flushLoop() {
+	defer uc.wg.Done()
+	ticker := time.NewTicker(uc.flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			uc.mu.Lock()
+			uc.flush()
+			uc.mu.Unlock()
+		case <-uc.done:
+			return
+		}
+	}
+}
+
+// flush sends the buffered points as one datagram. uc.mu must be held.
+func (uc *udpclient) flush() error {
+	if len(uc.buf) == 0 {
+		return nil
+	}
+	_, err := uc.conn.Write(uc.buf)
+	uc.buf = uc.buf[:0]
+	if err != nil && uc.errorHandler != nil {
+		uc.errorHandler(err)
+	}
+	return err
 }
 
 func (uc *udpclient) Write(bp BatchPoints) error {
-	var b = make([]byte, 0, uc.payloadSize) // initial buffer size, it will grow as needed
+	uc.mu.Lock()
+	defer uc.mu.Unlock()
+	if uc.buf == nil {
+		uc.buf = make([]byte, 0, uc.payloadSize) // initial buffer size, it will grow as needed
+	}
 	var d, _ = time.ParseDuration("1" + bp.Precision())
+	resolved, err := ResolveDuplicates(bp.Points(), bp.Precision(), bp.DuplicatePolicy())
+	if err != nil {
+		return err
+	}
 
 	var delayedError error
 
 	var checkBuffer = func(n int) {
-		if len(b) > 0 && len(b)+n > uc.payloadSize {
-			if _, err := uc.conn.Write(b); err != nil {
+		if len(uc.buf) > 0 && len(uc.buf)+n > uc.payloadSize {
+			if err := uc.flush(); err != nil {
 				delayedError = err
 			}
-			b = b[:0]
 		}
 	}
 
-	for _, p := range bp.Points() {
+	for _, p := range resolved {
 		p.pt.Round(d)
 		pointSize := p.pt.StringSize() + 1 // include newline in size
 		//point := p.pt.RoundedString(d) + "\n"
@@ -82,23 +179,24 @@ func (uc *udpclient) Write(bp BatchPoints) error {
 		checkBuffer(pointSize)
 
 		if p.Time().IsZero() || pointSize <= uc.payloadSize {
-			b = p.pt.AppendString(b)
-			b = append(b, '\n')
+			uc.buf = p.pt.AppendString(uc.buf)
+			uc.buf = append(uc.buf, '\n')
 			continue
 		}
 
 		points := p.pt.Split(uc.payloadSize - 1) // account for newline character
 		for _, sp := range points {
 			checkBuffer(sp.StringSize() + 1)
-			b = sp.AppendString(b)
-			b = append(b, '\n')
+			uc.buf = sp.AppendString(uc.buf)
+			uc.buf = append(uc.buf, '\n')
 		}
 	}
 
-	if len(b) > 0 {
-		if _, err := uc.conn.Write(b); err != nil {
-			return err
-		}
+	if uc.flushInterval > 0 {
+		return delayedError
+	}
+	if err := uc.flush(); err != nil {
+		return err
 	}
 	return delayedError
 }
@@ -0,0 +1,129 @@
+package client
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// FieldTypeError is a field whose value has a different type than the field
+// already has in its measurement. InfluxDB rejects the whole point.
+type FieldTypeError struct {
+	Measurement string
+	Field       string
+	Type        string // type of the value, as in FieldTypes
+	Expected    string // type of the field
+}
+
+func (e *FieldTypeError) Error() string {
+	return fmt.Sprintf("field type conflict: %s.%s is %s, got %s", e.Measurement, e.Field, e.Expected, e.Type)
+}
+
+// InvalidPoint is a point of a batch that failed validation.
+type InvalidPoint struct {
+	Index int    // index of the point in the batch
+	Line  string // line protocol of the point
+	Err   error
+}
+
+// ValidationError lists the points of a batch that failed validation.
+type ValidationError struct {
+	Points []InvalidPoint
+}
+
+func (e *ValidationError) Error() string {
+	if len(e.Points) == 1 {
+		return fmt.Sprintf("invalid point %d: %v", e.Points[0].Index, e.Points[0].Err)
+	}
+	msgs := make([]string, 0, len(e.Points))
+	for _, p := range e.Points {
+		msgs = append(msgs, fmt.Sprintf("point %d: %v", p.Index, p.Err))
+	}
+	return fmt.Sprintf("%d invalid points: %s", len(e.Points), strings.Join(msgs, "; "))
+}
+
+// ValidatePoint checks that every field of p has the type the schema holds
+// for it, in the form of FieldTypes. Fields the schema does not know are
+// valid. The first conflicting field, in name order, is returned as a
+// *FieldTypeError.
+func ValidatePoint(p *Point, schema map[string]map[string]string) error {
+	return validatePoint(p, schema, nil)
+}
+
+// ValidatePoints checks every point with ValidatePoint, and that fields
+// missing from the schema have the same type in all the points, as InfluxDB
+// requires within a batch. It returns a *ValidationError listing the
+// invalid points, or nil.
+func ValidatePoints(points []*Point, schema map[string]map[string]string) error {
+	var invalid []InvalidPoint
+	seen := make(map[string]map[string]string)
+	for i, p := range points {
+		if p == nil {
+			continue
+		}
+		if err := validatePoint(p, schema, seen); err != nil {
+			invalid = append(invalid, InvalidPoint{Index: i, Line: p.String(), Err: err})
+		}
+	}
+	if len(invalid) == 0 {
+		return nil
+	}
+	return &ValidationError{Points: invalid}
+}
+
+// validatePoint validates p against the schema and, for fields the schema
+// does not know, against the types in seen, recording the new ones.
+func validatePoint(p *Point, schema, seen map[string]map[string]string) error {
+	fields, err := p.Fields()
+	if err != nil {
+		return err
+	}
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	measurement := p.Name()
+	for _, name := range names {
+		typ := fieldValueType(fields[name])
+		expected, ok := schema[measurement][name]
+		if !ok && seen != nil {
+			expected, ok = seen[measurement][name]
+		}
+		if !ok {
+			continue
+		}
+		if typ != expected {
+			return &FieldTypeError{Measurement: measurement, Field: name, Type: typ, Expected: expected}
+		}
+	}
+	if seen != nil {
+		for _, name := range names {
+			if _, ok := schema[measurement][name]; ok {
+				continue
+			}
+			if seen[measurement] == nil {
+				seen[measurement] = make(map[string]string)
+			}
+			seen[measurement][name] = fieldValueType(fields[name])
+		}
+	}
+	return nil
+}
+
+// fieldValueType returns the type of a field value as stored in FieldTypes;
+// unsigned integers are integers like in fieldTypes.
+func fieldValueType(v interface{}) string {
+	switch v.(type) {
+	case float64:
+		return "float64"
+	case int64, uint64:
+		return "int64"
+	case string:
+		return "string"
+	case bool:
+		return "bool"
+	}
+	return fmt.Sprintf("%T", v)
+}
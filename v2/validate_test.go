@@ -0,0 +1,87 @@
+package client
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestValidatePoint(t *testing.T) {
+	schema := map[string]map[string]string{"h2o_feet": {"water_level": "float64", "level description": "string"}}
+	ts := time.Unix(0, 1566000000000000000)
+
+	valid, _ := NewPoint("h2o_feet", nil, map[string]interface{}{"water_level": 8.12, "level description": "high", "new": int64(1)}, ts)
+	if err := ValidatePoint(valid, schema); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	invalid, _ := NewPoint("h2o_feet", nil, map[string]interface{}{"water_level": int64(8), "level description": true}, ts)
+	err := ValidatePoint(invalid, schema)
+	var ferr *FieldTypeError
+	if !errors.As(err, &ferr) {
+		t.Fatalf("error:\t%v\nexpected:\t%s", err, "FieldTypeError")
+	}
+	expected := FieldTypeError{Measurement: "h2o_feet", Field: "level description", Type: "bool", Expected: "string"}
+	if *ferr != expected {
+		t.Errorf("error:\t%+v\nexpected:\t%+v", *ferr, expected)
+	}
+}
+
+func TestValidatePoints(t *testing.T) {
+	schema := map[string]map[string]string{"h2o_feet": {"water_level": "float64"}}
+	ts := time.Unix(0, 1566000000000000000)
+	p0, _ := NewPoint("h2o_feet", nil, map[string]interface{}{"water_level": 8.12, "index": int64(3)}, ts)
+	p1, _ := NewPoint("h2o_feet", nil, map[string]interface{}{"water_level": int64(8)}, ts)
+	p2, _ := NewPoint("h2o_feet", nil, map[string]interface{}{"index": 3.5}, ts)
+	p3, _ := NewPoint("h2o_pH", nil, map[string]interface{}{"index": 3.5}, ts)
+
+	/* schema 中没有的 index 以第一次出现的类型为准，其他表不受影响 */
+	err := ValidatePoints([]*Point{p0, p1, p2, nil, p3}, schema)
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("error:\t%v\nexpected:\t%s", err, "ValidationError")
+	}
+	if len(verr.Points) != 2 || verr.Points[0].Index != 1 || verr.Points[1].Index != 2 {
+		t.Fatalf("invalid points:\t%+v", verr.Points)
+	}
+	if verr.Points[1].Line != "h2o_feet index=3.5 1566000000000000000" {
+		t.Errorf("line:\t%s", verr.Points[1].Line)
+	}
+	expected := "2 invalid points: point 1: field type conflict: h2o_feet.water_level is float64, got int64; point 2: field type conflict: h2o_feet.index is int64, got float64"
+	if err.Error() != expected {
+		t.Errorf("error:\t%s\nexpected:\t%s", err, expected)
+	}
+
+	if err := ValidatePoints([]*Point{p0, p3}, schema); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestWrite_Validate(t *testing.T) {
+	defer SetSchema(SetSchema(&Schema{FieldTypes: map[string]map[string]string{"h2o_feet": {"water_level": "float64"}}}))
+	writes := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writes++
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+
+	pt, _ := NewPoint("h2o_feet", nil, map[string]interface{}{"water_level": int64(8)}, time.Unix(0, 1566000000000000000))
+	bp, _ := NewBatchPoints(BatchPointsConfig{Database: MyDB})
+	bp.AddPoint(pt)
+
+	/* 不检查时照常写入，检查时不发送请求 */
+	c, _ := NewHTTPClient(HTTPConfig{Addr: ts.URL})
+	defer c.Close()
+	if err := c.Write(bp); err != nil || writes != 1 {
+		t.Errorf("error:\t%v writes:\t%d", err, writes)
+	}
+	vc, _ := NewHTTPClient(HTTPConfig{Addr: ts.URL, ValidateWrites: true})
+	defer vc.Close()
+	var verr *ValidationError
+	if err := vc.Write(bp); !errors.As(err, &verr) || writes != 1 {
+		t.Errorf("error:\t%v writes:\t%d", err, writes)
+	}
+}
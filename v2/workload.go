@@ -0,0 +1,265 @@
+package client
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/InfluxDB-client/memcache"
+)
+
+// WorkloadConfig 配置查询模式的学习：记录每个查询模板到达的时间和时间范围相对到达时间的偏移，
+// 找出周期性到达的查询（比如定时刷新的仪表盘），在下一次预计到达之前提前查询并存入cache
+type WorkloadConfig struct {
+	Client          Client           // 执行刷新查询的数据库连接
+	Cache           *memcache.Client // 存入刷新结果的cache
+	Lead            time.Duration    // 在预计到达之前多久刷新，默认 5s
+	MinObservations int              // 判定为周期性查询需要的最少到达次数，默认 3
+	Tolerance       float64          // 到达间隔和平均周期的最大相对偏差，默认 0.2
+	MaxPatterns     int              // 最多记录的查询模式数，超过时丢弃最久没有到达的，默认 1000
+}
+
+// WorkloadPattern 是学习到的一个查询模式
+type WorkloadPattern struct {
+	Template     string        // QueryTemplate 得到的查询模板
+	StartOffset  time.Duration // 时间范围的下界相对到达时间的偏移，通常为负数
+	EndOffset    time.Duration // 时间范围的上界相对到达时间的偏移
+	Period       time.Duration // 到达的周期，不是周期性查询时为 0
+	Observations int           // 记录的到达次数
+	LastArrival  time.Time
+}
+
+// WorkloadStats 是查询模式学习的计数
+type WorkloadStats struct {
+	Patterns  int    // 记录的查询模式数
+	Periodic  int    // 其中周期性的查询模式数
+	Refreshed uint64 // 完成的刷新查询数
+	Errors    uint64 // 失败的刷新查询数
+}
+
+// workloadHistory 是每个查询模式保留的到达时间数
+const workloadHistory = 8
+
+type workloadPattern struct {
+	WorkloadPattern
+	query    string      // 最近一次到达的查询语句
+	arrivals []time.Time // 最近的到达时间，升序
+	timer    *time.Timer // 下一次刷新
+}
+
+// WorkloadLearner 从查询流中学习周期性的查询，并在它们到达之前刷新cache
+type WorkloadLearner struct {
+	conf WorkloadConfig
+
+	refreshed uint64
+	errors    uint64
+
+	mu       sync.Mutex
+	patterns map[string]*workloadPattern
+	stopped  bool
+	wg       sync.WaitGroup
+}
+
+// Workload 是调用方记录查询流的查询模式学习器，为 nil 时不学习
+var Workload *WorkloadLearner
+
+// NewWorkloadLearner 创建查询模式学习器
+func NewWorkloadLearner(conf WorkloadConfig) *WorkloadLearner {
+	if conf.Lead <= 0 {
+		conf.Lead = 5 * time.Second
+	}
+	if conf.MinObservations < 2 {
+		conf.MinObservations = 3
+	}
+	if conf.Tolerance <= 0 {
+		conf.Tolerance = 0.2
+	}
+	if conf.MaxPatterns <= 0 {
+		conf.MaxPatterns = 1000
+	}
+	return &WorkloadLearner{conf: conf, patterns: make(map[string]*workloadPattern)}
+}
+
+// Observe 记录查询 queryString 在 at 时刻到达，不论是否命中cache都应该调用；
+// 查询模式成为周期性的之后，在下一次预计到达之前 Lead 时间刷新cache
+func (wl *WorkloadLearner) Observe(queryString string, at time.Time) {
+	startTime, endTime, relative := GetQueryTimeRange(queryString)
+	if startTime < 0 {
+		return
+	}
+	/* 依赖当前时间的查询，时间范围是相对现在计算的 */
+	ref := at
+	if relative {
+		ref = time.Now()
+	}
+	template := QueryTemplate(queryString)
+	startOffset := time.Duration(startTime - ref.UnixNano()).Round(time.Second)
+	endOffset := time.Duration(endTime - ref.UnixNano()).Round(time.Second)
+	key := template + "#" + startOffset.String() + "#" + endOffset.String()
+
+	wl.mu.Lock()
+	defer wl.mu.Unlock()
+	if wl.stopped {
+		return
+	}
+	p, ok := wl.patterns[key]
+	if !ok {
+		if len(wl.patterns) >= wl.conf.MaxPatterns {
+			wl.evict()
+		}
+		p = &workloadPattern{WorkloadPattern: WorkloadPattern{Template: template, StartOffset: startOffset, EndOffset: endOffset}}
+		wl.patterns[key] = p
+	}
+	p.query = queryString
+	p.Observations++
+	p.LastArrival = at
+	p.arrivals = append(p.arrivals, at)
+	if len(p.arrivals) > workloadHistory {
+		p.arrivals = p.arrivals[len(p.arrivals)-workloadHistory:]
+	}
+	p.Period = wl.period(p.arrivals)
+
+	if p.timer != nil {
+		p.timer.Stop()
+		p.timer = nil
+	}
+	if p.Period > 0 {
+		delay := time.Until(at.Add(p.Period - wl.conf.Lead))
+		if delay < 0 {
+			delay = 0
+		}
+		p.timer = time.AfterFunc(delay, func() { wl.refresh(p) })
+	}
+}
+
+// period 返回到达时间的平均间隔，间隔不够稳定或次数不够时返回 0
+func (wl *WorkloadLearner) period(arrivals []time.Time) time.Duration {
+	if len(arrivals) < wl.conf.MinObservations {
+		return 0
+	}
+	mean := arrivals[len(arrivals)-1].Sub(arrivals[0]) / time.Duration(len(arrivals)-1)
+	if mean <= wl.conf.Lead {
+		return 0
+	}
+	for i := 1; i < len(arrivals); i++ {
+		d := arrivals[i].Sub(arrivals[i-1]) - mean
+		if d < 0 {
+			d = -d
+		}
+		if float64(d) > wl.conf.Tolerance*float64(mean) {
+			return 0
+		}
+	}
+	return mean
+}
+
+// refresh 按预计到达时间的时间范围查询并存入cache，上界不超过当前时间，剩下的部分由查询到达时补齐
+func (wl *WorkloadLearner) refresh(p *workloadPattern) {
+	wl.mu.Lock()
+	if wl.stopped {
+		wl.mu.Unlock()
+		return
+	}
+	arrival := p.LastArrival.Add(p.Period)
+	startTime := arrival.Add(p.StartOffset).UnixNano()
+	endTime := arrival.Add(p.EndOffset).UnixNano()
+	queryString := p.query
+	wl.wg.Add(1)
+	wl.mu.Unlock()
+	defer wl.wg.Done()
+
+	if now := time.Now().UnixNano(); endTime > now {
+		endTime = now
+	}
+	if startTime > endTime {
+		return
+	}
+	refreshQuery, err := QueryWithTimeRange(queryString, startTime, endTime)
+	if err == nil {
+		err = wl.fetch(refreshQuery)
+	}
+	if err != nil {
+		atomic.AddUint64(&wl.errors, 1)
+		return
+	}
+	atomic.AddUint64(&wl.refreshed, 1)
+}
+
+func (wl *WorkloadLearner) fetch(queryString string) error {
+	if err := waitDBLimiter(queryString); err != nil {
+		return err
+	}
+	resp, err := wl.conf.Client.Query(NewQuery(queryString, MyDB, "ns"))
+	if err != nil {
+		return err
+	}
+	if err := resp.Error(); err != nil {
+		return err
+	}
+	return setResponse(queryString, "ns", resp, wl.conf.Cache)
+}
+
+// evict 丢弃最久没有到达的查询模式
+func (wl *WorkloadLearner) evict() {
+	var oldest string
+	for key, p := range wl.patterns {
+		if oldest == "" || p.LastArrival.Before(wl.patterns[oldest].LastArrival) {
+			oldest = key
+		}
+	}
+	if p, ok := wl.patterns[oldest]; ok {
+		if p.timer != nil {
+			p.timer.Stop()
+		}
+		delete(wl.patterns, oldest)
+	}
+}
+
+// Patterns 返回学习到的查询模式，周期性的在前，按到达次数降序排列
+func (wl *WorkloadLearner) Patterns() []WorkloadPattern {
+	wl.mu.Lock()
+	patterns := make([]WorkloadPattern, 0, len(wl.patterns))
+	for _, p := range wl.patterns {
+		patterns = append(patterns, p.WorkloadPattern)
+	}
+	wl.mu.Unlock()
+
+	sort.Slice(patterns, func(i, j int) bool {
+		if (patterns[i].Period > 0) != (patterns[j].Period > 0) {
+			return patterns[i].Period > 0
+		}
+		if patterns[i].Observations != patterns[j].Observations {
+			return patterns[i].Observations > patterns[j].Observations
+		}
+		return patterns[i].Template < patterns[j].Template
+	})
+	return patterns
+}
+
+// Stats 返回当前的计数
+func (wl *WorkloadLearner) Stats() WorkloadStats {
+	stats := WorkloadStats{Refreshed: atomic.LoadUint64(&wl.refreshed), Errors: atomic.LoadUint64(&wl.errors)}
+	wl.mu.Lock()
+	defer wl.mu.Unlock()
+	stats.Patterns = len(wl.patterns)
+	for _, p := range wl.patterns {
+		if p.Period > 0 {
+			stats.Periodic++
+		}
+	}
+	return stats
+}
+
+// Stop 取消所有计划的刷新，并等待正在执行的刷新完成
+func (wl *WorkloadLearner) Stop() {
+	wl.mu.Lock()
+	wl.stopped = true
+	for _, p := range wl.patterns {
+		if p.timer != nil {
+			p.timer.Stop()
+		}
+	}
+	wl.mu.Unlock()
+	wl.wg.Wait()
+}
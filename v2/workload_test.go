@@ -0,0 +1,54 @@
+package client
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/InfluxDB-client/memcache"
+)
+
+// rangeQuery 返回时间范围为 [at-1h, at] 的查询
+func rangeQuery(at time.Time) string {
+	return "SELECT water_level FROM h2o_feet WHERE location = 'coyote_creek' AND time >= '" +
+		at.Add(-time.Hour).UTC().Format(time.RFC3339Nano) + "' AND time <= '" + at.UTC().Format(time.RFC3339Nano) + "'"
+}
+
+func TestWorkloadLearner(t *testing.T) {
+	var commands []string
+	ts := newAdminServer(&commands, `{"results":[{"statement_id":0}]}`)
+	defer ts.Close()
+	c, _ := NewHTTPClient(HTTPConfig{Addr: ts.URL})
+	defer c.Close()
+
+	wl := NewWorkloadLearner(WorkloadConfig{Client: c, Cache: memcache.New("localhost:0")})
+	now := time.Now().Truncate(time.Second)
+
+	/* 每分钟到达一次的仪表盘查询，下一次预计在 now 到达，立即刷新 */
+	for i := 3; i >= 1; i-- {
+		at := now.Add(-time.Duration(i) * time.Minute)
+		wl.Observe(rangeQuery(at), at)
+	}
+	/* 不规则到达的查询 */
+	for _, d := range []time.Duration{10 * time.Minute, 9 * time.Minute, 2 * time.Minute} {
+		at := now.Add(-d)
+		wl.Observe(strings.Replace(rangeQuery(at), "h2o_feet", "h2o_quality", 1), at)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for wl.Stats().Refreshed+wl.Stats().Errors == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	wl.Stop()
+
+	patterns := wl.Patterns()
+	if len(patterns) != 2 || patterns[0].Period != time.Minute || patterns[0].StartOffset != -time.Hour || patterns[1].Period != 0 {
+		t.Errorf("patterns:\t%+v", patterns)
+	}
+	if len(commands) != 1 || QueryTemplate(commands[0]) != QueryTemplate(rangeQuery(now)) {
+		t.Errorf("refresh queries:\t%q", commands)
+	}
+	if stats := wl.Stats(); stats.Patterns != 2 || stats.Periodic != 1 {
+		t.Errorf("stats:\t%+v", stats)
+	}
+}
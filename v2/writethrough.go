@@ -0,0 +1,312 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/InfluxDB-client/memcache"
+	"github.com/influxdata/influxdb1-client/models"
+)
+
+// WriteThroughConfig 配置写穿透：Write 成功后把写入的数据点追加到cache中匹配的语义段，
+// 并把语义段的覆盖范围延长到这些数据点，紧接着的查询可以直接命中cache；
+// 通过它执行的 SELECT INTO 不能追加，写入的表受影响的语义段被删除，见 InvalidateSelectInto
+type WriteThroughConfig struct {
+	Client  Client                          // 实际写入数据库的连接，查询也交给它
+	Cache   *memcache.Client                // 追加数据点的cache
+	MaxGap  time.Duration                   // 新数据点和覆盖范围末尾的最大间隔，超过时不追加；为 0 时不限制
+	OnError func(segment string, err error) // 追加或删除失败时调用，不影响 Write 和 Query 的结果
+}
+
+// NewWriteThroughClient 返回写穿透的 Client，只追加到没有聚合、没有 field 谓词的原始数据查询的语义段：
+// 数据点的 measurement 和 tags 要和语义段中的某张表一致，每一列都要有值且类型相同，时间在覆盖范围末尾之后。
+// 语义段有多张表（GROUP BY tag）而数据点不属于其中任何一张时，可能是新的表，这个语义段不追加；
+// 只有一张表时不属于这张表的数据点当作被 WHERE 中的 tag 谓词过滤掉
+func NewWriteThroughClient(conf WriteThroughConfig) (Client, error) {
+	if conf.Client == nil || conf.Cache == nil {
+		return nil, errors.New("write-through needs both a client and a cache")
+	}
+	return &writeThroughClient{conf: conf}, nil
+}
+
+type writeThroughClient struct {
+	conf WriteThroughConfig
+}
+
+// Write 写入数据库，成功后把数据点追加到cache，追加失败只通过 OnError 报告
+func (wc *writeThroughClient) Write(bp BatchPoints) error {
+	if err := wc.conf.Client.Write(bp); err != nil {
+		return err
+	}
+	for _, segment := range Coverage.Segments() {
+		if err := writeThrough(segment, bp.Points(), wc.conf.MaxGap, wc.conf.Cache); err != nil && wc.conf.OnError != nil {
+			wc.conf.OnError(segment, err)
+		}
+	}
+	return nil
+}
+
+// writeThrough 把 points 中属于语义段 segment 且在覆盖范围末尾之后的数据点追加到cache，并延长覆盖范围
+func writeThrough(segment string, points []*Point, maxGap time.Duration, mc *memcache.Client) error {
+	resp, tableSegments, ok := writeThroughResponse(segment, points, maxGap)
+	if !ok {
+		return nil
+	}
+	_, endTime := GetResponseTimeRange(resp)
+	return Append(segment, resp.ToByteArrayWithPrecision(tableSegments, "ns"), endTime, mc)
+}
+
+// wtTable 是语义段 SM 中的一张表
+type wtTable struct {
+	sm   string // 这张表的 SM，如 (h2o_feet.location=coyote_creek)
+	name string
+	tags map[string]string
+}
+
+// wtColumn 是语义段 SF 中的一列
+type wtColumn struct {
+	name     string
+	source   string // tag 或 field，为空时先找 field 再找 tag
+	datatype string
+}
+
+// writeThroughResponse 用属于语义段的数据点构造结果和每张表的语义段；语义段不能追加或者没有要追加的数据点时 ok 为 false
+func writeThroughResponse(segment string, points []*Point, maxGap time.Duration) (resp *Response, tableSegments []string, ok bool) {
+	covered, ok := Coverage.Covered(segment)
+	if !ok || len(covered) == 0 {
+		return nil, nil, false
+	}
+	end := covered[len(covered)-1].End
+
+	parts := strings.Split(segment, "#")
+	if len(parts) != 4 || parts[2] != "{empty}" || parts[3] != "{empty,empty}" {
+		return nil, nil, false
+	}
+	tables, ok := parseWriteThroughSM(parts[0])
+	if !ok {
+		return nil, nil, false
+	}
+	columns, ok := parseWriteThroughSF(parts[1])
+	if !ok {
+		return nil, nil, false
+	}
+
+	rows := make([][][]interface{}, len(tables))
+	measurements := make(map[string]bool, len(tables))
+	for _, t := range tables {
+		measurements[t.name] = true
+	}
+	minTime := int64(-1)
+	for _, p := range points {
+		ts := p.UnixNano()
+		if !measurements[p.Name()] || ts <= end {
+			continue
+		}
+		i := matchTable(tables, p)
+		if i < 0 {
+			if len(tables) > 1 {
+				return nil, nil, false
+			}
+			continue
+		}
+		row, ok := pointRow(p, columns)
+		if !ok {
+			return nil, nil, false
+		}
+		rows[i] = append(rows[i], row)
+		if minTime < 0 || ts < minTime {
+			minTime = ts
+		}
+	}
+	if minTime < 0 || (maxGap > 0 && minTime-end > int64(maxGap)) {
+		return nil, nil, false
+	}
+
+	names := make([]string, 0, len(columns)+1)
+	names = append(names, "time")
+	for _, c := range columns {
+		names = append(names, c.name)
+	}
+	series := make([]models.Row, 0, len(tables))
+	for i, t := range tables {
+		if len(rows[i]) == 0 {
+			continue
+		}
+		sort.SliceStable(rows[i], func(a, b int) bool {
+			ta, _ := rows[i][a][0].(json.Number).Int64()
+			tb, _ := rows[i][b][0].(json.Number).Int64()
+			return ta < tb
+		})
+		series = append(series, models.Row{Name: t.name, Tags: t.tags, Columns: names, Values: rows[i]})
+		tableSegments = append(tableSegments, "{"+t.sm+"}#"+strings.Join(parts[1:], "#"))
+	}
+	return &Response{Results: []Result{{Series: series}}}, tableSegments, true
+}
+
+// parseWriteThroughSM 把 {(m.tag=v,m.tag2=v2)(m.tag=v3,...)} 拆分成每张表，没有 tag 时为 (m.empty)
+func parseWriteThroughSM(sm string) ([]wtTable, bool) {
+	if !strings.HasPrefix(sm, "{(") || !strings.HasSuffix(sm, ")}") {
+		return nil, false
+	}
+	tables := make([]wtTable, 0)
+	for _, t := range strings.Split(sm[2:len(sm)-2], ")(") {
+		table := wtTable{sm: "(" + t + ")", tags: make(map[string]string)}
+		for _, kv := range strings.Split(t, ",") {
+			dot := strings.Index(kv, ".")
+			if dot <= 0 {
+				return nil, false
+			}
+			table.name = unescapeSegment(kv[:dot])
+			if kv[dot+1:] == "empty" {
+				continue
+			}
+			eq := strings.Index(kv, "=")
+			if eq <= dot {
+				return nil, false
+			}
+			table.tags[unescapeSegment(kv[dot+1:eq])] = unescapeSegment(kv[eq+1:])
+		}
+		tables = append(tables, table)
+	}
+	return tables, true
+}
+
+// parseWriteThroughSF 解析 {col[type],...}，有别名或表达式的列不能直接从数据点得到，返回 false
+func parseWriteThroughSF(sf string) ([]wtColumn, bool) {
+	sf = strings.TrimSuffix(strings.TrimPrefix(sf, "{"), "}")
+	if sf == "" {
+		return nil, false
+	}
+	columns := make([]wtColumn, 0)
+	for _, f := range strings.Split(sf, ",") {
+		idx := strings.Index(f, "[")
+		if idx <= 0 || !strings.HasSuffix(f, "]") || strings.ContainsAny(f[:idx], "@()"+sfOperators) {
+			return nil, false
+		}
+		name, source := unescapeSegment(f[:idx]), ""
+		if i := strings.Index(name, "::"); i >= 0 {
+			name, source = name[:i], name[i+2:]
+		}
+		columns = append(columns, wtColumn{name: name, source: source, datatype: f[idx+1 : len(f)-1]})
+	}
+	return columns, true
+}
+
+// matchTable 返回数据点所属的表的序号：measurement 相同，表中的 tag 和数据点的 tag 都相同；没有时返回 -1
+func matchTable(tables []wtTable, p *Point) int {
+	tags := p.Tags()
+	for i, t := range tables {
+		if t.name != p.Name() {
+			continue
+		}
+		match := true
+		for k, v := range t.tags {
+			if tags[k] != v {
+				match = false
+				break
+			}
+		}
+		if match {
+			return i
+		}
+	}
+	return -1
+}
+
+// pointRow 把数据点转换成结果中的一行，时间戳为纳秒；某一列没有值或者类型不同时返回 false
+func pointRow(p *Point, columns []wtColumn) ([]interface{}, bool) {
+	fields, err := p.Fields()
+	if err != nil {
+		return nil, false
+	}
+	tags := p.Tags()
+	row := make([]interface{}, 0, len(columns)+1)
+	row = append(row, json.Number(strconv.FormatInt(p.UnixNano(), 10)))
+	for _, c := range columns {
+		if v, ok := fields[c.name]; ok && c.source != "tag" {
+			value, ok := columnValue(v, c.datatype)
+			if !ok {
+				return nil, false
+			}
+			row = append(row, value)
+			continue
+		}
+		if v, ok := tags[c.name]; ok && c.source != "field" && c.datatype == "string" {
+			row = append(row, v)
+			continue
+		}
+		return nil, false
+	}
+	return row, true
+}
+
+// columnValue 把 field 的值转换成结果中 datatype 类型的列的值，和数据库返回的 json 解码后相同
+func columnValue(v interface{}, datatype string) (interface{}, bool) {
+	switch datatype {
+	case "int64":
+		switch n := v.(type) {
+		case int64:
+			return json.Number(strconv.FormatInt(n, 10)), true
+		case uint64:
+			return json.Number(strconv.FormatUint(n, 10)), true
+		}
+	case "float64":
+		if f, ok := v.(float64); ok {
+			s := strconv.FormatFloat(f, 'g', -1, 64)
+			if !strings.ContainsAny(s, ".eE") { // 整数形式的浮点数会被当作 int64，加上小数点
+				s += ".0"
+			}
+			return json.Number(s), true
+		}
+	case "bool":
+		if b, ok := v.(bool); ok {
+			return b, true
+		}
+	case "string":
+		if s, ok := v.(string); ok {
+			return s, true
+		}
+	}
+	return nil, false
+}
+
+func (wc *writeThroughClient) Ping(timeout time.Duration) (time.Duration, string, error) {
+	return wc.conf.Client.Ping(timeout)
+}
+
+// Query 执行查询，查询中有 SELECT INTO 时删除写入的表在cache中受影响的语义段，删除失败只通过 OnError 报告，segment 为空
+func (wc *writeThroughClient) Query(q Query) (*Response, error) {
+	resp, err := wc.conf.Client.Query(q)
+	if err != nil {
+		return resp, err
+	}
+	if _, err := InvalidateSelectInto(q.Command, wc.conf.Cache); err != nil && wc.conf.OnError != nil {
+		wc.conf.OnError("", err)
+	}
+	return resp, nil
+}
+
+func (wc *writeThroughClient) QueryAsChunk(q Query) (*ChunkedResponse, error) {
+	return wc.conf.Client.QueryAsChunk(q)
+}
+
+func (wc *writeThroughClient) QueryFlux(ctx context.Context, flux string) (*Response, error) {
+	return queryFlux(ctx, wc.conf.Client, flux)
+}
+
+func (wc *writeThroughClient) Close() error {
+	return wc.conf.Client.Close()
+}
+
+// Shutdown shuts down the client and closes the connections to the cache.
+func (wc *writeThroughClient) Shutdown(ctx context.Context) error {
+	if err := shutdownClient(ctx, wc.conf.Client); err != nil {
+		return err
+	}
+	return wc.conf.Cache.Close()
+}
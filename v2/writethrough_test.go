@@ -0,0 +1,144 @@
+package client
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/InfluxDB-client/memcache"
+)
+
+func TestWriteThroughResponse(t *testing.T) {
+	coverage := Coverage
+	defer func() { Coverage = coverage }()
+
+	point := func(measurement, location string, fields map[string]interface{}, ts int64) *Point {
+		p, _ := NewPoint(measurement, map[string]string{"location": location}, fields, time.Unix(0, ts))
+		return p
+	}
+	level := func(v float64) map[string]interface{} { return map[string]interface{}{"water_level": v} }
+	points := []*Point{
+		point("h2o_feet", "coyote_creek", level(8), 150),
+		point("h2o_feet", "coyote_creek", level(7.5), 50), // 已经覆盖的时间
+		point("h2o_feet", "santa_monica", level(2.1), 160),
+		point("h2o_pH", "coyote_creek", map[string]interface{}{"pH": int64(7)}, 170),
+	}
+
+	tests := []struct {
+		name     string
+		segment  string
+		points   []*Point
+		maxGap   time.Duration
+		expected [][]interface{}
+	}{
+		{
+			name:     "append after coverage end",
+			segment:  "{(h2o_feet.location=coyote_creek)}#{water_level[float64]}#{empty}#{empty,empty}",
+			points:   points,
+			expected: [][]interface{}{{json.Number("150"), json.Number("8.0")}},
+		},
+		{
+			name:     "tag column",
+			segment:  "{(h2o_feet.location=coyote_creek)}#{water_level[float64],location::tag[string]}#{empty}#{empty,empty}",
+			points:   points[:1],
+			expected: [][]interface{}{{json.Number("150"), json.Number("8.0"), "coyote_creek"}},
+		},
+		{
+			name:    "new table of GROUP BY",
+			segment: "{(h2o_feet.location=coyote_creek)(h2o_feet.location=santa_fe)}#{water_level[float64]}#{empty}#{empty,empty}",
+			points:  points,
+		},
+		{
+			name:    "aggregation",
+			segment: "{(h2o_feet.location=coyote_creek)}#{water_level[float64]}#{empty}#{mean,12m}",
+			points:  points,
+		},
+		{
+			name:    "field predicate",
+			segment: "{(h2o_feet.location=coyote_creek)}#{water_level[float64]}#{(water_level>8[float64])}#{empty,empty}",
+			points:  points,
+		},
+		{
+			name:    "missing column",
+			segment: "{(h2o_feet.location=coyote_creek)}#{water_level[float64],index[int64]}#{empty}#{empty,empty}",
+			points:  points,
+		},
+		{
+			name:    "type mismatch",
+			segment: "{(h2o_feet.location=coyote_creek)}#{water_level[int64]}#{empty}#{empty,empty}",
+			points:  points,
+		},
+		{
+			name:    "gap too large",
+			segment: "{(h2o_feet.location=coyote_creek)}#{water_level[float64]}#{empty}#{empty,empty}",
+			points:  points,
+			maxGap:  10,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			Coverage = NewCoverageIndex()
+			Coverage.Add(tt.segment, Interval{0, 100})
+			resp, segments, ok := writeThroughResponse(tt.segment, tt.points, tt.maxGap)
+			if tt.expected == nil {
+				if ok {
+					t.Errorf("segment should not be appended: %v", resp)
+				}
+				return
+			}
+			if !ok {
+				t.Fatalf("segment should be appended")
+			}
+			if values := resp.Results[0].Series[0].Values; !reflect.DeepEqual(values, tt.expected) {
+				t.Errorf("values:\t%v\nexpected:\t%v", values, tt.expected)
+			}
+			if !reflect.DeepEqual(segments, []string{tt.segment}) {
+				t.Errorf("segments:\t%v\nexpected:\t%v", segments, []string{tt.segment})
+			}
+
+			/* 追加的数据转换成字节数组后和存入的查询结果格式相同 */
+			converted := ByteArrayToResponse(append(resp.ToByteArrayWithPrecision(segments, "ns"), []byte("\r\n")...))
+			if v := converted.Results[0].Series[0].Values[0][1]; v != json.Number("8") {
+				t.Errorf("value:\t%v\nexpected:\t%v", v, json.Number("8"))
+			}
+		})
+	}
+}
+
+func TestWriteThroughClient_Write(t *testing.T) {
+	coverage := Coverage
+	defer func() { Coverage = coverage }()
+	Coverage = NewCoverageIndex()
+	segment := "{(cpu.empty)}#{value[float64]}#{empty}#{empty,empty}"
+	Coverage.Add(segment, Interval{-100, -1})
+
+	var writes int32
+	ts := newWriteServer(&writes, http.StatusNoContent)
+	defer ts.Close()
+	db, _ := NewHTTPClient(HTTPConfig{Addr: ts.URL})
+
+	var failed []string
+	c, err := NewWriteThroughClient(WriteThroughConfig{
+		Client:  db,
+		Cache:   memcache.New("localhost:0"),
+		OnError: func(segment string, err error) { failed = append(failed, segment) },
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer c.Close()
+
+	/* 写入数据库成功，追加到cache失败只通过 OnError 报告 */
+	if err := c.Write(testBatchPoints()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if writes != 1 || !reflect.DeepEqual(failed, []string{segment}) {
+		t.Errorf("writes:\t%d\nfailed:\t%v", writes, failed)
+	}
+	if covered, _ := Coverage.Covered(segment); !reflect.DeepEqual(covered, []Interval{{-100, -1}}) {
+		t.Errorf("coverage:\t%v\nexpected:\t%v", covered, []Interval{{-100, -1}})
+	}
+}